@@ -0,0 +1,387 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/CSCSoftware/wahoo/db"
+	"github.com/CSCSoftware/wahoo/wa"
+)
+
+// commands are the subcommands that can be given as the first argument,
+// before the flags. Without one wahoo runs the MCP server.
+var commands = []struct {
+	name, args, help string
+}{
+	{"serve", "", "Run the MCP server on stdin/stdout (the default)"},
+	{"validate-config", "", "Check the settings from flags, environment and config file and print them"},
+	{"pair", "", "Link the -account to WhatsApp by QR code, or by pairing code with -pair-phone"},
+	{"status", "", "Show whether the -account is paired and what its database holds"},
+	{"send", "<recipient> <message>", "Send a text message to a phone number or JID"},
+	{"export-chat", "<chat_jid> <file>", "Export a chat to a .json, .txt or .html file"},
+	{"query", "<sql>", "Run a read-only SQL query against the messages database"},
+	{"import-chat", "<chat_jid> <file>", "Import the messages of a .txt file from WhatsApp's \"Export chat\" into a chat, asking for the JIDs of participants not in -import-participants"},
+	{"import-whatsapp-mcp", "<messages.db>", "Merge the chats and messages of the Python whatsapp-mcp bridge's database into the -account's store"},
+	{"backup-store", "", "Write a backup of the -account's messages database (and media with -backup-media) to -backup-dir"},
+	{"restore-store", "<backup>", "Replace the -account's messages database with a backup directory written by backup-store (and restore its media with -backup-media)"},
+}
+
+// lookupCommand returns the positional arguments a command takes, and
+// whether it exists.
+func lookupCommand(name string) (args string, ok bool) {
+	for _, c := range commands {
+		if c.name == name {
+			return c.args, true
+		}
+	}
+	return "", false
+}
+
+// usage prints the commands and flags.
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [command] [flags] [arguments]\n\nCommands:\n", filepath.Base(os.Args[0]))
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %s %s\t%s\n", c.name, c.args, c.help)
+	}
+	w.Flush()
+	fmt.Fprintf(out, "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+// accountDir is the store directory of an account.
+func accountDir(storeDir, account string) string {
+	if account == wa.DefaultAccount {
+		return storeDir
+	}
+	return filepath.Join(storeDir, "accounts", account)
+}
+
+// openAccountStore opens the databases of an account that already exists,
+// without its WhatsApp client.
+func openAccountStore(storeDir, account string, opts db.Options) (*db.Store, error) {
+	dir := accountDir(storeDir, account)
+	if _, err := os.Stat(filepath.Join(dir, "messages.db")); err != nil {
+		return nil, fmt.Errorf("no account %s in %s", account, storeDir)
+	}
+	return db.OpenStore(dir, opts)
+}
+
+// runCommand runs a command other than serve and validate-config. configure
+// sets up the clients of the accounts it opens; backups configures
+// backup-store and restore-store, imports configures import-chat.
+func runCommand(command string, args []string, storeDir, account string, opts db.Options, configure func(*wa.Client), pairPhone string, readOnly bool, backups wa.BackupConfig, imports db.ImportChatOpts) error {
+	// These only need the databases
+	switch command {
+	case "export-chat":
+		return runExportChat(storeDir, account, opts, args[0], args[1])
+	case "query":
+		return runQuery(context.Background(), storeDir, account, opts, args[0])
+	case "import-chat":
+		imports.ChatJID, imports.Path = args[0], args[1]
+		return runImportChat(storeDir, account, opts, imports)
+	case "import-whatsapp-mcp":
+		return runImportWhatsAppMCP(storeDir, account, opts, args[0])
+	case "backup-store":
+		return runBackupStore(storeDir, account, opts, backups)
+	case "restore-store":
+		return runRestoreStore(storeDir, account, opts, args[0], backups.Media)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	accounts := wa.NewAccounts(ctx, storeDir, account)
+	accounts.StoreOptions = opts
+	accounts.Setup = func(a *wa.Account) { configure(a.Client) }
+	defer accounts.Close()
+
+	switch command {
+	case "pair":
+		return runPair(ctx, accounts, account, pairPhone)
+	case "status":
+		return runStatus(accounts, account)
+	case "send":
+		if readOnly {
+			return fmt.Errorf("send is not available in read-only mode")
+		}
+		return runSend(ctx, accounts, account, args[0], args[1])
+	}
+	return fmt.Errorf("unknown command %q", command)
+}
+
+// runPair links an account and exits once it is paired. The QR code or
+// pairing code is printed to stderr by the client.
+func runPair(ctx context.Context, accounts *wa.Accounts, name, phone string) error {
+	a, err := accounts.Open(name)
+	if err != nil {
+		return err
+	}
+	if id := a.Client.WA.Store.ID; id != nil {
+		return fmt.Errorf("account %s is already paired as %s", name, id.ToNonAD())
+	}
+	a.Client.PairPhone = phone
+	if err := a.Client.Connect(ctx); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Account %s paired as %s\n", name, a.Client.GetConnectionStatus().JID)
+	return nil
+}
+
+// runStatus prints an account's pairing and database summary without
+// connecting to WhatsApp.
+func runStatus(accounts *wa.Accounts, name string) error {
+	if !slices.Contains(accounts.Discover(), name) {
+		return fmt.Errorf("no account %s (run %s pair)", name, filepath.Base(os.Args[0]))
+	}
+	a, err := accounts.Open(name)
+	if err != nil {
+		return err
+	}
+	st := a.Client.GetConnectionStatus()
+	_, chats, err := a.Store.ListChats(db.ListChatsOpts{Limit: 1})
+	if err != nil {
+		return err
+	}
+	_, messages, err := a.Store.ListMessages(db.ListMessagesOpts{Limit: 1})
+	if err != nil {
+		return err
+	}
+	outbox, err := a.Store.ListOutbox()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Account:\t%s\n", a.Name)
+	fmt.Fprintf(w, "Store:\t%s\n", a.Dir)
+	if st.JID != "" {
+		paired := st.JID
+		if st.PushName != "" {
+			paired += " (" + st.PushName + ")"
+		}
+		fmt.Fprintf(w, "Paired as:\t%s\n", paired)
+	} else {
+		fmt.Fprintf(w, "Paired as:\tnot paired (run %s pair)\n", filepath.Base(os.Args[0]))
+	}
+	fmt.Fprintf(w, "Chats:\t%d\n", chats.TotalCount)
+	fmt.Fprintf(w, "Messages:\t%d\n", messages.TotalCount)
+	fmt.Fprintf(w, "Outbox:\t%d\n", len(outbox))
+	if others := accounts.Discover(); len(others) > 0 {
+		fmt.Fprintf(w, "Accounts on disk:\t%s\n", strings.Join(others, ", "))
+	}
+	return w.Flush()
+}
+
+// runSend connects an account, sends one text message and disconnects.
+func runSend(ctx context.Context, accounts *wa.Accounts, name, recipient, message string) error {
+	a, err := accounts.Open(name)
+	if err != nil {
+		return err
+	}
+	if a.Client.WA.Store.ID == nil {
+		return fmt.Errorf("account %s is not paired (run %s pair)", name, filepath.Base(os.Args[0]))
+	}
+	if err := a.Client.Connect(ctx); err != nil {
+		return err
+	}
+	ok, _, msg := a.Client.SendMessage(ctx, recipient, message, nil, false)
+	if !ok {
+		return fmt.Errorf("%s", msg)
+	}
+	fmt.Println(msg)
+	return nil
+}
+
+// runExportChat exports a chat without connecting to WhatsApp. The format
+// follows the file extension.
+func runExportChat(storeDir, account string, opts db.Options, chatJID, path string) error {
+	store, err := openAccountStore(storeDir, account, opts)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	format := db.ExportFormatJSON
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".txt":
+		format = db.ExportFormatText
+	case ".html", ".htm":
+		format = db.ExportFormatHTML
+	}
+	n, err := store.ExportChat(db.ExportChatOpts{ChatJID: chatJID, Format: format, Path: path})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d messages of %s to %s\n", n, chatJID, path)
+	return nil
+}
+
+// runQuery prints the result of a read-only SQL query as tab-separated
+// columns with a header line.
+func runQuery(ctx context.Context, storeDir, account string, opts db.Options, query string) error {
+	store, err := openAccountStore(storeDir, account, opts)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	result, err := store.QueryReadOnly(ctx, query)
+	if err != nil {
+		return err
+	}
+	fmt.Println(strings.Join(result.Columns, "\t"))
+	for _, row := range result.Rows {
+		fields := make([]string, len(row))
+		for i, v := range row {
+			if v == nil {
+				fields[i] = "NULL"
+			} else {
+				fields[i] = strings.NewReplacer("\t", `\t`, "\n", `\n`).Replace(fmt.Sprint(v))
+			}
+		}
+		fmt.Println(strings.Join(fields, "\t"))
+	}
+	fmt.Fprintf(os.Stderr, "%d rows\n", len(result.Rows))
+	return nil
+}
+
+// runBackupStore writes a backup of an account's store and deletes the
+// backups beyond backups.Keep.
+func runBackupStore(storeDir, account string, opts db.Options, backups wa.BackupConfig) error {
+	store, err := openAccountStore(storeDir, account, opts)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	dir := wa.BackupsDir(backups.Dir, accountDir(storeDir, account), account)
+	b, err := wa.BackupStore(context.Background(), store, accountDir(storeDir, account), dir, backups.Media)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Backup written to %s (%d MB)\n", b.Path, b.Bytes>>20)
+	if backups.Keep > 0 {
+		n, err := wa.PruneBackups(dir, backups.Keep)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			fmt.Fprintf(os.Stderr, "Deleted %d old backups\n", n)
+		}
+	}
+	return nil
+}
+
+// runRestoreStore restores a backup into an account's store.
+func runRestoreStore(storeDir, account string, opts db.Options, path string, media bool) error {
+	store, err := openAccountStore(storeDir, account, opts)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	if err := wa.RestoreStore(context.Background(), store, accountDir(storeDir, account), path, media); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Restored %s into account %s\n", path, account)
+	return nil
+}
+
+// runImportChat imports an exported chat file. Participants without a JID
+// are asked for on the terminal, if there is one.
+func runImportChat(storeDir, account string, opts db.Options, imports db.ImportChatOpts) error {
+	store, err := openAccountStore(storeDir, account, opts)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	imports.OwnJID = store.DeviceJID()
+	if imports.Participants == nil {
+		imports.Participants = make(map[string]string)
+	}
+	for {
+		result, err := store.ImportChat(imports)
+		var unmapped *db.UnmappedParticipantsError
+		if errors.As(err, &unmapped) && isTerminal(os.Stdin) {
+			if err := askParticipants(unmapped.Names, imports.Participants); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Imported %d of %d messages into %s (%d already stored, %d system notices skipped)\n",
+			result.Imported, result.Parsed, imports.ChatJID, result.Duplicate, result.Skipped)
+		return nil
+	}
+}
+
+// askParticipants asks for the JID, phone number or "me" of each name.
+func askParticipants(names []string, participants map[string]string) error {
+	in := bufio.NewScanner(os.Stdin)
+	for _, name := range names {
+		for participants[name] == "" {
+			fmt.Fprintf(os.Stderr, "JID, phone number or %q for %s: ", db.ParticipantMe, name)
+			if !in.Scan() {
+				return fmt.Errorf("no JID for participant %s", name)
+			}
+			participants[name] = strings.TrimSpace(in.Text())
+		}
+	}
+	return nil
+}
+
+// isTerminal reports whether f is a terminal rather than a file or pipe.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// loadParticipants reads a JSON object mapping the names in an exported
+// chat to JIDs, phone numbers or "me".
+func loadParticipants(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read participants: %w", err)
+	}
+	var participants map[string]string
+	if err := json.Unmarshal(data, &participants); err != nil {
+		return nil, fmt.Errorf("parse participants %s: %w", path, err)
+	}
+	return participants, nil
+}
+
+// runImportWhatsAppMCP merges a whatsapp-mcp database into an account's
+// store.
+func runImportWhatsAppMCP(storeDir, account string, opts db.Options, path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	store, err := openAccountStore(storeDir, account, opts)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	result, err := store.ImportWhatsAppMCP(path)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Imported %d messages and %d new chats from %s (%d messages already stored, %d failed)\n",
+		result.Messages, result.Chats, path, result.Duplicate, result.Failed)
+	return nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Settings can come from the command line, WAHOO_* environment variables and
+// a YAML config file, in that order of precedence.
+const (
+	sourceDefault = "default"
+	sourceFlag    = "command line"
+	sourceEnv     = "environment"
+	sourceConfig  = "config file"
+)
+
+// unconfigurable flags are one-off actions or locate the config itself.
+var unconfigurable = []string{"config", "export-metadata", "import-metadata"}
+
+// repeatableSettings are flags that can be given several times. In the
+// config file they take a list, in the environment a comma-separated one.
+var repeatableSettings = []string{"media-allow-dir", "send-allow", "send-deny"}
+
+// secretSettings are not printed by validate-config.
+var secretSettings = []string{"db-key"}
+
+// defaultConfigPath is wahoo/config.yaml in the user's config directory.
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "wahoo", "config.yaml")
+}
+
+// envName is the environment variable that overrides a flag, e.g.
+// WAHOO_RATE_LIMIT_CHAT for -rate-limit-chat.
+func envName(flagName string) string {
+	return "WAHOO_" + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// loadConfig reads a YAML config file into the values of the flags it sets.
+// Keys are flag names without the dash. Sections are joined to the names of
+// their keys, so rate-limit: {chat: 5} sets -rate-limit-chat, and a
+// section's enabled key sets the flag named like the section. Lists set
+// repeatable flags such as media-allow-dir once per item.
+func loadConfig(path string) (map[string][]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+	var root map[string]any
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("parse config %s: %w", path, err)
+	}
+	values := make(map[string][]string)
+	if err := flattenConfig("", root, values); err != nil {
+		return nil, fmt.Errorf("config %s: %w", path, err)
+	}
+	return values, nil
+}
+
+func flattenConfig(prefix string, node map[string]any, values map[string][]string) error {
+	for key, v := range node {
+		name := key
+		if prefix != "" {
+			name = prefix + "-" + key
+			if key == "enabled" {
+				name = prefix
+			}
+		}
+		if _, dup := values[name]; dup {
+			return fmt.Errorf("%s is set twice", name)
+		}
+		switch v := v.(type) {
+		case nil:
+		case map[string]any:
+			if err := flattenConfig(name, v, values); err != nil {
+				return err
+			}
+		case []any:
+			for _, item := range v {
+				if _, ok := item.(map[string]any); ok {
+					return fmt.Errorf("%s: list items must be plain values", name)
+				}
+				values[name] = append(values[name], fmt.Sprint(item))
+			}
+		default:
+			values[name] = []string{fmt.Sprint(v)}
+		}
+	}
+	return nil
+}
+
+// applySettings sets the flags not given on the command line from their
+// WAHOO_* environment variables or, failing that, from the config file, and
+// returns where each flag's value came from. configPath may be empty to use
+// the default config file if there is one; it is returned with the file
+// that was loaded, or "" if none was.
+func applySettings(fs *flag.FlagSet, configPath string) (sources map[string]string, loaded string, err error) {
+	var config map[string][]string
+	if configPath == "" {
+		if def := defaultConfigPath(); def != "" {
+			if _, err := os.Stat(def); err == nil {
+				configPath = def
+			}
+		}
+	}
+	if configPath != "" {
+		if config, err = loadConfig(configPath); err != nil {
+			return nil, "", err
+		}
+		for name, values := range config {
+			if fs.Lookup(name) == nil || slices.Contains(unconfigurable, name) {
+				return nil, "", fmt.Errorf("config %s: unknown setting %q", configPath, name)
+			}
+			if len(values) != 1 && !slices.Contains(repeatableSettings, name) {
+				return nil, "", fmt.Errorf("config %s: %s takes a single value", configPath, name)
+			}
+		}
+	}
+
+	sources = make(map[string]string)
+	fs.VisitAll(func(f *flag.Flag) { sources[f.Name] = sourceDefault })
+	fs.Visit(func(f *flag.Flag) { sources[f.Name] = sourceFlag })
+
+	var setErr error
+	fs.VisitAll(func(f *flag.Flag) {
+		if setErr != nil || sources[f.Name] == sourceFlag || slices.Contains(unconfigurable, f.Name) {
+			return
+		}
+		source, values := sourceConfig, config[f.Name]
+		if env := os.Getenv(envName(f.Name)); env != "" {
+			source, values = sourceEnv, []string{env}
+			if slices.Contains(repeatableSettings, f.Name) {
+				values = strings.Split(env, ",")
+			}
+		}
+		if values == nil {
+			return
+		}
+		for _, v := range values {
+			if err := fs.Set(f.Name, strings.TrimSpace(v)); err != nil {
+				setErr = fmt.Errorf("invalid %s from %s: %v", f.Name, source, err)
+				return
+			}
+		}
+		sources[f.Name] = source
+	})
+	return sources, configPath, setErr
+}
+
+// printSettings writes every setting with its value and source, for
+// validate-config. Secrets and repeatable flags only show whether they are set.
+func printSettings(fs *flag.FlagSet, sources map[string]string) {
+	var names []string
+	fs.VisitAll(func(f *flag.Flag) { names = append(names, f.Name) })
+	sort.Strings(names)
+	for _, name := range names {
+		f := fs.Lookup(name)
+		value := f.Value.String()
+		if slices.Contains(secretSettings, name) && value != "" ||
+			slices.Contains(repeatableSettings, name) && sources[name] != sourceDefault {
+			value = "(set)"
+		}
+		fmt.Printf("%-30s %-40s %s\n", name, value, sources[name])
+	}
+}
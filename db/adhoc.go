@@ -0,0 +1,57 @@
+package db
+
+import (
+	"context"
+	"fmt"
+)
+
+// QueryResult holds the rows of an ad-hoc query.
+type QueryResult struct {
+	Columns []string
+	Rows    [][]any
+}
+
+// QueryReadOnly runs an ad-hoc SQL statement against the messages database
+// on a connection that refuses writes, so it can't change the store.
+// Encrypted columns can be read with wahoo_decrypt(column).
+func (s *Store) QueryReadOnly(ctx context.Context, query string, args ...any) (*QueryResult, error) {
+	conn, err := s.MsgDB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, "PRAGMA query_only = ON"); err != nil {
+		return nil, fmt.Errorf("enable query_only: %w", err)
+	}
+	// The connection goes back to the pool, which must be able to write again
+	defer conn.ExecContext(context.Background(), "PRAGMA query_only = OFF")
+
+	rows, err := conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	result := &QueryResult{Columns: columns}
+	for rows.Next() {
+		values := make([]any, len(columns))
+		ptrs := make([]any, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		for i, v := range values {
+			if b, ok := v.([]byte); ok {
+				values[i] = string(b)
+			}
+		}
+		result.Rows = append(result.Rows, values)
+	}
+	return result, rows.Err()
+}
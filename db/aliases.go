@@ -0,0 +1,81 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SetContactAlias sets the name shown for a contact instead of its WhatsApp
+// name, or removes the alias if alias is empty. contact is a JID or phone
+// number. Returns the JID the alias is set for.
+func (s *Store) SetContactAlias(contact, alias string) (string, error) {
+	jid := strings.TrimSpace(contact)
+	if jid == "" {
+		return "", fmt.Errorf("contact is required")
+	}
+	if !strings.Contains(jid, "@") {
+		jid = strings.TrimPrefix(jid, "+") + "@s.whatsapp.net"
+	}
+
+	var err error
+	if alias = strings.TrimSpace(alias); alias == "" {
+		_, err = s.MsgDB.Exec("DELETE FROM contact_aliases WHERE jid = ?", jid)
+	} else {
+		_, err = s.MsgDB.Exec(
+			`INSERT INTO contact_aliases (jid, alias, updated_at) VALUES (?, ?, ?)
+			 ON CONFLICT(jid) DO UPDATE SET alias = excluded.alias, updated_at = excluded.updated_at`,
+			jid, alias, time.Now(),
+		)
+	}
+	if err != nil {
+		return "", fmt.Errorf("set contact alias: %w", err)
+	}
+	s.InvalidateNames()
+	return jid, nil
+}
+
+// applyAliases overrides the names in a BuildSenderCache lookup with the
+// contact aliases, for every JID of an aliased contact.
+func (s *Store) applyAliases(cache map[string]string) {
+	rows, err := s.MsgDB.Query("SELECT jid, alias FROM contact_aliases")
+	if err != nil {
+		return
+	}
+	aliases := map[string]string{}
+	for rows.Next() {
+		var jid, alias string
+		if rows.Scan(&jid, &alias) == nil {
+			aliases[jid] = alias
+		}
+	}
+	rows.Close()
+
+	for jid, alias := range aliases {
+		for _, j := range s.contactJIDs(jid) {
+			cache[j] = alias
+		}
+	}
+}
+
+// contactJIDs returns every JID of the contact jid: its linked identities and
+// the LID or phone number WhatsApp maps it to, each also as a bare number.
+func (s *Store) contactJIDs(jid string) []string {
+	jids := s.LinkedJIDs(jid)
+	if s.WaDB == nil {
+		return jids
+	}
+	user, server, _ := strings.Cut(jid, "@")
+	var other string
+	switch server {
+	case "s.whatsapp.net":
+		if s.WaDB.QueryRow("SELECT lid FROM whatsmeow_lid_map WHERE pn = ?", user).Scan(&other) == nil {
+			jids = append(jids, other+"@lid", other)
+		}
+	case "lid":
+		if s.WaDB.QueryRow("SELECT pn FROM whatsmeow_lid_map WHERE lid = ?", user).Scan(&other) == nil {
+			jids = append(jids, other+"@s.whatsapp.net", other)
+		}
+	}
+	return jids
+}
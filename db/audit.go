@@ -0,0 +1,107 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AuditEntry records one call of a write tool.
+type AuditEntry struct {
+	ID         int64   `json:"id"`
+	Timestamp  string  `json:"timestamp"`
+	Tool       string  `json:"tool"`
+	Session    *string `json:"session,omitempty"` // MCP session the call came from
+	Client     *string `json:"client,omitempty"`  // name and version the MCP client reported
+	Arguments  string  `json:"arguments"`         // JSON
+	Result     string  `json:"result"`            // the tool's output, or the error
+	Success    bool    `json:"success"`
+	DurationMS int64   `json:"duration_ms"`
+}
+
+// AuditLogOpts filters the entries returned by GetAuditLog.
+type AuditLogOpts struct {
+	Tool    string
+	Session string
+	After   *string
+	Before  *string
+	Limit   int // default 50
+	Page    int
+}
+
+// LogAudit appends an entry to the audit log and returns its ID. Arguments
+// and result are encrypted like message text, since they contain it.
+func (s *Store) LogAudit(e AuditEntry, at time.Time) (int64, error) {
+	res, err := s.MsgDB.Exec(
+		`INSERT INTO audit_log (timestamp, tool, session, client, arguments, result, success, duration_ms)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		at, e.Tool, e.Session, e.Client, s.seal(e.Arguments), s.seal(e.Result), e.Success, e.DurationMS,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("write audit log: %w", err)
+	}
+	return res.LastInsertId()
+}
+
+// GetAuditLog returns audit log entries, newest first.
+func (s *Store) GetAuditLog(opts AuditLogOpts) ([]AuditEntry, PageInfo, error) {
+	if opts.Limit == 0 {
+		opts.Limit = 50
+	}
+	var where []string
+	var params []any
+	if opts.Tool != "" {
+		where = append(where, "tool = ?")
+		params = append(params, opts.Tool)
+	}
+	if opts.Session != "" {
+		where = append(where, "session = ?")
+		params = append(params, opts.Session)
+	}
+	if opts.After != nil {
+		where = append(where, "timestamp > ?")
+		params = append(params, *opts.After)
+	}
+	if opts.Before != nil {
+		where = append(where, "timestamp < ?")
+		params = append(params, *opts.Before)
+	}
+	filter := ""
+	if len(where) > 0 {
+		filter = " WHERE " + strings.Join(where, " AND ")
+	}
+
+	var total int
+	if err := s.MsgDB.QueryRow("SELECT COUNT(*) FROM audit_log"+filter, params...).Scan(&total); err != nil {
+		return nil, PageInfo{}, fmt.Errorf("count audit log: %w", err)
+	}
+
+	rows, err := s.MsgDB.Query(
+		`SELECT id, timestamp, tool, session, client, wahoo_decrypt(arguments), wahoo_decrypt(result), success, duration_ms
+		 FROM audit_log`+filter+` ORDER BY id DESC LIMIT ? OFFSET ?`,
+		append(params, opts.Limit, opts.Page*opts.Limit)...,
+	)
+	if err != nil {
+		return nil, PageInfo{}, fmt.Errorf("get audit log: %w", err)
+	}
+	defer rows.Close()
+
+	result := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		var session, client, args, res sql.NullString
+		if err := rows.Scan(&e.ID, &e.Timestamp, &e.Tool, &session, &client, &args, &res, &e.Success, &e.DurationMS); err != nil {
+			return nil, PageInfo{}, fmt.Errorf("scan audit entry: %w", err)
+		}
+		if session.Valid {
+			e.Session = &session.String
+		}
+		if client.Valid {
+			e.Client = &client.String
+		}
+		e.Arguments, e.Result = args.String, res.String
+		result = append(result, e)
+	}
+	return result, newPageInfo(total, opts.Page, opts.Limit), rows.Err()
+}
@@ -0,0 +1,178 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"modernc.org/sqlite"
+)
+
+// backuper is implemented by modernc.org/sqlite connections, which expose
+// SQLite's online backup API.
+type backuper interface {
+	NewBackup(dstURI string) (*sqlite.Backup, error)
+	NewRestore(srcURI string) (*sqlite.Backup, error)
+}
+
+// withBackuper runs fn with the SQLite connection underneath one of the
+// messages database's connections.
+func (s *Store) withBackuper(ctx context.Context, fn func(b backuper) error) error {
+	conn, err := s.MsgDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Raw(func(dc any) error {
+		if tc, ok := dc.(timedConn); ok {
+			dc = tc.sqliteConn
+		}
+		b, ok := dc.(backuper)
+		if !ok {
+			return errors.New("the SQLite driver does not support online backups")
+		}
+		return fn(b)
+	})
+}
+
+// runBackup copies all pages in one step, so the copy is a consistent
+// snapshot. In WAL mode writers are not blocked while it runs.
+func runBackup(b *sqlite.Backup) error {
+	if _, err := b.Step(-1); err != nil {
+		b.Finish()
+		return err
+	}
+	return b.Finish()
+}
+
+// BackupDatabase writes a consistent snapshot of the messages database to a
+// new file at path with SQLite's online backup API, while the store stays
+// in use. Encrypted text stays encrypted in the copy.
+func (s *Store) BackupDatabase(ctx context.Context, path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("backup %s already exists", path)
+	}
+	err := s.withBackuper(ctx, func(b backuper) error {
+		backup, err := b.NewBackup(path)
+		if err != nil {
+			return err
+		}
+		return runBackup(backup)
+	})
+	if err != nil {
+		os.Remove(path)
+		return fmt.Errorf("backup messages database: %w", err)
+	}
+	return nil
+}
+
+// RestoreDatabase replaces the contents of the messages database with the
+// backup at path, while the store stays open. The backup is migrated to the
+// current schema in a temporary copy first, so a failed migration leaves the
+// store as it was. The backup must be encrypted with the store's key, or
+// both must be unencrypted.
+func (s *Store) RestoreDatabase(ctx context.Context, path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("restore messages database: %w", err)
+	}
+	if err := s.checkBackupKey(path); err != nil {
+		return err
+	}
+	migrated, err := migratedCopy(path)
+	if err != nil {
+		return fmt.Errorf("restore messages database: %w", err)
+	}
+	defer os.Remove(migrated)
+
+	err = s.withBackuper(ctx, func(b backuper) error {
+		restore, err := b.NewRestore(migrated)
+		if err != nil {
+			return err
+		}
+		return runBackup(restore)
+	})
+	if err != nil {
+		return fmt.Errorf("restore messages database: %w", err)
+	}
+
+	s.namesMu.Lock()
+	s.names = nil
+	s.namesMu.Unlock()
+	return nil
+}
+
+// migratedCopy copies the database at path to a temporary file, migrates
+// the copy to the current schema and returns its path. The backup itself
+// is not modified.
+func migratedCopy(path string) (string, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	tmp, err := os.CreateTemp("", "wahoo-restore-*.db")
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(tmp, src)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+
+	// Rollback journaling keeps every change in the file itself
+	copyDB, err := sql.Open("sqlite", "file:"+tmp.Name()+"?_pragma=journal_mode(DELETE)")
+	if err == nil {
+		err = migrate(copyDB)
+		if closeErr := copyDB.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+// checkBackupKey makes sure a backup's text can be read with the store's key.
+func (s *Store) checkBackupKey(path string) error {
+	backup, err := sql.Open("sqlite", "file:"+path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer backup.Close()
+
+	var salt []byte
+	err = backup.QueryRow("SELECT salt FROM encryption WHERE id = 1").Scan(&salt)
+	backupEncrypted := err == nil
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		// Backups of stores older than encryption have no encryption table
+		var exists bool
+		if backup.QueryRow("SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE name = 'encryption')").Scan(&exists); exists {
+			return fmt.Errorf("read backup %s: %w", path, err)
+		}
+	}
+
+	switch {
+	case backupEncrypted && s.cipher == nil:
+		return errors.New("the backup is encrypted but this store is not: start with the backup's -db-key")
+	case !backupEncrypted && s.cipher != nil:
+		return errors.New("the backup is not encrypted but this store is")
+	case backupEncrypted:
+		var current []byte
+		if err := s.MsgDB.QueryRow("SELECT salt FROM encryption WHERE id = 1").Scan(&current); err != nil {
+			return err
+		}
+		if string(current) != string(salt) {
+			return errors.New("the backup was encrypted with the key of another store")
+		}
+	}
+	return nil
+}
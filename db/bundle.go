@@ -0,0 +1,265 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// MetadataBundleVersion is the format version written by ExportMetadata.
+const MetadataBundleVersion = 1
+
+// MetadataBundle is a portable copy of the wahoo-local metadata of an account:
+// everything the user configured that is not part of the message archive.
+type MetadataBundle struct {
+	Version           int                `json:"version"`
+	ExportedAt        string             `json:"exported_at"`
+	WatchRules        []WatchRule        `json:"watch_rules"`
+	ModerationRules   []ModerationRule   `json:"moderation_rules,omitempty"`
+	RedactionProfiles []RedactionProfile `json:"redaction_profiles,omitempty"`
+	SendPolicy        []SendPolicyRule   `json:"send_policy,omitempty"`
+	ChatProfiles      []ChatProfileEntry `json:"chat_profiles"`
+	ChatStates        []ChatStateEntry   `json:"chat_states"`
+	Identities        []IdentityLink     `json:"identities"`
+}
+
+// ChatProfileEntry is a chat profile together with its chat.
+type ChatProfileEntry struct {
+	ChatJID string `json:"chat_jid"`
+	ChatProfile
+}
+
+// ChatStateEntry is the archive/pin/mute state of a chat.
+type ChatStateEntry struct {
+	ChatJID     string     `json:"chat_jid"`
+	Archived    bool       `json:"archived,omitempty"`
+	Pinned      bool       `json:"pinned,omitempty"`
+	Muted       bool       `json:"muted,omitempty"`
+	MutedUntil  *time.Time `json:"muted_until,omitempty"`
+	AutoRead    bool       `json:"auto_read,omitempty"`
+	SendProfile string     `json:"send_profile,omitempty"`
+	RetainDays  *int       `json:"retain_days,omitempty"`
+}
+
+// IdentityLink maps a JID to the canonical JID of the same person.
+type IdentityLink struct {
+	JID          string `json:"jid"`
+	CanonicalJID string `json:"canonical_jid"`
+	Reason       string `json:"reason,omitempty"`
+}
+
+// Summary describes the contents of the bundle, e.g. for tool results.
+func (b *MetadataBundle) Summary() string {
+	return fmt.Sprintf("%d watch rules, %d moderation rules, %d redaction profiles, %d send policy rules, %d chat profiles, %d chat states, %d identity links",
+		len(b.WatchRules), len(b.ModerationRules), len(b.RedactionProfiles), len(b.SendPolicy), len(b.ChatProfiles), len(b.ChatStates), len(b.Identities))
+}
+
+// ExportMetadata collects the local metadata into a bundle.
+func (s *Store) ExportMetadata() (*MetadataBundle, error) {
+	b := &MetadataBundle{
+		Version:      MetadataBundleVersion,
+		ExportedAt:   time.Now().Format(time.RFC3339),
+		ChatProfiles: []ChatProfileEntry{},
+		ChatStates:   []ChatStateEntry{},
+		Identities:   []IdentityLink{},
+	}
+
+	var err error
+	if b.WatchRules, err = s.ListWatchRules(); err != nil {
+		return nil, err
+	}
+	if b.ModerationRules, err = s.ListModerationRules(); err != nil {
+		return nil, err
+	}
+	if b.RedactionProfiles, err = s.ListRedactionProfiles(); err != nil {
+		return nil, err
+	}
+	if b.SendPolicy, err = s.ListSendPolicy(); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.MsgDB.Query("SELECT chat_jid, language, formality, emoji FROM chat_profiles ORDER BY chat_jid")
+	if err != nil {
+		return nil, fmt.Errorf("export chat profiles: %w", err)
+	}
+	for rows.Next() {
+		var e ChatProfileEntry
+		if rows.Scan(&e.ChatJID, &e.Language, &e.Formality, &e.Emoji) == nil {
+			b.ChatProfiles = append(b.ChatProfiles, e)
+		}
+	}
+	rows.Close()
+
+	rows, err = s.MsgDB.Query(
+		`SELECT jid, archived, pinned, muted, muted_until, auto_read, send_profile, retain_days FROM chats
+		 WHERE archived = 1 OR pinned = 1 OR muted = 1 OR auto_read = 1 OR send_profile != '' OR retain_days IS NOT NULL
+		 ORDER BY jid`)
+	if err != nil {
+		return nil, fmt.Errorf("export chat states: %w", err)
+	}
+	for rows.Next() {
+		var e ChatStateEntry
+		var archived, pinned, muted, autoRead sql.NullBool
+		var mutedUntil sql.NullTime
+		var sendProfile sql.NullString
+		var retainDays sql.NullInt64
+		if rows.Scan(&e.ChatJID, &archived, &pinned, &muted, &mutedUntil, &autoRead, &sendProfile, &retainDays) != nil {
+			continue
+		}
+		if retainDays.Valid {
+			days := int(retainDays.Int64)
+			e.RetainDays = &days
+		}
+		e.SendProfile = sendProfile.String
+		e.Archived, e.Pinned, e.Muted, e.AutoRead = archived.Bool, pinned.Bool, muted.Bool, autoRead.Bool
+		if e.Muted && mutedUntil.Valid {
+			e.MutedUntil = &mutedUntil.Time
+		}
+		b.ChatStates = append(b.ChatStates, e)
+	}
+	rows.Close()
+
+	rows, err = s.MsgDB.Query("SELECT jid, canonical_jid, reason FROM identities ORDER BY jid")
+	if err != nil {
+		return nil, fmt.Errorf("export identities: %w", err)
+	}
+	for rows.Next() {
+		var l IdentityLink
+		var reason sql.NullString
+		if rows.Scan(&l.JID, &l.CanonicalJID, &reason) == nil {
+			l.Reason = reason.String
+			b.Identities = append(b.Identities, l)
+		}
+	}
+	rows.Close()
+
+	return b, nil
+}
+
+// ExportMetadataFile writes the metadata bundle to a new file at path as
+// indented JSON.
+func (s *Store) ExportMetadataFile(path string) (*MetadataBundle, error) {
+	b, err := s.ExportMetadata()
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeNewFile(path, data); err != nil {
+		return nil, fmt.Errorf("write metadata bundle: %w", err)
+	}
+	return b, nil
+}
+
+// ImportMetadataFile reads a bundle written by ExportMetadataFile and imports it.
+func (s *Store) ImportMetadataFile(path string) (*MetadataBundle, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read metadata bundle: %w", err)
+	}
+	var b MetadataBundle
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("parse metadata bundle: %w", err)
+	}
+	return &b, s.ImportMetadata(&b)
+}
+
+// ImportMetadata merges a bundle into the store. Entries in the bundle replace
+// existing ones with the same key; everything else is kept. Chat states for
+// chats not seen yet are kept until the chat arrives.
+func (s *Store) ImportMetadata(b *MetadataBundle) error {
+	if b.Version < 1 || b.Version > MetadataBundleVersion {
+		return fmt.Errorf("unsupported metadata bundle version %d", b.Version)
+	}
+
+	tx, err := s.MsgDB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	for _, r := range b.WatchRules {
+		if _, err := tx.Exec(
+			`INSERT OR REPLACE INTO watch_rules (name, keyword, sender, chat_jid, mentions_me, created_at)
+			 VALUES (?, ?, ?, ?, ?, ?)`,
+			r.Name, r.Keyword, r.Sender, r.ChatJID, r.MentionsMe, now,
+		); err != nil {
+			return fmt.Errorf("import watch rule %s: %w", r.Name, err)
+		}
+	}
+	for _, r := range b.ModerationRules {
+		if _, err := tx.Exec(
+			`INSERT OR REPLACE INTO moderation_rules (name, group_jid, banned_words, block_links, created_at)
+			 VALUES (?, ?, ?, ?, ?)`,
+			r.Name, r.GroupJID, strings.Join(r.BannedWords, "\n"), r.BlockLinks, now,
+		); err != nil {
+			return fmt.Errorf("import moderation rule %s: %w", r.Name, err)
+		}
+	}
+	for _, p := range b.RedactionProfiles {
+		if _, err := tx.Exec(
+			`INSERT OR REPLACE INTO redaction_profiles (name, strip_media, mask_numbers, drop_participants, created_at)
+			 VALUES (?, ?, ?, ?, ?)`,
+			p.Name, p.StripMedia, p.MaskNumbers, strings.Join(p.DropParticipants, "\n"), now,
+		); err != nil {
+			return fmt.Errorf("import redaction profile %s: %w", p.Name, err)
+		}
+	}
+	for _, r := range b.SendPolicy {
+		if r.Action != SendAllow && r.Action != SendDeny {
+			return fmt.Errorf("import send policy %s: unknown action %q", r.Pattern, r.Action)
+		}
+		if _, err := tx.Exec(
+			"INSERT OR REPLACE INTO send_policy (pattern, action, created_at) VALUES (?, ?, ?)",
+			r.Pattern, r.Action, now,
+		); err != nil {
+			return fmt.Errorf("import send policy %s: %w", r.Pattern, err)
+		}
+	}
+	for _, p := range b.ChatProfiles {
+		if _, err := tx.Exec(
+			`INSERT OR REPLACE INTO chat_profiles (chat_jid, language, formality, emoji, updated_at)
+			 VALUES (?, ?, ?, ?, ?)`,
+			p.ChatJID, p.Language, p.Formality, p.Emoji, now,
+		); err != nil {
+			return fmt.Errorf("import chat profile %s: %w", p.ChatJID, err)
+		}
+	}
+	for _, c := range b.ChatStates {
+		var mutedUntil any
+		if c.Muted && c.MutedUntil != nil {
+			mutedUntil = *c.MutedUntil
+		}
+		if _, err := tx.Exec(
+			`INSERT INTO chats (jid, archived, pinned, muted, muted_until, auto_read, send_profile, retain_days)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			 ON CONFLICT(jid) DO UPDATE SET archived = excluded.archived, pinned = excluded.pinned,
+			   muted = excluded.muted, muted_until = excluded.muted_until, auto_read = excluded.auto_read,
+			   send_profile = excluded.send_profile, retain_days = excluded.retain_days`,
+			c.ChatJID, c.Archived, c.Pinned, c.Muted, mutedUntil, c.AutoRead, c.SendProfile, c.RetainDays,
+		); err != nil {
+			return fmt.Errorf("import chat state %s: %w", c.ChatJID, err)
+		}
+	}
+	for _, l := range b.Identities {
+		if _, err := tx.Exec(
+			`INSERT INTO identities (jid, canonical_jid, reason, linked_at) VALUES (?, ?, ?, ?)
+			 ON CONFLICT(jid) DO UPDATE SET canonical_jid = excluded.canonical_jid`,
+			l.JID, l.CanonicalJID, l.Reason, now,
+		); err != nil {
+			return fmt.Errorf("import identity %s: %w", l.JID, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	// Imported identity links change the names of old JIDs
+	s.InvalidateNames()
+	return nil
+}
@@ -0,0 +1,178 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Call statuses.
+const (
+	CallRinging      = "ringing"
+	CallAccepted     = "accepted"      // answered on one of our devices
+	CallRejected     = "rejected"      // declined on one of our devices or with reject_call
+	CallAutoRejected = "auto_rejected" // declined because the caller is unknown
+	CallMissed       = "missed"        // ended before it was answered
+	CallEnded        = "ended"         // ended after it was answered
+)
+
+// CallDict is the structured output for call queries.
+type CallDict struct {
+	CallID       string  `json:"call_id"`
+	Caller       string  `json:"caller"`
+	CallerName   string  `json:"caller_name"`
+	CallerDevice string  `json:"-"`
+	GroupJID     *string `json:"group_jid,omitempty"`
+	IsVideo      bool    `json:"is_video"`
+	Status       string  `json:"status"`
+	OfferedAt    string  `json:"offered_at"`
+	EndedAt      *string `json:"ended_at,omitempty"`
+	EndReason    *string `json:"end_reason,omitempty"`
+}
+
+// ListCallsOpts filters the calls returned by ListCalls.
+type ListCallsOpts struct {
+	Caller string
+	Status string
+	After  *string
+	Before *string
+	Limit  int // default 50
+	Page   int
+}
+
+// StoreCallOffer records an incoming call as ringing. A repeated offer for
+// the same call is ignored.
+func (s *Store) StoreCallOffer(callID, caller, callerDevice, groupJID string, isVideo bool, offeredAt time.Time) error {
+	_, err := s.MsgDB.Exec(
+		`INSERT OR IGNORE INTO calls (call_id, caller, caller_device, group_jid, is_video, status, offered_at)
+		 VALUES (?, ?, ?, NULLIF(?, ''), ?, ?, ?)`,
+		callID, caller, callerDevice, groupJID, isVideo, CallRinging, offeredAt,
+	)
+	if err != nil {
+		return fmt.Errorf("store call: %w", err)
+	}
+	return nil
+}
+
+// SetCallStatus records that a ringing call was accepted or rejected.
+// Calls that already ended keep their status.
+func (s *Store) SetCallStatus(callID, status string) error {
+	_, err := s.MsgDB.Exec(
+		"UPDATE calls SET status = ? WHERE call_id = ? AND status IN (?, ?)",
+		status, callID, CallRinging, CallAccepted,
+	)
+	if err != nil {
+		return fmt.Errorf("update call: %w", err)
+	}
+	return nil
+}
+
+// EndCall records the end of a call: a call that was still ringing was
+// missed, an accepted one ended, and a rejected one stays rejected.
+func (s *Store) EndCall(callID, reason string, endedAt time.Time) error {
+	_, err := s.MsgDB.Exec(
+		`UPDATE calls SET
+			status = CASE status WHEN ? THEN ? WHEN ? THEN ? ELSE status END,
+			ended_at = ?, end_reason = NULLIF(?, '')
+		 WHERE call_id = ? AND ended_at IS NULL`,
+		CallRinging, CallMissed, CallAccepted, CallEnded, endedAt, reason, callID,
+	)
+	if err != nil {
+		return fmt.Errorf("end call: %w", err)
+	}
+	return nil
+}
+
+const callColumns = "call_id, caller, caller_device, group_jid, is_video, status, offered_at, ended_at, end_reason"
+
+// GetCall returns a call by ID, or nil if it is not known.
+func (s *Store) GetCall(callID string) (*CallDict, error) {
+	rows, err := s.MsgDB.Query("SELECT "+callColumns+" FROM calls WHERE call_id = ?", callID)
+	if err != nil {
+		return nil, fmt.Errorf("get call: %w", err)
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	c, err := s.scanCall(rows)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// ListCalls returns calls, newest first.
+func (s *Store) ListCalls(opts ListCallsOpts) ([]CallDict, PageInfo, error) {
+	if opts.Limit == 0 {
+		opts.Limit = 50
+	}
+	var where []string
+	var params []any
+	if opts.Caller != "" {
+		jids := s.LinkedJIDs(opts.Caller)
+		where = append(where, "caller IN ("+placeholders(len(jids))+")")
+		params = append(params, repeatArgs(jids, 1)...)
+	}
+	if opts.Status != "" {
+		where = append(where, "status = ?")
+		params = append(params, opts.Status)
+	}
+	if opts.After != nil {
+		where = append(where, "offered_at > ?")
+		params = append(params, *opts.After)
+	}
+	if opts.Before != nil {
+		where = append(where, "offered_at < ?")
+		params = append(params, *opts.Before)
+	}
+	filter := ""
+	if len(where) > 0 {
+		filter = " WHERE " + strings.Join(where, " AND ")
+	}
+
+	var total int
+	if err := s.MsgDB.QueryRow("SELECT COUNT(*) FROM calls"+filter, params...).Scan(&total); err != nil {
+		return nil, PageInfo{}, fmt.Errorf("count calls: %w", err)
+	}
+
+	rows, err := s.MsgDB.Query(
+		"SELECT "+callColumns+" FROM calls"+filter+" ORDER BY offered_at DESC LIMIT ? OFFSET ?",
+		append(params, opts.Limit, opts.Page*opts.Limit)...,
+	)
+	if err != nil {
+		return nil, PageInfo{}, fmt.Errorf("list calls: %w", err)
+	}
+	defer rows.Close()
+
+	result := []CallDict{}
+	for rows.Next() {
+		c, err := s.scanCall(rows)
+		if err != nil {
+			return nil, PageInfo{}, err
+		}
+		result = append(result, c)
+	}
+	return result, newPageInfo(total, opts.Page, opts.Limit), rows.Err()
+}
+
+func (s *Store) scanCall(rows *sql.Rows) (CallDict, error) {
+	var c CallDict
+	var group, endedAt, reason sql.NullString
+	err := rows.Scan(&c.CallID, &c.Caller, &c.CallerDevice, &group, &c.IsVideo, &c.Status, &c.OfferedAt, &endedAt, &reason)
+	if err != nil {
+		return c, fmt.Errorf("scan call: %w", err)
+	}
+	if group.Valid {
+		c.GroupJID = &group.String
+	}
+	if endedAt.Valid {
+		c.EndedAt = &endedAt.String
+	}
+	if reason.Valid {
+		c.EndReason = &reason.String
+	}
+	c.CallerName = s.ResolveName(c.Caller)
+	return c, nil
+}
@@ -0,0 +1,393 @@
+package db
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SourceImported marks messages imported from an exported chat file.
+const SourceImported = "imported"
+
+// Date orders of exported chat files; see ImportChatOpts.DateOrder.
+const (
+	DateOrderDMY = "dmy"
+	DateOrderMDY = "mdy"
+)
+
+// ParticipantMe maps a participant of an exported chat to our own account.
+const ParticipantMe = "me"
+
+// ImportChatOpts holds parameters for ImportChat.
+type ImportChatOpts struct {
+	ChatJID string
+	Path    string // a .txt file written by WhatsApp's "Export chat"
+
+	// Participants maps the names in the file to JIDs or phone numbers, or
+	// to ParticipantMe. Names that are phone numbers need no mapping.
+	Participants map[string]string
+
+	// OwnJID is our account's JID, recorded as the sender of our messages.
+	OwnJID string
+
+	// DateOrder resolves dates such as 03/04/21 when no date in the file
+	// tells day and month apart: DateOrderDMY (default) or DateOrderMDY.
+	DateOrder string
+
+	DryRun bool // parse and count without storing
+}
+
+// ImportChatResult is the result of ImportChat.
+type ImportChatResult struct {
+	Parsed    int       `json:"parsed"`    // messages found in the file
+	Imported  int       `json:"imported"`  // messages stored
+	Duplicate int       `json:"duplicate"` // already stored, e.g. from a history sync
+	Skipped   int       `json:"skipped"`   // system notices without a sender
+	First     time.Time `json:"first"`
+	Last      time.Time `json:"last"`
+}
+
+// UnmappedParticipantsError is returned by ImportChat when senders in the
+// file have no mapping.
+type UnmappedParticipantsError struct {
+	Names []string
+}
+
+func (e *UnmappedParticipantsError) Error() string {
+	return fmt.Sprintf("no JID for participants %s: map them to a JID, phone number or %q", strings.Join(e.Names, ", "), ParticipantMe)
+}
+
+// ExportedMessage is a message read from an exported chat file.
+type ExportedMessage struct {
+	Time   time.Time
+	Sender string // name as shown in the file; "" for system notices
+	Text   string
+}
+
+// Exported chats start every message with a date and time, in a format
+// that depends on the phone and its locale:
+//
+//	31/12/2020, 23:59 - Name: text            (Android)
+//	12/31/20, 11:59 PM - Name: text           (Android, US)
+//	31.12.20, 23:59 - Name: text              (Android, German)
+//	[31/12/2020, 23:59:59] Name: text         (iOS)
+//	[2020-12-31, 11:59:59 p. m.] Name: text   (iOS, other locales)
+//
+// Lines that don't start like this continue the previous message.
+const (
+	exportDatePattern = `(\d{1,4})[./-](\d{1,2})[./-](\d{1,4}),?\s+`
+	exportTimePattern = `(\d{1,2})[:.](\d{2})(?:[:.](\d{2}))?(?:\s*([AaPp])\.?\s?[Mm]\.?)?`
+)
+
+var (
+	androidHeader = regexp.MustCompile(`^` + exportDatePattern + exportTimePattern + `\s+[-–]\s+(.*)$`)
+	iosHeader     = regexp.MustCompile(`^\[` + exportDatePattern + exportTimePattern + `\]\s+(.*)$`)
+	phoneName     = regexp.MustCompile(`^\+?[\d\s().-]{7,}$`)
+)
+
+// exportLine is a message header whose date is not resolved yet.
+type exportLine struct {
+	date   [3]int
+	clock  time.Duration
+	sender string
+	text   strings.Builder
+}
+
+// ParseChatExport reads the messages of an exported chat file. Times are
+// read as local time. dateOrder is used as in ImportChatOpts.
+func ParseChatExport(r io.Reader, dateOrder string) ([]ExportedMessage, error) {
+	var lines []*exportLine
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 4<<20)
+	for scanner.Scan() {
+		line := cleanExportLine(scanner.Text())
+		m := androidHeader.FindStringSubmatch(line)
+		if m == nil {
+			m = iosHeader.FindStringSubmatch(line)
+		}
+		if m == nil {
+			if len(lines) > 0 {
+				last := lines[len(lines)-1]
+				last.text.WriteString("\n" + line)
+			}
+			continue
+		}
+		l, err := parseExportHeader(m)
+		if err != nil {
+			return nil, fmt.Errorf("line %q: %w", line, err)
+		}
+		lines = append(lines, l)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("no messages found: not a WhatsApp chat export")
+	}
+
+	order, err := exportDateOrder(lines, dateOrder)
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]ExportedMessage, 0, len(lines))
+	for _, l := range lines {
+		var year, month, day int
+		switch order {
+		case "ymd":
+			year, month, day = l.date[0], l.date[1], l.date[2]
+		case DateOrderMDY:
+			month, day, year = l.date[0], l.date[1], l.date[2]
+		default:
+			day, month, year = l.date[0], l.date[1], l.date[2]
+		}
+		if year < 100 {
+			year += 2000
+		}
+		if month < 1 || month > 12 || day < 1 || day > 31 {
+			return nil, fmt.Errorf("invalid date %d-%02d-%02d", year, month, day)
+		}
+		t := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.Local).Add(l.clock)
+		messages = append(messages, ExportedMessage{Time: t, Sender: l.sender, Text: l.text.String()})
+	}
+	return messages, nil
+}
+
+// cleanExportLine removes the direction marks exports put around names and
+// media notes, and the narrow spaces before AM/PM.
+func cleanExportLine(line string) string {
+	line = strings.NewReplacer("\u200e", "", "\u200f", "", "\ufeff", "", "\u202f", " ", "\u00a0", " ").Replace(line)
+	return strings.TrimRight(line, "\r")
+}
+
+func parseExportHeader(m []string) (*exportLine, error) {
+	l := &exportLine{}
+	for i := range l.date {
+		l.date[i], _ = strconv.Atoi(m[1+i])
+	}
+	hour, _ := strconv.Atoi(m[4])
+	minute, _ := strconv.Atoi(m[5])
+	second, _ := strconv.Atoi(m[6]) // may be empty
+	switch strings.ToLower(m[7]) {
+	case "a":
+		if hour == 12 {
+			hour = 0
+		}
+	case "p":
+		if hour < 12 {
+			hour += 12
+		}
+	}
+	if hour > 23 || minute > 59 || second > 59 {
+		return nil, fmt.Errorf("invalid time")
+	}
+	l.clock = time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute + time.Duration(second)*time.Second
+
+	// System notices ("Messages are end-to-end encrypted", "X added Y")
+	// have no sender
+	if sender, text, ok := strings.Cut(m[8], ": "); ok {
+		l.sender = strings.TrimSpace(sender)
+		l.text.WriteString(text)
+	} else {
+		l.text.WriteString(m[8])
+	}
+	return l, nil
+}
+
+// exportDateOrder works out the order of the date fields from dates that
+// can only be read one way, falling back to fallback.
+func exportDateOrder(lines []*exportLine, fallback string) (string, error) {
+	dayFirst, monthFirst := false, false
+	for _, l := range lines {
+		switch {
+		case l.date[0] > 31:
+			return "ymd", nil
+		case l.date[0] > 12:
+			dayFirst = true
+		case l.date[1] > 12:
+			monthFirst = true
+		}
+	}
+	switch {
+	case dayFirst && monthFirst:
+		return "", fmt.Errorf("inconsistent dates: some have the day first, others the month")
+	case dayFirst:
+		return DateOrderDMY, nil
+	case monthFirst:
+		return DateOrderMDY, nil
+	case fallback == DateOrderMDY:
+		return DateOrderMDY, nil
+	}
+	return DateOrderDMY, nil
+}
+
+// ExportParticipants returns the sender names of exported messages, sorted.
+func ExportParticipants(messages []ExportedMessage) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, m := range messages {
+		if m.Sender != "" && !seen[m.Sender] {
+			seen[m.Sender] = true
+			names = append(names, m.Sender)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// resolveParticipant returns the sender (the user part of a JID) for a
+// participant name, and whether it is our own account.
+func resolveParticipant(name string, mapping map[string]string, ownJID string) (sender string, fromMe, ok bool) {
+	target, mapped := mapping[name]
+	if !mapped {
+		if !phoneName.MatchString(name) {
+			return "", false, false
+		}
+		target = name
+	}
+	target = strings.TrimSpace(target)
+	if strings.EqualFold(target, ParticipantMe) {
+		user, _, _ := strings.Cut(ownJID, "@")
+		user, _, _ = strings.Cut(user, ":")
+		return user, true, true
+	}
+	if user, _, isJID := strings.Cut(target, "@"); isJID {
+		return user, false, user != ""
+	}
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, target)
+	return digits, false, digits != ""
+}
+
+// ImportChat reads an exported chat file and stores its messages in the
+// chat, marked with SourceImported. Messages already stored with the same
+// minute and text are skipped, so a file can be imported again, and into a
+// chat that history sync filled in part. Every sender must be mapped in
+// opts.Participants, or the result is an *UnmappedParticipantsError.
+func (s *Store) ImportChat(opts ImportChatOpts) (ImportChatResult, error) {
+	var result ImportChatResult
+	if opts.ChatJID == "" || opts.Path == "" {
+		return result, fmt.Errorf("chat JID and file must be given")
+	}
+	f, err := os.Open(opts.Path)
+	if err != nil {
+		return result, err
+	}
+	defer f.Close()
+	messages, err := ParseChatExport(f, opts.DateOrder)
+	if err != nil {
+		return result, fmt.Errorf("parse %s: %w", opts.Path, err)
+	}
+
+	type participant struct {
+		sender string
+		fromMe bool
+	}
+	participants := make(map[string]participant)
+	var unmapped []string
+	for _, name := range ExportParticipants(messages) {
+		sender, fromMe, ok := resolveParticipant(name, opts.Participants, opts.OwnJID)
+		if !ok {
+			unmapped = append(unmapped, name)
+			continue
+		}
+		participants[name] = participant{sender, fromMe}
+	}
+	if len(unmapped) > 0 {
+		return result, &UnmappedParticipantsError{Names: unmapped}
+	}
+
+	existing, err := s.importKeys(opts.ChatJID)
+	if err != nil {
+		return result, err
+	}
+	var records []MessageRecord
+	for i, m := range messages {
+		if m.Sender == "" {
+			result.Skipped++
+			continue
+		}
+		result.Parsed++
+		if result.First.IsZero() || m.Time.Before(result.First) {
+			result.First = m.Time
+		}
+		if m.Time.After(result.Last) {
+			result.Last = m.Time
+		}
+		key := importKey(m.Time, m.Text)
+		if existing[key] > 0 {
+			existing[key]--
+			result.Duplicate++
+			continue
+		}
+		p := participants[m.Sender]
+		records = append(records, MessageRecord{
+			ID:        importedMessageID(opts.ChatJID, m, i),
+			ChatJID:   opts.ChatJID,
+			Sender:    p.sender,
+			Content:   m.Text,
+			Timestamp: m.Time,
+			IsFromMe:  p.fromMe,
+			Source:    SourceImported,
+		})
+	}
+	if opts.DryRun || len(records) == 0 {
+		result.Imported = len(records)
+		return result, nil
+	}
+
+	name := ""
+	if chat, err := s.GetChat(opts.ChatJID, false); err == nil && chat != nil && chat.Name != nil {
+		name = *chat.Name
+	}
+	if err := s.StoreChat(opts.ChatJID, name, result.Last); err != nil {
+		return result, fmt.Errorf("store chat: %w", err)
+	}
+	result.Imported, err = s.StoreMessages(records)
+	return result, err
+}
+
+// importKeys counts the chat's stored messages by importKey.
+func (s *Store) importKeys(chatJID string) (map[string]int, error) {
+	rows, err := s.MsgDB.Query("SELECT timestamp, wahoo_decrypt(content) FROM messages WHERE chat_jid = ?", chatJID)
+	if err != nil {
+		return nil, fmt.Errorf("read stored messages: %w", err)
+	}
+	defer rows.Close()
+	keys := make(map[string]int)
+	for rows.Next() {
+		var t time.Time
+		var content *string
+		if err := rows.Scan(&t, &content); err != nil {
+			return nil, err
+		}
+		if content != nil {
+			keys[importKey(t, *content)]++
+		}
+	}
+	return keys, rows.Err()
+}
+
+// importKey identifies a message by minute and text, as precise as exported
+// chats are.
+func importKey(t time.Time, text string) string {
+	return t.Truncate(time.Minute).UTC().Format(time.RFC3339) + "\x00" + strings.TrimSpace(text)
+}
+
+// importedMessageID derives a stable ID from a message and its position n
+// in the file, so importing the file twice stores each message once.
+func importedMessageID(chatJID string, m ExportedMessage, n int) string {
+	h := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%d\x00%s\x00%s\x00%d", chatJID, m.Time.Unix(), m.Sender, m.Text, n)))
+	return "imported-" + hex.EncodeToString(h[:10])
+}
@@ -0,0 +1,175 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// SetChatArchived records whether a chat is archived.
+func (s *Store) SetChatArchived(chatJID string, archived bool) error {
+	_, err := s.MsgDB.Exec("UPDATE chats SET archived = ? WHERE jid = ?", archived, chatJID)
+	return err
+}
+
+// SetChatPinned records whether a chat is pinned.
+func (s *Store) SetChatPinned(chatJID string, pinned bool) error {
+	_, err := s.MsgDB.Exec("UPDATE chats SET pinned = ? WHERE jid = ?", pinned, chatJID)
+	return err
+}
+
+// SetChatMuted records the mute state of a chat. A zero until while muted means muted forever.
+func (s *Store) SetChatMuted(chatJID string, muted bool, until time.Time) error {
+	var mutedUntil any
+	if muted && !until.IsZero() {
+		mutedUntil = until
+	}
+	_, err := s.MsgDB.Exec("UPDATE chats SET muted = ?, muted_until = ? WHERE jid = ?", muted, mutedUntil, chatJID)
+	return err
+}
+
+// SetChatAutoRead records whether incoming messages in a chat are marked as read automatically.
+func (s *Store) SetChatAutoRead(chatJID string, autoRead bool) error {
+	_, err := s.MsgDB.Exec("UPDATE chats SET auto_read = ? WHERE jid = ?", autoRead, chatJID)
+	return err
+}
+
+// ChatAutoRead reports whether auto-read is enabled for a chat.
+func (s *Store) ChatAutoRead(chatJID string) bool {
+	var autoRead sql.NullBool
+	s.MsgDB.QueryRow("SELECT auto_read FROM chats WHERE jid = ?", chatJID).Scan(&autoRead)
+	return autoRead.Bool
+}
+
+// SetChatDisappearingTimer records how long new messages in a chat last
+// before they disappear. Zero means disappearing messages are off.
+func (s *Store) SetChatDisappearingTimer(chatJID string, timer time.Duration) error {
+	_, err := s.MsgDB.Exec("UPDATE chats SET disappearing_timer = ? WHERE jid = ?", int64(timer.Seconds()), chatJID)
+	return err
+}
+
+// FormatDisappearingTimer formats a disappearing-message timer the way
+// WhatsApp offers it (24h, 7d, 90d), or "" if it is off.
+func FormatDisappearingTimer(timer time.Duration) string {
+	const day = 24 * time.Hour
+	switch {
+	case timer <= 0:
+		return ""
+	case timer == day:
+		return "24h"
+	case timer%day != 0:
+		return timer.String()
+	default:
+		return fmt.Sprintf("%dd", timer/day)
+	}
+}
+
+// Send profiles control how messages to a chat are paced.
+const (
+	SendProfileDefault  = ""         // send immediately
+	SendProfileHumanize = "humanize" // typing indicator and randomized pauses
+)
+
+// SetChatSendProfile records the send profile of a chat.
+func (s *Store) SetChatSendProfile(chatJID, profile string) error {
+	_, err := s.MsgDB.Exec("UPDATE chats SET send_profile = ? WHERE jid = ?", profile, chatJID)
+	return err
+}
+
+// ChatSendProfile returns the send profile of a chat.
+func (s *Store) ChatSendProfile(chatJID string) string {
+	var profile sql.NullString
+	s.MsgDB.QueryRow("SELECT send_profile FROM chats WHERE jid = ?", chatJID).Scan(&profile)
+	return profile.String
+}
+
+// UnreadSenders groups the given incoming messages of a chat by sender.
+// IDs that are not stored or were sent by us are returned as skipped.
+func (s *Store) UnreadSenders(chatJID string, ids []string) (map[string][]string, []string, error) {
+	if len(ids) == 0 {
+		return map[string][]string{}, nil, nil
+	}
+	rows, err := s.MsgDB.Query(
+		"SELECT id, sender FROM messages WHERE chat_jid = ? AND is_from_me = 0 AND id IN ("+placeholders(len(ids))+")",
+		append([]any{chatJID}, repeatArgs(ids, 1)...)...,
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("look up messages: %w", err)
+	}
+	defer rows.Close()
+
+	bySender := make(map[string][]string)
+	found := make(map[string]bool)
+	for rows.Next() {
+		var id, sender string
+		if rows.Scan(&id, &sender) == nil {
+			bySender[sender] = append(bySender[sender], id)
+			found[id] = true
+		}
+	}
+	var skipped []string
+	for _, id := range ids {
+		if !found[id] {
+			skipped = append(skipped, id)
+		}
+	}
+	return bySender, skipped, nil
+}
+
+// ClearChatMessages deletes the stored messages of a chat up to and including before,
+// mirroring "clear chat" on the phone. The chat itself is kept.
+func (s *Store) ClearChatMessages(chatJID string, before time.Time) (int64, error) {
+	res, err := s.MsgDB.Exec("DELETE FROM messages WHERE chat_jid = ? AND timestamp <= ?", chatJID, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// DeleteChat removes a chat and all its messages.
+func (s *Store) DeleteChat(chatJID string) error {
+	if _, err := s.MsgDB.Exec("DELETE FROM messages WHERE chat_jid = ?", chatJID); err != nil {
+		return err
+	}
+	_, err := s.MsgDB.Exec("DELETE FROM chats WHERE jid = ?", chatJID)
+	return err
+}
+
+// MarkChatRead moves the last-read time of a chat forward to at.
+func (s *Store) MarkChatRead(chatJID string, at time.Time) error {
+	_, err := s.MsgDB.Exec(
+		"UPDATE chats SET last_read_time = ? WHERE jid = ? AND (last_read_time IS NULL OR last_read_time < ?)",
+		at, chatJID, at,
+	)
+	return err
+}
+
+// MarkChatReadThrough moves the last-read time of a chat forward to the newest
+// of the given messages.
+func (s *Store) MarkChatReadThrough(chatJID string, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := s.MsgDB.Exec(
+		`UPDATE chats SET last_read_time = newest.ts
+		 FROM (SELECT MAX(timestamp) AS ts FROM messages WHERE chat_jid = ? AND id IN (`+placeholders(len(ids))+`)) AS newest
+		 WHERE chats.jid = ? AND newest.ts IS NOT NULL
+		   AND (chats.last_read_time IS NULL OR chats.last_read_time < newest.ts)`,
+		append(append([]any{chatJID}, repeatArgs(ids, 1)...), chatJID)...,
+	)
+	return err
+}
+
+// SetChatUnreadCount sets the last-read time of a chat so that its n newest
+// incoming messages are unread, e.g. when WhatsApp reports an unread count or
+// the chat is marked as unread.
+func (s *Store) SetChatUnreadCount(chatJID string, n int) error {
+	_, err := s.MsgDB.Exec(
+		`UPDATE chats SET last_read_time = (
+		   SELECT timestamp FROM messages WHERE chat_jid = ? AND is_from_me = 0
+		   ORDER BY timestamp DESC LIMIT 1 OFFSET ?)
+		 WHERE jid = ?`,
+		chatJID, n, chatJID,
+	)
+	return err
+}
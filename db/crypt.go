@@ -0,0 +1,233 @@
+package db
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"modernc.org/sqlite"
+)
+
+// Encrypted values are stored as text: the prefix, the ID of the key and
+// the base64 of the nonce followed by the AES-256-GCM ciphertext.
+const (
+	encryptedPrefix   = "enc1:"
+	keyDerivationIter = 600_000
+	keyVerifierText   = "wahoo"
+)
+
+// encryptedColumns hold message text. They are encrypted when the store is
+// opened with a key; chat names, senders, timestamps and media metadata are
+// not, so the message list can still be filtered and sorted in SQL.
+var encryptedColumns = []struct{ table, column string }{
+	{"messages", "content"},
+	{"messages", "vcard"},
+	{"transcripts", "text"},
+	{"sends", "content"},
+	{"statuses", "content"},
+	{"moderation_log", "content"},
+	{"audit_log", "arguments"},
+	{"audit_log", "result"},
+	{"templates", "body"},
+}
+
+// keyring maps key IDs to the ciphers of the stores opened with a key, so
+// the decrypt SQL function can decrypt values of every store.
+var keyring sync.Map
+
+// init registers wahoo_decrypt(value), which queries select the encrypted
+// columns through. Plaintext values pass through unchanged, so the queries
+// work whether or not a store is encrypted.
+func init() {
+	sqlite.MustRegisterDeterministicScalarFunction("wahoo_decrypt", 1, func(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		value, ok := args[0].(string)
+		if !ok || !strings.HasPrefix(value, encryptedPrefix) {
+			return args[0], nil
+		}
+		if plaintext, err := openValue(value); err == nil {
+			return plaintext, nil
+		}
+		return value, nil
+	})
+}
+
+// fieldCipher encrypts column values with a key derived from the database key.
+type fieldCipher struct {
+	id   string
+	aead cipher.AEAD
+}
+
+func newFieldCipher(passphrase string, salt []byte) (*fieldCipher, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, keyDerivationIter, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(key)
+	return &fieldCipher{id: hex.EncodeToString(sum[:4]), aead: aead}, nil
+}
+
+func (c *fieldCipher) seal(plaintext string) string {
+	nonce := make([]byte, c.aead.NonceSize())
+	rand.Read(nonce)
+	sealed := c.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return encryptedPrefix + c.id + ":" + base64.RawStdEncoding.EncodeToString(sealed)
+}
+
+func (c *fieldCipher) open(value string) (string, error) {
+	encoded, ok := strings.CutPrefix(value, encryptedPrefix+c.id+":")
+	if !ok {
+		return "", errors.New("value not encrypted with this key")
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	n := c.aead.NonceSize()
+	if err != nil || len(sealed) < n {
+		return "", errors.New("malformed encrypted value")
+	}
+	plaintext, err := c.aead.Open(nil, sealed[:n], sealed[n:], nil)
+	return string(plaintext), err
+}
+
+// openValue decrypts a value with the key it names.
+func openValue(value string) (string, error) {
+	id, _, _ := strings.Cut(strings.TrimPrefix(value, encryptedPrefix), ":")
+	c, ok := keyring.Load(id)
+	if !ok {
+		return "", fmt.Errorf("unknown key %s", id)
+	}
+	return c.(*fieldCipher).open(value)
+}
+
+// seal encrypts text for an encrypted column, if the store has a key.
+// Empty text is stored as is.
+func (s *Store) seal(text string) string {
+	if s.cipher == nil || text == "" {
+		return text
+	}
+	return s.cipher.seal(text)
+}
+
+// Encrypted reports whether the store encrypts message text.
+func (s *Store) Encrypted() bool {
+	return s.cipher != nil
+}
+
+// setupEncryption checks key against the database. A database without
+// encryption gets it enabled, encrypting the text stored so far; an
+// encrypted database can't be opened without its key.
+func (s *Store) setupEncryption(key string) error {
+	var salt []byte
+	var verifier string
+	err := s.MsgDB.QueryRow("SELECT salt, verifier FROM encryption WHERE id = 1").Scan(&salt, &verifier)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("read encryption settings: %w", err)
+	}
+	encrypted := err == nil
+
+	switch {
+	case key == "" && encrypted:
+		return errors.New("messages.db is encrypted: start with -db-key or -db-key-file")
+	case key == "":
+		return nil
+	case encrypted:
+		c, err := newFieldCipher(key, salt)
+		if err != nil {
+			return err
+		}
+		if text, err := c.open(verifier); err != nil || text != keyVerifierText {
+			return errors.New("wrong database key")
+		}
+		s.cipher = c
+		keyring.Store(c.id, c)
+		return nil
+	}
+
+	salt = make([]byte, 16)
+	rand.Read(salt)
+	c, err := newFieldCipher(key, salt)
+	if err != nil {
+		return err
+	}
+	s.cipher = c
+	keyring.Store(c.id, c)
+	return s.encryptExisting(salt)
+}
+
+// encryptExisting encrypts the plaintext stored in the encrypted columns and
+// records the key, in one transaction.
+func (s *Store) encryptExisting(salt []byte) error {
+	tx, err := s.MsgDB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	type row struct {
+		id    int64
+		value string
+	}
+	total := 0
+	for _, col := range encryptedColumns {
+		query := fmt.Sprintf("SELECT rowid, %[2]s FROM %[1]s WHERE rowid > ? AND %[2]s != '' AND %[2]s NOT LIKE '%[3]s%%' ORDER BY rowid LIMIT 1000",
+			col.table, col.column, encryptedPrefix)
+		update := fmt.Sprintf("UPDATE %s SET %s = ? WHERE rowid = ?", col.table, col.column)
+		var lastID int64
+		for {
+			rows, err := tx.Query(query, lastID)
+			if err != nil {
+				return fmt.Errorf("encrypt %s.%s: %w", col.table, col.column, err)
+			}
+			var batch []row
+			for rows.Next() {
+				var r row
+				if err := rows.Scan(&r.id, &r.value); err != nil {
+					rows.Close()
+					return fmt.Errorf("encrypt %s.%s: %w", col.table, col.column, err)
+				}
+				batch = append(batch, r)
+			}
+			rows.Close()
+			if len(batch) == 0 {
+				break
+			}
+			for _, r := range batch {
+				if _, err := tx.Exec(update, s.seal(r.value), r.id); err != nil {
+					return fmt.Errorf("encrypt %s.%s: %w", col.table, col.column, err)
+				}
+			}
+			lastID = batch[len(batch)-1].id
+			total += len(batch)
+		}
+	}
+
+	if _, err := tx.Exec("INSERT INTO encryption (id, salt, verifier, created_at) VALUES (1, ?, ?, ?)",
+		salt, s.seal(keyVerifierText), time.Now()); err != nil {
+		return fmt.Errorf("record encryption key: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Encryption enabled: encrypted %d stored values\n", total)
+
+	// Rewrite the file so no plaintext is left in free pages or the WAL
+	return s.Vacuum()
+}
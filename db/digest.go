@@ -0,0 +1,220 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Digest settings: the text is cut to about digestCharsPerToken characters
+// per token of the budget, and single messages to digestMaxRunes.
+const (
+	digestCharsPerToken = 4
+	digestMaxTokens     = 4000
+	digestMaxRunes      = 1000
+)
+
+// DigestOpts selects the messages condensed by ChatDigest.
+type DigestOpts struct {
+	ChatJID   string
+	After     *string
+	Before    *string
+	MaxTokens int // budget for Text (default 4000)
+}
+
+// DigestBucket is the number of messages in one hour, day or week of the
+// timeline, named by its local start time.
+type DigestBucket struct {
+	Start string `json:"start"`
+	Count int    `json:"count"`
+}
+
+// ChatDigest is a compact view of a chat over a time window, meant to be
+// summarized by an LLM in one go.
+type ChatDigest struct {
+	ChatJID      string         `json:"chat_jid"`
+	Name         *string        `json:"name,omitempty"`
+	IsGroup      bool           `json:"is_group"`
+	First        *string        `json:"first_message,omitempty"`
+	Last         *string        `json:"last_message,omitempty"`
+	MessageCount int            `json:"message_count"`
+	Participants []SenderCount  `json:"participants"`
+	Bucket       string         `json:"bucket"` // "hour", "day" or "week"
+	Timeline     []DigestBucket `json:"timeline"`
+
+	// Transcript of the window, one line per message under a header per
+	// day. When it exceeds the token budget the oldest messages are left out.
+	Text            string `json:"text"`
+	EstimatedTokens int    `json:"estimated_tokens"`
+	Truncated       bool   `json:"truncated,omitempty"`
+	OmittedMessages int    `json:"omitted_messages,omitempty"`
+}
+
+// ChatDigest condenses the messages of a chat in the window into
+// participants, a timeline and a transcript trimmed to opts.MaxTokens.
+// Deleted messages are skipped. Times are in local time.
+func (s *Store) ChatDigest(opts DigestOpts) (*ChatDigest, error) {
+	if opts.MaxTokens <= 0 {
+		opts.MaxTokens = digestMaxTokens
+	}
+	chat, err := s.GetChat(opts.ChatJID, false)
+	if err != nil {
+		return nil, err
+	}
+	if chat == nil {
+		return nil, fmt.Errorf("chat %s not found", opts.ChatJID)
+	}
+	all, err := s.chatMessages(ExportChatOpts{ChatJID: opts.ChatJID, After: opts.After, Before: opts.Before})
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []MessageDict
+	var times []time.Time
+	for _, m := range all {
+		ts, err := time.Parse(time.RFC3339Nano, m.Timestamp)
+		if err != nil || m.Revoked {
+			continue
+		}
+		messages = append(messages, m)
+		times = append(times, ts.Local())
+	}
+
+	d := &ChatDigest{
+		ChatJID:      chat.JID,
+		Name:         chat.Name,
+		IsGroup:      chat.IsGroup,
+		MessageCount: len(messages),
+		Participants: digestParticipants(messages),
+		Timeline:     []DigestBucket{},
+	}
+	if len(messages) == 0 {
+		d.Bucket = "day"
+		return d, nil
+	}
+	d.First, d.Last = &messages[0].Timestamp, &messages[len(messages)-1].Timestamp
+	d.Bucket, d.Timeline = digestTimeline(times)
+	d.Text, d.OmittedMessages = digestText(messages, times, opts.MaxTokens*digestCharsPerToken)
+	d.Truncated = d.OmittedMessages > 0
+	d.EstimatedTokens = (len(d.Text) + digestCharsPerToken - 1) / digestCharsPerToken
+	return d, nil
+}
+
+// digestParticipants counts the messages per sender, most active first.
+func digestParticipants(messages []MessageDict) []SenderCount {
+	counts := map[string]*SenderCount{}
+	for _, m := range messages {
+		key := m.SenderJID
+		if m.IsFromMe {
+			key = "me"
+		}
+		sc := counts[key]
+		if sc == nil {
+			sc = &SenderCount{Sender: key, Name: m.Sender}
+			counts[key] = sc
+		}
+		sc.Count++
+	}
+	result := []SenderCount{}
+	for _, sc := range counts {
+		result = append(result, *sc)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// digestTimeline buckets the message times (oldest first) by hour for
+// windows up to two days, by week beyond 90 days and by day otherwise.
+func digestTimeline(times []time.Time) (string, []DigestBucket) {
+	span := times[len(times)-1].Sub(times[0])
+	bucket, layout := "day", "2006-01-02"
+	switch {
+	case span <= 48*time.Hour:
+		bucket, layout = "hour", "2006-01-02 15:00"
+	case span > 90*24*time.Hour:
+		bucket = "week"
+	}
+
+	timeline := []DigestBucket{}
+	for _, ts := range times {
+		if bucket == "week" {
+			// weeks start on Monday
+			ts = ts.AddDate(0, 0, -(int(ts.Weekday())+6)%7)
+		}
+		start := ts.Format(layout)
+		if n := len(timeline); n > 0 && timeline[n-1].Start == start {
+			timeline[n-1].Count++
+		} else {
+			timeline = append(timeline, DigestBucket{Start: start, Count: 1})
+		}
+	}
+	return bucket, timeline
+}
+
+// digestText renders the messages as "15:04 Sender: text" lines under a
+// header per day, keeping the most recent ones that fit in maxChars. It
+// returns the text and how many older messages were left out.
+func digestText(messages []MessageDict, times []time.Time, maxChars int) (string, int) {
+	lines := make([]string, len(messages))
+	for i, m := range messages {
+		lines[i] = fmt.Sprintf("%s %s: %s", times[i].Format("15:04"), m.Sender, digestContent(m))
+	}
+	dayHeader := func(i int) string { return "## " + times[i].Format("Mon 2006-01-02") }
+
+	// Walk back from the newest message while the lines and the headers of
+	// their days fit.
+	start, size := len(messages), 0
+	for i := len(messages) - 1; i >= 0; i-- {
+		n := len(lines[i]) + 1
+		if i == len(messages)-1 || !sameDay(times[i], times[i+1]) {
+			n += len(dayHeader(i)) + 1
+		}
+		if size+n > maxChars && start < len(messages) {
+			break
+		}
+		start, size = i, size+n
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		fmt.Fprintf(&b, "[%d earlier messages omitted]\n", start)
+	}
+	for i := start; i < len(messages); i++ {
+		if i == start || !sameDay(times[i], times[i-1]) {
+			b.WriteString(dayHeader(i) + "\n")
+		}
+		b.WriteString(lines[i] + "\n")
+	}
+	return b.String(), start
+}
+
+// digestContent is the text of a message on one line: its content, audio
+// transcript or attachment, cut to digestMaxRunes.
+func digestContent(m MessageDict) string {
+	content := m.Content
+	if m.Transcript != nil && *m.Transcript != "" {
+		content = strings.TrimSpace(content + " " + *m.Transcript)
+	}
+	if a := attachment(m); a != "" {
+		content = strings.TrimSpace(fmt.Sprintf("<%s> %s", a, content))
+	}
+	content = strings.Join(strings.Fields(content), " ")
+	if utf8.RuneCountInString(content) > digestMaxRunes {
+		content = string([]rune(content)[:digestMaxRunes]) + "…"
+	}
+	if m.Edited {
+		content += " (edited)"
+	}
+	return content
+}
+
+func sameDay(a, b time.Time) bool {
+	return a.YearDay() == b.YearDay() && a.Year() == b.Year()
+}
@@ -0,0 +1,213 @@
+package db
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// EmbeddingInput is a message whose text still needs an embedding.
+type EmbeddingInput struct {
+	ID      string
+	ChatJID string
+	Text    string
+}
+
+// SemanticMatch is a message found by semantic search with its cosine
+// similarity to the query.
+type SemanticMatch struct {
+	MessageDict
+	Score float64 `json:"score"`
+}
+
+// SemanticSearchOpts filters the messages searched by SemanticSearch.
+type SemanticSearchOpts struct {
+	ChatJID  *string
+	After    *string
+	Before   *string
+	Limit    int     // top-k, default 10
+	MinScore float64 // drop matches less similar than this
+}
+
+// PendingEmbeddings returns up to limit messages with text but no embedding
+// from model, newest first so recent messages become searchable first.
+func (s *Store) PendingEmbeddings(model string, limit int) ([]EmbeddingInput, error) {
+	rows, err := s.MsgDB.Query(
+		`SELECT messages.id, messages.chat_jid, wahoo_decrypt(messages.content)
+		 FROM messages
+		 LEFT JOIN message_embeddings e ON e.chat_jid = messages.chat_jid AND e.message_id = messages.id AND e.model = ?
+		 WHERE messages.content IS NOT NULL AND messages.content != '' AND e.message_id IS NULL
+		 ORDER BY messages.timestamp DESC LIMIT ?`,
+		model, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("find messages to embed: %w", err)
+	}
+	defer rows.Close()
+
+	var result []EmbeddingInput
+	for rows.Next() {
+		var in EmbeddingInput
+		if err := rows.Scan(&in.ID, &in.ChatJID, &in.Text); err != nil {
+			return nil, err
+		}
+		result = append(result, in)
+	}
+	return result, rows.Err()
+}
+
+// StoreEmbeddings stores the vectors computed by model for the messages,
+// replacing those of other models.
+func (s *Store) StoreEmbeddings(model string, inputs []EmbeddingInput, vectors [][]float32) error {
+	if len(inputs) != len(vectors) {
+		return fmt.Errorf("got %d vectors for %d messages", len(vectors), len(inputs))
+	}
+	tx, err := s.MsgDB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	for i, in := range inputs {
+		if _, err := tx.Exec(
+			`INSERT OR REPLACE INTO message_embeddings (chat_jid, message_id, model, vector, created_at)
+			 VALUES (?, ?, ?, ?, ?)`,
+			in.ChatJID, in.ID, model, encodeVector(vectors[i]), now,
+		); err != nil {
+			return fmt.Errorf("store embedding of %s: %w", in.ID, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteStaleEmbeddings removes the embeddings of deleted messages. It
+// returns how many it removed.
+func (s *Store) DeleteStaleEmbeddings() (int64, error) {
+	res, err := s.MsgDB.Exec(
+		`DELETE FROM message_embeddings WHERE NOT EXISTS (
+			SELECT 1 FROM messages WHERE messages.chat_jid = message_embeddings.chat_jid
+			AND messages.id = message_embeddings.message_id)`,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("delete stale embeddings: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// EmbeddedCount returns how many messages have an embedding from model.
+func (s *Store) EmbeddedCount(model string) (int, error) {
+	var n int
+	err := s.MsgDB.QueryRow("SELECT COUNT(*) FROM message_embeddings WHERE model = ?", model).Scan(&n)
+	return n, err
+}
+
+// SemanticSearch returns the messages whose embeddings from model are most
+// similar to query, best first. Vectors are compared exhaustively, which is
+// fast enough for the history of a single account.
+func (s *Store) SemanticSearch(model string, query []float32, opts SemanticSearchOpts) ([]SemanticMatch, error) {
+	if opts.Limit <= 0 {
+		opts.Limit = 10
+	}
+	query = normalizeVector(query)
+
+	q := `SELECT e.chat_jid, e.message_id, e.vector FROM message_embeddings e
+		JOIN messages ON messages.chat_jid = e.chat_jid AND messages.id = e.message_id
+		WHERE e.model = ?`
+	params := []any{model}
+	if opts.ChatJID != nil {
+		q += " AND messages.chat_jid = ?"
+		params = append(params, *opts.ChatJID)
+	}
+	if opts.After != nil {
+		q += " AND messages.timestamp > ?"
+		params = append(params, *opts.After)
+	}
+	if opts.Before != nil {
+		q += " AND messages.timestamp < ?"
+		params = append(params, *opts.Before)
+	}
+
+	rows, err := s.MsgDB.Query(q, params...)
+	if err != nil {
+		return nil, fmt.Errorf("semantic search: %w", err)
+	}
+	defer rows.Close()
+
+	type hit struct {
+		chatJID, id string
+		score       float64
+	}
+	var top []hit // best first, at most opts.Limit
+	for rows.Next() {
+		var h hit
+		var vector []byte
+		if err := rows.Scan(&h.chatJID, &h.id, &vector); err != nil {
+			return nil, err
+		}
+		if len(vector) != 4*len(query) {
+			continue
+		}
+		h.score = dotProduct(query, vector)
+		if h.score < opts.MinScore || (len(top) == opts.Limit && h.score <= top[len(top)-1].score) {
+			continue
+		}
+		i := sort.Search(len(top), func(i int) bool { return top[i].score < h.score })
+		if len(top) < opts.Limit {
+			top = append(top, hit{})
+		}
+		copy(top[i+1:], top[i:])
+		top[i] = h
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	matches := make([]SemanticMatch, 0, len(top))
+	for _, h := range top {
+		m, err := s.getMessage(h.id, h.chatJID)
+		if err != nil {
+			continue
+		}
+		matches = append(matches, SemanticMatch{MessageDict: rawToDict(m), Score: math.Round(h.score*1000) / 1000})
+	}
+	return matches, nil
+}
+
+// encodeVector stores v scaled to unit length, so cosine similarity is a dot product.
+func encodeVector(v []float32) []byte {
+	v = normalizeVector(v)
+	b := make([]byte, 4*len(v))
+	for i, f := range v {
+		binary.LittleEndian.PutUint32(b[4*i:], math.Float32bits(f))
+	}
+	return b
+}
+
+func normalizeVector(v []float32) []float32 {
+	var sum float64
+	for _, f := range v {
+		sum += float64(f) * float64(f)
+	}
+	if sum == 0 {
+		return v
+	}
+	norm := float32(math.Sqrt(sum))
+	out := make([]float32, len(v))
+	for i, f := range v {
+		out[i] = f / norm
+	}
+	return out
+}
+
+// dotProduct multiplies q with a vector encoded by encodeVector.
+func dotProduct(q []float32, encoded []byte) float64 {
+	var sum float32
+	for i, f := range q {
+		sum += f * math.Float32frombits(binary.LittleEndian.Uint32(encoded[4*i:]))
+	}
+	return float64(sum)
+}
@@ -0,0 +1,246 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"strings"
+	"time"
+)
+
+// Chat export formats.
+const (
+	ExportFormatJSON = "json"
+	ExportFormatText = "text"
+	ExportFormatHTML = "html"
+)
+
+// ExportChatOpts holds parameters for ExportChat.
+type ExportChatOpts struct {
+	ChatJID      string
+	Format       string // json, text or html; default json
+	Path         string
+	After        *string // only messages after this timestamp
+	Before       *string // only messages before this timestamp
+	IncludeMedia bool    // reference downloaded media files by path
+	Redaction    *RedactionProfile
+}
+
+// ChatExport is the document written by ExportChat in JSON format.
+type ChatExport struct {
+	Chat       ChatDict      `json:"chat"`
+	ExportedAt string        `json:"exported_at"`
+	After      *string       `json:"after,omitempty"`
+	Before     *string       `json:"before,omitempty"`
+	Redaction  string        `json:"redaction,omitempty"` // name of the redaction profile applied
+	Messages   []MessageDict `json:"messages"`
+}
+
+// ExportChat writes all messages of a chat, oldest first, to a new file at
+// opts.Path and returns the number of messages exported.
+func (s *Store) ExportChat(opts ExportChatOpts) (int, error) {
+	if opts.Format == "" {
+		opts.Format = ExportFormatJSON
+	}
+	if opts.Format != ExportFormatJSON && opts.Format != ExportFormatText && opts.Format != ExportFormatHTML {
+		return 0, fmt.Errorf("unknown export format %q (use json, text or html)", opts.Format)
+	}
+
+	chat, err := s.GetChat(opts.ChatJID, false)
+	if err != nil {
+		return 0, err
+	}
+	if chat == nil {
+		return 0, fmt.Errorf("chat %s not found", opts.ChatJID)
+	}
+
+	messages, err := s.chatMessages(opts)
+	if err != nil {
+		return 0, err
+	}
+
+	export := ChatExport{
+		Chat:       *chat,
+		ExportedAt: time.Now().Format(time.RFC3339),
+		After:      opts.After,
+		Before:     opts.Before,
+		Messages:   messages,
+	}
+	if opts.Redaction != nil {
+		r := s.Redactor(*opts.Redaction)
+		export.Chat = r.Chat(export.Chat)
+		export.Messages = r.Messages(export.Messages)
+		export.Redaction = opts.Redaction.Name
+	}
+
+	var data []byte
+	switch opts.Format {
+	case ExportFormatJSON:
+		data, err = json.MarshalIndent(export, "", "  ")
+	case ExportFormatText:
+		data = []byte(export.text())
+	case ExportFormatHTML:
+		data, err = export.html()
+	}
+	if err != nil {
+		return 0, err
+	}
+	if err := writeNewFile(opts.Path, data); err != nil {
+		return 0, fmt.Errorf("write chat export: %w", err)
+	}
+	return len(export.Messages), nil
+}
+
+// writeNewFile writes data to a file that must not exist yet, so an export
+// never replaces an existing file. A partial file is removed on failure.
+func writeNewFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
+
+// chatMessages returns the messages of a chat in the export range, oldest first.
+func (s *Store) chatMessages(opts ExportChatOpts) ([]MessageDict, error) {
+	q := `SELECT ` + messageColumns + `
+		  FROM messages
+		  JOIN chats ON messages.chat_jid = chats.jid
+		  WHERE messages.chat_jid = ?`
+	params := []any{opts.ChatJID}
+	if opts.After != nil {
+		q += " AND messages.timestamp > ?"
+		params = append(params, *opts.After)
+	}
+	if opts.Before != nil {
+		q += " AND messages.timestamp < ?"
+		params = append(params, *opts.Before)
+	}
+	q += " ORDER BY messages.timestamp ASC"
+
+	rows, err := s.MsgDB.Query(q, params...)
+	if err != nil {
+		return nil, fmt.Errorf("export messages query: %w", err)
+	}
+	defer rows.Close()
+
+	result := []MessageDict{}
+	for rows.Next() {
+		m, err := scanMessage(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan message: %w", err)
+		}
+		d := rawToDict(m)
+		if !opts.IncludeMedia {
+			d.LocalPath = nil
+		}
+		result = append(result, d)
+	}
+	return result, nil
+}
+
+// exportTime shortens a stored timestamp to minute precision for transcripts.
+func exportTime(ts string) string {
+	if len(ts) >= 16 {
+		ts = ts[:16]
+	}
+	return strings.Replace(ts, "T", " ", 1)
+}
+
+// exportName returns the chat's display name, falling back to its JID.
+func (e *ChatExport) exportName() string {
+	if e.Chat.Name != nil && *e.Chat.Name != "" {
+		return *e.Chat.Name
+	}
+	return e.Chat.JID
+}
+
+// attachment describes a message's media or location in one line.
+func attachment(m MessageDict) string {
+	switch {
+	case m.Location != nil:
+		s := fmt.Sprintf("location %.6f,%.6f", m.Location.Latitude, m.Location.Longitude)
+		if m.Location.Name != "" {
+			s += " " + m.Location.Name
+		}
+		return s
+	case m.MediaType == nil:
+		return ""
+	case m.LocalPath != nil:
+		return fmt.Sprintf("%s: %s", *m.MediaType, *m.LocalPath)
+	default:
+		return *m.MediaType
+	}
+}
+
+// text renders the export as a plain-text transcript.
+func (e *ChatExport) text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Chat: %s (%s)\nExported: %s\n\n", e.exportName(), e.Chat.JID, e.ExportedAt)
+	for _, m := range e.Messages {
+		content := m.Content
+		if m.Revoked {
+			content = "[deleted]"
+		} else if a := attachment(m); a != "" {
+			content = strings.TrimSpace(fmt.Sprintf("<%s> %s", a, content))
+		}
+		if m.Edited {
+			content += " (edited)"
+		}
+		fmt.Fprintf(&b, "[%s] %s: %s\n", exportTime(m.Timestamp), m.Sender, content)
+	}
+	return b.String()
+}
+
+var exportHTMLTemplate = template.Must(template.New("chat").Funcs(template.FuncMap{
+	"time":       exportTime,
+	"attachment": attachment,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Name}}</title>
+<style>
+body { font-family: sans-serif; background: #efeae2; max-width: 800px; margin: 0 auto; padding: 1em; }
+h1 { font-size: 1.3em; margin-bottom: 0; }
+.meta { color: #667781; font-size: 0.85em; margin-bottom: 1.5em; }
+.msg { background: #fff; border-radius: 8px; padding: 6px 10px; margin: 4px 0; max-width: 75%; width: fit-content; }
+.msg.me { background: #d9fdd3; margin-left: auto; }
+.sender { font-weight: bold; font-size: 0.85em; color: #1f7aad; }
+.time { color: #667781; font-size: 0.75em; margin-left: 8px; }
+.attachment { color: #54656f; font-style: italic; }
+.content { white-space: pre-wrap; }
+.deleted { color: #8696a0; font-style: italic; }
+</style>
+</head>
+<body>
+<h1>{{.Name}}</h1>
+<div class="meta">{{.Export.Chat.JID}} &middot; exported {{.Export.ExportedAt}} &middot; {{len .Export.Messages}} messages</div>
+{{range .Export.Messages}}<div class="msg{{if .IsFromMe}} me{{end}}">
+<span class="sender">{{.Sender}}</span><span class="time">{{time .Timestamp}}{{if .Edited}} (edited){{end}}</span>
+{{if .Revoked}}<div class="deleted">This message was deleted</div>{{else}}{{with attachment .}}<div class="attachment">{{.}}</div>{{end}}{{if .Content}}<div class="content">{{.Content}}</div>{{end}}{{end}}
+</div>
+{{end}}</body>
+</html>
+`))
+
+// html renders the export as a self-contained HTML transcript.
+func (e *ChatExport) html() ([]byte, error) {
+	var b strings.Builder
+	err := exportHTMLTemplate.Execute(&b, struct {
+		Name   string
+		Export *ChatExport
+	}{e.exportName(), e})
+	if err != nil {
+		return nil, fmt.Errorf("render chat export: %w", err)
+	}
+	return []byte(b.String()), nil
+}
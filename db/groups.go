@@ -0,0 +1,394 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// GroupParticipantRecord is a group member as written to the group_participants table.
+type GroupParticipantRecord struct {
+	JID          string
+	IsAdmin      bool
+	IsSuperAdmin bool
+}
+
+// GroupRecord is group metadata as written to the groups table.
+type GroupRecord struct {
+	JID           string
+	Name          string
+	Topic         string
+	OwnerJID      string
+	CreatedAt     time.Time
+	Announce      bool   // only admins can send messages
+	Locked        bool   // only admins can edit group info
+	MemberAddMode string // admin_add or all_member_add; empty if unknown
+	Participants  []GroupParticipantRecord
+}
+
+// GroupParticipantDict is the structured output for a group member.
+type GroupParticipantDict struct {
+	JID          string `json:"jid"`
+	Name         string `json:"name"`
+	IsAdmin      bool   `json:"is_admin"`
+	IsSuperAdmin bool   `json:"is_super_admin"`
+}
+
+// GroupDict is the structured output for group queries.
+type GroupDict struct {
+	JID              string                 `json:"jid"`
+	Name             string                 `json:"name"`
+	Topic            *string                `json:"topic,omitempty"`
+	OwnerJID         *string                `json:"owner_jid,omitempty"`
+	CreatedAt        *string                `json:"created_at,omitempty"`
+	Announce         bool                   `json:"announce"`
+	Locked           bool                   `json:"locked"`
+	MemberAddMode    *string                `json:"member_add_mode,omitempty"` // admin_add or all_member_add
+	ParticipantCount int                    `json:"participant_count"`
+	Participants     []GroupParticipantDict `json:"participants,omitempty"`
+	UpdatedAt        string                 `json:"updated_at"`
+}
+
+// StoreGroup replaces the metadata and participant list of a group.
+func (s *Store) StoreGroup(g GroupRecord) error {
+	tx, err := s.MsgDB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var createdAt any
+	if !g.CreatedAt.IsZero() {
+		createdAt = g.CreatedAt
+	}
+	_, err = tx.Exec(
+		`INSERT OR REPLACE INTO groups (jid, name, topic, owner_jid, created_at, announce, locked, member_add_mode, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), ?)`,
+		g.JID, g.Name, g.Topic, g.OwnerJID, createdAt, g.Announce, g.Locked, g.MemberAddMode, time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("store group: %w", err)
+	}
+
+	if _, err := tx.Exec("DELETE FROM group_participants WHERE group_jid = ?", g.JID); err != nil {
+		return fmt.Errorf("clear participants: %w", err)
+	}
+	for _, p := range g.Participants {
+		if _, err := tx.Exec(
+			"INSERT OR REPLACE INTO group_participants (group_jid, jid, is_admin, is_super_admin) VALUES (?, ?, ?, ?)",
+			g.JID, p.JID, p.IsAdmin, p.IsSuperAdmin,
+		); err != nil {
+			return fmt.Errorf("store participant: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// SetGroupSettings updates the announce and locked settings of a cached
+// group; nil leaves a setting unchanged.
+func (s *Store) SetGroupSettings(jid string, announce, locked *bool) error {
+	_, err := s.MsgDB.Exec(
+		"UPDATE groups SET announce = COALESCE(?, announce), locked = COALESCE(?, locked), updated_at = ? WHERE jid = ?",
+		announce, locked, time.Now(), jid,
+	)
+	if err != nil {
+		return fmt.Errorf("update group settings: %w", err)
+	}
+	return nil
+}
+
+// GroupSendRestricted reports whether a cached group is an announcement
+// group (only admins can send) in which none of self is an admin. Groups
+// that aren't cached are not restricted.
+func (s *Store) GroupSendRestricted(groupJID string, self []string) (bool, error) {
+	var restricted bool
+	err := s.MsgDB.QueryRow(
+		`SELECT g.announce AND NOT EXISTS (
+			SELECT 1 FROM group_participants p
+			WHERE p.group_jid = g.jid AND p.jid IN (`+placeholders(len(self))+`) AND (p.is_admin OR p.is_super_admin))
+		 FROM groups g WHERE g.jid = ?`,
+		append(repeatArgs(self, 1), groupJID)...,
+	).Scan(&restricted)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("check group send: %w", err)
+	}
+	return restricted, nil
+}
+
+// DeleteGroup removes a group (e.g. after leaving it) from the cache.
+func (s *Store) DeleteGroup(jid string) error {
+	if _, err := s.MsgDB.Exec("DELETE FROM group_participants WHERE group_jid = ?", jid); err != nil {
+		return err
+	}
+	_, err := s.MsgDB.Exec("DELETE FROM groups WHERE jid = ?", jid)
+	return err
+}
+
+const groupColumns = `g.jid, g.name, g.topic, g.owner_jid, g.created_at, g.announce, g.locked, g.member_add_mode, g.updated_at,
+	(SELECT COUNT(*) FROM group_participants p WHERE p.group_jid = g.jid)`
+
+// scanGroup scans a row selected with groupColumns.
+func scanGroup(row rowScanner) (GroupDict, error) {
+	var d GroupDict
+	var name, topic, owner, createdAt, addMode sql.NullString
+	err := row.Scan(&d.JID, &name, &topic, &owner, &createdAt, &d.Announce, &d.Locked, &addMode, &d.UpdatedAt, &d.ParticipantCount)
+	d.Name = name.String
+	if topic.Valid && topic.String != "" {
+		d.Topic = &topic.String
+	}
+	if owner.Valid && owner.String != "" {
+		d.OwnerJID = &owner.String
+	}
+	if createdAt.Valid && createdAt.String != "" {
+		d.CreatedAt = &createdAt.String
+	}
+	if addMode.Valid {
+		d.MemberAddMode = &addMode.String
+	}
+	return d, err
+}
+
+// ListGroups returns cached groups, optionally filtered by name or JID.
+func (s *Store) ListGroups(query string, limit, page int) ([]GroupDict, error) {
+	if limit == 0 {
+		limit = 20
+	}
+
+	q := "SELECT " + groupColumns + " FROM groups g"
+	var params []any
+	if query != "" {
+		q += " WHERE LOWER(g.name) LIKE LOWER(?) OR g.jid LIKE ?"
+		pattern := "%" + query + "%"
+		params = append(params, pattern, pattern)
+	}
+	q += " ORDER BY g.name LIMIT ? OFFSET ?"
+	params = append(params, limit, page*limit)
+
+	rows, err := s.MsgDB.Query(q, params...)
+	if err != nil {
+		return nil, fmt.Errorf("list groups: %w", err)
+	}
+	defer rows.Close()
+
+	result := []GroupDict{}
+	for rows.Next() {
+		d, err := scanGroup(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan group: %w", err)
+		}
+		result = append(result, d)
+	}
+	return result, nil
+}
+
+// GetGroup returns a cached group with its participants, or nil if unknown.
+func (s *Store) GetGroup(jid string) (*GroupDict, error) {
+	d, err := scanGroup(s.MsgDB.QueryRow("SELECT "+groupColumns+" FROM groups g WHERE g.jid = ?", jid))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get group: %w", err)
+	}
+
+	rows, err := s.MsgDB.Query(
+		"SELECT jid, is_admin, is_super_admin FROM group_participants WHERE group_jid = ? ORDER BY is_super_admin DESC, is_admin DESC, jid",
+		jid,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get group participants: %w", err)
+	}
+	defer rows.Close()
+
+	d.Participants = []GroupParticipantDict{}
+	for rows.Next() {
+		var p GroupParticipantDict
+		if err := rows.Scan(&p.JID, &p.IsAdmin, &p.IsSuperAdmin); err != nil {
+			continue
+		}
+		p.Name = s.ResolveName(p.JID)
+		d.Participants = append(d.Participants, p)
+	}
+	return &d, nil
+}
+
+// GroupAdmins returns the user parts of a cached group's admins.
+// The map is empty if the group is not cached.
+func (s *Store) GroupAdmins(groupJID string) (map[string]bool, error) {
+	rows, err := s.MsgDB.Query(
+		"SELECT jid FROM group_participants WHERE group_jid = ? AND (is_admin = 1 OR is_super_admin = 1)",
+		groupJID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get group admins: %w", err)
+	}
+	defer rows.Close()
+
+	admins := make(map[string]bool)
+	for rows.Next() {
+		var jid string
+		if rows.Scan(&jid) == nil {
+			user, _, _ := strings.Cut(jid, "@")
+			admins[user] = true
+		}
+	}
+	return admins, nil
+}
+
+// Participant changes recorded in group_events. Add and remove are joins and
+// leaves made by someone else.
+const (
+	GroupEventJoin    = "join"
+	GroupEventAdd     = "add"
+	GroupEventLeave   = "leave"
+	GroupEventRemove  = "remove"
+	GroupEventPromote = "promote"
+	GroupEventDemote  = "demote"
+)
+
+// GroupEventRecord is a participant change as written to the group_events table.
+type GroupEventRecord struct {
+	GroupJID    string
+	Action      string // one of the GroupEvent constants
+	Participant string
+	Actor       string // who made the change, if known
+	Reason      string // e.g. "invite" for joins via invite link
+	Timestamp   time.Time
+}
+
+// GroupEventDict is the structured output for a participant change.
+type GroupEventDict struct {
+	Timestamp       string  `json:"timestamp"`
+	Action          string  `json:"action"`
+	Participant     string  `json:"participant"`
+	ParticipantName string  `json:"participant_name"`
+	Actor           *string `json:"actor,omitempty"`
+	ActorName       *string `json:"actor_name,omitempty"`
+	Reason          *string `json:"reason,omitempty"`
+}
+
+// GroupHistoryItem is a message or a participant change in a group's history.
+type GroupHistoryItem struct {
+	Type    string          `json:"type"` // "message" or "event"
+	Message *MessageDict    `json:"message,omitempty"`
+	Event   *GroupEventDict `json:"event,omitempty"`
+}
+
+// StoreGroupEvents records participant changes. Changes already recorded
+// are skipped.
+func (s *Store) StoreGroupEvents(events []GroupEventRecord) error {
+	tx, err := s.MsgDB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, e := range events {
+		var actor, reason any
+		if e.Actor != "" {
+			actor = e.Actor
+		}
+		if e.Reason != "" {
+			reason = e.Reason
+		}
+		if _, err := tx.Exec(
+			`INSERT OR IGNORE INTO group_events (group_jid, action, participant, actor, reason, timestamp)
+			 VALUES (?, ?, ?, ?, ?, ?)`,
+			e.GroupJID, e.Action, e.Participant, actor, reason, e.Timestamp,
+		); err != nil {
+			return fmt.Errorf("store group event: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// groupEvents returns up to limit participant changes of a group, newest
+// first, optionally only those before the given time.
+func (s *Store) groupEvents(groupJID string, limit int, before string) ([]GroupEventDict, error) {
+	q := "SELECT timestamp, action, participant, actor, reason FROM group_events WHERE group_jid = ?"
+	params := []any{groupJID}
+	if before != "" {
+		q += " AND timestamp < ?"
+		params = append(params, before)
+	}
+	q += " ORDER BY timestamp DESC, id DESC LIMIT ?"
+	params = append(params, limit)
+
+	rows, err := s.MsgDB.Query(q, params...)
+	if err != nil {
+		return nil, fmt.Errorf("group events: %w", err)
+	}
+	defer rows.Close()
+
+	var result []GroupEventDict
+	for rows.Next() {
+		var e GroupEventDict
+		var actor, reason sql.NullString
+		if err := rows.Scan(&e.Timestamp, &e.Action, &e.Participant, &actor, &reason); err != nil {
+			return nil, fmt.Errorf("scan group event: %w", err)
+		}
+		e.ParticipantName = s.ResolveName(e.Participant)
+		if actor.Valid {
+			name := s.ResolveName(actor.String)
+			e.Actor, e.ActorName = &actor.String, &name
+		}
+		if reason.Valid {
+			e.Reason = &reason.String
+		}
+		result = append(result, e)
+	}
+	return result, rows.Err()
+}
+
+// GroupHistory returns the latest limit messages and participant changes of
+// a group merged into one timeline, oldest first. before limits it to items
+// before a date.
+func (s *Store) GroupHistory(groupJID string, limit int, before string) ([]GroupHistoryItem, error) {
+	if limit == 0 {
+		limit = 50
+	}
+	opts := ListMessagesOpts{ChatJID: &groupJID, Limit: limit}
+	if before != "" {
+		opts.Before = &before
+	}
+	messages, _, err := s.ListMessages(opts)
+	if err != nil {
+		return nil, err
+	}
+	events, err := s.groupEvents(groupJID, limit, before)
+	if err != nil {
+		return nil, err
+	}
+
+	// Both lists are newest first: merge them, keep the newest limit items
+	// and return them in chronological order
+	items := make([]GroupHistoryItem, 0, limit)
+	for len(items) < limit && (len(messages) > 0 || len(events) > 0) {
+		if len(events) == 0 || (len(messages) > 0 && !timestampBefore(messages[0].Timestamp, events[0].Timestamp)) {
+			items = append(items, GroupHistoryItem{Type: "message", Message: &messages[0]})
+			messages = messages[1:]
+		} else {
+			items = append(items, GroupHistoryItem{Type: "event", Event: &events[0]})
+			events = events[1:]
+		}
+	}
+	for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+		items[i], items[j] = items[j], items[i]
+	}
+	return items, nil
+}
+
+// timestampBefore compares two scanned timestamps (RFC 3339).
+func timestampBefore(a, b string) bool {
+	ta, errA := time.Parse(time.RFC3339Nano, a)
+	tb, errB := time.Parse(time.RFC3339Nano, b)
+	if errA != nil || errB != nil {
+		return a < b
+	}
+	return ta.Before(tb)
+}
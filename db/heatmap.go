@@ -0,0 +1,92 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// HeatmapOpts selects the messages counted by ChatHeatmap. At least one of
+// ChatJID and Sender must be set.
+type HeatmapOpts struct {
+	ChatJID string // only messages in this chat
+	Sender  string // only messages from this contact (phone number or JID), in any chat unless ChatJID is set
+	After   *string
+}
+
+// HeatmapSlot is one weekday/hour bucket.
+type HeatmapSlot struct {
+	Weekday string `json:"weekday"`
+	Hour    int    `json:"hour"`
+	Count   int    `json:"count"`
+}
+
+// Heatmap holds message counts per weekday and hour of day in local time.
+type Heatmap struct {
+	Timezone string        `json:"timezone"`
+	Total    int           `json:"total"`
+	Weekdays []string      `json:"weekdays"` // row labels of Counts, starting with Sunday
+	Counts   [7][24]int    `json:"counts"`   // Counts[weekday][hour]
+	Busiest  []HeatmapSlot `json:"busiest"`  // up to 5 slots with the most messages
+}
+
+// ChatHeatmap buckets messages by weekday and hour, e.g. to find when a
+// contact is usually active.
+func (s *Store) ChatHeatmap(opts HeatmapOpts) (*Heatmap, error) {
+	if opts.ChatJID == "" && opts.Sender == "" {
+		return nil, fmt.Errorf("chat_jid or sender must be provided")
+	}
+
+	var where []string
+	var params []any
+	if opts.ChatJID != "" {
+		where = append(where, "chat_jid = ?")
+		params = append(params, opts.ChatJID)
+	}
+	if opts.Sender != "" {
+		senders := s.LinkedJIDs(opts.Sender)
+		where = append(where, "sender IN ("+placeholders(len(senders))+") AND is_from_me = 0")
+		params = append(params, repeatArgs(senders, 1)...)
+	}
+	if opts.After != nil {
+		where = append(where, "timestamp > ?")
+		params = append(params, *opts.After)
+	}
+
+	rows, err := s.MsgDB.Query("SELECT timestamp FROM messages WHERE "+strings.Join(where, " AND "), params...)
+	if err != nil {
+		return nil, fmt.Errorf("heatmap query: %w", err)
+	}
+	defer rows.Close()
+
+	zone, _ := time.Now().Zone()
+	h := &Heatmap{Timezone: zone, Busiest: []HeatmapSlot{}}
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		h.Weekdays = append(h.Weekdays, d.String())
+	}
+	for rows.Next() {
+		var ts time.Time
+		if rows.Scan(&ts) != nil {
+			continue
+		}
+		ts = ts.Local()
+		h.Counts[ts.Weekday()][ts.Hour()]++
+		h.Total++
+	}
+
+	var slots []HeatmapSlot
+	for d, hours := range h.Counts {
+		for hour, n := range hours {
+			if n > 0 {
+				slots = append(slots, HeatmapSlot{Weekday: h.Weekdays[d], Hour: hour, Count: n})
+			}
+		}
+	}
+	sort.SliceStable(slots, func(i, j int) bool { return slots[i].Count > slots[j].Count })
+	if len(slots) > 5 {
+		slots = slots[:5]
+	}
+	h.Busiest = append(h.Busiest, slots...)
+	return h, nil
+}
@@ -0,0 +1,52 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// ClaimIdempotencyKey reserves key for a call of tool, forgetting keys older
+// than window first. If the key is already taken, claimed is false and result
+// holds the result stored for it, or is empty while that call is still in
+// progress.
+func (s *Store) ClaimIdempotencyKey(tool, key string, window time.Duration) (result string, claimed bool, err error) {
+	now := time.Now()
+	if _, err := s.MsgDB.Exec("DELETE FROM idempotency_keys WHERE created_at < ?", now.Add(-window)); err != nil {
+		return "", false, fmt.Errorf("expire idempotency keys: %w", err)
+	}
+	res, err := s.MsgDB.Exec(
+		"INSERT INTO idempotency_keys (tool, key, created_at) VALUES (?, ?, ?) ON CONFLICT DO NOTHING",
+		tool, key, now,
+	)
+	if err != nil {
+		return "", false, fmt.Errorf("claim idempotency key: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return "", true, nil
+	}
+	var stored sql.NullString
+	if err := s.MsgDB.QueryRow("SELECT result FROM idempotency_keys WHERE tool = ? AND key = ?", tool, key).Scan(&stored); err != nil {
+		return "", false, fmt.Errorf("read idempotency key: %w", err)
+	}
+	return stored.String, false, nil
+}
+
+// CompleteIdempotencyKey stores the result of the call that claimed key.
+func (s *Store) CompleteIdempotencyKey(tool, key, result string) error {
+	_, err := s.MsgDB.Exec("UPDATE idempotency_keys SET result = ? WHERE tool = ? AND key = ?", result, tool, key)
+	if err != nil {
+		return fmt.Errorf("store idempotency key result: %w", err)
+	}
+	return nil
+}
+
+// ReleaseIdempotencyKey forgets a claimed key, so the call can be retried
+// with it.
+func (s *Store) ReleaseIdempotencyKey(tool, key string) error {
+	_, err := s.MsgDB.Exec("DELETE FROM idempotency_keys WHERE tool = ? AND key = ?", tool, key)
+	if err != nil {
+		return fmt.Errorf("release idempotency key: %w", err)
+	}
+	return nil
+}
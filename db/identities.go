@@ -0,0 +1,135 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// LinkIdentities records that oldJID and newJID belong to the same person
+// (e.g. after a phone number change). Both JIDs are mapped to a shared
+// canonical JID - the newest one - so queries can treat them as one contact.
+func (s *Store) LinkIdentities(oldJID, newJID, reason string) error {
+	if oldJID == "" || newJID == "" || oldJID == newJID {
+		return nil
+	}
+
+	oldCanonical := s.canonicalJID(oldJID)
+	newCanonical := s.canonicalJID(newJID)
+	if oldCanonical == newCanonical {
+		return nil
+	}
+
+	tx, err := s.MsgDB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+
+	// Re-point everything that followed the old identity to the new one
+	if _, err := tx.Exec(
+		"UPDATE identities SET canonical_jid = ? WHERE canonical_jid = ?",
+		newCanonical, oldCanonical,
+	); err != nil {
+		return fmt.Errorf("relink identities: %w", err)
+	}
+
+	for _, jid := range []string{oldJID, oldCanonical, newJID} {
+		if _, err := tx.Exec(
+			`INSERT INTO identities (jid, canonical_jid, reason, linked_at) VALUES (?, ?, ?, ?)
+			 ON CONFLICT(jid) DO UPDATE SET canonical_jid = excluded.canonical_jid`,
+			jid, newCanonical, reason, now,
+		); err != nil {
+			return fmt.Errorf("link identity %s: %w", jid, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// canonicalJID returns the canonical JID for jid, or jid itself if it is not linked.
+func (s *Store) canonicalJID(jid string) string {
+	var canonical string
+	err := s.MsgDB.QueryRow("SELECT canonical_jid FROM identities WHERE jid = ?", jid).Scan(&canonical)
+	if err != nil || canonical == "" {
+		return jid
+	}
+	return canonical
+}
+
+// LinkedJIDs returns every JID known to belong to the same person as jid,
+// including jid itself. Bare phone numbers are returned alongside full JIDs
+// because messages store senders in both forms; jid may be either.
+func (s *Store) LinkedJIDs(jid string) []string {
+	seen := map[string]bool{}
+	var result []string
+	add := func(j string) {
+		if j != "" && !seen[j] {
+			seen[j] = true
+			result = append(result, j)
+		}
+		if idx := strings.Index(j, "@"); idx > 0 && !seen[j[:idx]] {
+			seen[j[:idx]] = true
+			result = append(result, j[:idx])
+		}
+	}
+
+	// Identities are stored as full JIDs
+	if jid != "" && !strings.Contains(jid, "@") {
+		jid = strings.TrimPrefix(jid, "+") + "@s.whatsapp.net"
+	}
+	add(jid)
+	rows, err := s.MsgDB.Query(
+		"SELECT jid FROM identities WHERE canonical_jid = ? OR canonical_jid = (SELECT canonical_jid FROM identities WHERE jid = ?)",
+		jid, jid,
+	)
+	if err != nil {
+		return result
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var linked string
+		if rows.Scan(&linked) == nil {
+			add(linked)
+		}
+	}
+	return result
+}
+
+// identityLinks returns all jid -> canonical_jid mappings.
+func (s *Store) identityLinks() map[string]string {
+	links := make(map[string]string)
+	rows, err := s.MsgDB.Query("SELECT jid, canonical_jid FROM identities WHERE jid != canonical_jid")
+	if err != nil {
+		return links
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var jid string
+		var canonical sql.NullString
+		if rows.Scan(&jid, &canonical) == nil && canonical.Valid {
+			links[jid] = canonical.String
+		}
+	}
+	return links
+}
+
+// placeholders returns "?, ?, ..." with n placeholders for IN clauses.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// repeatArgs returns values as query arguments, repeated times times
+// (for queries that use the same IN list more than once).
+func repeatArgs(values []string, times int) []any {
+	args := make([]any, 0, len(values)*times)
+	for range times {
+		for _, v := range values {
+			args = append(args, v)
+		}
+	}
+	return args
+}
@@ -0,0 +1,120 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// LabelDict is the structured output for label queries.
+type LabelDict struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	Color        int    `json:"color"` // index into WhatsApp's label color palette
+	ChatCount    int    `json:"chat_count"`
+	MessageCount int    `json:"message_count"`
+}
+
+// StoreLabel creates or updates a label definition.
+func (s *Store) StoreLabel(id, name string, color, orderIndex int, at time.Time) error {
+	_, err := s.MsgDB.Exec(
+		`INSERT INTO labels (id, name, color, order_index, updated_at) VALUES (?, ?, ?, ?, ?)
+		 ON CONFLICT(id) DO UPDATE SET name = excluded.name, color = excluded.color,
+		   order_index = excluded.order_index, updated_at = excluded.updated_at`,
+		id, name, color, orderIndex, at,
+	)
+	return err
+}
+
+// DeleteLabel removes a label and its chat and message associations.
+func (s *Store) DeleteLabel(id string) error {
+	tx, err := s.MsgDB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, table := range []string{"chat_labels", "message_labels"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE label_id = ?", id); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM labels WHERE id = ?", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SetChatLabel applies a label to a chat or removes it.
+func (s *Store) SetChatLabel(chatJID, labelID string, labeled bool, at time.Time) error {
+	if !labeled {
+		_, err := s.MsgDB.Exec("DELETE FROM chat_labels WHERE chat_jid = ? AND label_id = ?", chatJID, labelID)
+		return err
+	}
+	_, err := s.MsgDB.Exec(
+		"INSERT OR IGNORE INTO chat_labels (chat_jid, label_id, labeled_at) VALUES (?, ?, ?)",
+		chatJID, labelID, at,
+	)
+	return err
+}
+
+// SetMessageLabel applies a label to a message or removes it.
+func (s *Store) SetMessageLabel(chatJID, messageID, labelID string, labeled bool, at time.Time) error {
+	if !labeled {
+		_, err := s.MsgDB.Exec("DELETE FROM message_labels WHERE chat_jid = ? AND message_id = ? AND label_id = ?",
+			chatJID, messageID, labelID)
+		return err
+	}
+	_, err := s.MsgDB.Exec(
+		"INSERT OR IGNORE INTO message_labels (chat_jid, message_id, label_id, labeled_at) VALUES (?, ?, ?, ?)",
+		chatJID, messageID, labelID, at,
+	)
+	return err
+}
+
+// labelColumns are the label columns read by scanLabel.
+const labelColumns = `labels.id, labels.name, labels.color,
+	(SELECT COUNT(*) FROM chat_labels WHERE chat_labels.label_id = labels.id),
+	(SELECT COUNT(*) FROM message_labels WHERE message_labels.label_id = labels.id)`
+
+func scanLabel(row rowScanner) (LabelDict, error) {
+	var l LabelDict
+	err := row.Scan(&l.ID, &l.Name, &l.Color, &l.ChatCount, &l.MessageCount)
+	return l, err
+}
+
+// ListLabels returns the labels in the order WhatsApp shows them.
+func (s *Store) ListLabels() ([]LabelDict, error) {
+	rows, err := s.MsgDB.Query("SELECT " + labelColumns + " FROM labels ORDER BY labels.order_index, labels.name")
+	if err != nil {
+		return nil, fmt.Errorf("list labels: %w", err)
+	}
+	defer rows.Close()
+
+	var result []LabelDict
+	for rows.Next() {
+		l, err := scanLabel(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan label: %w", err)
+		}
+		result = append(result, l)
+	}
+	return result, rows.Err()
+}
+
+// FindLabel returns the label with the given ID or, failing that, name
+// (case-insensitive), or nil if there is none.
+func (s *Store) FindLabel(idOrName string) (*LabelDict, error) {
+	l, err := scanLabel(s.MsgDB.QueryRow(
+		`SELECT `+labelColumns+` FROM labels WHERE labels.id = ? OR LOWER(labels.name) = ?
+		 ORDER BY labels.id = ? DESC LIMIT 1`,
+		idOrName, strings.ToLower(idOrName), idOrName,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("find label: %w", err)
+	}
+	return &l, nil
+}
@@ -0,0 +1,47 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// MediaObject is the archived copy of a message's media.
+type MediaObject struct {
+	MessageID  string
+	ChatJID    string
+	Key        string // object key in the archive
+	URL        string // unsigned object URL
+	Size       int64
+	UploadedAt time.Time
+}
+
+// SetMediaObject records the archived copy of a message's media.
+func (s *Store) SetMediaObject(o MediaObject) error {
+	_, err := s.MsgDB.Exec(
+		`INSERT OR REPLACE INTO media_objects (message_id, chat_jid, object_key, url, size, uploaded_at)
+		 VALUES (?, ?, ?, ?, ?, ?)`,
+		o.MessageID, o.ChatJID, o.Key, o.URL, o.Size, o.UploadedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("store media object: %w", err)
+	}
+	return nil
+}
+
+// GetMediaObject returns the archived copy of a message's media, or nil if
+// it was not archived.
+func (s *Store) GetMediaObject(messageID, chatJID string) (*MediaObject, error) {
+	o := MediaObject{MessageID: messageID, ChatJID: chatJID}
+	err := s.MsgDB.QueryRow(
+		"SELECT object_key, url, size, uploaded_at FROM media_objects WHERE message_id = ? AND chat_jid = ?",
+		messageID, chatJID,
+	).Scan(&o.Key, &o.URL, &o.Size, &o.UploadedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get media object: %w", err)
+	}
+	return &o, nil
+}
@@ -0,0 +1,77 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"time"
+
+	"github.com/CSCSoftware/wahoo/metrics"
+)
+
+// timedDriverName is the SQLite driver the Store opens its databases with;
+// it records how long statements take.
+const timedDriverName = "sqlite-timed"
+
+var queryDuration = metrics.NewHistogram("wahoo_db_query_duration_seconds",
+	"Time to execute a statement on the message store; for queries until the first row is available.",
+	metrics.DefBuckets, "op")
+
+// init wraps the driver registered by modernc.org/sqlite. sql.Open does not
+// connect, it only looks the driver up.
+func init() {
+	sqliteDB, err := sql.Open("sqlite", "")
+	if err != nil {
+		panic(err)
+	}
+	sql.Register(timedDriverName, timedDriver{sqliteDB.Driver()})
+	sqliteDB.Close()
+}
+
+// sqliteConn is the set of driver interfaces implemented by SQLite
+// connections that database/sql makes use of.
+type sqliteConn interface {
+	driver.Conn
+	driver.ConnBeginTx
+	driver.ConnPrepareContext
+	driver.ExecerContext
+	driver.QueryerContext
+	driver.Pinger
+	driver.SessionResetter
+	driver.Validator
+}
+
+type timedDriver struct {
+	driver.Driver
+}
+
+func (d timedDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if c, ok := conn.(sqliteConn); ok {
+		return timedConn{c}, nil
+	}
+	return conn, nil
+}
+
+// timedConn observes ExecContext and QueryContext, which database/sql uses
+// for all statements the Store runs, including those in transactions.
+type timedConn struct {
+	sqliteConn
+}
+
+func (c timedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	res, err := c.sqliteConn.ExecContext(ctx, query, args)
+	queryDuration.Observe(time.Since(start).Seconds(), "exec")
+	return res, err
+}
+
+func (c timedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	rows, err := c.sqliteConn.QueryContext(ctx, query, args)
+	queryDuration.Observe(time.Since(start).Seconds(), "query")
+	return rows, err
+}
@@ -0,0 +1,207 @@
+package db
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Schema changes to messages.db are migrations, applied in order on open and
+// recorded in the schema_version table. To change the schema, append a
+// migration: a new migrations/NNNN_name.sql file, or a Go function for
+// changes that need more than SQL. Never edit a migration that has shipped.
+//
+// Migrations 1-3 reproduce the schema of databases created before
+// versioning existed and are written to be no-ops on those; later ones run
+// exactly once and need not be idempotent.
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migration upgrades messages.db by one schema version.
+type migration struct {
+	version int
+	name    string
+	up      func(tx *sql.Tx) error
+}
+
+var migrations = []migration{
+	{1, "initial schema", sqlMigration("migrations/0001_initial.sql")},
+	{2, "columns added before schema versioning", migrateLegacyColumns},
+	{3, "message indexes", sqlMigration("migrations/0003_message_indexes.sql")},
+	{4, "send retry schedule", sqlMigration("migrations/0004_send_retry_schedule.sql")},
+	{5, "query indexes", sqlMigration("migrations/0005_query_indexes.sql")},
+	{6, "group events", sqlMigration("migrations/0006_group_events.sql")},
+	{7, "chat retention", sqlMigration("migrations/0007_retention.sql")},
+	{8, "encryption", sqlMigration("migrations/0008_encryption.sql")},
+	{9, "mentions", sqlMigration("migrations/0009_mentions.sql")},
+	{10, "starred messages", sqlMigration("migrations/0010_starred.sql")},
+	{11, "labels", sqlMigration("migrations/0011_labels.sql")},
+	{12, "message embeddings", sqlMigration("migrations/0012_embeddings.sql")},
+	{13, "audit log", sqlMigration("migrations/0013_audit_log.sql")},
+	{14, "send policy", sqlMigration("migrations/0014_send_policy.sql")},
+	{15, "view-once messages", sqlMigration("migrations/0015_view_once.sql")},
+	{16, "media details", sqlMigration("migrations/0016_media_details.sql")},
+	{17, "calls", sqlMigration("migrations/0017_calls.sql")},
+	{18, "presence", sqlMigration("migrations/0018_presence.sql")},
+	{19, "number checks", sqlMigration("migrations/0019_number_checks.sql")},
+	{20, "sync state", sqlMigration("migrations/0020_sync_state.sql")},
+	{21, "group member add mode", sqlMigration("migrations/0021_group_member_add_mode.sql")},
+	{22, "media objects", sqlMigration("migrations/0022_media_objects.sql")},
+	{23, "pending messages", sqlMigration("migrations/0023_pending_messages.sql")},
+	{24, "contact aliases", sqlMigration("migrations/0024_contact_aliases.sql")},
+	{25, "security events", sqlMigration("migrations/0025_security_events.sql")},
+	{26, "idempotency keys", sqlMigration("migrations/0026_idempotency_keys.sql")},
+	{27, "message templates", sqlMigration("migrations/0027_templates.sql")},
+	{28, "unconfirmed messages", sqlMigration("migrations/0028_unconfirmed_messages.sql")},
+}
+
+// sqlMigration runs an embedded SQL file.
+func sqlMigration(file string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		script, err := migrationFiles.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(string(script))
+		return err
+	}
+}
+
+// migrate brings messages.db up to the latest schema version.
+func migrate(db *sql.DB) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		name TEXT,
+		applied_at TIMESTAMP
+	)`); err != nil {
+		return fmt.Errorf("failed to create schema_version table: %v", err)
+	}
+
+	current, err := schemaVersion(db)
+	if err != nil {
+		return fmt.Errorf("failed to read schema version: %v", err)
+	}
+	latest := migrations[len(migrations)-1].version
+	if current > latest {
+		return fmt.Errorf("messages database has schema version %d, newer than this build supports (%d)", current, latest)
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if err := applyMigration(db, m); err != nil {
+			return fmt.Errorf("failed to migrate messages database to version %d (%s): %v", m.version, m.name, err)
+		}
+		if current > 0 {
+			fmt.Fprintf(os.Stderr, "Migrated messages database to schema version %d (%s)\n", m.version, m.name)
+		}
+	}
+	return nil
+}
+
+// schemaVersion returns the version of the last applied migration, or 0.
+func schemaVersion(db *sql.DB) (int, error) {
+	var version sql.NullInt64
+	err := db.QueryRow("SELECT MAX(version) FROM schema_version").Scan(&version)
+	return int(version.Int64), err
+}
+
+// applyMigration runs a migration and records it in one transaction.
+func applyMigration(db *sql.DB, m migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := m.up(tx); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("INSERT INTO schema_version (version, name, applied_at) VALUES (?, ?, ?)",
+		m.version, m.name, time.Now()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// migrateLegacyColumns adds the columns that were added to the initial
+// schema before it was versioned. Fresh databases already have them all.
+func migrateLegacyColumns(tx *sql.Tx) error {
+	// Chats that predate read tracking are considered read up to their last message
+	hadReadState, err := columnExists(tx, "chats", "last_read_time")
+	if err != nil {
+		return fmt.Errorf("failed to inspect chats table: %v", err)
+	}
+
+	for _, col := range []struct{ table, name, def string }{
+		{"messages", "edited", "BOOLEAN DEFAULT 0"},
+		{"messages", "edited_at", "TIMESTAMP"},
+		{"messages", "revoked", "BOOLEAN DEFAULT 0"},
+		{"messages", "revoked_at", "TIMESTAMP"},
+		{"messages", "source", "TEXT"},
+		{"messages", "sender_timestamp", "TIMESTAMP"},
+		{"messages", "local_path", "TEXT"},
+		{"messages", "sender_name", "TEXT"},
+		{"messages", "latitude", "REAL"},
+		{"messages", "longitude", "REAL"},
+		{"messages", "location_name", "TEXT"},
+		{"messages", "location_address", "TEXT"},
+		{"messages", "vcard", "TEXT"},
+		{"messages", "quoted_message_id", "TEXT"},
+		{"messages", "quoted_sender", "TEXT"},
+		{"chats", "archived", "BOOLEAN DEFAULT 0"},
+		{"chats", "pinned", "BOOLEAN DEFAULT 0"},
+		{"chats", "muted", "BOOLEAN DEFAULT 0"},
+		{"chats", "muted_until", "TIMESTAMP"},
+		{"chats", "auto_read", "BOOLEAN DEFAULT 0"},
+		{"chats", "send_profile", "TEXT"},
+		{"chats", "last_read_time", "TIMESTAMP"},
+		{"chats", "disappearing_timer", "INTEGER DEFAULT 0"},
+	} {
+		if err := addColumnIfMissing(tx, col.table, col.name, col.def); err != nil {
+			return fmt.Errorf("failed to add %s.%s: %v", col.table, col.name, err)
+		}
+	}
+
+	if !hadReadState {
+		if _, err := tx.Exec("UPDATE chats SET last_read_time = last_message_time"); err != nil {
+			return fmt.Errorf("failed to initialize read state: %v", err)
+		}
+	}
+	return nil
+}
+
+// addColumnIfMissing adds a column to an existing table unless it is already present.
+func addColumnIfMissing(tx *sql.Tx, table, column, definition string) error {
+	exists, err := columnExists(tx, table, column)
+	if err != nil || exists {
+		return err
+	}
+	_, err = tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// columnExists reports whether a table has a column.
+func columnExists(tx *sql.Tx, table, column string) (bool, error) {
+	rows, err := tx.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dflt, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
@@ -0,0 +1,180 @@
+-- Initial schema. Tables that existed before schema versioning may lack
+-- columns added since; migration 2 adds them.
+
+CREATE TABLE IF NOT EXISTS chats (
+	jid TEXT PRIMARY KEY,
+	name TEXT,
+	last_message_time TIMESTAMP,
+	archived BOOLEAN DEFAULT 0,
+	pinned BOOLEAN DEFAULT 0,
+	muted BOOLEAN DEFAULT 0,
+	muted_until TIMESTAMP,
+	auto_read BOOLEAN DEFAULT 0,
+	send_profile TEXT,
+	last_read_time TIMESTAMP,
+	disappearing_timer INTEGER DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS messages (
+	id TEXT,
+	chat_jid TEXT,
+	sender TEXT,
+	content TEXT,
+	timestamp TIMESTAMP,
+	is_from_me BOOLEAN,
+	media_type TEXT,
+	filename TEXT,
+	url TEXT,
+	media_key BLOB,
+	file_sha256 BLOB,
+	file_enc_sha256 BLOB,
+	file_length INTEGER,
+	edited BOOLEAN DEFAULT 0,
+	edited_at TIMESTAMP,
+	revoked BOOLEAN DEFAULT 0,
+	revoked_at TIMESTAMP,
+	source TEXT,
+	sender_timestamp TIMESTAMP,
+	local_path TEXT,
+	sender_name TEXT,
+	latitude REAL,
+	longitude REAL,
+	location_name TEXT,
+	location_address TEXT,
+	vcard TEXT,
+	quoted_message_id TEXT,
+	quoted_sender TEXT,
+	PRIMARY KEY (id, chat_jid),
+	FOREIGN KEY (chat_jid) REFERENCES chats(jid)
+);
+
+CREATE TABLE IF NOT EXISTS identities (
+	jid TEXT PRIMARY KEY,
+	canonical_jid TEXT NOT NULL,
+	reason TEXT,
+	linked_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS polls (
+	id TEXT,
+	chat_jid TEXT,
+	creator TEXT,
+	question TEXT,
+	options TEXT,
+	selectable_count INTEGER,
+	created_at TIMESTAMP,
+	PRIMARY KEY (id, chat_jid)
+);
+
+CREATE TABLE IF NOT EXISTS poll_votes (
+	poll_id TEXT,
+	chat_jid TEXT,
+	voter TEXT,
+	options TEXT,
+	timestamp TIMESTAMP,
+	PRIMARY KEY (poll_id, chat_jid, voter)
+);
+
+CREATE TABLE IF NOT EXISTS watch_rules (
+	name TEXT PRIMARY KEY,
+	keyword TEXT NOT NULL DEFAULT '',
+	sender TEXT NOT NULL DEFAULT '',
+	chat_jid TEXT NOT NULL DEFAULT '',
+	mentions_me BOOLEAN NOT NULL DEFAULT 0,
+	created_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS watch_hits (
+	rule TEXT,
+	message_id TEXT,
+	chat_jid TEXT,
+	matched_at TIMESTAMP,
+	PRIMARY KEY (rule, message_id, chat_jid)
+);
+
+CREATE TABLE IF NOT EXISTS sends (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	recipient TEXT,
+	content TEXT,
+	status TEXT,
+	attempts INTEGER DEFAULT 0,
+	last_error TEXT,
+	message_id TEXT,
+	created_at TIMESTAMP,
+	updated_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS statuses (
+	id TEXT,
+	sender TEXT,
+	content TEXT,
+	media_type TEXT,
+	timestamp TIMESTAMP,
+	expires_at TIMESTAMP,
+	PRIMARY KEY (id, sender)
+);
+
+CREATE TABLE IF NOT EXISTS groups (
+	jid TEXT PRIMARY KEY,
+	name TEXT,
+	topic TEXT,
+	owner_jid TEXT,
+	created_at TIMESTAMP,
+	announce BOOLEAN DEFAULT 0,
+	locked BOOLEAN DEFAULT 0,
+	updated_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS group_participants (
+	group_jid TEXT,
+	jid TEXT,
+	is_admin BOOLEAN DEFAULT 0,
+	is_super_admin BOOLEAN DEFAULT 0,
+	PRIMARY KEY (group_jid, jid)
+);
+
+CREATE TABLE IF NOT EXISTS moderation_rules (
+	name TEXT PRIMARY KEY,
+	group_jid TEXT NOT NULL DEFAULT '',
+	banned_words TEXT NOT NULL DEFAULT '',
+	block_links BOOLEAN NOT NULL DEFAULT 0,
+	created_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS moderation_log (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	rule TEXT,
+	group_jid TEXT,
+	message_id TEXT,
+	sender TEXT,
+	content TEXT,
+	reason TEXT,
+	revoked BOOLEAN,
+	error TEXT,
+	timestamp TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS redaction_profiles (
+	name TEXT PRIMARY KEY,
+	strip_media BOOLEAN NOT NULL DEFAULT 0,
+	mask_numbers BOOLEAN NOT NULL DEFAULT 0,
+	drop_participants TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS transcripts (
+	message_id TEXT,
+	chat_jid TEXT,
+	text TEXT NOT NULL,
+	backend TEXT,
+	created_at TIMESTAMP,
+	PRIMARY KEY (message_id, chat_jid)
+);
+
+CREATE TABLE IF NOT EXISTS chat_profiles (
+	chat_jid TEXT PRIMARY KEY,
+	language TEXT NOT NULL DEFAULT '',
+	formality TEXT NOT NULL DEFAULT '',
+	emoji TEXT NOT NULL DEFAULT '',
+	updated_at TIMESTAMP
+);
@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS idx_messages_chat_time ON messages (chat_jid, timestamp);
+CREATE INDEX IF NOT EXISTS idx_messages_quoted ON messages (chat_jid, quoted_message_id);
@@ -0,0 +1,2 @@
+-- When a failed send is next retried; NULL retries on the next outbox run.
+ALTER TABLE sends ADD COLUMN next_attempt_at TIMESTAMP;
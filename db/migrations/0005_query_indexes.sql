@@ -0,0 +1,5 @@
+CREATE INDEX idx_messages_sender_time ON messages (sender, timestamp);
+CREATE INDEX idx_messages_time ON messages (timestamp);
+-- Covers the unread count of every listed chat
+CREATE INDEX idx_messages_unread ON messages (chat_jid, is_from_me, timestamp);
+CREATE INDEX idx_chats_last_message ON chats (last_message_time);
@@ -0,0 +1,13 @@
+-- Participant changes of groups (joins, leaves, promotions), for group history.
+CREATE TABLE group_events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	group_jid TEXT NOT NULL,
+	action TEXT NOT NULL,
+	participant TEXT NOT NULL,
+	actor TEXT,
+	reason TEXT,
+	timestamp TIMESTAMP NOT NULL,
+	UNIQUE (group_jid, action, participant, timestamp)
+);
+
+CREATE INDEX idx_group_events_group_time ON group_events (group_jid, timestamp);
@@ -0,0 +1,2 @@
+-- Days a chat's messages are kept; NULL uses the default retention, 0 keeps them forever.
+ALTER TABLE chats ADD COLUMN retain_days INTEGER;
@@ -0,0 +1,8 @@
+-- Present once the message text columns are encrypted: the key derivation
+-- salt and a value encrypted with the key, to check keys against.
+CREATE TABLE encryption (
+	id INTEGER PRIMARY KEY CHECK (id = 1),
+	salt BLOB NOT NULL,
+	verifier TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL
+);
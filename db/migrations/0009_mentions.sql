@@ -0,0 +1,9 @@
+-- @-mentions of messages: the mentioned JIDs, one per line, and whether our
+-- own account is among them (resolved when the message arrives).
+ALTER TABLE messages ADD COLUMN mentioned_jids TEXT;
+ALTER TABLE messages ADD COLUMN mentions_me BOOLEAN NOT NULL DEFAULT 0;
+
+CREATE INDEX idx_messages_mentions_me ON messages (timestamp) WHERE mentions_me = 1;
+
+-- JIDs a queued or failed send mentions, one per line, so retries keep them.
+ALTER TABLE sends ADD COLUMN mentions TEXT;
@@ -0,0 +1,5 @@
+-- Starred (bookmarked) messages, starred here or on another device.
+ALTER TABLE messages ADD COLUMN starred BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE messages ADD COLUMN starred_at TIMESTAMP;
+
+CREATE INDEX idx_messages_starred ON messages (timestamp) WHERE starred = 1;
@@ -0,0 +1,28 @@
+-- WhatsApp Business labels and the chats and messages they are applied to,
+-- synced from app state.
+CREATE TABLE labels (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	color INTEGER NOT NULL DEFAULT 0,
+	order_index INTEGER NOT NULL DEFAULT 0,
+	updated_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE chat_labels (
+	chat_jid TEXT NOT NULL,
+	label_id TEXT NOT NULL,
+	labeled_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (chat_jid, label_id)
+);
+
+CREATE INDEX idx_chat_labels_label ON chat_labels (label_id);
+
+CREATE TABLE message_labels (
+	chat_jid TEXT NOT NULL,
+	message_id TEXT NOT NULL,
+	label_id TEXT NOT NULL,
+	labeled_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (chat_jid, message_id, label_id)
+);
+
+CREATE INDEX idx_message_labels_label ON message_labels (label_id);
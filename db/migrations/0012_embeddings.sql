@@ -0,0 +1,12 @@
+-- Embedding vectors of message text for semantic search: unit-length
+-- little-endian float32 arrays, tagged with the model that computed them.
+CREATE TABLE message_embeddings (
+	chat_jid TEXT NOT NULL,
+	message_id TEXT NOT NULL,
+	model TEXT NOT NULL,
+	vector BLOB NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (chat_jid, message_id)
+);
+
+CREATE INDEX idx_message_embeddings_model ON message_embeddings (model);
@@ -0,0 +1,15 @@
+-- Calls of write tools, for reviewing what MCP clients did.
+CREATE TABLE audit_log (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	timestamp TIMESTAMP NOT NULL,
+	tool TEXT NOT NULL,
+	session TEXT,
+	client TEXT,
+	arguments TEXT,
+	result TEXT,
+	success BOOLEAN NOT NULL,
+	duration_ms INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX idx_audit_log_timestamp ON audit_log (timestamp);
+CREATE INDEX idx_audit_log_tool ON audit_log (tool);
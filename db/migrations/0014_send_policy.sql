@@ -0,0 +1,7 @@
+-- Recipient patterns that outgoing messages are allowed to or refused for,
+-- managed with manage_send_policy.
+CREATE TABLE send_policy (
+	pattern TEXT PRIMARY KEY,
+	action TEXT NOT NULL,
+	created_at TIMESTAMP
+);
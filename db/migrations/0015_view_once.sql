@@ -0,0 +1,3 @@
+-- View-once media, which can be downloaded once with acknowledgment.
+ALTER TABLE messages ADD COLUMN view_once BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE messages ADD COLUMN viewed_at TIMESTAMP;
@@ -0,0 +1,3 @@
+-- MIME type of media messages and page count of documents.
+ALTER TABLE messages ADD COLUMN mimetype TEXT;
+ALTER TABLE messages ADD COLUMN page_count INTEGER;
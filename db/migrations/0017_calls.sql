@@ -0,0 +1,14 @@
+-- Incoming voice and video calls.
+CREATE TABLE calls (
+	call_id TEXT PRIMARY KEY,
+	caller TEXT NOT NULL,
+	caller_device TEXT NOT NULL, -- JID the offer came from, needed to reject it
+	group_jid TEXT,
+	is_video BOOLEAN NOT NULL DEFAULT 0,
+	status TEXT NOT NULL, -- ringing, accepted, rejected, auto_rejected, missed or ended
+	offered_at TIMESTAMP NOT NULL,
+	ended_at TIMESTAMP,
+	end_reason TEXT
+);
+
+CREATE INDEX idx_calls_offered_at ON calls (offered_at);
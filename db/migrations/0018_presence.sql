@@ -0,0 +1,17 @@
+-- Presence updates of contacts, for finding when they are usually online.
+CREATE TABLE presence (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	jid TEXT NOT NULL,
+	online BOOLEAN NOT NULL,
+	last_seen TIMESTAMP,
+	timestamp TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_presence_jid ON presence (jid, timestamp);
+CREATE INDEX idx_presence_timestamp ON presence (timestamp);
+
+-- Contacts whose presence is subscribed to again after every reconnect.
+CREATE TABLE presence_subscriptions (
+	jid TEXT PRIMARY KEY,
+	subscribed_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,8 @@
+-- Results of check_numbers, so numbers aren't looked up again on every check.
+CREATE TABLE number_checks (
+	phone TEXT PRIMARY KEY, -- digits only, with country code
+	jid TEXT,
+	on_whatsapp BOOLEAN NOT NULL,
+	business_name TEXT,
+	checked_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,26 @@
+-- History sync chunks, recorded when the phone announces them and processed
+-- afterwards, so a chunk interrupted by a restart is processed again.
+CREATE TABLE sync_state (
+	id TEXT PRIMARY KEY, -- ID of the message announcing the chunk
+	sync_type TEXT NOT NULL,
+	chunk_order INTEGER NOT NULL,
+	progress INTEGER NOT NULL, -- percent of the sync done with this chunk
+	notification BLOB NOT NULL, -- HistorySyncNotification, to download the chunk
+	status TEXT NOT NULL, -- pending, done or failed
+	attempts INTEGER NOT NULL DEFAULT 0,
+	error TEXT,
+	conversations INTEGER NOT NULL DEFAULT 0,
+	messages INTEGER NOT NULL DEFAULT 0,
+	received_at TIMESTAMP NOT NULL,
+	processed_at TIMESTAMP
+);
+
+CREATE INDEX idx_sync_state_status ON sync_state (status, received_at);
+
+-- Chats seen in history sync. complete is set once the phone has sent all
+-- the history it will send for the chat.
+CREATE TABLE sync_chats (
+	chat_jid TEXT PRIMARY KEY,
+	complete BOOLEAN NOT NULL DEFAULT 0,
+	synced_at TIMESTAMP NOT NULL
+);
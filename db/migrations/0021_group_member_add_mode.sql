@@ -0,0 +1,2 @@
+-- Who can add members to a group: admin_add or all_member_add.
+ALTER TABLE groups ADD COLUMN member_add_mode TEXT;
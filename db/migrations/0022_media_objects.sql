@@ -0,0 +1,12 @@
+-- Copies of downloaded and sent media in the media archive (S3-compatible
+-- object storage). Sent media has no row in messages, so this is keyed by
+-- message rather than a column of messages.
+CREATE TABLE media_objects (
+	message_id TEXT NOT NULL,
+	chat_jid TEXT NOT NULL,
+	object_key TEXT NOT NULL,
+	url TEXT NOT NULL,
+	size INTEGER NOT NULL,
+	uploaded_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (message_id, chat_jid)
+);
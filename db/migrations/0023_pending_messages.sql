@@ -0,0 +1,2 @@
+-- Messages we sent that WhatsApp has not acknowledged yet.
+ALTER TABLE messages ADD COLUMN pending BOOLEAN NOT NULL DEFAULT 0;
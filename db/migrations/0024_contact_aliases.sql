@@ -0,0 +1,7 @@
+-- Names set with set_contact_alias, shown instead of the contact's WhatsApp
+-- name.
+CREATE TABLE contact_aliases (
+	jid TEXT PRIMARY KEY,
+	alias TEXT NOT NULL,
+	updated_at TIMESTAMP
+);
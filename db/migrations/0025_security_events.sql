@@ -0,0 +1,11 @@
+-- Changes of contacts' security codes (identity keys), e.g. after they
+-- reinstalled WhatsApp or moved to a new phone.
+CREATE TABLE security_events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	jid TEXT NOT NULL,
+	changed_at TIMESTAMP NOT NULL,
+	implicit BOOLEAN NOT NULL DEFAULT 0 -- noticed from a message rather than announced by the server
+);
+
+CREATE INDEX idx_security_events_jid ON security_events (jid, changed_at);
+CREATE INDEX idx_security_events_changed_at ON security_events (changed_at);
@@ -0,0 +1,12 @@
+-- Idempotency keys of send tool calls and the results they returned, so a
+-- retried call returns the original result instead of sending again. A NULL
+-- result marks a call still in progress.
+CREATE TABLE idempotency_keys (
+	tool TEXT NOT NULL,
+	key TEXT NOT NULL,
+	result TEXT,
+	created_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (tool, key)
+);
+
+CREATE INDEX idx_idempotency_keys_created_at ON idempotency_keys (created_at);
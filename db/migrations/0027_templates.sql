@@ -0,0 +1,9 @@
+-- Message templates with {{placeholders}}, managed with create_template and
+-- sent with send_template.
+CREATE TABLE templates (
+	name TEXT PRIMARY KEY,
+	body TEXT NOT NULL,
+	description TEXT,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,3 @@
+-- Messages we sent that WhatsApp never acknowledged: the send timed out and
+-- no echo or receipt followed, so they may not have been delivered.
+ALTER TABLE messages ADD COLUMN unconfirmed BOOLEAN NOT NULL DEFAULT 0;
@@ -0,0 +1,150 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// linkPattern matches URLs and bare domains of common top-level domains.
+var linkPattern = regexp.MustCompile(`(?i)\b(https?://|www\.)\S+|\b[a-z0-9-]+\.(com|net|org|io|me|ly|gg|app|link|info|xyz|co|de)\b`)
+
+// ModerationRule removes unwanted messages from non-admins in groups we administer.
+type ModerationRule struct {
+	Name        string   `json:"name"`
+	GroupJID    string   `json:"group_jid,omitempty"` // empty applies to every group we administer
+	BannedWords []string `json:"banned_words,omitempty"`
+	BlockLinks  bool     `json:"block_links,omitempty"`
+}
+
+// AppliesTo reports whether the rule covers a group.
+func (r ModerationRule) AppliesTo(groupJID string) bool {
+	return r.GroupJID == "" || r.GroupJID == groupJID
+}
+
+// Violation returns why content breaks the rule, or "" if it doesn't.
+// Banned words match whole words, case-insensitively.
+func (r ModerationRule) Violation(content string) string {
+	for _, word := range r.BannedWords {
+		pattern := `(?i)\b` + regexp.QuoteMeta(word) + `\b`
+		if ok, _ := regexp.MatchString(pattern, content); ok {
+			return fmt.Sprintf("banned word %q", word)
+		}
+	}
+	if r.BlockLinks {
+		if link := linkPattern.FindString(content); link != "" {
+			return fmt.Sprintf("link %s", link)
+		}
+	}
+	return ""
+}
+
+// SaveModerationRule creates or replaces a moderation rule.
+func (s *Store) SaveModerationRule(r ModerationRule) error {
+	_, err := s.MsgDB.Exec(
+		`INSERT OR REPLACE INTO moderation_rules (name, group_jid, banned_words, block_links, created_at)
+		 VALUES (?, ?, ?, ?, ?)`,
+		r.Name, r.GroupJID, strings.Join(r.BannedWords, "\n"), r.BlockLinks, time.Now(),
+	)
+	return err
+}
+
+// DeleteModerationRule removes a rule. Returns false if it did not exist.
+func (s *Store) DeleteModerationRule(name string) (bool, error) {
+	res, err := s.MsgDB.Exec("DELETE FROM moderation_rules WHERE name = ?", name)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// ListModerationRules returns all moderation rules ordered by name.
+func (s *Store) ListModerationRules() ([]ModerationRule, error) {
+	rows, err := s.MsgDB.Query("SELECT name, group_jid, banned_words, block_links FROM moderation_rules ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("list moderation rules: %w", err)
+	}
+	defer rows.Close()
+
+	result := []ModerationRule{}
+	for rows.Next() {
+		var r ModerationRule
+		var words string
+		if err := rows.Scan(&r.Name, &r.GroupJID, &words, &r.BlockLinks); err != nil {
+			continue
+		}
+		if words != "" {
+			r.BannedWords = strings.Split(words, "\n")
+		}
+		result = append(result, r)
+	}
+	return result, nil
+}
+
+// ModerationLogEntry records a message a moderation rule acted on.
+type ModerationLogEntry struct {
+	ID        int64   `json:"id"`
+	Rule      string  `json:"rule"`
+	GroupJID  string  `json:"group_jid"`
+	MessageID string  `json:"message_id"`
+	Sender    string  `json:"sender"`
+	Content   string  `json:"content"`
+	Reason    string  `json:"reason"`
+	Revoked   bool    `json:"revoked"`
+	Error     *string `json:"error,omitempty"`
+	Timestamp string  `json:"timestamp"`
+}
+
+// LogModeration appends an entry to the moderation log.
+func (s *Store) LogModeration(e ModerationLogEntry, at time.Time) error {
+	var errText any
+	if e.Error != nil {
+		errText = *e.Error
+	}
+	_, err := s.MsgDB.Exec(
+		`INSERT INTO moderation_log (rule, group_jid, message_id, sender, content, reason, revoked, error, timestamp)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.Rule, e.GroupJID, e.MessageID, e.Sender, s.seal(e.Content), e.Reason, e.Revoked, errText, at,
+	)
+	return err
+}
+
+// GetModerationLog returns the most recent moderation actions, newest first.
+// If groupJID is non-empty only that group's entries are returned.
+func (s *Store) GetModerationLog(groupJID string, limit int) ([]ModerationLogEntry, error) {
+	if limit == 0 {
+		limit = 50
+	}
+	q := "SELECT id, rule, group_jid, message_id, sender, wahoo_decrypt(content), reason, revoked, error, timestamp FROM moderation_log"
+	var params []any
+	if groupJID != "" {
+		q += " WHERE group_jid = ?"
+		params = append(params, groupJID)
+	}
+	q += " ORDER BY id DESC LIMIT ?"
+	params = append(params, limit)
+
+	rows, err := s.MsgDB.Query(q, params...)
+	if err != nil {
+		return nil, fmt.Errorf("get moderation log: %w", err)
+	}
+	defer rows.Close()
+
+	result := []ModerationLogEntry{}
+	for rows.Next() {
+		var e ModerationLogEntry
+		var errText sql.NullString
+		if err := rows.Scan(&e.ID, &e.Rule, &e.GroupJID, &e.MessageID, &e.Sender, &e.Content,
+			&e.Reason, &e.Revoked, &errText, &e.Timestamp); err != nil {
+			continue
+		}
+		if errText.Valid {
+			e.Error = &errText.String
+		}
+		result = append(result, e)
+	}
+	return result, nil
+}
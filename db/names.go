@@ -0,0 +1,166 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// nameCacheTTL is how long the cached name lookup is used before it is
+// rebuilt, bounding how stale it gets when a name changes without an event
+// that triggers RefreshSenderNames.
+const nameCacheTTL = 10 * time.Minute
+
+// ResolveName returns the display name of a JID, or the JID itself if it has
+// none. Normally it uses the cached lookup of all names; in low-memory mode
+// every call runs targeted queries instead, so the full lookup is never held
+// in memory.
+func (s *Store) ResolveName(jid string) string {
+	if s.lowMemory {
+		return s.lookupName(jid)
+	}
+	return resolveSender(jid, s.senderNames())
+}
+
+// lookupName resolves a single JID with the same priorities as
+// BuildSenderCache: linked identity, alias, contact name, LID mapping, chat
+// name.
+func (s *Store) lookupName(jid string) string {
+	user, server, hasServer := strings.Cut(jid, "@")
+	var canonical sql.NullString
+	s.MsgDB.QueryRow("SELECT canonical_jid FROM identities WHERE jid = ? AND jid != canonical_jid", jid).Scan(&canonical)
+	if canonical.Valid && canonical.String != jid {
+		if name := s.lookupName(canonical.String); name != canonical.String {
+			return name
+		}
+	}
+
+	candidates := []string{jid}
+	if !hasServer {
+		candidates = []string{user + "@s.whatsapp.net", user + "@lid"}
+	}
+	if s.WaDB != nil && (!hasServer || server == "lid") {
+		var pn string
+		if s.WaDB.QueryRow("SELECT pn FROM whatsmeow_lid_map WHERE lid = ?", user).Scan(&pn) == nil {
+			candidates = append(candidates, pn+"@s.whatsapp.net")
+		}
+	}
+
+	var alias string
+	if s.MsgDB.QueryRow(
+		"SELECT alias FROM contact_aliases WHERE jid IN ("+placeholders(len(candidates))+") LIMIT 1",
+		repeatArgs(candidates, 1)...,
+	).Scan(&alias) == nil {
+		return alias
+	}
+
+	if s.WaDB != nil {
+		var fullName, pushName sql.NullString
+		err := s.WaDB.QueryRow(
+			"SELECT full_name, push_name FROM whatsmeow_contacts WHERE their_jid IN ("+placeholders(len(candidates))+
+				") ORDER BY full_name IS NULL OR full_name = '' LIMIT 1",
+			repeatArgs(candidates, 1)...,
+		).Scan(&fullName, &pushName)
+		if err == nil {
+			if fullName.String != "" {
+				return fullName.String
+			}
+			if pushName.String != "" {
+				return pushName.String
+			}
+		}
+	}
+
+	var name string
+	if s.MsgDB.QueryRow(
+		"SELECT name FROM chats WHERE jid IN ("+placeholders(len(candidates))+") AND name IS NOT NULL AND name != '' LIMIT 1",
+		repeatArgs(candidates, 1)...,
+	).Scan(&name) == nil {
+		return name
+	}
+	return jid
+}
+
+// senderNames returns the cached JID -> display name lookup, building it on
+// first use and once it is older than nameCacheTTL.
+func (s *Store) senderNames() map[string]string {
+	s.namesMu.Lock()
+	defer s.namesMu.Unlock()
+	if s.names == nil || time.Since(s.namesAt) > nameCacheTTL {
+		s.names, s.namesAt = s.BuildSenderCache(), time.Now()
+	}
+	return s.names
+}
+
+// InvalidateNames drops the cached name lookup so the next lookup rebuilds
+// it, e.g. after contacts or identity links changed.
+func (s *Store) InvalidateNames() {
+	s.namesMu.Lock()
+	s.names = nil
+	s.namesMu.Unlock()
+}
+
+// addChatName makes a newly seen chat's name available to StoreMessage without
+// a full rebuild. Chat names rank below contact names, so known JIDs are kept.
+func (s *Store) addChatName(jid, name string) {
+	s.namesMu.Lock()
+	defer s.namesMu.Unlock()
+	if s.names == nil {
+		return
+	}
+	if _, ok := s.names[jid]; !ok {
+		s.names[jid] = name
+	}
+	if idx := strings.Index(jid, "@"); idx > 0 {
+		if _, ok := s.names[jid[:idx]]; !ok {
+			s.names[jid[:idx]] = name
+		}
+	}
+}
+
+// RefreshSenderNames rebuilds the name lookup and rewrites the precomputed
+// sender_name of every stored message whose sender's name changed, so read
+// queries never need to resolve names themselves.
+func (s *Store) RefreshSenderNames() (int64, error) {
+	resolve := s.lookupName
+	if !s.lowMemory {
+		s.InvalidateNames()
+		names := s.senderNames()
+		resolve = func(jid string) string { return resolveSender(jid, names) }
+	}
+
+	rows, err := s.MsgDB.Query("SELECT DISTINCT sender FROM messages")
+	if err != nil {
+		return 0, fmt.Errorf("list senders: %w", err)
+	}
+	var senders []string
+	for rows.Next() {
+		var sender string
+		if rows.Scan(&sender) == nil {
+			senders = append(senders, sender)
+		}
+	}
+	rows.Close()
+
+	tx, err := s.MsgDB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var updated int64
+	for _, sender := range senders {
+		name := resolve(sender)
+		res, err := tx.Exec(
+			"UPDATE messages SET sender_name = ? WHERE sender = ? AND sender_name IS NOT ?",
+			name, sender, name,
+		)
+		if err != nil {
+			return 0, fmt.Errorf("update sender names: %w", err)
+		}
+		n, _ := res.RowsAffected()
+		updated += n
+	}
+	return updated, tx.Commit()
+}
@@ -0,0 +1,57 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// NumberCheck is the cached result of looking up a phone number on WhatsApp.
+type NumberCheck struct {
+	Phone        string // digits only, with country code
+	JID          string // empty if not on WhatsApp
+	OnWhatsApp   bool
+	BusinessName string // verified name if it is a business account
+	CheckedAt    time.Time
+}
+
+// StoreNumberCheck caches the result of a number lookup.
+func (s *Store) StoreNumberCheck(c NumberCheck) error {
+	_, err := s.MsgDB.Exec(
+		`INSERT OR REPLACE INTO number_checks (phone, jid, on_whatsapp, business_name, checked_at)
+		 VALUES (?, NULLIF(?, ''), ?, NULLIF(?, ''), ?)`,
+		c.Phone, c.JID, c.OnWhatsApp, c.BusinessName, c.CheckedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("store number check: %w", err)
+	}
+	return nil
+}
+
+// CachedNumberChecks returns the cached lookups of phones made after since,
+// keyed by phone.
+func (s *Store) CachedNumberChecks(phones []string, since time.Time) (map[string]NumberCheck, error) {
+	result := make(map[string]NumberCheck)
+	if len(phones) == 0 {
+		return result, nil
+	}
+	rows, err := s.MsgDB.Query(
+		`SELECT phone, jid, on_whatsapp, business_name, checked_at FROM number_checks
+		 WHERE phone IN (`+placeholders(len(phones))+`) AND checked_at > ?`,
+		append(repeatArgs(phones, 1), since)...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get number checks: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c NumberCheck
+		var jid, business sql.NullString
+		if err := rows.Scan(&c.Phone, &jid, &c.OnWhatsApp, &business, &c.CheckedAt); err != nil {
+			return nil, fmt.Errorf("scan number check: %w", err)
+		}
+		c.JID, c.BusinessName = jid.String, business.String
+		result[c.Phone] = c
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,132 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// PollOptionDict is the tally for a single poll option.
+type PollOptionDict struct {
+	Name   string   `json:"name"`
+	Votes  int      `json:"votes"`
+	Voters []string `json:"voters"`
+}
+
+// PollResultsDict is the structured output for poll result queries.
+type PollResultsDict struct {
+	PollID          string           `json:"poll_id"`
+	ChatJID         string           `json:"chat_jid"`
+	Question        string           `json:"question"`
+	SelectableCount int              `json:"selectable_count"`
+	Options         []PollOptionDict `json:"options"`
+	TotalVoters     int              `json:"total_voters"`
+}
+
+// StorePoll upserts a poll definition so that later votes can be decoded.
+func (s *Store) StorePoll(id, chatJID, creator, question string, options []string, selectableCount int, createdAt time.Time) error {
+	optionsJSON, err := json.Marshal(options)
+	if err != nil {
+		return err
+	}
+	_, err = s.MsgDB.Exec(
+		`INSERT OR REPLACE INTO polls (id, chat_jid, creator, question, options, selectable_count, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		id, chatJID, creator, question, string(optionsJSON), selectableCount, createdAt,
+	)
+	return err
+}
+
+// GetPollOptions returns the option names of a stored poll.
+func (s *Store) GetPollOptions(pollID, chatJID string) ([]string, error) {
+	var optionsJSON string
+	err := s.MsgDB.QueryRow("SELECT options FROM polls WHERE id = ? AND chat_jid = ?", pollID, chatJID).Scan(&optionsJSON)
+	if err != nil {
+		return nil, err
+	}
+	var options []string
+	if err := json.Unmarshal([]byte(optionsJSON), &options); err != nil {
+		return nil, fmt.Errorf("decode poll options: %w", err)
+	}
+	return options, nil
+}
+
+// StorePollVote records a voter's current selection. A new vote from the same
+// voter replaces the previous one, matching WhatsApp's semantics.
+func (s *Store) StorePollVote(pollID, chatJID, voter string, selected []string, timestamp time.Time) error {
+	selectedJSON, err := json.Marshal(selected)
+	if err != nil {
+		return err
+	}
+	_, err = s.MsgDB.Exec(
+		`INSERT OR REPLACE INTO poll_votes (poll_id, chat_jid, voter, options, timestamp)
+		 VALUES (?, ?, ?, ?, ?)`,
+		pollID, chatJID, voter, string(selectedJSON), timestamp,
+	)
+	return err
+}
+
+// GetPollResults tallies the stored votes for a poll. Returns nil if the poll is unknown.
+func (s *Store) GetPollResults(pollID, chatJID string) (*PollResultsDict, error) {
+	var question, optionsJSON string
+	var selectableCount int
+	err := s.MsgDB.QueryRow(
+		"SELECT question, options, selectable_count FROM polls WHERE id = ? AND chat_jid = ?",
+		pollID, chatJID,
+	).Scan(&question, &optionsJSON, &selectableCount)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get poll: %w", err)
+	}
+
+	var optionNames []string
+	if err := json.Unmarshal([]byte(optionsJSON), &optionNames); err != nil {
+		return nil, fmt.Errorf("decode poll options: %w", err)
+	}
+
+	result := &PollResultsDict{
+		PollID:          pollID,
+		ChatJID:         chatJID,
+		Question:        question,
+		SelectableCount: selectableCount,
+		Options:         make([]PollOptionDict, len(optionNames)),
+	}
+	index := make(map[string]int, len(optionNames))
+	for i, name := range optionNames {
+		result.Options[i] = PollOptionDict{Name: name, Voters: []string{}}
+		index[name] = i
+	}
+
+	rows, err := s.MsgDB.Query(
+		"SELECT voter, options FROM poll_votes WHERE poll_id = ? AND chat_jid = ? ORDER BY timestamp",
+		pollID, chatJID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get poll votes: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var voter, selectedJSON string
+		if err := rows.Scan(&voter, &selectedJSON); err != nil {
+			continue
+		}
+		var selected []string
+		if json.Unmarshal([]byte(selectedJSON), &selected) != nil || len(selected) == 0 {
+			continue // retracted vote
+		}
+		result.TotalVoters++
+		voterName := s.ResolveName(voter)
+		for _, name := range selected {
+			if i, ok := index[name]; ok {
+				result.Options[i].Votes++
+				result.Options[i].Voters = append(result.Options[i].Voters, voterName)
+			}
+		}
+	}
+
+	return result, nil
+}
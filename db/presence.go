@@ -0,0 +1,161 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PresenceHistory is how long presence updates are kept.
+const PresenceHistory = 90 * 24 * time.Hour
+
+// ContactPresence is a contact's last known presence and the hours of day
+// they usually come online.
+type ContactPresence struct {
+	JID          string  `json:"jid"`
+	Name         string  `json:"name"`
+	Status       string  `json:"status"` // online, offline or unknown
+	LastSeen     *string `json:"last_seen,omitempty"`
+	UpdatedAt    *string `json:"updated_at,omitempty"` // when the last presence update arrived
+	Subscribed   bool    `json:"subscribed"`
+	Timezone     string  `json:"timezone"`
+	OnlineByHour [24]int `json:"online_by_hour"` // times the contact came online per hour of day, local time
+	UsualHours   []int   `json:"usual_hours"`    // up to 3 hours of day they most often come online
+	Samples      int     `json:"samples"`        // presence updates the hours are based on
+}
+
+// StorePresence records a presence update and purges updates older than
+// PresenceHistory.
+func (s *Store) StorePresence(jid string, online bool, lastSeen, at time.Time) error {
+	var seen any
+	if !lastSeen.IsZero() {
+		seen = lastSeen
+	}
+	_, err := s.MsgDB.Exec(
+		"INSERT INTO presence (jid, online, last_seen, timestamp) VALUES (?, ?, ?, ?)",
+		jid, online, seen, at,
+	)
+	if err != nil {
+		return fmt.Errorf("store presence: %w", err)
+	}
+	_, err = s.MsgDB.Exec("DELETE FROM presence WHERE timestamp < ?", at.Add(-PresenceHistory))
+	return err
+}
+
+// AddPresenceSubscription remembers to subscribe to a contact's presence
+// after every reconnect.
+func (s *Store) AddPresenceSubscription(jid string, at time.Time) error {
+	_, err := s.MsgDB.Exec(
+		"INSERT OR IGNORE INTO presence_subscriptions (jid, subscribed_at) VALUES (?, ?)", jid, at)
+	if err != nil {
+		return fmt.Errorf("add presence subscription: %w", err)
+	}
+	return nil
+}
+
+// RemovePresenceSubscription stops renewing a presence subscription.
+// Returns false if there was none.
+func (s *Store) RemovePresenceSubscription(jid string) (bool, error) {
+	res, err := s.MsgDB.Exec("DELETE FROM presence_subscriptions WHERE jid = ?", jid)
+	if err != nil {
+		return false, fmt.Errorf("remove presence subscription: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// PresenceSubscriptions returns the JIDs whose presence is subscribed to.
+func (s *Store) PresenceSubscriptions() ([]string, error) {
+	rows, err := s.MsgDB.Query("SELECT jid FROM presence_subscriptions ORDER BY subscribed_at")
+	if err != nil {
+		return nil, fmt.Errorf("list presence subscriptions: %w", err)
+	}
+	defer rows.Close()
+	var jids []string
+	for rows.Next() {
+		var jid string
+		if err := rows.Scan(&jid); err != nil {
+			return nil, err
+		}
+		jids = append(jids, jid)
+	}
+	return jids, rows.Err()
+}
+
+// GetContactPresence returns a contact's last recorded presence and counts
+// the times they came online per hour of day since the given time.
+func (s *Store) GetContactPresence(jid string, since time.Time) (*ContactPresence, error) {
+	if !strings.Contains(jid, "@") {
+		jid += "@s.whatsapp.net"
+	}
+	jids := s.LinkedJIDs(jid)
+	in := "jid IN (" + placeholders(len(jids)) + ")"
+	args := repeatArgs(jids, 1)
+
+	zone, _ := time.Now().Zone()
+	p := &ContactPresence{JID: jid, Name: s.ResolveName(jid), Status: "unknown", Timezone: zone, UsualHours: []int{}}
+
+	var online bool
+	var lastSeen sql.NullString
+	var updatedAt string
+	err := s.MsgDB.QueryRow(
+		"SELECT online, last_seen, timestamp FROM presence WHERE "+in+" ORDER BY timestamp DESC LIMIT 1", args...,
+	).Scan(&online, &lastSeen, &updatedAt)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return nil, fmt.Errorf("get presence: %w", err)
+	default:
+		p.Status = "offline"
+		if online {
+			p.Status = "online"
+		}
+		if lastSeen.Valid {
+			p.LastSeen = &lastSeen.String
+		}
+		p.UpdatedAt = &updatedAt
+	}
+
+	var n int
+	if err := s.MsgDB.QueryRow("SELECT COUNT(*) FROM presence_subscriptions WHERE "+in, args...).Scan(&n); err != nil {
+		return nil, fmt.Errorf("get presence subscription: %w", err)
+	}
+	p.Subscribed = n > 0
+
+	// A contact came online when an online update follows an offline one
+	rows, err := s.MsgDB.Query(
+		"SELECT online, timestamp FROM presence WHERE "+in+" AND timestamp > ? ORDER BY timestamp",
+		append(args, since)...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get presence history: %w", err)
+	}
+	defer rows.Close()
+	wasOnline := false
+	for rows.Next() {
+		var ts time.Time
+		if rows.Scan(&online, &ts) != nil {
+			continue
+		}
+		p.Samples++
+		if online && !wasOnline {
+			p.OnlineByHour[ts.Local().Hour()]++
+		}
+		wasOnline = online
+	}
+
+	var hours []int
+	for hour, count := range p.OnlineByHour {
+		if count > 0 {
+			hours = append(hours, hour)
+		}
+	}
+	sort.SliceStable(hours, func(i, j int) bool { return p.OnlineByHour[hours[i]] > p.OnlineByHour[hours[j]] })
+	if len(hours) > 3 {
+		hours = hours[:3]
+	}
+	p.UsualHours = append(p.UsualHours, hours...)
+	return p, rows.Err()
+}
@@ -0,0 +1,45 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// ChatProfile holds hints on how the user writes in a chat, so drafted
+// replies can match their usual tone with that person.
+type ChatProfile struct {
+	Language  string `json:"language,omitempty"`  // e.g. "de" or "English"
+	Formality string `json:"formality,omitempty"` // casual, neutral or formal
+	Emoji     string `json:"emoji,omitempty"`     // none, some or lots
+}
+
+// SetChatProfile creates or replaces the profile of a chat.
+// A profile with all fields empty is removed.
+func (s *Store) SetChatProfile(chatJID string, p ChatProfile) error {
+	if p == (ChatProfile{}) {
+		_, err := s.MsgDB.Exec("DELETE FROM chat_profiles WHERE chat_jid = ?", chatJID)
+		return err
+	}
+	_, err := s.MsgDB.Exec(
+		`INSERT OR REPLACE INTO chat_profiles (chat_jid, language, formality, emoji, updated_at)
+		 VALUES (?, ?, ?, ?, ?)`,
+		chatJID, p.Language, p.Formality, p.Emoji, time.Now(),
+	)
+	return err
+}
+
+// GetChatProfile returns the profile of a chat, or nil if none is set.
+func (s *Store) GetChatProfile(chatJID string) (*ChatProfile, error) {
+	var p ChatProfile
+	err := s.MsgDB.QueryRow(
+		"SELECT language, formality, emoji FROM chat_profiles WHERE chat_jid = ?", chatJID,
+	).Scan(&p.Language, &p.Formality, &p.Emoji)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get chat profile: %w", err)
+	}
+	return &p, nil
+}
@@ -0,0 +1,268 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SourceWhatsAppMCP marks messages imported from the database of the Python
+// whatsapp-mcp bridge.
+const SourceWhatsAppMCP = "whatsapp_mcp"
+
+// WhatsAppMCPImport is the result of ImportWhatsAppMCP.
+type WhatsAppMCPImport struct {
+	Chats     int // chats that were not stored yet
+	Messages  int // messages stored
+	Duplicate int // messages already stored, by ID and chat
+	Failed    int // rows that could not be read or stored
+}
+
+// whatsAppMCPMediaColumns are the messages columns of whatsapp-mcp that its
+// older versions lack; they are read as NULL when missing.
+var whatsAppMCPMediaColumns = []string{"media_type", "filename", "url", "media_key", "file_sha256", "file_enc_sha256", "file_length"}
+
+// insertMessageIgnore stores a message like upsertMessage but leaves a
+// message that is already stored alone.
+var insertMessageIgnore = func() string {
+	insert, _, _ := strings.Cut(upsertMessage, "ON CONFLICT")
+	return insert + "ON CONFLICT(id, chat_jid) DO NOTHING"
+}()
+
+// ImportWhatsAppMCP merges the chats and messages of a messages.db written
+// by the Python whatsapp-mcp bridge into the store. Messages already
+// stored, by ID and chat JID, are kept as they are; chats keep their name.
+func (s *Store) ImportWhatsAppMCP(path string) (WhatsAppMCPImport, error) {
+	var result WhatsAppMCPImport
+	src, err := sql.Open("sqlite", "file:"+path+"?mode=ro")
+	if err != nil {
+		return result, err
+	}
+	defer src.Close()
+
+	columns, err := tableColumns(src, "messages")
+	if err != nil {
+		return result, err
+	}
+	for _, required := range []string{"id", "chat_jid", "sender", "content", "timestamp", "is_from_me"} {
+		if !columns[required] {
+			return result, fmt.Errorf("%s is not a whatsapp-mcp database: messages has no %s column", path, required)
+		}
+	}
+
+	if result.Chats, err = s.importWhatsAppMCPChats(src); err != nil {
+		return result, err
+	}
+
+	selected := []string{"id", "chat_jid", "sender", "content", "timestamp", "is_from_me"}
+	for _, c := range whatsAppMCPMediaColumns {
+		if columns[c] {
+			selected = append(selected, c)
+		} else {
+			selected = append(selected, "NULL")
+		}
+	}
+	rows, err := src.Query("SELECT " + strings.Join(selected, ", ") + " FROM messages ORDER BY timestamp")
+	if err != nil {
+		return result, fmt.Errorf("read messages: %w", err)
+	}
+	defer rows.Close()
+
+	var batch [][]any
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		args := batch
+		batch = nil
+		// Counted only once the batch is committed
+		var stored, duplicate, failed int
+		err := s.write(len(args), func(tx *sql.Tx) error {
+			stmt, err := tx.Prepare(insertMessageIgnore)
+			if err != nil {
+				return err
+			}
+			defer stmt.Close()
+			for _, a := range args {
+				// Messages may name chats missing from the chats table
+				if _, err := tx.Exec("INSERT INTO chats (jid) VALUES (?) ON CONFLICT DO NOTHING", a[1]); err != nil {
+					return err
+				}
+				res, err := stmt.Exec(a...)
+				if err != nil {
+					failed++
+					continue
+				}
+				if n, _ := res.RowsAffected(); n > 0 {
+					stored++
+				} else {
+					duplicate++
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		result.Messages += stored
+		result.Duplicate += duplicate
+		result.Failed += failed
+		return nil
+	}
+	for rows.Next() {
+		var m MessageRecord
+		var sender, content, mediaType, filename, url sql.NullString
+		var timestamp any
+		var fileLength sql.NullInt64
+		if err := rows.Scan(&m.ID, &m.ChatJID, &sender, &content, &timestamp, &m.IsFromMe,
+			&mediaType, &filename, &url, &m.MediaKey, &m.FileSHA256, &m.FileEncSHA256, &fileLength); err != nil {
+			result.Failed++
+			continue
+		}
+		ts, ok := parseImportedTime(timestamp)
+		if !ok || m.ID == "" || m.ChatJID == "" {
+			result.Failed++
+			continue
+		}
+		m.Sender, m.Content, m.Timestamp = sender.String, content.String, ts
+		m.MediaType, m.Filename, m.URL = mediaType.String, filename.String, url.String
+		m.FileLength = uint64(max(fileLength.Int64, 0))
+		m.Source = SourceWhatsAppMCP
+		if m.Content == "" && m.MediaType == "" {
+			continue
+		}
+		batch = append(batch, s.messageArgs(m))
+		if len(batch) == WriteBatchSize {
+			if err := flush(); err != nil {
+				return result, err
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return result, fmt.Errorf("read messages: %w", err)
+	}
+	if err := flush(); err != nil {
+		return result, err
+	}
+	s.InvalidateNames()
+	return result, nil
+}
+
+// importWhatsAppMCPChats adds the chats of a whatsapp-mcp database and
+// returns how many were new. Stored chats keep their name unless they have
+// none; the last message time only moves forward.
+func (s *Store) importWhatsAppMCPChats(src *sql.DB) (int, error) {
+	rows, err := src.Query("SELECT jid, name, last_message_time FROM chats")
+	if err != nil {
+		return 0, fmt.Errorf("read chats: %w", err)
+	}
+	type chat struct {
+		jid, name string
+		last      time.Time // zero if unknown
+	}
+	var chats []chat
+	for rows.Next() {
+		var jid string
+		var name sql.NullString
+		var last any
+		if err := rows.Scan(&jid, &name, &last); err != nil || jid == "" {
+			continue
+		}
+		lastTime, _ := parseImportedTime(last)
+		chats = append(chats, chat{jid, name.String, lastTime})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("read chats: %w", err)
+	}
+
+	added := 0
+	err = s.write(len(chats), func(tx *sql.Tx) error {
+		added = 0
+		for _, c := range chats {
+			// The times are compared parsed, as the two databases may store
+			// them in different formats and time zones
+			var stored any
+			err := tx.QueryRow("SELECT last_message_time FROM chats WHERE jid = ?", c.jid).Scan(&stored)
+			exists := err == nil
+			if err != nil && err != sql.ErrNoRows {
+				return err
+			}
+			var lastTime any
+			if current, ok := parseImportedTime(stored); ok && !c.last.After(current) {
+				lastTime = current
+			} else if !c.last.IsZero() {
+				lastTime = c.last
+			}
+			if _, err := tx.Exec(
+				`INSERT INTO chats (jid, name, last_message_time) VALUES (?, NULLIF(?, ''), ?)
+				 ON CONFLICT(jid) DO UPDATE SET name = COALESCE(NULLIF(chats.name, ''), excluded.name),
+					last_message_time = COALESCE(excluded.last_message_time, chats.last_message_time)`,
+				c.jid, c.name, lastTime,
+			); err != nil {
+				return err
+			}
+			if !exists {
+				added++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("store chats: %w", err)
+	}
+	return added, nil
+}
+
+// tableColumns returns the column names of a table.
+func tableColumns(conn *sql.DB, table string) (map[string]bool, error) {
+	rows, err := conn.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		columns[name] = true
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("no %s table", table)
+	}
+	return columns, rows.Err()
+}
+
+// importedTimeLayouts are the ways SQLite drivers store time.Time values.
+var importedTimeLayouts = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999 -0700 MST", // time.Time.String()
+}
+
+// parseImportedTime reads a timestamp column of another database.
+func parseImportedTime(v any) (time.Time, bool) {
+	switch v := v.(type) {
+	case time.Time:
+		return v, !v.IsZero()
+	case int64:
+		return time.Unix(v, 0), v > 0
+	case []byte:
+		return parseImportedTime(string(v))
+	case string:
+		v, _, _ = strings.Cut(v, " m=") // monotonic clock reading of time.Time.String()
+		for _, layout := range importedTimeLayouts {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
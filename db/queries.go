@@ -2,40 +2,136 @@ package db
 
 import (
 	"database/sql"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
+	"time"
 )
 
 // MessageDict is the structured output for MCP tool responses.
 type MessageDict struct {
-	ID        string  `json:"id"`
-	Timestamp string  `json:"timestamp"`
-	Sender    string  `json:"sender"`
-	SenderJID string  `json:"sender_jid"`
-	Content   string  `json:"content"`
-	IsFromMe  bool    `json:"is_from_me"`
-	ChatJID   string  `json:"chat_jid"`
-	ChatName  *string `json:"chat_name,omitempty"`
-	MediaType *string `json:"media_type,omitempty"`
+	ID        string    `json:"id"`
+	Timestamp string    `json:"timestamp"`
+	Sender    string    `json:"sender"`
+	SenderJID string    `json:"sender_jid"`
+	Content   string    `json:"content"`
+	IsFromMe  bool      `json:"is_from_me"`
+	ChatJID   string    `json:"chat_jid"`
+	ChatName  *string   `json:"chat_name,omitempty"`
+	MediaType *string   `json:"media_type,omitempty"`
+	Filename  *string   `json:"filename,omitempty"`
+	MimeType  *string   `json:"mimetype,omitempty"`
+	FileSize  *int64    `json:"file_size,omitempty"`  // bytes
+	PageCount *int      `json:"page_count,omitempty"` // pages of a document
+	LocalPath *string   `json:"local_path,omitempty"`
+	Location  *Location `json:"location,omitempty"`
+	VCard     *string   `json:"vcard,omitempty"`
+
+	// Set for replies: the quoted message and its sender (see get_thread)
+	QuotedMessageID *string `json:"quoted_message_id,omitempty"`
+	QuotedSender    *string `json:"quoted_sender,omitempty"`
+
+	MentionedJIDs []string `json:"mentioned_jids,omitempty"` // JIDs @-mentioned in the message
+	WasIMentioned bool     `json:"was_i_mentioned,omitempty"`
+
+	Starred   bool    `json:"starred,omitempty"`
+	StarredAt *string `json:"starred_at,omitempty"`
+
+	Transcript *string `json:"transcript,omitempty"` // text of a transcribed audio message
+
+	// TextTruncated is set when content or transcript were cut to keep within max_chars
+	TextTruncated bool `json:"text_truncated,omitempty"`
+
+	ViewOnce bool    `json:"view_once,omitempty"` // view-once media, see download_media
+	ViewedAt *string `json:"viewed_at,omitempty"`
+
+	Pending     bool `json:"pending,omitempty"`     // sent by us, not yet acknowledged by WhatsApp
+	Unconfirmed bool `json:"unconfirmed,omitempty"` // sending timed out and WhatsApp never acknowledged it
+
+	// Verification metadata: where the message came from and whether it changed
+	Source          string  `json:"source,omitempty"`           // "live", "history_sync" or "fetched"
+	SenderTimestamp *string `json:"sender_timestamp,omitempty"` // client-side send time; Timestamp is the server's
+	Edited          bool    `json:"edited,omitempty"`
+	EditedAt        *string `json:"edited_at,omitempty"`
+	Revoked         bool    `json:"revoked,omitempty"`
+	RevokedAt       *string `json:"revoked_at,omitempty"`
 }
 
 // ChatDict is the structured output for chat queries.
 type ChatDict struct {
-	JID             string  `json:"jid"`
-	Name            *string `json:"name"`
-	IsGroup         bool    `json:"is_group"`
-	LastMessageTime *string `json:"last_message_time,omitempty"`
-	LastMessage     *string `json:"last_message,omitempty"`
-	LastSender      *string `json:"last_sender,omitempty"`
-	LastIsFromMe    *bool   `json:"last_is_from_me,omitempty"`
+	JID             string       `json:"jid"`
+	Name            *string      `json:"name"`
+	IsGroup         bool         `json:"is_group"`
+	LastMessageTime *string      `json:"last_message_time,omitempty"`
+	LastMessage     *string      `json:"last_message,omitempty"`
+	LastSender      *string      `json:"last_sender,omitempty"`
+	LastIsFromMe    *bool        `json:"last_is_from_me,omitempty"`
+	Archived        bool         `json:"archived,omitempty"`
+	Pinned          bool         `json:"pinned,omitempty"`
+	Muted           bool         `json:"muted,omitempty"`
+	MutedUntil      *string      `json:"muted_until,omitempty"`  // unset while muted means forever
+	AutoRead        bool         `json:"auto_read,omitempty"`    // incoming messages get read receipts automatically
+	SendProfile     string       `json:"send_profile,omitempty"` // empty = send immediately
+	Disappearing    string       `json:"disappearing,omitempty"` // e.g. 7d; new messages expire after this long
+	RetainDays      *int         `json:"retain_days,omitempty"`  // stored messages are kept this many days, 0 = forever; unset = server default
+	UnreadCount     int          `json:"unread_count"`           // incoming messages after the last-read time
+	Profile         *ChatProfile `json:"profile,omitempty"`
 }
 
 // ContactDict is the structured output for contact queries.
 type ContactDict struct {
 	PhoneNumber string  `json:"phone_number"`
 	Name        *string `json:"name"`
+	Alias       *string `json:"alias,omitempty"` // set with set_contact_alias
 	JID         string  `json:"jid"`
+	IsBusiness  *bool   `json:"is_business,omitempty"` // set only when checked
+
+	// Set when the contact's security code changed in the last week (see list_security_events)
+	SecurityCodeChangedAt *string `json:"security_code_changed_at,omitempty"`
+}
+
+// PageInfo describes the page of a paginated list: which page it is, the
+// page size and how many results match in total.
+type PageInfo struct {
+	TotalCount int  `json:"total_count"`
+	Page       int  `json:"page"`
+	PageSize   int  `json:"page_size"`
+	HasMore    bool `json:"has_more"`
+
+	// NextCursor continues after this page, for lists with cursor pagination
+	NextCursor string `json:"next_cursor,omitempty"`
+
+	// Truncated is set when messages or their text were left out to keep
+	// within a size budget
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+func newPageInfo(total, page, pageSize int) PageInfo {
+	return PageInfo{TotalCount: total, Page: page, PageSize: pageSize, HasMore: (page+1)*pageSize < total}
+}
+
+// messageCursor is the position of a message in list order (newest first).
+// Cursors are opaque to callers: the fields joined by NUL, base64-encoded.
+type messageCursor struct {
+	timestamp, chatJID, id string
+}
+
+func (c messageCursor) encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.timestamp + "\x00" + c.chatJID + "\x00" + c.id))
+}
+
+func decodeMessageCursor(cursor string) (messageCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return messageCursor{}, errors.New("invalid cursor")
+	}
+	parts := strings.Split(string(b), "\x00")
+	if len(parts) != 3 {
+		return messageCursor{}, errors.New("invalid cursor")
+	}
+	return messageCursor{timestamp: parts[0], chatJID: parts[1], id: parts[2]}, nil
 }
 
 // MessageContextDict wraps a message with surrounding context.
@@ -47,28 +143,119 @@ type MessageContextDict struct {
 
 // internal raw message from DB scan
 type rawMessage struct {
-	timestamp string
-	sender    string
-	chatName  sql.NullString
-	content   sql.NullString
-	isFromMe  bool
-	chatJID   string
-	id        string
-	mediaType sql.NullString
+	timestamp   string
+	sender      string
+	chatName    sql.NullString
+	content     sql.NullString
+	isFromMe    bool
+	chatJID     string
+	id          string
+	mediaType   sql.NullString
+	filename    sql.NullString
+	mimeType    sql.NullString
+	fileSize    sql.NullInt64
+	pageCount   sql.NullInt64
+	edited      sql.NullBool
+	editedAt    sql.NullString
+	revoked     sql.NullBool
+	revokedAt   sql.NullString
+	source      sql.NullString
+	senderTS    sql.NullString
+	localPath   sql.NullString
+	senderName  sql.NullString
+	latitude    sql.NullFloat64
+	longitude   sql.NullFloat64
+	locName     sql.NullString
+	locAddress  sql.NullString
+	vcard       sql.NullString
+	quotedID    sql.NullString
+	quotedFrom  sql.NullString
+	mentioned   sql.NullString
+	mentionsMe  sql.NullBool
+	starred     sql.NullBool
+	starredAt   sql.NullString
+	viewOnce    sql.NullBool
+	viewedAt    sql.NullString
+	pending     sql.NullBool
+	unconfirmed sql.NullBool
+	transcript  sql.NullString
+}
+
+// messageColumns is the column list scanned by scanMessage.
+// Queries using it must alias the tables as messages and chats.
+const messageColumns = `messages.timestamp, messages.sender, chats.name, wahoo_decrypt(messages.content),
+	messages.is_from_me, chats.jid, messages.id, messages.media_type,
+	messages.filename, messages.mimetype, messages.file_length, messages.page_count,
+	messages.edited, messages.edited_at, messages.revoked, messages.revoked_at, messages.source, messages.sender_timestamp,
+	messages.local_path, messages.sender_name,
+	messages.latitude, messages.longitude, messages.location_name, messages.location_address,
+	wahoo_decrypt(messages.vcard), messages.quoted_message_id, messages.quoted_sender,
+	messages.mentioned_jids, messages.mentions_me, messages.starred, messages.starred_at,
+	messages.view_once, messages.viewed_at, messages.pending, messages.unconfirmed, ` + transcriptColumn
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanMessage scans a row selected with messageColumns.
+func scanMessage(row rowScanner) (rawMessage, error) {
+	var m rawMessage
+	err := row.Scan(&m.timestamp, &m.sender, &m.chatName, &m.content,
+		&m.isFromMe, &m.chatJID, &m.id, &m.mediaType,
+		&m.filename, &m.mimeType, &m.fileSize, &m.pageCount,
+		&m.edited, &m.editedAt, &m.revoked, &m.revokedAt, &m.source, &m.senderTS,
+		&m.localPath, &m.senderName,
+		&m.latitude, &m.longitude, &m.locName, &m.locAddress, &m.vcard, &m.quotedID, &m.quotedFrom,
+		&m.mentioned, &m.mentionsMe, &m.starred, &m.starredAt, &m.viewOnce, &m.viewedAt, &m.pending, &m.unconfirmed, &m.transcript)
+	return m, err
 }
 
 // rawChat holds scanned chat data before conversion to ChatDict
 type rawChat struct {
-	jid          string
-	name         sql.NullString
-	lastTime     sql.NullString
-	lastMsg      sql.NullString
-	lastSender   sql.NullString
-	lastIsFromMe sql.NullBool
+	jid            string
+	name           sql.NullString
+	lastTime       sql.NullString
+	lastMsg        sql.NullString
+	lastSender     sql.NullString
+	lastIsFromMe   sql.NullBool
+	lastSenderName sql.NullString
+	archived       sql.NullBool
+	pinned         sql.NullBool
+	muted          sql.NullBool
+	mutedUntil     sql.NullString
+	autoRead       sql.NullBool
+	sendProfile    sql.NullString
+	disappearing   sql.NullInt64
+	retainDays     sql.NullInt64
+	unreadCount    int
 }
 
-// toDict converts rawChat to ChatDict with resolved last sender.
-func (r rawChat) toDict(cache map[string]string) ChatDict {
+// chatStateColumns are the app-state and read-state columns selected after the last-message columns.
+const chatStateColumns = "chats.archived, chats.pinned, chats.muted, chats.muted_until, chats.auto_read, chats.send_profile, " +
+	"chats.disappearing_timer, chats.retain_days, " +
+	unreadCountColumn
+
+// unreadCountColumn counts the incoming messages of a chat newer than its
+// last-read time. Chats never read count all incoming messages.
+const unreadCountColumn = `(SELECT COUNT(*) FROM messages unread
+	WHERE unread.chat_jid = chats.jid AND unread.is_from_me = 0
+	AND (chats.last_read_time IS NULL OR unread.timestamp > chats.last_read_time))`
+
+// scanDest returns the scan destinations matching a chat query's column order.
+func (r *rawChat) scanDest() []any {
+	return []any{&r.jid, &r.name, &r.lastTime, &r.lastMsg, &r.lastSender, &r.lastIsFromMe, &r.lastSenderName,
+		&r.archived, &r.pinned, &r.muted, &r.mutedUntil, &r.autoRead, &r.sendProfile, &r.disappearing, &r.retainDays,
+		&r.unreadCount}
+}
+
+// clearLastMessage drops the last-message columns for callers that did not ask for them.
+func (r *rawChat) clearLastMessage() {
+	r.lastMsg, r.lastSender, r.lastIsFromMe, r.lastSenderName = sql.NullString{}, sql.NullString{}, sql.NullBool{}, sql.NullString{}
+}
+
+// toDict converts rawChat to ChatDict.
+func (r rawChat) toDict() ChatDict {
 	d := ChatDict{
 		JID:     r.jid,
 		IsGroup: strings.HasSuffix(r.jid, "@g.us"),
@@ -83,20 +270,36 @@ func (r rawChat) toDict(cache map[string]string) ChatDict {
 		d.LastMessage = &r.lastMsg.String
 	}
 	if r.lastSender.Valid {
-		senderName := resolveMessageSender(r.lastSender.String, r.lastIsFromMe.Valid && r.lastIsFromMe.Bool, cache)
+		senderName := displaySender(r.lastSender.String, r.lastSenderName, r.lastIsFromMe.Valid && r.lastIsFromMe.Bool)
 		d.LastSender = &senderName
 	}
 	if r.lastIsFromMe.Valid {
 		v := r.lastIsFromMe.Bool
 		d.LastIsFromMe = &v
 	}
+	d.Archived = r.archived.Bool
+	d.Pinned = r.pinned.Bool
+	d.Muted = r.muted.Bool
+	if d.Muted && r.mutedUntil.Valid {
+		d.MutedUntil = &r.mutedUntil.String
+	}
+	d.AutoRead = r.autoRead.Bool
+	d.SendProfile = r.sendProfile.String
+	d.Disappearing = FormatDisappearingTimer(time.Duration(r.disappearing.Int64) * time.Second)
+	if r.retainDays.Valid {
+		days := int(r.retainDays.Int64)
+		d.RetainDays = &days
+	}
+	d.UnreadCount = r.unreadCount
 	return d
 }
 
 // BuildSenderCache builds a JID -> display name lookup from both databases.
-// Priority: whatsmeow contacts > chats table (chats often store phone numbers as names).
+// Priority: contact aliases > whatsmeow contacts > chats table (chats often
+// store phone numbers as names).
 func (s *Store) BuildSenderCache() map[string]string {
 	cache := make(map[string]string)
+	defer s.applyAliases(cache)
 
 	// 1) Chat names from messages.db (lower priority)
 	rows, err := s.MsgDB.Query("SELECT jid, name FROM chats WHERE name IS NOT NULL AND name != ''")
@@ -143,25 +346,36 @@ func (s *Store) BuildSenderCache() map[string]string {
 
 	// 3) LID map: lid -> pn (phone number) -> contact name
 	rows3, err := s.WaDB.Query("SELECT lid, pn FROM whatsmeow_lid_map")
-	if err != nil {
-		return cache
-	}
-	defer rows3.Close()
-	for rows3.Next() {
-		var lid, pn string
-		if rows3.Scan(&lid, &pn) == nil {
-			pnJID := pn + "@s.whatsapp.net"
-			name := cache[pnJID]
-			if name == "" {
-				name = cache[pn]
-			}
-			if name != "" {
-				cache[lid+"@lid"] = name
-				cache[lid] = name
+	if err == nil {
+		defer rows3.Close()
+		for rows3.Next() {
+			var lid, pn string
+			if rows3.Scan(&lid, &pn) == nil {
+				pnJID := pn + "@s.whatsapp.net"
+				name := cache[pnJID]
+				if name == "" {
+					name = cache[pn]
+				}
+				if name != "" {
+					cache[lid+"@lid"] = name
+					cache[lid] = name
+				}
 			}
 		}
 	}
 
+	// 4) Linked identities (number changes): old JIDs show the current name
+	for jid, canonical := range s.identityLinks() {
+		name := resolveSender(canonical, cache)
+		if name == canonical {
+			continue
+		}
+		cache[jid] = name
+		if idx := strings.Index(jid, "@"); idx > 0 {
+			cache[jid[:idx]] = name
+		}
+	}
+
 	return cache
 }
 
@@ -178,12 +392,21 @@ func resolveSender(senderJID string, cache map[string]string) string {
 	return senderJID
 }
 
-// rawToDict converts a raw DB row to a MessageDict with resolved sender.
-func rawToDict(r rawMessage, cache map[string]string) MessageDict {
+// DisplayNames resolves a batch of JIDs to display names, falling back to the JID itself.
+func (s *Store) DisplayNames(jids []string) map[string]string {
+	names := make(map[string]string, len(jids))
+	for _, jid := range jids {
+		names[jid] = s.ResolveName(jid)
+	}
+	return names
+}
+
+// rawToDict converts a raw DB row to a MessageDict.
+func rawToDict(r rawMessage) MessageDict {
 	d := MessageDict{
 		ID:        r.id,
 		Timestamp: r.timestamp,
-		Sender:    resolveMessageSender(r.sender, r.isFromMe, cache),
+		Sender:    displaySender(r.sender, r.senderName, r.isFromMe),
 		SenderJID: r.sender,
 		Content:   r.content.String,
 		IsFromMe:  r.isFromMe,
@@ -194,16 +417,81 @@ func rawToDict(r rawMessage, cache map[string]string) MessageDict {
 	}
 	if r.mediaType.Valid && r.mediaType.String != "" {
 		d.MediaType = &r.mediaType.String
+		if r.filename.Valid && r.filename.String != "" {
+			d.Filename = &r.filename.String
+		}
+		if r.mimeType.Valid && r.mimeType.String != "" {
+			d.MimeType = &r.mimeType.String
+		}
+		if r.fileSize.Valid && r.fileSize.Int64 > 0 {
+			d.FileSize = &r.fileSize.Int64
+		}
+		if r.pageCount.Valid && r.pageCount.Int64 > 0 {
+			pages := int(r.pageCount.Int64)
+			d.PageCount = &pages
+		}
+	}
+	if r.localPath.Valid && r.localPath.String != "" {
+		d.LocalPath = &r.localPath.String
+	}
+	d.Source = r.source.String
+	if r.senderTS.Valid && r.senderTS.String != "" {
+		d.SenderTimestamp = &r.senderTS.String
+	}
+	d.Edited = r.edited.Valid && r.edited.Bool
+	if r.editedAt.Valid && r.editedAt.String != "" {
+		d.EditedAt = &r.editedAt.String
+	}
+	d.Revoked = r.revoked.Valid && r.revoked.Bool
+	if r.revokedAt.Valid && r.revokedAt.String != "" {
+		d.RevokedAt = &r.revokedAt.String
+	}
+	if r.latitude.Valid && r.longitude.Valid {
+		d.Location = &Location{
+			Latitude:  r.latitude.Float64,
+			Longitude: r.longitude.Float64,
+			Name:      r.locName.String,
+			Address:   r.locAddress.String,
+		}
+	}
+	if r.vcard.Valid && r.vcard.String != "" {
+		d.VCard = &r.vcard.String
+	}
+	if r.quotedID.Valid && r.quotedID.String != "" {
+		d.QuotedMessageID = &r.quotedID.String
+		if r.quotedFrom.Valid && r.quotedFrom.String != "" {
+			d.QuotedSender = &r.quotedFrom.String
+		}
+	}
+	if r.mentioned.Valid && r.mentioned.String != "" {
+		d.MentionedJIDs = strings.Split(r.mentioned.String, "\n")
+	}
+	d.WasIMentioned = r.mentionsMe.Valid && r.mentionsMe.Bool
+	d.Starred = r.starred.Valid && r.starred.Bool
+	if d.Starred && r.starredAt.Valid && r.starredAt.String != "" {
+		d.StarredAt = &r.starredAt.String
+	}
+	d.ViewOnce = r.viewOnce.Valid && r.viewOnce.Bool
+	if r.viewedAt.Valid && r.viewedAt.String != "" {
+		d.ViewedAt = &r.viewedAt.String
+	}
+	d.Pending = r.pending.Valid && r.pending.Bool
+	d.Unconfirmed = r.unconfirmed.Valid && r.unconfirmed.Bool
+	if r.transcript.Valid && r.transcript.String != "" {
+		d.Transcript = &r.transcript.String
 	}
 	return d
 }
 
-// resolveMessageSender resolves a sender JID to a display name, handling "Me" for own messages.
-func resolveMessageSender(senderJID string, isFromMe bool, cache map[string]string) string {
+// displaySender returns the precomputed sender name of a message, handling "Me" for own messages.
+func displaySender(senderJID string, senderName sql.NullString, isFromMe bool) string {
 	if isFromMe {
 		return "Me"
 	}
-	return resolveSender(senderJID, cache)
+	if senderName.Valid && senderName.String != "" {
+		return senderName.String
+	}
+	return senderJID
 }
 
 // ListMessagesOpts holds parameters for ListMessages.
@@ -213,15 +501,27 @@ type ListMessagesOpts struct {
 	SenderPhoneNumber *string
 	ChatJID           *string
 	Query             *string
+	Cursor            string // continue after this NextCursor instead of paging by offset
+	MentionsMe        bool   // only messages that @-mention our own account
+	Starred           bool   // only starred messages
 	Limit             int
 	Page              int
 	IncludeContext    bool
 	ContextBefore     int
 	ContextAfter      int
+
+	// Budgets for the size of the result; 0 is unlimited. MaxTotalMessages
+	// counts matches and context, and caps the page size. MaxChars counts
+	// content and transcripts.
+	MaxTotalMessages int
+	MaxChars         int
 }
 
 // ListMessages returns messages matching the criteria with optional context.
-func (s *Store) ListMessages(opts ListMessagesOpts) ([]MessageDict, error) {
+// The page info counts matching messages, not the context around them. Paging
+// with the returned NextCursor is stable while new messages arrive; paging by
+// offset shifts as they push older messages down.
+func (s *Store) ListMessages(opts ListMessagesOpts) ([]MessageDict, PageInfo, error) {
 	if opts.Limit == 0 {
 		opts.Limit = 20
 	}
@@ -231,13 +531,12 @@ func (s *Store) ListMessages(opts ListMessagesOpts) ([]MessageDict, error) {
 	if opts.IncludeContext && opts.ContextAfter == 0 {
 		opts.ContextAfter = 1
 	}
-
-	queryParts := []string{
-		`SELECT messages.timestamp, messages.sender, chats.name, messages.content,
-		 messages.is_from_me, chats.jid, messages.id, messages.media_type
-		 FROM messages
-		 JOIN chats ON messages.chat_jid = chats.jid`,
+	limitCapped := false
+	if opts.MaxTotalMessages > 0 && opts.Limit > opts.MaxTotalMessages {
+		opts.Limit, limitCapped = opts.MaxTotalMessages, true
 	}
+
+	queryParts := []string{"FROM messages JOIN chats ON messages.chat_jid = chats.jid"}
 	var whereClauses []string
 	var params []any
 
@@ -250,15 +549,22 @@ func (s *Store) ListMessages(opts ListMessagesOpts) ([]MessageDict, error) {
 		params = append(params, *opts.Before)
 	}
 	if opts.SenderPhoneNumber != nil {
-		whereClauses = append(whereClauses, "messages.sender = ?")
-		params = append(params, *opts.SenderPhoneNumber)
+		senders := s.LinkedJIDs(*opts.SenderPhoneNumber)
+		whereClauses = append(whereClauses, "messages.sender IN ("+placeholders(len(senders))+")")
+		params = append(params, repeatArgs(senders, 1)...)
 	}
 	if opts.ChatJID != nil {
 		whereClauses = append(whereClauses, "messages.chat_jid = ?")
 		params = append(params, *opts.ChatJID)
 	}
+	if opts.MentionsMe {
+		whereClauses = append(whereClauses, "messages.mentions_me = 1")
+	}
+	if opts.Starred {
+		whereClauses = append(whereClauses, "messages.starred = 1")
+	}
 	if opts.Query != nil {
-		whereClauses = append(whereClauses, "(LOWER(messages.content) LIKE LOWER(?) OR LOWER(messages.media_type) LIKE LOWER(?))")
+		whereClauses = append(whereClauses, "(LOWER(wahoo_decrypt(messages.content)) LIKE LOWER(?) OR LOWER(messages.media_type) LIKE LOWER(?))")
 		q := "%" + *opts.Query + "%"
 		params = append(params, q, q)
 	}
@@ -267,118 +573,189 @@ func (s *Store) ListMessages(opts ListMessagesOpts) ([]MessageDict, error) {
 		queryParts = append(queryParts, "WHERE "+strings.Join(whereClauses, " AND "))
 	}
 
+	var total int
+	if err := s.MsgDB.QueryRow("SELECT COUNT(*) "+strings.Join(queryParts, " "), params...).Scan(&total); err != nil {
+		return nil, PageInfo{}, fmt.Errorf("count messages: %w", err)
+	}
+	page := PageInfo{TotalCount: total, Page: opts.Page, PageSize: opts.Limit}
+
 	offset := opts.Page * opts.Limit
-	queryParts = append(queryParts, "ORDER BY messages.timestamp DESC")
+	if opts.Cursor != "" {
+		c, err := decodeMessageCursor(opts.Cursor)
+		if err != nil {
+			return nil, PageInfo{}, err
+		}
+		// Keyset pagination: continue after the cursor's message
+		keyset := `messages.timestamp <= ? AND (messages.timestamp < ? OR (messages.chat_jid, messages.id) < (?, ?))`
+		if len(whereClauses) > 0 {
+			queryParts = append(queryParts, "AND "+keyset)
+		} else {
+			queryParts = append(queryParts, "WHERE "+keyset)
+		}
+		params = append(params, c.timestamp, c.timestamp, c.chatJID, c.id)
+		offset, page.Page = 0, 0
+	}
+
+	// Fetch one extra message to tell whether there are more
+	queryParts = append(queryParts, "ORDER BY messages.timestamp DESC, messages.chat_jid DESC, messages.id DESC")
 	queryParts = append(queryParts, "LIMIT ? OFFSET ?")
-	params = append(params, opts.Limit, offset)
+	params = append(params, opts.Limit+1, offset)
 
-	rows, err := s.MsgDB.Query(strings.Join(queryParts, " "), params...)
+	rows, err := s.MsgDB.Query("SELECT "+messageColumns+" "+strings.Join(queryParts, " "), params...)
 	if err != nil {
-		return nil, fmt.Errorf("list messages query: %w", err)
+		return nil, PageInfo{}, fmt.Errorf("list messages query: %w", err)
 	}
 	defer rows.Close()
 
 	var messages []rawMessage
 	for rows.Next() {
-		var m rawMessage
-		if err := rows.Scan(&m.timestamp, &m.sender, &m.chatName, &m.content,
-			&m.isFromMe, &m.chatJID, &m.id, &m.mediaType); err != nil {
-			return nil, fmt.Errorf("scan message: %w", err)
+		m, err := scanMessage(rows)
+		if err != nil {
+			return nil, PageInfo{}, fmt.Errorf("scan message: %w", err)
 		}
 		messages = append(messages, m)
 	}
+	if len(messages) > opts.Limit {
+		messages = messages[:opts.Limit]
+		last := messages[len(messages)-1]
+		// The cursor keeps the timestamp as stored, so the keyset compares like with like
+		c := messageCursor{chatJID: last.chatJID, id: last.id}
+		if err := s.MsgDB.QueryRow("SELECT CAST(timestamp AS TEXT) FROM messages WHERE id = ? AND chat_jid = ?", last.id, last.chatJID).Scan(&c.timestamp); err != nil {
+			return nil, PageInfo{}, fmt.Errorf("list messages cursor: %w", err)
+		}
+		page.HasMore = true
+		page.NextCursor = c.encode()
+	}
 
-	cache := s.BuildSenderCache()
+	page.Truncated = limitCapped && page.HasMore
 
+	var result []MessageDict
 	if opts.IncludeContext && len(messages) > 0 {
-		var result []MessageDict
+		// Matches always fit; context fills what is left of the budget,
+		// nearest to its match first
+		budget := -1
+		if opts.MaxTotalMessages > 0 {
+			budget = opts.MaxTotalMessages - len(messages)
+		}
 		seen := make(map[string]bool)
+		keep := func(m rawMessage) bool {
+			if seen[m.id] {
+				return false
+			}
+			if budget == 0 {
+				page.Truncated = true
+				return false
+			}
+			if budget > 0 {
+				budget--
+			}
+			seen[m.id] = true
+			return true
+		}
 		for _, msg := range messages {
-			ctx, err := s.getMessageContextRaw(msg.id, opts.ContextBefore, opts.ContextAfter)
-			if err != nil {
-				continue
+			beforeMsgs, afterMsgs := s.messageContext(msg, opts.ContextBefore, opts.ContextAfter)
+			first := len(beforeMsgs)
+			for first > 0 && keep(beforeMsgs[first-1]) {
+				first--
+			}
+			for _, m := range beforeMsgs[first:] {
+				result = append(result, rawToDict(m))
 			}
-			for _, m := range ctx {
-				if !seen[m.id] {
-					seen[m.id] = true
-					result = append(result, rawToDict(m, cache))
+			if !seen[msg.id] {
+				seen[msg.id] = true
+				result = append(result, rawToDict(msg))
+			}
+			for _, m := range afterMsgs {
+				if !keep(m) {
+					break
 				}
+				result = append(result, rawToDict(m))
 			}
 		}
-		return result, nil
+	} else {
+		result = make([]MessageDict, 0, len(messages))
+		for _, m := range messages {
+			result = append(result, rawToDict(m))
+		}
 	}
-
-	result := make([]MessageDict, 0, len(messages))
-	for _, m := range messages {
-		result = append(result, rawToDict(m, cache))
+	if opts.MaxChars > 0 && truncateText(result, opts.MaxChars) {
+		page.Truncated = true
 	}
-	return result, nil
+	return result, page, nil
 }
 
-// getMessageContextRaw returns before + target + after as raw messages.
-func (s *Store) getMessageContextRaw(messageID string, before, after int) ([]rawMessage, error) {
-	// Get target message
-	var target rawMessage
-	var chatJID string
-	err := s.MsgDB.QueryRow(
-		`SELECT messages.timestamp, messages.sender, chats.name, messages.content,
-		 messages.is_from_me, chats.jid, messages.id, messages.chat_jid, messages.media_type
-		 FROM messages JOIN chats ON messages.chat_jid = chats.jid
-		 WHERE messages.id = ?`, messageID,
-	).Scan(&target.timestamp, &target.sender, &target.chatName, &target.content,
-		&target.isFromMe, &target.chatJID, &target.id, &chatJID, &target.mediaType)
-	if err != nil {
-		return nil, fmt.Errorf("message %s not found: %w", messageID, err)
+// truncateText cuts the content and transcripts of messages, in order, so
+// together they are at most maxChars characters; messages past the budget
+// keep no text. Returns whether anything was cut.
+func truncateText(messages []MessageDict, maxChars int) bool {
+	remaining := maxChars
+	fit := func(text string) (string, bool) {
+		runes := []rune(text)
+		if len(runes) <= remaining {
+			remaining -= len(runes)
+			return text, false
+		}
+		kept := string(runes[:remaining])
+		remaining = 0
+		if kept == "" {
+			return "", true
+		}
+		return kept + "…", true
+	}
+	truncated := false
+	for i := range messages {
+		m := &messages[i]
+		var contentCut, transcriptCut bool
+		m.Content, contentCut = fit(m.Content)
+		if m.Transcript != nil {
+			var t string
+			t, transcriptCut = fit(*m.Transcript)
+			m.Transcript = &t
+		}
+		m.TextTruncated = contentCut || transcriptCut
+		truncated = truncated || m.TextTruncated
 	}
+	return truncated
+}
 
-	var result []rawMessage
-
-	// Messages before
+// messageContext returns up to before and after messages surrounding target
+// in its chat, each oldest first. Both are range scans of the chat's
+// (chat_jid, timestamp) index.
+func (s *Store) messageContext(target rawMessage, before, after int) (beforeMsgs, afterMsgs []rawMessage) {
 	rows, err := s.MsgDB.Query(
-		`SELECT messages.timestamp, messages.sender, chats.name, messages.content,
-		 messages.is_from_me, chats.jid, messages.id, messages.media_type
+		`SELECT `+messageColumns+`
 		 FROM messages JOIN chats ON messages.chat_jid = chats.jid
 		 WHERE messages.chat_jid = ? AND messages.timestamp < ?
 		 ORDER BY messages.timestamp DESC LIMIT ?`,
-		chatJID, target.timestamp, before,
+		target.chatJID, target.timestamp, before,
 	)
 	if err == nil {
-		defer rows.Close()
-		var beforeMsgs []rawMessage
 		for rows.Next() {
-			var m rawMessage
-			rows.Scan(&m.timestamp, &m.sender, &m.chatName, &m.content,
-				&m.isFromMe, &m.chatJID, &m.id, &m.mediaType)
+			m, _ := scanMessage(rows)
 			beforeMsgs = append(beforeMsgs, m)
 		}
+		rows.Close()
 		// Reverse to chronological order
-		for i := len(beforeMsgs) - 1; i >= 0; i-- {
-			result = append(result, beforeMsgs[i])
+		for i, j := 0, len(beforeMsgs)-1; i < j; i, j = i+1, j-1 {
+			beforeMsgs[i], beforeMsgs[j] = beforeMsgs[j], beforeMsgs[i]
 		}
 	}
 
-	result = append(result, target)
-
-	// Messages after
-	rows2, err := s.MsgDB.Query(
-		`SELECT messages.timestamp, messages.sender, chats.name, messages.content,
-		 messages.is_from_me, chats.jid, messages.id, messages.media_type
+	rows, err = s.MsgDB.Query(
+		`SELECT `+messageColumns+`
 		 FROM messages JOIN chats ON messages.chat_jid = chats.jid
 		 WHERE messages.chat_jid = ? AND messages.timestamp > ?
 		 ORDER BY messages.timestamp ASC LIMIT ?`,
-		chatJID, target.timestamp, after,
+		target.chatJID, target.timestamp, after,
 	)
 	if err == nil {
-		defer rows2.Close()
-		for rows2.Next() {
-			var m rawMessage
-			rows2.Scan(&m.timestamp, &m.sender, &m.chatName, &m.content,
-				&m.isFromMe, &m.chatJID, &m.id, &m.mediaType)
-			result = append(result, m)
+		for rows.Next() {
+			m, _ := scanMessage(rows)
+			afterMsgs = append(afterMsgs, m)
 		}
+		rows.Close()
 	}
-
-	return result, nil
+	return beforeMsgs, afterMsgs
 }
 
 // GetMessageContext returns a message with surrounding context as structured dicts.
@@ -390,81 +767,34 @@ func (s *Store) GetMessageContext(messageID string, before, after int) (*Message
 		after = 5
 	}
 
-	// Get target
-	var target rawMessage
-	var chatJID string
-	err := s.MsgDB.QueryRow(
-		`SELECT messages.timestamp, messages.sender, chats.name, messages.content,
-		 messages.is_from_me, chats.jid, messages.id, messages.chat_jid, messages.media_type
+	target, err := scanMessage(s.MsgDB.QueryRow(
+		`SELECT `+messageColumns+`
 		 FROM messages JOIN chats ON messages.chat_jid = chats.jid
 		 WHERE messages.id = ?`, messageID,
-	).Scan(&target.timestamp, &target.sender, &target.chatName, &target.content,
-		&target.isFromMe, &target.chatJID, &target.id, &chatJID, &target.mediaType)
+	))
 	if err != nil {
 		return nil, fmt.Errorf("message %s not found: %w", messageID, err)
 	}
 
-	cache := s.BuildSenderCache()
+	beforeMsgs, afterMsgs := s.messageContext(target, before, after)
 	result := &MessageContextDict{
-		Message: rawToDict(target, cache),
+		Message: rawToDict(target),
+		Before:  make([]MessageDict, 0, len(beforeMsgs)),
+		After:   make([]MessageDict, 0, len(afterMsgs)),
 	}
-
-	// Before
-	rows, err := s.MsgDB.Query(
-		`SELECT messages.timestamp, messages.sender, chats.name, messages.content,
-		 messages.is_from_me, chats.jid, messages.id, messages.media_type
-		 FROM messages JOIN chats ON messages.chat_jid = chats.jid
-		 WHERE messages.chat_jid = ? AND messages.timestamp < ?
-		 ORDER BY messages.timestamp DESC LIMIT ?`,
-		chatJID, target.timestamp, before,
-	)
-	if err == nil {
-		defer rows.Close()
-		var beforeMsgs []MessageDict
-		for rows.Next() {
-			var m rawMessage
-			rows.Scan(&m.timestamp, &m.sender, &m.chatName, &m.content,
-				&m.isFromMe, &m.chatJID, &m.id, &m.mediaType)
-			beforeMsgs = append(beforeMsgs, rawToDict(m, cache))
-		}
-		// Reverse to chronological order
-		for i, j := 0, len(beforeMsgs)-1; i < j; i, j = i+1, j-1 {
-			beforeMsgs[i], beforeMsgs[j] = beforeMsgs[j], beforeMsgs[i]
-		}
-		result.Before = beforeMsgs
+	for _, m := range beforeMsgs {
+		result.Before = append(result.Before, rawToDict(m))
 	}
-	if result.Before == nil {
-		result.Before = []MessageDict{}
+	for _, m := range afterMsgs {
+		result.After = append(result.After, rawToDict(m))
 	}
-
-	// After
-	rows2, err := s.MsgDB.Query(
-		`SELECT messages.timestamp, messages.sender, chats.name, messages.content,
-		 messages.is_from_me, chats.jid, messages.id, messages.media_type
-		 FROM messages JOIN chats ON messages.chat_jid = chats.jid
-		 WHERE messages.chat_jid = ? AND messages.timestamp > ?
-		 ORDER BY messages.timestamp ASC LIMIT ?`,
-		chatJID, target.timestamp, after,
-	)
-	if err == nil {
-		defer rows2.Close()
-		for rows2.Next() {
-			var m rawMessage
-			rows2.Scan(&m.timestamp, &m.sender, &m.chatName, &m.content,
-				&m.isFromMe, &m.chatJID, &m.id, &m.mediaType)
-			result.After = append(result.After, rawToDict(m, cache))
-		}
-	}
-	if result.After == nil {
-		result.After = []MessageDict{}
-	}
-
 	return result, nil
 }
 
 // ListChatsOpts holds parameters for ListChats.
 type ListChatsOpts struct {
 	Query              *string
+	LabelID            *string // only chats with this label
 	Limit              int
 	Page               int
 	IncludeLastMessage bool
@@ -472,7 +802,7 @@ type ListChatsOpts struct {
 }
 
 // ListChats returns chats matching the criteria.
-func (s *Store) ListChats(opts ListChatsOpts) ([]ChatDict, error) {
+func (s *Store) ListChats(opts ListChatsOpts) ([]ChatDict, PageInfo, error) {
 	if opts.Limit == 0 {
 		opts.Limit = 20
 	}
@@ -480,18 +810,9 @@ func (s *Store) ListChats(opts ListChatsOpts) ([]ChatDict, error) {
 		opts.SortBy = "last_active"
 	}
 
-	queryParts := []string{
-		`SELECT chats.jid, chats.name, chats.last_message_time,
-		 messages.content, messages.sender, messages.is_from_me
-		 FROM chats`,
-	}
-
-	if opts.IncludeLastMessage {
-		queryParts = append(queryParts,
-			`LEFT JOIN messages ON chats.jid = messages.chat_jid
-			 AND chats.last_message_time = messages.timestamp`)
-	}
-
+	// Select the page of chats first, so the last message and unread count
+	// are only looked up for the chats returned
+	pageParts := []string{"SELECT * FROM chats"}
 	var whereClauses []string
 	var params []any
 
@@ -500,65 +821,125 @@ func (s *Store) ListChats(opts ListChatsOpts) ([]ChatDict, error) {
 		q := "%" + *opts.Query + "%"
 		params = append(params, q, q)
 	}
+	if opts.LabelID != nil {
+		whereClauses = append(whereClauses, "chats.jid IN (SELECT chat_jid FROM chat_labels WHERE label_id = ?)")
+		params = append(params, *opts.LabelID)
+	}
 
 	if len(whereClauses) > 0 {
-		queryParts = append(queryParts, "WHERE "+strings.Join(whereClauses, " AND "))
+		pageParts = append(pageParts, "WHERE "+strings.Join(whereClauses, " AND "))
 	}
 
+	var total int
+	countQuery := "SELECT COUNT(*) FROM chats " + strings.Join(pageParts[1:], " ")
+	if err := s.MsgDB.QueryRow(countQuery, params...).Scan(&total); err != nil {
+		return nil, PageInfo{}, fmt.Errorf("count chats: %w", err)
+	}
+	page := newPageInfo(total, opts.Page, opts.Limit)
+
+	orderBy := "ORDER BY chats.name"
 	if opts.SortBy == "last_active" {
-		queryParts = append(queryParts, "ORDER BY chats.last_message_time DESC")
-	} else {
-		queryParts = append(queryParts, "ORDER BY chats.name")
+		orderBy = "ORDER BY chats.pinned DESC, chats.last_message_time DESC"
 	}
 
 	offset := opts.Page * opts.Limit
-	queryParts = append(queryParts, "LIMIT ? OFFSET ?")
+	pageParts = append(pageParts, orderBy, "LIMIT ? OFFSET ?")
 	params = append(params, opts.Limit, offset)
 
-	rows, err := s.MsgDB.Query(strings.Join(queryParts, " "), params...)
+	query := `SELECT chats.jid, chats.name, chats.last_message_time,
+		 wahoo_decrypt(messages.content), messages.sender, messages.is_from_me, messages.sender_name, ` + chatStateColumns + `
+		 FROM (` + strings.Join(pageParts, " ") + `) AS chats
+		 LEFT JOIN messages ON chats.jid = messages.chat_jid
+		 AND chats.last_message_time = messages.timestamp ` + orderBy
+
+	rows, err := s.MsgDB.Query(query, params...)
 	if err != nil {
-		return nil, fmt.Errorf("list chats query: %w", err)
+		return nil, PageInfo{}, fmt.Errorf("list chats query: %w", err)
 	}
 	defer rows.Close()
 
-	cache := s.BuildSenderCache()
 	var result []ChatDict
 
 	for rows.Next() {
 		var r rawChat
-		if err := rows.Scan(&r.jid, &r.name, &r.lastTime, &r.lastMsg, &r.lastSender, &r.lastIsFromMe); err != nil {
-			return nil, fmt.Errorf("scan chat: %w", err)
+		if err := rows.Scan(r.scanDest()...); err != nil {
+			return nil, PageInfo{}, fmt.Errorf("scan chat: %w", err)
+		}
+		if !opts.IncludeLastMessage {
+			r.clearLastMessage()
 		}
-		result = append(result, r.toDict(cache))
+		result = append(result, r.toDict())
 	}
 
 	if result == nil {
 		result = []ChatDict{}
 	}
-	return result, nil
+	return result, page, nil
+}
+
+// ListUnreadChats returns chats with unread incoming messages, most unread first,
+// then most recently active. The page info counts all chats with unread messages.
+func (s *Store) ListUnreadChats(limit int) ([]ChatDict, PageInfo, error) {
+	if limit == 0 {
+		limit = 20
+	}
+	rows, err := s.MsgDB.Query(
+		`SELECT *, COUNT(*) OVER () FROM (
+		   SELECT chats.jid, chats.name, chats.last_message_time,
+		     wahoo_decrypt(messages.content), messages.sender, messages.is_from_me, messages.sender_name, `+chatStateColumns+` AS unread_count
+		   FROM chats
+		   LEFT JOIN messages ON chats.jid = messages.chat_jid AND chats.last_message_time = messages.timestamp
+		 ) WHERE unread_count > 0 -- the unread count is the last chat state column
+		 ORDER BY unread_count DESC, last_message_time DESC
+		 LIMIT ?`, limit)
+	if err != nil {
+		return nil, PageInfo{}, fmt.Errorf("list unread chats query: %w", err)
+	}
+	defer rows.Close()
+
+	result := []ChatDict{}
+	var total int
+	for rows.Next() {
+		var r rawChat
+		if err := rows.Scan(append(r.scanDest(), &total)...); err != nil {
+			return nil, PageInfo{}, fmt.Errorf("scan chat: %w", err)
+		}
+		result = append(result, r.toDict())
+	}
+	return result, newPageInfo(total, 0, limit), rows.Err()
 }
 
-// SearchContacts searches for contacts by name or phone number.
-func (s *Store) SearchContacts(query string) ([]ContactDict, error) {
+// SearchContacts searches for contacts by name, alias or phone number.
+func (s *Store) SearchContacts(query string, limit, page int) ([]ContactDict, PageInfo, error) {
+	if limit == 0 {
+		limit = 50
+	}
 	pattern := "%" + query + "%"
+	const from = `FROM chats LEFT JOIN contact_aliases ON contact_aliases.jid = chats.jid
+		WHERE (LOWER(chats.name) LIKE LOWER(?) OR LOWER(chats.jid) LIKE LOWER(?) OR LOWER(contact_aliases.alias) LIKE LOWER(?))
+		AND chats.jid NOT LIKE '%@g.us'`
+
+	var total int
+	if err := s.MsgDB.QueryRow("SELECT COUNT(*) "+from, pattern, pattern, pattern).Scan(&total); err != nil {
+		return nil, PageInfo{}, fmt.Errorf("count contacts: %w", err)
+	}
+
 	rows, err := s.MsgDB.Query(`
-		SELECT DISTINCT jid, name FROM chats
-		WHERE (LOWER(name) LIKE LOWER(?) OR LOWER(jid) LIKE LOWER(?))
-		AND jid NOT LIKE '%@g.us'
-		ORDER BY name, jid
-		LIMIT 50`,
-		pattern, pattern,
+		SELECT chats.jid, chats.name, contact_aliases.alias `+from+`
+		ORDER BY COALESCE(contact_aliases.alias, chats.name), chats.jid
+		LIMIT ? OFFSET ?`,
+		pattern, pattern, pattern, limit, page*limit,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("search contacts: %w", err)
+		return nil, PageInfo{}, fmt.Errorf("search contacts: %w", err)
 	}
 	defer rows.Close()
 
 	var result []ContactDict
 	for rows.Next() {
 		var jid string
-		var name sql.NullString
-		if err := rows.Scan(&jid, &name); err != nil {
+		var name, alias sql.NullString
+		if err := rows.Scan(&jid, &name, &alias); err != nil {
 			continue
 		}
 		phone := jid
@@ -572,52 +953,59 @@ func (s *Store) SearchContacts(query string) ([]ContactDict, error) {
 		if name.Valid {
 			d.Name = &name.String
 		}
+		if alias.Valid {
+			d.Alias = &alias.String
+		}
+		if changedAt, ok := s.RecentSecurityChange(jid); ok {
+			d.SecurityCodeChangedAt = &changedAt
+		}
 		result = append(result, d)
 	}
 
 	if result == nil {
 		result = []ContactDict{}
 	}
-	return result, nil
+	return result, newPageInfo(total, page, limit), nil
 }
 
 // GetChat returns a single chat by JID.
 func (s *Store) GetChat(chatJID string, includeLastMessage bool) (*ChatDict, error) {
-	q := `SELECT c.jid, c.name, c.last_message_time,
-		  m.content, m.sender, m.is_from_me
-		  FROM chats c`
-
-	if includeLastMessage {
-		q += ` LEFT JOIN messages m ON c.jid = m.chat_jid
-			   AND c.last_message_time = m.timestamp`
-	}
-	q += " WHERE c.jid = ?"
+	q := `SELECT chats.jid, chats.name, chats.last_message_time,
+		  wahoo_decrypt(messages.content), messages.sender, messages.is_from_me, messages.sender_name, ` + chatStateColumns + `
+		  FROM chats
+		  LEFT JOIN messages ON chats.jid = messages.chat_jid AND chats.last_message_time = messages.timestamp
+		  WHERE chats.jid = ?`
 
 	var r rawChat
-	err := s.MsgDB.QueryRow(q, chatJID).Scan(&r.jid, &r.name, &r.lastTime, &r.lastMsg, &r.lastSender, &r.lastIsFromMe)
+	err := s.MsgDB.QueryRow(q, chatJID).Scan(r.scanDest()...)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, fmt.Errorf("get chat: %w", err)
 	}
+	if !includeLastMessage {
+		r.clearLastMessage()
+	}
 
-	cache := s.BuildSenderCache()
-	d := r.toDict(cache)
+	d := r.toDict()
+	if d.Profile, err = s.GetChatProfile(chatJID); err != nil {
+		return nil, err
+	}
 	return &d, nil
 }
 
 // GetDirectChatByContact finds a direct chat by phone number.
 func (s *Store) GetDirectChatByContact(phoneNumber string) (*ChatDict, error) {
-	q := `SELECT c.jid, c.name, c.last_message_time,
-		  m.content, m.sender, m.is_from_me
-		  FROM chats c
-		  LEFT JOIN messages m ON c.jid = m.chat_jid AND c.last_message_time = m.timestamp
-		  WHERE c.jid LIKE ? AND c.jid NOT LIKE '%@g.us'
+	q := `SELECT chats.jid, chats.name, chats.last_message_time,
+		  wahoo_decrypt(messages.content), messages.sender, messages.is_from_me, messages.sender_name, ` + chatStateColumns + `
+		  FROM chats
+		  LEFT JOIN messages ON chats.jid = messages.chat_jid AND chats.last_message_time = messages.timestamp
+		  WHERE chats.jid LIKE ? AND chats.jid NOT LIKE '%@g.us'
 		  LIMIT 1`
 
 	var r rawChat
-	err := s.MsgDB.QueryRow(q, "%"+phoneNumber+"%").Scan(&r.jid, &r.name, &r.lastTime, &r.lastMsg, &r.lastSender, &r.lastIsFromMe)
+	err := s.MsgDB.QueryRow(q, "%"+phoneNumber+"%").Scan(r.scanDest()...)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -625,61 +1013,146 @@ func (s *Store) GetDirectChatByContact(phoneNumber string) (*ChatDict, error) {
 		return nil, fmt.Errorf("get direct chat: %w", err)
 	}
 
-	cache := s.BuildSenderCache()
-	d := r.toDict(cache)
+	d := r.toDict()
 	return &d, nil
 }
 
 // GetContactChats returns all chats involving a contact.
-func (s *Store) GetContactChats(jid string, limit, page int) ([]ChatDict, error) {
+func (s *Store) GetContactChats(jid string, limit, page int) ([]ChatDict, PageInfo, error) {
 	if limit == 0 {
 		limit = 20
 	}
 
-	rows, err := s.MsgDB.Query(`
-		SELECT DISTINCT c.jid, c.name, c.last_message_time,
-		 m.content, m.sender, m.is_from_me
-		FROM chats c
-		JOIN messages m ON c.jid = m.chat_jid
-		WHERE m.sender = ? OR c.jid = ?
-		ORDER BY c.last_message_time DESC
+	jids := s.LinkedJIDs(jid)
+	in := placeholders(len(jids))
+	query := `SELECT DISTINCT chats.jid, chats.name, chats.last_message_time,
+		 wahoo_decrypt(messages.content), messages.sender, messages.is_from_me, messages.sender_name, ` + chatStateColumns + `
+		FROM chats
+		JOIN messages ON chats.jid = messages.chat_jid
+		WHERE messages.sender IN (` + in + `) OR chats.jid IN (` + in + `)`
+
+	var total int
+	if err := s.MsgDB.QueryRow("SELECT COUNT(*) FROM ("+query+")", repeatArgs(jids, 2)...).Scan(&total); err != nil {
+		return nil, PageInfo{}, fmt.Errorf("count contact chats: %w", err)
+	}
+
+	params := append(repeatArgs(jids, 2), limit, page*limit)
+	rows, err := s.MsgDB.Query(query+`
+		ORDER BY chats.last_message_time DESC
 		LIMIT ? OFFSET ?`,
-		jid, jid, limit, page*limit,
+		params...,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("get contact chats: %w", err)
+		return nil, PageInfo{}, fmt.Errorf("get contact chats: %w", err)
 	}
 	defer rows.Close()
 
-	cache := s.BuildSenderCache()
 	var result []ChatDict
 
 	for rows.Next() {
 		var r rawChat
-		if err := rows.Scan(&r.jid, &r.name, &r.lastTime, &r.lastMsg, &r.lastSender, &r.lastIsFromMe); err != nil {
+		if err := rows.Scan(r.scanDest()...); err != nil {
 			continue
 		}
-		result = append(result, r.toDict(cache))
+		result = append(result, r.toDict())
 	}
 
 	if result == nil {
 		result = []ChatDict{}
 	}
-	return result, nil
+	return result, newPageInfo(total, page, limit), nil
+}
+
+// GetMessage returns a single message, or nil if it is not stored.
+func (s *Store) GetMessage(messageID, chatJID string) (*MessageDict, error) {
+	m, err := s.getMessage(messageID, chatJID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get message: %w", err)
+	}
+
+	d := rawToDict(m)
+	return &d, nil
+}
+
+// MessageKey identifies a stored message to WhatsApp.
+type MessageKey struct {
+	ID        string
+	IsFromMe  bool
+	Timestamp time.Time
+}
+
+// HistoryAnchor returns the key of messageID in chatJID, or of the chat's
+// oldest stored message if messageID is empty. It returns nil if there is
+// no such message.
+func (s *Store) HistoryAnchor(chatJID, messageID string) (*MessageKey, error) {
+	var row *sql.Row
+	if messageID == "" {
+		row = s.MsgDB.QueryRow(
+			`SELECT id, is_from_me, timestamp FROM messages WHERE chat_jid = ? ORDER BY timestamp LIMIT 1`, chatJID)
+	} else {
+		row = s.MsgDB.QueryRow(
+			`SELECT id, is_from_me, timestamp FROM messages WHERE chat_jid = ? AND id = ?`, chatJID, messageID)
+	}
+	var k MessageKey
+	err := row.Scan(&k.ID, &k.IsFromMe, &k.Timestamp)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get history anchor: %w", err)
+	}
+	return &k, nil
+}
+
+// HistoryAnchorAt returns the key of the oldest message of chatJID stored at
+// or after t, so history requested before it reaches back from t. If all
+// stored messages are older, the newest is returned; nil if there are none.
+func (s *Store) HistoryAnchorAt(chatJID string, t time.Time) (*MessageKey, error) {
+	var k MessageKey
+	err := s.MsgDB.QueryRow(
+		`SELECT id, is_from_me, timestamp FROM messages WHERE chat_jid = ? AND timestamp >= ? ORDER BY timestamp LIMIT 1`,
+		chatJID, t,
+	).Scan(&k.ID, &k.IsFromMe, &k.Timestamp)
+	if err == sql.ErrNoRows {
+		err = s.MsgDB.QueryRow(
+			`SELECT id, is_from_me, timestamp FROM messages WHERE chat_jid = ? ORDER BY timestamp DESC LIMIT 1`, chatJID,
+		).Scan(&k.ID, &k.IsFromMe, &k.Timestamp)
+	}
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get history anchor: %w", err)
+	}
+	return &k, nil
+}
+
+// CountChatMessages returns how many messages of a chat are stored.
+func (s *Store) CountChatMessages(chatJID string) (int, error) {
+	var n int
+	if err := s.MsgDB.QueryRow("SELECT COUNT(*) FROM messages WHERE chat_jid = ?", chatJID).Scan(&n); err != nil {
+		return 0, fmt.Errorf("count messages: %w", err)
+	}
+	return n, nil
 }
 
 // GetLastInteraction returns the most recent message involving a contact.
 func (s *Store) GetLastInteraction(jid string) (*MessageDict, error) {
-	var m rawMessage
-	err := s.MsgDB.QueryRow(`
-		SELECT m.timestamp, m.sender, c.name, m.content, m.is_from_me, c.jid, m.id, m.media_type
-		FROM messages m
-		JOIN chats c ON m.chat_jid = c.jid
-		WHERE m.sender = ? OR c.jid = ?
-		ORDER BY m.timestamp DESC LIMIT 1`,
-		jid, jid,
-	).Scan(&m.timestamp, &m.sender, &m.chatName, &m.content,
-		&m.isFromMe, &m.chatJID, &m.id, &m.mediaType)
+	jids := s.LinkedJIDs(jid)
+	in := placeholders(len(jids))
+	params := repeatArgs(jids, 2)
+
+	m, err := scanMessage(s.MsgDB.QueryRow(`
+		SELECT `+messageColumns+`
+		FROM messages
+		JOIN chats ON messages.chat_jid = chats.jid
+		WHERE messages.sender IN (`+in+`) OR chats.jid IN (`+in+`)
+		ORDER BY messages.timestamp DESC LIMIT 1`,
+		params...,
+	))
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -688,8 +1161,6 @@ func (s *Store) GetLastInteraction(jid string) (*MessageDict, error) {
 		return nil, fmt.Errorf("get last interaction: %w", err)
 	}
 
-	cache := s.BuildSenderCache()
-	d := rawToDict(m, cache)
+	d := rawToDict(m)
 	return &d, nil
 }
-
@@ -0,0 +1,227 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// phoneNumberPattern matches phone numbers of 7 to 15 digits written with
+// optional +, spaces, dashes, dots or parentheses, as well as the user part of
+// phone JIDs. Dates are excluded by datePattern.
+var (
+	phoneNumberPattern = regexp.MustCompile(`\+?\d(?:[\s().-]?\d){6,14}`)
+	datePattern        = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}`)
+)
+
+// RedactionProfile describes what to remove from chat data before it leaves
+// wahoo, e.g. in an export handed to someone outside the conversation.
+type RedactionProfile struct {
+	Name             string   `json:"name"`
+	StripMedia       bool     `json:"strip_media,omitempty"`       // drop media, locations and contact cards
+	MaskNumbers      bool     `json:"mask_numbers,omitempty"`      // mask phone numbers in senders, JIDs and text
+	DropParticipants []string `json:"drop_participants,omitempty"` // phone numbers or JIDs whose messages are removed
+}
+
+// SaveRedactionProfile creates or replaces a redaction profile.
+func (s *Store) SaveRedactionProfile(p RedactionProfile) error {
+	_, err := s.MsgDB.Exec(
+		`INSERT OR REPLACE INTO redaction_profiles (name, strip_media, mask_numbers, drop_participants, created_at)
+		 VALUES (?, ?, ?, ?, ?)`,
+		p.Name, p.StripMedia, p.MaskNumbers, strings.Join(p.DropParticipants, "\n"), time.Now(),
+	)
+	return err
+}
+
+// DeleteRedactionProfile removes a profile. Returns false if it did not exist.
+func (s *Store) DeleteRedactionProfile(name string) (bool, error) {
+	res, err := s.MsgDB.Exec("DELETE FROM redaction_profiles WHERE name = ?", name)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// GetRedactionProfile returns a profile by name, or nil if it does not exist.
+func (s *Store) GetRedactionProfile(name string) (*RedactionProfile, error) {
+	p := RedactionProfile{Name: name}
+	var dropped string
+	err := s.MsgDB.QueryRow(
+		"SELECT strip_media, mask_numbers, drop_participants FROM redaction_profiles WHERE name = ?", name,
+	).Scan(&p.StripMedia, &p.MaskNumbers, &dropped)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get redaction profile: %w", err)
+	}
+	if dropped != "" {
+		p.DropParticipants = strings.Split(dropped, "\n")
+	}
+	return &p, nil
+}
+
+// ListRedactionProfiles returns all redaction profiles ordered by name.
+func (s *Store) ListRedactionProfiles() ([]RedactionProfile, error) {
+	rows, err := s.MsgDB.Query("SELECT name, strip_media, mask_numbers, drop_participants FROM redaction_profiles ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("list redaction profiles: %w", err)
+	}
+	defer rows.Close()
+
+	result := []RedactionProfile{}
+	for rows.Next() {
+		var p RedactionProfile
+		var dropped string
+		if err := rows.Scan(&p.Name, &p.StripMedia, &p.MaskNumbers, &dropped); err != nil {
+			continue
+		}
+		if dropped != "" {
+			p.DropParticipants = strings.Split(dropped, "\n")
+		}
+		result = append(result, p)
+	}
+	return result, nil
+}
+
+// maskNumber keeps the last two digits of a phone number and masks the rest.
+func maskNumber(number string) string {
+	digits := 0
+	for _, r := range number {
+		if r >= '0' && r <= '9' {
+			digits++
+		}
+	}
+	var b strings.Builder
+	seen := 0
+	for _, r := range number {
+		if r >= '0' && r <= '9' {
+			seen++
+			if seen <= digits-2 {
+				r = '•'
+			}
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// maskNumbers masks every phone number in text.
+func maskNumbers(text string) string {
+	return phoneNumberPattern.ReplaceAllStringFunc(text, func(number string) string {
+		if datePattern.MatchString(number) {
+			return number
+		}
+		return maskNumber(number)
+	})
+}
+
+// Redactor applies a redaction profile to chat data. Create one with
+// Store.Redactor so dropped participants are matched under all their linked JIDs.
+type Redactor struct {
+	profile RedactionProfile
+	dropped map[string]bool
+}
+
+// Redactor prepares a redactor for a profile.
+func (s *Store) Redactor(p RedactionProfile) *Redactor {
+	r := &Redactor{profile: p, dropped: map[string]bool{}}
+	for _, participant := range p.DropParticipants {
+		participant = strings.TrimPrefix(strings.TrimSpace(participant), "+")
+		for _, j := range s.LinkedJIDs(participant) {
+			r.dropped[j] = true
+		}
+	}
+	return r
+}
+
+// Messages returns the messages that survive the profile, redacted.
+func (r *Redactor) Messages(messages []MessageDict) []MessageDict {
+	result := make([]MessageDict, 0, len(messages))
+	for _, m := range messages {
+		if !m.IsFromMe && r.dropped[m.SenderJID] {
+			continue
+		}
+		if m.QuotedSender != nil && r.dropped[*m.QuotedSender] {
+			m.QuotedSender = nil
+		}
+		if len(m.MentionedJIDs) > 0 {
+			var kept []string
+			for _, jid := range m.MentionedJIDs {
+				if !r.dropped[jid] {
+					kept = append(kept, jid)
+				}
+			}
+			m.MentionedJIDs = kept
+		}
+		result = append(result, r.Message(m))
+	}
+	return result
+}
+
+// Message redacts a single message. Dropped participants are not handled here;
+// use Messages to remove them.
+func (r *Redactor) Message(m MessageDict) MessageDict {
+	if r.profile.StripMedia {
+		if m.Content == "" && m.MediaType != nil {
+			m.Content = fmt.Sprintf("[%s omitted]", *m.MediaType)
+		}
+		if m.VCard != nil {
+			m.Content = "[contact card omitted]"
+		}
+		m.MediaType, m.LocalPath, m.Location, m.VCard = nil, nil, nil, nil
+	}
+	if r.profile.MaskNumbers {
+		m.Content = maskNumbers(m.Content)
+		m.Sender = maskNumbers(m.Sender)
+		m.SenderJID = maskNumbers(m.SenderJID)
+		m.ChatJID = maskNumbers(m.ChatJID)
+		if m.ChatName != nil {
+			name := maskNumbers(*m.ChatName)
+			m.ChatName = &name
+		}
+		if m.VCard != nil {
+			vcard := maskNumbers(*m.VCard)
+			m.VCard = &vcard
+		}
+		if m.QuotedSender != nil {
+			sender := maskNumbers(*m.QuotedSender)
+			m.QuotedSender = &sender
+		}
+		if m.Transcript != nil {
+			transcript := maskNumbers(*m.Transcript)
+			m.Transcript = &transcript
+		}
+		if len(m.MentionedJIDs) > 0 {
+			masked := make([]string, len(m.MentionedJIDs))
+			for i, jid := range m.MentionedJIDs {
+				masked[i] = maskNumbers(jid)
+			}
+			m.MentionedJIDs = masked
+		}
+	}
+	return m
+}
+
+// Chat redacts the identifying fields of a chat.
+func (r *Redactor) Chat(c ChatDict) ChatDict {
+	if r.profile.MaskNumbers {
+		c.JID = maskNumbers(c.JID)
+		if c.Name != nil {
+			name := maskNumbers(*c.Name)
+			c.Name = &name
+		}
+		if c.LastSender != nil {
+			sender := maskNumbers(*c.LastSender)
+			c.LastSender = &sender
+		}
+		if c.LastMessage != nil {
+			msg := maskNumbers(*c.LastMessage)
+			c.LastMessage = &msg
+		}
+	}
+	return c
+}
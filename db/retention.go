@@ -0,0 +1,141 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// PurgeOpts selects the messages PurgeMessages deletes. Dates are compared
+// like the list_messages filters.
+type PurgeOpts struct {
+	ChatJID string
+	After   string
+	Before  string
+}
+
+// PurgeResult is the outcome of deleting stored messages.
+type PurgeResult struct {
+	Messages   int
+	MediaPaths []string // downloaded media of the deleted messages
+}
+
+// SetChatRetention sets how many days a chat's messages are kept. Nil
+// removes the override, so the default retention applies; 0 keeps the
+// messages forever.
+func (s *Store) SetChatRetention(chatJID string, days *int) error {
+	_, err := s.MsgDB.Exec("UPDATE chats SET retain_days = ? WHERE jid = ?", days, chatJID)
+	return err
+}
+
+// PurgeMessages deletes the stored messages matching opts. With dryRun set
+// nothing is deleted, but the result tells what would be. The caller
+// deletes the media files listed in the result.
+func (s *Store) PurgeMessages(opts PurgeOpts, dryRun bool) (PurgeResult, error) {
+	var where []string
+	var args []any
+	if opts.ChatJID != "" {
+		where = append(where, "chat_jid = ?")
+		args = append(args, opts.ChatJID)
+	}
+	if opts.After != "" {
+		where = append(where, "timestamp > ?")
+		args = append(args, opts.After)
+	}
+	if opts.Before != "" {
+		where = append(where, "timestamp < ?")
+		args = append(args, opts.Before)
+	}
+	if len(where) == 0 {
+		return PurgeResult{}, fmt.Errorf("purge needs a chat or a date range")
+	}
+	return s.purge(strings.Join(where, " AND "), args, dryRun)
+}
+
+// ApplyRetention deletes messages older than their chat's retention: the
+// chat's own retain_days, or defaultDays for chats without an override.
+// defaultDays 0 keeps messages of those chats forever.
+func (s *Store) ApplyRetention(defaultDays int, now time.Time) (PurgeResult, error) {
+	rows, err := s.MsgDB.Query("SELECT jid, retain_days FROM chats WHERE retain_days > 0")
+	if err != nil {
+		return PurgeResult{}, fmt.Errorf("read chat retention: %w", err)
+	}
+	overrides := make(map[string]int)
+	for rows.Next() {
+		var jid string
+		var days int
+		if rows.Scan(&jid, &days) == nil {
+			overrides[jid] = days
+		}
+	}
+	rows.Close()
+
+	var total PurgeResult
+	add := func(r PurgeResult, err error) error {
+		total.Messages += r.Messages
+		total.MediaPaths = append(total.MediaPaths, r.MediaPaths...)
+		return err
+	}
+	for jid, days := range overrides {
+		if err := add(s.purge("chat_jid = ? AND timestamp < ?", []any{jid, now.AddDate(0, 0, -days)}, false)); err != nil {
+			return total, err
+		}
+	}
+	if defaultDays > 0 {
+		err := add(s.purge("timestamp < ? AND chat_jid NOT IN (SELECT jid FROM chats WHERE retain_days IS NOT NULL)",
+			[]any{now.AddDate(0, 0, -defaultDays)}, false))
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// purge deletes the messages matching where, returning their downloaded media.
+func (s *Store) purge(where string, args []any, dryRun bool) (PurgeResult, error) {
+	tx, err := s.MsgDB.Begin()
+	if err != nil {
+		return PurgeResult{}, err
+	}
+	defer tx.Rollback()
+
+	var result PurgeResult
+	rows, err := tx.Query("SELECT local_path FROM messages WHERE "+where+" AND local_path IS NOT NULL AND local_path != ''", args...)
+	if err != nil {
+		return PurgeResult{}, fmt.Errorf("purge media query: %w", err)
+	}
+	for rows.Next() {
+		var path string
+		if rows.Scan(&path) == nil {
+			result.MediaPaths = append(result.MediaPaths, path)
+		}
+	}
+	rows.Close()
+
+	if dryRun {
+		err = tx.QueryRow("SELECT COUNT(*) FROM messages WHERE "+where, args...).Scan(&result.Messages)
+		if err != nil {
+			return PurgeResult{}, fmt.Errorf("purge count: %w", err)
+		}
+		return result, nil
+	}
+
+	res, err := tx.Exec("DELETE FROM messages WHERE "+where, args...)
+	if err != nil {
+		return PurgeResult{}, fmt.Errorf("purge messages: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	result.Messages = int(n)
+	return result, tx.Commit()
+}
+
+// Vacuum rebuilds the messages database to return the space of deleted
+// rows to the file system, then truncates the write-ahead log.
+func (s *Store) Vacuum() error {
+	if _, err := s.MsgDB.Exec("VACUUM"); err != nil {
+		return fmt.Errorf("vacuum: %w", err)
+	}
+	var busy, logFrames, checkpointed sql.NullInt64
+	return s.MsgDB.QueryRow("PRAGMA wal_checkpoint(TRUNCATE)").Scan(&busy, &logFrames, &checkpointed)
+}
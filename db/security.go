@@ -0,0 +1,108 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// securityFlagWindow is how long contact results flag a contact after its
+// security code changed.
+const securityFlagWindow = 7 * 24 * time.Hour
+
+// securityEventDedup is how close together changes of the same contact's
+// security code are recorded once: WhatsApp announces a change and then
+// messages reveal it again, once per device.
+const securityEventDedup = time.Minute
+
+// SecurityEventDict is the structured output for security event queries.
+type SecurityEventDict struct {
+	JID       string `json:"jid"`
+	Name      string `json:"name"`
+	ChangedAt string `json:"changed_at"`
+	Implicit  bool   `json:"implicit,omitempty"` // noticed from a message rather than announced by WhatsApp
+}
+
+// ListSecurityEventsOpts filters the events returned by ListSecurityEvents.
+type ListSecurityEventsOpts struct {
+	Contact string
+	After   *string
+	Limit   int // default 50
+	Page    int
+}
+
+// StoreIdentityChange records that the security code of jid changed.
+func (s *Store) StoreIdentityChange(jid string, changedAt time.Time, implicit bool) error {
+	_, err := s.MsgDB.Exec(
+		`INSERT INTO security_events (jid, changed_at, implicit)
+		 SELECT ?, ?, ? WHERE NOT EXISTS (SELECT 1 FROM security_events WHERE jid = ? AND changed_at > ?)`,
+		jid, changedAt, implicit, jid, changedAt.Add(-securityEventDedup),
+	)
+	if err != nil {
+		return fmt.Errorf("store security event: %w", err)
+	}
+	return nil
+}
+
+// ListSecurityEvents returns security code changes, newest first.
+func (s *Store) ListSecurityEvents(opts ListSecurityEventsOpts) ([]SecurityEventDict, PageInfo, error) {
+	if opts.Limit == 0 {
+		opts.Limit = 50
+	}
+	var where []string
+	var params []any
+	if opts.Contact != "" {
+		contact := opts.Contact
+		if !strings.Contains(contact, "@") {
+			contact = strings.TrimPrefix(contact, "+") + "@s.whatsapp.net"
+		}
+		jids := s.contactJIDs(contact)
+		where = append(where, "jid IN ("+placeholders(len(jids))+")")
+		params = append(params, repeatArgs(jids, 1)...)
+	}
+	if opts.After != nil {
+		where = append(where, "changed_at > ?")
+		params = append(params, *opts.After)
+	}
+	filter := ""
+	if len(where) > 0 {
+		filter = " WHERE " + strings.Join(where, " AND ")
+	}
+
+	var total int
+	if err := s.MsgDB.QueryRow("SELECT COUNT(*) FROM security_events"+filter, params...).Scan(&total); err != nil {
+		return nil, PageInfo{}, fmt.Errorf("count security events: %w", err)
+	}
+
+	rows, err := s.MsgDB.Query(
+		"SELECT jid, changed_at, implicit FROM security_events"+filter+" ORDER BY changed_at DESC LIMIT ? OFFSET ?",
+		append(params, opts.Limit, opts.Page*opts.Limit)...,
+	)
+	if err != nil {
+		return nil, PageInfo{}, fmt.Errorf("list security events: %w", err)
+	}
+	defer rows.Close()
+
+	result := []SecurityEventDict{}
+	for rows.Next() {
+		var e SecurityEventDict
+		if err := rows.Scan(&e.JID, &e.ChangedAt, &e.Implicit); err != nil {
+			return nil, PageInfo{}, fmt.Errorf("scan security event: %w", err)
+		}
+		e.Name = s.ResolveName(e.JID)
+		result = append(result, e)
+	}
+	return result, newPageInfo(total, opts.Page, opts.Limit), rows.Err()
+}
+
+// RecentSecurityChange returns when the security code of the contact jid
+// last changed, if that was within securityFlagWindow.
+func (s *Store) RecentSecurityChange(jid string) (string, bool) {
+	jids := s.contactJIDs(jid)
+	var changedAt string
+	err := s.MsgDB.QueryRow(
+		"SELECT changed_at FROM security_events WHERE jid IN ("+placeholders(len(jids))+") AND changed_at > ? ORDER BY changed_at DESC LIMIT 1",
+		append(repeatArgs(jids, 1), time.Now().Add(-securityFlagWindow))...,
+	).Scan(&changedAt)
+	return changedAt, err == nil
+}
@@ -0,0 +1,60 @@
+package db
+
+import (
+	"fmt"
+	"time"
+)
+
+// Send policy actions.
+const (
+	SendAllow = "allow"
+	SendDeny  = "deny"
+)
+
+// SendPolicyRule allows or refuses sending to the recipients matching a
+// pattern (see wa.SendPolicy).
+type SendPolicyRule struct {
+	Pattern string `json:"pattern"`
+	Action  string `json:"action"` // allow or deny
+}
+
+// SetSendPolicyRule adds a rule, replacing the one for the same pattern.
+func (s *Store) SetSendPolicyRule(pattern, action string) error {
+	if action != SendAllow && action != SendDeny {
+		return fmt.Errorf("unknown send policy action %q (use allow or deny)", action)
+	}
+	_, err := s.MsgDB.Exec(
+		"INSERT OR REPLACE INTO send_policy (pattern, action, created_at) VALUES (?, ?, ?)",
+		pattern, action, time.Now(),
+	)
+	return err
+}
+
+// RemoveSendPolicyRule deletes the rule for pattern. Returns false if there is none.
+func (s *Store) RemoveSendPolicyRule(pattern string) (bool, error) {
+	res, err := s.MsgDB.Exec("DELETE FROM send_policy WHERE pattern = ?", pattern)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// ListSendPolicy returns all send policy rules ordered by pattern.
+func (s *Store) ListSendPolicy() ([]SendPolicyRule, error) {
+	rows, err := s.MsgDB.Query("SELECT pattern, action FROM send_policy ORDER BY pattern")
+	if err != nil {
+		return nil, fmt.Errorf("list send policy: %w", err)
+	}
+	defer rows.Close()
+
+	result := []SendPolicyRule{}
+	for rows.Next() {
+		var r SendPolicyRule
+		if err := rows.Scan(&r.Pattern, &r.Action); err != nil {
+			return nil, err
+		}
+		result = append(result, r)
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,233 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Send statuses tracked in the sends table.
+const (
+	SendPending   = "pending"
+	SendQueued    = "queued" // waiting for a connection
+	SendSent      = "sent"
+	SendFailed    = "failed"    // will be retried
+	SendAbandoned = "abandoned" // gave up after too many attempts
+	SendCancelled = "cancelled"
+	// SendUnconfirmed marks a send that timed out: it may have been delivered,
+	// so it is never retried automatically.
+	SendUnconfirmed = "unconfirmed"
+)
+
+// SendDict is the structured output for send status queries.
+type SendDict struct {
+	ID            int64    `json:"send_id"`
+	Recipient     string   `json:"recipient"`
+	Content       string   `json:"content"`
+	Mentions      []string `json:"mentions,omitempty"` // JIDs the text @-mentions
+	Status        string   `json:"status"`
+	Attempts      int      `json:"attempts"`
+	LastError     *string  `json:"last_error,omitempty"`
+	MessageID     *string  `json:"message_id,omitempty"`
+	NextAttemptAt *string  `json:"next_attempt_at,omitempty"`
+	CreatedAt     string   `json:"created_at"`
+	UpdatedAt     string   `json:"updated_at"`
+}
+
+// sendColumns are the sends columns read by scanSend.
+const sendColumns = `id, recipient, wahoo_decrypt(content), mentions, status, attempts, last_error, message_id, next_attempt_at, created_at, updated_at`
+
+// RecordSend creates a send entry with status SendPending (about to be
+// attempted) or SendQueued (waiting for a connection) and returns its ID.
+// mentions are the JIDs the text @-mentions, if any.
+func (s *Store) RecordSend(recipient, content string, mentions []string, status string) (int64, error) {
+	var mentioned any
+	if len(mentions) > 0 {
+		mentioned = strings.Join(mentions, "\n")
+	}
+	now := time.Now()
+	res, err := s.MsgDB.Exec(
+		`INSERT INTO sends (recipient, content, mentions, status, attempts, created_at, updated_at)
+		 VALUES (?, ?, ?, ?, 0, ?, ?)`,
+		recipient, s.seal(content), mentioned, status, now, now,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// UpdateSendResult records the outcome of a send attempt. A failed attempt is
+// retried at retryAt, or marked abandoned once maxAttempts is reached.
+func (s *Store) UpdateSendResult(id int64, messageID string, sendErr error, maxAttempts int, retryAt time.Time) error {
+	if sendErr == nil {
+		_, err := s.MsgDB.Exec(
+			`UPDATE sends SET status = ?, message_id = ?, last_error = NULL, next_attempt_at = NULL,
+				attempts = attempts + 1, updated_at = ?
+			 WHERE id = ?`,
+			SendSent, messageID, time.Now(), id,
+		)
+		return err
+	}
+	_, err := s.MsgDB.Exec(
+		`UPDATE sends SET
+			status = CASE WHEN attempts + 1 >= ? THEN ? ELSE ? END,
+			last_error = ?, next_attempt_at = ?, attempts = attempts + 1, updated_at = ?
+		 WHERE id = ?`,
+		maxAttempts, SendAbandoned, SendFailed, sendErr.Error(), retryAt, time.Now(), id,
+	)
+	return err
+}
+
+// MarkSendUnconfirmed records a send attempt whose outcome is unknown because
+// it timed out. messageID is the ID it was sent under, so a later echo or
+// receipt can confirm it.
+func (s *Store) MarkSendUnconfirmed(id int64, messageID string, sendErr error) error {
+	_, err := s.MsgDB.Exec(
+		`UPDATE sends SET status = ?, message_id = ?, last_error = ?, next_attempt_at = NULL,
+			attempts = attempts + 1, updated_at = ?
+		 WHERE id = ?`,
+		SendUnconfirmed, messageID, sendErr.Error(), time.Now(), id,
+	)
+	return err
+}
+
+// ConfirmUnconfirmedSends marks the unconfirmed sends made under the given
+// message IDs as sent, once WhatsApp has shown it received them.
+func (s *Store) ConfirmUnconfirmedSends(messageIDs []string) error {
+	if len(messageIDs) == 0 {
+		return nil
+	}
+	args := []any{SendSent, time.Now(), SendUnconfirmed}
+	for _, id := range messageIDs {
+		args = append(args, id)
+	}
+	_, err := s.MsgDB.Exec(
+		`UPDATE sends SET status = ?, last_error = NULL, updated_at = ?
+		 WHERE status = ? AND message_id IN (`+placeholders(len(messageIDs))+`)`,
+		args...,
+	)
+	return err
+}
+
+// ResetInterruptedSends marks sends still pending since before cutoff as
+// unconfirmed: the process attempting them stopped, so they may or may not
+// have been delivered. It returns how many were reset.
+func (s *Store) ResetInterruptedSends(cutoff time.Time) (int64, error) {
+	res, err := s.MsgDB.Exec(
+		`UPDATE sends SET status = ?, last_error = ?, next_attempt_at = NULL, updated_at = ?
+		 WHERE status = ? AND updated_at < ?`,
+		SendUnconfirmed, "interrupted while sending", time.Now(), SendPending, cutoff,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// ClaimSend marks a queued or failed send as pending before it is attempted.
+// It reports false if the send is no longer waiting, e.g. because it was
+// cancelled or another retry claimed it first.
+func (s *Store) ClaimSend(id int64) (bool, error) {
+	res, err := s.MsgDB.Exec(
+		`UPDATE sends SET status = ?, updated_at = ? WHERE id = ? AND status IN (?, ?)`,
+		SendPending, time.Now(), id, SendQueued, SendFailed,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// CancelSend cancels a queued or failed send so it is never sent, or
+// dismisses an unconfirmed one. It reports false if the send does not exist
+// or is not waiting in the outbox.
+func (s *Store) CancelSend(id int64) (bool, error) {
+	res, err := s.MsgDB.Exec(
+		`UPDATE sends SET status = ?, next_attempt_at = NULL, updated_at = ? WHERE id = ? AND status IN (?, ?, ?)`,
+		SendCancelled, time.Now(), id, SendQueued, SendFailed, SendUnconfirmed,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// ListOutbox returns sends not yet delivered or given up on, oldest first.
+// Unconfirmed sends are included until a receipt confirms them.
+func (s *Store) ListOutbox() ([]SendDict, error) {
+	return s.listSends(`status IN (?, ?, ?, ?)`, SendPending, SendQueued, SendFailed, SendUnconfirmed)
+}
+
+// ListFailedSends returns sends waiting to be retried, oldest first.
+func (s *Store) ListFailedSends() ([]SendDict, error) {
+	return s.listSends(`status = ?`, SendFailed)
+}
+
+// ListDueSends returns queued sends and failed sends whose retry time has
+// come, oldest first. Unconfirmed sends are never due, and pending ones are
+// being attempted or were interrupted; see ResetInterruptedSends.
+func (s *Store) ListDueSends(now time.Time) ([]SendDict, error) {
+	return s.listSends(`status = ? OR (status = ? AND (next_attempt_at IS NULL OR next_attempt_at <= ?))`,
+		SendQueued, SendFailed, now)
+}
+
+// listSends returns the sends matching where, oldest first.
+func (s *Store) listSends(where string, args ...any) ([]SendDict, error) {
+	rows, err := s.MsgDB.Query(
+		`SELECT `+sendColumns+` FROM sends WHERE `+where+` ORDER BY created_at`,
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list sends: %w", err)
+	}
+	defer rows.Close()
+
+	var result []SendDict
+	for rows.Next() {
+		d, err := scanSend(rows)
+		if err != nil {
+			continue
+		}
+		result = append(result, d)
+	}
+	return result, nil
+}
+
+// GetSend returns a send by ID, or nil if it does not exist.
+func (s *Store) GetSend(id int64) (*SendDict, error) {
+	d, err := scanSend(s.MsgDB.QueryRow(
+		`SELECT `+sendColumns+` FROM sends WHERE id = ?`, id,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get send: %w", err)
+	}
+	return &d, nil
+}
+
+// scanSend scans a sends row into a SendDict.
+func scanSend(row rowScanner) (SendDict, error) {
+	var d SendDict
+	var mentions, lastError, messageID, nextAttempt sql.NullString
+	err := row.Scan(&d.ID, &d.Recipient, &d.Content, &mentions, &d.Status, &d.Attempts,
+		&lastError, &messageID, &nextAttempt, &d.CreatedAt, &d.UpdatedAt)
+	if mentions.Valid && mentions.String != "" {
+		d.Mentions = strings.Split(mentions.String, "\n")
+	}
+	if lastError.Valid {
+		d.LastError = &lastError.String
+	}
+	if messageID.Valid && messageID.String != "" {
+		d.MessageID = &messageID.String
+	}
+	if nextAttempt.Valid {
+		d.NextAttemptAt = &nextAttempt.String
+	}
+	return d, err
+}
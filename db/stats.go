@@ -0,0 +1,212 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxResponseGap is the longest pause still counted as a reply; longer
+// silences start a new conversation rather than answer the previous one.
+const maxResponseGap = 24 * time.Hour
+
+// StatsOpts selects the messages aggregated by ChatStatistics.
+type StatsOpts struct {
+	ChatJID string // empty = all chats
+	After   *string
+	Before  *string
+	TopN    int // length of the sender and chat rankings (default 10)
+}
+
+// SenderCount is the number of messages sent by one participant.
+type SenderCount struct {
+	Sender string `json:"sender"`
+	Name   string `json:"name"`
+	Count  int    `json:"count"`
+}
+
+// ChatCount is the number of messages in one chat.
+type ChatCount struct {
+	JID   string  `json:"jid"`
+	Name  *string `json:"name,omitempty"`
+	Count int     `json:"count"`
+}
+
+// DayCount is the number of messages on one calendar day.
+type DayCount struct {
+	Date  string `json:"date"`
+	Count int    `json:"count"`
+}
+
+// ChatStatistics summarizes activity in a chat or across all chats.
+// Days and hours are in local time.
+type ChatStatistics struct {
+	Total    int            `json:"total"`
+	FromMe   int            `json:"from_me"`
+	Incoming int            `json:"incoming"`
+	ByType   map[string]int `json:"by_type"` // "text" or the media type
+	BySender []SenderCount  `json:"by_sender"`
+	ByDay    []DayCount     `json:"by_day"`
+	ByHour   [24]int        `json:"by_hour"`
+
+	// Average time until a message was answered by the other side, counting
+	// replies within 24 hours. Nil if there were no such replies.
+	MyAvgResponseSeconds     *float64 `json:"my_avg_response_seconds,omitempty"`
+	OthersAvgResponseSeconds *float64 `json:"others_avg_response_seconds,omitempty"`
+
+	MostActiveChats []ChatCount `json:"most_active_chats,omitempty"` // only across all chats
+}
+
+// responseTimer averages how long each side takes to answer the other.
+type responseTimer struct {
+	chat          string
+	waitingSince  time.Time // first unanswered message of the current run
+	waitingFromMe bool
+	mine, others  time.Duration
+	nMine, nOther int
+}
+
+func (r *responseTimer) add(chat string, fromMe bool, ts time.Time) {
+	if chat != r.chat {
+		r.chat, r.waitingSince, r.waitingFromMe = chat, ts, fromMe
+		return
+	}
+	if fromMe == r.waitingFromMe {
+		return
+	}
+	if gap := ts.Sub(r.waitingSince); gap >= 0 && gap <= maxResponseGap {
+		if fromMe {
+			r.mine += gap
+			r.nMine++
+		} else {
+			r.others += gap
+			r.nOther++
+		}
+	}
+	r.waitingSince, r.waitingFromMe = ts, fromMe
+}
+
+func averageSeconds(total time.Duration, n int) *float64 {
+	if n == 0 {
+		return nil
+	}
+	avg := total.Seconds() / float64(n)
+	return &avg
+}
+
+// ChatStatistics aggregates message counts per sender, day, hour and type,
+// response times and (across all chats) the most active chats.
+func (s *Store) ChatStatistics(opts StatsOpts) (*ChatStatistics, error) {
+	if opts.TopN == 0 {
+		opts.TopN = 10
+	}
+
+	var where []string
+	var params []any
+	if opts.ChatJID != "" {
+		where = append(where, "chat_jid = ?")
+		params = append(params, opts.ChatJID)
+	}
+	if opts.After != nil {
+		where = append(where, "timestamp > ?")
+		params = append(params, *opts.After)
+	}
+	if opts.Before != nil {
+		where = append(where, "timestamp < ?")
+		params = append(params, *opts.Before)
+	}
+	q := "SELECT chat_jid, sender, sender_name, is_from_me, media_type, timestamp FROM messages"
+	if len(where) > 0 {
+		q += " WHERE " + strings.Join(where, " AND ")
+	}
+	q += " ORDER BY chat_jid, timestamp"
+
+	rows, err := s.MsgDB.Query(q, params...)
+	if err != nil {
+		return nil, fmt.Errorf("statistics query: %w", err)
+	}
+	defer rows.Close()
+
+	st := &ChatStatistics{ByType: map[string]int{}}
+	senders := map[string]*SenderCount{}
+	days := map[string]int{}
+	chats := map[string]int{}
+	var timer responseTimer
+
+	for rows.Next() {
+		var chatJID, sender string
+		var senderName, mediaType sql.NullString
+		var fromMe bool
+		var ts time.Time
+		if rows.Scan(&chatJID, &sender, &senderName, &fromMe, &mediaType, &ts) != nil {
+			continue
+		}
+		ts = ts.Local()
+
+		st.Total++
+		if fromMe {
+			st.FromMe++
+		} else {
+			st.Incoming++
+			sc := senders[sender]
+			if sc == nil {
+				sc = &SenderCount{Sender: sender, Name: displaySender(sender, senderName, false)}
+				senders[sender] = sc
+			}
+			sc.Count++
+		}
+		if mediaType.String != "" {
+			st.ByType[mediaType.String]++
+		} else {
+			st.ByType["text"]++
+		}
+		days[ts.Format("2006-01-02")]++
+		st.ByHour[ts.Hour()]++
+		chats[chatJID]++
+		timer.add(chatJID, fromMe, ts)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("statistics query: %w", err)
+	}
+
+	if st.FromMe > 0 {
+		senders[""] = &SenderCount{Sender: "me", Name: "Me", Count: st.FromMe}
+	}
+	st.BySender = []SenderCount{}
+	for _, sc := range senders {
+		st.BySender = append(st.BySender, *sc)
+	}
+	sort.Slice(st.BySender, func(i, j int) bool { return st.BySender[i].Count > st.BySender[j].Count })
+	if len(st.BySender) > opts.TopN {
+		st.BySender = st.BySender[:opts.TopN]
+	}
+
+	st.ByDay = []DayCount{}
+	for day, n := range days {
+		st.ByDay = append(st.ByDay, DayCount{Date: day, Count: n})
+	}
+	sort.Slice(st.ByDay, func(i, j int) bool { return st.ByDay[i].Date < st.ByDay[j].Date })
+
+	st.MyAvgResponseSeconds = averageSeconds(timer.mine, timer.nMine)
+	st.OthersAvgResponseSeconds = averageSeconds(timer.others, timer.nOther)
+
+	if opts.ChatJID == "" {
+		for jid, n := range chats {
+			st.MostActiveChats = append(st.MostActiveChats, ChatCount{JID: jid, Count: n})
+		}
+		sort.Slice(st.MostActiveChats, func(i, j int) bool { return st.MostActiveChats[i].Count > st.MostActiveChats[j].Count })
+		if len(st.MostActiveChats) > opts.TopN {
+			st.MostActiveChats = st.MostActiveChats[:opts.TopN]
+		}
+		for i := range st.MostActiveChats {
+			var name sql.NullString
+			s.MsgDB.QueryRow("SELECT name FROM chats WHERE jid = ?", st.MostActiveChats[i].JID).Scan(&name)
+			if name.Valid && name.String != "" {
+				st.MostActiveChats[i].Name = &name.String
+			}
+		}
+	}
+	return st, nil
+}
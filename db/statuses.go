@@ -0,0 +1,68 @@
+package db
+
+import (
+	"fmt"
+	"time"
+)
+
+// StatusLifetime is how long a status update stays visible after it was posted.
+const StatusLifetime = 24 * time.Hour
+
+// StatusDict is the structured output for status (story) queries.
+type StatusDict struct {
+	ID         string  `json:"id"`
+	Sender     string  `json:"sender"`
+	SenderName string  `json:"sender_name"`
+	Content    string  `json:"content,omitempty"`
+	MediaType  *string `json:"media_type,omitempty"`
+	Timestamp  string  `json:"timestamp"`
+	ExpiresAt  string  `json:"expires_at"`
+}
+
+// StoreStatus saves a status update from a contact and purges expired ones.
+func (s *Store) StoreStatus(id, sender, content, mediaType string, timestamp time.Time) error {
+	_, err := s.MsgDB.Exec(
+		`INSERT OR REPLACE INTO statuses (id, sender, content, media_type, timestamp, expires_at)
+		 VALUES (?, ?, ?, ?, ?, ?)`,
+		id, sender, s.seal(content), mediaType, timestamp, timestamp.Add(StatusLifetime),
+	)
+	if err != nil {
+		return err
+	}
+	_, err = s.MsgDB.Exec("DELETE FROM statuses WHERE expires_at <= ?", time.Now())
+	return err
+}
+
+// ListStatuses returns unexpired status updates, newest first.
+// If sender is non-empty only that contact's statuses are returned.
+func (s *Store) ListStatuses(sender string) ([]StatusDict, error) {
+	q := "SELECT id, sender, wahoo_decrypt(content), media_type, timestamp, expires_at FROM statuses WHERE expires_at > ?"
+	params := []any{time.Now()}
+	if sender != "" {
+		jids := s.LinkedJIDs(sender)
+		q += " AND sender IN (" + placeholders(len(jids)) + ")"
+		params = append(params, repeatArgs(jids, 1)...)
+	}
+	q += " ORDER BY timestamp DESC"
+
+	rows, err := s.MsgDB.Query(q, params...)
+	if err != nil {
+		return nil, fmt.Errorf("list statuses: %w", err)
+	}
+	defer rows.Close()
+
+	result := []StatusDict{}
+	for rows.Next() {
+		var d StatusDict
+		var mediaType string
+		if err := rows.Scan(&d.ID, &d.Sender, &d.Content, &mediaType, &d.Timestamp, &d.ExpiresAt); err != nil {
+			continue
+		}
+		if mediaType != "" {
+			d.MediaType = &mediaType
+		}
+		d.SenderName = s.ResolveName(d.Sender)
+		result = append(result, d)
+	}
+	return result, nil
+}
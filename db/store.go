@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	_ "modernc.org/sqlite"
@@ -14,68 +16,128 @@ import (
 type Store struct {
 	MsgDB *sql.DB // messages.db - our message history
 	WaDB  *sql.DB // whatsapp.db - whatsmeow session + contacts
+
+	lowMemory bool
+	cipher    *fieldCipher // encrypts message text; nil if the store has no key
+
+	namesMu sync.Mutex
+	names   map[string]string // cached BuildSenderCache result, nil until needed (never set in low-memory mode)
+	namesAt time.Time         // when names was built
+
+	writer *writer // serializes message writes
 }
 
+// Options tune how a Store uses resources.
+type Options struct {
+	// LowMemory shrinks SQLite caches, limits open connections and resolves
+	// sender names per lookup instead of keeping every name in memory.
+	LowMemory bool
+
+	// Key encrypts message text at rest (AES-256-GCM with a key derived from
+	// it). Setting it on an unencrypted store encrypts the text stored so
+	// far; an encrypted store can't be opened without it.
+	Key string
+}
+
+// Memory ceilings of low-memory mode. Every SQLite connection gets a page
+// cache of LowMemoryCacheKB, and the Store's own handles are capped at
+// LowMemoryMaxConns connections, so their page caches stay at 1 MiB each.
+const (
+	LowMemoryCacheKB  = 512
+	LowMemoryMaxConns = 2
+)
+
+// LowMemoryPragmas are appended to SQLite DSNs in low-memory mode: a small
+// page cache, no memory-mapped I/O and temporary tables on disk.
+var LowMemoryPragmas = fmt.Sprintf("&_pragma=cache_size(-%d)&_pragma=mmap_size(0)&_pragma=temp_store(1)", LowMemoryCacheKB)
+
 // NewStore opens both SQLite databases from the given directory.
 // Creates the directory and tables if they don't exist.
 func NewStore(storeDir string) (*Store, error) {
+	return OpenStore(storeDir, Options{})
+}
+
+// OpenStore is NewStore with options.
+func OpenStore(storeDir string, opts Options) (*Store, error) {
 	if err := os.MkdirAll(storeDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create store directory: %v", err)
 	}
+	var pragmas string
+	if opts.LowMemory {
+		pragmas = LowMemoryPragmas
+	}
 
-	// Open messages database
+	// Open messages database. Transactions take the write lock when they
+	// begin and wait up to five seconds for it, so a busy database is waited
+	// for instead of failing on the first write of a transaction that began reading.
 	msgPath := filepath.Join(storeDir, "messages.db")
-	msgDB, err := sql.Open("sqlite", "file:"+msgPath+"?_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)")
+	msgDB, err := sql.Open(timedDriverName, "file:"+msgPath+"?_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_txlock=immediate"+pragmas)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open messages database: %v", err)
 	}
+	if opts.LowMemory {
+		msgDB.SetMaxOpenConns(LowMemoryMaxConns)
+	}
 
-	// Create tables if they don't exist
-	_, err = msgDB.Exec(`
-		CREATE TABLE IF NOT EXISTS chats (
-			jid TEXT PRIMARY KEY,
-			name TEXT,
-			last_message_time TIMESTAMP
-		);
-
-		CREATE TABLE IF NOT EXISTS messages (
-			id TEXT,
-			chat_jid TEXT,
-			sender TEXT,
-			content TEXT,
-			timestamp TIMESTAMP,
-			is_from_me BOOLEAN,
-			media_type TEXT,
-			filename TEXT,
-			url TEXT,
-			media_key BLOB,
-			file_sha256 BLOB,
-			file_enc_sha256 BLOB,
-			file_length INTEGER,
-			PRIMARY KEY (id, chat_jid),
-			FOREIGN KEY (chat_jid) REFERENCES chats(jid)
-		);
-	`)
-	if err != nil {
+	if err := migrate(msgDB); err != nil {
 		msgDB.Close()
-		return nil, fmt.Errorf("failed to create tables: %v", err)
+		return nil, err
 	}
 
 	// Open whatsmeow database (read-only for contact resolution)
 	waPath := filepath.Join(storeDir, "whatsapp.db")
-	waDB, err := sql.Open("sqlite", "file:"+waPath+"?_pragma=journal_mode(WAL)")
+	waDB, err := sql.Open(timedDriverName, "file:"+waPath+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)"+pragmas)
 	if err != nil {
 		// Not fatal - whatsmeow DB may not exist yet on first run
 		fmt.Fprintf(os.Stderr, "Warning: could not open whatsmeow DB: %v\n", err)
 		waDB = nil
+	} else if opts.LowMemory {
+		waDB.SetMaxOpenConns(LowMemoryMaxConns)
 	}
 
-	return &Store{MsgDB: msgDB, WaDB: waDB}, nil
+	s := &Store{MsgDB: msgDB, WaDB: waDB, lowMemory: opts.LowMemory, writer: newWriter()}
+	go s.runWriter()
+	if err := s.setupEncryption(opts.Key); err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	// Backfill sender names on messages stored before the column existed
+	var missing bool
+	msgDB.QueryRow("SELECT EXISTS (SELECT 1 FROM messages WHERE sender_name IS NULL)").Scan(&missing)
+	if missing {
+		if _, err := s.RefreshSenderNames(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: could not backfill sender names: %v\n", err)
+		}
+	}
+	return s, nil
 }
 
-// Close closes both database connections.
+// LowMemory reports whether the store was opened in low-memory mode.
+func (s *Store) LowMemory() bool {
+	return s.lowMemory
+}
+
+// DeviceJID returns the JID the account is paired as, from the whatsmeow
+// database, or "" if it is not paired.
+func (s *Store) DeviceJID() string {
+	if s.WaDB == nil {
+		return ""
+	}
+	var jid string
+	s.WaDB.QueryRow("SELECT jid FROM whatsmeow_device LIMIT 1").Scan(&jid)
+	return jid
+}
+
+// Close commits queued message writes, checkpoints the messages database's
+// write-ahead log into the database file and closes both database
+// connections.
 func (s *Store) Close() {
+	s.closeWriter()
 	if s.MsgDB != nil {
+		if _, err := s.MsgDB.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: could not checkpoint messages DB: %v\n", err)
+		}
 		s.MsgDB.Close()
 	}
 	if s.WaDB != nil {
@@ -83,32 +145,365 @@ func (s *Store) Close() {
 	}
 }
 
-// StoreChat upserts a chat record.
+// StoreChat upserts a chat record. The last message time only moves
+// forward, so storing older history doesn't reorder the chat list.
 func (s *Store) StoreChat(jid, name string, lastMessageTime time.Time) error {
+	// Upsert rather than replace so chat state columns (archived, pinned, muted, ...) survive
 	_, err := s.MsgDB.Exec(
-		"INSERT OR REPLACE INTO chats (jid, name, last_message_time) VALUES (?, ?, ?)",
+		`INSERT INTO chats (jid, name, last_message_time) VALUES (?, ?, ?)
+		 ON CONFLICT(jid) DO UPDATE SET name = excluded.name,
+			last_message_time = MAX(excluded.last_message_time, COALESCE(chats.last_message_time, ''))`,
 		jid, name, lastMessageTime,
 	)
+	if err == nil && name != "" {
+		s.addChatName(jid, name)
+	}
 	return err
 }
 
-// StoreMessage inserts or replaces a message. Skips if both content and mediaType are empty.
-func (s *Store) StoreMessage(id, chatJID, sender, content string, timestamp time.Time, isFromMe bool,
-	mediaType, filename, url string, mediaKey, fileSHA256, fileEncSHA256 []byte, fileLength uint64) error {
+// Message sources recorded with each stored message.
+const (
+	SourceLive        = "live"
+	SourceHistorySync = "history_sync"
+	SourceFetched     = "fetched" // requested on demand, e.g. channel messages
+)
+
+// MessageRecord is a message as written to the messages table.
+type MessageRecord struct {
+	ID              string
+	ChatJID         string
+	Sender          string
+	Content         string
+	Timestamp       time.Time // server timestamp
+	IsFromMe        bool
+	Source          string     // SourceLive or SourceHistorySync
+	SenderTimestamp *time.Time // client-side send time, if known
+
+	MediaType     string
+	Filename      string
+	URL           string
+	MediaKey      []byte
+	FileSHA256    []byte
+	FileEncSHA256 []byte
+	FileLength    uint64
+	MimeType      string
+	PageCount     uint32 // pages of a document, if known
+
+	Location *Location // set for location and live location messages
+	VCard    string    // vCard text of contact card messages
 
-	if content == "" && mediaType == "" {
+	QuotedMessageID string // message this one replies to, if any
+	QuotedSender    string // sender of the quoted message (user part of the JID)
+
+	MentionedJIDs []string // JIDs @-mentioned in the message
+	MentionsMe    bool     // our own account is among MentionedJIDs
+
+	ViewOnce bool // view-once image, video or voice message
+
+	// Pending marks a message we are sending that WhatsApp has not
+	// acknowledged yet. Storing the message again without it, as its echo
+	// does, clears the flag for good.
+	Pending bool
+}
+
+// Location is the position shared in a location message.
+type Location struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Name      string  `json:"name,omitempty"`
+	Address   string  `json:"address,omitempty"`
+}
+
+// StoreMessage inserts or updates a message. Skips if both content and mediaType are empty.
+// The original source is kept, and content of locally edited messages is not overwritten.
+func (s *Store) StoreMessage(m MessageRecord) error {
+	if m.Content == "" && m.MediaType == "" {
 		return nil
 	}
+	args := s.messageArgs(m)
+	return s.write(1, func(tx *sql.Tx) error {
+		_, err := tx.Exec(upsertMessage, args...)
+		return err
+	})
+}
+
+// StoreMessages stores messages like StoreMessage, WriteBatchSize to a
+// transaction. Returns how many were stored; a message that fails doesn't
+// keep the others from being stored.
+func (s *Store) StoreMessages(ms []MessageRecord) (int, error) {
+	stored, failed := 0, 0
+	var firstErr error
+	for len(ms) > 0 {
+		chunk := ms[:min(len(ms), WriteBatchSize)]
+		ms = ms[len(chunk):]
+
+		var args [][]any
+		for _, m := range chunk {
+			if m.Content != "" || m.MediaType != "" {
+				args = append(args, s.messageArgs(m))
+			}
+		}
+		var chunkStored, chunkFailed int
+		var chunkErr error
+		err := s.write(len(args), func(tx *sql.Tx) error {
+			chunkStored, chunkFailed, chunkErr = 0, 0, nil
+			stmt, err := tx.Prepare(upsertMessage)
+			if err != nil {
+				return err
+			}
+			defer stmt.Close()
+			for _, a := range args {
+				if _, err := stmt.Exec(a...); err != nil {
+					chunkFailed++
+					if chunkErr == nil {
+						chunkErr = err
+					}
+					continue
+				}
+				chunkStored++
+			}
+			return nil
+		})
+		if err != nil {
+			return stored, err
+		}
+		stored += chunkStored
+		failed += chunkFailed
+		if firstErr == nil {
+			firstErr = chunkErr
+		}
+	}
+	if firstErr != nil {
+		return stored, fmt.Errorf("%d messages not stored: %w", failed, firstErr)
+	}
+	return stored, nil
+}
+
+const upsertMessage = `INSERT INTO messages
+	(id, chat_jid, sender, content, timestamp, is_from_me, media_type, filename, url, media_key, file_sha256, file_enc_sha256, file_length,
+	 source, sender_timestamp, sender_name, latitude, longitude, location_name, location_address, vcard,
+	 quoted_message_id, quoted_sender, mentioned_jids, mentions_me, view_once, mimetype, page_count, pending)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(id, chat_jid) DO UPDATE SET
+		sender = excluded.sender,
+		sender_name = excluded.sender_name,
+		content = CASE WHEN messages.edited THEN messages.content ELSE excluded.content END,
+		timestamp = excluded.timestamp,
+		is_from_me = excluded.is_from_me,
+		media_type = excluded.media_type,
+		filename = excluded.filename,
+		url = excluded.url,
+		media_key = excluded.media_key,
+		file_sha256 = excluded.file_sha256,
+		file_enc_sha256 = excluded.file_enc_sha256,
+		file_length = excluded.file_length,
+		mimetype = COALESCE(excluded.mimetype, messages.mimetype),
+		page_count = COALESCE(excluded.page_count, messages.page_count),
+		latitude = excluded.latitude,
+		longitude = excluded.longitude,
+		location_name = excluded.location_name,
+		location_address = excluded.location_address,
+		vcard = excluded.vcard,
+		quoted_message_id = COALESCE(excluded.quoted_message_id, messages.quoted_message_id),
+		quoted_sender = COALESCE(excluded.quoted_sender, messages.quoted_sender),
+		mentioned_jids = COALESCE(excluded.mentioned_jids, messages.mentioned_jids),
+		mentions_me = excluded.mentions_me OR messages.mentions_me,
+		view_once = excluded.view_once OR messages.view_once,
+		pending = excluded.pending AND messages.pending,
+		unconfirmed = messages.unconfirmed AND excluded.pending,
+		sender_timestamp = COALESCE(messages.sender_timestamp, excluded.sender_timestamp)`
+
+// messageArgs returns the arguments of upsertMessage for m. Names are
+// resolved here rather than on the writer, which must not wait for reads.
+func (s *Store) messageArgs(m MessageRecord) []any {
+	var lat, lon, locName, locAddress any
+	if m.Location != nil {
+		lat, lon, locName, locAddress = m.Location.Latitude, m.Location.Longitude, m.Location.Name, m.Location.Address
+	}
+	var vcard any
+	if m.VCard != "" {
+		vcard = s.seal(m.VCard)
+	}
+	var quotedID, quotedSender any
+	if m.QuotedMessageID != "" {
+		quotedID, quotedSender = m.QuotedMessageID, m.QuotedSender
+	}
+	var mentioned any
+	if len(m.MentionedJIDs) > 0 {
+		mentioned = strings.Join(m.MentionedJIDs, "\n")
+	}
+	var mimeType, pageCount any
+	if m.MimeType != "" {
+		mimeType = m.MimeType
+	}
+	if m.PageCount > 0 {
+		pageCount = m.PageCount
+	}
+	return []any{
+		m.ID, m.ChatJID, m.Sender, s.seal(m.Content), m.Timestamp, m.IsFromMe, m.MediaType, m.Filename, m.URL,
+		m.MediaKey, m.FileSHA256, m.FileEncSHA256, m.FileLength, m.Source, m.SenderTimestamp,
+		s.ResolveName(m.Sender), lat, lon, locName, locAddress, vcard,
+		quotedID, quotedSender, mentioned, m.MentionsMe, m.ViewOnce, mimeType, pageCount, m.Pending,
+	}
+}
 
+// EditMessage replaces the text of a stored message and flags it as edited.
+// Its embedding is dropped so the new text gets embedded.
+func (s *Store) EditMessage(id, chatJID, newContent string, editedAt time.Time) error {
 	_, err := s.MsgDB.Exec(
-		`INSERT OR REPLACE INTO messages
-		(id, chat_jid, sender, content, timestamp, is_from_me, media_type, filename, url, media_key, file_sha256, file_enc_sha256, file_length)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		id, chatJID, sender, content, timestamp, isFromMe, mediaType, filename, url, mediaKey, fileSHA256, fileEncSHA256, fileLength,
+		"UPDATE messages SET content = ?, edited = 1, edited_at = ? WHERE id = ? AND chat_jid = ?",
+		s.seal(newContent), editedAt, id, chatJID,
 	)
+	if err != nil {
+		return err
+	}
+	_, err = s.MsgDB.Exec("DELETE FROM message_embeddings WHERE message_id = ? AND chat_jid = ?", id, chatJID)
 	return err
 }
 
+// ConfirmSentMessage clears the pending flag of a message we sent once
+// WhatsApp has acknowledged it, taking the server timestamp.
+func (s *Store) ConfirmSentMessage(id, chatJID string, timestamp time.Time) error {
+	_, err := s.MsgDB.Exec("UPDATE messages SET pending = 0, timestamp = ? WHERE id = ? AND chat_jid = ?", timestamp, id, chatJID)
+	return err
+}
+
+// ConfirmDeliveredMessages clears the pending and unconfirmed flags of the
+// messages we sent with the given IDs, e.g. because a receipt for them arrived.
+func (s *Store) ConfirmDeliveredMessages(ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	_, err := s.MsgDB.Exec(
+		`UPDATE messages SET pending = 0, unconfirmed = 0
+		 WHERE is_from_me AND (pending OR unconfirmed) AND id IN (`+placeholders(len(ids))+`)`,
+		args...,
+	)
+	return err
+}
+
+// FlagUnconfirmedMessages marks messages still pending since before cutoff as
+// unconfirmed: their send timed out and WhatsApp has not acknowledged them
+// since. It returns how many were flagged.
+func (s *Store) FlagUnconfirmedMessages(cutoff time.Time) (int64, error) {
+	res, err := s.MsgDB.Exec(
+		"UPDATE messages SET pending = 0, unconfirmed = 1 WHERE pending AND timestamp < ?", cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// DeletePendingMessage deletes a message stored while it was being sent,
+// unless WhatsApp has acknowledged it in the meantime.
+func (s *Store) DeletePendingMessage(id, chatJID string) error {
+	_, err := s.MsgDB.Exec("DELETE FROM messages WHERE id = ? AND chat_jid = ? AND pending", id, chatJID)
+	return err
+}
+
+// MarkMessageRevoked flags a stored message as revoked (deleted for everyone).
+// Its content is kept.
+func (s *Store) MarkMessageRevoked(id, chatJID string, revokedAt time.Time) error {
+	_, err := s.MsgDB.Exec("UPDATE messages SET revoked = 1, revoked_at = ? WHERE id = ? AND chat_jid = ?", revokedAt, id, chatJID)
+	return err
+}
+
+// SetMessageStarred stars or unstars a stored message. It reports false if
+// the message is not stored.
+func (s *Store) SetMessageStarred(id, chatJID string, starred bool, at time.Time) (bool, error) {
+	var starredAt any
+	if starred {
+		starredAt = at
+	}
+	res, err := s.MsgDB.Exec("UPDATE messages SET starred = ?, starred_at = ? WHERE id = ? AND chat_jid = ?",
+		starred, starredAt, id, chatJID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// ViewOnceState reports whether a stored message is view-once media and when
+// it was viewed, if it was.
+func (s *Store) ViewOnceState(id, chatJID string) (viewOnce bool, viewedAt *string, err error) {
+	var viewed sql.NullString
+	err = s.MsgDB.QueryRow("SELECT view_once, viewed_at FROM messages WHERE id = ? AND chat_jid = ?", id, chatJID).Scan(&viewOnce, &viewed)
+	if err == sql.ErrNoRows {
+		return false, nil, nil
+	}
+	if viewed.Valid {
+		viewedAt = &viewed.String
+	}
+	return viewOnce, viewedAt, err
+}
+
+// MarkViewOnceViewed records when view-once media was viewed. It reports
+// false if it had been viewed already.
+func (s *Store) MarkViewOnceViewed(id, chatJID string, at time.Time) (bool, error) {
+	res, err := s.MsgDB.Exec("UPDATE messages SET viewed_at = ? WHERE id = ? AND chat_jid = ? AND viewed_at IS NULL", at, id, chatJID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// DeleteMessage removes a stored message.
+func (s *Store) DeleteMessage(id, chatJID string) error {
+	_, err := s.MsgDB.Exec("DELETE FROM messages WHERE id = ? AND chat_jid = ?", id, chatJID)
+	return err
+}
+
+// SetMediaLocalPath records where a message's media was downloaded to.
+func (s *Store) SetMediaLocalPath(id, chatJID, localPath string) error {
+	_, err := s.MsgDB.Exec("UPDATE messages SET local_path = ? WHERE id = ? AND chat_jid = ?", localPath, id, chatJID)
+	return err
+}
+
+// SetMediaURL records a new location of a message's media, after the sender
+// re-uploaded it.
+func (s *Store) SetMediaURL(id, chatJID, url string) error {
+	_, err := s.MsgDB.Exec("UPDATE messages SET url = ? WHERE id = ? AND chat_jid = ?", url, id, chatJID)
+	return err
+}
+
+// MediaLocalPath returns where a message's media was downloaded to, or "" if
+// it has not been downloaded.
+func (s *Store) MediaLocalPath(id, chatJID string) string {
+	var path sql.NullString
+	s.MsgDB.QueryRow("SELECT local_path FROM messages WHERE id = ? AND chat_jid = ?", id, chatJID).Scan(&path)
+	return path.String
+}
+
+// ClearMediaLocalPath forgets a downloaded media file that was deleted.
+func (s *Store) ClearMediaLocalPath(localPath string) error {
+	_, err := s.MsgDB.Exec("UPDATE messages SET local_path = NULL WHERE local_path = ?", localPath)
+	return err
+}
+
+// MediaLocalPaths maps every recorded media download to its chat JID.
+func (s *Store) MediaLocalPaths() (map[string]string, error) {
+	rows, err := s.MsgDB.Query("SELECT local_path, chat_jid FROM messages WHERE local_path IS NOT NULL AND local_path != ''")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	paths := make(map[string]string)
+	for rows.Next() {
+		var path, chatJID string
+		if err := rows.Scan(&path, &chatJID); err != nil {
+			return nil, err
+		}
+		paths[path] = chatJID
+	}
+	return paths, rows.Err()
+}
+
 // GetMediaInfo retrieves media metadata for a message (for download).
 func (s *Store) GetMediaInfo(messageID, chatJID string) (url string, mediaKey, fileSHA256, fileEncSHA256 []byte, fileLength uint64, mediaType, filename string, err error) {
 	err = s.MsgDB.QueryRow(
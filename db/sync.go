@@ -0,0 +1,219 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// History sync chunk statuses.
+const (
+	SyncPending = "pending"
+	SyncDone    = "done"
+	SyncFailed  = "failed" // gave up after MaxSyncAttempts
+)
+
+// MaxSyncAttempts is how often processing a history sync chunk is tried.
+const MaxSyncAttempts = 3
+
+// SyncChunk is a history sync chunk announced by the phone.
+type SyncChunk struct {
+	ID           string // ID of the message announcing the chunk
+	SyncType     string
+	ChunkOrder   int
+	Progress     int    // percent of the sync done with this chunk
+	Notification []byte // marshaled HistorySyncNotification
+	Attempts     int
+	ReceivedAt   time.Time
+}
+
+// SyncStatus is the progress of history sync.
+type SyncStatus struct {
+	ChunksPending int             `json:"chunks_pending"`
+	ChunksDone    int             `json:"chunks_done"`
+	ChunksFailed  int             `json:"chunks_failed"`
+	Messages      int             `json:"messages"`           // stored from history sync chunks
+	Progress      *int            `json:"progress,omitempty"` // percent, as reported with the latest chunk
+	LastChunkAt   *string         `json:"last_chunk_at,omitempty"`
+	ChatsSynced   int             `json:"chats_synced"`
+	ChatsComplete int             `json:"chats_complete"`
+	Chunks        []SyncChunkDict `json:"chunks"` // latest first
+	Chats         []SyncChatDict  `json:"chats"`  // latest synced first
+}
+
+// SyncChunkDict is the structured output for a history sync chunk.
+type SyncChunkDict struct {
+	ID            string  `json:"id"`
+	SyncType      string  `json:"sync_type"`
+	ChunkOrder    int     `json:"chunk_order"`
+	Progress      int     `json:"progress"`
+	Status        string  `json:"status"`
+	Attempts      int     `json:"attempts"`
+	Error         *string `json:"error,omitempty"`
+	Conversations int     `json:"conversations"`
+	Messages      int     `json:"messages"`
+	ReceivedAt    string  `json:"received_at"`
+	ProcessedAt   *string `json:"processed_at,omitempty"`
+}
+
+// SyncChatDict is the structured output for a chat seen in history sync.
+type SyncChatDict struct {
+	JID           string  `json:"jid"`
+	Name          string  `json:"name"`
+	Complete      bool    `json:"complete"` // the phone sent all the history it will send
+	Messages      int     `json:"messages"` // stored in total
+	OldestMessage *string `json:"oldest_message,omitempty"`
+	SyncedAt      string  `json:"synced_at"`
+}
+
+// AddSyncChunk records an announced history sync chunk as pending. A chunk
+// announced again is ignored.
+func (s *Store) AddSyncChunk(c SyncChunk) error {
+	_, err := s.MsgDB.Exec(
+		`INSERT OR IGNORE INTO sync_state (id, sync_type, chunk_order, progress, notification, status, received_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		c.ID, c.SyncType, c.ChunkOrder, c.Progress, c.Notification, SyncPending, c.ReceivedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("add sync chunk: %w", err)
+	}
+	return nil
+}
+
+// PendingSyncChunks returns the chunks still to be processed, in the order
+// they were announced.
+func (s *Store) PendingSyncChunks() ([]SyncChunk, error) {
+	rows, err := s.MsgDB.Query(
+		`SELECT id, sync_type, chunk_order, progress, notification, attempts, received_at
+		 FROM sync_state WHERE status = ? ORDER BY received_at, chunk_order`, SyncPending)
+	if err != nil {
+		return nil, fmt.Errorf("list sync chunks: %w", err)
+	}
+	defer rows.Close()
+	var chunks []SyncChunk
+	for rows.Next() {
+		var c SyncChunk
+		if err := rows.Scan(&c.ID, &c.SyncType, &c.ChunkOrder, &c.Progress, &c.Notification, &c.Attempts, &c.ReceivedAt); err != nil {
+			return nil, fmt.Errorf("scan sync chunk: %w", err)
+		}
+		chunks = append(chunks, c)
+	}
+	return chunks, rows.Err()
+}
+
+// FinishSyncChunk marks a chunk as processed.
+func (s *Store) FinishSyncChunk(id string, conversations, messages int, at time.Time) error {
+	_, err := s.MsgDB.Exec(
+		`UPDATE sync_state SET status = ?, attempts = attempts + 1, error = NULL,
+			conversations = ?, messages = ?, processed_at = ?
+		 WHERE id = ?`,
+		SyncDone, conversations, messages, at, id,
+	)
+	if err != nil {
+		return fmt.Errorf("finish sync chunk: %w", err)
+	}
+	return nil
+}
+
+// FailSyncChunk records a failed attempt to process a chunk. After
+// MaxSyncAttempts the chunk is given up.
+func (s *Store) FailSyncChunk(id, reason string, at time.Time) error {
+	_, err := s.MsgDB.Exec(
+		`UPDATE sync_state SET attempts = attempts + 1, error = ?, processed_at = ?,
+			status = CASE WHEN attempts + 1 >= ? THEN ? ELSE status END
+		 WHERE id = ?`,
+		reason, at, MaxSyncAttempts, SyncFailed, id,
+	)
+	if err != nil {
+		return fmt.Errorf("fail sync chunk: %w", err)
+	}
+	return nil
+}
+
+// MarkChatSynced records that history of a chat arrived. Once complete, a
+// chat stays complete.
+func (s *Store) MarkChatSynced(chatJID string, complete bool, at time.Time) error {
+	_, err := s.MsgDB.Exec(
+		`INSERT INTO sync_chats (chat_jid, complete, synced_at) VALUES (?, ?, ?)
+		 ON CONFLICT(chat_jid) DO UPDATE SET complete = complete OR excluded.complete, synced_at = excluded.synced_at`,
+		chatJID, complete, at,
+	)
+	if err != nil {
+		return fmt.Errorf("mark chat synced: %w", err)
+	}
+	return nil
+}
+
+// GetSyncStatus summarizes history sync with the latest limit chunks and
+// chats. If chatJID is set only that chat is listed.
+func (s *Store) GetSyncStatus(chatJID string, limit int) (*SyncStatus, error) {
+	st := &SyncStatus{Chunks: []SyncChunkDict{}, Chats: []SyncChatDict{}}
+	err := s.MsgDB.QueryRow(
+		`SELECT COALESCE(SUM(status = ?), 0), COALESCE(SUM(status = ?), 0), COALESCE(SUM(status = ?), 0),
+			COALESCE(SUM(messages), 0), MAX(received_at)
+		 FROM sync_state`,
+		SyncPending, SyncDone, SyncFailed,
+	).Scan(&st.ChunksPending, &st.ChunksDone, &st.ChunksFailed, &st.Messages, &st.LastChunkAt)
+	if err != nil {
+		return nil, fmt.Errorf("get sync status: %w", err)
+	}
+	var progress int
+	err = s.MsgDB.QueryRow(
+		"SELECT progress FROM sync_state WHERE progress > 0 ORDER BY received_at DESC, chunk_order DESC LIMIT 1",
+	).Scan(&progress)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return nil, fmt.Errorf("get sync progress: %w", err)
+	default:
+		st.Progress = &progress
+	}
+	if err := s.MsgDB.QueryRow("SELECT COUNT(*), COALESCE(SUM(complete), 0) FROM sync_chats").
+		Scan(&st.ChatsSynced, &st.ChatsComplete); err != nil {
+		return nil, fmt.Errorf("get synced chats: %w", err)
+	}
+
+	rows, err := s.MsgDB.Query(
+		`SELECT id, sync_type, chunk_order, progress, status, attempts, error, conversations, messages, received_at, processed_at
+		 FROM sync_state ORDER BY received_at DESC, chunk_order DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list sync chunks: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c SyncChunkDict
+		if err := rows.Scan(&c.ID, &c.SyncType, &c.ChunkOrder, &c.Progress, &c.Status, &c.Attempts, &c.Error,
+			&c.Conversations, &c.Messages, &c.ReceivedAt, &c.ProcessedAt); err != nil {
+			return nil, fmt.Errorf("scan sync chunk: %w", err)
+		}
+		st.Chunks = append(st.Chunks, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	where, args := "", []any{}
+	if chatJID != "" {
+		where, args = "WHERE sc.chat_jid = ?", append(args, chatJID)
+	}
+	chatRows, err := s.MsgDB.Query(
+		`SELECT sc.chat_jid, COALESCE(c.name, ''), sc.complete, sc.synced_at,
+			(SELECT COUNT(*) FROM messages m WHERE m.chat_jid = sc.chat_jid),
+			(SELECT MIN(m.timestamp) FROM messages m WHERE m.chat_jid = sc.chat_jid)
+		 FROM sync_chats sc LEFT JOIN chats c ON c.jid = sc.chat_jid
+		 `+where+` ORDER BY sc.synced_at DESC LIMIT ?`,
+		append(args, limit)...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list synced chats: %w", err)
+	}
+	defer chatRows.Close()
+	for chatRows.Next() {
+		var c SyncChatDict
+		if err := chatRows.Scan(&c.JID, &c.Name, &c.Complete, &c.SyncedAt, &c.Messages, &c.OldestMessage); err != nil {
+			return nil, fmt.Errorf("scan synced chat: %w", err)
+		}
+		st.Chats = append(st.Chats, c)
+	}
+	return st, chatRows.Err()
+}
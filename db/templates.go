@@ -0,0 +1,81 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// TemplateDict is the structured output for message template queries.
+type TemplateDict struct {
+	Name         string   `json:"name"`
+	Body         string   `json:"body"`
+	Description  string   `json:"description,omitempty"`
+	Placeholders []string `json:"placeholders"` // set by the caller, see wa.TemplatePlaceholders
+	UpdatedAt    string   `json:"updated_at"`
+}
+
+const templateColumns = "name, wahoo_decrypt(body), description, updated_at"
+
+// SaveTemplate stores a message template, replacing the one with the same
+// name. Reports whether one was replaced.
+func (s *Store) SaveTemplate(name, body, description string) (bool, error) {
+	var replaced bool
+	s.MsgDB.QueryRow("SELECT 1 FROM templates WHERE name = ?", name).Scan(&replaced)
+	now := time.Now()
+	_, err := s.MsgDB.Exec(
+		`INSERT INTO templates (name, body, description, created_at, updated_at) VALUES (?, ?, NULLIF(?, ''), ?, ?)
+		 ON CONFLICT(name) DO UPDATE SET body = excluded.body, description = excluded.description, updated_at = excluded.updated_at`,
+		name, s.seal(body), description, now, now,
+	)
+	if err != nil {
+		return false, fmt.Errorf("save template: %w", err)
+	}
+	return replaced, nil
+}
+
+// GetTemplate returns the template named name, or nil if there is none.
+func (s *Store) GetTemplate(name string) (*TemplateDict, error) {
+	rows, err := s.MsgDB.Query("SELECT "+templateColumns+" FROM templates WHERE name = ?", name)
+	if err != nil {
+		return nil, fmt.Errorf("get template: %w", err)
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	t, err := scanTemplate(rows)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// ListTemplates returns all templates ordered by name.
+func (s *Store) ListTemplates() ([]TemplateDict, error) {
+	rows, err := s.MsgDB.Query("SELECT " + templateColumns + " FROM templates ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("list templates: %w", err)
+	}
+	defer rows.Close()
+
+	result := []TemplateDict{}
+	for rows.Next() {
+		t, err := scanTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, t)
+	}
+	return result, rows.Err()
+}
+
+func scanTemplate(rows *sql.Rows) (TemplateDict, error) {
+	var t TemplateDict
+	var description sql.NullString
+	if err := rows.Scan(&t.Name, &t.Body, &description, &t.UpdatedAt); err != nil {
+		return t, fmt.Errorf("scan template: %w", err)
+	}
+	t.Description = description.String
+	return t, nil
+}
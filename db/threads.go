@@ -0,0 +1,87 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// maxThreadDepth bounds how many quoted messages GetThread follows.
+const maxThreadDepth = 50
+
+// ThreadDict is a message with the reply chain leading up to it and the
+// direct replies it received.
+type ThreadDict struct {
+	Chain   []MessageDict `json:"chain"`   // oldest quoted message first, ending with the requested message
+	Replies []MessageDict `json:"replies"` // messages quoting the requested message, oldest first
+
+	// The chain continues with this message, which is not stored locally
+	// (e.g. it predates the history sync).
+	MissingQuotedID *string `json:"missing_quoted_id,omitempty"`
+}
+
+// getMessage loads one message. chatJID may be empty if the ID is unique.
+func (s *Store) getMessage(id, chatJID string) (rawMessage, error) {
+	q := `SELECT ` + messageColumns + `
+		  FROM messages JOIN chats ON messages.chat_jid = chats.jid
+		  WHERE messages.id = ?`
+	params := []any{id}
+	if chatJID != "" {
+		q += " AND messages.chat_jid = ?"
+		params = append(params, chatJID)
+	}
+	return scanMessage(s.MsgDB.QueryRow(q+" LIMIT 1", params...))
+}
+
+// GetThread follows the quoted messages of a reply back to the start of the
+// conversation thread and collects the replies to the message.
+func (s *Store) GetThread(messageID, chatJID string) (*ThreadDict, error) {
+	target, err := s.getMessage(messageID, chatJID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("message %s not found", messageID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("thread query: %w", err)
+	}
+
+	thread := &ThreadDict{Chain: []MessageDict{rawToDict(target)}, Replies: []MessageDict{}}
+	seen := map[string]bool{target.id: true}
+	cur := target
+	for depth := 0; depth < maxThreadDepth && cur.quotedID.String != "" && !seen[cur.quotedID.String]; depth++ {
+		quoted, err := s.getMessage(cur.quotedID.String, target.chatJID)
+		if errors.Is(err, sql.ErrNoRows) {
+			missing := cur.quotedID.String
+			thread.MissingQuotedID = &missing
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("thread query: %w", err)
+		}
+		seen[quoted.id] = true
+		thread.Chain = append(thread.Chain, rawToDict(quoted))
+		cur = quoted
+	}
+	for i, j := 0, len(thread.Chain)-1; i < j; i, j = i+1, j-1 {
+		thread.Chain[i], thread.Chain[j] = thread.Chain[j], thread.Chain[i]
+	}
+
+	rows, err := s.MsgDB.Query(
+		`SELECT `+messageColumns+`
+		 FROM messages JOIN chats ON messages.chat_jid = chats.jid
+		 WHERE messages.chat_jid = ? AND messages.quoted_message_id = ?
+		 ORDER BY messages.timestamp ASC`,
+		target.chatJID, target.id,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("replies query: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		m, err := scanMessage(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan message: %w", err)
+		}
+		thread.Replies = append(thread.Replies, rawToDict(m))
+	}
+	return thread, rows.Err()
+}
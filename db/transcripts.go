@@ -0,0 +1,51 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// transcriptColumn selects the transcript of a message in queries aliasing
+// the messages table as messages.
+const transcriptColumn = `(SELECT wahoo_decrypt(text) FROM transcripts
+	WHERE transcripts.message_id = messages.id AND transcripts.chat_jid = messages.chat_jid)`
+
+// Transcript is the text of an audio message produced by a transcription backend.
+type Transcript struct {
+	MessageID string `json:"message_id"`
+	ChatJID   string `json:"chat_jid"`
+	Text      string `json:"text"`
+	Backend   string `json:"backend"` // e.g. whisper.cpp or the API host
+	CreatedAt string `json:"created_at"`
+}
+
+// SaveTranscript stores or replaces the transcript of a message.
+func (s *Store) SaveTranscript(t Transcript, at time.Time) error {
+	_, err := s.MsgDB.Exec(
+		`INSERT INTO transcripts (message_id, chat_jid, text, backend, created_at)
+		 VALUES (?, ?, ?, ?, ?)
+		 ON CONFLICT(message_id, chat_jid) DO UPDATE SET
+			text = excluded.text, backend = excluded.backend, created_at = excluded.created_at`,
+		t.MessageID, t.ChatJID, s.seal(t.Text), t.Backend, at,
+	)
+	return err
+}
+
+// GetTranscript returns the transcript of a message, or nil if it has none.
+func (s *Store) GetTranscript(messageID, chatJID string) (*Transcript, error) {
+	t := Transcript{MessageID: messageID, ChatJID: chatJID}
+	var createdAt time.Time
+	err := s.MsgDB.QueryRow(
+		"SELECT wahoo_decrypt(text), backend, created_at FROM transcripts WHERE message_id = ? AND chat_jid = ?",
+		messageID, chatJID,
+	).Scan(&t.Text, &t.Backend, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	t.CreatedAt = createdAt.Format(time.RFC3339)
+	return &t, nil
+}
@@ -0,0 +1,130 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// WatchRule describes a listen-only filter over incoming messages.
+// Empty fields match anything; all set fields must match.
+type WatchRule struct {
+	Name       string `json:"name"`
+	Keyword    string `json:"keyword,omitempty"`
+	Sender     string `json:"sender,omitempty"`
+	ChatJID    string `json:"chat_jid,omitempty"`
+	MentionsMe bool   `json:"mentions_me,omitempty"`
+}
+
+// Matches reports whether a message satisfies the rule.
+func (r WatchRule) Matches(chatJID, sender, content string, mentionsMe bool) bool {
+	if r.Keyword != "" && !strings.Contains(strings.ToLower(content), strings.ToLower(r.Keyword)) {
+		return false
+	}
+	if r.Sender != "" && r.Sender != sender && !strings.HasPrefix(r.Sender, sender+"@") {
+		return false
+	}
+	if r.ChatJID != "" && r.ChatJID != chatJID {
+		return false
+	}
+	if r.MentionsMe && !mentionsMe {
+		return false
+	}
+	return true
+}
+
+// SaveWatchRule creates or replaces a watch rule.
+func (s *Store) SaveWatchRule(r WatchRule) error {
+	_, err := s.MsgDB.Exec(
+		`INSERT OR REPLACE INTO watch_rules (name, keyword, sender, chat_jid, mentions_me, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?)`,
+		r.Name, r.Keyword, r.Sender, r.ChatJID, r.MentionsMe, time.Now(),
+	)
+	return err
+}
+
+// DeleteWatchRule removes a rule and its recorded hits. Returns false if the rule did not exist.
+func (s *Store) DeleteWatchRule(name string) (bool, error) {
+	res, err := s.MsgDB.Exec("DELETE FROM watch_rules WHERE name = ?", name)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	_, _ = s.MsgDB.Exec("DELETE FROM watch_hits WHERE rule = ?", name)
+	return n > 0, nil
+}
+
+// ListWatchRules returns all watch rules ordered by name.
+func (s *Store) ListWatchRules() ([]WatchRule, error) {
+	rows, err := s.MsgDB.Query("SELECT name, keyword, sender, chat_jid, mentions_me FROM watch_rules ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("list watch rules: %w", err)
+	}
+	defer rows.Close()
+
+	result := []WatchRule{}
+	for rows.Next() {
+		var r WatchRule
+		if err := rows.Scan(&r.Name, &r.Keyword, &r.Sender, &r.ChatJID, &r.MentionsMe); err != nil {
+			continue
+		}
+		result = append(result, r)
+	}
+	return result, nil
+}
+
+// GetWatchRule returns a rule by name, or nil if it does not exist.
+func (s *Store) GetWatchRule(name string) (*WatchRule, error) {
+	var r WatchRule
+	err := s.MsgDB.QueryRow(
+		"SELECT name, keyword, sender, chat_jid, mentions_me FROM watch_rules WHERE name = ?", name,
+	).Scan(&r.Name, &r.Keyword, &r.Sender, &r.ChatJID, &r.MentionsMe)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get watch rule: %w", err)
+	}
+	return &r, nil
+}
+
+// StoreWatchHit records that a message matched a rule.
+func (s *Store) StoreWatchHit(rule, messageID, chatJID string, matchedAt time.Time) error {
+	_, err := s.MsgDB.Exec(
+		"INSERT OR IGNORE INTO watch_hits (rule, message_id, chat_jid, matched_at) VALUES (?, ?, ?, ?)",
+		rule, messageID, chatJID, matchedAt,
+	)
+	return err
+}
+
+// GetWatchHits returns the most recent messages that matched a rule, newest first.
+func (s *Store) GetWatchHits(rule string, limit int) ([]MessageDict, error) {
+	if limit == 0 {
+		limit = 50
+	}
+
+	rows, err := s.MsgDB.Query(
+		`SELECT `+messageColumns+`
+		 FROM watch_hits
+		 JOIN messages ON watch_hits.message_id = messages.id AND watch_hits.chat_jid = messages.chat_jid
+		 JOIN chats ON messages.chat_jid = chats.jid
+		 WHERE watch_hits.rule = ?
+		 ORDER BY watch_hits.matched_at DESC LIMIT ?`,
+		rule, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get watch hits: %w", err)
+	}
+	defer rows.Close()
+
+	result := []MessageDict{}
+	for rows.Next() {
+		m, err := scanMessage(rows)
+		if err != nil {
+			continue
+		}
+		result = append(result, rawToDict(m))
+	}
+	return result, nil
+}
@@ -0,0 +1,119 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+)
+
+// WriteBatchSize is the most rows the writer commits in one transaction.
+// History sync stores messages in chunks of this size.
+const WriteBatchSize = 500
+
+// writer serializes message writes on one goroutine. Writes queued while a
+// transaction commits are grouped into the next one, so bursts cost one
+// fsync instead of one per row and never contend for SQLite's write lock
+// among themselves.
+type writer struct {
+	mu     sync.RWMutex // held for reading while queueing, for writing to close
+	closed bool
+	ops    chan *writeOp
+	done   chan struct{}
+}
+
+type writeOp struct {
+	fn   func(tx *sql.Tx) error
+	rows int // rows fn writes, to size batches
+	err  chan error
+}
+
+func newWriter() *writer {
+	return &writer{ops: make(chan *writeOp, WriteBatchSize), done: make(chan struct{})}
+}
+
+// write runs fn in a transaction of the writer goroutine and waits for it
+// to commit. fn must not use the Store's other methods, which would block
+// on a connection held by the writer in low-memory mode.
+func (s *Store) write(rows int, fn func(tx *sql.Tx) error) error {
+	op := &writeOp{fn: fn, rows: rows, err: make(chan error, 1)}
+	s.writer.mu.RLock()
+	if s.writer.closed {
+		s.writer.mu.RUnlock()
+		return fmt.Errorf("message store is closed")
+	}
+	s.writer.ops <- op
+	s.writer.mu.RUnlock()
+	return <-op.err
+}
+
+// runWriter commits queued writes until the writer is closed.
+func (s *Store) runWriter() {
+	defer close(s.writer.done)
+	for op := range s.writer.ops {
+		batch := []*writeOp{op}
+		rows := op.rows
+	collect:
+		for rows < WriteBatchSize {
+			select {
+			case next, ok := <-s.writer.ops:
+				if !ok {
+					break collect
+				}
+				batch = append(batch, next)
+				rows += next.rows
+			default:
+				break collect
+			}
+		}
+		s.commitBatch(batch)
+	}
+}
+
+// commitBatch runs a batch of writes in one transaction. Each write gets a
+// savepoint, so a failing one is rolled back without taking the others
+// with it.
+func (s *Store) commitBatch(batch []*writeOp) {
+	errs := make([]error, len(batch))
+	tx, err := s.MsgDB.Begin()
+	if err == nil {
+		for i, op := range batch {
+			if _, err = tx.Exec("SAVEPOINT write"); err != nil {
+				break
+			}
+			if errs[i] = op.fn(tx); errs[i] != nil {
+				if _, err = tx.Exec("ROLLBACK TO write"); err != nil {
+					break
+				}
+			}
+			if _, err = tx.Exec("RELEASE write"); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			err = tx.Commit()
+		} else {
+			tx.Rollback()
+		}
+	}
+	for i, op := range batch {
+		if err != nil {
+			op.err <- fmt.Errorf("write messages: %w", err)
+		} else {
+			op.err <- errs[i]
+		}
+	}
+}
+
+// closeWriter commits the queued writes and stops the writer. Later writes
+// fail.
+func (s *Store) closeWriter() {
+	s.writer.mu.Lock()
+	if s.writer.closed {
+		s.writer.mu.Unlock()
+		return
+	}
+	s.writer.closed = true
+	close(s.writer.ops)
+	s.writer.mu.Unlock()
+	<-s.writer.done
+}
@@ -4,64 +4,487 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/CSCSoftware/wahoo/db"
 	mcpServer "github.com/CSCSoftware/wahoo/mcp"
+	"github.com/CSCSoftware/wahoo/metrics"
 	"github.com/CSCSoftware/wahoo/wa"
 )
 
 func main() {
+	configPath := flag.String("config", os.Getenv("WAHOO_CONFIG"), "Load settings from this YAML file (default: wahoo/config.yaml in the user config directory, if it exists); flags and WAHOO_* environment variables override it (also WAHOO_CONFIG)")
 	storeDir := flag.String("store-dir", "store", "Directory for SQLite databases")
-	flag.Parse()
+	account := flag.String("account", wa.DefaultAccount, "Account used when a tool call does not name one (named accounts live in <store-dir>/accounts/<name>)")
+	dupWindow := flag.Duration("dup-window", 2*time.Minute, "Window for detecting duplicate sends of the same text (0 disables)")
+	dupMode := flag.String("dup-mode", "warn", "What to do with duplicate sends: warn or refuse")
+	idempotencyWindow := flag.Duration("idempotency-window", 24*time.Hour, "How long send tools remember idempotency keys, returning the original result when a key is reused (0 ignores keys)")
+	rateLimitChat := flag.Int("rate-limit-chat", 0, "Most messages sent to one chat per minute (0 = unlimited)")
+	rateLimitGlobal := flag.Int("rate-limit-global", 0, "Most messages sent per minute across all chats of an account (0 = unlimited)")
+	rateLimitMode := flag.String("rate-limit-mode", "reject", "What to do with sends over the rate limit: reject, or queue them (up to 2 minutes)")
+	sendTimeout := flag.Duration("send-timeout", wa.DefaultTimeouts.Send, "Give up on sending a message after this long, failing the tool call with a timeout error (0 = no limit)")
+	mediaTimeout := flag.Duration("media-timeout", wa.DefaultTimeouts.Media, "Give up on uploading or downloading a media file after this long (0 = no limit)")
+	appStateTimeout := flag.Duration("app-state-timeout", wa.DefaultTimeouts.AppState, "Give up on syncing a chat change (archive, pin, mute, star, labels) after this long (0 = no limit)")
+	requestTimeout := flag.Duration("request-timeout", wa.DefaultTimeouts.Request, "Give up on other WhatsApp requests (groups, profile, blocklist, presence, channels) after this long (0 = no limit)")
+	autoDownload := flag.Bool("auto-download", false, "Automatically download incoming media")
+	maxImageMB := flag.Int("auto-download-max-image-mb", 10, "Largest image or GIF to auto-download in MB (0 = never)")
+	maxAudioMB := flag.Int("auto-download-max-audio-mb", 10, "Largest audio file to auto-download in MB (0 = never)")
+	maxDocumentMB := flag.Int("auto-download-max-document-mb", 25, "Largest document to auto-download in MB (0 = never)")
+	maxVideoMB := flag.Int("auto-download-max-video-mb", 0, "Largest video to auto-download in MB (0 = never)")
+	maxDownloadMB := flag.Int("max-download-mb", 0, "Refuse to download media files larger than this many MB, also on request (0 = unlimited)")
+	mediaMaxSizeMB := flag.Int("media-max-size-mb", 0, "Keep downloaded media per account within this size, deleting the oldest files hourly (0 = unlimited)")
+	mediaMaxAgeDays := flag.Int("media-max-age-days", 0, "Delete downloaded media older than this many days, checked hourly (0 = keep forever)")
+	retainDays := flag.Int("retain-days", 0, "Delete stored messages and their downloaded media older than this many days, checked hourly; chats can override it with set_chat_retention (0 = keep forever)")
+	importParticipants := flag.String("import-participants", "", "JSON file mapping the participant names of an exported chat to JIDs, phone numbers or \"me\", for import-chat")
+	importDateOrder := flag.String("import-date-order", db.DateOrderDMY, "How import-chat reads dates like 03/04/21 when the file doesn't tell: dmy or mdy")
+	backupDir := flag.String("backup-dir", "", "Write backups here, in a subdirectory per named account (default: <store-dir>/backups of each account)")
+	backupInterval := flag.Duration("backup-interval", 0, "Back up the messages database this often while serving, e.g. 24h (0 = never)")
+	backupKeep := flag.Int("backup-keep", 7, "Keep this many of the newest backups, deleting older ones (0 = keep all)")
+	backupMedia := flag.Bool("backup-media", false, "Include downloaded media in backups, and restore it with restore-store")
+	vacuumInterval := flag.Duration("vacuum-interval", 0, "VACUUM the messages database this often to return the space of deleted messages to disk, e.g. 168h (0 = never)")
+	pairPhone := flag.String("pair-phone", "", "Pair the default account by phone number (digits with country code) using a pairing code instead of the QR code")
+	banner := flag.String("banner", "wahoo - WhatsApp MCP Server", "Startup banner printed to stderr (empty to disable)")
+	strictStdio := flag.Bool("strict-stdio", false, "Guarantee that only MCP JSON reaches stdout by redirecting all other output to stderr")
+	notifyChat := flag.String("notify-chat", "", "Forward account events (logout, bans, repeated send failures) to this chat: \"self\" or a JID")
+	exportMetadata := flag.String("export-metadata", "", "Export the -account's local metadata (watch rules, chat profiles and states, identity links) to this JSON file and exit")
+	importMetadata := flag.String("import-metadata", "", "Import a metadata bundle written by -export-metadata into the -account and exit")
+	transcribeCmd := flag.String("transcribe-cmd", "", "Transcribe audio with this whisper.cpp binary, e.g. whisper-cli (needs -transcribe-model and ffmpeg)")
+	transcribeURL := flag.String("transcribe-url", "", "Transcribe audio with an OpenAI-compatible endpoint, e.g. https://api.openai.com/v1/audio/transcriptions (API key from WAHOO_TRANSCRIBE_API_KEY)")
+	transcribeModel := flag.String("transcribe-model", "", "ggml model file for -transcribe-cmd, or model name for -transcribe-url (default whisper-1)")
+	transcribeLang := flag.String("transcribe-language", "", "Spoken language code passed to the transcription backend (empty = auto-detect)")
+	embedCmd := flag.String("embed-cmd", "", "Index messages for semantic search with this llama.cpp binary, e.g. llama-embedding (needs -embed-model)")
+	embedURL := flag.String("embed-url", "", "Index messages for semantic search with an OpenAI-compatible endpoint, e.g. https://api.openai.com/v1/embeddings or Ollama's http://localhost:11434/v1/embeddings (API key from WAHOO_EMBED_API_KEY)")
+	embedModel := flag.String("embed-model", "", "GGUF embedding model file for -embed-cmd, or model name for -embed-url (default text-embedding-3-small)")
+	s3Bucket := flag.String("s3-bucket", "", "Archive downloaded and sent media in this S3 or MinIO bucket (credentials from WAHOO_S3_ACCESS_KEY and WAHOO_S3_SECRET_KEY)")
+	s3Endpoint := flag.String("s3-endpoint", "https://s3.amazonaws.com", "S3 endpoint, e.g. https://s3.eu-central-1.amazonaws.com or MinIO's http://localhost:9000")
+	s3Region := flag.String("s3-region", "us-east-1", "S3 region used to sign requests")
+	s3Prefix := flag.String("s3-prefix", "", "Prefix of the archived media object keys, e.g. wahoo/")
+	s3PathStyle := flag.Bool("s3-path-style", false, "Address the bucket in the URL path instead of the host name (needed by MinIO)")
+	mediaURLs := flag.Bool("media-urls", false, "Make download_media return a presigned URL of the archived copy instead of the local path (needs -s3-bucket)")
+	mediaURLExpiry := flag.Duration("media-url-expiry", time.Hour, "How long the URLs returned by -media-urls stay valid (at most 168h)")
+	autoTranscribe := flag.Bool("auto-transcribe", false, "Transcribe incoming audio messages automatically")
+	deleteRevoked := flag.Bool("delete-revoked", false, "Delete messages their sender revoked from the local database instead of keeping them flagged as revoked")
+	rejectUnknownCalls := flag.Bool("reject-unknown-calls", false, "Reject incoming 1:1 calls from numbers that are not in the address book")
+	rejectCallMessage := flag.String("reject-call-message", "", "Message sent to callers rejected by -reject-unknown-calls (empty sends none)")
+	lowMemory := flag.Bool("low-memory", false, "Tune for Raspberry Pi-class hosts: 192 MB Go heap soft limit, small SQLite caches, streamed media, smaller history sync")
+	dbKey := flag.String("db-key", os.Getenv("WAHOO_DB_KEY"), "Encrypt stored message text with this passphrase; an unencrypted database is encrypted on first use (also WAHOO_DB_KEY; prefer -db-key-file, command lines are visible to other users)")
+	dbKeyFile := flag.String("db-key-file", "", "Read the -db-key passphrase from this file")
+	metricsAddr := flag.String("metrics-addr", "", "Serve Prometheus metrics at http://<addr>/metrics, e.g. localhost:9464 (empty disables)")
+	readOnly := flag.Bool("read-only", envBool("WAHOO_READ_ONLY"), "Expose only query tools: no sending, revoking, blocking, chat management, requests to WhatsApp beyond queries, or file exports (also WAHOO_READ_ONLY=1)")
+	requireConfirmation := flag.Bool("require-confirmation", envBool("WAHOO_REQUIRE_CONFIRMATION"), "Make delete_chat, revoke_message and block_contact return a confirmation token and act only when called again with it (also WAHOO_REQUIRE_CONFIRMATION=1)")
+	auditLogPath := flag.String("audit-log", "", "Also append every write tool call to this JSONL file (calls are always recorded in the database; see get_audit_log)")
+	var mediaAllowDirs []string
+	flag.Func("media-allow-dir", "Only allow sending files from this directory (repeatable; downloaded media is always allowed). Without it any readable file can be sent", func(dir string) error {
+		if dir == "" {
+			return fmt.Errorf("empty directory")
+		}
+		mediaAllowDirs = append(mediaAllowDirs, dir)
+		return nil
+	})
+	sendPolicyFile := flag.String("send-policy", "", "Load allowed and denied recipients from this JSON file: {\"allow\": [...], \"deny\": [...]}")
+	sendPolicy := &wa.SendPolicy{}
+	flag.Func("send-allow", "Only allow sending to recipients matching this JID or phone number pattern, e.g. 4917* or *@g.us (repeatable)", func(pattern string) error {
+		sendPolicy.Allow = append(sendPolicy.Allow, pattern)
+		return wa.ValidSendPattern(pattern)
+	})
+	flag.Func("send-deny", "Refuse sending to recipients matching this JID or phone number pattern (repeatable)", func(pattern string) error {
+		sendPolicy.Deny = append(sendPolicy.Deny, pattern)
+		return wa.ValidSendPattern(pattern)
+	})
+
+	// "wahoo [command] [flags] [arguments]": the command defaults to serve
+	flag.Usage = usage
+	args := os.Args[1:]
+	command := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+	commandArgs, ok := lookupCommand(command)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", command)
+		usage()
+		os.Exit(2)
+	}
+	flag.CommandLine.Parse(args)
+	if want := len(strings.Fields(commandArgs)); flag.NArg() != want {
+		fmt.Fprintf(os.Stderr, "Usage: %s %s [flags] %s\n", filepath.Base(os.Args[0]), command, commandArgs)
+		os.Exit(2)
+	}
+	sources, loadedConfig, err := applySettings(flag.CommandLine, *configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	if *dupMode != "warn" && *dupMode != "refuse" {
+		fmt.Fprintf(os.Stderr, "Invalid -dup-mode %q (expected warn or refuse)\n", *dupMode)
+		os.Exit(1)
+	}
+	if *rateLimitMode != "reject" && *rateLimitMode != "queue" {
+		fmt.Fprintf(os.Stderr, "Invalid -rate-limit-mode %q (expected reject or queue)\n", *rateLimitMode)
+		os.Exit(1)
+	}
+	if !wa.ValidAccountName(*account) {
+		fmt.Fprintf(os.Stderr, "Invalid -account %q (letters, digits, - and _ only)\n", *account)
+		os.Exit(1)
+	}
+
+	if *sendPolicyFile != "" {
+		p, err := wa.LoadSendPolicy(*sendPolicyFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		sendPolicy.Allow = append(sendPolicy.Allow, p.Allow...)
+		sendPolicy.Deny = append(sendPolicy.Deny, p.Deny...)
+	}
+
+	key, err := readDBKey(*dbKey, *dbKeyFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	storeOpts := db.Options{LowMemory: *lowMemory, Key: key}
+
+	if command == "validate-config" {
+		if loadedConfig != "" {
+			fmt.Printf("Configuration OK (config file %s)\n\n", loadedConfig)
+		} else {
+			fmt.Printf("Configuration OK (no config file)\n\n")
+		}
+		printSettings(flag.CommandLine, sources)
+		return
+	}
+
+	if *exportMetadata != "" || *importMetadata != "" {
+		if err := runMetadataCommand(*storeDir, *account, storeOpts, *exportMetadata, *importMetadata); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	imports := db.ImportChatOpts{DateOrder: *importDateOrder}
+	if *importDateOrder != db.DateOrderDMY && *importDateOrder != db.DateOrderMDY {
+		fmt.Fprintf(os.Stderr, "Invalid -import-date-order %q (expected dmy or mdy)\n", *importDateOrder)
+		os.Exit(1)
+	}
+	if *importParticipants != "" {
+		if imports.Participants, err = loadParticipants(*importParticipants); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+	}
+	backups := wa.BackupConfig{Dir: *backupDir, Interval: *backupInterval, Keep: *backupKeep, Media: *backupMedia}
+
+	// configure applies the send guards and policies to an account's client
+	configure := func(client *wa.Client) {
+		client.DupGuard = wa.NewDuplicateGuard(*dupWindow, *dupMode)
+		client.RateLimit = wa.NewRateLimiter(*rateLimitChat, *rateLimitGlobal, *rateLimitMode)
+		client.MediaAllowDirs = mediaAllowDirs
+		client.SendPolicy = sendPolicy
+		client.DeleteRevoked = *deleteRevoked
+		client.RejectUnknownCalls = *rejectUnknownCalls
+		client.RejectCallMessage = *rejectCallMessage
+		client.ReadOnly = *readOnly
+		client.MaxDownloadBytes = int64(*maxDownloadMB) << 20
+		client.Timeouts = wa.Timeouts{Send: *sendTimeout, Media: *mediaTimeout, AppState: *appStateTimeout, Request: *requestTimeout}
+	}
+
+	if command != "serve" {
+		if err := runCommand(command, flag.Args(), *storeDir, *account, storeOpts, configure, *pairPhone, *readOnly, backups, imports); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Must happen before anything else can write to stdout
+	var mcpOut io.WriteCloser
+	if *strictStdio {
+		mcpOut, err = mcpServer.StrictStdout()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+	}
 
 	// All non-MCP output goes to stderr
-	fmt.Fprintln(os.Stderr, "wahoo - WhatsApp MCP Server")
+	if *banner != "" {
+		fmt.Fprintln(os.Stderr, *banner)
+	}
 	fmt.Fprintf(os.Stderr, "Store directory: %s\n", *storeDir)
+	if *readOnly {
+		fmt.Fprintln(os.Stderr, "Read-only mode: write tools disabled")
+	}
+	if *requireConfirmation {
+		fmt.Fprintln(os.Stderr, "Destructive tools require confirmation")
+	}
+	if len(mediaAllowDirs) > 0 {
+		fmt.Fprintf(os.Stderr, "Media allowed from: %s\n", strings.Join(mediaAllowDirs, ", "))
+	}
+	if !sendPolicy.Empty() {
+		fmt.Fprintf(os.Stderr, "Send policy: %d allowed and %d denied recipient patterns\n", len(sendPolicy.Allow), len(sendPolicy.Deny))
+	}
 
-	// Open databases
-	store, err := db.NewStore(*storeDir)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to open databases: %v\n", err)
+	if *metricsAddr != "" {
+		if err := serveMetrics(*metricsAddr); err != nil {
+			fmt.Fprintf(os.Stderr, "Metrics: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Metrics at http://%s/metrics\n", *metricsAddr)
+	}
+
+	var auditMirror io.Writer
+	if *auditLogPath != "" {
+		f, err := os.OpenFile(*auditLogPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Audit log: %v\n", err)
+			os.Exit(1)
+		}
+		auditMirror = f
+		fmt.Fprintf(os.Stderr, "Audit log mirrored to %s\n", *auditLogPath)
+	}
+
+	var transcriber wa.Transcriber
+	switch {
+	case *transcribeCmd != "" && *transcribeURL != "":
+		fmt.Fprintln(os.Stderr, "Use either -transcribe-cmd or -transcribe-url, not both")
+		os.Exit(1)
+	case *transcribeCmd != "":
+		if *transcribeModel == "" {
+			fmt.Fprintln(os.Stderr, "-transcribe-cmd needs -transcribe-model")
+			os.Exit(1)
+		}
+		transcriber = &wa.WhisperCPP{Binary: *transcribeCmd, Model: *transcribeModel, Language: *transcribeLang}
+	case *transcribeURL != "":
+		transcriber = &wa.HTTPTranscriber{URL: *transcribeURL, APIKey: os.Getenv("WAHOO_TRANSCRIBE_API_KEY"), Model: *transcribeModel, Language: *transcribeLang}
+	case *autoTranscribe:
+		fmt.Fprintln(os.Stderr, "-auto-transcribe needs -transcribe-cmd or -transcribe-url")
 		os.Exit(1)
 	}
-	defer store.Close()
 
-	// Create and connect WhatsApp client
-	ctx, cancel := context.WithCancel(context.Background())
+	var embedder wa.Embedder
+	switch {
+	case *embedCmd != "" && *embedURL != "":
+		fmt.Fprintln(os.Stderr, "Use either -embed-cmd or -embed-url, not both")
+		os.Exit(1)
+	case *embedCmd != "":
+		if *embedModel == "" {
+			fmt.Fprintln(os.Stderr, "-embed-cmd needs -embed-model")
+			os.Exit(1)
+		}
+		embedder = &wa.LlamaCPPEmbedder{Binary: *embedCmd, Model: *embedModel}
+	case *embedURL != "":
+		embedder = &wa.HTTPEmbedder{URL: *embedURL, APIKey: os.Getenv("WAHOO_EMBED_API_KEY"), Model: *embedModel}
+	}
+
+	var mediaArchive wa.MediaArchive
+	switch {
+	case *s3Bucket != "":
+		mediaArchive = &wa.S3Archive{
+			Endpoint:  *s3Endpoint,
+			Region:    *s3Region,
+			Bucket:    *s3Bucket,
+			Prefix:    *s3Prefix,
+			AccessKey: os.Getenv("WAHOO_S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("WAHOO_S3_SECRET_KEY"),
+			PathStyle: *s3PathStyle,
+		}
+		fmt.Fprintf(os.Stderr, "Media archived in S3 bucket %s at %s\n", *s3Bucket, *s3Endpoint)
+	case *mediaURLs:
+		fmt.Fprintln(os.Stderr, "-media-urls needs -s3-bucket")
+		os.Exit(1)
+	}
+
+	downloadWorkers := 2
+	if *lowMemory {
+		wa.EnableLowMemory()
+		downloadWorkers = wa.LowMemoryDownloadWorkers
+		fmt.Fprintf(os.Stderr, "Low-memory mode: heap soft limit %d MB\n", wa.LowMemoryHeapLimit>>20)
+	}
+
+	// SIGINT and SIGTERM cancel ctx, which makes the MCP server return so
+	// the accounts are closed cleanly below
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
-	client, err := wa.NewClient(store, *storeDir)
+	accounts := wa.NewAccounts(ctx, *storeDir, *account)
+	accounts.StoreOptions = storeOpts
+	accounts.Setup = func(a *wa.Account) {
+		client := a.Client
+		configure(client)
+		client.Transcriber = transcriber
+		client.Embedder = embedder
+		client.MediaArchive = mediaArchive
+		client.MediaURLs = *mediaURLs
+		client.MediaURLExpiry = *mediaURLExpiry
+		client.MediaQuota = wa.MediaQuota{
+			MaxBytes: int64(*mediaMaxSizeMB) << 20,
+			MaxAge:   time.Duration(*mediaMaxAgeDays) * 24 * time.Hour,
+		}
+		client.Retention = wa.Retention{Days: *retainDays, VacuumInterval: *vacuumInterval}
+		client.Backups = backups
+		if *notifyChat != "" {
+			client.EnableEventNotifications(*notifyChat)
+		}
+
+		if *autoDownload {
+			const mb = 1024 * 1024
+			client.StartAutoDownload(ctx, wa.AutoDownloadConfig{
+				Workers: downloadWorkers,
+				MaxBytes: map[string]uint64{
+					"image":    uint64(*maxImageMB) * mb,
+					"gif":      uint64(*maxImageMB) * mb,
+					"audio":    uint64(*maxAudioMB) * mb,
+					"document": uint64(*maxDocumentMB) * mb,
+					"video":    uint64(*maxVideoMB) * mb,
+				},
+			})
+		}
+
+		if *autoTranscribe {
+			client.StartAutoTranscribe(ctx)
+		}
+
+		if embedder != nil {
+			client.StartEmbeddingIndexer(ctx)
+		}
+
+		if client.MediaQuota.Enabled() {
+			client.StartMediaCleanup(ctx, client.MediaQuota)
+		}
+
+		// Runs without -retain-days too, for chats with their own retention
+		client.StartRetention(ctx, client.Retention)
+
+		if backups.Interval > 0 {
+			client.StartBackups(ctx, client.Backups)
+		}
+
+		if *readOnly {
+			return
+		}
+
+		// Retry failed sends in the background
+		client.StartOutboxWorker(ctx, 30*time.Second)
+	}
+
+	// Open the default account plus every account found on disk
+	names := accounts.Discover()
+	if !slices.Contains(names, *account) {
+		names = append(names, *account)
+	}
+	for _, name := range names {
+		a, err := accounts.Open(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open account: %v\n", err)
+			accounts.Close()
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Account %s: %s\n", a.Name, a.Dir)
+		if name == *account {
+			a.Client.PairPhone = *pairPhone
+		}
+		accounts.Connect(a)
+	}
+
+	// Create and run MCP server (blocks on stdin/stdout)
+	server := mcpServer.NewServer(accounts, mcpServer.Options{
+		ReadOnly:            *readOnly,
+		RequireConfirmation: *requireConfirmation,
+		AuditMirror:         auditMirror,
+		IdempotencyWindow:   *idempotencyWindow,
+	})
+	err = server.Run(ctx, mcpOut)
+	if ctx.Err() != nil {
+		err = nil // stopped by a signal
+	}
+
+	// Stop the workers, then let in-flight writes finish before the
+	// databases are checkpointed and closed. A second signal kills the
+	// process as usual.
+	fmt.Fprintln(os.Stderr, "Shutting down...")
+	cancel()
+	accounts.Close()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to create WhatsApp client: %v\n", err)
+		fmt.Fprintf(os.Stderr, "MCP server error: %v\n", err)
 		os.Exit(1)
 	}
+}
 
-	// Connect in background goroutine
-	go func() {
-		if err := client.Connect(ctx); err != nil {
-			fmt.Fprintf(os.Stderr, "WhatsApp connection error: %v\n", err)
-			// Don't exit - MCP server can still serve read-only DB queries
+// runMetadataCommand exports or imports an account's metadata bundle without
+// connecting to WhatsApp.
+func runMetadataCommand(storeDir, account string, opts db.Options, exportPath, importPath string) error {
+	store, err := db.OpenStore(accountDir(storeDir, account), opts)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	if importPath != "" {
+		b, err := store.ImportMetadataFile(importPath)
+		if err != nil {
+			return err
 		}
-	}()
+		fmt.Fprintf(os.Stderr, "Imported %s from %s\n", b.Summary(), importPath)
+	}
+	if exportPath != "" {
+		b, err := store.ExportMetadataFile(exportPath)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Exported %s to %s\n", b.Summary(), exportPath)
+	}
+	return nil
+}
 
-	// Handle OS signals for clean shutdown
+// serveMetrics starts the Prometheus metrics listener in the background.
+// The address is bound before returning so a busy port fails startup.
+func serveMetrics(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
 	go func() {
-		sigChan := make(chan os.Signal, 1)
-		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-		<-sigChan
-		fmt.Fprintln(os.Stderr, "Shutting down...")
-		cancel()
-		client.Disconnect()
-		os.Exit(0)
+		if err := http.Serve(ln, mux); err != nil {
+			fmt.Fprintf(os.Stderr, "Metrics listener stopped: %v\n", err)
+		}
 	}()
+	return nil
+}
 
-	// Create and run MCP server (blocks on stdin/stdout)
-	server := mcpServer.NewServer(store, client)
-	if err := server.Run(ctx); err != nil {
-		fmt.Fprintf(os.Stderr, "MCP server error: %v\n", err)
-		os.Exit(1)
+// envBool reports whether the environment variable is set to a true value
+// such as 1 or true.
+func envBool(name string) bool {
+	v, _ := strconv.ParseBool(os.Getenv(name))
+	return v
+}
+
+// readDBKey returns the database key from -db-key or, if set, -db-key-file.
+func readDBKey(key, keyFile string) (string, error) {
+	if keyFile == "" {
+		return key, nil
+	}
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return "", fmt.Errorf("read -db-key-file: %w", err)
+	}
+	key = strings.TrimSpace(string(data))
+	if key == "" {
+		return "", fmt.Errorf("-db-key-file %s is empty", keyFile)
 	}
+	return key, nil
 }
@@ -0,0 +1,141 @@
+package mcp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/CSCSoftware/wahoo/db"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// auditLog records the calls of write tools in the audit table of the
+// account they act on, and optionally mirrors them to a JSONL file.
+type auditLog struct {
+	mu       sync.Mutex
+	mirrorTo io.Writer                     // JSONL mirror, nil if not configured
+	sessions map[*mcp.ServerSession]string // IDs for sessions whose transport has none
+}
+
+func newAuditLog(mirror io.Writer) *auditLog {
+	return &auditLog{mirrorTo: mirror, sessions: make(map[*mcp.ServerSession]string)}
+}
+
+// sessionID identifies the MCP session of a call. Stdio sessions have no
+// ID of their own, so they get a random one for their lifetime, forgotten
+// once the session's connection closes.
+func (a *auditLog) sessionID(ss *mcp.ServerSession) string {
+	if ss == nil {
+		return ""
+	}
+	if id := ss.ID(); id != "" {
+		return id
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	id, ok := a.sessions[ss]
+	if !ok {
+		b := make([]byte, 8)
+		rand.Read(b)
+		id = hex.EncodeToString(b)
+		a.sessions[ss] = id
+		go func() {
+			ss.Wait()
+			a.mu.Lock()
+			delete(a.sessions, ss)
+			a.mu.Unlock()
+		}()
+	}
+	return id
+}
+
+// mirror appends an entry to the JSONL mirror.
+func (a *auditLog) mirror(account string, e db.AuditEntry) error {
+	if a.mirrorTo == nil {
+		return nil
+	}
+	line, err := json.Marshal(struct {
+		Account string `json:"account,omitempty"`
+		db.AuditEntry
+		Arguments json.RawMessage `json:"arguments,omitempty"` // as JSON rather than a string
+	}{account, e, json.RawMessage(e.Arguments)})
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, err = a.mirrorTo.Write(append(line, '\n'))
+	return err
+}
+
+// auditToolCalls is a receiving middleware that records every call of a
+// write tool, including calls rejected in read-only mode.
+func (s *Server) auditToolCalls(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		call, ok := req.(*mcp.CallToolRequest)
+		if !ok || call.Params == nil || !isWriteTool(call.Params.Name) {
+			return next(ctx, method, req)
+		}
+
+		start := time.Now()
+		res, err := next(ctx, method, req)
+		s.recordAudit(call, res, err, start)
+		return res, err
+	}
+}
+
+func (s *Server) recordAudit(call *mcp.CallToolRequest, res mcp.Result, callErr error, start time.Time) {
+	var args struct {
+		Account string `json:"account"`
+	}
+	json.Unmarshal(call.Params.Arguments, &args)
+
+	e := db.AuditEntry{
+		Tool:       call.Params.Name,
+		Arguments:  string(call.Params.Arguments),
+		Success:    callErr == nil && !failedResult(res),
+		DurationMS: time.Since(start).Milliseconds(),
+	}
+	if e.Arguments == "" {
+		e.Arguments = "{}"
+	}
+	if session := s.audit.sessionID(call.Session); session != "" {
+		e.Session = &session
+	}
+	if call.Session != nil {
+		if p := call.Session.InitializeParams(); p != nil && p.ClientInfo != nil {
+			client := p.ClientInfo.Name + " " + p.ClientInfo.Version
+			e.Client = &client
+		}
+	}
+	if callErr != nil {
+		e.Result = callErr.Error()
+	} else if result, ok := res.(*mcp.CallToolResult); ok && len(result.Content) > 0 {
+		if text, ok := result.Content[0].(*mcp.TextContent); ok {
+			e.Result = text.Text
+		}
+	}
+
+	// Calls for unknown accounts, like add_account's, go to the default one
+	store, _, err := s.account(args.Account)
+	if err != nil {
+		store, _, err = s.account("")
+	}
+	if err == nil {
+		e.ID, err = store.LogAudit(e, start)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Audit log: %v\n", err)
+	}
+	e.Timestamp = start.Format(time.RFC3339Nano)
+	if err := s.audit.mirror(args.Account, e); err != nil {
+		fmt.Fprintf(os.Stderr, "Audit log: %v\n", err)
+	}
+}
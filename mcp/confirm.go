@@ -0,0 +1,112 @@
+package mcp
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CSCSoftware/wahoo/db"
+)
+
+// confirmationTTL is how long a confirmation token can be used.
+const confirmationTTL = 5 * time.Minute
+
+// confirmInput is embedded in the inputs of destructive tools, which act
+// immediately unless asked for a dry run or the server requires confirmation.
+type confirmInput struct {
+	DryRun            bool   `json:"dry_run,omitempty" jsonschema:"Only report what would happen, without doing it"`
+	ConfirmationToken string `json:"confirmation_token,omitempty" jsonschema:"Token returned by the previous call when the server requires confirmation"`
+}
+
+// confirmations holds the tokens handed out in require-confirmation mode.
+// A token is good for one call of the tool with the same arguments.
+type confirmations struct {
+	mu      sync.Mutex
+	pending map[string]pendingConfirmation
+}
+
+type pendingConfirmation struct {
+	key     string // tool, account and targets of the call
+	expires time.Time
+}
+
+func newConfirmations() *confirmations {
+	return &confirmations{pending: make(map[string]pendingConfirmation)}
+}
+
+// issue returns a new token for the call identified by key.
+func (c *confirmations) issue(key string) string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	token := hex.EncodeToString(b)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for t, p := range c.pending {
+		if now.After(p.expires) {
+			delete(c.pending, t)
+		}
+	}
+	c.pending[token] = pendingConfirmation{key: key, expires: now.Add(confirmationTTL)}
+	return token
+}
+
+// redeem uses up token and reports whether it was issued for key and has
+// not expired.
+func (c *confirmations) redeem(token, key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p, ok := c.pending[token]
+	if !ok || p.key != key {
+		return false
+	}
+	delete(c.pending, token)
+	return time.Now().Before(p.expires)
+}
+
+// confirm checks a call of a destructive tool before it runs. description
+// says what the call would do; targets are the arguments it acts on. It
+// returns the result to respond with instead of running the tool, or nil if
+// the tool should go ahead.
+func (s *Server) confirm(tool string, input confirmInput, description string, targets ...string) *sendResult {
+	if input.DryRun {
+		return &sendResult{Success: true, Message: "Dry run: would " + description}
+	}
+	if s.confirmations == nil {
+		return nil
+	}
+
+	key := tool + "\x00" + strings.Join(targets, "\x00")
+	if input.ConfirmationToken == "" {
+		token := s.confirmations.issue(key)
+		return &sendResult{
+			Success:           false,
+			Message:           fmt.Sprintf("Confirmation required: this would %s. Call %s again with the same arguments and confirmation_token within %d minutes to proceed.", description, tool, int(confirmationTTL.Minutes())),
+			ConfirmationToken: token,
+		}
+	}
+	if !s.confirmations.redeem(input.ConfirmationToken, key) {
+		return &sendResult{Success: false, Message: fmt.Sprintf("Invalid or expired confirmation token: call %s without confirmation_token to get a new one", tool)}
+	}
+	return nil
+}
+
+// chatLabel names a chat or contact for confirmation messages.
+func chatLabel(store *db.Store, jid string) string {
+	if name := store.ResolveName(jid); name != "" && name != jid {
+		return fmt.Sprintf("%s (%s)", name, jid)
+	}
+	return jid
+}
+
+// preview shortens message text for confirmation messages.
+func preview(text string) string {
+	if r := []rune(text); len(r) > 80 {
+		return string(r[:80]) + "…"
+	}
+	return text
+}
@@ -0,0 +1,64 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/CSCSoftware/wahoo/db"
+	"github.com/CSCSoftware/wahoo/wa"
+)
+
+// idempotencyInput is embedded in the inputs of send tools, so agents can
+// retry a call whose result they missed without sending twice.
+type idempotencyInput struct {
+	IdempotencyKey string `json:"idempotency_key,omitempty" jsonschema:"Unique key for this send, e.g. a UUID; a retry with the same key returns the original result instead of sending again"`
+}
+
+// idempotent runs send for a call of tool unless the call's idempotency key
+// was used for tool within the server's idempotency window, in which case it
+// returns the result of that call. The key is only released when nothing was
+// sent or recorded for the outbox, e.g. because the call was rejected; a send
+// that failed or timed out keeps it, as it may have reached WhatsApp or will
+// be retried.
+func idempotent[R any](ctx context.Context, s *Server, store *db.Store, tool string, input idempotencyInput, send func(context.Context) (R, error)) (R, error) {
+	key := input.IdempotencyKey
+	if key == "" || s.idempotencyWindow <= 0 {
+		return send(ctx)
+	}
+
+	var result R
+	stored, claimed, err := store.ClaimIdempotencyKey(tool, key, s.idempotencyWindow)
+	if err != nil {
+		return result, err
+	}
+	if !claimed {
+		if stored == "" {
+			return result, fmt.Errorf("a %s call with idempotency key %q is still in progress or was interrupted; check before sending again with a new key", tool, key)
+		}
+		err := json.Unmarshal([]byte(stored), &result)
+		return result, err
+	}
+
+	ctx, attempts := wa.WithSendAttempts(ctx)
+	result, err = send(ctx)
+	if !attempts.Attempted() {
+		if err := store.ReleaseIdempotencyKey(tool, key); err != nil {
+			fmt.Fprintf(os.Stderr, "Idempotency key: %v\n", err)
+		}
+		return result, err
+	}
+	if err != nil {
+		// Without a result the key stays in progress, so a retry is refused
+		return result, err
+	}
+	data, err := json.Marshal(result)
+	if err == nil {
+		err = store.CompleteIdempotencyKey(tool, key, string(data))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Idempotency key: %v\n", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,60 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/CSCSoftware/wahoo/metrics"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+var (
+	toolCalls = metrics.NewCounter("wahoo_tool_calls_total",
+		"MCP tool calls by tool and outcome (ok or error).", "tool", "status")
+	toolDuration = metrics.NewHistogram("wahoo_tool_call_duration_seconds",
+		"Time to handle an MCP tool call.", metrics.DefBuckets, "tool")
+)
+
+// instrumentToolCalls is a receiving middleware that counts and times tool
+// calls. A call counts as an error if it fails, its result is an error or
+// it reports success=false.
+func instrumentToolCalls(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		call, ok := req.(*mcp.CallToolRequest)
+		if !ok || call.Params == nil {
+			return next(ctx, method, req)
+		}
+
+		start := time.Now()
+		res, err := next(ctx, method, req)
+		toolDuration.Observe(time.Since(start).Seconds(), call.Params.Name)
+
+		status := "ok"
+		if err != nil || failedResult(res) {
+			status = "error"
+		}
+		toolCalls.Inc(call.Params.Name, status)
+		return res, err
+	}
+}
+
+func failedResult(res mcp.Result) bool {
+	result, ok := res.(*mcp.CallToolResult)
+	if !ok {
+		return false
+	}
+	if result.IsError {
+		return true
+	}
+	// Typed tool output arrives marshaled; only send-style results have a
+	// success field, so skip decoding everything else
+	raw, ok := result.StructuredContent.(json.RawMessage)
+	if !ok || !bytes.Contains(raw, []byte(`"success":false`)) {
+		return false
+	}
+	var sr sendResult
+	return json.Unmarshal(raw, &sr) == nil && !sr.Success
+}
@@ -0,0 +1,130 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// writeTools are the tools that change WhatsApp state, the paired accounts
+// or rules that act on WhatsApp on their own, and those that make requests to
+// WhatsApp or other services or write files beyond the message database.
+// They are not registered in read-only mode.
+var writeTools = []string{
+	// Accounts
+	"add_account",
+	"request_pairing_code",
+	"set_profile_name",
+	"set_profile_status",
+	"set_profile_picture",
+
+	// Sending
+	"send_message",
+	"send_broadcast",
+	"create_template",
+	"send_template",
+	"retry_failed_sends",
+	"cancel_outbox_message",
+	"manage_send_policy",
+	"send_file",
+	"send_album",
+	"send_audio_message",
+	"send_sticker",
+	"send_gif",
+	"send_location",
+	"send_contact_card",
+	"post_status",
+	"create_poll",
+	"revoke_message",
+	"edit_message",
+
+	// Contacts
+	"set_contact_alias",
+	"block_contact",
+	"unblock_contact",
+
+	// Calls
+	"reject_call",
+
+	// Presence subscriptions announce us as online to WhatsApp
+	"subscribe_presence",
+	"get_presence_snapshot",
+
+	// Ask the phone or WhatsApp for messages
+	"sync_history",
+	"fetch_older_messages",
+	"fetch_newsletter_messages",
+
+	// Chat management
+	"mute_chat",
+	"pin_chat",
+	"star_message",
+	"archive_chat",
+	"set_chat_label",
+	"delete_chat",
+	"mark_chat_read",
+	"mark_messages_read",
+	"set_auto_read",
+	"set_send_profile",
+	"set_disappearing_timer",
+	"set_chat_retention",
+
+	// Groups
+	"revoke_group_invite_link",
+	"join_group_via_link",
+
+	// Channels
+	"follow_newsletter",
+	"unfollow_newsletter",
+	"send_newsletter_message",
+
+	// Download media, send it to the transcription backend or write files
+	"download_media",
+	"transcribe_audio",
+	"export_chat",
+	"export_metadata",
+	"backup_store",
+
+	// Deletes downloaded media and stored messages
+	"cleanup_media",
+	"purge_messages",
+	"restore_store",
+
+	// Adds messages to the local database
+	"import_chat_export",
+
+	// Moderation rules revoke messages; imported metadata may contain them
+	"add_moderation_rule",
+	"import_metadata",
+}
+
+// isWriteTool reports whether name is one of writeTools.
+func isWriteTool(name string) bool {
+	for _, t := range writeTools {
+		if t == name {
+			return true
+		}
+	}
+	return false
+}
+
+// enableReadOnly removes the write tools and rejects calls to them, so
+// clients that cached the tool list get a clear error instead of an
+// unknown tool.
+func (s *Server) enableReadOnly() {
+	s.mcpServer.RemoveTools(writeTools...)
+	s.mcpServer.AddReceivingMiddleware(func(next mcp.MethodHandler) mcp.MethodHandler {
+		return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+			if call, ok := req.(*mcp.CallToolRequest); ok && call.Params != nil && isWriteTool(call.Params.Name) {
+				return &mcp.CallToolResult{
+					IsError: true,
+					Content: []mcp.Content{&mcp.TextContent{
+						Text: fmt.Sprintf("%s is disabled: the server is running in read-only mode", call.Params.Name),
+					}},
+				}, nil
+			}
+			return next(ctx, method, req)
+		}
+	})
+}
@@ -0,0 +1,283 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/CSCSoftware/wahoo/db"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// watchURIPrefix is the URI scheme for watch rule hit streams: whatsapp://watch/{rule}
+const watchURIPrefix = "whatsapp://watch/"
+
+// messagesURI is the stream of new messages of the default account. Adding
+// /{chat_jid} narrows it to one chat.
+const messagesURI = "whatsapp://messages"
+
+// recentMessagesLimit is the number of messages returned when a messages resource is read.
+const recentMessagesLimit = 20
+
+// connectionURI is the connection status resource of the default account.
+const connectionURI = "whatsapp://connection"
+
+// pairingURI is the pairing QR code of the default account. Adding /{account}
+// selects another account.
+const pairingURI = "whatsapp://pairing"
+
+// registerResources registers the MCP resources and resource templates.
+func (s *Server) registerResources() {
+	s.mcpServer.AddResourceTemplate(&mcp.ResourceTemplate{
+		Name:        "watch",
+		URITemplate: watchURIPrefix + "{rule}",
+		Description: "Recent WhatsApp messages matching a watch rule of the default account (see add_watch_rule). Subscribe to get notified of new hits.",
+		MIMEType:    "application/json",
+	}, s.handleReadWatch)
+
+	s.mcpServer.AddResource(&mcp.Resource{
+		Name:        "messages",
+		URI:         messagesURI,
+		Description: "Recent WhatsApp messages of the default account. Subscribe to be pushed every new message; the notification's _meta.message holds it in list_messages format.",
+		MIMEType:    "application/json",
+	}, s.handleReadMessages)
+
+	s.mcpServer.AddResourceTemplate(&mcp.ResourceTemplate{
+		Name:        "chat_messages",
+		URITemplate: messagesURI + "/{+chat_jid}",
+		Description: "Recent messages of one WhatsApp chat of the default account. Subscribe to be pushed new messages of that chat only.",
+		MIMEType:    "application/json",
+	}, s.handleReadMessages)
+
+	s.mcpServer.AddResource(&mcp.Resource{
+		Name:        "connection",
+		URI:         connectionURI,
+		Description: "Connection and session status of the default WhatsApp account (see get_connection_status). Subscribe to get notified of changes.",
+		MIMEType:    "application/json",
+	}, s.handleReadConnection)
+
+	s.mcpServer.AddResource(&mcp.Resource{
+		Name:        "pairing",
+		URI:         pairingURI,
+		Description: "Pairing state and current QR code of the default WhatsApp account (see get_pairing_qr). Subscribe to get notified whenever the code rotates or pairing ends.",
+		MIMEType:    "application/json",
+	}, s.handleReadPairing)
+
+	s.mcpServer.AddResourceTemplate(&mcp.ResourceTemplate{
+		Name:        "account_pairing",
+		URITemplate: pairingURI + "/{account}",
+		Description: "Pairing state and current QR code of one WhatsApp account. Subscribe to get notified whenever the code rotates or pairing ends.",
+		MIMEType:    "application/json",
+	}, s.handleReadPairing)
+}
+
+// watchRuleFromURI extracts the rule name from a whatsapp://watch/{rule} URI.
+func watchRuleFromURI(uri string) (string, bool) {
+	rule, ok := strings.CutPrefix(uri, watchURIPrefix)
+	return rule, ok && rule != ""
+}
+
+func (s *Server) handleReadWatch(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+	rule, ok := watchRuleFromURI(req.Params.URI)
+	if !ok {
+		return nil, mcp.ResourceNotFoundError(req.Params.URI)
+	}
+	store, _, err := s.account("")
+	if err != nil {
+		return nil, err
+	}
+	r, err := store.GetWatchRule(rule)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil {
+		return nil, mcp.ResourceNotFoundError(req.Params.URI)
+	}
+
+	hits, err := store.GetWatchHits(rule, 50)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(map[string]any{"rule": r, "messages": hits, "count": len(hits)})
+	if err != nil {
+		return nil, err
+	}
+	return &mcp.ReadResourceResult{Contents: []*mcp.ResourceContents{{
+		URI:      req.Params.URI,
+		MIMEType: "application/json",
+		Text:     string(data),
+	}}}, nil
+}
+
+// chatFromMessagesURI extracts the chat JID from a whatsapp://messages/{chat_jid}
+// URI; it is empty for whatsapp://messages itself.
+func chatFromMessagesURI(uri string) (string, bool) {
+	if uri == messagesURI {
+		return "", true
+	}
+	chatJID, ok := strings.CutPrefix(uri, messagesURI+"/")
+	return chatJID, ok && chatJID != ""
+}
+
+func (s *Server) handleReadMessages(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+	chatJID, ok := chatFromMessagesURI(req.Params.URI)
+	if !ok {
+		return nil, mcp.ResourceNotFoundError(req.Params.URI)
+	}
+	store, _, err := s.account("")
+	if err != nil {
+		return nil, err
+	}
+
+	opts := db.ListMessagesOpts{Limit: recentMessagesLimit}
+	if chatJID != "" {
+		opts.ChatJID = &chatJID
+	}
+	messages, _, err := store.ListMessages(opts)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(map[string]any{"messages": messages, "count": len(messages)})
+	if err != nil {
+		return nil, err
+	}
+	return &mcp.ReadResourceResult{Contents: []*mcp.ResourceContents{{
+		URI:      req.Params.URI,
+		MIMEType: "application/json",
+		Text:     string(data),
+	}}}, nil
+}
+
+func (s *Server) handleReadConnection(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+	_, client, err := s.account("")
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(connectionStatusFrom(client.GetConnectionStatus()))
+	if err != nil {
+		return nil, err
+	}
+	return &mcp.ReadResourceResult{Contents: []*mcp.ResourceContents{{
+		URI:      req.Params.URI,
+		MIMEType: "application/json",
+		Text:     string(data),
+	}}}, nil
+}
+
+// accountFromPairingURI extracts the account name from a
+// whatsapp://pairing/{account} URI; it is empty for whatsapp://pairing itself.
+func accountFromPairingURI(uri string) (string, bool) {
+	if uri == pairingURI {
+		return "", true
+	}
+	account, ok := strings.CutPrefix(uri, pairingURI+"/")
+	return account, ok && account != ""
+}
+
+func (s *Server) handleReadPairing(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+	name, ok := accountFromPairingURI(req.Params.URI)
+	if !ok {
+		return nil, mcp.ResourceNotFoundError(req.Params.URI)
+	}
+	a, err := s.accounts.Get(name)
+	if err != nil {
+		return nil, mcp.ResourceNotFoundError(req.Params.URI)
+	}
+	result, _ := pairingQRFor(a)
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	return &mcp.ReadResourceResult{Contents: []*mcp.ResourceContents{{
+		URI:      req.Params.URI,
+		MIMEType: "application/json",
+		Text:     string(data),
+	}}}, nil
+}
+
+// handleSubscribe only accepts subscriptions to the connection status, the
+// pairing QR codes, the message streams and existing watch rules.
+func (s *Server) handleSubscribe(ctx context.Context, req *mcp.SubscribeRequest) error {
+	if req.Params.URI == connectionURI {
+		return nil
+	}
+	if name, ok := accountFromPairingURI(req.Params.URI); ok {
+		if _, err := s.accounts.Get(name); err != nil {
+			return mcp.ResourceNotFoundError(req.Params.URI)
+		}
+		return nil
+	}
+	if _, ok := chatFromMessagesURI(req.Params.URI); ok {
+		return nil
+	}
+	rule, ok := watchRuleFromURI(req.Params.URI)
+	if !ok {
+		return fmt.Errorf("resource %s does not support subscriptions", req.Params.URI)
+	}
+	store, _, err := s.account("")
+	if err != nil {
+		return err
+	}
+	r, err := store.GetWatchRule(rule)
+	if err != nil {
+		return err
+	}
+	if r == nil {
+		return mcp.ResourceNotFoundError(req.Params.URI)
+	}
+	return nil
+}
+
+func (s *Server) handleUnsubscribe(ctx context.Context, req *mcp.UnsubscribeRequest) error {
+	return nil
+}
+
+// notifyConnectionChange tells subscribed clients that the connection status changed.
+func (s *Server) notifyConnectionChange() {
+	_ = s.mcpServer.ResourceUpdated(context.Background(), &mcp.ResourceUpdatedNotificationParams{
+		URI: connectionURI,
+	})
+}
+
+// notifyPairing tells subscribed clients that an account's pairing QR code
+// rotated or pairing ended.
+func (s *Server) notifyPairing(account string) {
+	uris := []string{pairingURI + "/" + account}
+	if account == s.accounts.Default {
+		uris = append(uris, pairingURI)
+	}
+	for _, uri := range uris {
+		_ = s.mcpServer.ResourceUpdated(context.Background(), &mcp.ResourceUpdatedNotificationParams{
+			URI: uri,
+		})
+	}
+}
+
+// notifyMessage pushes a newly stored message to clients subscribed to all
+// messages or to its chat.
+func (s *Server) notifyMessage(chatJID, messageID string) {
+	store, _, err := s.account("")
+	if err != nil {
+		return
+	}
+	msg, err := store.GetMessage(messageID, chatJID)
+	if err != nil || msg == nil {
+		return
+	}
+	meta := mcp.Meta{"message": msg}
+	for _, uri := range []string{messagesURI, messagesURI + "/" + chatJID} {
+		_ = s.mcpServer.ResourceUpdated(context.Background(), &mcp.ResourceUpdatedNotificationParams{
+			Meta: meta,
+			URI:  uri,
+		})
+	}
+}
+
+// notifyWatchHit tells subscribed clients that a watch rule has a new hit.
+func (s *Server) notifyWatchHit(rule string) {
+	_ = s.mcpServer.ResourceUpdated(context.Background(), &mcp.ResourceUpdatedNotificationParams{
+		URI: watchURIPrefix + rule,
+	})
+}
@@ -2,6 +2,9 @@ package mcp
 
 import (
 	"context"
+	"io"
+	"os"
+	"time"
 
 	"github.com/CSCSoftware/wahoo/db"
 	"github.com/CSCSoftware/wahoo/wa"
@@ -9,30 +12,89 @@ import (
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 )
 
-// Server wraps the MCP server with our store and WhatsApp client.
+// Server wraps the MCP server with our WhatsApp accounts.
 type Server struct {
 	mcpServer *mcp.Server
-	store     *db.Store
-	client    *wa.Client
+	accounts  *wa.Accounts
+	readOnly  bool
+
+	confirmations *confirmations // set in require-confirmation mode
+	audit         *auditLog
+
+	idempotencyWindow time.Duration
 }
 
-// NewServer creates an MCP server with all WhatsApp tools registered.
-func NewServer(store *db.Store, client *wa.Client) *Server {
+// Options configures NewServer.
+type Options struct {
+	ReadOnly bool // expose only query tools and reject calls to write tools
+
+	// RequireConfirmation makes destructive tools return a confirmation
+	// token and act only when called again with it.
+	RequireConfirmation bool
+
+	// AuditMirror, if set, receives every audit log entry as a JSON line.
+	AuditMirror io.Writer
+
+	// IdempotencyWindow is how long send tools remember idempotency keys;
+	// 0 ignores them.
+	IdempotencyWindow time.Duration
+}
+
+// NewServer creates an MCP server with all WhatsApp tools and resources registered.
+func NewServer(accounts *wa.Accounts, opts Options) *Server {
 	s := &Server{
-		store:  store,
-		client: client,
+		accounts: accounts,
+		readOnly: opts.ReadOnly,
+		audit:    newAuditLog(opts.AuditMirror),
+
+		idempotencyWindow: opts.IdempotencyWindow,
+	}
+	if opts.RequireConfirmation {
+		s.confirmations = newConfirmations()
 	}
 
 	s.mcpServer = mcp.NewServer(&mcp.Implementation{
 		Name:    "whatsapp",
 		Version: "1.0.0",
-	}, nil)
+	}, &mcp.ServerOptions{
+		SubscribeHandler:   s.handleSubscribe,
+		UnsubscribeHandler: s.handleUnsubscribe,
+	})
 
 	s.registerTools()
+	s.registerResources()
+	s.mcpServer.AddReceivingMiddleware(instrumentToolCalls)
+	if s.readOnly {
+		s.enableReadOnly()
+	}
+	// Added last, so calls rejected in read-only mode are recorded too
+	s.mcpServer.AddReceivingMiddleware(s.auditToolCalls)
+
+	accounts.OnQRCode = s.notifyPairing
+
+	// Watch, message and connection resources are served from the default account
+	if a, err := accounts.Get(""); err == nil {
+		a.Client.OnWatchHit = s.notifyWatchHit
+		a.Client.OnMessage = s.notifyMessage
+		a.Client.OnConnectionChange = s.notifyConnectionChange
+	}
 	return s
 }
 
-// Run starts the MCP server on stdio (blocking).
-func (s *Server) Run(ctx context.Context) error {
-	return s.mcpServer.Run(ctx, &mcp.StdioTransport{})
+// account resolves the store and client for a tool call. An empty name selects the default account.
+func (s *Server) account(name string) (*db.Store, *wa.Client, error) {
+	a, err := s.accounts.Get(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return a.Store, a.Client, nil
+}
+
+// Run starts the MCP server on stdio (blocking). If out is non-nil (see
+// StrictStdout) it replaces os.Stdout as the output stream.
+func (s *Server) Run(ctx context.Context, out io.WriteCloser) error {
+	if out == nil {
+		return s.mcpServer.Run(ctx, &mcp.StdioTransport{})
+	}
+	return s.mcpServer.Run(ctx, &mcp.IOTransport{Reader: os.Stdin, Writer: out})
 }
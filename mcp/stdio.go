@@ -0,0 +1,62 @@
+package mcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// StrictStdout takes exclusive ownership of stdout for the MCP stream.
+// The original stdout is duplicated for MCP use and file descriptor 1 (and
+// os.Stdout) is pointed at stderr, so stray prints from any library end up in
+// the log instead of corrupting the protocol. A self-check verifies the
+// redirect before anything is written. Every line written to the returned
+// writer must be a JSON message; anything else is diverted to stderr.
+func StrictStdout() (io.WriteCloser, error) {
+	out, err := redirectStdout()
+	if err != nil {
+		return nil, fmt.Errorf("strict stdio: %w", err)
+	}
+	if err := checkStdoutRedirected(); err != nil {
+		return nil, fmt.Errorf("strict stdio self-check failed: %w", err)
+	}
+	os.Stdout = os.Stderr
+	return &jsonLineWriter{out: out}, nil
+}
+
+// jsonLineWriter forwards complete newline-delimited JSON messages and
+// diverts any other output to stderr.
+type jsonLineWriter struct {
+	mu  sync.Mutex
+	out *os.File
+	buf []byte
+}
+
+func (w *jsonLineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		line := w.buf[:i+1]
+		if json.Valid(line) {
+			if _, err := w.out.Write(line); err != nil {
+				return 0, err
+			}
+		} else {
+			fmt.Fprintf(os.Stderr, "strict stdio: diverted non-JSON output: %q\n", line)
+		}
+		w.buf = w.buf[i+1:]
+	}
+}
+
+func (w *jsonLineWriter) Close() error {
+	return w.out.Close()
+}
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package mcp
+
+import (
+	"errors"
+	"os"
+)
+
+func redirectStdout() (*os.File, error) {
+	return nil, errors.New("not supported on this platform")
+}
+
+func checkStdoutRedirected() error {
+	return nil
+}
@@ -0,0 +1,38 @@
+//go:build unix
+
+package mcp
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// redirectStdout duplicates the real stdout and points file descriptor 1 at stderr.
+func redirectStdout() (*os.File, error) {
+	fd, err := unix.Dup(1)
+	if err != nil {
+		return nil, fmt.Errorf("dup stdout: %w", err)
+	}
+	if err := unix.Dup2(2, 1); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("redirect stdout: %w", err)
+	}
+	return os.NewFile(uintptr(fd), "mcp-stdout"), nil
+}
+
+// checkStdoutRedirected verifies that file descriptor 1 now refers to stderr.
+func checkStdoutRedirected() error {
+	var out, errOut unix.Stat_t
+	if err := unix.Fstat(1, &out); err != nil {
+		return err
+	}
+	if err := unix.Fstat(2, &errOut); err != nil {
+		return err
+	}
+	if out.Dev != errOut.Dev || out.Ino != errOut.Ino {
+		return fmt.Errorf("file descriptor 1 does not point at stderr")
+	}
+	return nil
+}
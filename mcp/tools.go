@@ -2,33 +2,120 @@ package mcp
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/CSCSoftware/wahoo/db"
+	"github.com/CSCSoftware/wahoo/wa"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"rsc.io/qr"
 )
 
-// registerTools registers all 21 WhatsApp MCP tools.
+// watchRuleNamePattern restricts rule names to characters that are safe in resource URIs.
+var watchRuleNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// registerTools registers all 112 WhatsApp MCP tools. In read-only mode the
+// write tools are removed again by enableReadOnly.
 func (s *Server) registerTools() {
+	// === Account tools ===
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "list_accounts",
+		Description: "List the WhatsApp accounts served by this server and whether each is connected. Other tools take an optional account parameter.",
+	}, s.handleListAccounts)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "add_account",
+		Description: "Add a new named WhatsApp account and start QR pairing. Returns the QR code text to scan with WhatsApp (Linked devices); call again for a fresh code if it expires.",
+	}, s.handleAddAccount)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "request_pairing_code",
+		Description: "Pair an account by phone number instead of QR code. Returns an 8-character code to enter on the phone under Linked devices > Link with phone number. Creates the account if it does not exist.",
+	}, s.handleRequestPairingCode)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "get_pairing_qr",
+		Description: "Get the QR code for pairing an unpaired account, as text and as a PNG image to show the user, who scans it with WhatsApp > Linked devices > Link a device. Codes rotate about every 20 seconds: pass the last code as previous_code to wait for the next one, or subscribe to whatsapp://pairing.",
+	}, s.handleGetPairingQR)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "set_profile_name",
+		Description: "Set the account's profile (push) name that other WhatsApp users see.",
+	}, s.handleSetProfileName)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "set_profile_status",
+		Description: "Set the account's \"About\" text. An empty text clears it.",
+	}, s.handleSetProfileStatus)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "set_profile_picture",
+		Description: "Set the account's profile picture from a JPEG, PNG or GIF file. The image is cropped to a centered square and scaled to 640x640. An empty path removes the picture.",
+	}, s.handleSetProfilePicture)
+
 	// === Read-only DB tools (no WhatsApp client needed) ===
 
 	mcp.AddTool(s.mcpServer, &mcp.Tool{
 		Name:        "search_contacts",
-		Description: "Search WhatsApp contacts by name or phone number.",
+		Description: "Search WhatsApp contacts by name, alias or phone number. Set check_is_business to tell WhatsApp Business accounts from personal ones.",
 	}, s.handleSearchContacts)
 
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "set_contact_alias",
+		Description: "Set a local alias for a contact, shown as the sender name of their messages instead of their WhatsApp name and matched by search_contacts. Omit alias to remove it. The alias is stored locally; WhatsApp is not changed.",
+	}, s.handleSetContactAlias)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "list_security_events",
+		Description: "List changes of contacts' security codes, newest first. A code changes when a contact reinstalls WhatsApp or switches phones, but also when someone else takes over their account: before sending sensitive content to a contact with a recent change (search_contacts sets security_code_changed_at), warn the user to verify the contact another way.",
+	}, s.handleListSecurityEvents)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "get_business_profile",
+		Description: "Get the public profile of a WhatsApp Business account: verified name, description, categories, address, email, websites and opening hours.",
+	}, s.handleGetBusinessProfile)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "check_numbers",
+		Description: "Check which phone numbers are registered on WhatsApp, e.g. before messaging a list of prospects: returns the JID, whether the number is on WhatsApp and whether it is a business account. Up to 100 numbers per call; results are cached.",
+	}, s.handleCheckNumbers)
+
 	mcp.AddTool(s.mcpServer, &mcp.Tool{
 		Name:        "list_messages",
-		Description: "Get WhatsApp messages matching specified criteria with optional context.",
+		Description: "Get WhatsApp messages matching specified criteria with optional context. total_count and has_more count matching messages, not context. max_total_messages and max_chars bound the size of the result; truncated is set when they cut anything. While has_more is true, pass next_cursor as cursor to get the next page; unlike page numbers, cursors don't shift when new messages arrive.",
 	}, s.handleListMessages)
 
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "list_mentions",
+		Description: "List the messages that @-mention you, newest first, optionally in one chat. Paging works as in list_messages.",
+	}, s.handleListMentions)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "list_starred_messages",
+		Description: "List starred messages, newest first, optionally in one chat: messages bookmarked with star_message or starred on the phone. Paging works as in list_messages.",
+	}, s.handleListStarredMessages)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "semantic_search_messages",
+		Description: "Search messages by meaning rather than keywords, so paraphrases match: returns the top-k most similar messages, best first, with a similarity score. Requires an embedding backend configured at startup; messages are indexed in the background, and indexed_messages tells how many are searchable so far.",
+	}, s.handleSemanticSearchMessages)
+
 	mcp.AddTool(s.mcpServer, &mcp.Tool{
 		Name:        "list_chats",
-		Description: "Get WhatsApp chats matching specified criteria.",
+		Description: "Get WhatsApp chats matching specified criteria. Archived, pinned and muted flags mirror the phone; pinned chats sort first by last activity.",
 	}, s.handleListChats)
 
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "list_unread_chats",
+		Description: "List chats that need attention: chats with unread incoming messages, most unread first, then most recent. Read state follows mark_chat_as_read, read receipts and reading on other devices.",
+	}, s.handleListUnreadChats)
+
 	mcp.AddTool(s.mcpServer, &mcp.Tool{
 		Name:        "get_chat",
 		Description: "Get WhatsApp chat metadata by JID.",
@@ -54,38 +141,303 @@ func (s *Server) registerTools() {
 		Description: "Get context around a specific WhatsApp message.",
 	}, s.handleGetMessageContext)
 
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "get_thread",
+		Description: "Get the reply chain of a WhatsApp message: the messages it quotes back to the start of the thread, oldest first, and the direct replies it received.",
+	}, s.handleGetThread)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "sync_history",
+		Description: "Ask the phone for older messages of a chat to fill gaps in the local history: up to count messages before the given message, or before the oldest stored one. The phone must be online; the messages are stored asynchronously as it answers.",
+	}, s.handleSyncHistory)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "fetch_older_messages",
+		Description: "Fetch older messages of a chat from the phone and wait for them: up to count messages sent before the given date, or before the oldest stored message. Reports how many new messages were stored. The phone must be online.",
+	}, s.handleFetchOlderMessages)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "get_sync_status",
+		Description: "Get the progress of history sync: chunks received from the phone and whether they were processed, messages stored, and which chats have their full history. Chunks interrupted by a restart are processed again on the next connect.",
+	}, s.handleGetSyncStatus)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "get_chat_heatmap",
+		Description: "Count messages of a chat or contact by weekday and hour of day (local time), with the busiest slots. Use it to answer questions like when a contact is usually active or best reached.",
+	}, s.handleGetChatHeatmap)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "get_chat_statistics",
+		Description: "Summarize messaging activity in a chat, or across all chats, over an optional date range: message counts per sender, per day and per hour, text vs media breakdown, average response times, and the most active chats. Useful for \"summarize my last month\" requests.",
+	}, s.handleGetChatStatistics)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "get_chat_digest",
+		Description: "Get a compact, token-efficient digest of one chat over a time window for summarizing: participants with message counts, an hourly/daily/weekly timeline, and a one-line-per-message transcript trimmed to a token budget (most recent messages kept). Use instead of paging through list_messages when summarizing long chats.",
+	}, s.handleGetChatDigest)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "list_groups",
+		Description: "List WhatsApp groups you are a member of, from the local cache.",
+	}, s.handleListGroups)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "get_group_info",
+		Description: "Get WhatsApp group metadata and participants (with admin flags) from the local cache. announce means only admins can send messages, locked that only admins can edit the group info, and member_add_mode who can add members.",
+	}, s.handleGetGroupInfo)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "get_group_history",
+		Description: "Get a group's recent messages merged chronologically with participant changes (joins, adds, leaves, removes, promotions, demotions), showing who added or removed whom. Participant changes are recorded from when they are observed live.",
+	}, s.handleGetGroupHistory)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "list_contact_statuses",
+		Description: "List unexpired WhatsApp status updates (stories) posted by contacts, optionally for a single contact.",
+	}, s.handleListContactStatuses)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "add_watch_rule",
+		Description: "Create or replace a listen-only watch rule. Matching incoming messages are exposed as the subscribable resource whatsapp://watch/{name}.",
+	}, s.handleAddWatchRule)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "remove_watch_rule",
+		Description: "Delete a watch rule and its recorded hits.",
+	}, s.handleRemoveWatchRule)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "list_watch_rules",
+		Description: "List all watch rules and their resource URIs.",
+	}, s.handleListWatchRules)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "add_moderation_rule",
+		Description: "Create or replace a group moderation rule. In groups you admin, incoming messages from non-admins that contain a banned word or (optionally) a link are revoked for everyone, logged, and reported as an account notice.",
+	}, s.handleAddModerationRule)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "remove_moderation_rule",
+		Description: "Delete a group moderation rule. Its log entries are kept.",
+	}, s.handleRemoveModerationRule)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "list_moderation_rules",
+		Description: "List all group moderation rules.",
+	}, s.handleListModerationRules)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "get_moderation_log",
+		Description: "List messages revoked (or that failed to be revoked) by moderation rules, newest first.",
+	}, s.handleGetModerationLog)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "get_audit_log",
+		Description: "List recorded calls of write tools (sending, revoking, blocking, chat management, rule changes, ...), newest first: tool, arguments, result, success, time, and the MCP session and client that made the call. For reviewing what agents did with the account.",
+	}, s.handleGetAuditLog)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "export_metadata",
+		Description: "Export wahoo-local metadata (watch and moderation rules, redaction profiles, chat profiles, archive/pin/mute states, identity links) to a portable JSON file, for backups or moving to another machine. Messages are not included.",
+	}, s.handleExportMetadata)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "import_metadata",
+		Description: "Import a metadata bundle written by export_metadata. Entries in the bundle replace existing ones with the same name or chat; everything else is kept.",
+	}, s.handleImportMetadata)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "export_chat",
+		Description: "Export a whole chat (optionally a date range) to a file as JSON, a plain-text transcript, or a self-contained HTML page, for archiving or hand-off to other systems. Media is referenced by local file path if include_media is set; use download_media first to fetch files.",
+	}, s.handleExportChat)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "set_redaction_profile",
+		Description: "Create or replace a named redaction profile that strips media, masks phone numbers, and/or drops specific participants' messages. Pass it to export_chat so shared conversations don't leak other participants' data.",
+	}, s.handleSetRedactionProfile)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "remove_redaction_profile",
+		Description: "Delete a redaction profile.",
+	}, s.handleRemoveRedactionProfile)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "list_redaction_profiles",
+		Description: "List all redaction profiles.",
+	}, s.handleListRedactionProfiles)
+
 	// === Write tools (need WhatsApp client) ===
 
 	mcp.AddTool(s.mcpServer, &mcp.Tool{
 		Name:        "send_message",
-		Description: "Send a WhatsApp message to a person or group. For group chats use the JID.",
+		Description: "Send a WhatsApp message to a person or group. For group chats use the JID. While disconnected the message is queued (queued=true) and sent on reconnect.",
 	}, s.handleSendMessage)
 
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "send_broadcast",
+		Description: "Send a text message to several recipients one after another, pausing between sends to avoid being flagged as spam. The message may contain {placeholders} filled from each recipient's vars. Returns the result for every recipient.",
+	}, s.handleSendBroadcast)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "create_template",
+		Description: "Save a message template for repeated sends such as appointment reminders, e.g. \"Hi {{name}}, see you on {{date}}\". Saving under an existing name replaces that template. Send it with send_template.",
+	}, s.handleCreateTemplate)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "list_templates",
+		Description: "List the saved message templates with their {{placeholders}}.",
+	}, s.handleListTemplates)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "send_template",
+		Description: "Send a saved message template, filling its {{placeholders}} from vars. Every placeholder needs a value; otherwise nothing is sent. Sends like send_message, including queueing while disconnected.",
+	}, s.handleSendTemplate)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "get_send_status",
+		Description: "Get the delivery status of a message sent with send_message by its send ID: pending, queued, sent, failed, unconfirmed (timed out and possibly delivered; not retried), abandoned or cancelled.",
+	}, s.handleGetSendStatus)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "retry_failed_sends",
+		Description: "Retry all failed text sends now instead of waiting for the automatic retry.",
+	}, s.handleRetryFailedSends)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "list_outbox",
+		Description: "List text sends not yet delivered: queued while disconnected, in flight, failed and waiting for a retry (with the next retry time), or unconfirmed after timing out.",
+	}, s.handleListOutbox)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "cancel_outbox_message",
+		Description: "Cancel a queued or failed text send by its send ID so it is never sent, or dismiss an unconfirmed one.",
+	}, s.handleCancelOutboxMessage)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "manage_send_policy",
+		Description: "Restrict who messages can be sent to: add recipient patterns to allow or deny, or remove them, and get the resulting policy (call without arguments to just view it). Patterns are JIDs or phone numbers with optional * wildcards, e.g. 4917*, *@g.us. Once any pattern is allowed only matching recipients can be messaged; denied patterns always win. Applies to every kind of send. Patterns set by the server operator are shown but cannot be changed.",
+	}, s.handleManageSendPolicy)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "get_connection_status",
+		Description: "Get whether the WhatsApp client is connected and logged in, the paired number and push name, when it last connected, and recent connection errors.",
+	}, s.handleGetConnectionStatus)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "get_account_health",
+		Description: "Get send volume, failure rate, WhatsApp error codes and ban/rate-limit events for an account, with a risk assessment. Use it to tune sending before the number gets flagged.",
+	}, s.handleGetAccountHealth)
+
 	mcp.AddTool(s.mcpServer, &mcp.Tool{
 		Name:        "send_file",
 		Description: "Send a file such as a picture, raw audio, video or document via WhatsApp. For group messages use the JID.",
 	}, s.handleSendFile)
 
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "send_album",
+		Description: "Send 2 to 30 images and videos as one WhatsApp album, with an optional caption on the first. Reports the result of every file; nothing is sent if any file can't be prepared.",
+	}, s.handleSendAlbum)
+
 	mcp.AddTool(s.mcpServer, &mcp.Tool{
 		Name:        "send_audio_message",
 		Description: "Send any audio file as a WhatsApp audio message. If it errors due to ffmpeg not being installed, use send_file instead.",
 	}, s.handleSendAudioMessage)
 
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "send_sticker",
+		Description: "Send an image as a WhatsApp sticker. PNG/JPEG files are converted to 512x512 WebP, which requires ffmpeg.",
+	}, s.handleSendSticker)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "send_gif",
+		Description: "Send an animated GIF that plays in a loop, optionally with a caption. GIF files are converted to MP4, which requires ffmpeg; MP4 files are sent as-is.",
+	}, s.handleSendGIF)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "send_location",
+		Description: "Send a location pin to a person or group, optionally with a place name and address. For group chats use the JID.",
+	}, s.handleSendLocation)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "send_contact_card",
+		Description: "Share a contact card with a person or group, built from a name and phone number or given as a raw vCard. For group chats use the JID.",
+	}, s.handleSendContactCard)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "post_status",
+		Description: "Post a WhatsApp status update (story): text only, or an image with optional caption.",
+	}, s.handlePostStatus)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "create_poll",
+		Description: "Send a WhatsApp poll to a person or group. For group chats use the JID.",
+	}, s.handleCreatePoll)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "get_poll_results",
+		Description: "Get the current vote tally of a WhatsApp poll.",
+	}, s.handleGetPollResults)
+
 	mcp.AddTool(s.mcpServer, &mcp.Tool{
 		Name:        "download_media",
-		Description: "Download media from a WhatsApp message and get the local file path.",
+		Description: "Download media from a WhatsApp message and get the local file path, or, if the server is configured to, a time-limited URL of its copy in the media archive. View-once media can be downloaded only once, with acknowledge_view_once. Sends progress notifications if the call has a progress token.",
 	}, s.handleDownloadMedia)
 
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "transcribe_audio",
+		Description: "Transcribe an audio or voice message (downloading it if needed) and store the transcript, which list_messages then includes. Returns the stored transcript if there is one unless force is set. Requires a transcription backend configured at startup.",
+	}, s.handleTranscribeAudio)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "get_storage_usage",
+		Description: "Get the disk space used by downloaded media, per chat and in total, and by the databases.",
+	}, s.handleGetStorageUsage)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "cleanup_media",
+		Description: "Delete downloaded media files older than max_age_days, then the oldest files until the media directory fits in max_size_mb. Without limits the server's -media-max-size-mb and -media-max-age-days apply. Use dry_run to see what would be deleted.",
+	}, s.handleCleanupMedia)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "purge_messages",
+		Description: "Delete stored messages, and their downloaded media, from the local database: all messages of a chat, or those in a date range (optionally of one chat). Messages stay on WhatsApp. Use dry_run to see how many would be deleted.",
+	}, s.handlePurgeMessages)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "import_chat_export",
+		Description: "Import the history in a .txt file from WhatsApp's \"Export chat\" into a chat, for messages the server never received. Senders named in the file must be mapped to a JID, phone number or \"me\" in participants (names that are phone numbers map themselves); the call reports any that are missing. Messages already stored are skipped, so it is safe to import a file again. Use dry_run to check the file first.",
+	}, s.handleImportChatExport)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "backup_store",
+		Description: "Write a consistent backup of the messages database, and optionally the downloaded media, to a new directory in the server's backup directory while the server keeps running. Older backups beyond the server's -backup-keep are deleted.",
+	}, s.handleBackupStore)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "list_backups",
+		Description: "List the backups of the messages database, newest first, with their paths for restore_store.",
+	}, s.handleListBackups)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "restore_store",
+		Description: "Replace the messages database with a backup from list_backups, and optionally copy its media files back. Messages stored since the backup are lost. Use dry_run to see what would be restored.",
+	}, s.handleRestoreStore)
+
 	// === Chat management tools ===
 
 	mcp.AddTool(s.mcpServer, &mcp.Tool{
 		Name:        "revoke_message",
-		Description: "Delete/revoke a WhatsApp message. Can revoke own messages or others' messages as group admin.",
+		Description: "Delete/revoke a WhatsApp message. Can revoke own messages or others' messages as group admin. Use dry_run to see which message would be revoked.",
 	}, s.handleRevokeMessage)
 
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "edit_message",
+		Description: "Edit the text of a WhatsApp message you sent. Only possible within 15 minutes of sending.",
+	}, s.handleEditMessage)
+
 	mcp.AddTool(s.mcpServer, &mcp.Tool{
 		Name:        "block_contact",
-		Description: "Block a WhatsApp contact.",
+		Description: "Block a WhatsApp contact. Use dry_run to see who would be blocked.",
 	}, s.handleBlockContact)
 
 	mcp.AddTool(s.mcpServer, &mcp.Tool{
@@ -98,6 +450,36 @@ func (s *Server) registerTools() {
 		Description: "Get the list of all blocked WhatsApp contacts.",
 	}, s.handleGetBlocklist)
 
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "list_calls",
+		Description: "List incoming voice and video calls, newest first: caller, whether it was a video or group call, and status (ringing, accepted, rejected, auto_rejected, missed or ended).",
+	}, s.handleListCalls)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "reject_call",
+		Description: "Reject an incoming call that is still ringing (see list_calls for call IDs).",
+	}, s.handleRejectCall)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "get_presence_snapshot",
+		Description: "Subscribe to the presence of several contacts at once, wait briefly for updates and return who is online and when each was last seen.",
+	}, s.handleGetPresenceSnapshot)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "subscribe_presence",
+		Description: "Subscribe to the presence of contacts and keep the subscriptions across reconnects. Their online/offline updates are recorded for get_contact_presence. Set unsubscribe to stop.",
+	}, s.handleSubscribePresence)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "get_contact_presence",
+		Description: "Get a contact's last recorded presence (online, offline, last seen) and the hours of day they usually come online, from updates recorded since subscribe_presence. Use it to pick a good time to send a message.",
+	}, s.handleGetContactPresence)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "set_chat_profile",
+		Description: "Set how you usually write in a chat (language, formality, emoji usage). The profile is returned with get_chat so drafted replies can match your tone with that person.",
+	}, s.handleSetChatProfile)
+
 	mcp.AddTool(s.mcpServer, &mcp.Tool{
 		Name:        "mute_chat",
 		Description: "Mute or unmute a WhatsApp chat. Duration in hours, 0 = mute forever.",
@@ -108,29 +490,196 @@ func (s *Server) registerTools() {
 		Description: "Pin or unpin a WhatsApp chat.",
 	}, s.handlePinChat)
 
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "star_message",
+		Description: "Star or unstar a WhatsApp message to bookmark it for list_starred_messages. The star is stored locally and synced to the phone while connected.",
+	}, s.handleStarMessage)
+
 	mcp.AddTool(s.mcpServer, &mcp.Tool{
 		Name:        "archive_chat",
 		Description: "Archive or unarchive a WhatsApp chat.",
 	}, s.handleArchiveChat)
 
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "list_labels",
+		Description: "List the labels of a WhatsApp Business account with the number of chats and messages carrying each. Labels sync from the phone; other accounts have none.",
+	}, s.handleListLabels)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "get_chats_by_label",
+		Description: "Get the WhatsApp Business chats carrying a label, given by ID or name.",
+	}, s.handleGetChatsByLabel)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "set_chat_label",
+		Description: "Apply a WhatsApp Business label (ID or name from list_labels) to a chat or remove it.",
+	}, s.handleSetChatLabel)
+
 	mcp.AddTool(s.mcpServer, &mcp.Tool{
 		Name:        "delete_chat",
-		Description: "Delete a WhatsApp chat entirely (removes from WhatsApp and local DB).",
+		Description: "Delete a WhatsApp chat entirely (removes from WhatsApp and local DB). Use dry_run to see what would be deleted.",
 	}, s.handleDeleteChat)
 
 	mcp.AddTool(s.mcpServer, &mcp.Tool{
 		Name:        "mark_chat_read",
 		Description: "Mark a WhatsApp chat as read or unread.",
 	}, s.handleMarkChatRead)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "mark_messages_read",
+		Description: "Send read receipts (blue ticks) for specific incoming messages of a chat. Unlike mark_chat_read this is visible to the sender.",
+	}, s.handleMarkMessagesRead)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "set_auto_read",
+		Description: "Enable or disable automatic read receipts for new incoming messages in a chat.",
+	}, s.handleSetAutoRead)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "set_send_profile",
+		Description: "Set how text messages to a chat are sent: \"default\" sends immediately, \"humanize\" shows the typing indicator for a realistic time and leaves randomized pauses between messages.",
+	}, s.handleSetSendProfile)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "set_disappearing_timer",
+		Description: "Turn disappearing messages in a chat on or off. New messages are deleted for everyone after the given duration (24h, 7d or 90d).",
+	}, s.handleSetDisappearingTimer)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "set_chat_retention",
+		Description: "Set how many days a chat's messages are kept in the local database, overriding the server's -retain-days. Older messages and their downloaded media are deleted hourly. 0 keeps them forever; omit days to use the server default again.",
+	}, s.handleSetChatRetention)
+
+	// === Group invite tools ===
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "get_group_invite_link",
+		Description: "Get the invite link of a WhatsApp group. Requires being a group admin.",
+	}, s.handleGetGroupInviteLink)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "revoke_group_invite_link",
+		Description: "Revoke the invite link of a WhatsApp group so it no longer works, and get the new link. Requires being a group admin.",
+	}, s.handleRevokeGroupInviteLink)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "join_group_via_link",
+		Description: "Join a WhatsApp group with an invite link. Without confirm=true it only returns the group the link leads to (name, topic, size) so you can check it with the user first.",
+	}, s.handleJoinGroupViaLink)
+
+	// === Channel tools ===
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "list_newsletters",
+		Description: "List the WhatsApp channels (newsletters) the account follows, with subscriber count and the account's role.",
+	}, s.handleListNewsletters)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "fetch_newsletter_messages",
+		Description: "Fetch the latest messages of a WhatsApp channel into the message database, so list_messages and search can find them. Messages of followed channels also arrive live.",
+	}, s.handleFetchNewsletterMessages)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "follow_newsletter",
+		Description: "Follow a WhatsApp channel by JID (ending in @newsletter) or invite link (https://whatsapp.com/channel/...).",
+	}, s.handleFollowNewsletter)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "unfollow_newsletter",
+		Description: "Stop following a WhatsApp channel.",
+	}, s.handleUnfollowNewsletter)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "send_newsletter_message",
+		Description: "Post a text message to a WhatsApp channel the account administers.",
+	}, s.handleSendNewsletterMessage)
 }
 
 // --- Input types ---
 
+// accountInput selects the WhatsApp account a tool acts on. It is embedded in every tool input.
+type accountInput struct {
+	Account string `json:"account,omitempty" jsonschema:"Name of the WhatsApp account to use (default: the server's default account)"`
+}
+
+type emptyInput struct{}
+
+type addAccountInput struct {
+	Name string `json:"name" jsonschema:"Name for the new account (letters, digits, - and _)"`
+}
+
+type requestPairingCodeInput struct {
+	accountInput
+
+	PhoneNumber string `json:"phone_number" jsonschema:"Phone number of the WhatsApp account to link, with country code (no + or symbols)"`
+}
+
+type getPairingQRInput struct {
+	accountInput
+
+	PreviousCode string `json:"previous_code,omitempty" jsonschema:"QR code returned by the previous call; waits up to 60 seconds for a newer code or for pairing to finish"`
+}
+
+type setProfileNameInput struct {
+	accountInput
+
+	Name string `json:"name" jsonschema:"The new profile name"`
+}
+
+type setProfileStatusInput struct {
+	accountInput
+
+	Text string `json:"text" jsonschema:"The new About text (empty clears it)"`
+}
+
+type setProfilePictureInput struct {
+	accountInput
+
+	ImagePath string `json:"image_path" jsonschema:"Absolute path to the image file (empty removes the picture)"`
+}
+
 type searchContactsInput struct {
-	Query string `json:"query" jsonschema:"Search term to match against contact names or phone numbers"`
+	accountInput
+
+	Query           string `json:"query" jsonschema:"Search term to match against contact names, aliases or phone numbers"`
+	Limit           int    `json:"limit,omitempty" jsonschema:"Maximum contacts to return (default 50)"`
+	Page            int    `json:"page,omitempty" jsonschema:"Page number (default 0)"`
+	CheckIsBusiness bool   `json:"check_is_business,omitempty" jsonschema:"Set is_business on each contact (asks WhatsApp while connected)"`
+}
+
+type setContactAliasInput struct {
+	accountInput
+
+	Contact string `json:"contact" jsonschema:"Phone number or JID of the contact"`
+	Alias   string `json:"alias,omitempty" jsonschema:"Name to show for the contact; omit to remove the alias"`
+}
+
+type listSecurityEventsInput struct {
+	accountInput
+
+	Contact string  `json:"contact,omitempty" jsonschema:"Only show changes of this phone number or JID"`
+	After   *string `json:"after,omitempty" jsonschema:"ISO-8601 date; only show changes after this time"`
+	Limit   int     `json:"limit,omitempty" jsonschema:"Maximum number of events to return (default 50)"`
+	Page    int     `json:"page,omitempty" jsonschema:"Page number (default 0)"`
+}
+
+type checkNumbersInput struct {
+	accountInput
+
+	Numbers     []string `json:"numbers" jsonschema:"Phone numbers with country code, e.g. +49 151 2345678"`
+	MaxAgeHours int      `json:"max_age_hours,omitempty" jsonschema:"Use cached results up to this old (default 168, one week)"`
+	Refresh     bool     `json:"refresh,omitempty" jsonschema:"Ask WhatsApp again instead of using cached results"`
+}
+
+type getBusinessProfileInput struct {
+	accountInput
+
+	JID string `json:"jid" jsonschema:"Phone number or JID of the business"`
 }
 
 type listMessagesInput struct {
+	accountInput
+
 	After             string `json:"after,omitempty" jsonschema:"ISO-8601 date to only return messages after"`
 	Before            string `json:"before,omitempty" jsonschema:"ISO-8601 date to only return messages before"`
 	SenderPhoneNumber string `json:"sender_phone_number,omitempty" jsonschema:"Phone number to filter by sender"`
@@ -138,12 +687,48 @@ type listMessagesInput struct {
 	Query             string `json:"query,omitempty" jsonschema:"Search term to filter messages by content"`
 	Limit             int    `json:"limit,omitempty" jsonschema:"Maximum number of messages (default 20)"`
 	Page              int    `json:"page,omitempty" jsonschema:"Page number for pagination (default 0)"`
+	Cursor            string `json:"cursor,omitempty" jsonschema:"next_cursor of a previous call with the same filters, to get the page after it; used instead of page"`
 	IncludeContext    *bool  `json:"include_context,omitempty" jsonschema:"Include surrounding context messages (default true)"`
 	ContextBefore     int    `json:"context_before,omitempty" jsonschema:"Number of messages before each match (default 1)"`
 	ContextAfter      int    `json:"context_after,omitempty" jsonschema:"Number of messages after each match (default 1)"`
+	MaxTotalMessages  int    `json:"max_total_messages,omitempty" jsonschema:"Return at most this many messages, matches and context together; matches come first, then context nearest to them (also caps limit)"`
+	MaxChars          int    `json:"max_chars,omitempty" jsonschema:"Cut message content and transcripts, in order, to at most this many characters in total"`
+}
+
+type listMentionsInput struct {
+	accountInput
+
+	ChatJID string `json:"chat_jid,omitempty" jsonschema:"Only mentions in this chat"`
+	After   string `json:"after,omitempty" jsonschema:"ISO-8601 date to only return mentions after"`
+	Before  string `json:"before,omitempty" jsonschema:"ISO-8601 date to only return mentions before"`
+	Limit   int    `json:"limit,omitempty" jsonschema:"Maximum number of messages (default 20)"`
+	Page    int    `json:"page,omitempty" jsonschema:"Page number for pagination (default 0)"`
+	Cursor  string `json:"cursor,omitempty" jsonschema:"next_cursor of a previous call with the same filters, to get the page after it; used instead of page"`
+}
+
+type listStarredMessagesInput struct {
+	accountInput
+
+	ChatJID string `json:"chat_jid,omitempty" jsonschema:"Only starred messages in this chat"`
+	Limit   int    `json:"limit,omitempty" jsonschema:"Maximum number of messages (default 20)"`
+	Page    int    `json:"page,omitempty" jsonschema:"Page number for pagination (default 0)"`
+	Cursor  string `json:"cursor,omitempty" jsonschema:"next_cursor of a previous call with the same filters, to get the page after it; used instead of page"`
+}
+
+type semanticSearchMessagesInput struct {
+	accountInput
+
+	Query    string  `json:"query" jsonschema:"What to look for, in natural language"`
+	Limit    int     `json:"limit,omitempty" jsonschema:"Number of messages to return (default 10, at most 100)"`
+	ChatJID  string  `json:"chat_jid,omitempty" jsonschema:"Only search this chat"`
+	After    string  `json:"after,omitempty" jsonschema:"ISO-8601 date to only search messages after"`
+	Before   string  `json:"before,omitempty" jsonschema:"ISO-8601 date to only search messages before"`
+	MinScore float64 `json:"min_score,omitempty" jsonschema:"Drop matches with a lower similarity score (-1 to 1)"`
 }
 
 type listChatsInput struct {
+	accountInput
+
 	Query              string `json:"query,omitempty" jsonschema:"Search term to filter chats by name or JID"`
 	Limit              int    `json:"limit,omitempty" jsonschema:"Maximum number of chats (default 20)"`
 	Page               int    `json:"page,omitempty" jsonschema:"Page number for pagination (default 0)"`
@@ -151,395 +736,3506 @@ type listChatsInput struct {
 	SortBy             string `json:"sort_by,omitempty" jsonschema:"Sort by last_active or name (default last_active)"`
 }
 
+type listUnreadChatsInput struct {
+	accountInput
+
+	Limit int `json:"limit,omitempty" jsonschema:"Maximum number of chats (default 20)"`
+}
+
 type getChatInput struct {
+	accountInput
+
 	ChatJID            string `json:"chat_jid" jsonschema:"The JID of the chat to retrieve"`
 	IncludeLastMessage *bool  `json:"include_last_message,omitempty" jsonschema:"Include last message (default true)"`
 }
 
 type getDirectChatByContactInput struct {
+	accountInput
+
 	SenderPhoneNumber string `json:"sender_phone_number" jsonschema:"The phone number to search for"`
 }
 
 type getContactChatsInput struct {
+	accountInput
+
 	JID   string `json:"jid" jsonschema:"The contact's JID to search for"`
 	Limit int    `json:"limit,omitempty" jsonschema:"Maximum chats to return (default 20)"`
 	Page  int    `json:"page,omitempty" jsonschema:"Page number (default 0)"`
 }
 
+type getChatHeatmapInput struct {
+	accountInput
+
+	ChatJID string  `json:"chat_jid,omitempty" jsonschema:"Count messages in this chat"`
+	Sender  string  `json:"sender,omitempty" jsonschema:"Phone number or JID; count only messages from this contact (in any chat unless chat_jid is set)"`
+	After   *string `json:"after,omitempty" jsonschema:"ISO-8601 date; only count messages after this time"`
+}
+
+type getChatStatisticsInput struct {
+	accountInput
+
+	ChatJID string  `json:"chat_jid,omitempty" jsonschema:"Only include this chat (default: all chats)"`
+	After   *string `json:"after,omitempty" jsonschema:"ISO-8601 date; only include messages after this time"`
+	Before  *string `json:"before,omitempty" jsonschema:"ISO-8601 date; only include messages before this time"`
+	Top     int     `json:"top,omitempty" jsonschema:"Number of senders and chats to rank (default 10)"`
+}
+
+type getChatDigestInput struct {
+	accountInput
+
+	ChatJID   string  `json:"chat_jid" jsonschema:"The JID of the chat to digest"`
+	After     *string `json:"after,omitempty" jsonschema:"ISO-8601 date; only include messages after this time"`
+	Before    *string `json:"before,omitempty" jsonschema:"ISO-8601 date; only include messages before this time"`
+	MaxTokens int     `json:"max_tokens,omitempty" jsonschema:"Approximate token budget for the transcript (default 4000)"`
+}
+
 type getLastInteractionInput struct {
+	accountInput
+
 	JID string `json:"jid" jsonschema:"The JID of the contact to search for"`
 }
 
 type getMessageContextInput struct {
+	accountInput
+
 	MessageID string `json:"message_id" jsonschema:"The ID of the message to get context for"`
 	Before    int    `json:"before,omitempty" jsonschema:"Number of messages before (default 5)"`
 	After     int    `json:"after,omitempty" jsonschema:"Number of messages after (default 5)"`
 }
 
-type sendMessageInput struct {
-	Recipient string `json:"recipient" jsonschema:"Phone number (no + or symbols) or JID"`
-	Message   string `json:"message" jsonschema:"The message text to send"`
+type getThreadInput struct {
+	accountInput
+
+	MessageID string `json:"message_id" jsonschema:"The ID of the message"`
+	ChatJID   string `json:"chat_jid,omitempty" jsonschema:"Chat of the message (optional, message IDs are unique per chat)"`
 }
 
-type sendFileInput struct {
-	Recipient string `json:"recipient" jsonschema:"Phone number (no + or symbols) or JID"`
-	MediaPath string `json:"media_path" jsonschema:"Absolute path to the media file to send"`
+type syncHistoryInput struct {
+	accountInput
+
+	ChatJID         string `json:"chat_jid" jsonschema:"The JID of the chat"`
+	Count           int    `json:"count,omitempty" jsonschema:"Number of messages to request (default 50, max 500)"`
+	BeforeMessageID string `json:"before_message_id,omitempty" jsonschema:"Request messages before this stored message (default: the oldest stored message of the chat)"`
 }
 
-type sendAudioMessageInput struct {
+type fetchOlderMessagesInput struct {
+	accountInput
+
+	ChatJID     string `json:"chat_jid" jsonschema:"The JID of the chat"`
+	Before      string `json:"before,omitempty" jsonschema:"ISO-8601 date to fetch messages before (default: the oldest stored message)"`
+	Count       int    `json:"count,omitempty" jsonschema:"Number of messages to request (default 50, max 500)"`
+	WaitSeconds int    `json:"wait_seconds,omitempty" jsonschema:"How long to wait for the phone to answer (default 60, max 300)"`
+}
+
+type getSyncStatusInput struct {
+	accountInput
+
+	ChatJID string `json:"chat_jid,omitempty" jsonschema:"Only report the sync of this chat"`
+	Limit   int    `json:"limit,omitempty" jsonschema:"Number of latest chunks and chats to list (default 20)"`
+}
+
+type listGroupsInput struct {
+	accountInput
+
+	Query string `json:"query,omitempty" jsonschema:"Search term to filter groups by name or JID"`
+	Limit int    `json:"limit,omitempty" jsonschema:"Maximum number of groups (default 20)"`
+	Page  int    `json:"page,omitempty" jsonschema:"Page number for pagination (default 0)"`
+}
+
+type getGroupInfoInput struct {
+	accountInput
+
+	GroupJID string `json:"group_jid" jsonschema:"The JID of the group (ending in @g.us)"`
+}
+
+type getGroupHistoryInput struct {
+	accountInput
+
+	GroupJID string `json:"group_jid" jsonschema:"The JID of the group (ending in @g.us)"`
+	Limit    int    `json:"limit,omitempty" jsonschema:"Maximum number of messages and changes (default 50)"`
+	Before   string `json:"before,omitempty" jsonschema:"ISO-8601 date to only return history before"`
+}
+
+type listContactStatusesInput struct {
+	accountInput
+
+	JID string `json:"jid,omitempty" jsonschema:"Phone number or JID of a contact to filter by"`
+}
+
+type addWatchRuleInput struct {
+	accountInput
+
+	Name       string `json:"name" jsonschema:"Rule name (letters, digits, - and _), used in the resource URI"`
+	Keyword    string `json:"keyword,omitempty" jsonschema:"Case-insensitive text the message must contain"`
+	Sender     string `json:"sender,omitempty" jsonschema:"Phone number or JID the message must come from"`
+	ChatJID    string `json:"chat_jid,omitempty" jsonschema:"Chat JID the message must be in"`
+	MentionsMe bool   `json:"mentions_me,omitempty" jsonschema:"Only match messages that @-mention you"`
+}
+
+type removeWatchRuleInput struct {
+	accountInput
+
+	Name string `json:"name" jsonschema:"Name of the watch rule to delete"`
+}
+
+type addModerationRuleInput struct {
+	accountInput
+
+	Name        string   `json:"name" jsonschema:"Rule name"`
+	GroupJID    string   `json:"group_jid,omitempty" jsonschema:"Group JID the rule applies to (default: every group you admin)"`
+	BannedWords []string `json:"banned_words,omitempty" jsonschema:"Words that get a message revoked (whole words, case-insensitive)"`
+	BlockLinks  bool     `json:"block_links,omitempty" jsonschema:"Revoke messages containing links"`
+}
+
+type removeModerationRuleInput struct {
+	accountInput
+
+	Name string `json:"name" jsonschema:"Name of the moderation rule to delete"`
+}
+
+type getModerationLogInput struct {
+	accountInput
+
+	GroupJID string `json:"group_jid,omitempty" jsonschema:"Only show entries for this group"`
+	Limit    int    `json:"limit,omitempty" jsonschema:"Maximum number of entries to return (default 50)"`
+}
+
+type getAuditLogInput struct {
+	accountInput
+
+	Tool    string  `json:"tool,omitempty" jsonschema:"Only show calls of this tool"`
+	Session string  `json:"session,omitempty" jsonschema:"Only show calls from this MCP session"`
+	After   *string `json:"after,omitempty" jsonschema:"ISO-8601 date; only show calls after this time"`
+	Before  *string `json:"before,omitempty" jsonschema:"ISO-8601 date; only show calls before this time"`
+	Limit   int     `json:"limit,omitempty" jsonschema:"Maximum number of entries to return (default 50)"`
+	Page    int     `json:"page,omitempty" jsonschema:"Page number (default 0)"`
+}
+
+type exportMetadataInput struct {
+	accountInput
+
+	Path string `json:"path" jsonschema:"New file to write the JSON bundle to, in a directory media can be sent from"`
+}
+
+type exportChatInput struct {
+	accountInput
+
+	ChatJID      string  `json:"chat_jid" jsonschema:"The JID of the chat to export"`
+	Path         string  `json:"path" jsonschema:"New file to write the export to, in a directory media can be sent from"`
+	Format       string  `json:"format,omitempty" jsonschema:"json (default), text or html"`
+	After        *string `json:"after,omitempty" jsonschema:"ISO-8601 timestamp; only export messages after this time"`
+	Before       *string `json:"before,omitempty" jsonschema:"ISO-8601 timestamp; only export messages before this time"`
+	IncludeMedia bool    `json:"include_media,omitempty" jsonschema:"Reference downloaded media files by their local path"`
+	Redaction    string  `json:"redaction_profile,omitempty" jsonschema:"Name of a redaction profile to apply"`
+}
+
+type setRedactionProfileInput struct {
+	accountInput
+
+	Name             string   `json:"name" jsonschema:"Profile name"`
+	StripMedia       bool     `json:"strip_media,omitempty" jsonschema:"Remove media, locations and contact cards"`
+	MaskNumbers      bool     `json:"mask_numbers,omitempty" jsonschema:"Mask phone numbers in senders, JIDs and message text"`
+	DropParticipants []string `json:"drop_participants,omitempty" jsonschema:"Phone numbers or JIDs whose messages are removed"`
+}
+
+type removeRedactionProfileInput struct {
+	accountInput
+
+	Name string `json:"name" jsonschema:"Name of the redaction profile to delete"`
+}
+
+type importMetadataInput struct {
+	accountInput
+
+	Path string `json:"path" jsonschema:"Bundle file written by export_metadata, in a directory media can be sent from"`
+}
+
+type sendMessageInput struct {
+	accountInput
+	idempotencyInput
+
+	Recipient string   `json:"recipient" jsonschema:"Phone number (no + or symbols) or JID"`
+	Message   string   `json:"message" jsonschema:"The message text to send"`
+	Mentions  []string `json:"mentions,omitempty" jsonschema:"Phone numbers or JIDs to @-mention; write them as @number in the message, missing ones are appended"`
+	Force     bool     `json:"force,omitempty" jsonschema:"Send even if the identical text was just sent to this recipient"`
+}
+
+type broadcastRecipientInput struct {
+	Recipient string            `json:"recipient" jsonschema:"Phone number (no + or symbols) or JID"`
+	Vars      map[string]string `json:"vars,omitempty" jsonschema:"Values for the {placeholders} in the message, e.g. {\"name\": \"Anna\"}"`
+}
+
+type sendBroadcastInput struct {
+	accountInput
+	idempotencyInput
+
+	Recipients      []broadcastRecipientInput `json:"recipients" jsonschema:"Recipients in send order (at most 256)"`
+	Message         string                    `json:"message" jsonschema:"The message text; {name} placeholders are replaced with each recipient's vars"`
+	IntervalSeconds float64                   `json:"interval_seconds,omitempty" jsonschema:"Pause between sends in seconds, randomized by ±25% (default 5, minimum 1)"`
+}
+
+type createTemplateInput struct {
+	accountInput
+
+	Name        string `json:"name" jsonschema:"Name of the template"`
+	Body        string `json:"body" jsonschema:"The message text, with {{placeholders}} for the values given to send_template"`
+	Description string `json:"description,omitempty" jsonschema:"What the template is for"`
+}
+
+type sendTemplateInput struct {
+	accountInput
+	idempotencyInput
+
+	Recipient string            `json:"recipient" jsonschema:"Phone number (no + or symbols) or JID"`
+	Name      string            `json:"name" jsonschema:"Name of the template (see list_templates)"`
+	Vars      map[string]string `json:"vars,omitempty" jsonschema:"Values for the {{placeholders}}, e.g. {\"name\": \"Anna\"}"`
+	Force     bool              `json:"force,omitempty" jsonschema:"Send even if the identical text was just sent to this recipient"`
+}
+
+type getSendStatusInput struct {
+	accountInput
+
+	SendID int64 `json:"send_id" jsonschema:"The send ID returned by send_message"`
+}
+
+type manageSendPolicyInput struct {
+	accountInput
+
+	Allow  []string `json:"allow,omitempty" jsonschema:"Recipient patterns to allow"`
+	Deny   []string `json:"deny,omitempty" jsonschema:"Recipient patterns to deny"`
+	Remove []string `json:"remove,omitempty" jsonschema:"Patterns to remove from the policy"`
+}
+
+type sendFileInput struct {
+	accountInput
+	idempotencyInput
+
+	Recipient string `json:"recipient" jsonschema:"Phone number (no + or symbols) or JID"`
+	MediaPath string `json:"media_path" jsonschema:"Absolute path to the media file to send"`
+	Caption   string `json:"caption,omitempty" jsonschema:"Optional caption shown with images, videos and documents"`
+	MimeType  string `json:"mime_type,omitempty" jsonschema:"Optional MIME type override (e.g. application/pdf); detected from extension or content if omitted"`
+}
+
+type sendAlbumInput struct {
+	accountInput
+	idempotencyInput
+
+	Recipient  string   `json:"recipient" jsonschema:"Phone number (no + or symbols) or JID"`
+	MediaPaths []string `json:"media_paths" jsonschema:"Absolute paths of the images and videos, in album order"`
+	Caption    string   `json:"caption,omitempty" jsonschema:"Optional caption shown with the first file"`
+}
+
+type sendAudioMessageInput struct {
+	accountInput
+	idempotencyInput
+
 	Recipient string `json:"recipient" jsonschema:"Phone number (no + or symbols) or JID"`
 	MediaPath string `json:"media_path" jsonschema:"Absolute path to the audio file"`
 }
 
+type sendStickerInput struct {
+	accountInput
+	idempotencyInput
+
+	Recipient string `json:"recipient" jsonschema:"Phone number (no + or symbols) or JID"`
+	MediaPath string `json:"media_path" jsonschema:"Absolute path to a PNG, JPEG or WebP image"`
+}
+
+type sendGIFInput struct {
+	accountInput
+	idempotencyInput
+
+	Recipient string `json:"recipient" jsonschema:"Phone number (no + or symbols) or JID"`
+	MediaPath string `json:"media_path" jsonschema:"Absolute path to a GIF or MP4 file"`
+	Caption   string `json:"caption,omitempty" jsonschema:"Optional caption"`
+}
+
+type sendLocationInput struct {
+	accountInput
+	idempotencyInput
+
+	Recipient string  `json:"recipient" jsonschema:"Phone number (no + or symbols) or JID"`
+	Latitude  float64 `json:"latitude" jsonschema:"Latitude in degrees"`
+	Longitude float64 `json:"longitude" jsonschema:"Longitude in degrees"`
+	Name      string  `json:"name,omitempty" jsonschema:"Name of the place"`
+	Address   string  `json:"address,omitempty" jsonschema:"Address of the place"`
+}
+
+type sendContactCardInput struct {
+	accountInput
+	idempotencyInput
+
+	Recipient string `json:"recipient" jsonschema:"Phone number (no + or symbols) or JID"`
+	Name      string `json:"name,omitempty" jsonschema:"Name of the shared contact"`
+	Phone     string `json:"phone,omitempty" jsonschema:"Phone number of the shared contact with country code"`
+	VCard     string `json:"vcard,omitempty" jsonschema:"Raw vCard to send instead of name and phone"`
+}
+
+type postStatusInput struct {
+	accountInput
+	idempotencyInput
+
+	Text      string `json:"text,omitempty" jsonschema:"Status text, or the caption if an image is given"`
+	ImagePath string `json:"image_path,omitempty" jsonschema:"Absolute path to an image to post"`
+}
+
+type createPollInput struct {
+	accountInput
+	idempotencyInput
+
+	Recipient   string   `json:"recipient" jsonschema:"Phone number (no + or symbols) or JID"`
+	Question    string   `json:"question" jsonschema:"The poll question"`
+	Options     []string `json:"options" jsonschema:"The answer options (at least 2)"`
+	MultiSelect bool     `json:"multi_select,omitempty" jsonschema:"Allow voters to select multiple options (default false)"`
+}
+
+type getPollResultsInput struct {
+	accountInput
+
+	ChatJID string `json:"chat_jid" jsonschema:"JID of the chat containing the poll"`
+	PollID  string `json:"poll_id" jsonschema:"Message ID of the poll"`
+}
+
 type downloadMediaInput struct {
+	accountInput
+
 	MessageID string `json:"message_id" jsonschema:"ID of the message containing the media"`
 	ChatJID   string `json:"chat_jid" jsonschema:"JID of the chat containing the message"`
+
+	AcknowledgeViewOnce bool `json:"acknowledge_view_once,omitempty" jsonschema:"Required for view-once media (view_once in message listings): it can be downloaded only once, and the time is recorded as viewed_at"`
+}
+
+type transcribeAudioInput struct {
+	accountInput
+
+	MessageID string `json:"message_id" jsonschema:"ID of the audio message"`
+	ChatJID   string `json:"chat_jid" jsonschema:"JID of the chat containing the message"`
+	Force     bool   `json:"force,omitempty" jsonschema:"Transcribe again even if a transcript is stored"`
+}
+
+type cleanupMediaInput struct {
+	accountInput
+
+	MaxSizeMB  int  `json:"max_size_mb,omitempty" jsonschema:"Largest total size of downloaded media to keep in MB"`
+	MaxAgeDays int  `json:"max_age_days,omitempty" jsonschema:"Delete media downloaded more than this many days ago"`
+	DryRun     bool `json:"dry_run,omitempty" jsonschema:"Only report what would be deleted"`
+}
+
+type purgeMessagesInput struct {
+	accountInput
+
+	ChatJID string `json:"chat_jid,omitempty" jsonschema:"Only delete messages of this chat"`
+	After   string `json:"after,omitempty" jsonschema:"ISO-8601 date to only delete messages after"`
+	Before  string `json:"before,omitempty" jsonschema:"ISO-8601 date to only delete messages before"`
+	DryRun  bool   `json:"dry_run,omitempty" jsonschema:"Only report what would be deleted"`
+}
+
+type importChatExportInput struct {
+	accountInput
+
+	ChatJID      string            `json:"chat_jid" jsonschema:"JID of the chat to import into"`
+	Path         string            `json:"path" jsonschema:"The exported .txt file, in a directory media can be sent from"`
+	Participants map[string]string `json:"participants,omitempty" jsonschema:"Sender name in the file to JID, phone number or \"me\""`
+	DateOrder    string            `json:"date_order,omitempty" jsonschema:"dmy (default) or mdy, for files whose dates could be read either way"`
+	DryRun       bool              `json:"dry_run,omitempty" jsonschema:"Only parse the file and report what would be imported"`
+}
+
+type backupStoreInput struct {
+	accountInput
+
+	IncludeMedia bool `json:"include_media,omitempty" jsonschema:"Also copy the downloaded media (default: the server's -backup-media)"`
+}
+
+type restoreStoreInput struct {
+	accountInput
+	confirmInput
+
+	Path         string `json:"path" jsonschema:"Backup directory, from list_backups"`
+	IncludeMedia bool   `json:"include_media,omitempty" jsonschema:"Also copy the backed up media files missing from the media directory back"`
 }
 
 type revokeMessageInput struct {
+	accountInput
+
+	confirmInput
+
 	ChatJID   string `json:"chat_jid" jsonschema:"JID of the chat containing the message"`
 	MessageID string `json:"message_id" jsonschema:"ID of the message to revoke/delete"`
 	SenderJID string `json:"sender_jid,omitempty" jsonschema:"Sender JID (only needed to revoke others messages as group admin)"`
 }
 
+type editMessageInput struct {
+	accountInput
+
+	ChatJID   string `json:"chat_jid" jsonschema:"JID of the chat containing the message"`
+	MessageID string `json:"message_id" jsonschema:"ID of your own message to edit"`
+	NewText   string `json:"new_text" jsonschema:"The replacement message text"`
+}
+
 type blockContactInput struct {
+	accountInput
+	confirmInput
+
 	JID string `json:"jid" jsonschema:"JID of the contact to block (e.g. 491234567890@s.whatsapp.net)"`
 }
 
 type unblockContactInput struct {
+	accountInput
+
 	JID string `json:"jid" jsonschema:"JID of the contact to unblock"`
 }
 
-type emptyInput struct{}
+type listCallsInput struct {
+	accountInput
+
+	Caller string  `json:"caller,omitempty" jsonschema:"Only show calls from this phone number or JID"`
+	Status string  `json:"status,omitempty" jsonschema:"Only show calls with this status: ringing, accepted, rejected, auto_rejected, missed or ended"`
+	After  *string `json:"after,omitempty" jsonschema:"ISO-8601 date; only show calls after this time"`
+	Before *string `json:"before,omitempty" jsonschema:"ISO-8601 date; only show calls before this time"`
+	Limit  int     `json:"limit,omitempty" jsonschema:"Maximum number of calls to return (default 50)"`
+	Page   int     `json:"page,omitempty" jsonschema:"Page number (default 0)"`
+}
+
+type rejectCallInput struct {
+	accountInput
+
+	CallID string `json:"call_id" jsonschema:"ID of the ringing call to reject"`
+}
+
+type getPresenceSnapshotInput struct {
+	accountInput
+
+	JIDs        []string `json:"jids" jsonschema:"Phone numbers or JIDs of the contacts to check"`
+	WaitSeconds int      `json:"wait_seconds,omitempty" jsonschema:"How long to wait for presence updates (default 5, max 30)"`
+}
+
+type subscribePresenceInput struct {
+	accountInput
+
+	JIDs        []string `json:"jids" jsonschema:"Phone numbers or JIDs of the contacts"`
+	Unsubscribe bool     `json:"unsubscribe,omitempty" jsonschema:"Stop renewing the subscriptions instead"`
+}
+
+type getContactPresenceInput struct {
+	accountInput
+
+	JID  string `json:"jid" jsonschema:"Phone number or JID of the contact"`
+	Days int    `json:"days,omitempty" jsonschema:"How many days of presence updates to base the usual hours on (default 30)"`
+}
+
+type setChatProfileInput struct {
+	accountInput
+
+	ChatJID   string `json:"chat_jid" jsonschema:"JID of the chat"`
+	Language  string `json:"language,omitempty" jsonschema:"Preferred language, e.g. de or English"`
+	Formality string `json:"formality,omitempty" jsonschema:"casual, neutral or formal"`
+	Emoji     string `json:"emoji,omitempty" jsonschema:"Emoji usage: none, some or lots"`
+	Clear     bool   `json:"clear,omitempty" jsonschema:"Remove the profile instead (other fields are ignored)"`
+}
 
 type muteChatInput struct {
+	accountInput
+
 	ChatJID       string `json:"chat_jid" jsonschema:"JID of the chat to mute/unmute"`
 	Mute          bool   `json:"mute" jsonschema:"true to mute, false to unmute"`
 	DurationHours int    `json:"duration_hours,omitempty" jsonschema:"Mute duration in hours (0 = forever, only used when mute=true)"`
 }
 
 type pinChatInput struct {
+	accountInput
+
 	ChatJID string `json:"chat_jid" jsonschema:"JID of the chat to pin/unpin"`
 	Pin     bool   `json:"pin" jsonschema:"true to pin, false to unpin"`
 }
 
+type starMessageInput struct {
+	accountInput
+
+	ChatJID   string `json:"chat_jid" jsonschema:"JID of the chat containing the message"`
+	MessageID string `json:"message_id" jsonschema:"ID of the message to star/unstar"`
+	Star      bool   `json:"star" jsonschema:"true to star, false to unstar"`
+}
+
+type listLabelsInput struct {
+	accountInput
+}
+
+type getChatsByLabelInput struct {
+	accountInput
+
+	Label              string `json:"label" jsonschema:"Label ID or name"`
+	Limit              int    `json:"limit,omitempty" jsonschema:"Maximum number of chats (default 20)"`
+	Page               int    `json:"page,omitempty" jsonschema:"Page number for pagination (default 0)"`
+	IncludeLastMessage bool   `json:"include_last_message,omitempty" jsonschema:"Include the last message of each chat"`
+}
+
+type setChatLabelInput struct {
+	accountInput
+
+	ChatJID string `json:"chat_jid" jsonschema:"JID of the chat to label"`
+	Label   string `json:"label" jsonschema:"Label ID or name"`
+	Labeled bool   `json:"labeled" jsonschema:"true to apply the label, false to remove it"`
+}
+
 type archiveChatInput struct {
+	accountInput
+
 	ChatJID string `json:"chat_jid" jsonschema:"JID of the chat to archive/unarchive"`
 	Archive bool   `json:"archive" jsonschema:"true to archive, false to unarchive"`
 }
 
 type deleteChatInput struct {
+	accountInput
+	confirmInput
+
 	ChatJID string `json:"chat_jid" jsonschema:"JID of the chat to delete"`
 }
 
 type markChatReadInput struct {
+	accountInput
+
 	ChatJID string `json:"chat_jid" jsonschema:"JID of the chat to mark"`
 	Read    bool   `json:"read" jsonschema:"true to mark as read, false to mark as unread"`
 }
 
+type markMessagesReadInput struct {
+	accountInput
+
+	ChatJID    string   `json:"chat_jid" jsonschema:"JID of the chat the messages are in"`
+	MessageIDs []string `json:"message_ids" jsonschema:"IDs of the incoming messages to mark as read"`
+}
+
+type setAutoReadInput struct {
+	accountInput
+
+	ChatJID string `json:"chat_jid" jsonschema:"JID of the chat"`
+	Enabled bool   `json:"enabled" jsonschema:"true to send read receipts for new messages automatically"`
+}
+
+type setChatRetentionInput struct {
+	accountInput
+
+	ChatJID string `json:"chat_jid" jsonschema:"JID of the chat"`
+	Days    *int   `json:"days,omitempty" jsonschema:"Days to keep messages, 0 = forever; omit to use the server default"`
+}
+
+type setSendProfileInput struct {
+	accountInput
+
+	ChatJID string `json:"chat_jid" jsonschema:"JID of the chat"`
+	Profile string `json:"profile" jsonschema:"default or humanize"`
+}
+
+type groupInviteLinkInput struct {
+	accountInput
+
+	GroupJID string `json:"group_jid" jsonschema:"The JID of the group (ending in @g.us)"`
+}
+
+type joinGroupViaLinkInput struct {
+	accountInput
+
+	Link    string `json:"link" jsonschema:"Invite link (https://chat.whatsapp.com/...) or its code"`
+	Confirm bool   `json:"confirm,omitempty" jsonschema:"true to join; otherwise only the group is looked up"`
+}
+
+type newsletterInput struct {
+	accountInput
+
+	NewsletterJID string `json:"newsletter_jid" jsonschema:"The JID of the channel (ending in @newsletter)"`
+}
+
+type fetchNewsletterMessagesInput struct {
+	accountInput
+
+	NewsletterJID string `json:"newsletter_jid" jsonschema:"The JID of the channel (ending in @newsletter)"`
+	Count         int    `json:"count,omitempty" jsonschema:"Number of latest messages to fetch (default and maximum 100)"`
+}
+
+type followNewsletterInput struct {
+	accountInput
+
+	Channel string `json:"channel" jsonschema:"Channel JID (ending in @newsletter) or invite link (https://whatsapp.com/channel/...)"`
+}
+
+type sendNewsletterMessageInput struct {
+	accountInput
+	idempotencyInput
+
+	NewsletterJID string `json:"newsletter_jid" jsonschema:"The JID of the channel (ending in @newsletter)"`
+	Message       string `json:"message" jsonschema:"The text to post"`
+}
+
+type setDisappearingTimerInput struct {
+	accountInput
+
+	ChatJID  string `json:"chat_jid" jsonschema:"JID of the chat"`
+	Duration string `json:"duration" jsonschema:"off, 24h, 7d or 90d"`
+}
+
 // --- Output wrapper types (MCP SDK requires type "object", not slices/pointers) ---
 
-type contactsResult struct {
-	Contacts []db.ContactDict `json:"contacts"`
-	Count    int              `json:"count"`
-}
+// List results carry the page info (total_count, page, page_size, has_more)
+// next to Count, the number of results returned.
+type contactsResult struct {
+	Contacts []db.ContactDict `json:"contacts"`
+	Count    int              `json:"count"`
+	db.PageInfo
+}
+
+type messagesResult struct {
+	Messages []db.MessageDict `json:"messages"`
+	Count    int              `json:"count"`
+	db.PageInfo
+}
+
+type chatsResult struct {
+	Chats []db.ChatDict `json:"chats"`
+	Count int           `json:"count"`
+	db.PageInfo
+}
+
+type chatResult struct {
+	Chat db.ChatDict `json:"chat"`
+}
+
+type messageResult struct {
+	Message db.MessageDict `json:"message"`
+}
+
+type messageContextResult struct {
+	Context db.MessageContextDict `json:"context"`
+}
+
+// --- Handlers ---
+
+type accountInfo struct {
+	Name      string `json:"name"`
+	Default   bool   `json:"default"`
+	Connected bool   `json:"connected"`
+	Paired    bool   `json:"paired"`
+	JID       string `json:"jid,omitempty"`
+}
+
+type accountsResult struct {
+	Accounts []accountInfo `json:"accounts"`
+	Count    int           `json:"count"`
+}
+
+func (s *Server) handleListAccounts(ctx context.Context, req *mcp.CallToolRequest, input emptyInput) (*mcp.CallToolResult, accountsResult, error) {
+	result := []accountInfo{}
+	for _, a := range s.accounts.List() {
+		info := accountInfo{
+			Name:      a.Name,
+			Default:   a.Name == s.accounts.Default,
+			Connected: a.Client.IsConnected(),
+		}
+		if id := a.Client.WA.Store.ID; id != nil {
+			info.Paired = true
+			info.JID = id.ToNonAD().String()
+		}
+		result = append(result, info)
+	}
+	return nil, accountsResult{Accounts: result, Count: len(result)}, nil
+}
+
+type addAccountResult struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+	QRCode  string `json:"qr_code,omitempty"`
+}
+
+func (s *Server) handleAddAccount(ctx context.Context, req *mcp.CallToolRequest, input addAccountInput) (*mcp.CallToolResult, addAccountResult, error) {
+	if !wa.ValidAccountName(input.Name) {
+		return nil, addAccountResult{Success: false, Message: "Account name must consist of letters, digits, - and _"}, nil
+	}
+	_, code, err := s.accounts.Pair(input.Name, 30*time.Second)
+	if err != nil {
+		return nil, addAccountResult{Success: false, Message: err.Error()}, nil
+	}
+	return nil, addAccountResult{
+		Success: true,
+		Message: fmt.Sprintf("Scan the QR code with WhatsApp > Linked devices to pair account %s. The code is also printed on the server's stderr.", input.Name),
+		QRCode:  code,
+	}, nil
+}
+
+type pairingCodeResult struct {
+	Success     bool   `json:"success"`
+	Message     string `json:"message"`
+	PairingCode string `json:"pairing_code,omitempty"`
+}
+
+func (s *Server) handleRequestPairingCode(ctx context.Context, req *mcp.CallToolRequest, input requestPairingCodeInput) (*mcp.CallToolResult, pairingCodeResult, error) {
+	if input.PhoneNumber == "" {
+		return nil, pairingCodeResult{Success: false, Message: "Phone number must be provided"}, nil
+	}
+	name := input.Account
+	if name == "" {
+		name = s.accounts.Default
+	}
+	_, code, err := s.accounts.RequestPairingCode(name, input.PhoneNumber, 30*time.Second)
+	if err != nil {
+		return nil, pairingCodeResult{Success: false, Message: err.Error()}, nil
+	}
+	return nil, pairingCodeResult{
+		Success:     true,
+		Message:     fmt.Sprintf("On the phone open WhatsApp > Linked devices > Link a device > Link with phone number instead, and enter the code to pair account %s.", name),
+		PairingCode: code,
+	}, nil
+}
+
+type pairingQRResult struct {
+	Account  string  `json:"account"`
+	Paired   bool    `json:"paired"`
+	JID      string  `json:"jid,omitempty"`
+	QRCode   string  `json:"qr_code,omitempty"`
+	QRImage  string  `json:"qr_image,omitempty"` // PNG data URI
+	IssuedAt *string `json:"issued_at,omitempty"`
+	Message  string  `json:"message"`
+}
+
+// pairingQRWait is how long get_pairing_qr waits for a code to rotate.
+const pairingQRWait = 60 * time.Second
+
+func (s *Server) handleGetPairingQR(ctx context.Context, req *mcp.CallToolRequest, input getPairingQRInput) (*mcp.CallToolResult, pairingQRResult, error) {
+	a, err := s.accounts.Get(input.Account)
+	if err != nil {
+		return nil, pairingQRResult{}, err
+	}
+	if a.Client.WA.Store.ID == nil && input.PreviousCode == "" {
+		if code, _ := a.PairingQR(); code == "" {
+			// Not connecting (any more): start over to get a fresh code
+			if _, _, err := s.accounts.Pair(a.Name, 30*time.Second); err != nil {
+				return nil, pairingQRResult{Account: a.Name, Message: err.Error()}, nil
+			}
+		}
+	}
+
+	deadline := time.Now().Add(pairingQRWait)
+	for input.PreviousCode != "" && a.Client.WA.Store.ID == nil && time.Now().Before(deadline) {
+		if code, _ := a.PairingQR(); code != input.PreviousCode {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return nil, pairingQRResult{}, ctx.Err()
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+
+	result, png := pairingQRFor(a)
+	if png == nil {
+		return nil, result, nil
+	}
+	// Shown as an image by clients that don't render the data URI
+	return &mcp.CallToolResult{Content: []mcp.Content{
+		&mcp.TextContent{Text: result.Message},
+		&mcp.ImageContent{MIMEType: "image/png", Data: png},
+	}}, result, nil
+}
+
+// pairingQRFor describes an account's pairing state and renders its current
+// QR code as PNG, which is nil if there is none.
+func pairingQRFor(a *wa.Account) (pairingQRResult, []byte) {
+	result := pairingQRResult{Account: a.Name}
+	if id := a.Client.WA.Store.ID; id != nil {
+		result.Paired = true
+		result.JID = id.ToNonAD().String()
+		result.Message = fmt.Sprintf("Account %s is paired", a.Name)
+		return result, nil
+	}
+	code, issued := a.PairingQR()
+	if code == "" {
+		result.Message = fmt.Sprintf("Account %s is not paired and not waiting for a QR scan: call get_pairing_qr to start pairing", a.Name)
+		return result, nil
+	}
+	result.QRCode = code
+	ts := issued.Format(time.RFC3339)
+	result.IssuedAt = &ts
+	result.Message = fmt.Sprintf("Scan the QR code with WhatsApp > Linked devices > Link a device to pair account %s. It rotates about every 20 seconds.", a.Name)
+	qrCode, err := qr.Encode(code, qr.L)
+	if err != nil {
+		return result, nil
+	}
+	png := qrCode.PNG()
+	result.QRImage = "data:image/png;base64," + base64.StdEncoding.EncodeToString(png)
+	return result, png
+}
+
+func (s *Server) handleSetProfileName(ctx context.Context, req *mcp.CallToolRequest, input setProfileNameInput) (*mcp.CallToolResult, sendResult, error) {
+	_, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, sendResult{}, err
+	}
+	if client == nil {
+		return nil, sendResult{Success: false, Message: "WhatsApp client not available"}, nil
+	}
+	success, msg := client.SetProfileName(ctx, input.Name)
+	return nil, sendResult{Success: success, Message: msg}, nil
+}
+
+func (s *Server) handleSetProfileStatus(ctx context.Context, req *mcp.CallToolRequest, input setProfileStatusInput) (*mcp.CallToolResult, sendResult, error) {
+	_, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, sendResult{}, err
+	}
+	if client == nil {
+		return nil, sendResult{Success: false, Message: "WhatsApp client not available"}, nil
+	}
+	success, msg := client.SetProfileStatus(ctx, input.Text)
+	return nil, sendResult{Success: success, Message: msg}, nil
+}
+
+func (s *Server) handleSetProfilePicture(ctx context.Context, req *mcp.CallToolRequest, input setProfilePictureInput) (*mcp.CallToolResult, sendResult, error) {
+	_, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, sendResult{}, err
+	}
+	if client == nil {
+		return nil, sendResult{Success: false, Message: "WhatsApp client not available"}, nil
+	}
+	success, msg := client.SetProfilePicture(ctx, input.ImagePath)
+	return nil, sendResult{Success: success, Message: msg}, nil
+}
+
+func (s *Server) handleSearchContacts(ctx context.Context, req *mcp.CallToolRequest, input searchContactsInput) (*mcp.CallToolResult, contactsResult, error) {
+	store, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, contactsResult{}, err
+	}
+	result, page, err := store.SearchContacts(input.Query, input.Limit, input.Page)
+	if err != nil {
+		return nil, contactsResult{}, err
+	}
+	if result == nil {
+		result = []db.ContactDict{}
+	}
+	if input.CheckIsBusiness && client != nil && len(result) > 0 {
+		jids := make([]string, len(result))
+		for i, c := range result {
+			jids[i] = c.JID
+		}
+		business := client.CheckBusiness(ctx, jids)
+		for i := range result {
+			if b, ok := business[result[i].JID]; ok {
+				result[i].IsBusiness = &b
+			}
+		}
+	}
+	return nil, contactsResult{Contacts: result, Count: len(result), PageInfo: page}, nil
+}
+
+func (s *Server) handleSetContactAlias(ctx context.Context, req *mcp.CallToolRequest, input setContactAliasInput) (*mcp.CallToolResult, sendResult, error) {
+	store, _, err := s.account(input.Account)
+	if err != nil {
+		return nil, sendResult{}, err
+	}
+	jid, err := store.SetContactAlias(input.Contact, input.Alias)
+	if err != nil {
+		return nil, sendResult{Success: false, Message: err.Error()}, nil
+	}
+	// Stored messages carry their sender's name, so rewrite it right away
+	updated, err := store.RefreshSenderNames()
+	if err != nil {
+		return nil, sendResult{}, err
+	}
+	if strings.TrimSpace(input.Alias) == "" {
+		return nil, sendResult{Success: true, Message: fmt.Sprintf("Alias of %s removed (%d messages updated)", jid, updated)}, nil
+	}
+	return nil, sendResult{Success: true, Message: fmt.Sprintf("%s is now shown as %s (%d messages updated)", jid, strings.TrimSpace(input.Alias), updated)}, nil
+}
+
+type securityEventsResult struct {
+	Events []db.SecurityEventDict `json:"events"`
+	Count  int                    `json:"count"`
+	db.PageInfo
+}
+
+func (s *Server) handleListSecurityEvents(ctx context.Context, req *mcp.CallToolRequest, input listSecurityEventsInput) (*mcp.CallToolResult, securityEventsResult, error) {
+	store, _, err := s.account(input.Account)
+	if err != nil {
+		return nil, securityEventsResult{}, err
+	}
+	events, page, err := store.ListSecurityEvents(db.ListSecurityEventsOpts{
+		Contact: input.Contact,
+		After:   input.After,
+		Limit:   input.Limit,
+		Page:    input.Page,
+	})
+	if err != nil {
+		return nil, securityEventsResult{}, err
+	}
+	return nil, securityEventsResult{Events: events, Count: len(events), PageInfo: page}, nil
+}
+
+type numberCheckEntry struct {
+	Number       string  `json:"number"`
+	JID          string  `json:"jid,omitempty"`
+	OnWhatsApp   bool    `json:"on_whatsapp"`
+	IsBusiness   bool    `json:"is_business"`
+	BusinessName string  `json:"business_name,omitempty"`
+	Cached       bool    `json:"cached"`
+	CheckedAt    *string `json:"checked_at,omitempty"`
+	Error        string  `json:"error,omitempty"`
+}
+
+type checkNumbersResult struct {
+	Numbers    []numberCheckEntry `json:"numbers"`
+	OnWhatsApp int                `json:"on_whatsapp"`
+	Count      int                `json:"count"`
+}
+
+func (s *Server) handleCheckNumbers(ctx context.Context, req *mcp.CallToolRequest, input checkNumbersInput) (*mcp.CallToolResult, checkNumbersResult, error) {
+	_, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, checkNumbersResult{}, err
+	}
+	if client == nil {
+		return nil, checkNumbersResult{}, fmt.Errorf("WhatsApp client not available")
+	}
+	if len(input.Numbers) == 0 {
+		return nil, checkNumbersResult{}, fmt.Errorf("at least one number must be provided")
+	}
+	maxAge := 168 * time.Hour
+	if input.Refresh {
+		maxAge = 0
+	} else if input.MaxAgeHours > 0 {
+		maxAge = time.Duration(input.MaxAgeHours) * time.Hour
+	}
+
+	statuses, err := client.CheckNumbers(ctx, input.Numbers, maxAge)
+	if err != nil {
+		return nil, checkNumbersResult{}, err
+	}
+	result := checkNumbersResult{Numbers: make([]numberCheckEntry, 0, len(statuses))}
+	for _, st := range statuses {
+		e := numberCheckEntry{
+			Number:       st.Number,
+			JID:          st.JID,
+			OnWhatsApp:   st.OnWhatsApp,
+			IsBusiness:   st.IsBusiness,
+			BusinessName: st.BusinessName,
+			Cached:       st.Cached,
+			Error:        st.Error,
+		}
+		if !st.CheckedAt.IsZero() {
+			ts := st.CheckedAt.Format(time.RFC3339)
+			e.CheckedAt = &ts
+		}
+		if st.OnWhatsApp {
+			result.OnWhatsApp++
+		}
+		result.Numbers = append(result.Numbers, e)
+	}
+	result.Count = len(result.Numbers)
+	return nil, result, nil
+}
+
+type businessHoursResult struct {
+	Day   string `json:"day"`
+	Mode  string `json:"mode"` // specific_hours, open_24h or appointment_only
+	Open  string `json:"open,omitempty"`
+	Close string `json:"close,omitempty"`
+}
+
+type businessProfileResult struct {
+	JID         string                `json:"jid"`
+	Name        string                `json:"name,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Categories  []string              `json:"categories"`
+	Address     string                `json:"address,omitempty"`
+	Email       string                `json:"email,omitempty"`
+	Websites    []string              `json:"websites"`
+	Timezone    string                `json:"timezone,omitempty"`
+	Hours       []businessHoursResult `json:"hours"`
+}
+
+func (s *Server) handleGetBusinessProfile(ctx context.Context, req *mcp.CallToolRequest, input getBusinessProfileInput) (*mcp.CallToolResult, businessProfileResult, error) {
+	_, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, businessProfileResult{}, err
+	}
+	if client == nil {
+		return nil, businessProfileResult{}, fmt.Errorf("WhatsApp client not available")
+	}
+	if input.JID == "" {
+		return nil, businessProfileResult{}, fmt.Errorf("jid must be provided")
+	}
+	p, err := client.GetBusinessProfile(ctx, input.JID)
+	if err != nil {
+		return nil, businessProfileResult{}, err
+	}
+	result := businessProfileResult{
+		JID:         p.JID,
+		Name:        p.Name,
+		Description: p.Description,
+		Categories:  p.Categories,
+		Address:     p.Address,
+		Email:       p.Email,
+		Websites:    p.Websites,
+		Timezone:    p.Timezone,
+		Hours:       make([]businessHoursResult, len(p.Hours)),
+	}
+	for i, h := range p.Hours {
+		result.Hours[i] = businessHoursResult{Day: h.Day, Mode: h.Mode, Open: h.Open, Close: h.Close}
+	}
+	return nil, result, nil
+}
+
+func (s *Server) handleListMessages(ctx context.Context, req *mcp.CallToolRequest, input listMessagesInput) (*mcp.CallToolResult, messagesResult, error) {
+	store, _, err := s.account(input.Account)
+	if err != nil {
+		return nil, messagesResult{}, err
+	}
+	opts := db.ListMessagesOpts{
+		Cursor:           input.Cursor,
+		Limit:            input.Limit,
+		Page:             input.Page,
+		IncludeContext:   true,
+		ContextBefore:    input.ContextBefore,
+		ContextAfter:     input.ContextAfter,
+		MaxTotalMessages: input.MaxTotalMessages,
+		MaxChars:         input.MaxChars,
+	}
+	if input.After != "" {
+		opts.After = &input.After
+	}
+	if input.Before != "" {
+		opts.Before = &input.Before
+	}
+	if input.SenderPhoneNumber != "" {
+		opts.SenderPhoneNumber = &input.SenderPhoneNumber
+	}
+	if input.ChatJID != "" {
+		opts.ChatJID = &input.ChatJID
+	}
+	if input.Query != "" {
+		opts.Query = &input.Query
+	}
+	if input.IncludeContext != nil {
+		opts.IncludeContext = *input.IncludeContext
+	}
+
+	result, page, err := store.ListMessages(opts)
+	if err != nil {
+		return nil, messagesResult{}, err
+	}
+	if result == nil {
+		result = []db.MessageDict{}
+	}
+	return nil, messagesResult{Messages: result, Count: len(result), PageInfo: page}, nil
+}
+
+func (s *Server) handleListMentions(ctx context.Context, req *mcp.CallToolRequest, input listMentionsInput) (*mcp.CallToolResult, messagesResult, error) {
+	store, _, err := s.account(input.Account)
+	if err != nil {
+		return nil, messagesResult{}, err
+	}
+	opts := db.ListMessagesOpts{
+		MentionsMe: true,
+		Cursor:     input.Cursor,
+		Limit:      input.Limit,
+		Page:       input.Page,
+	}
+	if input.ChatJID != "" {
+		opts.ChatJID = &input.ChatJID
+	}
+	if input.After != "" {
+		opts.After = &input.After
+	}
+	if input.Before != "" {
+		opts.Before = &input.Before
+	}
+
+	result, page, err := store.ListMessages(opts)
+	if err != nil {
+		return nil, messagesResult{}, err
+	}
+	if result == nil {
+		result = []db.MessageDict{}
+	}
+	return nil, messagesResult{Messages: result, Count: len(result), PageInfo: page}, nil
+}
+
+func (s *Server) handleListStarredMessages(ctx context.Context, req *mcp.CallToolRequest, input listStarredMessagesInput) (*mcp.CallToolResult, messagesResult, error) {
+	store, _, err := s.account(input.Account)
+	if err != nil {
+		return nil, messagesResult{}, err
+	}
+	opts := db.ListMessagesOpts{
+		Starred: true,
+		Cursor:  input.Cursor,
+		Limit:   input.Limit,
+		Page:    input.Page,
+	}
+	if input.ChatJID != "" {
+		opts.ChatJID = &input.ChatJID
+	}
+
+	result, page, err := store.ListMessages(opts)
+	if err != nil {
+		return nil, messagesResult{}, err
+	}
+	if result == nil {
+		result = []db.MessageDict{}
+	}
+	return nil, messagesResult{Messages: result, Count: len(result), PageInfo: page}, nil
+}
+
+type semanticSearchResult struct {
+	Matches []db.SemanticMatch `json:"matches"`
+	Count   int                `json:"count"`
+	Indexed int                `json:"indexed_messages"`
+}
+
+func (s *Server) handleSemanticSearchMessages(ctx context.Context, req *mcp.CallToolRequest, input semanticSearchMessagesInput) (*mcp.CallToolResult, semanticSearchResult, error) {
+	_, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, semanticSearchResult{}, err
+	}
+	if strings.TrimSpace(input.Query) == "" {
+		return nil, semanticSearchResult{}, fmt.Errorf("query must be provided")
+	}
+	if client == nil {
+		return nil, semanticSearchResult{}, fmt.Errorf("WhatsApp client not available")
+	}
+	opts := db.SemanticSearchOpts{Limit: min(input.Limit, 100), MinScore: input.MinScore}
+	if input.ChatJID != "" {
+		opts.ChatJID = &input.ChatJID
+	}
+	if input.After != "" {
+		opts.After = &input.After
+	}
+	if input.Before != "" {
+		opts.Before = &input.Before
+	}
+
+	matches, indexed, err := client.SemanticSearch(ctx, input.Query, opts)
+	if err != nil {
+		return nil, semanticSearchResult{}, err
+	}
+	return nil, semanticSearchResult{Matches: matches, Count: len(matches), Indexed: indexed}, nil
+}
+
+func (s *Server) handleListChats(ctx context.Context, req *mcp.CallToolRequest, input listChatsInput) (*mcp.CallToolResult, chatsResult, error) {
+	store, _, err := s.account(input.Account)
+	if err != nil {
+		return nil, chatsResult{}, err
+	}
+	opts := db.ListChatsOpts{
+		Limit:              input.Limit,
+		Page:               input.Page,
+		IncludeLastMessage: true,
+		SortBy:             input.SortBy,
+	}
+	if input.Query != "" {
+		opts.Query = &input.Query
+	}
+	if input.IncludeLastMessage != nil {
+		opts.IncludeLastMessage = *input.IncludeLastMessage
+	}
+
+	result, page, err := store.ListChats(opts)
+	if err != nil {
+		return nil, chatsResult{}, err
+	}
+	if result == nil {
+		result = []db.ChatDict{}
+	}
+	return nil, chatsResult{Chats: result, Count: len(result), PageInfo: page}, nil
+}
+
+func (s *Server) handleListUnreadChats(ctx context.Context, req *mcp.CallToolRequest, input listUnreadChatsInput) (*mcp.CallToolResult, chatsResult, error) {
+	store, _, err := s.account(input.Account)
+	if err != nil {
+		return nil, chatsResult{}, err
+	}
+	result, page, err := store.ListUnreadChats(input.Limit)
+	if err != nil {
+		return nil, chatsResult{}, err
+	}
+	return nil, chatsResult{Chats: result, Count: len(result), PageInfo: page}, nil
+}
+
+func (s *Server) handleGetChat(ctx context.Context, req *mcp.CallToolRequest, input getChatInput) (*mcp.CallToolResult, chatResult, error) {
+	store, _, err := s.account(input.Account)
+	if err != nil {
+		return nil, chatResult{}, err
+	}
+	includeLastMsg := true
+	if input.IncludeLastMessage != nil {
+		includeLastMsg = *input.IncludeLastMessage
+	}
+	result, err := store.GetChat(input.ChatJID, includeLastMsg)
+	if err != nil {
+		return nil, chatResult{}, err
+	}
+	if result == nil {
+		return nil, chatResult{}, fmt.Errorf("chat not found: %s", input.ChatJID)
+	}
+	return nil, chatResult{Chat: *result}, nil
+}
+
+func (s *Server) handleGetDirectChatByContact(ctx context.Context, req *mcp.CallToolRequest, input getDirectChatByContactInput) (*mcp.CallToolResult, chatResult, error) {
+	store, _, err := s.account(input.Account)
+	if err != nil {
+		return nil, chatResult{}, err
+	}
+	result, err := store.GetDirectChatByContact(input.SenderPhoneNumber)
+	if err != nil {
+		return nil, chatResult{}, err
+	}
+	if result == nil {
+		return nil, chatResult{}, fmt.Errorf("no direct chat found for: %s", input.SenderPhoneNumber)
+	}
+	return nil, chatResult{Chat: *result}, nil
+}
+
+func (s *Server) handleGetContactChats(ctx context.Context, req *mcp.CallToolRequest, input getContactChatsInput) (*mcp.CallToolResult, chatsResult, error) {
+	store, _, err := s.account(input.Account)
+	if err != nil {
+		return nil, chatsResult{}, err
+	}
+	result, page, err := store.GetContactChats(input.JID, input.Limit, input.Page)
+	if err != nil {
+		return nil, chatsResult{}, err
+	}
+	if result == nil {
+		result = []db.ChatDict{}
+	}
+	return nil, chatsResult{Chats: result, Count: len(result), PageInfo: page}, nil
+}
+
+func (s *Server) handleGetLastInteraction(ctx context.Context, req *mcp.CallToolRequest, input getLastInteractionInput) (*mcp.CallToolResult, messageResult, error) {
+	store, _, err := s.account(input.Account)
+	if err != nil {
+		return nil, messageResult{}, err
+	}
+	result, err := store.GetLastInteraction(input.JID)
+	if err != nil {
+		return nil, messageResult{}, err
+	}
+	if result == nil {
+		return nil, messageResult{}, fmt.Errorf("no interaction found for: %s", input.JID)
+	}
+	return nil, messageResult{Message: *result}, nil
+}
+
+type heatmapResult struct {
+	db.Heatmap
+}
+
+func (s *Server) handleGetChatHeatmap(ctx context.Context, req *mcp.CallToolRequest, input getChatHeatmapInput) (*mcp.CallToolResult, heatmapResult, error) {
+	store, _, err := s.account(input.Account)
+	if err != nil {
+		return nil, heatmapResult{}, err
+	}
+	h, err := store.ChatHeatmap(db.HeatmapOpts{ChatJID: input.ChatJID, Sender: input.Sender, After: input.After})
+	if err != nil {
+		return nil, heatmapResult{}, err
+	}
+	return nil, heatmapResult{Heatmap: *h}, nil
+}
+
+type chatStatisticsResult struct {
+	db.ChatStatistics
+}
+
+func (s *Server) handleGetChatStatistics(ctx context.Context, req *mcp.CallToolRequest, input getChatStatisticsInput) (*mcp.CallToolResult, chatStatisticsResult, error) {
+	store, _, err := s.account(input.Account)
+	if err != nil {
+		return nil, chatStatisticsResult{}, err
+	}
+	st, err := store.ChatStatistics(db.StatsOpts{
+		ChatJID: input.ChatJID,
+		After:   input.After,
+		Before:  input.Before,
+		TopN:    input.Top,
+	})
+	if err != nil {
+		return nil, chatStatisticsResult{}, err
+	}
+	return nil, chatStatisticsResult{ChatStatistics: *st}, nil
+}
+
+type chatDigestResult struct {
+	db.ChatDigest
+}
+
+func (s *Server) handleGetChatDigest(ctx context.Context, req *mcp.CallToolRequest, input getChatDigestInput) (*mcp.CallToolResult, chatDigestResult, error) {
+	store, _, err := s.account(input.Account)
+	if err != nil {
+		return nil, chatDigestResult{}, err
+	}
+	digest, err := store.ChatDigest(db.DigestOpts{
+		ChatJID:   input.ChatJID,
+		After:     input.After,
+		Before:    input.Before,
+		MaxTokens: input.MaxTokens,
+	})
+	if err != nil {
+		return nil, chatDigestResult{}, err
+	}
+	return nil, chatDigestResult{ChatDigest: *digest}, nil
+}
+
+func (s *Server) handleGetMessageContext(ctx context.Context, req *mcp.CallToolRequest, input getMessageContextInput) (*mcp.CallToolResult, messageContextResult, error) {
+	store, _, err := s.account(input.Account)
+	if err != nil {
+		return nil, messageContextResult{}, err
+	}
+	result, err := store.GetMessageContext(input.MessageID, input.Before, input.After)
+	if err != nil {
+		return nil, messageContextResult{}, err
+	}
+	if result == nil {
+		return nil, messageContextResult{}, fmt.Errorf("message not found: %s", input.MessageID)
+	}
+	return nil, messageContextResult{Context: *result}, nil
+}
+
+type threadResult struct {
+	db.ThreadDict
+}
+
+func (s *Server) handleGetThread(ctx context.Context, req *mcp.CallToolRequest, input getThreadInput) (*mcp.CallToolResult, threadResult, error) {
+	store, _, err := s.account(input.Account)
+	if err != nil {
+		return nil, threadResult{}, err
+	}
+	thread, err := store.GetThread(input.MessageID, input.ChatJID)
+	if err != nil {
+		return nil, threadResult{}, err
+	}
+	return nil, threadResult{*thread}, nil
+}
+
+func (s *Server) handleSyncHistory(ctx context.Context, req *mcp.CallToolRequest, input syncHistoryInput) (*mcp.CallToolResult, sendResult, error) {
+	_, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, sendResult{}, err
+	}
+	if client == nil {
+		return nil, sendResult{Success: false, Message: "WhatsApp client not available"}, nil
+	}
+	success, msg := client.RequestHistory(ctx, input.ChatJID, input.BeforeMessageID, input.Count)
+	return nil, sendResult{Success: success, Message: msg}, nil
+}
+
+// fetchOlderMessagesResult is the structured output of fetch_older_messages.
+type fetchOlderMessagesResult struct {
+	Success       bool    `json:"success"`
+	Message       string  `json:"message"`
+	Requested     int     `json:"requested"`
+	Added         int     `json:"added"`    // new messages stored
+	Answered      bool    `json:"answered"` // the phone answered within the wait
+	AnchorID      string  `json:"anchor_id,omitempty"`
+	OldestMessage *string `json:"oldest_message,omitempty"`
+}
+
+func (s *Server) handleFetchOlderMessages(ctx context.Context, req *mcp.CallToolRequest, input fetchOlderMessagesInput) (*mcp.CallToolResult, fetchOlderMessagesResult, error) {
+	_, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, fetchOlderMessagesResult{}, err
+	}
+	if client == nil {
+		return nil, fetchOlderMessagesResult{Success: false, Message: "WhatsApp client not available"}, nil
+	}
+	if input.ChatJID == "" {
+		return nil, fetchOlderMessagesResult{Success: false, Message: "chat_jid must be provided"}, nil
+	}
+	var before time.Time
+	if input.Before != "" {
+		if before, err = parseDate(input.Before); err != nil {
+			return nil, fetchOlderMessagesResult{Success: false, Message: err.Error()}, nil
+		}
+	}
+	wait := 60 * time.Second
+	if input.WaitSeconds > 0 {
+		wait = time.Duration(min(input.WaitSeconds, 300)) * time.Second
+	}
+
+	fetched, err := client.FetchOlderMessages(ctx, input.ChatJID, before, input.Count, wait)
+	if err != nil {
+		return nil, fetchOlderMessagesResult{Success: false, Message: err.Error()}, nil
+	}
+	result := fetchOlderMessagesResult{
+		Success:   true,
+		Requested: fetched.Requested,
+		Added:     fetched.Added,
+		Answered:  fetched.Answered,
+		AnchorID:  fetched.AnchorID,
+	}
+	if fetched.Oldest != nil {
+		ts := fetched.Oldest.Format(time.RFC3339)
+		result.OldestMessage = &ts
+	}
+	if fetched.Answered {
+		result.Message = fmt.Sprintf("Stored %d new messages of %s", fetched.Added, input.ChatJID)
+	} else {
+		result.Message = fmt.Sprintf("The phone did not answer within %s; messages it sends later are still stored (%d new so far)", wait, fetched.Added)
+	}
+	return nil, result, nil
+}
+
+// parseDate parses an ISO-8601 date, with or without a time of day.
+// Times without a zone are local.
+func parseDate(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q: expected ISO-8601 such as 2024-05-01 or 2024-05-01T14:30:00Z", s)
+}
+
+func (s *Server) handleGetSyncStatus(ctx context.Context, req *mcp.CallToolRequest, input getSyncStatusInput) (*mcp.CallToolResult, db.SyncStatus, error) {
+	store, _, err := s.account(input.Account)
+	if err != nil {
+		return nil, db.SyncStatus{}, err
+	}
+	limit := 20
+	if input.Limit > 0 {
+		limit = input.Limit
+	}
+	st, err := store.GetSyncStatus(input.ChatJID, limit)
+	if err != nil {
+		return nil, db.SyncStatus{}, err
+	}
+	return nil, *st, nil
+}
+
+type groupsResult struct {
+	Groups []db.GroupDict `json:"groups"`
+	Count  int            `json:"count"`
+}
+
+type groupResult struct {
+	Group db.GroupDict `json:"group"`
+}
+
+func (s *Server) handleListGroups(ctx context.Context, req *mcp.CallToolRequest, input listGroupsInput) (*mcp.CallToolResult, groupsResult, error) {
+	store, _, err := s.account(input.Account)
+	if err != nil {
+		return nil, groupsResult{}, err
+	}
+	result, err := store.ListGroups(input.Query, input.Limit, input.Page)
+	if err != nil {
+		return nil, groupsResult{}, err
+	}
+	return nil, groupsResult{Groups: result, Count: len(result)}, nil
+}
+
+func (s *Server) handleGetGroupInfo(ctx context.Context, req *mcp.CallToolRequest, input getGroupInfoInput) (*mcp.CallToolResult, groupResult, error) {
+	store, _, err := s.account(input.Account)
+	if err != nil {
+		return nil, groupResult{}, err
+	}
+	result, err := store.GetGroup(input.GroupJID)
+	if err != nil {
+		return nil, groupResult{}, err
+	}
+	if result == nil {
+		return nil, groupResult{}, fmt.Errorf("group not found: %s", input.GroupJID)
+	}
+	return nil, groupResult{Group: *result}, nil
+}
+
+type groupHistoryResult struct {
+	Items []db.GroupHistoryItem `json:"items"`
+	Count int                   `json:"count"`
+}
+
+func (s *Server) handleGetGroupHistory(ctx context.Context, req *mcp.CallToolRequest, input getGroupHistoryInput) (*mcp.CallToolResult, groupHistoryResult, error) {
+	store, _, err := s.account(input.Account)
+	if err != nil {
+		return nil, groupHistoryResult{}, err
+	}
+	result, err := store.GroupHistory(input.GroupJID, input.Limit, input.Before)
+	if err != nil {
+		return nil, groupHistoryResult{}, err
+	}
+	return nil, groupHistoryResult{Items: result, Count: len(result)}, nil
+}
+
+type statusesResult struct {
+	Statuses []db.StatusDict `json:"statuses"`
+	Count    int             `json:"count"`
+}
+
+func (s *Server) handleListContactStatuses(ctx context.Context, req *mcp.CallToolRequest, input listContactStatusesInput) (*mcp.CallToolResult, statusesResult, error) {
+	store, _, err := s.account(input.Account)
+	if err != nil {
+		return nil, statusesResult{}, err
+	}
+	result, err := store.ListStatuses(input.JID)
+	if err != nil {
+		return nil, statusesResult{}, err
+	}
+	return nil, statusesResult{Statuses: result, Count: len(result)}, nil
+}
+
+type watchRuleResult struct {
+	db.WatchRule
+	URI string `json:"uri"`
+}
+
+type watchRulesResult struct {
+	Rules []watchRuleResult `json:"rules"`
+	Count int               `json:"count"`
+}
+
+func (s *Server) handleAddWatchRule(ctx context.Context, req *mcp.CallToolRequest, input addWatchRuleInput) (*mcp.CallToolResult, sendResult, error) {
+	store, _, err := s.account(input.Account)
+	if err != nil {
+		return nil, sendResult{}, err
+	}
+	if !watchRuleNamePattern.MatchString(input.Name) {
+		return nil, sendResult{Success: false, Message: "Rule name must consist of letters, digits, - and _"}, nil
+	}
+	if input.Keyword == "" && input.Sender == "" && input.ChatJID == "" && !input.MentionsMe {
+		return nil, sendResult{Success: false, Message: "At least one of keyword, sender, chat_jid or mentions_me must be set"}, nil
+	}
+	rule := db.WatchRule{
+		Name:       input.Name,
+		Keyword:    input.Keyword,
+		Sender:     input.Sender,
+		ChatJID:    input.ChatJID,
+		MentionsMe: input.MentionsMe,
+	}
+	if err := store.SaveWatchRule(rule); err != nil {
+		return nil, sendResult{}, err
+	}
+	return nil, sendResult{Success: true, Message: fmt.Sprintf("Watch rule %s saved; subscribe to %s%s", input.Name, watchURIPrefix, input.Name)}, nil
+}
+
+func (s *Server) handleExportMetadata(ctx context.Context, req *mcp.CallToolRequest, input exportMetadataInput) (*mcp.CallToolResult, sendResult, error) {
+	store, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, sendResult{}, err
+	}
+	if input.Path == "" {
+		return nil, sendResult{Success: false, Message: "path must be provided"}, nil
+	}
+	path, err := client.AllowedNewFile(input.Path)
+	if err != nil {
+		return nil, sendResult{Success: false, Message: err.Error()}, nil
+	}
+	b, err := store.ExportMetadataFile(path)
+	if err != nil {
+		return nil, sendResult{Success: false, Message: err.Error()}, nil
+	}
+	return nil, sendResult{Success: true, Message: fmt.Sprintf("Exported %s to %s", b.Summary(), input.Path)}, nil
+}
+
+func (s *Server) handleImportMetadata(ctx context.Context, req *mcp.CallToolRequest, input importMetadataInput) (*mcp.CallToolResult, sendResult, error) {
+	store, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, sendResult{}, err
+	}
+	if input.Path == "" {
+		return nil, sendResult{Success: false, Message: "path must be provided"}, nil
+	}
+	path, err := client.AllowedFile(input.Path)
+	if err != nil {
+		return nil, sendResult{Success: false, Message: err.Error()}, nil
+	}
+	b, err := store.ImportMetadataFile(path)
+	if err != nil {
+		return nil, sendResult{Success: false, Message: err.Error()}, nil
+	}
+	return nil, sendResult{Success: true, Message: fmt.Sprintf("Imported %s from %s", b.Summary(), input.Path)}, nil
+}
+
+func (s *Server) handleExportChat(ctx context.Context, req *mcp.CallToolRequest, input exportChatInput) (*mcp.CallToolResult, sendResult, error) {
+	store, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, sendResult{}, err
+	}
+	if input.ChatJID == "" || input.Path == "" {
+		return nil, sendResult{Success: false, Message: "chat_jid and path must be provided"}, nil
+	}
+	path, err := client.AllowedNewFile(input.Path)
+	if err != nil {
+		return nil, sendResult{Success: false, Message: err.Error()}, nil
+	}
+	opts := db.ExportChatOpts{
+		ChatJID:      input.ChatJID,
+		Format:       input.Format,
+		Path:         path,
+		After:        input.After,
+		Before:       input.Before,
+		IncludeMedia: input.IncludeMedia,
+	}
+	if input.Redaction != "" {
+		if opts.Redaction, err = store.GetRedactionProfile(input.Redaction); err != nil {
+			return nil, sendResult{}, err
+		}
+		if opts.Redaction == nil {
+			return nil, sendResult{Success: false, Message: fmt.Sprintf("No redaction profile named %s", input.Redaction)}, nil
+		}
+	}
+	n, err := store.ExportChat(opts)
+	if err != nil {
+		return nil, sendResult{Success: false, Message: err.Error()}, nil
+	}
+	return nil, sendResult{Success: true, Message: fmt.Sprintf("Exported %d messages of %s to %s", n, input.ChatJID, input.Path)}, nil
+}
+
+type redactionProfilesResult struct {
+	Profiles []db.RedactionProfile `json:"profiles"`
+	Count    int                   `json:"count"`
+}
+
+func (s *Server) handleSetRedactionProfile(ctx context.Context, req *mcp.CallToolRequest, input setRedactionProfileInput) (*mcp.CallToolResult, sendResult, error) {
+	store, _, err := s.account(input.Account)
+	if err != nil {
+		return nil, sendResult{}, err
+	}
+	if input.Name == "" {
+		return nil, sendResult{Success: false, Message: "name must be provided"}, nil
+	}
+	var dropped []string
+	for _, p := range input.DropParticipants {
+		if p = strings.TrimSpace(p); p != "" {
+			dropped = append(dropped, p)
+		}
+	}
+	if !input.StripMedia && !input.MaskNumbers && len(dropped) == 0 {
+		return nil, sendResult{Success: false, Message: "At least one of strip_media, mask_numbers or drop_participants must be set"}, nil
+	}
+	profile := db.RedactionProfile{
+		Name:             input.Name,
+		StripMedia:       input.StripMedia,
+		MaskNumbers:      input.MaskNumbers,
+		DropParticipants: dropped,
+	}
+	if err := store.SaveRedactionProfile(profile); err != nil {
+		return nil, sendResult{}, err
+	}
+	return nil, sendResult{Success: true, Message: fmt.Sprintf("Redaction profile %s saved", input.Name)}, nil
+}
+
+func (s *Server) handleRemoveRedactionProfile(ctx context.Context, req *mcp.CallToolRequest, input removeRedactionProfileInput) (*mcp.CallToolResult, sendResult, error) {
+	store, _, err := s.account(input.Account)
+	if err != nil {
+		return nil, sendResult{}, err
+	}
+	found, err := store.DeleteRedactionProfile(input.Name)
+	if err != nil {
+		return nil, sendResult{}, err
+	}
+	if !found {
+		return nil, sendResult{Success: false, Message: fmt.Sprintf("No redaction profile named %s", input.Name)}, nil
+	}
+	return nil, sendResult{Success: true, Message: fmt.Sprintf("Redaction profile %s removed", input.Name)}, nil
+}
+
+func (s *Server) handleListRedactionProfiles(ctx context.Context, req *mcp.CallToolRequest, input accountInput) (*mcp.CallToolResult, redactionProfilesResult, error) {
+	store, _, err := s.account(input.Account)
+	if err != nil {
+		return nil, redactionProfilesResult{}, err
+	}
+	profiles, err := store.ListRedactionProfiles()
+	if err != nil {
+		return nil, redactionProfilesResult{}, err
+	}
+	return nil, redactionProfilesResult{Profiles: profiles, Count: len(profiles)}, nil
+}
+
+func (s *Server) handleRemoveWatchRule(ctx context.Context, req *mcp.CallToolRequest, input removeWatchRuleInput) (*mcp.CallToolResult, sendResult, error) {
+	store, _, err := s.account(input.Account)
+	if err != nil {
+		return nil, sendResult{}, err
+	}
+	found, err := store.DeleteWatchRule(input.Name)
+	if err != nil {
+		return nil, sendResult{}, err
+	}
+	if !found {
+		return nil, sendResult{Success: false, Message: fmt.Sprintf("No watch rule named %s", input.Name)}, nil
+	}
+	return nil, sendResult{Success: true, Message: fmt.Sprintf("Watch rule %s removed", input.Name)}, nil
+}
+
+func (s *Server) handleListWatchRules(ctx context.Context, req *mcp.CallToolRequest, input accountInput) (*mcp.CallToolResult, watchRulesResult, error) {
+	store, _, err := s.account(input.Account)
+	if err != nil {
+		return nil, watchRulesResult{}, err
+	}
+	rules, err := store.ListWatchRules()
+	if err != nil {
+		return nil, watchRulesResult{}, err
+	}
+	result := make([]watchRuleResult, 0, len(rules))
+	for _, r := range rules {
+		result = append(result, watchRuleResult{WatchRule: r, URI: watchURIPrefix + r.Name})
+	}
+	return nil, watchRulesResult{Rules: result, Count: len(result)}, nil
+}
+
+type moderationRulesResult struct {
+	Rules []db.ModerationRule `json:"rules"`
+	Count int                 `json:"count"`
+}
+
+type moderationLogResult struct {
+	Entries []db.ModerationLogEntry `json:"entries"`
+	Count   int                     `json:"count"`
+}
+
+func (s *Server) handleAddModerationRule(ctx context.Context, req *mcp.CallToolRequest, input addModerationRuleInput) (*mcp.CallToolResult, sendResult, error) {
+	store, _, err := s.account(input.Account)
+	if err != nil {
+		return nil, sendResult{}, err
+	}
+	if input.Name == "" {
+		return nil, sendResult{Success: false, Message: "name must be provided"}, nil
+	}
+	if input.GroupJID != "" && !strings.HasSuffix(input.GroupJID, "@g.us") {
+		return nil, sendResult{Success: false, Message: "group_jid must be a group JID (ending in @g.us)"}, nil
+	}
+	var words []string
+	for _, w := range input.BannedWords {
+		if w = strings.TrimSpace(w); w != "" {
+			words = append(words, w)
+		}
+	}
+	if len(words) == 0 && !input.BlockLinks {
+		return nil, sendResult{Success: false, Message: "At least one of banned_words or block_links must be set"}, nil
+	}
+	rule := db.ModerationRule{
+		Name:        input.Name,
+		GroupJID:    input.GroupJID,
+		BannedWords: words,
+		BlockLinks:  input.BlockLinks,
+	}
+	if err := store.SaveModerationRule(rule); err != nil {
+		return nil, sendResult{}, err
+	}
+	scope := "every group you admin"
+	if input.GroupJID != "" {
+		scope = input.GroupJID
+	}
+	return nil, sendResult{Success: true, Message: fmt.Sprintf("Moderation rule %s saved for %s", input.Name, scope)}, nil
+}
+
+func (s *Server) handleRemoveModerationRule(ctx context.Context, req *mcp.CallToolRequest, input removeModerationRuleInput) (*mcp.CallToolResult, sendResult, error) {
+	store, _, err := s.account(input.Account)
+	if err != nil {
+		return nil, sendResult{}, err
+	}
+	found, err := store.DeleteModerationRule(input.Name)
+	if err != nil {
+		return nil, sendResult{}, err
+	}
+	if !found {
+		return nil, sendResult{Success: false, Message: fmt.Sprintf("No moderation rule named %s", input.Name)}, nil
+	}
+	return nil, sendResult{Success: true, Message: fmt.Sprintf("Moderation rule %s removed", input.Name)}, nil
+}
+
+func (s *Server) handleListModerationRules(ctx context.Context, req *mcp.CallToolRequest, input accountInput) (*mcp.CallToolResult, moderationRulesResult, error) {
+	store, _, err := s.account(input.Account)
+	if err != nil {
+		return nil, moderationRulesResult{}, err
+	}
+	rules, err := store.ListModerationRules()
+	if err != nil {
+		return nil, moderationRulesResult{}, err
+	}
+	return nil, moderationRulesResult{Rules: rules, Count: len(rules)}, nil
+}
+
+func (s *Server) handleGetModerationLog(ctx context.Context, req *mcp.CallToolRequest, input getModerationLogInput) (*mcp.CallToolResult, moderationLogResult, error) {
+	store, _, err := s.account(input.Account)
+	if err != nil {
+		return nil, moderationLogResult{}, err
+	}
+	entries, err := store.GetModerationLog(input.GroupJID, input.Limit)
+	if err != nil {
+		return nil, moderationLogResult{}, err
+	}
+	return nil, moderationLogResult{Entries: entries, Count: len(entries)}, nil
+}
+
+type auditLogResult struct {
+	Entries []db.AuditEntry `json:"entries"`
+	Count   int             `json:"count"`
+	db.PageInfo
+}
+
+func (s *Server) handleGetAuditLog(ctx context.Context, req *mcp.CallToolRequest, input getAuditLogInput) (*mcp.CallToolResult, auditLogResult, error) {
+	store, _, err := s.account(input.Account)
+	if err != nil {
+		return nil, auditLogResult{}, err
+	}
+	entries, page, err := store.GetAuditLog(db.AuditLogOpts{
+		Tool:    input.Tool,
+		Session: input.Session,
+		After:   input.After,
+		Before:  input.Before,
+		Limit:   input.Limit,
+		Page:    input.Page,
+	})
+	if err != nil {
+		return nil, auditLogResult{}, err
+	}
+	return nil, auditLogResult{Entries: entries, Count: len(entries), PageInfo: page}, nil
+}
+
+type sendResult struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+	Queued  bool   `json:"queued,omitempty"` // waiting in the outbox until reconnect
+
+	// Set when the server requires confirmation: call again with it to proceed
+	ConfirmationToken string `json:"confirmation_token,omitempty"`
+}
+
+func (s *Server) handleSendMessage(ctx context.Context, req *mcp.CallToolRequest, input sendMessageInput) (*mcp.CallToolResult, sendResult, error) {
+	store, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, sendResult{}, err
+	}
+	if input.Recipient == "" {
+		return nil, sendResult{Success: false, Message: "Recipient must be provided"}, nil
+	}
+	if client == nil {
+		return nil, sendResult{Success: false, Message: "WhatsApp client not available"}, nil
+	}
+	result, err := idempotent(ctx, s, store, "send_message", input.idempotencyInput, func(ctx context.Context) (sendResult, error) {
+		success, queued, msg := client.SendMessage(ctx, input.Recipient, input.Message, input.Mentions, input.Force)
+		return sendResult{Success: success, Message: msg, Queued: queued}, nil
+	})
+	return nil, result, err
+}
+
+type broadcastRecipientResult struct {
+	Recipient string `json:"recipient"`
+	Success   bool   `json:"success"`
+	Queued    bool   `json:"queued,omitempty"`
+	Message   string `json:"message"`
+}
+
+type broadcastResult struct {
+	Success bool                       `json:"success"` // every recipient was sent to or queued
+	Message string                     `json:"message"`
+	Sent    int                        `json:"sent"`
+	Queued  int                        `json:"queued"`
+	Failed  int                        `json:"failed"`
+	Results []broadcastRecipientResult `json:"results"`
+}
+
+func (s *Server) handleSendBroadcast(ctx context.Context, req *mcp.CallToolRequest, input sendBroadcastInput) (*mcp.CallToolResult, broadcastResult, error) {
+	store, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, broadcastResult{}, err
+	}
+	if len(input.Recipients) == 0 {
+		return nil, broadcastResult{Success: false, Message: "At least one recipient must be provided"}, nil
+	}
+	if len(input.Recipients) > wa.MaxBroadcastRecipients {
+		return nil, broadcastResult{Success: false, Message: fmt.Sprintf("At most %d recipients per broadcast", wa.MaxBroadcastRecipients)}, nil
+	}
+	if client == nil {
+		return nil, broadcastResult{Success: false, Message: "WhatsApp client not available"}, nil
+	}
+
+	interval := wa.DefaultBroadcastInterval
+	if input.IntervalSeconds > 0 {
+		interval = max(time.Duration(input.IntervalSeconds*float64(time.Second)), wa.MinBroadcastInterval)
+	}
+	recipients := make([]wa.BroadcastRecipient, len(input.Recipients))
+	for i, r := range input.Recipients {
+		recipients[i] = wa.BroadcastRecipient{Recipient: r.Recipient, Vars: r.Vars}
+	}
+
+	out, err := idempotent(ctx, s, store, "send_broadcast", input.idempotencyInput, func(ctx context.Context) (broadcastResult, error) {
+		out := broadcastResult{Results: []broadcastRecipientResult{}}
+		for _, r := range client.SendBroadcast(ctx, recipients, input.Message, interval) {
+			out.Results = append(out.Results, broadcastRecipientResult{Recipient: r.Recipient, Success: r.Success, Queued: r.Queued, Message: r.Message})
+			switch {
+			case r.Queued:
+				out.Queued++
+			case r.Success:
+				out.Sent++
+			default:
+				out.Failed++
+			}
+		}
+		out.Success = out.Failed == 0
+		out.Message = fmt.Sprintf("Sent to %d of %d recipients", out.Sent, len(recipients))
+		if out.Queued > 0 {
+			out.Message += fmt.Sprintf(", %d queued until reconnect", out.Queued)
+		}
+		return out, nil
+	})
+	return nil, out, err
+}
+
+func (s *Server) handleCreateTemplate(ctx context.Context, req *mcp.CallToolRequest, input createTemplateInput) (*mcp.CallToolResult, sendResult, error) {
+	store, _, err := s.account(input.Account)
+	if err != nil {
+		return nil, sendResult{}, err
+	}
+	name := strings.TrimSpace(input.Name)
+	if name == "" || strings.TrimSpace(input.Body) == "" {
+		return nil, sendResult{Success: false, Message: "Name and body must be provided"}, nil
+	}
+	replaced, err := store.SaveTemplate(name, input.Body, input.Description)
+	if err != nil {
+		return nil, sendResult{}, err
+	}
+	msg := fmt.Sprintf("Template %s saved", name)
+	if replaced {
+		msg = fmt.Sprintf("Template %s replaced", name)
+	}
+	if placeholders := wa.TemplatePlaceholders(input.Body); len(placeholders) > 0 {
+		msg += fmt.Sprintf(" with placeholders %s", strings.Join(placeholders, ", "))
+	}
+	return nil, sendResult{Success: true, Message: msg}, nil
+}
+
+type templatesResult struct {
+	Templates []db.TemplateDict `json:"templates"`
+	Count     int               `json:"count"`
+}
+
+func (s *Server) handleListTemplates(ctx context.Context, req *mcp.CallToolRequest, input accountInput) (*mcp.CallToolResult, templatesResult, error) {
+	store, _, err := s.account(input.Account)
+	if err != nil {
+		return nil, templatesResult{}, err
+	}
+	templates, err := store.ListTemplates()
+	if err != nil {
+		return nil, templatesResult{}, err
+	}
+	for i := range templates {
+		templates[i].Placeholders = wa.TemplatePlaceholders(templates[i].Body)
+	}
+	return nil, templatesResult{Templates: templates, Count: len(templates)}, nil
+}
+
+func (s *Server) handleSendTemplate(ctx context.Context, req *mcp.CallToolRequest, input sendTemplateInput) (*mcp.CallToolResult, sendResult, error) {
+	store, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, sendResult{}, err
+	}
+	if input.Recipient == "" {
+		return nil, sendResult{Success: false, Message: "Recipient must be provided"}, nil
+	}
+	if client == nil {
+		return nil, sendResult{Success: false, Message: "WhatsApp client not available"}, nil
+	}
+	result, err := idempotent(ctx, s, store, "send_template", input.idempotencyInput, func(ctx context.Context) (sendResult, error) {
+		success, queued, msg := client.SendTemplate(ctx, input.Recipient, input.Name, input.Vars, input.Force)
+		return sendResult{Success: success, Message: msg, Queued: queued}, nil
+	})
+	return nil, result, err
+}
+
+type sendStatusResult struct {
+	Send db.SendDict `json:"send"`
+}
+
+func (s *Server) handleGetSendStatus(ctx context.Context, req *mcp.CallToolRequest, input getSendStatusInput) (*mcp.CallToolResult, sendStatusResult, error) {
+	store, _, err := s.account(input.Account)
+	if err != nil {
+		return nil, sendStatusResult{}, err
+	}
+	result, err := store.GetSend(input.SendID)
+	if err != nil {
+		return nil, sendStatusResult{}, err
+	}
+	if result == nil {
+		return nil, sendStatusResult{}, fmt.Errorf("send not found: %d", input.SendID)
+	}
+	return nil, sendStatusResult{Send: *result}, nil
+}
+
+type outboxResult struct {
+	Sends []db.SendDict `json:"sends"`
+	Count int           `json:"count"`
+}
+
+func (s *Server) handleListOutbox(ctx context.Context, req *mcp.CallToolRequest, input accountInput) (*mcp.CallToolResult, outboxResult, error) {
+	store, _, err := s.account(input.Account)
+	if err != nil {
+		return nil, outboxResult{}, err
+	}
+	sends, err := store.ListOutbox()
+	if err != nil {
+		return nil, outboxResult{}, err
+	}
+	if sends == nil {
+		sends = []db.SendDict{}
+	}
+	return nil, outboxResult{Sends: sends, Count: len(sends)}, nil
+}
+
+func (s *Server) handleCancelOutboxMessage(ctx context.Context, req *mcp.CallToolRequest, input getSendStatusInput) (*mcp.CallToolResult, sendResult, error) {
+	store, _, err := s.account(input.Account)
+	if err != nil {
+		return nil, sendResult{}, err
+	}
+	cancelled, err := store.CancelSend(input.SendID)
+	if err != nil {
+		return nil, sendResult{}, err
+	}
+	if !cancelled {
+		return nil, sendResult{Success: false, Message: fmt.Sprintf("Send %d is not waiting in the outbox", input.SendID)}, nil
+	}
+	return nil, sendResult{Success: true, Message: fmt.Sprintf("Send %d cancelled", input.SendID)}, nil
+}
+
+type sendPolicyResult struct {
+	Success      bool                `json:"success"`
+	Message      string              `json:"message"`
+	Rules        []db.SendPolicyRule `json:"rules"`
+	ServerPolicy *wa.SendPolicy      `json:"server_policy,omitempty"` // from the server's flags; read-only
+}
+
+func (s *Server) handleManageSendPolicy(ctx context.Context, req *mcp.CallToolRequest, input manageSendPolicyInput) (*mcp.CallToolResult, sendPolicyResult, error) {
+	store, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, sendPolicyResult{}, err
+	}
+	for _, pattern := range append(input.Allow, input.Deny...) {
+		if err := wa.ValidSendPattern(pattern); err != nil {
+			return nil, sendPolicyResult{Success: false, Message: err.Error(), Rules: []db.SendPolicyRule{}}, nil
+		}
+	}
+
+	var changes []string
+	for _, pattern := range input.Remove {
+		removed, err := store.RemoveSendPolicyRule(pattern)
+		if err != nil {
+			return nil, sendPolicyResult{}, err
+		}
+		if removed {
+			changes = append(changes, "removed "+pattern)
+		} else {
+			changes = append(changes, pattern+" was not in the policy")
+		}
+	}
+	for _, pattern := range input.Allow {
+		if err := store.SetSendPolicyRule(pattern, db.SendAllow); err != nil {
+			return nil, sendPolicyResult{}, err
+		}
+		changes = append(changes, "allowed "+pattern)
+	}
+	for _, pattern := range input.Deny {
+		if err := store.SetSendPolicyRule(pattern, db.SendDeny); err != nil {
+			return nil, sendPolicyResult{}, err
+		}
+		changes = append(changes, "denied "+pattern)
+	}
+
+	rules, err := store.ListSendPolicy()
+	if err != nil {
+		return nil, sendPolicyResult{}, err
+	}
+	result := sendPolicyResult{Success: true, Rules: rules}
+	if client != nil && !client.SendPolicy.Empty() {
+		result.ServerPolicy = client.SendPolicy
+	}
+	switch {
+	case len(changes) > 0:
+		result.Message = "Send policy updated: " + strings.Join(changes, ", ")
+	case len(rules) == 0 && result.ServerPolicy == nil:
+		result.Message = "No send policy: messages can be sent to anyone"
+	default:
+		result.Message = fmt.Sprintf("Send policy has %d rules", len(rules))
+	}
+	return nil, result, nil
+}
+
+func (s *Server) handleRetryFailedSends(ctx context.Context, req *mcp.CallToolRequest, input accountInput) (*mcp.CallToolResult, sendResult, error) {
+	_, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, sendResult{}, err
+	}
+	if client == nil {
+		return nil, sendResult{Success: false, Message: "WhatsApp client not available"}, nil
+	}
+	retried, succeeded, err := client.RetryFailedSends()
+	if err != nil {
+		return nil, sendResult{}, err
+	}
+	return nil, sendResult{
+		Success: succeeded == retried,
+		Message: fmt.Sprintf("Retried %d failed sends, %d succeeded", retried, succeeded),
+	}, nil
+}
+
+type connectionError struct {
+	Time   string `json:"time"`
+	Kind   string `json:"kind"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type connectionStatusResult struct {
+	Connected        bool              `json:"connected"`
+	LoggedIn         bool              `json:"logged_in"`
+	JID              string            `json:"jid,omitempty"`
+	PushName         string            `json:"push_name,omitempty"`
+	LastConnected    *string           `json:"last_connected,omitempty"`
+	LastDisconnected *string           `json:"last_disconnected,omitempty"`
+	Errors           []connectionError `json:"recent_errors"`
+}
+
+// connectionStatusFrom converts a client's connection status to its JSON form.
+func connectionStatusFrom(st wa.ConnectionStatus) connectionStatusResult {
+	result := connectionStatusResult{
+		Connected: st.Connected,
+		LoggedIn:  st.LoggedIn,
+		JID:       st.JID,
+		PushName:  st.PushName,
+		Errors:    make([]connectionError, 0, len(st.Errors)),
+	}
+	if !st.LastConnected.IsZero() {
+		ts := st.LastConnected.Format(time.RFC3339)
+		result.LastConnected = &ts
+	}
+	if !st.LastDisconnected.IsZero() {
+		ts := st.LastDisconnected.Format(time.RFC3339)
+		result.LastDisconnected = &ts
+	}
+	for _, e := range st.Errors {
+		result.Errors = append(result.Errors, connectionError{Time: e.Time.Format(time.RFC3339), Kind: e.Kind, Detail: e.Detail})
+	}
+	return result
+}
+
+func (s *Server) handleGetConnectionStatus(ctx context.Context, req *mcp.CallToolRequest, input accountInput) (*mcp.CallToolResult, connectionStatusResult, error) {
+	_, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, connectionStatusResult{}, err
+	}
+	if client == nil {
+		return nil, connectionStatusResult{}, fmt.Errorf("WhatsApp client not available")
+	}
+	return nil, connectionStatusFrom(client.GetConnectionStatus()), nil
+}
+
+type healthEvent struct {
+	Time   string `json:"time"`
+	Kind   string `json:"kind"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type accountHealthResult struct {
+	Risk             string         `json:"risk"`
+	SendsLastHour    int            `json:"sends_last_hour"`
+	SendsLastDay     int            `json:"sends_last_day"`
+	FailuresLastHour int            `json:"failures_last_hour"`
+	FailuresLastDay  int            `json:"failures_last_day"`
+	FailureRate      float64        `json:"failure_rate"`
+	ErrorCodes       map[string]int `json:"error_codes"`
+	RecentEvents     []healthEvent  `json:"recent_events"`
+	Warnings         []string       `json:"warnings"`
+}
+
+func (s *Server) handleGetAccountHealth(ctx context.Context, req *mcp.CallToolRequest, input accountInput) (*mcp.CallToolResult, accountHealthResult, error) {
+	_, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, accountHealthResult{}, err
+	}
+	if client == nil {
+		return nil, accountHealthResult{}, fmt.Errorf("WhatsApp client not available")
+	}
+	h := client.GetAccountHealth()
+	result := accountHealthResult{
+		Risk:             h.Risk,
+		SendsLastHour:    h.SendsLastHour,
+		SendsLastDay:     h.SendsLastDay,
+		FailuresLastHour: h.FailuresLastHour,
+		FailuresLastDay:  h.FailuresLastDay,
+		FailureRate:      h.FailureRate,
+		ErrorCodes:       h.ErrorCodes,
+		RecentEvents:     []healthEvent{},
+		Warnings:         h.Warnings,
+	}
+	for _, e := range h.RecentEvents {
+		result.RecentEvents = append(result.RecentEvents, healthEvent{Time: e.Time.Format(time.RFC3339), Kind: e.Kind, Detail: e.Detail})
+	}
+	if result.Warnings == nil {
+		result.Warnings = []string{}
+	}
+	return nil, result, nil
+}
+
+func (s *Server) handleSendFile(ctx context.Context, req *mcp.CallToolRequest, input sendFileInput) (*mcp.CallToolResult, sendResult, error) {
+	store, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, sendResult{}, err
+	}
+	if input.Recipient == "" {
+		return nil, sendResult{Success: false, Message: "Recipient must be provided"}, nil
+	}
+	if client == nil {
+		return nil, sendResult{Success: false, Message: "WhatsApp client not available"}, nil
+	}
+	result, err := idempotent(ctx, s, store, "send_file", input.idempotencyInput, func(ctx context.Context) (sendResult, error) {
+		success, msg := client.SendMedia(ctx, input.Recipient, input.MediaPath, input.Caption, input.MimeType)
+		return sendResult{Success: success, Message: msg}, nil
+	})
+	return nil, result, err
+}
+
+type albumItemResult struct {
+	Path      string `json:"path"`
+	Success   bool   `json:"success"`
+	MessageID string `json:"message_id,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+type sendAlbumResult struct {
+	Success bool              `json:"success"`
+	Message string            `json:"message"`
+	Items   []albumItemResult `json:"items"`
+}
+
+func (s *Server) handleSendAlbum(ctx context.Context, req *mcp.CallToolRequest, input sendAlbumInput) (*mcp.CallToolResult, sendAlbumResult, error) {
+	store, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, sendAlbumResult{}, err
+	}
+	if input.Recipient == "" {
+		return nil, sendAlbumResult{Success: false, Message: "Recipient must be provided", Items: []albumItemResult{}}, nil
+	}
+	if client == nil {
+		return nil, sendAlbumResult{Success: false, Message: "WhatsApp client not available", Items: []albumItemResult{}}, nil
+	}
+	result, err := idempotent(ctx, s, store, "send_album", input.idempotencyInput, func(ctx context.Context) (sendAlbumResult, error) {
+		items, success, msg := client.SendAlbum(ctx, input.Recipient, input.MediaPaths, input.Caption)
+		result := sendAlbumResult{Success: success, Message: msg, Items: make([]albumItemResult, 0, len(items))}
+		for _, item := range items {
+			result.Items = append(result.Items, albumItemResult{Path: item.Path, Success: item.Success, MessageID: item.MessageID, Error: item.Error})
+		}
+		return result, nil
+	})
+	return nil, result, err
+}
+
+func (s *Server) handleSendAudioMessage(ctx context.Context, req *mcp.CallToolRequest, input sendAudioMessageInput) (*mcp.CallToolResult, sendResult, error) {
+	store, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, sendResult{}, err
+	}
+	if input.Recipient == "" {
+		return nil, sendResult{Success: false, Message: "Recipient must be provided"}, nil
+	}
+	if client == nil {
+		return nil, sendResult{Success: false, Message: "WhatsApp client not available"}, nil
+	}
+	result, err := idempotent(ctx, s, store, "send_audio_message", input.idempotencyInput, func(ctx context.Context) (sendResult, error) {
+		success, msg := client.SendAudioMessage(ctx, input.Recipient, input.MediaPath)
+		return sendResult{Success: success, Message: msg}, nil
+	})
+	return nil, result, err
+}
+
+func (s *Server) handleSendSticker(ctx context.Context, req *mcp.CallToolRequest, input sendStickerInput) (*mcp.CallToolResult, sendResult, error) {
+	store, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, sendResult{}, err
+	}
+	if input.Recipient == "" {
+		return nil, sendResult{Success: false, Message: "Recipient must be provided"}, nil
+	}
+	if client == nil {
+		return nil, sendResult{Success: false, Message: "WhatsApp client not available"}, nil
+	}
+	result, err := idempotent(ctx, s, store, "send_sticker", input.idempotencyInput, func(ctx context.Context) (sendResult, error) {
+		success, msg := client.SendSticker(ctx, input.Recipient, input.MediaPath)
+		return sendResult{Success: success, Message: msg}, nil
+	})
+	return nil, result, err
+}
+
+func (s *Server) handleSendGIF(ctx context.Context, req *mcp.CallToolRequest, input sendGIFInput) (*mcp.CallToolResult, sendResult, error) {
+	store, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, sendResult{}, err
+	}
+	if input.Recipient == "" {
+		return nil, sendResult{Success: false, Message: "Recipient must be provided"}, nil
+	}
+	if client == nil {
+		return nil, sendResult{Success: false, Message: "WhatsApp client not available"}, nil
+	}
+	result, err := idempotent(ctx, s, store, "send_gif", input.idempotencyInput, func(ctx context.Context) (sendResult, error) {
+		success, msg := client.SendGIF(ctx, input.Recipient, input.MediaPath, input.Caption)
+		return sendResult{Success: success, Message: msg}, nil
+	})
+	return nil, result, err
+}
+
+func (s *Server) handleSendContactCard(ctx context.Context, req *mcp.CallToolRequest, input sendContactCardInput) (*mcp.CallToolResult, sendResult, error) {
+	store, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, sendResult{}, err
+	}
+	if input.Recipient == "" {
+		return nil, sendResult{Success: false, Message: "Recipient must be provided"}, nil
+	}
+	if client == nil {
+		return nil, sendResult{Success: false, Message: "WhatsApp client not available"}, nil
+	}
+	result, err := idempotent(ctx, s, store, "send_contact_card", input.idempotencyInput, func(ctx context.Context) (sendResult, error) {
+		success, msg := client.SendContactCard(ctx, input.Recipient, input.Name, input.Phone, input.VCard)
+		return sendResult{Success: success, Message: msg}, nil
+	})
+	return nil, result, err
+}
+
+func (s *Server) handleSendLocation(ctx context.Context, req *mcp.CallToolRequest, input sendLocationInput) (*mcp.CallToolResult, sendResult, error) {
+	store, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, sendResult{}, err
+	}
+	if input.Recipient == "" {
+		return nil, sendResult{Success: false, Message: "Recipient must be provided"}, nil
+	}
+	if client == nil {
+		return nil, sendResult{Success: false, Message: "WhatsApp client not available"}, nil
+	}
+	result, err := idempotent(ctx, s, store, "send_location", input.idempotencyInput, func(ctx context.Context) (sendResult, error) {
+		success, msg := client.SendLocation(ctx, input.Recipient, input.Latitude, input.Longitude, input.Name, input.Address)
+		return sendResult{Success: success, Message: msg}, nil
+	})
+	return nil, result, err
+}
+
+func (s *Server) handlePostStatus(ctx context.Context, req *mcp.CallToolRequest, input postStatusInput) (*mcp.CallToolResult, sendResult, error) {
+	store, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, sendResult{}, err
+	}
+	if client == nil {
+		return nil, sendResult{Success: false, Message: "WhatsApp client not available"}, nil
+	}
+	result, err := idempotent(ctx, s, store, "post_status", input.idempotencyInput, func(ctx context.Context) (sendResult, error) {
+		success, msg := client.SendStatus(ctx, input.Text, input.ImagePath)
+		return sendResult{Success: success, Message: msg}, nil
+	})
+	return nil, result, err
+}
+
+func (s *Server) handleCreatePoll(ctx context.Context, req *mcp.CallToolRequest, input createPollInput) (*mcp.CallToolResult, sendResult, error) {
+	store, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, sendResult{}, err
+	}
+	if input.Recipient == "" {
+		return nil, sendResult{Success: false, Message: "Recipient must be provided"}, nil
+	}
+	if client == nil {
+		return nil, sendResult{Success: false, Message: "WhatsApp client not available"}, nil
+	}
+	result, err := idempotent(ctx, s, store, "create_poll", input.idempotencyInput, func(ctx context.Context) (sendResult, error) {
+		success, msg := client.CreatePoll(ctx, input.Recipient, input.Question, input.Options, input.MultiSelect)
+		return sendResult{Success: success, Message: msg}, nil
+	})
+	return nil, result, err
+}
+
+type pollResultsResult struct {
+	Poll db.PollResultsDict `json:"poll"`
+}
+
+func (s *Server) handleGetPollResults(ctx context.Context, req *mcp.CallToolRequest, input getPollResultsInput) (*mcp.CallToolResult, pollResultsResult, error) {
+	store, _, err := s.account(input.Account)
+	if err != nil {
+		return nil, pollResultsResult{}, err
+	}
+	result, err := store.GetPollResults(input.PollID, input.ChatJID)
+	if err != nil {
+		return nil, pollResultsResult{}, err
+	}
+	if result == nil {
+		return nil, pollResultsResult{}, fmt.Errorf("poll not found: %s", input.PollID)
+	}
+	return nil, pollResultsResult{Poll: *result}, nil
+}
+
+type downloadResult struct {
+	Success       bool   `json:"success"`
+	Message       string `json:"message"`
+	FilePath      string `json:"file_path,omitempty"`
+	ThumbnailPath string `json:"thumbnail_path,omitempty"` // images and videos
+	URL           string `json:"url,omitempty"`            // presigned archive URL, instead of the file path
+	URLExpiresAt  string `json:"url_expires_at,omitempty"`
+}
+
+func (s *Server) handleDownloadMedia(ctx context.Context, req *mcp.CallToolRequest, input downloadMediaInput) (*mcp.CallToolResult, downloadResult, error) {
+	_, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, downloadResult{}, err
+	}
+	if client == nil {
+		return nil, downloadResult{Success: false, Message: "WhatsApp client not available"}, nil
+	}
+	download := client.DownloadMedia
+	if input.AcknowledgeViewOnce {
+		download = client.DownloadViewOnceMedia
+	}
+	if token := req.Params.GetProgressToken(); token != nil {
+		ctx = wa.WithProgress(ctx, func(done, total int64) {
+			_ = req.Session.NotifyProgress(ctx, &mcp.ProgressNotificationParams{
+				ProgressToken: token,
+				Message:       "Downloading media",
+				Progress:      float64(done),
+				Total:         float64(total),
+			})
+		})
+	}
+	path, err := download(ctx, input.MessageID, input.ChatJID)
+	if err != nil {
+		return nil, downloadResult{Success: false, Message: err.Error()}, nil
+	}
+	if client.MediaURLs {
+		url, expires, err := client.MediaURL(input.MessageID, input.ChatJID)
+		if err == nil {
+			return nil, downloadResult{Success: true, Message: "Media archived", URL: url, URLExpiresAt: expires.Format(time.RFC3339)}, nil
+		}
+		// Fall back to the local file, which was downloaded anyway
+		return nil, downloadResult{Success: true, Message: fmt.Sprintf("Media downloaded, but no archive URL: %v", err), FilePath: path, ThumbnailPath: wa.MediaThumbnail(path)}, nil
+	}
+	return nil, downloadResult{Success: true, Message: "Media downloaded successfully", FilePath: path, ThumbnailPath: wa.MediaThumbnail(path)}, nil
+}
+
+type transcriptResult struct {
+	Success    bool           `json:"success"`
+	Message    string         `json:"message,omitempty"`
+	Transcript *db.Transcript `json:"transcript,omitempty"`
+}
+
+func (s *Server) handleTranscribeAudio(ctx context.Context, req *mcp.CallToolRequest, input transcribeAudioInput) (*mcp.CallToolResult, transcriptResult, error) {
+	_, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, transcriptResult{}, err
+	}
+	t, err := client.TranscribeAudio(ctx, input.ChatJID, input.MessageID, input.Force)
+	if err != nil {
+		return nil, transcriptResult{Success: false, Message: err.Error()}, nil
+	}
+	return nil, transcriptResult{Success: true, Transcript: t}, nil
+}
+
+type chatStorageResult struct {
+	ChatJID string  `json:"chat_jid"`
+	Name    *string `json:"name,omitempty"`
+	Files   int     `json:"files"`
+	Bytes   int64   `json:"bytes"`
+}
+
+type storageUsageResult struct {
+	MediaFiles    int                 `json:"media_files"`
+	MediaBytes    int64               `json:"media_bytes"`
+	DatabaseBytes int64               `json:"database_bytes"`
+	Chats         []chatStorageResult `json:"chats"` // largest first
+}
+
+func (s *Server) handleGetStorageUsage(ctx context.Context, req *mcp.CallToolRequest, input accountInput) (*mcp.CallToolResult, storageUsageResult, error) {
+	store, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, storageUsageResult{}, err
+	}
+	if client == nil {
+		return nil, storageUsageResult{}, fmt.Errorf("WhatsApp client not available")
+	}
+	usage, err := client.StorageUsage()
+	if err != nil {
+		return nil, storageUsageResult{}, err
+	}
+
+	result := storageUsageResult{
+		MediaFiles:    usage.MediaFiles,
+		MediaBytes:    usage.MediaBytes,
+		DatabaseBytes: usage.DatabaseBytes,
+		Chats:         []chatStorageResult{},
+	}
+	for _, cs := range usage.Chats {
+		r := chatStorageResult{ChatJID: cs.ChatJID, Files: cs.Files, Bytes: cs.Bytes}
+		if chat, err := store.GetChat(cs.ChatJID, false); err == nil && chat != nil {
+			r.Name = chat.Name
+		}
+		result.Chats = append(result.Chats, r)
+	}
+	return nil, result, nil
+}
+
+type cleanupMediaResult struct {
+	Success        bool   `json:"success"`
+	Message        string `json:"message"`
+	FilesDeleted   int    `json:"files_deleted"`
+	BytesFreed     int64  `json:"bytes_freed"`
+	BytesRemaining int64  `json:"bytes_remaining"`
+}
+
+func (s *Server) handleCleanupMedia(ctx context.Context, req *mcp.CallToolRequest, input cleanupMediaInput) (*mcp.CallToolResult, cleanupMediaResult, error) {
+	_, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, cleanupMediaResult{}, err
+	}
+	if client == nil {
+		return nil, cleanupMediaResult{Success: false, Message: "WhatsApp client not available"}, nil
+	}
+	quota := client.MediaQuota
+	if input.MaxSizeMB > 0 || input.MaxAgeDays > 0 {
+		quota = wa.MediaQuota{
+			MaxBytes: int64(input.MaxSizeMB) << 20,
+			MaxAge:   time.Duration(input.MaxAgeDays) * 24 * time.Hour,
+		}
+	}
+	if !quota.Enabled() {
+		return nil, cleanupMediaResult{Success: false, Message: "No limit given: set max_size_mb or max_age_days"}, nil
+	}
+
+	cleanup, err := client.CleanupMedia(quota, input.DryRun)
+	if err != nil {
+		return nil, cleanupMediaResult{}, err
+	}
+	msg := fmt.Sprintf("Deleted %d files (%d MB) to enforce %s", cleanup.FilesDeleted, cleanup.BytesFreed>>20, quota)
+	if input.DryRun {
+		msg = fmt.Sprintf("Would delete %d files (%d MB) to enforce %s", cleanup.FilesDeleted, cleanup.BytesFreed>>20, quota)
+	}
+	return nil, cleanupMediaResult{
+		Success:        true,
+		Message:        msg,
+		FilesDeleted:   cleanup.FilesDeleted,
+		BytesFreed:     cleanup.BytesFreed,
+		BytesRemaining: cleanup.BytesRemaining,
+	}, nil
+}
+
+type purgeMessagesResult struct {
+	Success    bool   `json:"success"`
+	Message    string `json:"message"`
+	Messages   int    `json:"messages"`
+	MediaFiles int    `json:"media_files"`
+}
+
+func (s *Server) handlePurgeMessages(ctx context.Context, req *mcp.CallToolRequest, input purgeMessagesInput) (*mcp.CallToolResult, purgeMessagesResult, error) {
+	_, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, purgeMessagesResult{}, err
+	}
+	if client == nil {
+		return nil, purgeMessagesResult{Success: false, Message: "WhatsApp client not available"}, nil
+	}
+	if input.ChatJID == "" && input.After == "" && input.Before == "" {
+		return nil, purgeMessagesResult{Success: false, Message: "Nothing selected: set chat_jid, after or before"}, nil
+	}
+
+	opts := db.PurgeOpts{ChatJID: input.ChatJID, After: input.After, Before: input.Before}
+	result, err := client.PurgeMessages(opts, input.DryRun)
+	if err != nil {
+		return nil, purgeMessagesResult{}, err
+	}
+	msg := fmt.Sprintf("Deleted %d messages and %d media files", result.Messages, len(result.MediaPaths))
+	if input.DryRun {
+		msg = fmt.Sprintf("Would delete %d messages and %d media files", result.Messages, len(result.MediaPaths))
+	}
+	return nil, purgeMessagesResult{
+		Success:    true,
+		Message:    msg,
+		Messages:   result.Messages,
+		MediaFiles: len(result.MediaPaths),
+	}, nil
+}
+
+type importChatExportResult struct {
+	Success              bool                 `json:"success"`
+	Message              string               `json:"message"`
+	UnmappedParticipants []string             `json:"unmapped_participants,omitempty"`
+	Result               *db.ImportChatResult `json:"result,omitempty"`
+}
+
+func (s *Server) handleImportChatExport(ctx context.Context, req *mcp.CallToolRequest, input importChatExportInput) (*mcp.CallToolResult, importChatExportResult, error) {
+	store, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, importChatExportResult{}, err
+	}
+	if input.DateOrder != "" && input.DateOrder != db.DateOrderDMY && input.DateOrder != db.DateOrderMDY {
+		return nil, importChatExportResult{Success: false, Message: "date_order must be dmy or mdy"}, nil
+	}
+	path, err := client.AllowedFile(input.Path)
+	if err != nil {
+		return nil, importChatExportResult{Success: false, Message: err.Error()}, nil
+	}
+	opts := db.ImportChatOpts{
+		ChatJID:      input.ChatJID,
+		Path:         path,
+		Participants: input.Participants,
+		DateOrder:    input.DateOrder,
+		DryRun:       input.DryRun,
+	}
+	if client != nil && client.WA.Store.ID != nil {
+		opts.OwnJID = client.WA.Store.ID.ToNonAD().String()
+	}
+	result, err := store.ImportChat(opts)
+	var unmapped *db.UnmappedParticipantsError
+	if errors.As(err, &unmapped) {
+		return nil, importChatExportResult{Success: false, Message: err.Error(), UnmappedParticipants: unmapped.Names}, nil
+	}
+	if err != nil {
+		return nil, importChatExportResult{Success: false, Message: err.Error()}, nil
+	}
+	msg := fmt.Sprintf("Imported %d of %d messages into %s (%d already stored)", result.Imported, result.Parsed, input.ChatJID, result.Duplicate)
+	if input.DryRun {
+		msg = fmt.Sprintf("Would import %d of %d messages into %s (%d already stored)", result.Imported, result.Parsed, input.ChatJID, result.Duplicate)
+	}
+	return nil, importChatExportResult{Success: true, Message: msg, Result: &result}, nil
+}
+
+type backupResult struct {
+	Success bool       `json:"success"`
+	Message string     `json:"message"`
+	Backup  *wa.Backup `json:"backup,omitempty"`
+}
+
+func (s *Server) handleBackupStore(ctx context.Context, req *mcp.CallToolRequest, input backupStoreInput) (*mcp.CallToolResult, backupResult, error) {
+	_, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, backupResult{}, err
+	}
+	if client == nil {
+		return nil, backupResult{Success: false, Message: "WhatsApp client not available"}, nil
+	}
+	b, err := client.BackupStore(ctx, input.IncludeMedia || client.Backups.Media)
+	if err != nil {
+		return nil, backupResult{Success: false, Message: err.Error()}, nil
+	}
+	msg := fmt.Sprintf("Backup written to %s (%d MB)", b.Path, b.Bytes>>20)
+	if keep := client.Backups.Keep; keep > 0 {
+		if n, err := wa.PruneBackups(client.BackupDir(), keep); err != nil {
+			msg += fmt.Sprintf("; deleting old backups failed: %v", err)
+		} else if n > 0 {
+			msg += fmt.Sprintf("; deleted %d old backups", n)
+		}
+	}
+	return nil, backupResult{Success: true, Message: msg, Backup: b}, nil
+}
+
+type listBackupsResult struct {
+	Dir     string      `json:"dir"`
+	Backups []wa.Backup `json:"backups"`
+	Count   int         `json:"count"`
+}
+
+func (s *Server) handleListBackups(ctx context.Context, req *mcp.CallToolRequest, input accountInput) (*mcp.CallToolResult, listBackupsResult, error) {
+	_, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, listBackupsResult{}, err
+	}
+	if client == nil {
+		return nil, listBackupsResult{}, fmt.Errorf("WhatsApp client not available")
+	}
+	backups, err := wa.ListBackups(client.BackupDir())
+	if err != nil {
+		return nil, listBackupsResult{}, err
+	}
+	if backups == nil {
+		backups = []wa.Backup{}
+	}
+	return nil, listBackupsResult{Dir: client.BackupDir(), Backups: backups, Count: len(backups)}, nil
+}
+
+func (s *Server) handleRestoreStore(ctx context.Context, req *mcp.CallToolRequest, input restoreStoreInput) (*mcp.CallToolResult, sendResult, error) {
+	_, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, sendResult{}, err
+	}
+	if client == nil {
+		return nil, sendResult{Success: false, Message: "WhatsApp client not available"}, nil
+	}
+	if input.Path == "" {
+		return nil, sendResult{Success: false, Message: "path must be provided"}, nil
+	}
+	description := fmt.Sprintf("replace the messages database with the backup %s, losing messages stored since", input.Path)
+	if input.IncludeMedia {
+		description += ", and restore its media"
+	}
+	if r := s.confirm("restore_store", input.confirmInput, description, input.Account, input.Path); r != nil {
+		return nil, *r, nil
+	}
+	if err := client.RestoreStore(ctx, input.Path, input.IncludeMedia); err != nil {
+		return nil, sendResult{Success: false, Message: err.Error()}, nil
+	}
+	return nil, sendResult{Success: true, Message: fmt.Sprintf("Restored %s", input.Path)}, nil
+}
+
+// --- Chat management handlers ---
+
+func (s *Server) handleRevokeMessage(ctx context.Context, req *mcp.CallToolRequest, input revokeMessageInput) (*mcp.CallToolResult, sendResult, error) {
+	store, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, sendResult{}, err
+	}
+	if client == nil {
+		return nil, sendResult{Success: false, Message: "WhatsApp client not available"}, nil
+	}
+	description := fmt.Sprintf("revoke message %s in %s for everyone", input.MessageID, chatLabel(store, input.ChatJID))
+	if m, err := store.GetMessage(input.MessageID, input.ChatJID); err == nil && m != nil {
+		description += fmt.Sprintf(" (from %s: %q)", m.Sender, preview(m.Content))
+	} else {
+		description += " (not in the local database)"
+	}
+	if r := s.confirm("revoke_message", input.confirmInput, description, input.Account, input.ChatJID, input.MessageID, input.SenderJID); r != nil {
+		return nil, *r, nil
+	}
+	success, msg := client.RevokeMessage(ctx, input.ChatJID, input.MessageID, input.SenderJID)
+	return nil, sendResult{Success: success, Message: msg}, nil
+}
+
+func (s *Server) handleEditMessage(ctx context.Context, req *mcp.CallToolRequest, input editMessageInput) (*mcp.CallToolResult, sendResult, error) {
+	_, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, sendResult{}, err
+	}
+	if input.NewText == "" {
+		return nil, sendResult{Success: false, Message: "New text must be provided"}, nil
+	}
+	if client == nil {
+		return nil, sendResult{Success: false, Message: "WhatsApp client not available"}, nil
+	}
+	success, msg := client.EditMessage(ctx, input.ChatJID, input.MessageID, input.NewText)
+	return nil, sendResult{Success: success, Message: msg}, nil
+}
+
+func (s *Server) handleBlockContact(ctx context.Context, req *mcp.CallToolRequest, input blockContactInput) (*mcp.CallToolResult, sendResult, error) {
+	store, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, sendResult{}, err
+	}
+	if client == nil {
+		return nil, sendResult{Success: false, Message: "WhatsApp client not available"}, nil
+	}
+	description := "block contact " + chatLabel(store, input.JID)
+	if r := s.confirm("block_contact", input.confirmInput, description, input.Account, input.JID); r != nil {
+		return nil, *r, nil
+	}
+	success, msg := client.BlockContact(ctx, input.JID)
+	return nil, sendResult{Success: success, Message: msg}, nil
+}
+
+func (s *Server) handleUnblockContact(ctx context.Context, req *mcp.CallToolRequest, input unblockContactInput) (*mcp.CallToolResult, sendResult, error) {
+	_, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, sendResult{}, err
+	}
+	if client == nil {
+		return nil, sendResult{Success: false, Message: "WhatsApp client not available"}, nil
+	}
+	success, msg := client.UnblockContact(ctx, input.JID)
+	return nil, sendResult{Success: success, Message: msg}, nil
+}
+
+type blocklistResult struct {
+	BlockedJIDs []string `json:"blocked_jids"`
+	Count       int      `json:"count"`
+}
+
+func (s *Server) handleGetBlocklist(ctx context.Context, req *mcp.CallToolRequest, input accountInput) (*mcp.CallToolResult, blocklistResult, error) {
+	_, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, blocklistResult{}, err
+	}
+	if client == nil {
+		return nil, blocklistResult{}, fmt.Errorf("WhatsApp client not available")
+	}
+	jids, err := client.GetBlocklist(ctx)
+	if err != nil {
+		return nil, blocklistResult{}, err
+	}
+	if jids == nil {
+		jids = []string{}
+	}
+	return nil, blocklistResult{BlockedJIDs: jids, Count: len(jids)}, nil
+}
+
+type callsResult struct {
+	Calls []db.CallDict `json:"calls"`
+	Count int           `json:"count"`
+	db.PageInfo
+}
+
+func (s *Server) handleListCalls(ctx context.Context, req *mcp.CallToolRequest, input listCallsInput) (*mcp.CallToolResult, callsResult, error) {
+	store, _, err := s.account(input.Account)
+	if err != nil {
+		return nil, callsResult{}, err
+	}
+	calls, page, err := store.ListCalls(db.ListCallsOpts{
+		Caller: input.Caller,
+		Status: input.Status,
+		After:  input.After,
+		Before: input.Before,
+		Limit:  input.Limit,
+		Page:   input.Page,
+	})
+	if err != nil {
+		return nil, callsResult{}, err
+	}
+	return nil, callsResult{Calls: calls, Count: len(calls), PageInfo: page}, nil
+}
+
+func (s *Server) handleRejectCall(ctx context.Context, req *mcp.CallToolRequest, input rejectCallInput) (*mcp.CallToolResult, sendResult, error) {
+	_, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, sendResult{}, err
+	}
+	if client == nil {
+		return nil, sendResult{Success: false, Message: "WhatsApp client not available"}, nil
+	}
+	success, msg := client.RejectCall(ctx, input.CallID)
+	return nil, sendResult{Success: success, Message: msg}, nil
+}
+
+type presenceEntry struct {
+	JID      string  `json:"jid"`
+	Name     string  `json:"name"`
+	Status   string  `json:"status"` // online, offline or unknown
+	LastSeen *string `json:"last_seen,omitempty"`
+	Error    string  `json:"error,omitempty"`
+}
+
+type presenceSnapshotResult struct {
+	Contacts []presenceEntry `json:"contacts"`
+	Online   int             `json:"online"`
+	Count    int             `json:"count"`
+}
+
+func (s *Server) handleGetPresenceSnapshot(ctx context.Context, req *mcp.CallToolRequest, input getPresenceSnapshotInput) (*mcp.CallToolResult, presenceSnapshotResult, error) {
+	store, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, presenceSnapshotResult{}, err
+	}
+	if client == nil {
+		return nil, presenceSnapshotResult{}, fmt.Errorf("WhatsApp client not available")
+	}
+	if len(input.JIDs) == 0 {
+		return nil, presenceSnapshotResult{}, fmt.Errorf("at least one JID must be provided")
+	}
+	wait := 5 * time.Second
+	if input.WaitSeconds > 0 {
+		wait = time.Duration(min(input.WaitSeconds, 30)) * time.Second
+	}
+
+	statuses, err := client.GetPresenceSnapshot(ctx, input.JIDs, wait)
+	if err != nil {
+		return nil, presenceSnapshotResult{}, err
+	}
+
+	jids := make([]string, len(statuses))
+	for i, st := range statuses {
+		jids[i] = st.JID
+	}
+	names := store.DisplayNames(jids)
 
-type messagesResult struct {
-	Messages []db.MessageDict `json:"messages"`
-	Count    int              `json:"count"`
+	result := presenceSnapshotResult{Contacts: make([]presenceEntry, 0, len(statuses))}
+	for _, st := range statuses {
+		e := presenceEntry{JID: st.JID, Name: names[st.JID], Status: "unknown", Error: st.Error}
+		if st.Known {
+			e.Status = "offline"
+			if st.Online {
+				e.Status = "online"
+				result.Online++
+			}
+		}
+		if !st.LastSeen.IsZero() {
+			ts := st.LastSeen.Format(time.RFC3339)
+			e.LastSeen = &ts
+		}
+		result.Contacts = append(result.Contacts, e)
+	}
+	result.Count = len(result.Contacts)
+	return nil, result, nil
 }
 
-type chatsResult struct {
-	Chats []db.ChatDict `json:"chats"`
-	Count int           `json:"count"`
+type presenceSubscriptionEntry struct {
+	JID   string `json:"jid"`
+	Name  string `json:"name"`
+	Error string `json:"error,omitempty"`
 }
 
-type chatResult struct {
-	Chat db.ChatDict `json:"chat"`
+type subscribePresenceResult struct {
+	Success  bool                        `json:"success"`
+	Message  string                      `json:"message"`
+	Contacts []presenceSubscriptionEntry `json:"contacts"`
 }
 
-type messageResult struct {
-	Message db.MessageDict `json:"message"`
-}
+func (s *Server) handleSubscribePresence(ctx context.Context, req *mcp.CallToolRequest, input subscribePresenceInput) (*mcp.CallToolResult, subscribePresenceResult, error) {
+	store, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, subscribePresenceResult{}, err
+	}
+	if client == nil {
+		return nil, subscribePresenceResult{Success: false, Message: "WhatsApp client not available", Contacts: []presenceSubscriptionEntry{}}, nil
+	}
+	if len(input.JIDs) == 0 {
+		return nil, subscribePresenceResult{}, fmt.Errorf("at least one JID must be provided")
+	}
 
-type messageContextResult struct {
-	Context db.MessageContextDict `json:"context"`
-}
+	var subs []wa.PresenceSubscription
+	if input.Unsubscribe {
+		subs = client.UnsubscribePresence(input.JIDs)
+	} else if subs, err = client.SubscribePresence(ctx, input.JIDs); err != nil {
+		return nil, subscribePresenceResult{Success: false, Message: err.Error(), Contacts: []presenceSubscriptionEntry{}}, nil
+	}
 
-// --- Handlers ---
+	jids := make([]string, len(subs))
+	for i, sub := range subs {
+		jids[i] = sub.JID
+	}
+	names := store.DisplayNames(jids)
 
-func (s *Server) handleSearchContacts(ctx context.Context, req *mcp.CallToolRequest, input searchContactsInput) (*mcp.CallToolResult, contactsResult, error) {
-	result, err := s.store.SearchContacts(input.Query)
-	if err != nil {
-		return nil, contactsResult{}, err
+	result := subscribePresenceResult{Contacts: make([]presenceSubscriptionEntry, 0, len(subs))}
+	done := 0
+	for _, sub := range subs {
+		result.Contacts = append(result.Contacts, presenceSubscriptionEntry{JID: sub.JID, Name: names[sub.JID], Error: sub.Error})
+		if sub.Error == "" {
+			done++
+		}
 	}
-	if result == nil {
-		result = []db.ContactDict{}
+	result.Success = done > 0
+	if input.Unsubscribe {
+		result.Message = fmt.Sprintf("Unsubscribed from %d of %d contacts", done, len(subs))
+	} else {
+		result.Message = fmt.Sprintf("Subscribed to %d of %d contacts", done, len(subs))
 	}
-	return nil, contactsResult{Contacts: result, Count: len(result)}, nil
+	return nil, result, nil
 }
 
-func (s *Server) handleListMessages(ctx context.Context, req *mcp.CallToolRequest, input listMessagesInput) (*mcp.CallToolResult, messagesResult, error) {
-	opts := db.ListMessagesOpts{
-		Limit:          input.Limit,
-		Page:           input.Page,
-		IncludeContext: true,
-		ContextBefore:  input.ContextBefore,
-		ContextAfter:   input.ContextAfter,
+func (s *Server) handleGetContactPresence(ctx context.Context, req *mcp.CallToolRequest, input getContactPresenceInput) (*mcp.CallToolResult, db.ContactPresence, error) {
+	store, _, err := s.account(input.Account)
+	if err != nil {
+		return nil, db.ContactPresence{}, err
 	}
-	if input.After != "" {
-		opts.After = &input.After
+	if input.JID == "" {
+		return nil, db.ContactPresence{}, fmt.Errorf("jid must be provided")
 	}
-	if input.Before != "" {
-		opts.Before = &input.Before
+	days := 30
+	if input.Days > 0 {
+		days = input.Days
 	}
-	if input.SenderPhoneNumber != "" {
-		opts.SenderPhoneNumber = &input.SenderPhoneNumber
+	p, err := store.GetContactPresence(input.JID, time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		return nil, db.ContactPresence{}, err
 	}
-	if input.ChatJID != "" {
-		opts.ChatJID = &input.ChatJID
+	return nil, *p, nil
+}
+
+func (s *Server) handleSetChatProfile(ctx context.Context, req *mcp.CallToolRequest, input setChatProfileInput) (*mcp.CallToolResult, sendResult, error) {
+	store, _, err := s.account(input.Account)
+	if err != nil {
+		return nil, sendResult{}, err
 	}
-	if input.Query != "" {
-		opts.Query = &input.Query
+	if input.ChatJID == "" {
+		return nil, sendResult{Success: false, Message: "chat_jid must be provided"}, nil
 	}
-	if input.IncludeContext != nil {
-		opts.IncludeContext = *input.IncludeContext
+	if input.Clear {
+		if err := store.SetChatProfile(input.ChatJID, db.ChatProfile{}); err != nil {
+			return nil, sendResult{}, err
+		}
+		return nil, sendResult{Success: true, Message: fmt.Sprintf("Profile of %s removed", input.ChatJID)}, nil
 	}
 
-	result, err := s.store.ListMessages(opts)
+	switch input.Formality {
+	case "", "casual", "neutral", "formal":
+	default:
+		return nil, sendResult{Success: false, Message: "formality must be casual, neutral or formal"}, nil
+	}
+	switch input.Emoji {
+	case "", "none", "some", "lots":
+	default:
+		return nil, sendResult{Success: false, Message: "emoji must be none, some or lots"}, nil
+	}
+
+	// Omitted fields keep their previous value
+	profile, err := store.GetChatProfile(input.ChatJID)
 	if err != nil {
-		return nil, messagesResult{}, err
+		return nil, sendResult{}, err
 	}
-	if result == nil {
-		result = []db.MessageDict{}
+	if profile == nil {
+		profile = &db.ChatProfile{}
+	}
+	if input.Language != "" {
+		profile.Language = input.Language
+	}
+	if input.Formality != "" {
+		profile.Formality = input.Formality
 	}
-	return nil, messagesResult{Messages: result, Count: len(result)}, nil
+	if input.Emoji != "" {
+		profile.Emoji = input.Emoji
+	}
+	if err := store.SetChatProfile(input.ChatJID, *profile); err != nil {
+		return nil, sendResult{}, err
+	}
+	return nil, sendResult{Success: true, Message: fmt.Sprintf("Profile of %s saved", input.ChatJID)}, nil
 }
 
-func (s *Server) handleListChats(ctx context.Context, req *mcp.CallToolRequest, input listChatsInput) (*mcp.CallToolResult, chatsResult, error) {
-	opts := db.ListChatsOpts{
-		Limit:              input.Limit,
-		Page:               input.Page,
-		IncludeLastMessage: true,
-		SortBy:             input.SortBy,
+func (s *Server) handleMuteChat(ctx context.Context, req *mcp.CallToolRequest, input muteChatInput) (*mcp.CallToolResult, sendResult, error) {
+	_, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, sendResult{}, err
 	}
-	if input.Query != "" {
-		opts.Query = &input.Query
+	if client == nil {
+		return nil, sendResult{Success: false, Message: "WhatsApp client not available"}, nil
 	}
-	if input.IncludeLastMessage != nil {
-		opts.IncludeLastMessage = *input.IncludeLastMessage
+	if !input.Mute {
+		success, msg := client.UnmuteChat(ctx, input.ChatJID)
+		return nil, sendResult{Success: success, Message: msg}, nil
 	}
+	duration := time.Duration(input.DurationHours) * time.Hour
+	success, msg := client.MuteChat(ctx, input.ChatJID, duration)
+	return nil, sendResult{Success: success, Message: msg}, nil
+}
 
-	result, err := s.store.ListChats(opts)
+func (s *Server) handlePinChat(ctx context.Context, req *mcp.CallToolRequest, input pinChatInput) (*mcp.CallToolResult, sendResult, error) {
+	_, client, err := s.account(input.Account)
 	if err != nil {
-		return nil, chatsResult{}, err
+		return nil, sendResult{}, err
 	}
-	if result == nil {
-		result = []db.ChatDict{}
+	if client == nil {
+		return nil, sendResult{Success: false, Message: "WhatsApp client not available"}, nil
 	}
-	return nil, chatsResult{Chats: result, Count: len(result)}, nil
+	success, msg := client.PinChat(ctx, input.ChatJID, input.Pin)
+	return nil, sendResult{Success: success, Message: msg}, nil
 }
 
-func (s *Server) handleGetChat(ctx context.Context, req *mcp.CallToolRequest, input getChatInput) (*mcp.CallToolResult, chatResult, error) {
-	includeLastMsg := true
-	if input.IncludeLastMessage != nil {
-		includeLastMsg = *input.IncludeLastMessage
-	}
-	result, err := s.store.GetChat(input.ChatJID, includeLastMsg)
+func (s *Server) handleStarMessage(ctx context.Context, req *mcp.CallToolRequest, input starMessageInput) (*mcp.CallToolResult, sendResult, error) {
+	_, client, err := s.account(input.Account)
 	if err != nil {
-		return nil, chatResult{}, err
+		return nil, sendResult{}, err
 	}
-	if result == nil {
-		return nil, chatResult{}, fmt.Errorf("chat not found: %s", input.ChatJID)
+	if input.ChatJID == "" || input.MessageID == "" {
+		return nil, sendResult{Success: false, Message: "chat_jid and message_id must be provided"}, nil
 	}
-	return nil, chatResult{Chat: *result}, nil
+	if client == nil {
+		return nil, sendResult{Success: false, Message: "WhatsApp client not available"}, nil
+	}
+	success, msg := client.StarMessage(ctx, input.ChatJID, input.MessageID, input.Star)
+	return nil, sendResult{Success: success, Message: msg}, nil
 }
 
-func (s *Server) handleGetDirectChatByContact(ctx context.Context, req *mcp.CallToolRequest, input getDirectChatByContactInput) (*mcp.CallToolResult, chatResult, error) {
-	result, err := s.store.GetDirectChatByContact(input.SenderPhoneNumber)
+type labelsResult struct {
+	Labels []db.LabelDict `json:"labels"`
+	Count  int            `json:"count"`
+}
+
+func (s *Server) handleListLabels(ctx context.Context, req *mcp.CallToolRequest, input listLabelsInput) (*mcp.CallToolResult, labelsResult, error) {
+	store, _, err := s.account(input.Account)
 	if err != nil {
-		return nil, chatResult{}, err
+		return nil, labelsResult{}, err
 	}
-	if result == nil {
-		return nil, chatResult{}, fmt.Errorf("no direct chat found for: %s", input.SenderPhoneNumber)
+	labels, err := store.ListLabels()
+	if err != nil {
+		return nil, labelsResult{}, err
 	}
-	return nil, chatResult{Chat: *result}, nil
+	if labels == nil {
+		labels = []db.LabelDict{}
+	}
+	return nil, labelsResult{Labels: labels, Count: len(labels)}, nil
 }
 
-func (s *Server) handleGetContactChats(ctx context.Context, req *mcp.CallToolRequest, input getContactChatsInput) (*mcp.CallToolResult, chatsResult, error) {
-	result, err := s.store.GetContactChats(input.JID, input.Limit, input.Page)
+func (s *Server) handleGetChatsByLabel(ctx context.Context, req *mcp.CallToolRequest, input getChatsByLabelInput) (*mcp.CallToolResult, chatsResult, error) {
+	store, _, err := s.account(input.Account)
 	if err != nil {
 		return nil, chatsResult{}, err
 	}
-	if result == nil {
-		result = []db.ChatDict{}
+	label, err := store.FindLabel(input.Label)
+	if err != nil {
+		return nil, chatsResult{}, err
 	}
-	return nil, chatsResult{Chats: result, Count: len(result)}, nil
+	if label == nil {
+		return nil, chatsResult{}, fmt.Errorf("label not found: %s", input.Label)
+	}
+	result, page, err := store.ListChats(db.ListChatsOpts{
+		LabelID:            &label.ID,
+		Limit:              input.Limit,
+		Page:               input.Page,
+		IncludeLastMessage: input.IncludeLastMessage,
+	})
+	if err != nil {
+		return nil, chatsResult{}, err
+	}
+	return nil, chatsResult{Chats: result, Count: len(result), PageInfo: page}, nil
 }
 
-func (s *Server) handleGetLastInteraction(ctx context.Context, req *mcp.CallToolRequest, input getLastInteractionInput) (*mcp.CallToolResult, messageResult, error) {
-	result, err := s.store.GetLastInteraction(input.JID)
+func (s *Server) handleSetChatLabel(ctx context.Context, req *mcp.CallToolRequest, input setChatLabelInput) (*mcp.CallToolResult, sendResult, error) {
+	_, client, err := s.account(input.Account)
 	if err != nil {
-		return nil, messageResult{}, err
+		return nil, sendResult{}, err
 	}
-	if result == nil {
-		return nil, messageResult{}, fmt.Errorf("no interaction found for: %s", input.JID)
+	if input.ChatJID == "" || input.Label == "" {
+		return nil, sendResult{Success: false, Message: "chat_jid and label must be provided"}, nil
 	}
-	return nil, messageResult{Message: *result}, nil
+	if client == nil {
+		return nil, sendResult{Success: false, Message: "WhatsApp client not available"}, nil
+	}
+	success, msg := client.SetChatLabel(ctx, input.ChatJID, input.Label, input.Labeled)
+	return nil, sendResult{Success: success, Message: msg}, nil
 }
 
-func (s *Server) handleGetMessageContext(ctx context.Context, req *mcp.CallToolRequest, input getMessageContextInput) (*mcp.CallToolResult, messageContextResult, error) {
-	result, err := s.store.GetMessageContext(input.MessageID, input.Before, input.After)
+func (s *Server) handleArchiveChat(ctx context.Context, req *mcp.CallToolRequest, input archiveChatInput) (*mcp.CallToolResult, sendResult, error) {
+	_, client, err := s.account(input.Account)
 	if err != nil {
-		return nil, messageContextResult{}, err
+		return nil, sendResult{}, err
 	}
-	if result == nil {
-		return nil, messageContextResult{}, fmt.Errorf("message not found: %s", input.MessageID)
+	if client == nil {
+		return nil, sendResult{Success: false, Message: "WhatsApp client not available"}, nil
 	}
-	return nil, messageContextResult{Context: *result}, nil
-}
-
-type sendResult struct {
-	Success bool   `json:"success"`
-	Message string `json:"message"`
+	success, msg := client.ArchiveChat(ctx, input.ChatJID, input.Archive)
+	return nil, sendResult{Success: success, Message: msg}, nil
 }
 
-func (s *Server) handleSendMessage(ctx context.Context, req *mcp.CallToolRequest, input sendMessageInput) (*mcp.CallToolResult, sendResult, error) {
-	if input.Recipient == "" {
-		return nil, sendResult{Success: false, Message: "Recipient must be provided"}, nil
+func (s *Server) handleDeleteChat(ctx context.Context, req *mcp.CallToolRequest, input deleteChatInput) (*mcp.CallToolResult, sendResult, error) {
+	store, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, sendResult{}, err
 	}
-	if s.client == nil {
+	if client == nil {
 		return nil, sendResult{Success: false, Message: "WhatsApp client not available"}, nil
 	}
-	success, msg := s.client.SendMessage(input.Recipient, input.Message)
+	jid := input.ChatJID
+	_, page, err := store.ListMessages(db.ListMessagesOpts{ChatJID: &jid, Limit: 1})
+	if err != nil {
+		return nil, sendResult{}, err
+	}
+	description := fmt.Sprintf("delete chat %s and its %d stored messages from WhatsApp and the local database", chatLabel(store, input.ChatJID), page.TotalCount)
+	if r := s.confirm("delete_chat", input.confirmInput, description, input.Account, input.ChatJID); r != nil {
+		return nil, *r, nil
+	}
+	success, msg := client.DeleteChat(ctx, input.ChatJID)
 	return nil, sendResult{Success: success, Message: msg}, nil
 }
 
-func (s *Server) handleSendFile(ctx context.Context, req *mcp.CallToolRequest, input sendFileInput) (*mcp.CallToolResult, sendResult, error) {
-	if input.Recipient == "" {
-		return nil, sendResult{Success: false, Message: "Recipient must be provided"}, nil
+func (s *Server) handleMarkChatRead(ctx context.Context, req *mcp.CallToolRequest, input markChatReadInput) (*mcp.CallToolResult, sendResult, error) {
+	_, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, sendResult{}, err
 	}
-	if s.client == nil {
+	if client == nil {
 		return nil, sendResult{Success: false, Message: "WhatsApp client not available"}, nil
 	}
-	success, msg := s.client.SendMedia(input.Recipient, input.MediaPath, "")
+	success, msg := client.MarkChatAsRead(ctx, input.ChatJID, input.Read)
 	return nil, sendResult{Success: success, Message: msg}, nil
 }
 
-func (s *Server) handleSendAudioMessage(ctx context.Context, req *mcp.CallToolRequest, input sendAudioMessageInput) (*mcp.CallToolResult, sendResult, error) {
-	if input.Recipient == "" {
-		return nil, sendResult{Success: false, Message: "Recipient must be provided"}, nil
+func (s *Server) handleMarkMessagesRead(ctx context.Context, req *mcp.CallToolRequest, input markMessagesReadInput) (*mcp.CallToolResult, sendResult, error) {
+	_, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, sendResult{}, err
 	}
-	if s.client == nil {
+	if client == nil {
 		return nil, sendResult{Success: false, Message: "WhatsApp client not available"}, nil
 	}
-	success, msg := s.client.SendAudioMessage(input.Recipient, input.MediaPath)
+	success, msg := client.MarkMessagesRead(ctx, input.ChatJID, input.MessageIDs)
 	return nil, sendResult{Success: success, Message: msg}, nil
 }
 
-type downloadResult struct {
-	Success  bool   `json:"success"`
-	Message  string `json:"message"`
-	FilePath string `json:"file_path,omitempty"`
+func (s *Server) handleSetAutoRead(ctx context.Context, req *mcp.CallToolRequest, input setAutoReadInput) (*mcp.CallToolResult, sendResult, error) {
+	store, _, err := s.account(input.Account)
+	if err != nil {
+		return nil, sendResult{}, err
+	}
+	chat, err := store.GetChat(input.ChatJID, false)
+	if err != nil {
+		return nil, sendResult{}, err
+	}
+	if chat == nil {
+		return nil, sendResult{Success: false, Message: fmt.Sprintf("Chat not found: %s", input.ChatJID)}, nil
+	}
+	if err := store.SetChatAutoRead(input.ChatJID, input.Enabled); err != nil {
+		return nil, sendResult{}, err
+	}
+	if input.Enabled {
+		return nil, sendResult{Success: true, Message: fmt.Sprintf("New messages in %s will be marked as read automatically", input.ChatJID)}, nil
+	}
+	return nil, sendResult{Success: true, Message: fmt.Sprintf("Auto-read disabled for %s", input.ChatJID)}, nil
 }
 
-func (s *Server) handleDownloadMedia(ctx context.Context, req *mcp.CallToolRequest, input downloadMediaInput) (*mcp.CallToolResult, downloadResult, error) {
-	if s.client == nil {
-		return nil, downloadResult{Success: false, Message: "WhatsApp client not available"}, nil
+func (s *Server) handleSetSendProfile(ctx context.Context, req *mcp.CallToolRequest, input setSendProfileInput) (*mcp.CallToolResult, sendResult, error) {
+	store, _, err := s.account(input.Account)
+	if err != nil {
+		return nil, sendResult{}, err
+	}
+	var profile string
+	switch input.Profile {
+	case "", "default":
+		profile = db.SendProfileDefault
+	case db.SendProfileHumanize:
+		profile = db.SendProfileHumanize
+	default:
+		return nil, sendResult{Success: false, Message: "profile must be default or humanize"}, nil
 	}
-	path, err := s.client.DownloadMedia(input.MessageID, input.ChatJID)
+	chat, err := store.GetChat(input.ChatJID, false)
 	if err != nil {
-		return nil, downloadResult{Success: false, Message: err.Error()}, nil
+		return nil, sendResult{}, err
+	}
+	if chat == nil {
+		return nil, sendResult{Success: false, Message: fmt.Sprintf("Chat not found: %s", input.ChatJID)}, nil
+	}
+	if err := store.SetChatSendProfile(input.ChatJID, profile); err != nil {
+		return nil, sendResult{}, err
+	}
+	if profile == db.SendProfileHumanize {
+		return nil, sendResult{Success: true, Message: fmt.Sprintf("Messages to %s will be sent with typing indicator and pauses", input.ChatJID)}, nil
 	}
-	return nil, downloadResult{Success: true, Message: "Media downloaded successfully", FilePath: path}, nil
+	return nil, sendResult{Success: true, Message: fmt.Sprintf("Messages to %s will be sent immediately", input.ChatJID)}, nil
 }
 
-// --- Chat management handlers ---
-
-func (s *Server) handleRevokeMessage(ctx context.Context, req *mcp.CallToolRequest, input revokeMessageInput) (*mcp.CallToolResult, sendResult, error) {
-	if s.client == nil {
-		return nil, sendResult{Success: false, Message: "WhatsApp client not available"}, nil
+func (s *Server) handleSetChatRetention(ctx context.Context, req *mcp.CallToolRequest, input setChatRetentionInput) (*mcp.CallToolResult, sendResult, error) {
+	store, _, err := s.account(input.Account)
+	if err != nil {
+		return nil, sendResult{}, err
 	}
-	success, msg := s.client.RevokeMessage(input.ChatJID, input.MessageID, input.SenderJID)
-	return nil, sendResult{Success: success, Message: msg}, nil
+	if input.Days != nil && *input.Days < 0 {
+		return nil, sendResult{Success: false, Message: "days must be 0 or more"}, nil
+	}
+	chat, err := store.GetChat(input.ChatJID, false)
+	if err != nil {
+		return nil, sendResult{}, err
+	}
+	if chat == nil {
+		return nil, sendResult{Success: false, Message: fmt.Sprintf("Chat not found: %s", input.ChatJID)}, nil
+	}
+	if err := store.SetChatRetention(input.ChatJID, input.Days); err != nil {
+		return nil, sendResult{}, err
+	}
+	switch {
+	case input.Days == nil:
+		return nil, sendResult{Success: true, Message: fmt.Sprintf("Messages of %s are kept as long as the server default", input.ChatJID)}, nil
+	case *input.Days == 0:
+		return nil, sendResult{Success: true, Message: fmt.Sprintf("Messages of %s are kept forever", input.ChatJID)}, nil
+	}
+	return nil, sendResult{Success: true, Message: fmt.Sprintf("Messages of %s older than %d days will be deleted within the hour", input.ChatJID, *input.Days)}, nil
 }
 
-func (s *Server) handleBlockContact(ctx context.Context, req *mcp.CallToolRequest, input blockContactInput) (*mcp.CallToolResult, sendResult, error) {
-	if s.client == nil {
+func (s *Server) handleSetDisappearingTimer(ctx context.Context, req *mcp.CallToolRequest, input setDisappearingTimerInput) (*mcp.CallToolResult, sendResult, error) {
+	_, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, sendResult{}, err
+	}
+	if client == nil {
 		return nil, sendResult{Success: false, Message: "WhatsApp client not available"}, nil
 	}
-	success, msg := s.client.BlockContact(input.JID)
+	var timer time.Duration
+	switch input.Duration {
+	case "off", "0":
+	case "24h":
+		timer = 24 * time.Hour
+	case "7d":
+		timer = 7 * 24 * time.Hour
+	case "90d":
+		timer = 90 * 24 * time.Hour
+	default:
+		return nil, sendResult{Success: false, Message: "duration must be off, 24h, 7d or 90d"}, nil
+	}
+	success, msg := client.SetDisappearingTimer(ctx, input.ChatJID, timer)
 	return nil, sendResult{Success: success, Message: msg}, nil
 }
 
-func (s *Server) handleUnblockContact(ctx context.Context, req *mcp.CallToolRequest, input unblockContactInput) (*mcp.CallToolResult, sendResult, error) {
-	if s.client == nil {
-		return nil, sendResult{Success: false, Message: "WhatsApp client not available"}, nil
+type inviteLinkResult struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+	Link    string `json:"link,omitempty"`
+}
+
+func (s *Server) handleGetGroupInviteLink(ctx context.Context, req *mcp.CallToolRequest, input groupInviteLinkInput) (*mcp.CallToolResult, inviteLinkResult, error) {
+	return s.groupInviteLink(ctx, input, false)
+}
+
+func (s *Server) handleRevokeGroupInviteLink(ctx context.Context, req *mcp.CallToolRequest, input groupInviteLinkInput) (*mcp.CallToolResult, inviteLinkResult, error) {
+	return s.groupInviteLink(ctx, input, true)
+}
+
+// groupInviteLink gets or, with reset, revokes and replaces a group's invite link.
+func (s *Server) groupInviteLink(ctx context.Context, input groupInviteLinkInput, reset bool) (*mcp.CallToolResult, inviteLinkResult, error) {
+	_, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, inviteLinkResult{}, err
 	}
-	success, msg := s.client.UnblockContact(input.JID)
-	return nil, sendResult{Success: success, Message: msg}, nil
+	if client == nil {
+		return nil, inviteLinkResult{Success: false, Message: "WhatsApp client not available"}, nil
+	}
+	link, err := client.GroupInviteLink(ctx, input.GroupJID, reset)
+	if err != nil {
+		return nil, inviteLinkResult{Success: false, Message: fmt.Sprintf("Failed to get invite link: %v", err)}, nil
+	}
+	if reset {
+		return nil, inviteLinkResult{Success: true, Message: "Old invite link revoked", Link: link}, nil
+	}
+	return nil, inviteLinkResult{Success: true, Message: "Invite link retrieved", Link: link}, nil
 }
 
-type blocklistResult struct {
-	BlockedJIDs []string `json:"blocked_jids"`
-	Count       int      `json:"count"`
+type groupPreviewResult struct {
+	JID                  string  `json:"jid"`
+	Name                 string  `json:"name"`
+	Topic                string  `json:"topic,omitempty"`
+	OwnerJID             string  `json:"owner_jid,omitempty"`
+	CreatedAt            *string `json:"created_at,omitempty"`
+	ParticipantCount     int     `json:"participant_count"`
+	Announce             bool    `json:"announce"`
+	JoinApprovalRequired bool    `json:"join_approval_required"`
 }
 
-func (s *Server) handleGetBlocklist(ctx context.Context, req *mcp.CallToolRequest, input emptyInput) (*mcp.CallToolResult, blocklistResult, error) {
-	if s.client == nil {
-		return nil, blocklistResult{}, fmt.Errorf("WhatsApp client not available")
+type joinGroupResult struct {
+	Success bool                `json:"success"`
+	Message string              `json:"message"`
+	Joined  bool                `json:"joined"`
+	Group   *groupPreviewResult `json:"group,omitempty"`
+}
+
+func (s *Server) handleJoinGroupViaLink(ctx context.Context, req *mcp.CallToolRequest, input joinGroupViaLinkInput) (*mcp.CallToolResult, joinGroupResult, error) {
+	_, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, joinGroupResult{}, err
+	}
+	if client == nil {
+		return nil, joinGroupResult{Success: false, Message: "WhatsApp client not available"}, nil
 	}
-	jids, err := s.client.GetBlocklist()
+
+	if input.Confirm {
+		success, msg := client.JoinGroupWithLink(ctx, input.Link)
+		return nil, joinGroupResult{Success: success, Message: msg, Joined: success}, nil
+	}
+
+	preview, err := client.PreviewGroupInvite(ctx, input.Link)
 	if err != nil {
-		return nil, blocklistResult{}, err
+		return nil, joinGroupResult{Success: false, Message: fmt.Sprintf("Failed to resolve invite link: %v", err)}, nil
 	}
-	if jids == nil {
-		jids = []string{}
+	group := &groupPreviewResult{
+		JID:                  preview.JID,
+		Name:                 preview.Name,
+		Topic:                preview.Topic,
+		OwnerJID:             preview.OwnerJID,
+		ParticipantCount:     preview.ParticipantCount,
+		Announce:             preview.Announce,
+		JoinApprovalRequired: preview.JoinApprovalRequired,
 	}
-	return nil, blocklistResult{BlockedJIDs: jids, Count: len(jids)}, nil
+	if !preview.CreatedAt.IsZero() {
+		created := preview.CreatedAt.Format(time.RFC3339)
+		group.CreatedAt = &created
+	}
+	return nil, joinGroupResult{
+		Success: true,
+		Message: "Not joined yet: call again with confirm=true to join this group",
+		Group:   group,
+	}, nil
 }
 
-func (s *Server) handleMuteChat(ctx context.Context, req *mcp.CallToolRequest, input muteChatInput) (*mcp.CallToolResult, sendResult, error) {
-	if s.client == nil {
-		return nil, sendResult{Success: false, Message: "WhatsApp client not available"}, nil
+type newsletterResult struct {
+	JID         string `json:"jid"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Subscribers int    `json:"subscribers"`
+	Role        string `json:"role,omitempty"`
+	Muted       bool   `json:"muted"`
+	InviteLink  string `json:"invite_link,omitempty"`
+}
+
+type newslettersResult struct {
+	Newsletters []newsletterResult `json:"newsletters"`
+	Count       int                `json:"count"`
+}
+
+func (s *Server) handleListNewsletters(ctx context.Context, req *mcp.CallToolRequest, input accountInput) (*mcp.CallToolResult, newslettersResult, error) {
+	_, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, newslettersResult{}, err
 	}
-	if !input.Mute {
-		success, msg := s.client.UnmuteChat(input.ChatJID)
-		return nil, sendResult{Success: success, Message: msg}, nil
+	if client == nil {
+		return nil, newslettersResult{}, fmt.Errorf("WhatsApp client not available")
 	}
-	duration := time.Duration(input.DurationHours) * time.Hour
-	success, msg := s.client.MuteChat(input.ChatJID, duration)
-	return nil, sendResult{Success: success, Message: msg}, nil
+	newsletters, err := client.ListNewsletters(ctx)
+	if err != nil {
+		return nil, newslettersResult{}, err
+	}
+
+	result := newslettersResult{Newsletters: []newsletterResult{}, Count: len(newsletters)}
+	for _, n := range newsletters {
+		result.Newsletters = append(result.Newsletters, newsletterResult{
+			JID:         n.JID,
+			Name:        n.Name,
+			Description: n.Description,
+			Subscribers: n.Subscribers,
+			Role:        n.Role,
+			Muted:       n.Muted,
+			InviteLink:  n.InviteLink,
+		})
+	}
+	return nil, result, nil
 }
 
-func (s *Server) handlePinChat(ctx context.Context, req *mcp.CallToolRequest, input pinChatInput) (*mcp.CallToolResult, sendResult, error) {
-	if s.client == nil {
-		return nil, sendResult{Success: false, Message: "WhatsApp client not available"}, nil
+type fetchNewsletterMessagesResult struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+	Stored  int    `json:"stored"`
+}
+
+func (s *Server) handleFetchNewsletterMessages(ctx context.Context, req *mcp.CallToolRequest, input fetchNewsletterMessagesInput) (*mcp.CallToolResult, fetchNewsletterMessagesResult, error) {
+	_, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, fetchNewsletterMessagesResult{}, err
 	}
-	success, msg := s.client.PinChat(input.ChatJID, input.Pin)
-	return nil, sendResult{Success: success, Message: msg}, nil
+	if client == nil {
+		return nil, fetchNewsletterMessagesResult{Success: false, Message: "WhatsApp client not available"}, nil
+	}
+	stored, err := client.FetchNewsletterMessages(ctx, input.NewsletterJID, input.Count)
+	if err != nil {
+		return nil, fetchNewsletterMessagesResult{Success: false, Message: fmt.Sprintf("Failed to fetch channel messages: %v", err)}, nil
+	}
+	return nil, fetchNewsletterMessagesResult{
+		Success: true,
+		Message: fmt.Sprintf("Stored %d messages of %s", stored, input.NewsletterJID),
+		Stored:  stored,
+	}, nil
 }
 
-func (s *Server) handleArchiveChat(ctx context.Context, req *mcp.CallToolRequest, input archiveChatInput) (*mcp.CallToolResult, sendResult, error) {
-	if s.client == nil {
+func (s *Server) handleFollowNewsletter(ctx context.Context, req *mcp.CallToolRequest, input followNewsletterInput) (*mcp.CallToolResult, sendResult, error) {
+	_, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, sendResult{}, err
+	}
+	if client == nil {
 		return nil, sendResult{Success: false, Message: "WhatsApp client not available"}, nil
 	}
-	success, msg := s.client.ArchiveChat(input.ChatJID, input.Archive)
+	success, msg := client.FollowNewsletter(ctx, input.Channel)
 	return nil, sendResult{Success: success, Message: msg}, nil
 }
 
-func (s *Server) handleDeleteChat(ctx context.Context, req *mcp.CallToolRequest, input deleteChatInput) (*mcp.CallToolResult, sendResult, error) {
-	if s.client == nil {
+func (s *Server) handleUnfollowNewsletter(ctx context.Context, req *mcp.CallToolRequest, input newsletterInput) (*mcp.CallToolResult, sendResult, error) {
+	_, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, sendResult{}, err
+	}
+	if client == nil {
 		return nil, sendResult{Success: false, Message: "WhatsApp client not available"}, nil
 	}
-	success, msg := s.client.DeleteChat(input.ChatJID)
+	success, msg := client.UnfollowNewsletter(ctx, input.NewsletterJID)
 	return nil, sendResult{Success: success, Message: msg}, nil
 }
 
-func (s *Server) handleMarkChatRead(ctx context.Context, req *mcp.CallToolRequest, input markChatReadInput) (*mcp.CallToolResult, sendResult, error) {
-	if s.client == nil {
+func (s *Server) handleSendNewsletterMessage(ctx context.Context, req *mcp.CallToolRequest, input sendNewsletterMessageInput) (*mcp.CallToolResult, sendResult, error) {
+	store, client, err := s.account(input.Account)
+	if err != nil {
+		return nil, sendResult{}, err
+	}
+	if client == nil {
 		return nil, sendResult{Success: false, Message: "WhatsApp client not available"}, nil
 	}
-	success, msg := s.client.MarkChatAsRead(input.ChatJID, input.Read)
-	return nil, sendResult{Success: success, Message: msg}, nil
+	result, err := idempotent(ctx, s, store, "send_newsletter_message", input.idempotencyInput, func(ctx context.Context) (sendResult, error) {
+		success, msg := client.SendNewsletterMessage(ctx, input.NewsletterJID, input.Message)
+		return sendResult{Success: success, Message: msg}, nil
+	})
+	return nil, result, err
 }
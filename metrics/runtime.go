@@ -0,0 +1,14 @@
+package metrics
+
+import "runtime"
+
+func init() {
+	NewGaugeFunc("wahoo_goroutines", "Number of goroutines.", func() float64 {
+		return float64(runtime.NumGoroutine())
+	})
+	NewGaugeFunc("wahoo_heap_alloc_bytes", "Bytes of allocated heap objects.", func() float64 {
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		return float64(m.HeapAlloc)
+	})
+}
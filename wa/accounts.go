@@ -0,0 +1,272 @@
+package wa
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/CSCSoftware/wahoo/db"
+)
+
+// DefaultAccount is the account stored directly in the store directory,
+// which keeps single-account setups from before named accounts working.
+const DefaultAccount = "default"
+
+var accountNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Account is a named WhatsApp session with its own message and session databases.
+type Account struct {
+	Name   string
+	Dir    string
+	Store  *db.Store
+	Client *Client
+
+	mu         sync.Mutex
+	connecting bool
+	qrCode     string    // latest pairing QR code while connecting
+	qrIssued   time.Time // when qrCode was issued
+}
+
+// Accounts manages the open WhatsApp accounts. The default account lives in
+// the store directory itself, all others in <store-dir>/accounts/<name>.
+type Accounts struct {
+	ctx     context.Context
+	baseDir string
+	Default string // account used when a tool call does not name one
+
+	// Setup is called for every newly opened account before it connects.
+	Setup func(*Account)
+
+	// StoreOptions are used to open the databases of every account.
+	StoreOptions db.Options
+
+	// OnQRCode is called with an account's name whenever its pairing QR
+	// code rotates, and when pairing ends.
+	OnQRCode func(account string)
+
+	mu       sync.Mutex
+	accounts map[string]*Account
+}
+
+// NewAccounts creates an account manager. Clients connect using ctx.
+func NewAccounts(ctx context.Context, baseDir, defaultName string) *Accounts {
+	if defaultName == "" {
+		defaultName = DefaultAccount
+	}
+	return &Accounts{
+		ctx:      ctx,
+		baseDir:  baseDir,
+		Default:  defaultName,
+		accounts: make(map[string]*Account),
+	}
+}
+
+// ValidAccountName reports whether name can be used as an account name.
+func ValidAccountName(name string) bool {
+	return accountNamePattern.MatchString(name)
+}
+
+func (m *Accounts) dir(name string) string {
+	if name == DefaultAccount {
+		return m.baseDir
+	}
+	return filepath.Join(m.baseDir, "accounts", name)
+}
+
+// Discover returns the names of all accounts that exist on disk.
+func (m *Accounts) Discover() []string {
+	var names []string
+	if _, err := os.Stat(filepath.Join(m.baseDir, "whatsapp.db")); err == nil {
+		names = append(names, DefaultAccount)
+	}
+	entries, _ := os.ReadDir(filepath.Join(m.baseDir, "accounts"))
+	for _, e := range entries {
+		if e.IsDir() && ValidAccountName(e.Name()) && e.Name() != DefaultAccount {
+			names = append(names, e.Name())
+		}
+	}
+	return names
+}
+
+// Open opens the databases and client of an account, creating it if needed.
+// Opening an account that is already open returns it unchanged.
+func (m *Accounts) Open(name string) (*Account, error) {
+	if !ValidAccountName(name) {
+		return nil, fmt.Errorf("invalid account name %q (letters, digits, - and _ only)", name)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if a, ok := m.accounts[name]; ok {
+		return a, nil
+	}
+
+	dir := m.dir(name)
+	store, err := db.OpenStore(dir, m.StoreOptions)
+	if err != nil {
+		return nil, fmt.Errorf("open databases for account %s: %w", name, err)
+	}
+	client, err := NewClient(store, dir)
+	if err != nil {
+		store.Close()
+		return nil, fmt.Errorf("create client for account %s: %w", name, err)
+	}
+
+	a := &Account{Name: name, Dir: dir, Store: store, Client: client}
+	client.AccountName = name
+	client.OnQRCode = func(code string) {
+		a.setQRCode(code)
+		m.notifyQRCode(name)
+	}
+	if m.Setup != nil {
+		m.Setup(a)
+	}
+	m.accounts[name] = a
+	return a, nil
+}
+
+// Get returns an open account. An empty name selects the default account.
+func (m *Accounts) Get(name string) (*Account, error) {
+	if name == "" {
+		name = m.Default
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a, ok := m.accounts[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown account %q", name)
+	}
+	return a, nil
+}
+
+// List returns all open accounts ordered by name.
+func (m *Accounts) List() []*Account {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result := make([]*Account, 0, len(m.accounts))
+	for _, a := range m.accounts {
+		result = append(result, a)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// Connect connects an account in the background.
+func (m *Accounts) Connect(a *Account) {
+	a.mu.Lock()
+	if a.connecting {
+		a.mu.Unlock()
+		return
+	}
+	a.connecting = true
+	a.mu.Unlock()
+
+	go func() {
+		err := a.Client.Connect(m.ctx)
+		a.mu.Lock()
+		a.connecting = false
+		pairing := a.qrCode != ""
+		a.qrCode = ""
+		a.mu.Unlock()
+		if pairing {
+			m.notifyQRCode(a.Name)
+		}
+		if err != nil {
+			a.Client.recordConnectError(err)
+			// Not fatal - the account can still serve read-only DB queries
+			fmt.Fprintf(os.Stderr, "WhatsApp connection error (account %s): %v\n", a.Name, err)
+		}
+	}()
+}
+
+// Pair opens an account if needed, starts connecting it and waits up to
+// timeout for a pairing QR code. Calling it again while pairing returns the
+// latest code.
+func (m *Accounts) Pair(name string, timeout time.Duration) (*Account, string, error) {
+	a, err := m.startPairing(name)
+	if err != nil {
+		return nil, "", err
+	}
+	code, err := a.waitForQRCode(timeout)
+	return a, code, err
+}
+
+// RequestPairingCode is like Pair but links the account by phone number:
+// it returns the code to type into the phone instead of a QR code.
+func (m *Accounts) RequestPairingCode(name, phone string, timeout time.Duration) (*Account, string, error) {
+	a, err := m.startPairing(name)
+	if err != nil {
+		return nil, "", err
+	}
+	// A QR code being issued means the socket is ready for code pairing
+	if _, err := a.waitForQRCode(timeout); err != nil {
+		return a, "", err
+	}
+	code, err := a.Client.RequestPairingCode(phone)
+	return a, code, err
+}
+
+// startPairing opens an unpaired account and starts connecting it.
+func (m *Accounts) startPairing(name string) (*Account, error) {
+	a, err := m.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if a.Client.WA.Store.ID != nil {
+		return a, fmt.Errorf("account %s is already paired", name)
+	}
+	m.Connect(a)
+	return a, nil
+}
+
+// waitForQRCode waits for the account's connection to issue a pairing QR code.
+func (a *Account) waitForQRCode(timeout time.Duration) (string, error) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		a.mu.Lock()
+		code, connecting := a.qrCode, a.connecting
+		a.mu.Unlock()
+		if code != "" {
+			return code, nil
+		}
+		if !connecting {
+			return "", fmt.Errorf("connection for account %s ended before pairing started (see server log)", a.Name)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	return "", fmt.Errorf("timeout waiting for pairing to start")
+}
+
+// Close disconnects all accounts and closes their databases.
+func (m *Accounts) Close() {
+	for _, a := range m.List() {
+		a.Client.Close()
+		a.Store.Close()
+	}
+}
+
+func (a *Account) setQRCode(code string) {
+	a.mu.Lock()
+	a.qrCode = code
+	a.qrIssued = time.Now()
+	a.mu.Unlock()
+}
+
+// PairingQR returns the account's current pairing QR code and when it was
+// issued, or "" if the account is not waiting to be paired.
+func (a *Account) PairingQR() (code string, issued time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.qrCode, a.qrIssued
+}
+
+func (m *Accounts) notifyQRCode(name string) {
+	if m.OnQRCode != nil {
+		m.OnQRCode(name)
+	}
+}
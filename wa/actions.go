@@ -5,7 +5,10 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/CSCSoftware/wahoo/db"
+
 	"go.mau.fi/whatsmeow/appstate"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
 	"go.mau.fi/whatsmeow/proto/waCommon"
 	"go.mau.fi/whatsmeow/types"
 	"google.golang.org/protobuf/proto"
@@ -14,7 +17,7 @@ import (
 // RevokeMessage deletes/revokes a message.
 // For own messages: pass empty senderJID.
 // For others' messages (as group admin): pass the original sender's JID.
-func (c *Client) RevokeMessage(chatJID, messageID, senderJID string) (bool, string) {
+func (c *Client) RevokeMessage(ctx context.Context, chatJID, messageID, senderJID string) (bool, string) {
 	if !c.IsConnected() {
 		return false, "Not connected to WhatsApp"
 	}
@@ -33,16 +36,87 @@ func (c *Client) RevokeMessage(chatJID, messageID, senderJID string) (bool, stri
 	}
 
 	revokeMsg := c.WA.BuildRevoke(chat, sender, messageID)
-	_, err = c.WA.SendMessage(context.Background(), chat, revokeMsg)
-	if err != nil {
+	ctx, done := withTimeout(ctx, c.Timeouts.Send, "sending the revoke")
+	_, err = c.WA.SendMessage(ctx, chat, revokeMsg)
+	if err = done(err); err != nil {
 		return false, fmt.Sprintf("Failed to revoke message: %v", err)
 	}
 
+	if err := c.Store.MarkMessageRevoked(messageID, chatJID, time.Now()); err != nil {
+		c.Logger.Warnf("Failed to record revoke locally: %v", err)
+	}
+
 	return true, fmt.Sprintf("Message %s revoked in %s", messageID, chatJID)
 }
 
+// EditMessage replaces the text of one of our own messages.
+// WhatsApp only accepts edits within 15 minutes of the original send.
+func (c *Client) EditMessage(ctx context.Context, chatJID, messageID, newText string) (bool, string) {
+	if !c.IsConnected() {
+		return false, "Not connected to WhatsApp"
+	}
+
+	chat, err := types.ParseJID(chatJID)
+	if err != nil {
+		return false, fmt.Sprintf("Invalid chat JID: %v", err)
+	}
+
+	editMsg := c.WA.BuildEdit(chat, messageID, &waProto.Message{
+		Conversation: proto.String(newText),
+	})
+	ctx, done := withTimeout(ctx, c.Timeouts.Send, "sending the edit")
+	resp, err := c.WA.SendMessage(ctx, chat, editMsg)
+	if err = done(err); err != nil {
+		return false, fmt.Sprintf("Failed to edit message: %v", err)
+	}
+
+	if err := c.Store.EditMessage(messageID, chatJID, newText, resp.Timestamp); err != nil {
+		c.Logger.Warnf("Failed to record edit locally: %v", err)
+	}
+
+	return true, fmt.Sprintf("Message %s edited in %s", messageID, chatJID)
+}
+
+// StarMessage stars or unstars a stored message. The star is kept locally
+// and, while connected, synced to the phone and other devices; a failed sync
+// still leaves the local star in place.
+func (c *Client) StarMessage(ctx context.Context, chatJID, messageID string, star bool) (bool, string) {
+	chat, err := types.ParseJID(chatJID)
+	if err != nil {
+		return false, fmt.Sprintf("Invalid chat JID: %v", err)
+	}
+	msg, err := c.Store.GetMessage(messageID, chatJID)
+	if err != nil {
+		return false, err.Error()
+	}
+	if msg == nil {
+		return false, fmt.Sprintf("Message %s not found in %s", messageID, chatJID)
+	}
+
+	if _, err := c.Store.SetMessageStarred(messageID, chatJID, star, time.Now()); err != nil {
+		return false, fmt.Sprintf("Failed to record star: %v", err)
+	}
+	action := "starred"
+	if !star {
+		action = "unstarred"
+	}
+
+	if !c.IsConnected() {
+		return true, fmt.Sprintf("Message %s %s locally (not connected, so not synced to WhatsApp)", messageID, action)
+	}
+	// Own messages and direct chats use the chat as sender, which BuildStar encodes as "0"
+	sender := chat
+	if !msg.IsFromMe && chat.Server == types.GroupServer {
+		sender = c.senderJID(msg.SenderJID)
+	}
+	if err := c.sendAppState(ctx, appstate.BuildStar(chat, sender, messageID, msg.IsFromMe, star)); err != nil {
+		return true, fmt.Sprintf("Message %s %s locally, but syncing to WhatsApp failed: %v", messageID, action, err)
+	}
+	return true, fmt.Sprintf("Message %s %s in %s", messageID, action, chatJID)
+}
+
 // BlockContact adds a contact to the blocklist.
-func (c *Client) BlockContact(jidStr string) (bool, string) {
+func (c *Client) BlockContact(ctx context.Context, jidStr string) (bool, string) {
 	if !c.IsConnected() {
 		return false, "Not connected to WhatsApp"
 	}
@@ -52,8 +126,9 @@ func (c *Client) BlockContact(jidStr string) (bool, string) {
 		return false, fmt.Sprintf("Invalid JID: %v", err)
 	}
 
-	_, err = c.WA.UpdateBlocklist(context.Background(), jid, "block")
-	if err != nil {
+	ctx, done := withTimeout(ctx, c.Timeouts.Request, "updating the blocklist")
+	_, err = c.WA.UpdateBlocklist(ctx, jid, "block")
+	if err = done(err); err != nil {
 		return false, fmt.Sprintf("Failed to block contact: %v", err)
 	}
 
@@ -61,7 +136,7 @@ func (c *Client) BlockContact(jidStr string) (bool, string) {
 }
 
 // UnblockContact removes a contact from the blocklist.
-func (c *Client) UnblockContact(jidStr string) (bool, string) {
+func (c *Client) UnblockContact(ctx context.Context, jidStr string) (bool, string) {
 	if !c.IsConnected() {
 		return false, "Not connected to WhatsApp"
 	}
@@ -71,8 +146,9 @@ func (c *Client) UnblockContact(jidStr string) (bool, string) {
 		return false, fmt.Sprintf("Invalid JID: %v", err)
 	}
 
-	_, err = c.WA.UpdateBlocklist(context.Background(), jid, "unblock")
-	if err != nil {
+	ctx, done := withTimeout(ctx, c.Timeouts.Request, "updating the blocklist")
+	_, err = c.WA.UpdateBlocklist(ctx, jid, "unblock")
+	if err = done(err); err != nil {
 		return false, fmt.Sprintf("Failed to unblock contact: %v", err)
 	}
 
@@ -80,13 +156,14 @@ func (c *Client) UnblockContact(jidStr string) (bool, string) {
 }
 
 // GetBlocklist returns the list of blocked contacts.
-func (c *Client) GetBlocklist() ([]string, error) {
+func (c *Client) GetBlocklist(ctx context.Context) ([]string, error) {
 	if !c.IsConnected() {
 		return nil, fmt.Errorf("not connected to WhatsApp")
 	}
 
-	blocklist, err := c.WA.GetBlocklist(context.Background())
-	if err != nil {
+	ctx, done := withTimeout(ctx, c.Timeouts.Request, "getting the blocklist")
+	blocklist, err := c.WA.GetBlocklist(ctx)
+	if err = done(err); err != nil {
 		return nil, fmt.Errorf("failed to get blocklist: %w", err)
 	}
 
@@ -98,7 +175,7 @@ func (c *Client) GetBlocklist() ([]string, error) {
 }
 
 // MuteChat mutes a chat. duration=0 means mute forever.
-func (c *Client) MuteChat(chatJID string, duration time.Duration) (bool, string) {
+func (c *Client) MuteChat(ctx context.Context, chatJID string, duration time.Duration) (bool, string) {
 	if !c.IsConnected() {
 		return false, "Not connected to WhatsApp"
 	}
@@ -108,10 +185,17 @@ func (c *Client) MuteChat(chatJID string, duration time.Duration) (bool, string)
 		return false, fmt.Sprintf("Invalid JID: %v", err)
 	}
 
-	err = c.WA.SendAppState(context.Background(), appstate.BuildMute(jid, true, duration))
+	err = c.sendAppState(ctx, appstate.BuildMute(jid, true, duration))
 	if err != nil {
 		return false, fmt.Sprintf("Failed to mute chat: %v", err)
 	}
+	var until time.Time
+	if duration > 0 {
+		until = time.Now().Add(duration)
+	}
+	if err := c.Store.SetChatMuted(chatJID, true, until); err != nil {
+		c.Logger.Warnf("Failed to record mute locally: %v", err)
+	}
 
 	if duration == 0 {
 		return true, fmt.Sprintf("Chat %s muted permanently", chatJID)
@@ -120,7 +204,7 @@ func (c *Client) MuteChat(chatJID string, duration time.Duration) (bool, string)
 }
 
 // UnmuteChat unmutes a chat.
-func (c *Client) UnmuteChat(chatJID string) (bool, string) {
+func (c *Client) UnmuteChat(ctx context.Context, chatJID string) (bool, string) {
 	if !c.IsConnected() {
 		return false, "Not connected to WhatsApp"
 	}
@@ -130,16 +214,45 @@ func (c *Client) UnmuteChat(chatJID string) (bool, string) {
 		return false, fmt.Sprintf("Invalid JID: %v", err)
 	}
 
-	err = c.WA.SendAppState(context.Background(), appstate.BuildMute(jid, false, 0))
+	err = c.sendAppState(ctx, appstate.BuildMute(jid, false, 0))
 	if err != nil {
 		return false, fmt.Sprintf("Failed to unmute chat: %v", err)
 	}
+	if err := c.Store.SetChatMuted(chatJID, false, time.Time{}); err != nil {
+		c.Logger.Warnf("Failed to record unmute locally: %v", err)
+	}
 
 	return true, fmt.Sprintf("Chat %s unmuted", chatJID)
 }
 
+// SetDisappearingTimer turns disappearing messages in a chat on or off.
+// WhatsApp only accepts the durations offered in its apps: 24h, 7d and 90d.
+func (c *Client) SetDisappearingTimer(ctx context.Context, chatJID string, timer time.Duration) (bool, string) {
+	if !c.IsConnected() {
+		return false, "Not connected to WhatsApp"
+	}
+
+	jid, err := types.ParseJID(chatJID)
+	if err != nil {
+		return false, fmt.Sprintf("Invalid JID: %v", err)
+	}
+
+	ctx, done := withTimeout(ctx, c.Timeouts.Request, "setting disappearing messages")
+	if err := done(c.WA.SetDisappearingTimer(ctx, jid, timer, time.Time{})); err != nil {
+		return false, fmt.Sprintf("Failed to set disappearing messages: %v", err)
+	}
+	if err := c.Store.SetChatDisappearingTimer(chatJID, timer); err != nil {
+		c.Logger.Warnf("Failed to record disappearing timer locally: %v", err)
+	}
+
+	if timer == 0 {
+		return true, fmt.Sprintf("Disappearing messages turned off in %s", chatJID)
+	}
+	return true, fmt.Sprintf("New messages in %s disappear after %s", chatJID, db.FormatDisappearingTimer(timer))
+}
+
 // PinChat pins or unpins a chat.
-func (c *Client) PinChat(chatJID string, pin bool) (bool, string) {
+func (c *Client) PinChat(ctx context.Context, chatJID string, pin bool) (bool, string) {
 	if !c.IsConnected() {
 		return false, "Not connected to WhatsApp"
 	}
@@ -149,7 +262,7 @@ func (c *Client) PinChat(chatJID string, pin bool) (bool, string) {
 		return false, fmt.Sprintf("Invalid JID: %v", err)
 	}
 
-	err = c.WA.SendAppState(context.Background(), appstate.BuildPin(jid, pin))
+	err = c.sendAppState(ctx, appstate.BuildPin(jid, pin))
 	if err != nil {
 		action := "pin"
 		if !pin {
@@ -157,6 +270,9 @@ func (c *Client) PinChat(chatJID string, pin bool) (bool, string) {
 		}
 		return false, fmt.Sprintf("Failed to %s chat: %v", action, err)
 	}
+	if err := c.Store.SetChatPinned(chatJID, pin); err != nil {
+		c.Logger.Warnf("Failed to record pin state locally: %v", err)
+	}
 
 	if pin {
 		return true, fmt.Sprintf("Chat %s pinned", chatJID)
@@ -165,7 +281,7 @@ func (c *Client) PinChat(chatJID string, pin bool) (bool, string) {
 }
 
 // ArchiveChat archives or unarchives a chat.
-func (c *Client) ArchiveChat(chatJID string, archive bool) (bool, string) {
+func (c *Client) ArchiveChat(ctx context.Context, chatJID string, archive bool) (bool, string) {
 	if !c.IsConnected() {
 		return false, "Not connected to WhatsApp"
 	}
@@ -177,7 +293,7 @@ func (c *Client) ArchiveChat(chatJID string, archive bool) (bool, string) {
 
 	lastMsgTime, lastMsgKey := c.getLastMessageKey(chatJID)
 
-	err = c.WA.SendAppState(context.Background(), appstate.BuildArchive(jid, archive, lastMsgTime, lastMsgKey))
+	err = c.sendAppState(ctx, appstate.BuildArchive(jid, archive, lastMsgTime, lastMsgKey))
 	if err != nil {
 		action := "archive"
 		if !archive {
@@ -185,6 +301,9 @@ func (c *Client) ArchiveChat(chatJID string, archive bool) (bool, string) {
 		}
 		return false, fmt.Sprintf("Failed to %s chat: %v", action, err)
 	}
+	if err := c.Store.SetChatArchived(chatJID, archive); err != nil {
+		c.Logger.Warnf("Failed to record archive state locally: %v", err)
+	}
 
 	if archive {
 		return true, fmt.Sprintf("Chat %s archived", chatJID)
@@ -193,7 +312,7 @@ func (c *Client) ArchiveChat(chatJID string, archive bool) (bool, string) {
 }
 
 // DeleteChat deletes a chat entirely.
-func (c *Client) DeleteChat(chatJID string) (bool, string) {
+func (c *Client) DeleteChat(ctx context.Context, chatJID string) (bool, string) {
 	if !c.IsConnected() {
 		return false, "Not connected to WhatsApp"
 	}
@@ -205,20 +324,19 @@ func (c *Client) DeleteChat(chatJID string) (bool, string) {
 
 	lastMsgTime, lastMsgKey := c.getLastMessageKey(chatJID)
 
-	err = c.WA.SendAppState(context.Background(), appstate.BuildDeleteChat(jid, lastMsgTime, lastMsgKey, true))
+	err = c.sendAppState(ctx, appstate.BuildDeleteChat(jid, lastMsgTime, lastMsgKey, true))
 	if err != nil {
 		return false, fmt.Sprintf("Failed to delete chat: %v", err)
 	}
 
 	// Also remove from local DB (ignore errors - best effort cleanup)
-	_, _ = c.Store.MsgDB.Exec("DELETE FROM messages WHERE chat_jid = ?", chatJID)
-	_, _ = c.Store.MsgDB.Exec("DELETE FROM chats WHERE jid = ?", chatJID)
+	_ = c.Store.DeleteChat(chatJID)
 
 	return true, fmt.Sprintf("Chat %s deleted", chatJID)
 }
 
 // MarkChatAsRead marks a chat as read or unread.
-func (c *Client) MarkChatAsRead(chatJID string, read bool) (bool, string) {
+func (c *Client) MarkChatAsRead(ctx context.Context, chatJID string, read bool) (bool, string) {
 	if !c.IsConnected() {
 		return false, "Not connected to WhatsApp"
 	}
@@ -230,7 +348,7 @@ func (c *Client) MarkChatAsRead(chatJID string, read bool) (bool, string) {
 
 	_, lastMsgKey := c.getLastMessageKey(chatJID)
 
-	err = c.WA.SendAppState(context.Background(), appstate.BuildMarkChatAsRead(jid, read, time.Now(), lastMsgKey))
+	err = c.sendAppState(ctx, appstate.BuildMarkChatAsRead(jid, read, time.Now(), lastMsgKey))
 	if err != nil {
 		action := "read"
 		if !read {
@@ -239,12 +357,28 @@ func (c *Client) MarkChatAsRead(chatJID string, read bool) (bool, string) {
 		return false, fmt.Sprintf("Failed to mark as %s: %v", action, err)
 	}
 
+	if read {
+		err = c.Store.MarkChatRead(chatJID, time.Now())
+	} else {
+		err = c.Store.SetChatUnreadCount(chatJID, 1)
+	}
+	if err != nil {
+		c.Logger.Warnf("Failed to record read state of %s: %v", chatJID, err)
+	}
+
 	if read {
 		return true, fmt.Sprintf("Chat %s marked as read", chatJID)
 	}
 	return true, fmt.Sprintf("Chat %s marked as unread", chatJID)
 }
 
+// sendAppState syncs a chat state change to WhatsApp within the app state
+// timeout.
+func (c *Client) sendAppState(ctx context.Context, patch appstate.PatchInfo) error {
+	ctx, done := withTimeout(ctx, c.Timeouts.AppState, "syncing the change to WhatsApp")
+	return done(c.WA.SendAppState(ctx, patch))
+}
+
 // getLastMessageKey retrieves the last message's timestamp and key for a chat.
 func (c *Client) getLastMessageKey(chatJID string) (time.Time, *waCommon.MessageKey) {
 	var lastMsgID, lastSender string
@@ -0,0 +1,125 @@
+package wa
+
+import (
+	"context"
+	"fmt"
+
+	"go.mau.fi/whatsmeow"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/proto/waCommon"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"google.golang.org/protobuf/proto"
+)
+
+// Album size limits: WhatsApp groups at least two images or videos, and
+// its apps send at most 30 at once.
+const (
+	minAlbumItems = 2
+	maxAlbumItems = 30
+)
+
+// AlbumItem is the outcome of sending one file of an album.
+type AlbumItem struct {
+	Path      string
+	Success   bool
+	MessageID string // set if sent
+	Error     string // why it was not sent
+}
+
+// SendAlbum sends images and videos as one album: an album message
+// announcing them, then each file linked to it. The caption is shown on the
+// first file. All files are uploaded before anything is sent, so a file
+// that can't be read or is not an image or video fails the whole album.
+// The album counts as one send for the rate limit.
+func (c *Client) SendAlbum(ctx context.Context, recipient string, mediaPaths []string, caption string) (items []AlbumItem, ok bool, msg string) {
+	if len(mediaPaths) < minAlbumItems || len(mediaPaths) > maxAlbumItems {
+		return nil, false, fmt.Sprintf("An album needs %d to %d images or videos", minAlbumItems, maxAlbumItems)
+	}
+	if !c.IsConnected() {
+		return nil, false, "Not connected to WhatsApp"
+	}
+	jid, err := parseRecipient(recipient)
+	if err != nil {
+		return nil, false, err.Error()
+	}
+
+	items = make([]AlbumItem, len(mediaPaths))
+	messages := make([]*waProto.Message, len(mediaPaths))
+	resolvedPaths := make([]string, len(mediaPaths))
+	var images, videos uint32
+	failed := false
+	for i, path := range mediaPaths {
+		items[i].Path = path
+		resolved, err := c.allowedMediaPath(path)
+		if err != nil {
+			items[i].Error, failed = err.Error(), true
+			continue
+		}
+		resolvedPaths[i] = resolved
+		itemCaption := ""
+		if i == 0 {
+			itemCaption = caption
+		}
+		m, mediaType, err := c.buildMediaMessage(ctx, resolved, itemCaption, "")
+		switch {
+		case err != nil:
+			items[i].Error, failed = err.Error(), true
+		case mediaType == whatsmeow.MediaImage:
+			images++
+		case mediaType == whatsmeow.MediaVideo:
+			videos++
+		default:
+			items[i].Error, failed = "not an image or video", true
+		}
+		messages[i] = m
+	}
+	if failed {
+		return items, false, "Album not sent: some files could not be prepared"
+	}
+
+	note, allowed := c.allowSend(jid)
+	if !allowed {
+		return items, false, note
+	}
+
+	album := &waProto.Message{AlbumMessage: &waE2E.AlbumMessage{
+		ExpectedImageCount: proto.Uint32(images),
+		ExpectedVideoCount: proto.Uint32(videos),
+	}}
+	resp, err := c.sendTracked(ctx, jid, album)
+	if err != nil {
+		for i := range items {
+			items[i].Error = "album not sent"
+		}
+		return items, false, fmt.Sprintf("Error sending album: %v%s", err, c.healthWarning())
+	}
+	parent := &waCommon.MessageKey{
+		RemoteJID: proto.String(jid.String()),
+		FromMe:    proto.Bool(true),
+		ID:        proto.String(resp.ID),
+	}
+
+	sent := 0
+	for i, m := range messages {
+		m.MessageContextInfo = &waE2E.MessageContextInfo{
+			MessageAssociation: &waE2E.MessageAssociation{
+				AssociationType:  waE2E.MessageAssociation_MEDIA_ALBUM.Enum(),
+				ParentMessageKey: parent,
+			},
+		}
+		r, err := c.sendTracked(ctx, jid, m)
+		if err != nil {
+			items[i].Error = err.Error()
+			continue
+		}
+		items[i].Success, items[i].MessageID = true, r.ID
+		sent++
+		if err := c.archiveMedia(r.ID, jid.String(), resolvedPaths[i]); err != nil {
+			c.Logger.Warnf("%v", err)
+		}
+	}
+	if sent < len(items) {
+		return items, sent > 0, fmt.Sprintf("Album sent to %s with %d of %d files%s%s", recipient, sent, len(items), note, c.healthWarning())
+	}
+	return items, true, fmt.Sprintf("Album of %d files sent to %s%s%s", sent, recipient, note, c.healthWarning())
+}
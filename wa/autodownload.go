@@ -0,0 +1,65 @@
+package wa
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// AutoDownloadConfig controls automatic download of incoming media.
+// MaxBytes maps a media type ("image", "gif", "audio", "document", "video") to the
+// largest file that is fetched automatically; types not listed (or 0) are skipped.
+type AutoDownloadConfig struct {
+	Workers  int
+	MaxBytes map[string]uint64
+}
+
+type downloadJob struct {
+	messageID string
+	chatJID   string
+}
+
+// autoDownloader feeds incoming media messages to a pool of download workers.
+type autoDownloader struct {
+	cfg  AutoDownloadConfig
+	jobs chan downloadJob
+}
+
+// StartAutoDownload enables automatic media downloads using a worker pool
+// that runs until ctx is done.
+func (c *Client) StartAutoDownload(ctx context.Context, cfg AutoDownloadConfig) {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 2
+	}
+	d := &autoDownloader{cfg: cfg, jobs: make(chan downloadJob, 100)}
+	for range cfg.Workers {
+		c.goWork(func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-d.jobs:
+					if _, err := c.DownloadMedia(ctx, job.messageID, job.chatJID); err != nil {
+						c.Logger.Warnf("Auto-download of %s failed: %v", job.messageID, err)
+					}
+				}
+			}
+		})
+	}
+	c.autoDownload = d
+	fmt.Fprintf(os.Stderr, "Auto-download enabled (%d workers)\n", cfg.Workers)
+}
+
+// enqueue schedules a download if the media type and size are within limits.
+// Drops the job if the queue is full; download_media still works later.
+func (d *autoDownloader) enqueue(c *Client, messageID, chatJID, mediaType string, fileLength uint64) {
+	limit := d.cfg.MaxBytes[mediaType]
+	if limit == 0 || fileLength > limit {
+		return
+	}
+	select {
+	case d.jobs <- downloadJob{messageID: messageID, chatJID: chatJID}:
+	default:
+		c.Logger.Warnf("Auto-download queue full, skipping %s", messageID)
+	}
+}
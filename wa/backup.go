@@ -0,0 +1,274 @@
+package wa
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/CSCSoftware/wahoo/db"
+)
+
+// A backup is a directory named wahoo-<time> holding a snapshot of
+// messages.db and, optionally, a copy of the media directory.
+const (
+	backupPrefix     = "wahoo-"
+	backupTimeLayout = "20060102-150405"
+	backupDBName     = "messages.db"
+	backupMediaDir   = "media"
+)
+
+// BackupConfig schedules automatic backups.
+type BackupConfig struct {
+	Dir      string        // see BackupsDir
+	Interval time.Duration // time between backups
+	Keep     int           // newest backups kept, older ones are deleted; 0 keeps all
+	Media    bool          // also copy the downloaded media
+}
+
+// Backup is a backup of an account's message store.
+type Backup struct {
+	Path      string    `json:"path"`
+	CreatedAt time.Time `json:"created_at"`
+	Bytes     int64     `json:"bytes"`
+	Media     bool      `json:"media"` // includes the downloaded media
+}
+
+// BackupsDir is where an account's backups are written: the backups
+// directory of its store, or a subdirectory of dir named like the account if
+// dir is set. The default account uses dir itself.
+func BackupsDir(dir, storeDir, account string) string {
+	switch {
+	case dir == "":
+		return filepath.Join(storeDir, "backups")
+	case account == "" || account == DefaultAccount:
+		return dir
+	}
+	return filepath.Join(dir, account)
+}
+
+// BackupStore writes a backup of the messages database, and with media of
+// the downloaded media, to a new directory in dir. The store stays in use
+// while it runs.
+func BackupStore(ctx context.Context, store *db.Store, storeDir, dir string, media bool) (*Backup, error) {
+	now := time.Now()
+	path := filepath.Join(dir, backupPrefix+now.Format(backupTimeLayout))
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("create backup directory: %w", err)
+	}
+	// Mkdir fails if a backup was written in the same second
+	if err := os.Mkdir(path, 0700); err != nil {
+		return nil, fmt.Errorf("create backup directory: %w", err)
+	}
+	if err := store.BackupDatabase(ctx, filepath.Join(path, backupDBName)); err != nil {
+		os.RemoveAll(path)
+		return nil, err
+	}
+	if media {
+		if err := copyTree(filepath.Join(storeDir, "media"), filepath.Join(path, backupMediaDir), false); err != nil {
+			os.RemoveAll(path)
+			return nil, fmt.Errorf("backup media: %w", err)
+		}
+	}
+	return readBackup(path)
+}
+
+// RestoreStore replaces the messages database with the one in a backup
+// directory and, with media, copies the backed up media files that are
+// missing from the media directory back into it.
+func RestoreStore(ctx context.Context, store *db.Store, storeDir, path string, media bool) error {
+	b, err := readBackup(path)
+	if err != nil {
+		return err
+	}
+	if media && !b.Media {
+		return fmt.Errorf("backup %s has no media", path)
+	}
+	if err := store.RestoreDatabase(ctx, filepath.Join(path, backupDBName)); err != nil {
+		return err
+	}
+	if media {
+		if err := copyTree(filepath.Join(path, backupMediaDir), filepath.Join(storeDir, "media"), true); err != nil {
+			return fmt.Errorf("restore media: %w", err)
+		}
+	}
+	return nil
+}
+
+// readBackup describes the backup in a directory.
+func readBackup(path string) (*Backup, error) {
+	name := filepath.Base(path)
+	created, err := time.ParseInLocation(backupTimeLayout, strings.TrimPrefix(name, backupPrefix), time.Local)
+	if !strings.HasPrefix(name, backupPrefix) || err != nil {
+		return nil, fmt.Errorf("%s is not a backup directory", path)
+	}
+	if _, err := os.Stat(filepath.Join(path, backupDBName)); err != nil {
+		return nil, fmt.Errorf("backup %s has no %s", path, backupDBName)
+	}
+	b := &Backup{Path: path, CreatedAt: created}
+	if info, err := os.Stat(filepath.Join(path, backupMediaDir)); err == nil && info.IsDir() {
+		b.Media = true
+	}
+	err = filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		b.Bytes += info.Size()
+		return nil
+	})
+	return b, err
+}
+
+// ListBackups returns the backups in dir, newest first.
+func ListBackups(dir string) ([]Backup, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var backups []Backup
+	for _, e := range entries {
+		if !e.IsDir() || !strings.HasPrefix(e.Name(), backupPrefix) {
+			continue
+		}
+		if b, err := readBackup(filepath.Join(dir, e.Name())); err == nil {
+			backups = append(backups, *b)
+		}
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].CreatedAt.After(backups[j].CreatedAt) })
+	return backups, nil
+}
+
+// PruneBackups deletes all but the keep newest backups in dir and returns
+// how many it deleted.
+func PruneBackups(dir string, keep int) (int, error) {
+	backups, err := ListBackups(dir)
+	if err != nil || len(backups) <= keep {
+		return 0, err
+	}
+	deleted := 0
+	for _, b := range backups[keep:] {
+		if err := os.RemoveAll(b.Path); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// copyTree copies the files under src to dst, keeping their modification
+// times, which media cleanup goes by. With skipExisting, files already in
+// dst are left alone. A missing src copies nothing.
+func copyTree(src, dst string, skipExisting bool) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == src && errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		rel, _ := filepath.Rel(src, path)
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if skipExisting {
+			if _, err := os.Stat(target); err == nil {
+				return nil
+			}
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if err := copyFile(path, target); err != nil {
+			return err
+		}
+		return os.Chtimes(target, info.ModTime(), info.ModTime())
+	})
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
+
+// BackupDir is where the account's backups are written.
+func (c *Client) BackupDir() string {
+	return BackupsDir(c.Backups.Dir, c.StoreDir, c.AccountName)
+}
+
+// BackupStore writes a backup of the account's store to BackupDir; see
+// BackupStore.
+func (c *Client) BackupStore(ctx context.Context, media bool) (*Backup, error) {
+	return BackupStore(ctx, c.Store, c.StoreDir, c.BackupDir(), media)
+}
+
+// RestoreStore restores a backup into the account's store; see
+// RestoreStore.
+func (c *Client) RestoreStore(ctx context.Context, path string, media bool) error {
+	return RestoreStore(ctx, c.Store, c.StoreDir, path, media)
+}
+
+// StartBackups writes a backup every cfg.Interval until ctx is done,
+// deleting all but the cfg.Keep newest.
+func (c *Client) StartBackups(ctx context.Context, cfg BackupConfig) {
+	c.Backups = cfg
+	dir := c.BackupDir()
+	run := func() {
+		b, err := c.BackupStore(ctx, cfg.Media)
+		if err != nil {
+			c.Logger.Warnf("Backup failed: %v", err)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "Backup written to %s (%d MB)\n", b.Path, b.Bytes>>20)
+		if cfg.Keep > 0 {
+			if n, err := PruneBackups(dir, cfg.Keep); err != nil {
+				c.Logger.Warnf("Deleting old backups failed: %v", err)
+			} else if n > 0 {
+				fmt.Fprintf(os.Stderr, "Deleted %d old backups\n", n)
+			}
+		}
+	}
+	c.goWork(func() {
+		ticker := time.NewTicker(cfg.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				run()
+			}
+		}
+	})
+	fmt.Fprintf(os.Stderr, "Backups every %s to %s\n", cfg.Interval, dir)
+}
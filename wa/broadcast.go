@@ -0,0 +1,82 @@
+package wa
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// Broadcast limits. WhatsApp's own broadcast lists hold at most 256
+// recipients; bulk sends faster than a few seconds apart risk a ban.
+const (
+	MaxBroadcastRecipients   = 256
+	DefaultBroadcastInterval = 5 * time.Second
+	MinBroadcastInterval     = 1 * time.Second
+)
+
+// BroadcastRecipient is one recipient of a broadcast and the values for the
+// {placeholders} in the message template.
+type BroadcastRecipient struct {
+	Recipient string
+	Vars      map[string]string
+}
+
+// BroadcastResult is the outcome of sending to one recipient.
+type BroadcastResult struct {
+	Recipient string
+	Success   bool
+	Queued    bool // queued in the outbox while disconnected
+	Message   string
+}
+
+var placeholderPattern = regexp.MustCompile(`\{(\w+)\}`)
+
+// fillTemplate replaces each {name} in tmpl with vars[name]. A placeholder
+// without a value is an error, so nobody receives a half-filled message.
+func fillTemplate(tmpl string, vars map[string]string) (string, error) {
+	var missing string
+	text := placeholderPattern.ReplaceAllStringFunc(tmpl, func(m string) string {
+		name := m[1 : len(m)-1]
+		v, ok := vars[name]
+		if !ok && missing == "" {
+			missing = name
+		}
+		return v
+	})
+	if missing != "" {
+		return "", fmt.Errorf("no value for {%s}", missing)
+	}
+	return text, nil
+}
+
+// SendBroadcast sends a text to each recipient in turn, filling the template
+// with the recipient's variables and waiting interval (±25% jitter) between
+// sends. It stops early if ctx is cancelled; recipients not reached are
+// reported as failed.
+func (c *Client) SendBroadcast(ctx context.Context, recipients []BroadcastRecipient, tmpl string, interval time.Duration) []BroadcastResult {
+	results := make([]BroadcastResult, 0, len(recipients))
+	sent := false
+	for _, r := range recipients {
+		text, err := fillTemplate(tmpl, r.Vars)
+		if err != nil {
+			results = append(results, BroadcastResult{Recipient: r.Recipient, Message: fmt.Sprintf("Not sent: %v", err)})
+			continue
+		}
+		if sent {
+			select {
+			case <-ctx.Done():
+			case <-time.After(jitter(interval)):
+			}
+		}
+		if ctx.Err() != nil {
+			results = append(results, BroadcastResult{Recipient: r.Recipient, Message: "Not sent: broadcast cancelled"})
+			continue
+		}
+
+		success, queued, msg := c.SendMessage(ctx, r.Recipient, text, nil, false)
+		results = append(results, BroadcastResult{Recipient: r.Recipient, Success: success, Queued: queued, Message: msg})
+		sent = true
+	}
+	return results
+}
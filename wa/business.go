@@ -0,0 +1,173 @@
+package wa
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	waBinary "go.mau.fi/whatsmeow/binary"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// BusinessProfile is the public profile of a WhatsApp Business account.
+type BusinessProfile struct {
+	JID         string
+	Name        string // verified business name, if known
+	Description string
+	Categories  []string
+	Address     string
+	Email       string
+	Websites    []string
+	Timezone    string // of the opening hours
+	Hours       []BusinessHours
+}
+
+// BusinessHours are the opening hours of a business on one day.
+type BusinessHours struct {
+	Day   string // sun, mon, ...
+	Mode  string // specific_hours, open_24h or appointment_only
+	Open  string // HH:MM, for specific_hours
+	Close string
+}
+
+// GetBusinessProfile fetches the business profile of a contact. whatsmeow's
+// GetBusinessProfile drops the description and websites, so the query is
+// sent and parsed here.
+func (c *Client) GetBusinessProfile(ctx context.Context, recipient string) (*BusinessProfile, error) {
+	if !c.IsConnected() {
+		return nil, fmt.Errorf("not connected to WhatsApp")
+	}
+	jid, err := parseRecipient(recipient)
+	if err != nil {
+		return nil, err
+	}
+	jid = jid.ToNonAD()
+
+	ctx, done := withTimeout(ctx, c.Timeouts.Request, "querying the business profile")
+	defer done(nil)
+	internals := c.WA.DangerousInternals()
+	id := internals.GenerateRequestID()
+	waiter := internals.WaitResponse(id)
+	err = internals.SendNode(ctx, waBinary.Node{
+		Tag:   "iq",
+		Attrs: waBinary.Attrs{"id": id, "xmlns": "w:biz", "type": "get", "to": types.ServerJID},
+		Content: []waBinary.Node{{
+			Tag:     "business_profile",
+			Attrs:   waBinary.Attrs{"v": "244"},
+			Content: []waBinary.Node{{Tag: "profile", Attrs: waBinary.Attrs{"jid": jid}}},
+		}},
+	})
+	if err != nil {
+		internals.CancelResponse(id, waiter)
+		return nil, fmt.Errorf("query business profile: %w", err)
+	}
+	var resp *waBinary.Node
+	select {
+	case resp = <-waiter:
+	case <-ctx.Done():
+		internals.CancelResponse(id, waiter)
+		return nil, fmt.Errorf("query business profile: %w", done(ctx.Err()))
+	}
+	if resp.AttrGetter().OptionalString("type") == "error" {
+		errNode := resp.GetChildByTag("error")
+		return nil, fmt.Errorf("query business profile: %s (%s)",
+			errNode.AttrGetter().OptionalString("text"), errNode.AttrGetter().OptionalString("code"))
+	}
+
+	bizNode := resp.GetChildByTag("business_profile")
+	profileNode, ok := bizNode.GetOptionalChildByTag("profile")
+	if !ok || len(profileNode.GetChildren()) == 0 {
+		return nil, fmt.Errorf("%s is not a WhatsApp Business account", jid)
+	}
+	p := &BusinessProfile{
+		JID:         jid.String(),
+		Description: nodeText(profileNode.GetChildByTag("description")),
+		Address:     nodeText(profileNode.GetChildByTag("address")),
+		Email:       nodeText(profileNode.GetChildByTag("email")),
+		Categories:  []string{},
+		Websites:    []string{},
+		Hours:       []BusinessHours{},
+	}
+	if contact, err := c.WA.Store.Contacts.GetContact(ctx, jid); err == nil {
+		p.Name = contact.BusinessName
+	}
+	for _, child := range profileNode.GetChildren() {
+		if child.Tag == "website" {
+			p.Websites = append(p.Websites, nodeText(child))
+		}
+	}
+	categories := profileNode.GetChildByTag("categories")
+	for _, category := range categories.GetChildren() {
+		if category.Tag == "category" {
+			p.Categories = append(p.Categories, nodeText(category))
+		}
+	}
+	hours := profileNode.GetChildByTag("business_hours")
+	p.Timezone = hours.AttrGetter().OptionalString("timezone")
+	for _, config := range hours.GetChildren() {
+		if config.Tag != "business_hours_config" {
+			continue
+		}
+		ag := config.AttrGetter()
+		p.Hours = append(p.Hours, BusinessHours{
+			Day:   ag.OptionalString("day_of_week"),
+			Mode:  ag.OptionalString("mode"),
+			Open:  minutesToClock(ag.OptionalString("open_time")),
+			Close: minutesToClock(ag.OptionalString("close_time")),
+		})
+	}
+	return p, nil
+}
+
+// CheckBusiness reports which contacts are WhatsApp Business accounts,
+// keyed by the given JIDs; contacts it can't tell about are left out. While
+// connected WhatsApp is asked; otherwise the verified business names
+// WhatsApp sent with earlier messages are used.
+func (c *Client) CheckBusiness(ctx context.Context, jids []string) map[string]bool {
+	result := make(map[string]bool, len(jids))
+	parsed := make(map[types.JID]string, len(jids))
+	for _, j := range jids {
+		if jid, err := parseRecipient(j); err == nil {
+			parsed[jid.ToNonAD()] = j
+		}
+	}
+
+	if c.IsConnected() {
+		query := make([]types.JID, 0, len(parsed))
+		for jid := range parsed {
+			query = append(query, jid)
+		}
+		queryCtx, done := withTimeout(ctx, c.Timeouts.Request, "querying business accounts")
+		info, err := c.WA.GetUserInfo(queryCtx, query)
+		if err = done(err); err == nil {
+			for jid, j := range parsed {
+				result[j] = info[jid].VerifiedName != nil
+			}
+			return result
+		}
+		c.Logger.Warnf("Failed to query business accounts: %v", err)
+	}
+	if c.WA.Store.Contacts == nil {
+		return result // not paired yet, nothing is known
+	}
+	for jid, j := range parsed {
+		contact, err := c.WA.Store.Contacts.GetContact(ctx, jid)
+		result[j] = err == nil && contact.BusinessName != ""
+	}
+	return result
+}
+
+func nodeText(n waBinary.Node) string {
+	b, _ := n.Content.([]byte)
+	return string(b)
+}
+
+// minutesToClock formats opening hours, given in minutes after midnight, as
+// HH:MM. Other values are returned unchanged.
+func minutesToClock(minutes string) string {
+	m, err := strconv.Atoi(minutes)
+	if err != nil {
+		return minutes
+	}
+	return fmt.Sprintf("%02d:%02d", m/60, m%60)
+}
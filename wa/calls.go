@@ -0,0 +1,138 @@
+package wa
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/CSCSoftware/wahoo/db"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// handleCallEvent records incoming calls and how they ended, and rejects
+// calls from unknown numbers if configured to. Returns false for other
+// events.
+func handleCallEvent(c *Client, evt interface{}) bool {
+	var err error
+	switch v := evt.(type) {
+	case *events.CallOffer:
+		isVideo := false
+		if v.Data != nil {
+			for _, child := range v.Data.GetChildren() {
+				isVideo = isVideo || child.Tag == "video"
+			}
+		}
+		err = c.storeCallOffer(v.BasicCallMeta, isVideo)
+		if err == nil && c.RejectUnknownCalls && !c.ReadOnly && v.GroupJID.IsEmpty() {
+			c.goWork(func() { c.autoRejectCall(v.BasicCallMeta) })
+		}
+	case *events.CallOfferNotice:
+		err = c.storeCallOffer(v.BasicCallMeta, v.Media == "video")
+	case *events.CallAccept:
+		err = c.Store.SetCallStatus(v.CallID, db.CallAccepted)
+	case *events.CallReject:
+		err = c.Store.SetCallStatus(v.CallID, db.CallRejected)
+	case *events.CallTerminate:
+		err = c.Store.EndCall(v.CallID, v.Reason, v.Timestamp)
+	default:
+		return false
+	}
+	if err != nil {
+		c.Logger.Warnf("Failed to record call: %v", err)
+	}
+	return true
+}
+
+// callCaller is the number that started a call, preferring the phone number
+// over the LID.
+func callCaller(meta types.BasicCallMeta) types.JID {
+	caller := meta.CallCreator
+	if caller.IsEmpty() {
+		caller = meta.From
+	}
+	if caller.Server == types.HiddenUserServer && !meta.CallCreatorAlt.IsEmpty() {
+		caller = meta.CallCreatorAlt
+	}
+	return caller.ToNonAD()
+}
+
+func (c *Client) storeCallOffer(meta types.BasicCallMeta, isVideo bool) error {
+	return c.Store.StoreCallOffer(meta.CallID, callCaller(meta).String(), meta.From.String(),
+		meta.GroupJID.String(), isVideo, meta.Timestamp)
+}
+
+// isKnownCaller reports whether a caller is in the address book. A push
+// name alone does not make a caller known.
+func (c *Client) isKnownCaller(meta types.BasicCallMeta) bool {
+	for _, jid := range []types.JID{meta.CallCreator, meta.CallCreatorAlt, meta.From} {
+		if jid.IsEmpty() {
+			continue
+		}
+		contact, err := c.WA.Store.Contacts.GetContact(context.Background(), jid.ToNonAD())
+		if err == nil && (contact.FullName != "" || contact.FirstName != "") {
+			return true
+		}
+	}
+	return false
+}
+
+// autoRejectCall rejects a call from a caller that is not in the address
+// book and answers with RejectCallMessage, if set. It runs on its own, so
+// only the timeouts bound it.
+func (c *Client) autoRejectCall(meta types.BasicCallMeta) {
+	if c.isKnownCaller(meta) {
+		return
+	}
+	ctx := context.Background()
+	caller := callCaller(meta)
+	if err := c.rejectCall(ctx, meta.From, meta.CallID); err != nil {
+		c.Logger.Warnf("Failed to reject call from unknown caller %s: %v", caller, err)
+		return
+	}
+	if err := c.Store.SetCallStatus(meta.CallID, db.CallAutoRejected); err != nil {
+		c.Logger.Warnf("Failed to record call: %v", err)
+	}
+	c.Logger.Infof("Rejected call from unknown caller %s", caller)
+	if c.RejectCallMessage == "" {
+		return
+	}
+	if ok, _, msg := c.SendMessage(ctx, caller.String(), c.RejectCallMessage, nil, false); !ok {
+		c.Logger.Warnf("Failed to answer rejected call from %s: %s", caller, msg)
+	}
+}
+
+// RejectCall declines an incoming call that is still ringing.
+func (c *Client) RejectCall(ctx context.Context, callID string) (bool, string) {
+	if !c.IsConnected() {
+		return false, "Not connected to WhatsApp"
+	}
+	call, err := c.Store.GetCall(callID)
+	if err != nil {
+		return false, err.Error()
+	}
+	if call == nil {
+		return false, fmt.Sprintf("Call %s not found (see list_calls)", callID)
+	}
+	if call.Status != db.CallRinging {
+		return false, fmt.Sprintf("Call %s is not ringing (status: %s)", callID, call.Status)
+	}
+	from, err := types.ParseJID(call.CallerDevice)
+	if err != nil {
+		return false, fmt.Sprintf("Invalid caller JID: %v", err)
+	}
+
+	if err := c.rejectCall(ctx, from, callID); err != nil {
+		return false, fmt.Sprintf("Failed to reject call: %v", err)
+	}
+	if err := c.Store.SetCallStatus(callID, db.CallRejected); err != nil {
+		c.Logger.Warnf("Failed to record call: %v", err)
+	}
+	return true, fmt.Sprintf("Call from %s rejected", call.CallerName)
+}
+
+// rejectCall declines a call from the caller device within the request
+// timeout.
+func (c *Client) rejectCall(ctx context.Context, from types.JID, callID string) error {
+	ctx, done := withTimeout(ctx, c.Timeouts.Request, "rejecting the call")
+	return done(c.WA.RejectCall(ctx, from, callID))
+}
@@ -0,0 +1,75 @@
+package wa
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// handleChatStateEvent applies archive/pin/mute/read/clear/delete and message
+// star app-state changes made on another device to the local database.
+// Returns false for other events.
+func handleChatStateEvent(c *Client, evt interface{}) bool {
+	var chatJID, change string
+	var err error
+
+	switch v := evt.(type) {
+	case *events.Archive:
+		chatJID = v.JID.String()
+		change = fmt.Sprintf("archived=%t", v.Action.GetArchived())
+		err = c.Store.SetChatArchived(chatJID, v.Action.GetArchived())
+	case *events.Pin:
+		chatJID = v.JID.String()
+		change = fmt.Sprintf("pinned=%t", v.Action.GetPinned())
+		err = c.Store.SetChatPinned(chatJID, v.Action.GetPinned())
+	case *events.Mute:
+		chatJID = v.JID.String()
+		var until time.Time
+		if ts := v.Action.GetMuteEndTimestamp(); ts > 0 {
+			until = time.UnixMilli(ts)
+		}
+		change = fmt.Sprintf("muted=%t", v.Action.GetMuted())
+		err = c.Store.SetChatMuted(chatJID, v.Action.GetMuted(), until)
+	case *events.MarkChatAsRead:
+		chatJID = v.JID.String()
+		read := v.Action.GetRead()
+		change = fmt.Sprintf("read=%t", read)
+		if read {
+			at := v.Timestamp
+			if ts := v.Action.GetMessageRange().GetLastMessageTimestamp(); ts > 0 {
+				at = time.Unix(ts, 0)
+			}
+			err = c.Store.MarkChatRead(chatJID, at)
+		} else {
+			err = c.Store.SetChatUnreadCount(chatJID, 1)
+		}
+	case *events.ClearChat:
+		chatJID = v.JID.String()
+		before := v.Timestamp
+		if ts := v.Action.GetMessageRange().GetLastMessageTimestamp(); ts > 0 {
+			before = time.Unix(ts, 0)
+		}
+		var n int64
+		n, err = c.Store.ClearChatMessages(chatJID, before)
+		change = fmt.Sprintf("cleared %d messages", n)
+	case *events.Star:
+		chatJID = v.ChatJID.String()
+		change = fmt.Sprintf("message %s starred=%t", v.MessageID, v.Action.GetStarred())
+		_, err = c.Store.SetMessageStarred(v.MessageID, chatJID, v.Action.GetStarred(), v.Timestamp)
+	case *events.DeleteChat:
+		chatJID = v.JID.String()
+		change = "deleted"
+		err = c.Store.DeleteChat(chatJID)
+	default:
+		return false
+	}
+
+	if err != nil {
+		c.Logger.Warnf("Failed to apply chat state change for %s: %v", chatJID, err)
+	} else {
+		fmt.Fprintf(os.Stderr, "Chat %s %s (from another device)\n", chatJID, change)
+	}
+	return true
+}
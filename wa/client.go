@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	_ "modernc.org/sqlite"
@@ -21,21 +22,112 @@ import (
 
 // Client wraps the whatsmeow client and our message store.
 type Client struct {
-	WA       *whatsmeow.Client
-	Store    *db.Store
-	StoreDir string
-	Logger   waLog.Logger
+	WA        *whatsmeow.Client
+	Store     *db.Store
+	StoreDir  string
+	Logger    waLog.Logger
+	DupGuard  *DuplicateGuard // nil disables duplicate-send detection
+	RateLimit *RateLimiter    // nil disables rate limiting
+
+	// SendPolicy limits the recipients of all sends, in addition to the
+	// account's policy managed with manage_send_policy. nil allows all.
+	SendPolicy *SendPolicy
+
+	// OnWatchHit is called with the rule name whenever an incoming message matches a watch rule.
+	OnWatchHit func(rule string)
+
+	// OnMessage is called whenever a live message, incoming or our own, is stored.
+	OnMessage func(chatJID, messageID string)
+
+	// OnQRCode is called with each new pairing QR code while pairing.
+	OnQRCode func(code string)
+
+	// OnConnectionChange is called whenever the connection status changes.
+	OnConnectionChange func()
+
+	// DeleteRevoked deletes messages their sender revoked instead of keeping
+	// them flagged as revoked.
+	DeleteRevoked bool
+
+	// AccountName labels the client's metrics.
+	AccountName string
+
+	// ReadOnly stops the client from acting on its own: moderation rules only
+	// log violations and automatic read receipts are not sent.
+	ReadOnly bool
+
+	// MediaAllowDirs restricts the files that can be sent to these directories
+	// and the media directory (symlinks resolved). Empty allows any file.
+	MediaAllowDirs []string
+
+	// MediaQuota is the default limit cleanup_media enforces on downloaded media.
+	MediaQuota MediaQuota
+
+	// Retention is how long stored messages are kept by default.
+	Retention Retention
+
+	// Backups is where backups are written and how they are scheduled.
+	Backups BackupConfig
+
+	// PairPhone, if set, requests a phone pairing code for this number when an
+	// unpaired client connects. The QR code is still shown as a fallback.
+	PairPhone string
+
+	// Transcriber transcribes audio messages; nil disables transcription.
+	Transcriber Transcriber
+
+	// RejectUnknownCalls rejects incoming calls from callers that are not in
+	// the address book, answering with RejectCallMessage if it is set.
+	RejectUnknownCalls bool
+	RejectCallMessage  string
+
+	// Embedder computes the vectors for semantic search; nil disables it.
+	Embedder Embedder
+
+	// MediaArchive keeps copies of downloaded and sent media; nil disables it.
+	MediaArchive MediaArchive
+
+	// MediaURLs makes download_media return a presigned URL of the archived
+	// copy, valid for MediaURLExpiry, instead of the local path.
+	MediaURLs      bool
+	MediaURLExpiry time.Duration
+
+	// MaxDownloadBytes is the largest media file downloaded; 0 is unlimited.
+	MaxDownloadBytes int64
+
+	// Timeouts bound the WhatsApp calls of sends, media transfers and chat
+	// state changes.
+	Timeouts Timeouts
+
+	autoDownload   *autoDownloader  // nil unless StartAutoDownload was called
+	transcribeJobs chan downloadJob // nil unless StartAutoTranscribe was called
+	notifier       *eventNotifier   // nil unless EnableEventNotifications was called
+	presence       presenceTracker
+	historySync    historySyncer
+	mediaRetries   mediaRetries
+	health         healthTracker
+	conn           connectionTracker
+	pacer          sendPacer
+	handlerOnce    sync.Once
+	work           workTracker
+
+	nameRefreshMu sync.Mutex
+	nameRefresh   *time.Timer // pending debounced sender name refresh
 }
 
 // NewClient creates a new WhatsApp client and connects to the whatsmeow session DB.
 func NewClient(store *db.Store, storeDir string) (*Client, error) {
 	// All whatsmeow logs go to stderr (stdout is for MCP)
-	logger := waLog.Stdout("WhatsApp", "INFO", true)
+	logger := newStderrLogger("WhatsApp", "INFO")
 
 	// Open whatsmeow session container
 	dbPath := filepath.Join(storeDir, "whatsapp.db")
-	dbLog := waLog.Stdout("Database", "INFO", true)
-	container, err := sqlstore.New(context.Background(), "sqlite", "file:"+dbPath+"?_pragma=foreign_keys(1)", dbLog)
+	dbLog := newStderrLogger("Database", "INFO")
+	dsn := "file:" + dbPath + "?_pragma=foreign_keys(1)"
+	if store.LowMemory() {
+		dsn += db.LowMemoryPragmas
+	}
+	container, err := sqlstore.New(context.Background(), "sqlite", dsn, dbLog)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open whatsmeow DB: %w", err)
 	}
@@ -55,30 +147,24 @@ func NewClient(store *db.Store, storeDir string) (*Client, error) {
 	if waClient == nil {
 		return nil, fmt.Errorf("failed to create WhatsApp client")
 	}
+	// Reconcile archive/pin/mute state on a full app-state sync too, not just incremental patches
+	waClient.EmitAppStateEventsOnFullSync = true
+	// History sync chunks are recorded before they are downloaded, so they can be resumed
+	waClient.ManualHistorySyncDownload = true
 
 	return &Client{
 		WA:       waClient,
 		Store:    store,
 		StoreDir: storeDir,
 		Logger:   logger,
+		Timeouts: DefaultTimeouts,
 	}, nil
 }
 
 // Connect connects to WhatsApp, showing QR code on stderr if needed.
 func (c *Client) Connect(ctx context.Context) error {
-	// Register event handlers
-	c.WA.AddEventHandler(func(evt interface{}) {
-		switch v := evt.(type) {
-		case *events.Message:
-			handleMessage(c, v)
-		case *events.HistorySync:
-			handleHistorySync(c, v)
-		case *events.Connected:
-			c.Logger.Infof("Connected to WhatsApp")
-		case *events.LoggedOut:
-			c.Logger.Warnf("Device logged out")
-		}
-	})
+	// Register event handlers (once, Connect may be retried for pairing)
+	c.handlerOnce.Do(func() { c.WA.AddEventHandler(c.handleEvent) })
 
 	if c.WA.Store.ID == nil {
 		// New client - need QR code pairing
@@ -89,10 +175,21 @@ func (c *Client) Connect(ctx context.Context) error {
 
 		// QR code goes to stderr (stdout is MCP)
 		connected := make(chan bool, 1)
+		pairRequested := false
 		for evt := range qrChan {
 			if evt.Event == "code" {
+				// The first QR event means the socket is ready for code pairing
+				if c.PairPhone != "" && !pairRequested {
+					pairRequested = true
+					if _, err := c.RequestPairingCode(c.PairPhone); err != nil {
+						c.Logger.Warnf("%v", err)
+					}
+				}
 				fmt.Fprintln(os.Stderr, "\nScan this QR code with your WhatsApp app:")
 				qrterminal.GenerateHalfBlock(evt.Code, qrterminal.L, os.Stderr)
+				if c.OnQRCode != nil {
+					c.OnQRCode(evt.Code)
+				}
 			} else if evt.Event == "success" {
 				connected <- true
 				break
@@ -103,6 +200,7 @@ func (c *Client) Connect(ctx context.Context) error {
 		case <-connected:
 			fmt.Fprintln(os.Stderr, "Successfully connected and authenticated!")
 		case <-time.After(3 * time.Minute):
+			c.WA.Disconnect()
 			return fmt.Errorf("timeout waiting for QR code scan")
 		case <-ctx.Done():
 			return ctx.Err()
@@ -125,6 +223,59 @@ func (c *Client) Connect(ctx context.Context) error {
 	return nil
 }
 
+// handleEvent dispatches whatsmeow events.
+func (c *Client) handleEvent(evt interface{}) {
+	if !c.work.begin() {
+		return // shutting down
+	}
+	defer c.work.done()
+
+	c.notifyEvent(evt)
+	c.trackHealthEvent(evt)
+	c.recordConnectionMetrics(evt)
+	if c.trackConnectionEvent(evt) {
+		c.notifyConnectionChange()
+	}
+	if handleChatStateEvent(c, evt) || handleLabelEvent(c, evt) || handleCallEvent(c, evt) {
+		return
+	}
+
+	switch v := evt.(type) {
+	case *events.Message:
+		handleMessage(c, v)
+		c.trackReadState(v)
+	case *events.Receipt:
+		c.trackReadState(v)
+		c.confirmDelivered(v)
+	case *events.Connected:
+		c.Logger.Infof("Connected to WhatsApp")
+		c.scheduleNameRefresh()
+		c.goWork(c.flushOutboxOnConnect)
+		c.goWork(c.renewPresenceSubscriptions)
+		c.resumeHistorySync()
+		c.goWork(func() {
+			if err := c.SyncGroups(context.Background()); err != nil {
+				c.Logger.Warnf("Group sync failed: %v", err)
+			}
+		})
+	case *events.Presence:
+		c.presence.update(v)
+		c.storePresence(v)
+	case *events.GroupInfo:
+		c.goWork(func() { handleGroupInfo(c, v) })
+	case *events.JoinedGroup:
+		c.storeGroupInfo(&v.GroupInfo)
+	case *events.MediaRetry:
+		c.goWork(func() { c.handleMediaRetry(v) })
+	case *events.IdentityChange:
+		c.handleIdentityChange(v)
+	case *events.Contact, *events.PushName, *events.BusinessName:
+		c.scheduleNameRefresh()
+	case *events.LoggedOut:
+		c.Logger.Warnf("Device logged out")
+	}
+}
+
 // Disconnect cleanly disconnects from WhatsApp.
 func (c *Client) Disconnect() {
 	if c.WA != nil {
@@ -0,0 +1,114 @@
+package wa
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// maxConnectionErrors is how many recent connection errors are remembered.
+const maxConnectionErrors = 10
+
+// ConnectionError is a connection problem reported by WhatsApp or while connecting.
+type ConnectionError struct {
+	Time   time.Time
+	Kind   string // connect_failure, stream_error, logged_out, temporary_ban, keepalive_timeout, ...
+	Detail string
+}
+
+// ConnectionStatus is the session state of a client.
+type ConnectionStatus struct {
+	Connected        bool
+	LoggedIn         bool
+	JID              string // own JID, empty if not paired
+	PushName         string
+	LastConnected    time.Time // zero if not connected since startup
+	LastDisconnected time.Time
+	Errors           []ConnectionError // newest first
+}
+
+// connectionTracker remembers connection state changes reported by whatsmeow.
+type connectionTracker struct {
+	mu               sync.Mutex
+	lastConnected    time.Time
+	lastDisconnected time.Time
+	errors           []ConnectionError
+}
+
+func (t *connectionTracker) addError(kind, detail string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.errors = append(t.errors, ConnectionError{Time: time.Now(), Kind: kind, Detail: detail})
+	if len(t.errors) > maxConnectionErrors {
+		t.errors = t.errors[len(t.errors)-maxConnectionErrors:]
+	}
+}
+
+// trackConnectionEvent records connection-related events and reports whether
+// the event changed the connection state.
+func (c *Client) trackConnectionEvent(evt interface{}) bool {
+	switch v := evt.(type) {
+	case *events.Connected:
+		c.conn.mu.Lock()
+		c.conn.lastConnected = time.Now()
+		c.conn.mu.Unlock()
+	case *events.Disconnected:
+		c.conn.mu.Lock()
+		c.conn.lastDisconnected = time.Now()
+		c.conn.mu.Unlock()
+	case *events.LoggedOut:
+		c.conn.addError("logged_out", v.Reason.String())
+	case *events.ConnectFailure:
+		c.conn.addError("connect_failure", fmt.Sprintf("%d %s", v.Reason, v.Message))
+	case *events.StreamError:
+		c.conn.addError("stream_error", v.Code)
+	case *events.TemporaryBan:
+		c.conn.addError("temporary_ban", v.String())
+	case *events.StreamReplaced:
+		c.conn.addError("stream_replaced", "another client connected with the same session")
+	case *events.ClientOutdated:
+		c.conn.addError("client_outdated", "WhatsApp rejected the client version")
+	case *events.KeepAliveTimeout:
+		c.conn.addError("keepalive_timeout", fmt.Sprintf("%d keepalive failures", v.ErrorCount))
+	case *events.KeepAliveRestored:
+	default:
+		return false
+	}
+	return true
+}
+
+// recordConnectError remembers an error returned while connecting.
+func (c *Client) recordConnectError(err error) {
+	c.conn.addError("connect", err.Error())
+	c.notifyConnectionChange()
+}
+
+func (c *Client) notifyConnectionChange() {
+	if c.OnConnectionChange != nil {
+		c.OnConnectionChange()
+	}
+}
+
+// GetConnectionStatus returns the current session state and recent connection errors.
+func (c *Client) GetConnectionStatus() ConnectionStatus {
+	st := ConnectionStatus{
+		Connected: c.IsConnected(),
+		LoggedIn:  c.WA.IsLoggedIn(),
+		PushName:  c.WA.Store.PushName,
+	}
+	if c.WA.Store.ID != nil {
+		st.JID = c.WA.Store.ID.ToNonAD().String()
+	}
+
+	c.conn.mu.Lock()
+	defer c.conn.mu.Unlock()
+	st.LastConnected = c.conn.lastConnected
+	st.LastDisconnected = c.conn.lastDisconnected
+	st.Errors = make([]ConnectionError, 0, len(c.conn.errors))
+	for i := len(c.conn.errors) - 1; i >= 0; i-- {
+		st.Errors = append(st.Errors, c.conn.errors[i])
+	}
+	return st
+}
@@ -0,0 +1,132 @@
+package wa
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"go.mau.fi/whatsmeow"
+)
+
+// Progress of media downloads is reported every downloadProgressStep bytes.
+// Downloads of at least downloadLogBytes are also logged at every quarter.
+const (
+	downloadProgressStep = 1 << 20
+	downloadLogBytes     = 16 << 20
+)
+
+// maxEncryptionOverhead is how much larger than the file WhatsApp's
+// encrypted media can be: up to 16 bytes of padding and a 10-byte MAC.
+const maxEncryptionOverhead = 26
+
+// ProgressFunc receives the progress of a media download: the bytes
+// downloaded so far of total, which is 0 if unknown.
+type ProgressFunc func(done, total int64)
+
+type progressKey struct{}
+
+// WithProgress returns a context under which media downloads report their
+// progress to fn.
+func WithProgress(ctx context.Context, fn ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+// errDownloadTooLarge stops a download that grows beyond the size limit.
+var errDownloadTooLarge = errors.New("media exceeds the download size limit")
+
+// downloadFile is the file a download is decrypted into. It counts the bytes
+// written, reports progress and stops a download beyond its size limit.
+// It wraps rather than embeds the file so io.Copy can't bypass Write.
+type downloadFile struct {
+	f        *os.File
+	name     string
+	total    int64 // expected size, 0 if unknown
+	max      int64 // largest size written, 0 for no limit
+	written  int64
+	reported int64
+	logged   int64 // quarters logged
+	progress ProgressFunc
+	logf     func(format string, args ...interface{})
+}
+
+func (d *downloadFile) Write(p []byte) (int, error) {
+	if d.max > 0 && d.written+int64(len(p)) > d.max {
+		return 0, errDownloadTooLarge
+	}
+	n, err := d.f.Write(p)
+	d.written += int64(n)
+	if d.written-d.reported >= downloadProgressStep {
+		d.reported = d.written
+		if d.progress != nil {
+			d.progress(d.done(), d.total)
+		}
+	}
+	if d.total >= downloadLogBytes {
+		if q := min(d.written*4/d.total, 3); q > d.logged {
+			d.logged = q
+			d.logf("Downloading %s: %d%% of %d MB", d.name, q*25, d.total>>20)
+		}
+	}
+	return n, err
+}
+
+// done returns the bytes downloaded, not counting the encryption overhead
+// beyond the expected size.
+func (d *downloadFile) done() int64 {
+	if d.total > 0 {
+		return min(d.written, d.total)
+	}
+	return d.written
+}
+
+func (d *downloadFile) Read(p []byte) (int, error)                   { return d.f.Read(p) }
+func (d *downloadFile) ReadAt(p []byte, off int64) (int, error)      { return d.f.ReadAt(p, off) }
+func (d *downloadFile) WriteAt(p []byte, off int64) (int, error)     { return d.f.WriteAt(p, off) }
+func (d *downloadFile) Seek(offset int64, whence int) (int64, error) { return d.f.Seek(offset, whence) }
+func (d *downloadFile) Truncate(size int64) error                    { return d.f.Truncate(size) }
+func (d *downloadFile) Stat() (fs.FileInfo, error)                   { return d.f.Stat() }
+
+// downloadToPath streams media to localPath within the media timeout: the
+// encrypted file is written to disk and decrypted in place, so no more than
+// a buffer of it is held in memory. A partial file is removed on failure.
+func (c *Client) downloadToPath(ctx context.Context, downloader whatsmeow.DownloadableMessage, localPath string) error {
+	// The size is checked up front when the message states it; the limit on
+	// the written bytes catches the rest
+	var size int64
+	if sized, ok := downloader.(interface{ GetFileLength() uint64 }); ok {
+		size = int64(sized.GetFileLength())
+	}
+	if c.MaxDownloadBytes > 0 && size > c.MaxDownloadBytes {
+		return fmt.Errorf("media is %d MB, larger than the download limit of %d MB", size>>20, c.MaxDownloadBytes>>20)
+	}
+
+	f, err := os.OpenFile(localPath, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to save file: %w", err)
+	}
+	file := &downloadFile{f: f, name: filepath.Base(localPath), total: size, logf: c.Logger.Infof}
+	if c.MaxDownloadBytes > 0 {
+		file.max = c.MaxDownloadBytes + maxEncryptionOverhead
+	}
+	file.progress, _ = ctx.Value(progressKey{}).(ProgressFunc)
+
+	ctx, done := withTimeout(ctx, c.Timeouts.Media, "downloading media")
+	err = done(c.WA.DownloadToFile(ctx, downloader, file))
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to save file: %w", closeErr)
+	}
+	if errors.Is(err, errDownloadTooLarge) {
+		err = fmt.Errorf("media is larger than the download limit of %d MB", c.MaxDownloadBytes>>20)
+	}
+	if err != nil {
+		os.Remove(localPath)
+		return fmt.Errorf("download failed: %w", err)
+	}
+	if file.progress != nil {
+		file.progress(file.done(), size)
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package wa
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/CSCSoftware/wahoo/db"
+)
+
+// Embedding indexing settings: messages are embedded embedBatchSize at a
+// time, each cut to embedMaxRunes, and new messages are picked up every
+// embedInterval.
+const (
+	embedBatchSize = 32
+	embedMaxRunes  = 2000
+	embedInterval  = time.Minute
+	embedTimeout   = 2 * time.Minute
+)
+
+// Embedder turns texts into embedding vectors for semantic search.
+type Embedder interface {
+	Name() string // identifies the model; stored with each vector
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// LlamaCPPEmbedder embeds with a local llama.cpp llama-embedding binary and
+// a GGUF embedding model.
+type LlamaCPPEmbedder struct {
+	Binary string // e.g. llama-embedding
+	Model  string // path to a GGUF embedding model
+}
+
+// llamaSeparator separates the prompts passed to llama-embedding at once.
+const llamaSeparator = "\x1e"
+
+func (l *LlamaCPPEmbedder) Name() string { return "llama.cpp:" + filepath.Base(l.Model) }
+
+func (l *LlamaCPPEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	out, err := exec.CommandContext(ctx, l.Binary, "-m", l.Model, "--log-disable",
+		"--embd-output-format", "json", "--embd-separator", llamaSeparator,
+		"-p", strings.Join(texts, llamaSeparator)).Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s failed: %w", filepath.Base(l.Binary), err)
+	}
+	return parseEmbeddings(out, len(texts))
+}
+
+// HTTPEmbedder posts texts to an OpenAI-compatible /v1/embeddings endpoint,
+// e.g. OpenAI or a local Ollama or llama.cpp server.
+type HTTPEmbedder struct {
+	URL    string
+	APIKey string // sent as a bearer token if set
+	Model  string // default text-embedding-3-small
+}
+
+func (h *HTTPEmbedder) model() string {
+	if h.Model == "" {
+		return "text-embedding-3-small"
+	}
+	return h.Model
+}
+
+func (h *HTTPEmbedder) Name() string { return h.model() }
+
+func (h *HTTPEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	body, err := json.Marshal(map[string]any{"model": h.model(), "input": texts})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if h.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+h.APIKey)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("embedding request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<20))
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("embedding API returned %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	return parseEmbeddings(data, len(texts))
+}
+
+// parseEmbeddings reads the OpenAI embeddings response format, which
+// llama-embedding also writes.
+func parseEmbeddings(data []byte, n int) ([][]float32, error) {
+	var result struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("invalid embedding response: %w", err)
+	}
+	if len(result.Data) != n {
+		return nil, fmt.Errorf("got %d embeddings for %d texts", len(result.Data), n)
+	}
+	vectors := make([][]float32, n)
+	for _, d := range result.Data {
+		if d.Index < 0 || d.Index >= n || len(d.Embedding) == 0 {
+			return nil, fmt.Errorf("invalid embedding at index %d", d.Index)
+		}
+		vectors[d.Index] = d.Embedding
+	}
+	return vectors, nil
+}
+
+// embeddingText collapses whitespace and cuts text to embedMaxRunes.
+func embeddingText(text string) string {
+	if fields := strings.Fields(text); len(fields) > 0 {
+		text = strings.Join(fields, " ")
+	}
+	if r := []rune(text); len(r) > embedMaxRunes {
+		text = string(r[:embedMaxRunes])
+	}
+	return text
+}
+
+// SemanticSearch returns the stored messages most similar in meaning to
+// query. Only messages the indexer has embedded are found; indexed is how
+// many there are.
+func (c *Client) SemanticSearch(ctx context.Context, query string, opts db.SemanticSearchOpts) (matches []db.SemanticMatch, indexed int, err error) {
+	if c.Embedder == nil {
+		return nil, 0, fmt.Errorf("semantic search is not configured (start the server with -embed-cmd or -embed-url)")
+	}
+	ctx, cancel := context.WithTimeout(ctx, embedTimeout)
+	defer cancel()
+	vectors, err := c.Embedder.Embed(ctx, []string{embeddingText(query)})
+	if err != nil {
+		return nil, 0, err
+	}
+	model := c.Embedder.Name()
+	if indexed, err = c.Store.EmbeddedCount(model); err != nil {
+		return nil, 0, err
+	}
+	matches, err = c.Store.SemanticSearch(model, vectors[0], opts)
+	return matches, indexed, err
+}
+
+// indexEmbeddings embeds the stored messages that have no embedding yet,
+// newest first, until all are done or a batch fails.
+func (c *Client) indexEmbeddings(ctx context.Context) (int, error) {
+	if _, err := c.Store.DeleteStaleEmbeddings(); err != nil {
+		return 0, err
+	}
+	model := c.Embedder.Name()
+	indexed := 0
+	for ctx.Err() == nil {
+		pending, err := c.Store.PendingEmbeddings(model, embedBatchSize)
+		if err != nil || len(pending) == 0 {
+			return indexed, err
+		}
+		texts := make([]string, len(pending))
+		for i, p := range pending {
+			texts[i] = embeddingText(p.Text)
+		}
+		embedCtx, cancel := context.WithTimeout(ctx, embedTimeout)
+		vectors, err := c.Embedder.Embed(embedCtx, texts)
+		cancel()
+		if err != nil {
+			return indexed, err
+		}
+		if err := c.Store.StoreEmbeddings(model, pending, vectors); err != nil {
+			return indexed, err
+		}
+		indexed += len(pending)
+	}
+	return indexed, nil
+}
+
+// StartEmbeddingIndexer embeds stored and incoming messages in the background
+// until ctx is done, so semantic search can find them. Embedder must be set.
+func (c *Client) StartEmbeddingIndexer(ctx context.Context) {
+	run := func() {
+		n, err := c.indexEmbeddings(ctx)
+		if err != nil && ctx.Err() == nil {
+			c.Logger.Warnf("Embedding messages failed: %v", err)
+		}
+		if n > 0 {
+			fmt.Fprintf(os.Stderr, "Semantic search: embedded %d messages\n", n)
+		}
+	}
+	c.goWork(func() {
+		run()
+		ticker := time.NewTicker(embedInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				run()
+			}
+		}
+	})
+	fmt.Fprintf(os.Stderr, "Semantic search enabled (%s)\n", c.Embedder.Name())
+}
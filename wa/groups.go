@@ -0,0 +1,168 @@
+package wa
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/CSCSoftware/wahoo/db"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// SyncGroups refreshes the local group cache from the list of joined groups.
+func (c *Client) SyncGroups(ctx context.Context) error {
+	if !c.IsConnected() {
+		return fmt.Errorf("not connected to WhatsApp")
+	}
+
+	ctx, done := withTimeout(ctx, c.Timeouts.Request, "getting the joined groups")
+	groups, err := c.WA.GetJoinedGroups(ctx)
+	if err = done(err); err != nil {
+		return fmt.Errorf("failed to get joined groups: %w", err)
+	}
+
+	for _, info := range groups {
+		c.storeGroupInfo(info)
+	}
+	fmt.Fprintf(os.Stderr, "Group sync complete. Cached %d groups.\n", len(groups))
+	return nil
+}
+
+// storeGroupInfo writes whatsmeow group metadata to the local cache.
+func (c *Client) storeGroupInfo(info *types.GroupInfo) {
+	record := db.GroupRecord{
+		JID:           info.JID.String(),
+		Name:          info.Name,
+		Topic:         info.Topic,
+		CreatedAt:     info.GroupCreated,
+		Announce:      info.IsAnnounce,
+		Locked:        info.IsLocked,
+		MemberAddMode: string(info.MemberAddMode),
+	}
+	if !info.OwnerJID.IsEmpty() {
+		record.OwnerJID = info.OwnerJID.String()
+	}
+	for _, p := range info.Participants {
+		record.Participants = append(record.Participants, db.GroupParticipantRecord{
+			JID:          p.JID.String(),
+			IsAdmin:      p.IsAdmin,
+			IsSuperAdmin: p.IsSuperAdmin,
+		})
+	}
+
+	if err := c.Store.StoreGroup(record); err != nil {
+		c.Logger.Warnf("Failed to store group %s: %v", record.JID, err)
+	}
+
+	var timer time.Duration
+	if info.IsEphemeral {
+		timer = time.Duration(info.DisappearingTimer) * time.Second
+	}
+	if err := c.Store.SetChatDisappearingTimer(record.JID, timer); err != nil {
+		c.Logger.Warnf("Failed to record disappearing timer of %s: %v", record.JID, err)
+	}
+}
+
+// handleGroupInfo records the participant changes of a group notification
+// and refreshes the cached group. Settings changes are applied right away;
+// then the full info is re-fetched rather than patched, so the cache can't
+// drift.
+func handleGroupInfo(c *Client, evt *events.GroupInfo) {
+	if evt.Announce != nil || evt.Locked != nil {
+		var announce, locked *bool
+		if evt.Announce != nil {
+			announce = &evt.Announce.IsAnnounce
+		}
+		if evt.Locked != nil {
+			locked = &evt.Locked.IsLocked
+		}
+		if err := c.Store.SetGroupSettings(evt.JID.String(), announce, locked); err != nil {
+			c.Logger.Warnf("Failed to update settings of group %s: %v", evt.JID, err)
+		}
+	}
+	if changes := groupEventRecords(evt); len(changes) > 0 {
+		if err := c.Store.StoreGroupEvents(changes); err != nil {
+			c.Logger.Warnf("Failed to record participant changes of %s: %v", evt.JID, err)
+		}
+	}
+	if evt.Delete != nil {
+		if err := c.Store.DeleteGroup(evt.JID.String()); err != nil {
+			c.Logger.Warnf("Failed to delete group %s: %v", evt.JID, err)
+		}
+		return
+	}
+	ctx, done := withTimeout(context.Background(), c.Timeouts.Request, "getting the group info")
+	info, err := c.WA.GetGroupInfo(ctx, evt.JID)
+	if err = done(err); err != nil {
+		c.Logger.Warnf("Failed to refresh group %s: %v", evt.JID, err)
+		return
+	}
+	c.storeGroupInfo(info)
+}
+
+// checkGroupSend returns why we can't send to jid if it is an announcement
+// group, where only admins can send, and we aren't an admin of it, or "".
+// It goes by the cached group.
+func (c *Client) checkGroupSend(jid types.JID) string {
+	if jid.Server != types.GroupServer || c.WA.Store.ID == nil {
+		return ""
+	}
+	self := []string{c.WA.Store.ID.ToNonAD().String()}
+	if !c.WA.Store.LID.IsEmpty() {
+		self = append(self, c.WA.Store.LID.ToNonAD().String())
+	}
+	restricted, err := c.Store.GroupSendRestricted(jid.String(), self)
+	if err != nil {
+		c.Logger.Warnf("%v", err)
+		return ""
+	}
+	if restricted {
+		return fmt.Sprintf("Only admins can send messages to %s (announcement group) and this account is not an admin", jid)
+	}
+	return ""
+}
+
+// groupEventRecords lists the participant changes in a group notification.
+// Joins and leaves by someone other than the participant are adds and removes.
+func groupEventRecords(evt *events.GroupInfo) []db.GroupEventRecord {
+	var actor, actorPN types.JID
+	if evt.Sender != nil {
+		actor = evt.Sender.ToNonAD()
+	}
+	if evt.SenderPN != nil {
+		actorPN = evt.SenderPN.ToNonAD()
+	}
+	timestamp := evt.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+
+	var records []db.GroupEventRecord
+	add := func(action, byOther string, participants []types.JID, reason string) {
+		for _, p := range participants {
+			p = p.ToNonAD()
+			record := db.GroupEventRecord{
+				GroupJID:    evt.JID.String(),
+				Action:      action,
+				Participant: p.String(),
+				Reason:      reason,
+				Timestamp:   timestamp,
+			}
+			if !actor.IsEmpty() {
+				record.Actor = actor.String()
+				if byOther != "" && actor != p && actorPN != p {
+					record.Action = byOther
+				}
+			}
+			records = append(records, record)
+		}
+	}
+	add(db.GroupEventJoin, db.GroupEventAdd, evt.Join, evt.JoinReason)
+	add(db.GroupEventLeave, db.GroupEventRemove, evt.Leave, "")
+	add(db.GroupEventPromote, "", evt.Promote, "")
+	add(db.GroupEventDemote, "", evt.Demote, "")
+	return records
+}
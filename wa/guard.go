@@ -0,0 +1,59 @@
+package wa
+
+import (
+	"sync"
+	"time"
+)
+
+// DuplicateGuard remembers recently sent texts per recipient so that agent
+// retry loops don't double-text people.
+type DuplicateGuard struct {
+	Window time.Duration // 0 disables the guard
+	Refuse bool          // refuse duplicates instead of only warning
+
+	mu     sync.Mutex
+	recent map[string]time.Time
+}
+
+// NewDuplicateGuard creates a guard. mode is "warn" or "refuse".
+func NewDuplicateGuard(window time.Duration, mode string) *DuplicateGuard {
+	return &DuplicateGuard{
+		Window: window,
+		Refuse: mode == "refuse",
+		recent: make(map[string]time.Time),
+	}
+}
+
+// Check reports whether the same text was sent to recipient within the window,
+// and if so how long ago.
+func (g *DuplicateGuard) Check(recipient, text string) (bool, time.Duration) {
+	if g == nil || g.Window <= 0 {
+		return false, 0
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	sentAt, ok := g.recent[recipient+"\x00"+text]
+	if !ok {
+		return false, 0
+	}
+	age := time.Since(sentAt)
+	return age < g.Window, age
+}
+
+// Record remembers a successful send and drops entries older than the window.
+func (g *DuplicateGuard) Record(recipient, text string) {
+	if g == nil || g.Window <= 0 {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	for key, sentAt := range g.recent {
+		if now.Sub(sentAt) >= g.Window {
+			delete(g.recent, key)
+		}
+	}
+	g.recent[recipient+"\x00"+text] = now
+}
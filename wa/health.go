@@ -0,0 +1,247 @@
+package wa
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// Thresholds above which sending behaviour is reported as risky. They are
+// deliberately conservative: new or rarely used numbers get flagged far
+// sooner than established ones.
+const (
+	healthHourlySendLimit  = 60
+	healthDailySendLimit   = 500
+	healthFailureRateLimit = 0.3
+	healthMinSendsForRate  = 5 // failure rate is meaningless below this
+	healthMaxEvents        = 20
+)
+
+// HealthEvent is an account-level warning sign reported by WhatsApp.
+type HealthEvent struct {
+	Time   time.Time
+	Kind   string // temporary_ban, connect_failure, stream_error, logged_out, rate_limited
+	Detail string
+}
+
+// AccountHealth summarizes the signals correlated with an account getting flagged.
+type AccountHealth struct {
+	Risk             string // "ok", "elevated" or "high"
+	SendsLastHour    int
+	SendsLastDay     int
+	FailuresLastHour int
+	FailuresLastDay  int
+	FailureRate      float64        // failed share of sends in the last hour
+	ErrorCodes       map[string]int // send error codes seen in the last day
+	RecentEvents     []HealthEvent  // newest first
+	Warnings         []string
+}
+
+type sendSample struct {
+	at   time.Time
+	ok   bool
+	code string
+}
+
+// healthTracker keeps the last day of send outcomes and recent account events.
+type healthTracker struct {
+	mu     sync.Mutex
+	sends  []sendSample
+	events []HealthEvent
+}
+
+func (t *healthTracker) recordSend(err error) {
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	cutoff := now.Add(-24 * time.Hour)
+	i := 0
+	for i < len(t.sends) && t.sends[i].at.Before(cutoff) {
+		i++
+	}
+	t.sends = append(t.sends[i:], sendSample{at: now, ok: err == nil, code: sendErrorCode(err)})
+
+	if errors.Is(err, whatsmeow.ErrIQRateOverLimit) {
+		t.addEventLocked(HealthEvent{Time: now, Kind: "rate_limited", Detail: err.Error()})
+	}
+}
+
+func (t *healthTracker) addEvent(kind, detail string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.addEventLocked(HealthEvent{Time: time.Now(), Kind: kind, Detail: detail})
+}
+
+func (t *healthTracker) addEventLocked(e HealthEvent) {
+	t.events = append(t.events, e)
+	if len(t.events) > healthMaxEvents {
+		t.events = t.events[len(t.events)-healthMaxEvents:]
+	}
+}
+
+// sendErrorCode classifies a send error by the code WhatsApp returned, if any.
+func sendErrorCode(err error) string {
+	if err == nil {
+		return ""
+	}
+	var iqErr *whatsmeow.IQError
+	if errors.As(err, &iqErr) && iqErr.Code != 0 {
+		return fmt.Sprintf("%d", iqErr.Code)
+	}
+	if errors.Is(err, whatsmeow.ErrServerReturnedError) {
+		// Formatted as "server returned error <code>"
+		fields := strings.Fields(err.Error())
+		return fields[len(fields)-1]
+	}
+	if errors.Is(err, whatsmeow.ErrNotConnected) || errors.Is(err, whatsmeow.ErrNotLoggedIn) {
+		return "not_connected"
+	}
+	return "other"
+}
+
+// trackHealthEvent records whatsmeow events that indicate account trouble.
+func (c *Client) trackHealthEvent(evt interface{}) {
+	switch v := evt.(type) {
+	case *events.TemporaryBan:
+		c.health.addEvent("temporary_ban", v.String())
+	case *events.ConnectFailure:
+		c.health.addEvent("connect_failure", fmt.Sprintf("%d %s", v.Reason, v.Message))
+	case *events.StreamError:
+		c.health.addEvent("stream_error", v.Code)
+	case *events.LoggedOut:
+		c.health.addEvent("logged_out", v.Reason.String())
+	}
+}
+
+// SendAttempts tells whether the sends made under a context from
+// WithSendAttempts got a message to WhatsApp, possibly, or into the outbox.
+// Sends WhatsApp rejected do not count.
+type SendAttempts struct {
+	attempted atomic.Bool
+}
+
+// Attempted reports whether a message may have reached WhatsApp or will be
+// sent by the outbox.
+func (a *SendAttempts) Attempted() bool {
+	return a.attempted.Load()
+}
+
+type sendAttemptsKey struct{}
+
+// WithSendAttempts returns a context under which sends report to the returned
+// SendAttempts.
+func WithSendAttempts(ctx context.Context) (context.Context, *SendAttempts) {
+	a := &SendAttempts{}
+	return context.WithValue(ctx, sendAttemptsKey{}, a), a
+}
+
+// noteSendAttempt records for WithSendAttempts that a message may have
+// reached WhatsApp or was recorded in the outbox.
+func noteSendAttempt(ctx context.Context) {
+	if a, ok := ctx.Value(sendAttemptsKey{}).(*SendAttempts); ok {
+		a.attempted.Store(true)
+	}
+}
+
+// sendTracked sends a message within the send timeout and records the
+// outcome for the health report. The message is stored while it is sent; see
+// storePending. The response carries the message ID even if the send failed.
+func (c *Client) sendTracked(ctx context.Context, to types.JID, msg *waProto.Message) (whatsmeow.SendResponse, error) {
+	id := c.WA.GenerateMessageID()
+	stored := c.storePending(to, id, msg)
+	ctx, done := withTimeout(ctx, c.Timeouts.Send, "sending the message")
+	resp, err := c.WA.SendMessage(ctx, to, msg, whatsmeow.SendRequestExtra{ID: id})
+	err = done(err)
+	if err == nil || IsTimeout(err) {
+		noteSendAttempt(ctx)
+	}
+	resp.ID = id
+	if stored {
+		c.settlePending(to, id, resp, err)
+	}
+	c.health.recordSend(err)
+	c.recordSendMetrics(err)
+	return resp, err
+}
+
+// GetAccountHealth reports recent send volume, failures and warning events.
+func (c *Client) GetAccountHealth() AccountHealth {
+	now := time.Now()
+	h := AccountHealth{ErrorCodes: make(map[string]int)}
+
+	c.health.mu.Lock()
+	for _, s := range c.health.sends {
+		lastHour := now.Sub(s.at) < time.Hour
+		h.SendsLastDay++
+		if lastHour {
+			h.SendsLastHour++
+		}
+		if !s.ok {
+			h.FailuresLastDay++
+			h.ErrorCodes[s.code]++
+			if lastHour {
+				h.FailuresLastHour++
+			}
+		}
+	}
+	for _, e := range c.health.events {
+		if now.Sub(e.Time) < 24*time.Hour {
+			h.RecentEvents = append(h.RecentEvents, e)
+		}
+	}
+	c.health.mu.Unlock()
+
+	sort.Slice(h.RecentEvents, func(i, j int) bool { return h.RecentEvents[i].Time.After(h.RecentEvents[j].Time) })
+	if h.SendsLastHour > 0 {
+		h.FailureRate = float64(h.FailuresLastHour) / float64(h.SendsLastHour)
+	}
+
+	h.Risk = "ok"
+	elevate := func(risk, warning string) {
+		if risk == "high" || h.Risk == "ok" {
+			h.Risk = risk
+		}
+		h.Warnings = append(h.Warnings, warning)
+	}
+	if h.SendsLastHour > healthHourlySendLimit {
+		elevate("elevated", fmt.Sprintf("%d messages sent in the last hour (more than %d looks automated)", h.SendsLastHour, healthHourlySendLimit))
+	}
+	if h.SendsLastDay > healthDailySendLimit {
+		elevate("elevated", fmt.Sprintf("%d messages sent in the last day (more than %d looks automated)", h.SendsLastDay, healthDailySendLimit))
+	}
+	if h.SendsLastHour >= healthMinSendsForRate && h.FailureRate >= healthFailureRateLimit {
+		elevate("elevated", fmt.Sprintf("%.0f%% of sends failed in the last hour", h.FailureRate*100))
+	}
+	var banned, rateLimited bool
+	for _, e := range h.RecentEvents {
+		banned = banned || e.Kind == "temporary_ban"
+		rateLimited = rateLimited || e.Kind == "rate_limited"
+	}
+	if banned {
+		elevate("high", "WhatsApp temporarily banned this account in the last day")
+	}
+	if rateLimited {
+		elevate("high", "WhatsApp rate-limited this account in the last day")
+	}
+	return h
+}
+
+// healthWarning returns a suffix for send results when the account looks at risk.
+func (c *Client) healthWarning() string {
+	h := c.GetAccountHealth()
+	if h.Risk == "ok" {
+		return ""
+	}
+	return fmt.Sprintf(" (warning: %s risk - %s; slow down, see get_account_health)", h.Risk, strings.Join(h.Warnings, "; "))
+}
@@ -0,0 +1,134 @@
+package wa
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/CSCSoftware/wahoo/db"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// On-demand history requests. WhatsApp recommends 50 messages at a time.
+const (
+	DefaultHistoryRequest = 50
+	MaxHistoryRequest     = 500
+)
+
+// RequestHistory asks the phone for up to count messages of a chat sent
+// before beforeID, or before the oldest stored message if beforeID is empty.
+// The phone answers with an on-demand history sync, which is stored like any
+// other; the phone must be online for it to answer.
+func (c *Client) RequestHistory(ctx context.Context, chatJID, beforeID string, count int) (bool, string) {
+	if !c.IsConnected() {
+		return false, "Not connected to WhatsApp"
+	}
+	jid, err := types.ParseJID(chatJID)
+	if err != nil {
+		return false, fmt.Sprintf("Invalid JID: %v", err)
+	}
+	if count <= 0 {
+		count = DefaultHistoryRequest
+	}
+	count = min(count, MaxHistoryRequest)
+
+	anchor, err := c.Store.HistoryAnchor(jid.String(), beforeID)
+	if err != nil {
+		return false, fmt.Sprintf("Error: %v", err)
+	}
+	if anchor == nil {
+		if beforeID != "" {
+			return false, fmt.Sprintf("Message %s not found in %s", beforeID, chatJID)
+		}
+		return false, fmt.Sprintf("No messages of %s stored; history can only be requested before a known message", chatJID)
+	}
+
+	if err := c.requestHistoryBefore(ctx, jid, anchor, count); err != nil {
+		return false, fmt.Sprintf("Failed to request history: %v", err)
+	}
+	return true, fmt.Sprintf("Requested up to %d messages of %s before %s (%s) from the phone; they are stored as it answers, usually within a minute",
+		count, chatJID, anchor.ID, anchor.Timestamp.Format("2006-01-02 15:04"))
+}
+
+// FetchResult is the outcome of FetchOlderMessages.
+type FetchResult struct {
+	Requested  int
+	AnchorID   string // history was requested before this message
+	AnchorTime time.Time
+	Answered   bool       // the phone answered within the wait
+	Added      int        // messages of the chat that were not stored before
+	Oldest     *time.Time // oldest stored message of the chat afterwards
+}
+
+// FetchOlderMessages asks the phone for up to count messages of a chat sent
+// before the given time, or before the oldest stored message if it is zero,
+// and waits up to wait for them to be stored.
+func (c *Client) FetchOlderMessages(ctx context.Context, chatJID string, before time.Time, count int, wait time.Duration) (*FetchResult, error) {
+	if !c.IsConnected() {
+		return nil, fmt.Errorf("not connected to WhatsApp")
+	}
+	jid, err := types.ParseJID(chatJID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JID: %v", err)
+	}
+	chatJID = jid.String()
+	if count <= 0 {
+		count = DefaultHistoryRequest
+	}
+	count = min(count, MaxHistoryRequest)
+
+	var anchor *db.MessageKey
+	if before.IsZero() {
+		anchor, err = c.Store.HistoryAnchor(chatJID, "")
+	} else {
+		anchor, err = c.Store.HistoryAnchorAt(chatJID, before)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if anchor == nil {
+		return nil, fmt.Errorf("no messages of %s stored; history can only be requested before a known message", chatJID)
+	}
+	stored, err := c.Store.CountChatMessages(chatJID)
+	if err != nil {
+		return nil, err
+	}
+
+	synced, stop := c.historySync.waitChat(chatJID)
+	defer stop()
+	if err := c.requestHistoryBefore(ctx, jid, anchor, count); err != nil {
+		return nil, fmt.Errorf("request history: %w", err)
+	}
+	result := &FetchResult{Requested: count, AnchorID: anchor.ID, AnchorTime: anchor.Timestamp}
+	select {
+	case <-synced:
+		result.Answered = true
+	case <-time.After(wait):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	now, err := c.Store.CountChatMessages(chatJID)
+	if err != nil {
+		return nil, err
+	}
+	result.Added = max(now-stored, 0)
+	if oldest, err := c.Store.HistoryAnchor(chatJID, ""); err == nil && oldest != nil {
+		result.Oldest = &oldest.Timestamp
+	}
+	return result, nil
+}
+
+// requestHistoryBefore sends an on-demand history sync request for count
+// messages before anchor. The answer arrives as a history sync chunk.
+func (c *Client) requestHistoryBefore(ctx context.Context, chat types.JID, anchor *db.MessageKey, count int) error {
+	info := &types.MessageInfo{
+		MessageSource: types.MessageSource{Chat: chat, IsFromMe: anchor.IsFromMe},
+		ID:            anchor.ID,
+		Timestamp:     anchor.Timestamp,
+	}
+	ctx, done := withTimeout(ctx, c.Timeouts.Send, "requesting history")
+	_, err := c.WA.SendPeerMessage(ctx, c.WA.BuildHistorySyncRequest(info, count))
+	return done(err)
+}
@@ -0,0 +1,156 @@
+package wa
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/CSCSoftware/wahoo/db"
+
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// historySyncTimeout bounds downloading and storing one history sync chunk.
+const historySyncTimeout = 5 * time.Minute
+
+// historySyncer runs one worker at a time over the pending chunks.
+type historySyncer struct {
+	mu      sync.Mutex
+	running bool
+	again   bool                       // chunks were added while the worker ran
+	waiters map[string][]chan struct{} // by chat, closed once a chunk with the chat is stored
+}
+
+// waitChat returns a channel that is closed once the next chunk with
+// history of chatJID has been stored, and a func to stop waiting.
+func (h *historySyncer) waitChat(chatJID string) (<-chan struct{}, func()) {
+	ch := make(chan struct{})
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.waiters == nil {
+		h.waiters = make(map[string][]chan struct{})
+	}
+	h.waiters[chatJID] = append(h.waiters[chatJID], ch)
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		waiters := h.waiters[chatJID]
+		for i, w := range waiters {
+			if w == ch {
+				h.waiters[chatJID] = append(waiters[:i], waiters[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// chatSynced wakes up those waiting for history of chatJID.
+func (h *historySyncer) chatSynced(chatJID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, ch := range h.waiters[chatJID] {
+		close(ch)
+	}
+	delete(h.waiters, chatJID)
+}
+
+// queueHistorySync records a history sync chunk announced by the phone and
+// processes it. whatsmeow is told not to download chunks itself, so a chunk
+// is on record before it is processed and one interrupted by a restart is
+// processed on the next connect.
+func (c *Client) queueHistorySync(msg *events.Message, notif *waProto.HistorySyncNotification) {
+	blob, err := proto.Marshal(notif)
+	if err != nil {
+		c.Logger.Warnf("Failed to record history sync chunk %s: %v", msg.Info.ID, err)
+		return
+	}
+	err = c.Store.AddSyncChunk(db.SyncChunk{
+		ID:           msg.Info.ID,
+		SyncType:     notif.GetSyncType().String(),
+		ChunkOrder:   int(notif.GetChunkOrder()),
+		Progress:     int(notif.GetProgress()),
+		Notification: blob,
+		ReceivedAt:   msg.Info.Timestamp,
+	})
+	if err != nil {
+		c.Logger.Warnf("Failed to record history sync chunk %s: %v", msg.Info.ID, err)
+		return
+	}
+	c.resumeHistorySync()
+}
+
+// resumeHistorySync processes pending history sync chunks in the background
+// unless that is already happening.
+func (c *Client) resumeHistorySync() {
+	c.historySync.mu.Lock()
+	defer c.historySync.mu.Unlock()
+	if c.historySync.running {
+		c.historySync.again = true
+		return
+	}
+	c.historySync.running = true
+	c.goWork(func() {
+		for {
+			c.processSyncChunks()
+			c.historySync.mu.Lock()
+			if !c.historySync.again {
+				c.historySync.running = false
+				c.historySync.mu.Unlock()
+				return
+			}
+			c.historySync.again = false
+			c.historySync.mu.Unlock()
+		}
+	})
+}
+
+// processSyncChunks processes each pending chunk once, in the order they
+// were announced. Chunks that fail stay pending until MaxSyncAttempts.
+func (c *Client) processSyncChunks() {
+	chunks, err := c.Store.PendingSyncChunks()
+	if err != nil {
+		c.Logger.Warnf("Failed to list history sync chunks: %v", err)
+		return
+	}
+	for _, chunk := range chunks {
+		if !c.IsConnected() {
+			return // resumed on the next connect
+		}
+		conversations, messages, err := c.processSyncChunk(chunk)
+		if err != nil {
+			c.Logger.Warnf("Failed to process history sync chunk %s (attempt %d of %d): %v",
+				chunk.ID, chunk.Attempts+1, db.MaxSyncAttempts, err)
+			if err := c.Store.FailSyncChunk(chunk.ID, err.Error(), time.Now()); err != nil {
+				c.Logger.Warnf("Failed to record history sync chunk %s: %v", chunk.ID, err)
+			}
+			continue
+		}
+		if err := c.Store.FinishSyncChunk(chunk.ID, conversations, messages, time.Now()); err != nil {
+			c.Logger.Warnf("Failed to record history sync chunk %s: %v", chunk.ID, err)
+		}
+	}
+}
+
+func (c *Client) processSyncChunk(chunk db.SyncChunk) (conversations, messages int, err error) {
+	var notif waProto.HistorySyncNotification
+	if err := proto.Unmarshal(chunk.Notification, &notif); err != nil {
+		return 0, 0, fmt.Errorf("decode notification: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Processing history sync chunk %d (%s, %d%%)\n", chunk.ChunkOrder, chunk.SyncType, chunk.Progress)
+
+	ctx, cancel := context.WithTimeout(context.Background(), historySyncTimeout)
+	defer cancel()
+	data, err := c.WA.DownloadHistorySync(ctx, &notif, true)
+	if err != nil {
+		return 0, 0, err
+	}
+	messages, err = handleHistorySync(c, data)
+	for _, conversation := range data.GetConversations() {
+		c.historySync.chatSynced(conversation.GetID())
+	}
+	return len(data.GetConversations()), messages, err
+}
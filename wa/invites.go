@@ -0,0 +1,109 @@
+package wa
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// GroupPreview describes the group an invite link leads to.
+type GroupPreview struct {
+	JID                  string
+	Name                 string
+	Topic                string
+	OwnerJID             string // empty if unknown
+	CreatedAt            time.Time
+	ParticipantCount     int
+	Announce             bool // only admins can send messages
+	JoinApprovalRequired bool // an admin must approve new members
+}
+
+// inviteCode accepts an invite link or its bare code.
+func inviteCode(link string) (string, error) {
+	code := strings.TrimPrefix(strings.TrimSpace(link), whatsmeow.InviteLinkPrefix)
+	if code == "" || strings.ContainsAny(code, "/?# ") {
+		return "", fmt.Errorf("not a WhatsApp group invite link: %s", link)
+	}
+	return code, nil
+}
+
+// GroupInviteLink returns the invite link of a group we administer. With
+// reset set the current link is revoked and a new one returned.
+func (c *Client) GroupInviteLink(ctx context.Context, groupJID string, reset bool) (string, error) {
+	if !c.IsConnected() {
+		return "", fmt.Errorf("not connected to WhatsApp")
+	}
+	jid, err := types.ParseJID(groupJID)
+	if err != nil {
+		return "", fmt.Errorf("invalid JID: %w", err)
+	}
+	if jid.Server != types.GroupServer {
+		return "", fmt.Errorf("%s is not a group", groupJID)
+	}
+	ctx, done := withTimeout(ctx, c.Timeouts.Request, "getting the invite link")
+	link, err := c.WA.GetGroupInviteLink(ctx, jid, reset)
+	return link, done(err)
+}
+
+// PreviewGroupInvite resolves an invite link to the group it leads to
+// without joining.
+func (c *Client) PreviewGroupInvite(ctx context.Context, link string) (*GroupPreview, error) {
+	if !c.IsConnected() {
+		return nil, fmt.Errorf("not connected to WhatsApp")
+	}
+	code, err := inviteCode(link)
+	if err != nil {
+		return nil, err
+	}
+	ctx, done := withTimeout(ctx, c.Timeouts.Request, "resolving the invite link")
+	info, err := c.WA.GetGroupInfoFromLink(ctx, code)
+	if err = done(err); err != nil {
+		return nil, err
+	}
+
+	preview := &GroupPreview{
+		JID:                  info.JID.String(),
+		Name:                 info.Name,
+		Topic:                info.Topic,
+		CreatedAt:            info.GroupCreated,
+		ParticipantCount:     max(info.ParticipantCount, len(info.Participants)),
+		Announce:             info.IsAnnounce,
+		JoinApprovalRequired: info.IsJoinApprovalRequired,
+	}
+	if !info.OwnerJID.IsEmpty() {
+		preview.OwnerJID = info.OwnerJID.String()
+	}
+	return preview, nil
+}
+
+// JoinGroupWithLink joins the group an invite link leads to. Groups that
+// require approval get a join request instead.
+func (c *Client) JoinGroupWithLink(ctx context.Context, link string) (bool, string) {
+	preview, err := c.PreviewGroupInvite(ctx, link)
+	if err != nil {
+		return false, fmt.Sprintf("Failed to resolve invite link: %v", err)
+	}
+	code, _ := inviteCode(link)
+
+	joinCtx, done := withTimeout(ctx, c.Timeouts.Request, "joining the group")
+	jid, err := c.WA.JoinGroupWithLink(joinCtx, code)
+	if err = done(err); err != nil {
+		return false, fmt.Sprintf("Failed to join group: %v", err)
+	}
+	if preview.JoinApprovalRequired {
+		return true, fmt.Sprintf("Requested to join %s (%s); a group admin must approve the request", preview.Name, jid)
+	}
+
+	infoCtx, done := withTimeout(ctx, c.Timeouts.Request, "getting the group info")
+	info, err := c.WA.GetGroupInfo(infoCtx, jid)
+	if err = done(err); err == nil {
+		c.storeGroupInfo(info)
+	} else {
+		c.Logger.Warnf("Failed to fetch joined group %s: %v", jid, err)
+	}
+	return true, fmt.Sprintf("Joined group %s (%s)", preview.Name, jid)
+}
@@ -0,0 +1,70 @@
+package wa
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mau.fi/whatsmeow/appstate"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// handleLabelEvent applies WhatsApp Business label definitions and label
+// assignments synced from app state to the local database. Returns false for
+// other events.
+func handleLabelEvent(c *Client, evt interface{}) bool {
+	var err error
+	switch v := evt.(type) {
+	case *events.LabelEdit:
+		if v.Action.GetDeleted() {
+			err = c.Store.DeleteLabel(v.LabelID)
+		} else {
+			err = c.Store.StoreLabel(v.LabelID, v.Action.GetName(), int(v.Action.GetColor()),
+				int(v.Action.GetOrderIndex()), v.Timestamp)
+		}
+	case *events.LabelAssociationChat:
+		err = c.Store.SetChatLabel(v.JID.String(), v.LabelID, v.Action.GetLabeled(), v.Timestamp)
+	case *events.LabelAssociationMessage:
+		err = c.Store.SetMessageLabel(v.JID.String(), v.MessageID, v.LabelID, v.Action.GetLabeled(), v.Timestamp)
+	default:
+		return false
+	}
+	if err != nil {
+		c.Logger.Warnf("Failed to apply label change: %v", err)
+	}
+	return true
+}
+
+// SetChatLabel applies a label, given by ID or name, to a chat or removes
+// it. Labels exist on WhatsApp Business accounts only.
+func (c *Client) SetChatLabel(ctx context.Context, chatJID, label string, labeled bool) (bool, string) {
+	if !c.IsConnected() {
+		return false, "Not connected to WhatsApp"
+	}
+
+	jid, err := types.ParseJID(chatJID)
+	if err != nil {
+		return false, fmt.Sprintf("Invalid JID: %v", err)
+	}
+	l, err := c.Store.FindLabel(label)
+	if err != nil {
+		return false, err.Error()
+	}
+	if l == nil {
+		return false, fmt.Sprintf("Label %q not found (labels exist on WhatsApp Business accounts only; see list_labels)", label)
+	}
+
+	err = c.sendAppState(ctx, appstate.BuildLabelChat(jid, l.ID, labeled))
+	if err != nil {
+		return false, fmt.Sprintf("Failed to update label of chat: %v", err)
+	}
+	if err := c.Store.SetChatLabel(chatJID, l.ID, labeled, time.Now()); err != nil {
+		c.Logger.Warnf("Failed to record label locally: %v", err)
+	}
+
+	if labeled {
+		return true, fmt.Sprintf("Chat %s labeled %q", chatJID, l.Name)
+	}
+	return true, fmt.Sprintf("Label %q removed from chat %s", l.Name, chatJID)
+}
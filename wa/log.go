@@ -0,0 +1,39 @@
+package wa
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	waLog "go.mau.fi/whatsmeow/util/log"
+)
+
+var logLevels = map[string]int{"DEBUG": 0, "INFO": 1, "WARN": 2, "ERROR": 3}
+
+// stderrLogger is a waLog.Logger writing to stderr. whatsmeow's own
+// waLog.Stdout prints to stdout, which would corrupt the MCP stream.
+type stderrLogger struct {
+	mod string
+	min int
+}
+
+// newStderrLogger returns a logger for module that drops messages below minLevel.
+func newStderrLogger(module, minLevel string) waLog.Logger {
+	return &stderrLogger{mod: module, min: logLevels[strings.ToUpper(minLevel)]}
+}
+
+func (l *stderrLogger) outputf(level, msg string, args ...interface{}) {
+	if logLevels[level] < l.min {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%s [%s %s] %s\n", time.Now().Format("15:04:05.000"), l.mod, level, fmt.Sprintf(msg, args...))
+}
+
+func (l *stderrLogger) Errorf(msg string, args ...interface{}) { l.outputf("ERROR", msg, args...) }
+func (l *stderrLogger) Warnf(msg string, args ...interface{})  { l.outputf("WARN", msg, args...) }
+func (l *stderrLogger) Infof(msg string, args ...interface{})  { l.outputf("INFO", msg, args...) }
+func (l *stderrLogger) Debugf(msg string, args ...interface{}) { l.outputf("DEBUG", msg, args...) }
+func (l *stderrLogger) Sub(mod string) waLog.Logger {
+	return &stderrLogger{mod: l.mod + "/" + mod, min: l.min}
+}
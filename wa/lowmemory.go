@@ -0,0 +1,45 @@
+package wa
+
+import (
+	"runtime/debug"
+
+	waStore "go.mau.fi/whatsmeow/store"
+	"google.golang.org/protobuf/proto"
+)
+
+// Memory ceilings of low-memory mode, sized for Raspberry Pi–class hosts
+// with 512 MB to 1 GB of RAM.
+const (
+	// LowMemoryHeapLimit is the soft limit for the Go heap; the garbage
+	// collector works harder as it is approached.
+	LowMemoryHeapLimit = 192 << 20
+	// LowMemoryGCPercent makes the collector run at 50% heap growth instead of 100%.
+	LowMemoryGCPercent = 50
+	// LowMemoryDownloadWorkers bounds concurrent automatic media downloads.
+	LowMemoryDownloadWorkers = 1
+	// LowMemoryMaxAnalyzeBytes is the largest voice note loaded into memory
+	// for duration and waveform analysis; larger ones are sent without.
+	LowMemoryMaxAnalyzeBytes = 4 << 20
+	// LowMemoryMaxThumbnailPixels is the largest image decoded to generate
+	// a thumbnail for; larger images are sent without a preview.
+	LowMemoryMaxThumbnailPixels = 4_000_000
+	// History sync limits requested from the phone when pairing, which bound
+	// the size of the history blobs whatsmeow decompresses in memory.
+	lowMemoryHistoryDays    = 90
+	lowMemoryHistorySizeMB  = 100
+	lowMemoryStorageQuotaMB = 512
+)
+
+// EnableLowMemory applies the process-wide settings of low-memory mode: a soft
+// heap limit, a more eager garbage collector and smaller history syncs.
+// Stores and clients additionally need to be opened with db.Options.LowMemory.
+func EnableLowMemory() {
+	debug.SetMemoryLimit(LowMemoryHeapLimit)
+	debug.SetGCPercent(LowMemoryGCPercent)
+
+	cfg := waStore.DeviceProps.HistorySyncConfig
+	cfg.FullSyncDaysLimit = proto.Uint32(lowMemoryHistoryDays)
+	cfg.RecentSyncDaysLimit = proto.Uint32(lowMemoryHistoryDays)
+	cfg.FullSyncSizeMbLimit = proto.Uint32(lowMemoryHistorySizeMB)
+	cfg.StorageQuotaMb = proto.Uint32(lowMemoryStorageQuotaMB)
+}
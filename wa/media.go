@@ -7,10 +7,14 @@ import (
 	"fmt"
 	"math"
 	"math/rand"
+	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
+
+	"github.com/CSCSoftware/wahoo/db"
 
 	"go.mau.fi/whatsmeow"
 	waProto "go.mau.fi/whatsmeow/binary/proto"
@@ -18,30 +22,87 @@ import (
 	"google.golang.org/protobuf/proto"
 )
 
-// SendMessage sends a text message to a recipient.
-func (c *Client) SendMessage(recipient, message string) (bool, string) {
+// SendMessage sends a text message to a recipient, @-mentioning the given
+// phone numbers or JIDs (see resolveMentions).
+// Unless force is set, the duplicate guard may refuse (or warn about) a text
+// that was already sent to the same recipient within its window.
+// Every attempt is tracked in the sends table; failed sends are retried by the outbox worker.
+// While disconnected the text is queued in the outbox instead and sent on
+// reconnect; queued reports this.
+func (c *Client) SendMessage(ctx context.Context, recipient, message string, mentions []string, force bool) (success, queued bool, msg string) {
+	jid, err := parseRecipient(recipient)
+	if err != nil {
+		return false, false, err.Error()
+	}
+	message, mentions, err = resolveMentions(message, mentions)
+	if err != nil {
+		return false, false, err.Error()
+	}
+
+	var warning string
+	if dup, age := c.DupGuard.Check(jid.String(), message); dup && !force {
+		if c.DupGuard.Refuse {
+			return false, false, fmt.Sprintf("Identical message already sent to %s %s ago; not sending again (use force=true to override)",
+				recipient, age.Round(time.Second))
+		}
+		warning = fmt.Sprintf(" (warning: identical message was already sent %s ago)", age.Round(time.Second))
+	}
+
+	note, ok := c.allowSend(jid)
+	if !ok {
+		return false, false, note
+	}
+	warning = note + warning
+
 	if !c.IsConnected() {
-		return false, "Not connected to WhatsApp"
+		sendID, err := c.Store.RecordSend(jid.String(), message, mentions, db.SendQueued)
+		if err != nil {
+			return false, false, fmt.Sprintf("Not connected to WhatsApp, and queueing the message failed: %v", err)
+		}
+		noteSendAttempt(ctx)
+		return true, true, fmt.Sprintf("Not connected to WhatsApp: message to %s queued as send ID %d and sent on reconnect%s",
+			recipient, sendID, warning)
 	}
 
-	jid, err := parseRecipient(recipient)
+	if err := c.paceSend(ctx, jid, message); err != nil {
+		return false, false, fmt.Sprintf("Message to %s not sent: %v", recipient, err)
+	}
+
+	sendID, err := c.Store.RecordSend(jid.String(), message, mentions, db.SendPending)
 	if err != nil {
-		return false, err.Error()
+		c.Logger.Warnf("Failed to record send: %v", err)
 	}
 
-	msg := &waProto.Message{
-		Conversation: proto.String(message),
+	if err := c.attemptSend(ctx, sendID, 0, jid.String(), message, mentions); err != nil {
+		if sendID == 0 {
+			return false, false, fmt.Sprintf("Error sending message: %v%s", err, c.healthWarning())
+		}
+		if IsTimeout(err) {
+			return false, false, fmt.Sprintf("Error sending message: %v (send ID %d, may have been delivered, so it is not retried)%s",
+				err, sendID, c.healthWarning())
+		}
+		return false, false, fmt.Sprintf("Error sending message: %v (send ID %d, will be retried)%s", err, sendID, c.healthWarning())
 	}
+	if sendID == 0 {
+		return true, false, fmt.Sprintf("Message sent to %s%s%s", recipient, warning, c.healthWarning())
+	}
+	return true, false, fmt.Sprintf("Message sent to %s (send ID %d)%s%s", recipient, sendID, warning, c.healthWarning())
+}
 
-	_, err = c.WA.SendMessage(context.Background(), jid, msg)
+// SendMedia sends a file (image, video, document) to a recipient.
+// mimeOverride forces the content type; if empty it is detected from the
+// file extension, falling back to content sniffing. The file must lie in an
+// allowed media directory.
+func (c *Client) SendMedia(ctx context.Context, recipient, mediaPath, caption, mimeOverride string) (bool, string) {
+	path, err := c.allowedMediaPath(mediaPath)
 	if err != nil {
-		return false, fmt.Sprintf("Error sending message: %v", err)
+		return false, fmt.Sprintf("Error: %v", err)
 	}
-	return true, fmt.Sprintf("Message sent to %s", recipient)
+	return c.sendMedia(ctx, recipient, path, caption, mimeOverride)
 }
 
-// SendMedia sends a file (image, video, document) to a recipient.
-func (c *Client) SendMedia(recipient, mediaPath, caption string) (bool, string) {
+// sendMedia sends a file without checking it against the media allowlist.
+func (c *Client) sendMedia(ctx context.Context, recipient, mediaPath, caption, mimeOverride string) (bool, string) {
 	if !c.IsConnected() {
 		return false, "Not connected to WhatsApp"
 	}
@@ -51,44 +112,34 @@ func (c *Client) SendMedia(recipient, mediaPath, caption string) (bool, string)
 		return false, err.Error()
 	}
 
-	mediaData, err := os.ReadFile(mediaPath)
-	if err != nil {
-		return false, fmt.Sprintf("Error reading media file: %v", err)
+	note, ok := c.allowSend(jid)
+	if !ok {
+		return false, note
 	}
 
-	fileExt := strings.ToLower(filepath.Ext(mediaPath))
-	if fileExt != "" {
-		fileExt = fileExt[1:] // remove dot
+	msg, _, err := c.buildMediaMessage(ctx, mediaPath, caption, mimeOverride)
+	if err != nil {
+		return false, fmt.Sprintf("Error %v", err)
 	}
 
-	var mediaType whatsmeow.MediaType
-	var mimeType string
-
-	switch fileExt {
-	case "jpg", "jpeg":
-		mediaType, mimeType = whatsmeow.MediaImage, "image/jpeg"
-	case "png":
-		mediaType, mimeType = whatsmeow.MediaImage, "image/png"
-	case "gif":
-		mediaType, mimeType = whatsmeow.MediaImage, "image/gif"
-	case "webp":
-		mediaType, mimeType = whatsmeow.MediaImage, "image/webp"
-	case "ogg":
-		mediaType, mimeType = whatsmeow.MediaAudio, "audio/ogg; codecs=opus"
-	case "mp4":
-		mediaType, mimeType = whatsmeow.MediaVideo, "video/mp4"
-	case "avi":
-		mediaType, mimeType = whatsmeow.MediaVideo, "video/avi"
-	case "mov":
-		mediaType, mimeType = whatsmeow.MediaVideo, "video/quicktime"
-	default:
-		mediaType, mimeType = whatsmeow.MediaDocument, "application/octet-stream"
+	sent, err := c.sendTracked(ctx, jid, msg)
+	if err != nil {
+		return false, fmt.Sprintf("Error sending media: %v%s", err, c.healthWarning())
 	}
+	if err := c.archiveMedia(sent.ID, jid.String(), mediaPath); err != nil {
+		c.Logger.Warnf("%v", err)
+	}
+	return true, fmt.Sprintf("Media sent to %s%s%s", recipient, note, c.healthWarning())
+}
 
-	resp, err := c.WA.Upload(context.Background(), mediaData, mediaType)
+// buildMediaMessage uploads a file and returns the message that sends it,
+// with its WhatsApp media type.
+func (c *Client) buildMediaMessage(ctx context.Context, mediaPath, caption, mimeOverride string) (*waProto.Message, whatsmeow.MediaType, error) {
+	upload, err := c.uploadFile(ctx, mediaPath, mimeOverride)
 	if err != nil {
-		return false, fmt.Sprintf("Error uploading media: %v", err)
+		return nil, "", err
 	}
+	mediaType, mimeType, resp := upload.Type, upload.MimeType, upload.Resp
 
 	msg := &waProto.Message{}
 	switch mediaType {
@@ -103,14 +154,28 @@ func (c *Client) SendMedia(recipient, mediaPath, caption string) (bool, string)
 			FileSHA256:    resp.FileSHA256,
 			FileLength:    &resp.FileLength,
 		}
+		if thumb, w, h, err := c.imagePreview(upload, mediaPath); err == nil {
+			msg.ImageMessage.JPEGThumbnail = thumb
+			msg.ImageMessage.Width, msg.ImageMessage.Height = proto.Uint32(w), proto.Uint32(h)
+		} else {
+			c.Logger.Debugf("No thumbnail for %s: %v", mediaPath, err)
+		}
 	case whatsmeow.MediaAudio:
 		var seconds uint32 = 30
 		var waveform []byte
 		if strings.Contains(mimeType, "ogg") {
-			if s, w, err := analyzeOggOpus(mediaData); err == nil {
-				seconds, waveform = s, w
+			if data := upload.fullData(mediaPath); data != nil {
+				if s, w, err := analyzeOggOpus(data); err == nil {
+					seconds, waveform = s, w
+				}
 			}
 		}
+		// Prefer the waveform of the real audio to the synthetic one
+		if w, err := audioWaveform(mediaPath); err == nil {
+			waveform = w
+		} else {
+			c.Logger.Debugf("No waveform for %s: %v", mediaPath, err)
+		}
 		msg.AudioMessage = &waProto.AudioMessage{
 			Mimetype:      proto.String(mimeType),
 			URL:           &resp.URL,
@@ -134,6 +199,24 @@ func (c *Client) SendMedia(recipient, mediaPath, caption string) (bool, string)
 			FileSHA256:    resp.FileSHA256,
 			FileLength:    &resp.FileLength,
 		}
+		info, probeErr := probeVideo(mediaPath)
+		if probeErr == nil {
+			msg.VideoMessage.Seconds = proto.Uint32(info.Seconds)
+			if info.Width > 0 && info.Height > 0 {
+				msg.VideoMessage.Width, msg.VideoMessage.Height = proto.Uint32(info.Width), proto.Uint32(info.Height)
+			}
+		} else {
+			c.Logger.Debugf("Could not probe %s: %v", mediaPath, probeErr)
+		}
+		if thumb, w, h, err := videoPreview(mediaPath); err == nil {
+			msg.VideoMessage.JPEGThumbnail = thumb
+			// Fall back to the frame size if probing found none
+			if msg.VideoMessage.Width == nil {
+				msg.VideoMessage.Width, msg.VideoMessage.Height = proto.Uint32(w), proto.Uint32(h)
+			}
+		} else {
+			c.Logger.Debugf("No thumbnail for %s: %v", mediaPath, err)
+		}
 	case whatsmeow.MediaDocument:
 		msg.DocumentMessage = &waProto.DocumentMessage{
 			Title:         proto.String(filepath.Base(mediaPath)),
@@ -148,61 +231,282 @@ func (c *Client) SendMedia(recipient, mediaPath, caption string) (bool, string)
 		}
 	}
 
-	_, err = c.WA.SendMessage(context.Background(), jid, msg)
-	if err != nil {
-		return false, fmt.Sprintf("Error sending media: %v", err)
-	}
-	return true, fmt.Sprintf("Media sent to %s", recipient)
+	return msg, mediaType, nil
 }
 
 // SendAudioMessage sends an audio file as a voice message, converting to OGG Opus if needed.
-func (c *Client) SendAudioMessage(recipient, mediaPath string) (bool, string) {
+func (c *Client) SendAudioMessage(ctx context.Context, recipient, mediaPath string) (bool, string) {
 	if !c.IsConnected() {
 		return false, "Not connected to WhatsApp"
 	}
 
+	mediaPath, err := c.allowedMediaPath(mediaPath)
+	if err != nil {
+		return false, fmt.Sprintf("Error: %v", err)
+	}
+
 	// Convert to OGG Opus if not already
 	if !strings.HasSuffix(strings.ToLower(mediaPath), ".ogg") {
 		converted, err := convertToOpusOgg(mediaPath)
 		if err != nil {
-			return false, fmt.Sprintf("Error converting to Opus OGG (ffmpeg needed): %v", err)
+			return false, fmt.Sprintf("Error converting to Opus OGG: %v", err)
 		}
 		mediaPath = converted
 		defer os.Remove(converted)
 	}
 
-	return c.SendMedia(recipient, mediaPath, "")
+	return c.sendMedia(ctx, recipient, mediaPath, "", "")
 }
 
-// DownloadMedia downloads media from a message and saves it to disk.
-func (c *Client) DownloadMedia(messageID, chatJID string) (string, error) {
+// stickerSize is the width and height WhatsApp expects for sticker images.
+const stickerSize = 512
+
+// SendSticker sends an image as a sticker. PNG/JPEG input is converted to a
+// 512x512 WebP with ffmpeg; WebP input is sent as-is.
+func (c *Client) SendSticker(ctx context.Context, recipient, mediaPath string) (bool, string) {
 	if !c.IsConnected() {
-		return "", fmt.Errorf("not connected to WhatsApp")
+		return false, "Not connected to WhatsApp"
+	}
+
+	jid, err := parseRecipient(recipient)
+	if err != nil {
+		return false, err.Error()
+	}
+
+	mediaPath, err = c.allowedMediaPath(mediaPath)
+	if err != nil {
+		return false, fmt.Sprintf("Error: %v", err)
+	}
+
+	note, ok := c.allowSend(jid)
+	if !ok {
+		return false, note
+	}
+
+	if !strings.HasSuffix(strings.ToLower(mediaPath), ".webp") {
+		converted, err := convertToStickerWebP(mediaPath)
+		if err != nil {
+			return false, fmt.Sprintf("Error converting to WebP (ffmpeg needed): %v", err)
+		}
+		mediaPath = converted
+		defer os.Remove(converted)
+	}
+
+	data, err := os.ReadFile(mediaPath)
+	if err != nil {
+		return false, fmt.Sprintf("Error reading sticker file: %v", err)
+	}
+
+	resp, err := c.uploadWithRetry(ctx, "upload", func(ctx context.Context) (whatsmeow.UploadResponse, error) {
+		return c.WA.Upload(ctx, data, whatsmeow.MediaImage)
+	})
+	if err != nil {
+		return false, fmt.Sprintf("Error uploading sticker: %v", err)
+	}
+
+	msg := &waProto.Message{
+		StickerMessage: &waProto.StickerMessage{
+			Mimetype:      proto.String("image/webp"),
+			URL:           &resp.URL,
+			DirectPath:    &resp.DirectPath,
+			MediaKey:      resp.MediaKey,
+			FileEncSHA256: resp.FileEncSHA256,
+			FileSHA256:    resp.FileSHA256,
+			FileLength:    &resp.FileLength,
+			Width:         proto.Uint32(stickerSize),
+			Height:        proto.Uint32(stickerSize),
+		},
+	}
+
+	sent, err := c.sendTracked(ctx, jid, msg)
+	if err != nil {
+		return false, fmt.Sprintf("Error sending sticker: %v%s", err, c.healthWarning())
+	}
+	if err := c.archiveMedia(sent.ID, jid.String(), mediaPath); err != nil {
+		c.Logger.Warnf("%v", err)
+	}
+	return true, fmt.Sprintf("Sticker sent to %s%s%s", recipient, note, c.healthWarning())
+}
+
+// SendGIF sends an animated GIF, which WhatsApp plays as a looping, silent
+// video. GIF files are converted to MP4 with ffmpeg; MP4 input is sent as-is.
+func (c *Client) SendGIF(ctx context.Context, recipient, mediaPath, caption string) (bool, string) {
+	if !c.IsConnected() {
+		return false, "Not connected to WhatsApp"
+	}
+
+	jid, err := parseRecipient(recipient)
+	if err != nil {
+		return false, err.Error()
+	}
+
+	mediaPath, err = c.allowedMediaPath(mediaPath)
+	if err != nil {
+		return false, fmt.Sprintf("Error: %v", err)
+	}
+
+	note, ok := c.allowSend(jid)
+	if !ok {
+		return false, note
+	}
+
+	if !strings.HasSuffix(strings.ToLower(mediaPath), ".mp4") {
+		converted, err := convertGIFToMP4(mediaPath)
+		if err != nil {
+			return false, fmt.Sprintf("Error converting to MP4 (ffmpeg needed): %v", err)
+		}
+		mediaPath = converted
+		defer os.Remove(converted)
+	}
+
+	msg, _, err := c.buildMediaMessage(ctx, mediaPath, caption, "video/mp4")
+	if err != nil {
+		return false, fmt.Sprintf("Error %v", err)
 	}
+	msg.VideoMessage.GifPlayback = proto.Bool(true)
 
+	sent, err := c.sendTracked(ctx, jid, msg)
+	if err != nil {
+		return false, fmt.Sprintf("Error sending GIF: %v%s", err, c.healthWarning())
+	}
+	if err := c.archiveMedia(sent.ID, jid.String(), mediaPath); err != nil {
+		c.Logger.Warnf("%v", err)
+	}
+	return true, fmt.Sprintf("GIF sent to %s%s%s", recipient, note, c.healthWarning())
+}
+
+// SendLocation sends a location pin. name and address are optional.
+func (c *Client) SendLocation(ctx context.Context, recipient string, latitude, longitude float64, name, address string) (bool, string) {
+	if !c.IsConnected() {
+		return false, "Not connected to WhatsApp"
+	}
+	if latitude < -90 || latitude > 90 || longitude < -180 || longitude > 180 {
+		return false, "Latitude must be between -90 and 90, longitude between -180 and 180"
+	}
+
+	jid, err := parseRecipient(recipient)
+	if err != nil {
+		return false, err.Error()
+	}
+
+	note, ok := c.allowSend(jid)
+	if !ok {
+		return false, note
+	}
+
+	loc := &waProto.LocationMessage{
+		DegreesLatitude:  proto.Float64(latitude),
+		DegreesLongitude: proto.Float64(longitude),
+	}
+	if name != "" {
+		loc.Name = proto.String(name)
+	}
+	if address != "" {
+		loc.Address = proto.String(address)
+	}
+
+	_, err = c.sendTracked(ctx, jid, &waProto.Message{LocationMessage: loc})
+	if err != nil {
+		return false, fmt.Sprintf("Error sending location: %v%s", err, c.healthWarning())
+	}
+	return true, fmt.Sprintf("Location sent to %s%s%s", recipient, note, c.healthWarning())
+}
+
+// DownloadMedia downloads media from a message and saves it to disk.
+func (c *Client) DownloadMedia(ctx context.Context, messageID, chatJID string) (string, error) {
 	url, mediaKey, fileSHA256, fileEncSHA256, fileLength, mediaType, filename, err := c.Store.GetMediaInfo(messageID, chatJID)
 	if err != nil {
 		return "", fmt.Errorf("failed to find message: %w", err)
 	}
 
-	if mediaType == "" {
+	if mediaType == "" || mediaType == "location" || mediaType == "live_location" {
 		return "", fmt.Errorf("not a media message")
 	}
+	if viewOnce, _, err := c.Store.ViewOnceState(messageID, chatJID); err != nil {
+		return "", err
+	} else if viewOnce {
+		return "", fmt.Errorf("message %s is view-once media, which can only be downloaded once with acknowledge_view_once=true", messageID)
+	}
+	return c.downloadMedia(ctx, messageID, chatJID, url, mediaKey, fileSHA256, fileEncSHA256, fileLength, mediaType, filename)
+}
 
-	// Create download directory
-	chatDir := filepath.Join(c.StoreDir, strings.ReplaceAll(chatJID, ":", "_"))
-	if err := os.MkdirAll(chatDir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create directory: %w", err)
+// DownloadViewOnceMedia downloads view-once media and records it as viewed.
+// It can be downloaded only once; other media is downloaded as by
+// DownloadMedia.
+func (c *Client) DownloadViewOnceMedia(ctx context.Context, messageID, chatJID string) (string, error) {
+	viewOnce, viewedAt, err := c.Store.ViewOnceState(messageID, chatJID)
+	if err != nil {
+		return "", err
+	}
+	if !viewOnce {
+		return c.DownloadMedia(ctx, messageID, chatJID)
+	}
+	if viewedAt != nil {
+		return "", fmt.Errorf("view-once media of message %s was already viewed at %s", messageID, *viewedAt)
 	}
 
-	localPath := filepath.Join(chatDir, filename)
-	absPath, _ := filepath.Abs(localPath)
+	url, mediaKey, fileSHA256, fileEncSHA256, fileLength, mediaType, filename, err := c.Store.GetMediaInfo(messageID, chatJID)
+	if err != nil {
+		return "", fmt.Errorf("failed to find message: %w", err)
+	}
+	// A failed download does not use up the single view
+	path, err := c.downloadMedia(ctx, messageID, chatJID, url, mediaKey, fileSHA256, fileEncSHA256, fileLength, mediaType, filename)
+	if err != nil {
+		return "", err
+	}
+	if ok, err := c.Store.MarkViewOnceViewed(messageID, chatJID, time.Now()); err != nil {
+		return "", err
+	} else if !ok {
+		return "", fmt.Errorf("view-once media of message %s was already viewed", messageID)
+	}
+	return path, nil
+}
 
+// downloadMedia downloads a media message's file into the media directory,
+// or returns the file downloaded before.
+func (c *Client) downloadMedia(ctx context.Context, messageID, chatJID, url string, mediaKey, fileSHA256, fileEncSHA256 []byte, fileLength uint64, mediaType, filename string) (string, error) {
 	// Check if already downloaded
-	if _, err := os.Stat(localPath); err == nil {
-		return absPath, nil
+	if path := c.Store.MediaLocalPath(messageID, chatJID); path != "" {
+		if _, err := os.Stat(path); err == nil {
+			if MediaThumbnail(path) == "" {
+				c.saveThumbnail(path, mediaType)
+			}
+			return path, nil
+		}
+	}
+
+	// Create download directory; the chat JID and filename come from the
+	// message and must not escape the media directory
+	chatDir := filepath.Join(c.MediaDir(), sanitizeFilename(chatJID, "unknown"))
+	if err := os.MkdirAll(chatDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory: %w", err)
+	}
+	name := sanitizeFilename(filename, mediaType+"_"+sanitizeFilename(messageID, "media"))
+	if !withinDir(chatDir, filepath.Join(chatDir, name)) {
+		return "", fmt.Errorf("invalid media filename %q", filename)
+	}
+
+	// Media cleaned up from disk comes back from the archive, which keeps
+	// it after WhatsApp's copy has expired
+	path, err := c.restoreMedia(messageID, chatJID, chatDir, name)
+	if err == nil && path != "" {
+		if err = verifyMediaSHA256(path, fileSHA256); err != nil {
+			os.Remove(path)
+		}
+	}
+	if err != nil {
+		c.Logger.Warnf("Failed to restore archived media: %v", err)
+	} else if path != "" {
+		if err := c.Store.SetMediaLocalPath(messageID, chatJID, path); err != nil {
+			c.Logger.Warnf("Failed to record local path: %v", err)
+		}
+		c.saveThumbnail(path, mediaType)
+		return path, nil
 	}
 
+	if !c.IsConnected() {
+		return "", fmt.Errorf("not connected to WhatsApp")
+	}
 	// Need all media info to download
 	if url == "" || len(mediaKey) == 0 {
 		return "", fmt.Errorf("incomplete media information")
@@ -211,9 +515,9 @@ func (c *Client) DownloadMedia(messageID, chatJID string) (string, error) {
 	// Map media type string to whatsmeow type
 	var waMediaType whatsmeow.MediaType
 	switch mediaType {
-	case "image":
+	case "image", "sticker":
 		waMediaType = whatsmeow.MediaImage
-	case "video":
+	case "video", "gif":
 		waMediaType = whatsmeow.MediaVideo
 	case "audio":
 		waMediaType = whatsmeow.MediaAudio
@@ -235,15 +539,37 @@ func (c *Client) DownloadMedia(messageID, chatJID string) (string, error) {
 		MediaType:     waMediaType,
 	}
 
-	data, err := c.WA.Download(context.Background(), downloader)
+	// Documents often share names, so other files of the chat are kept
+	localPath, err := reserveFilename(chatDir, name)
 	if err != nil {
-		return "", fmt.Errorf("download failed: %w", err)
+		return "", fmt.Errorf("failed to create file: %w", err)
 	}
+	absPath, _ := filepath.Abs(localPath)
 
-	if err := os.WriteFile(localPath, data, 0644); err != nil {
-		return "", fmt.Errorf("failed to save file: %w", err)
+	if err := c.downloadToPath(ctx, downloader, localPath); err != nil {
+		os.Remove(localPath)
+		if isMediaExpired(err) {
+			if err := c.requestMediaRetry(ctx, messageID, chatJID, mediaKey); err != nil {
+				return "", fmt.Errorf("media expired on WhatsApp's servers, and requesting a re-upload failed: %w", err)
+			}
+			return "", ErrMediaExpired
+		}
+		return "", err
+	}
+	if err := verifyMediaSHA256(localPath, fileSHA256); err != nil {
+		os.Remove(localPath)
+		return "", err
 	}
 
+	if err := c.Store.SetMediaLocalPath(messageID, chatJID, absPath); err != nil {
+		c.Logger.Warnf("Failed to record local path: %v", err)
+	}
+	if _, err := c.saveThumbnail(absPath, mediaType); err != nil {
+		c.Logger.Debugf("No thumbnail for %s: %v", absPath, err)
+	}
+	if err := c.archiveMedia(messageID, chatJID, absPath); err != nil {
+		c.Logger.Warnf("%v", err)
+	}
 	return absPath, nil
 }
 
@@ -266,6 +592,66 @@ func (d *MediaDownloader) GetFileSHA256() []byte          { return d.FileSHA256
 func (d *MediaDownloader) GetFileEncSHA256() []byte       { return d.FileEncSHA256 }
 func (d *MediaDownloader) GetMediaType() whatsmeow.MediaType { return d.MediaType }
 
+// detectMediaType determines the WhatsApp media type and MIME type of a file.
+// An explicit override wins; otherwise the extension is used, and files with
+// unknown or missing extensions are sniffed with http.DetectContentType.
+func detectMediaType(mediaPath string, data []byte, override string) (whatsmeow.MediaType, string) {
+	if override != "" {
+		return mediaTypeForMime(override), override
+	}
+
+	fileExt := strings.ToLower(filepath.Ext(mediaPath))
+	if fileExt != "" {
+		fileExt = fileExt[1:] // remove dot
+	}
+
+	switch fileExt {
+	case "jpg", "jpeg":
+		return whatsmeow.MediaImage, "image/jpeg"
+	case "png":
+		return whatsmeow.MediaImage, "image/png"
+	case "gif":
+		return whatsmeow.MediaImage, "image/gif"
+	case "webp":
+		return whatsmeow.MediaImage, "image/webp"
+	case "ogg":
+		return whatsmeow.MediaAudio, "audio/ogg; codecs=opus"
+	case "mp4":
+		return whatsmeow.MediaVideo, "video/mp4"
+	case "avi":
+		return whatsmeow.MediaVideo, "video/avi"
+	case "mov":
+		return whatsmeow.MediaVideo, "video/quicktime"
+	}
+
+	sniffed := http.DetectContentType(data)
+	if idx := strings.Index(sniffed, ";"); idx > 0 {
+		sniffed = sniffed[:idx]
+	}
+	switch sniffed {
+	case "application/ogg":
+		// Ogg containers sent by us are treated as Opus voice notes
+		return whatsmeow.MediaAudio, "audio/ogg; codecs=opus"
+	case "application/octet-stream", "text/plain":
+		return whatsmeow.MediaDocument, "application/octet-stream"
+	}
+	return mediaTypeForMime(sniffed), sniffed
+}
+
+// mediaTypeForMime maps a MIME type to the WhatsApp media type used for upload.
+func mediaTypeForMime(mimeType string) whatsmeow.MediaType {
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		return whatsmeow.MediaImage
+	case strings.HasPrefix(mimeType, "audio/"):
+		return whatsmeow.MediaAudio
+	case strings.HasPrefix(mimeType, "video/"):
+		return whatsmeow.MediaVideo
+	default:
+		return whatsmeow.MediaDocument
+	}
+}
+
 // parseRecipient parses a phone number or JID string into a types.JID.
 func parseRecipient(recipient string) (types.JID, error) {
 	if strings.Contains(recipient, "@") {
@@ -284,8 +670,12 @@ func extractDirectPathFromURL(url string) string {
 	return "/" + pathPart
 }
 
-// convertToOpusOgg converts any audio file to OGG Opus using ffmpeg.
+// convertToOpusOgg converts any audio file to OGG Opus using ffmpeg. Without
+// ffmpeg, builds with the opusenc tag convert WAV files in-process.
 func convertToOpusOgg(inputPath string) (string, error) {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		return encodeOpusOgg(inputPath)
+	}
 	outPath := inputPath + ".ogg"
 	cmd := exec.Command("ffmpeg", "-y", "-i", inputPath,
 		"-c:a", "libopus", "-b:a", "32k", "-vn", outPath)
@@ -296,6 +686,33 @@ func convertToOpusOgg(inputPath string) (string, error) {
 	return outPath, nil
 }
 
+// convertToStickerWebP scales an image to fit a transparent 512x512 canvas and encodes it as WebP using ffmpeg.
+func convertToStickerWebP(inputPath string) (string, error) {
+	outPath := inputPath + ".webp"
+	filter := fmt.Sprintf("format=rgba,scale=%[1]d:%[1]d:force_original_aspect_ratio=decrease,pad=%[1]d:%[1]d:(ow-iw)/2:(oh-ih)/2:color=black@0", stickerSize)
+	cmd := exec.Command("ffmpeg", "-y", "-i", inputPath,
+		"-vf", filter, "-c:v", "libwebp", "-quality", "80", "-frames:v", "1", outPath)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("ffmpeg conversion failed: %w", err)
+	}
+	return outPath, nil
+}
+
+// convertGIFToMP4 converts an animated GIF to a silent H.264 MP4 that plays
+// on all WhatsApp clients, which need even frame dimensions.
+func convertGIFToMP4(inputPath string) (string, error) {
+	outPath := inputPath + ".mp4"
+	cmd := exec.Command("ffmpeg", "-y", "-i", inputPath,
+		"-vf", "scale=trunc(iw/2)*2:trunc(ih/2)*2", "-c:v", "libx264", "-pix_fmt", "yuv420p",
+		"-movflags", "+faststart", "-an", outPath)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("ffmpeg conversion failed: %w", err)
+	}
+	return outPath, nil
+}
+
 // analyzeOggOpus extracts duration and generates a waveform from an Ogg Opus file.
 func analyzeOggOpus(data []byte) (duration uint32, waveform []byte, err error) {
 	if len(data) < 4 || string(data[0:4]) != "OggS" {
@@ -366,7 +783,8 @@ func analyzeOggOpus(data []byte) (duration uint32, waveform []byte, err error) {
 	return duration, waveform, nil
 }
 
-// placeholderWaveform generates a synthetic waveform for voice messages.
+// placeholderWaveform generates a synthetic waveform for voice messages, used
+// when the audio cannot be decoded.
 func placeholderWaveform(duration uint32) []byte {
 	const waveformLength = 64
 	waveform := make([]byte, waveformLength)
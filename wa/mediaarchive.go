@@ -0,0 +1,134 @@
+package wa
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/CSCSoftware/wahoo/db"
+)
+
+// mediaArchiveTimeout bounds uploading or restoring one media file.
+const mediaArchiveTimeout = 10 * time.Minute
+
+// MediaArchive keeps durable copies of media files off the local disk.
+type MediaArchive interface {
+	Name() string
+	// Put uploads the file at path as key and returns the object's URL.
+	Put(ctx context.Context, key, path, contentType string) (string, error)
+	// PresignGet returns a URL the object can be downloaded from without
+	// credentials until it expires.
+	PresignGet(key string, expires time.Duration) (string, error)
+}
+
+// mediaObjectKey names the archived copy of a message's media:
+// <account>/<chat>/<message ID>/<file name>.
+func (c *Client) mediaObjectKey(messageID, chatJID, path string) string {
+	account := c.AccountName
+	if account == "" {
+		account = DefaultAccount
+	}
+	return account + "/" + sanitizeFilename(chatJID, "unknown") + "/" +
+		sanitizeFilename(messageID, "media") + "/" + sanitizeFilename(filepath.Base(path), "media")
+}
+
+// archiveMedia uploads a message's media file to the media archive and
+// records the copy. Without an archive it does nothing.
+func (c *Client) archiveMedia(messageID, chatJID, path string) error {
+	if c.MediaArchive == nil {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), mediaArchiveTimeout)
+	defer cancel()
+	key := c.mediaObjectKey(messageID, chatJID, path)
+	url, err := c.MediaArchive.Put(ctx, key, path, mime.TypeByExtension(filepath.Ext(path)))
+	if err != nil {
+		return fmt.Errorf("archive media of %s: %w", messageID, err)
+	}
+	return c.Store.SetMediaObject(db.MediaObject{
+		MessageID:  messageID,
+		ChatJID:    chatJID,
+		Key:        key,
+		URL:        url,
+		Size:       info.Size(),
+		UploadedAt: time.Now(),
+	})
+}
+
+// restoreMedia downloads the archived copy of a message's media into a new
+// file named like name in dir. Returns "" if there is none.
+func (c *Client) restoreMedia(messageID, chatJID, dir, name string) (string, error) {
+	if c.MediaArchive == nil {
+		return "", nil
+	}
+	obj, err := c.Store.GetMediaObject(messageID, chatJID)
+	if err != nil || obj == nil {
+		return "", err
+	}
+	url, err := c.MediaArchive.PresignGet(obj.Key, mediaArchiveTimeout)
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), mediaArchiveTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("restore media of %s: %w", messageID, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("restore media of %s: archive returned %s", messageID, resp.Status)
+	}
+
+	path, err := reserveFilename(dir, name)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		f.Close()
+		os.Remove(path)
+		return "", fmt.Errorf("restore media of %s: %w", messageID, err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return filepath.Abs(path)
+}
+
+// MediaURL returns a presigned URL of the archived copy of a message's
+// media, valid for MediaURLExpiry, and when it expires.
+func (c *Client) MediaURL(messageID, chatJID string) (string, time.Time, error) {
+	if c.MediaArchive == nil {
+		return "", time.Time{}, fmt.Errorf("no media archive configured")
+	}
+	obj, err := c.Store.GetMediaObject(messageID, chatJID)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if obj == nil {
+		return "", time.Time{}, fmt.Errorf("media of message %s is not archived", messageID)
+	}
+	url, err := c.MediaArchive.PresignGet(obj.Key, c.MediaURLExpiry)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return url, time.Now().Add(c.MediaURLExpiry), nil
+}
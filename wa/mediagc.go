@@ -0,0 +1,246 @@
+package wa
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// mediaCleanupInterval is how often StartMediaCleanup enforces the quota.
+const mediaCleanupInterval = time.Hour
+
+// MediaQuota limits the disk space taken by downloaded media. Files are
+// pruned oldest download first.
+type MediaQuota struct {
+	MaxBytes int64         // total size of the media directory; 0 = unlimited
+	MaxAge   time.Duration // time since download; 0 = keep forever
+}
+
+// Enabled reports whether the quota sets any limit.
+func (q MediaQuota) Enabled() bool {
+	return q.MaxBytes > 0 || q.MaxAge > 0
+}
+
+func (q MediaQuota) String() string {
+	var limits []string
+	if q.MaxBytes > 0 {
+		limits = append(limits, fmt.Sprintf("max %d MB", q.MaxBytes>>20))
+	}
+	if q.MaxAge > 0 {
+		limits = append(limits, fmt.Sprintf("max %d days", int(q.MaxAge.Hours()/24)))
+	}
+	return strings.Join(limits, ", ")
+}
+
+// MediaCleanup is the result of a media cleanup run.
+type MediaCleanup struct {
+	FilesDeleted   int
+	BytesFreed     int64
+	BytesRemaining int64
+}
+
+// mediaFile is a downloaded media file together with its thumbnail.
+type mediaFile struct {
+	path    string
+	chatDir string
+	size    int64 // including the thumbnail
+	modTime time.Time
+}
+
+// mediaFiles lists the downloaded media files, oldest first. Thumbnails are
+// counted with the file they belong to. Paths are absolute, like the ones
+// DownloadMedia records.
+func (c *Client) mediaFiles() ([]mediaFile, error) {
+	root, err := filepath.Abs(c.MediaDir())
+	if err != nil {
+		return nil, err
+	}
+	var files []mediaFile
+	thumbSizes := make(map[string]int64)
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root && errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if media, ok := strings.CutSuffix(path, thumbnailSuffix); ok {
+			thumbSizes[media] = info.Size()
+			return nil
+		}
+		rel, _ := filepath.Rel(root, path)
+		files = append(files, mediaFile{
+			path:    path,
+			chatDir: filepath.Dir(rel),
+			size:    info.Size(),
+			modTime: info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range files {
+		files[i].size += thumbSizes[files[i].path]
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	return files, nil
+}
+
+// CleanupMedia deletes downloaded media older than the quota's MaxAge, then
+// the oldest remaining files until the total is within MaxBytes. With dryRun
+// set nothing is deleted, but the result tells what would be.
+func (c *Client) CleanupMedia(q MediaQuota, dryRun bool) (MediaCleanup, error) {
+	files, err := c.mediaFiles()
+	if err != nil {
+		return MediaCleanup{}, fmt.Errorf("failed to scan media directory: %w", err)
+	}
+
+	var result MediaCleanup
+	for _, f := range files {
+		result.BytesRemaining += f.size
+	}
+	cutoff := time.Now().Add(-q.MaxAge)
+	for _, f := range files {
+		expired := q.MaxAge > 0 && f.modTime.Before(cutoff)
+		overQuota := q.MaxBytes > 0 && result.BytesRemaining > q.MaxBytes
+		if !expired && !overQuota {
+			break // files are oldest first, so the rest are kept too
+		}
+		if !dryRun {
+			if err := c.deleteMediaFile(f.path); err != nil {
+				c.Logger.Warnf("Failed to delete %s: %v", f.path, err)
+				continue
+			}
+		}
+		result.FilesDeleted++
+		result.BytesFreed += f.size
+		result.BytesRemaining -= f.size
+	}
+
+	if !dryRun {
+		removeEmptyDirs(c.MediaDir())
+	}
+	return result, nil
+}
+
+// deleteMediaFile removes a downloaded file and its thumbnail and forgets
+// the download in the database.
+func (c *Client) deleteMediaFile(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	os.Remove(thumbnailPath(path))
+	return c.Store.ClearMediaLocalPath(path)
+}
+
+// removeEmptyDirs removes the empty chat directories under root.
+func removeEmptyDirs(root string) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			os.Remove(filepath.Join(root, e.Name())) // fails unless empty
+		}
+	}
+}
+
+// StartMediaCleanup enforces the quota now and then every hour until ctx is done.
+func (c *Client) StartMediaCleanup(ctx context.Context, q MediaQuota) {
+	run := func() {
+		result, err := c.CleanupMedia(q, false)
+		if err != nil {
+			c.Logger.Warnf("Media cleanup failed: %v", err)
+		} else if result.FilesDeleted > 0 {
+			fmt.Fprintf(os.Stderr, "Media cleanup: deleted %d files, freed %d MB\n", result.FilesDeleted, result.BytesFreed>>20)
+		}
+	}
+	c.goWork(func() {
+		run()
+		ticker := time.NewTicker(mediaCleanupInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				run()
+			}
+		}
+	})
+	fmt.Fprintf(os.Stderr, "Media quota enabled (%s)\n", q)
+}
+
+// ChatStorage is the disk space used by the downloaded media of one chat.
+type ChatStorage struct {
+	ChatJID string // the media subdirectory name if no stored message refers to the files
+	Files   int
+	Bytes   int64
+}
+
+// StorageUsage is the disk space used by an account.
+type StorageUsage struct {
+	MediaFiles    int
+	MediaBytes    int64
+	DatabaseBytes int64         // messages.db and whatsapp.db, including WAL files
+	Chats         []ChatStorage // largest first
+}
+
+// StorageUsage measures the media directory and databases. Files are
+// attributed to chats by the download paths recorded in the database.
+func (c *Client) StorageUsage() (StorageUsage, error) {
+	files, err := c.mediaFiles()
+	if err != nil {
+		return StorageUsage{}, fmt.Errorf("failed to scan media directory: %w", err)
+	}
+	paths, err := c.Store.MediaLocalPaths()
+	if err != nil {
+		return StorageUsage{}, fmt.Errorf("failed to read download paths: %w", err)
+	}
+
+	var usage StorageUsage
+	byChat := make(map[string]*ChatStorage)
+	for _, f := range files {
+		chatJID, ok := paths[f.path]
+		if !ok {
+			chatJID = f.chatDir
+		}
+		cs := byChat[chatJID]
+		if cs == nil {
+			cs = &ChatStorage{ChatJID: chatJID}
+			byChat[chatJID] = cs
+		}
+		cs.Files++
+		cs.Bytes += f.size
+		usage.MediaFiles++
+		usage.MediaBytes += f.size
+	}
+	usage.Chats = make([]ChatStorage, 0, len(byChat))
+	for _, cs := range byChat {
+		usage.Chats = append(usage.Chats, *cs)
+	}
+	sort.Slice(usage.Chats, func(i, j int) bool { return usage.Chats[i].Bytes > usage.Chats[j].Bytes })
+
+	for _, name := range []string{"messages.db", "messages.db-wal", "whatsapp.db", "whatsapp.db-wal"} {
+		if info, err := os.Stat(filepath.Join(c.StoreDir, name)); err == nil {
+			usage.DatabaseBytes += info.Size()
+		}
+	}
+	return usage, nil
+}
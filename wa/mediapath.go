@@ -0,0 +1,151 @@
+package wa
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// maxFilenameLen caps sanitized download filenames, leaving room for the
+// directory on filesystems with a 255 byte name limit.
+const maxFilenameLen = 200
+
+// MediaDir is the directory downloaded media is written to, one
+// subdirectory per chat.
+func (c *Client) MediaDir() string {
+	return filepath.Join(c.StoreDir, "media")
+}
+
+// allowedMediaPath resolves a file path the model asked to send, following
+// symlinks, and checks that it lies inside one of MediaAllowDirs or the
+// media directory. With no MediaAllowDirs configured every path is allowed.
+// The resolved path is returned so the checked file is the one read.
+func (c *Client) allowedMediaPath(path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("no file path given")
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("invalid path %s: %w", path, err)
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return "", fmt.Errorf("cannot access %s: %w", path, err)
+	}
+	if len(c.MediaAllowDirs) == 0 {
+		return resolved, nil
+	}
+
+	for _, dir := range append([]string{c.MediaDir()}, c.MediaAllowDirs...) {
+		dir, err := filepath.Abs(dir)
+		if err != nil {
+			continue
+		}
+		if d, err := filepath.EvalSymlinks(dir); err == nil {
+			dir = d
+		}
+		if withinDir(dir, resolved) {
+			return resolved, nil
+		}
+	}
+	return "", fmt.Errorf("%s is outside the allowed media directories", path)
+}
+
+// AllowedFile resolves a file the model asked to read from, such as a chat
+// export to import, and checks it against the same directories as files to
+// send. Only regular files are allowed.
+func (c *Client) AllowedFile(path string) (string, error) {
+	resolved, err := c.allowedMediaPath(path)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return "", fmt.Errorf("cannot access %s: %w", path, err)
+	}
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("%s is not a regular file", path)
+	}
+	return resolved, nil
+}
+
+// AllowedNewFile resolves a file the model asked to write, such as a chat
+// export. Its directory is checked against the same directories as files
+// to send; the file itself is created by the caller and must not exist.
+func (c *Client) AllowedNewFile(path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("no file path given")
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("invalid path %s: %w", path, err)
+	}
+	dir, err := c.allowedMediaPath(filepath.Dir(abs))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, filepath.Base(abs)), nil
+}
+
+// withinDir reports whether path is dir or lies below it. Both must be
+// absolute and clean.
+func withinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(os.PathSeparator))
+}
+
+// reserveFilename creates an empty file named name in dir, or, if that
+// exists, name with " (2)", " (3)" and so on before the extension, and
+// returns its path.
+func reserveFilename(dir, name string) (string, error) {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for n := 1; ; n++ {
+		candidate := name
+		if n > 1 {
+			candidate = fmt.Sprintf("%s (%d)%s", base, n, ext)
+		}
+		path := filepath.Join(dir, candidate)
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			f.Close()
+			return path, nil
+		}
+		if !os.IsExist(err) {
+			return "", err
+		}
+	}
+}
+
+// sanitizeFilename turns a name taken from a message (a document's file
+// name or a chat JID) into a single safe path component. Directory parts,
+// control characters and leading dots are removed; fallback is used if
+// nothing is left.
+func sanitizeFilename(name, fallback string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r == '/' || r == '\\' || r == ':':
+			return '_'
+		case unicode.IsControl(r):
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimLeft(strings.TrimSpace(name), ".")
+	if len(name) > maxFilenameLen {
+		ext := filepath.Ext(name)
+		if len(ext) > 16 {
+			ext = ""
+		}
+		name = strings.ToValidUTF8(name[:maxFilenameLen-len(ext)], "") + ext
+	}
+	if name == "" {
+		return fallback
+	}
+	return name
+}
@@ -0,0 +1,165 @@
+package wa
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waMmsRetry"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// ErrMediaExpired is returned for media WhatsApp's servers no longer have. A
+// re-upload has been requested from the sender's phone; once it arrives the
+// media is downloaded automatically.
+var ErrMediaExpired = errors.New("media expired on WhatsApp's servers; a re-upload was requested from the sender's phone, try again in a minute")
+
+// mediaHost is the media server a re-uploaded file's direct path is stored
+// under; downloads only use the path.
+const mediaHost = "https://mmg.whatsapp.net"
+
+// mediaRetryInterval is how long after a retry request for a message's media
+// another one may be sent.
+const mediaRetryInterval = time.Minute
+
+// mediaRetries remembers the media retry requests awaiting an answer.
+type mediaRetries struct {
+	mu        sync.Mutex
+	requested map[string]time.Time // by chat JID and message ID
+}
+
+// start records a request for a message's media, or reports false if one
+// was sent within mediaRetryInterval.
+func (r *mediaRetries) start(chatJID, messageID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := chatJID + "/" + messageID
+	if at, ok := r.requested[key]; ok && time.Since(at) < mediaRetryInterval {
+		return false
+	}
+	if r.requested == nil {
+		r.requested = make(map[string]time.Time)
+	}
+	r.requested[key] = time.Now()
+	return true
+}
+
+// finish forgets a request and reports whether there was one.
+func (r *mediaRetries) finish(chatJID, messageID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := chatJID + "/" + messageID
+	_, ok := r.requested[key]
+	delete(r.requested, key)
+	return ok
+}
+
+// isMediaExpired reports whether a download failed because WhatsApp's
+// servers no longer have the media.
+func isMediaExpired(err error) bool {
+	return errors.Is(err, whatsmeow.ErrMediaDownloadFailedWith404) || errors.Is(err, whatsmeow.ErrMediaDownloadFailedWith410)
+}
+
+// verifyMediaSHA256 checks a downloaded file against the SHA-256 hash of the
+// message. Without a hash there is nothing to check.
+func verifyMediaSHA256(path string, want []byte) error {
+	if len(want) == 0 {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	if !bytes.Equal(h.Sum(nil), want) {
+		return fmt.Errorf("media failed the integrity check: its SHA-256 hash does not match the message")
+	}
+	return nil
+}
+
+// requestMediaRetry asks the phone that sent a message to upload its media
+// again. Requests for the same message are sent at most every
+// mediaRetryInterval.
+func (c *Client) requestMediaRetry(ctx context.Context, messageID, chatJID string, mediaKey []byte) error {
+	chat, err := types.ParseJID(chatJID)
+	if err != nil {
+		return err
+	}
+	msg, err := c.Store.GetMessage(messageID, chatJID)
+	if err != nil {
+		return err
+	}
+	if msg == nil {
+		return fmt.Errorf("message %s not found in %s", messageID, chatJID)
+	}
+	if !c.mediaRetries.start(chatJID, messageID) {
+		return nil
+	}
+
+	info := &types.MessageInfo{
+		ID: messageID,
+		MessageSource: types.MessageSource{
+			Chat:     chat,
+			Sender:   chat,
+			IsFromMe: msg.IsFromMe,
+			IsGroup:  chat.Server == types.GroupServer,
+		},
+	}
+	switch {
+	case msg.IsFromMe && c.WA.Store.ID != nil:
+		info.Sender = c.WA.Store.ID.ToNonAD()
+	case info.IsGroup:
+		info.Sender = c.senderJID(msg.SenderJID)
+	}
+	if err := c.WA.SendMediaRetryReceipt(ctx, info, mediaKey); err != nil {
+		c.mediaRetries.finish(chatJID, messageID)
+		return err
+	}
+	c.Logger.Infof("Media of %s expired, requested a re-upload", messageID)
+	return nil
+}
+
+// handleMediaRetry stores the new location of media the sender's phone
+// re-uploaded after requestMediaRetry, and downloads it.
+func (c *Client) handleMediaRetry(evt *events.MediaRetry) {
+	messageID, chatJID := evt.MessageID, evt.ChatID.String()
+	if !c.mediaRetries.finish(chatJID, messageID) {
+		return
+	}
+	url, mediaKey, fileSHA256, fileEncSHA256, fileLength, mediaType, filename, err := c.Store.GetMediaInfo(messageID, chatJID)
+	if err != nil {
+		c.Logger.Warnf("Failed to find message %s for media retry: %v", messageID, err)
+		return
+	}
+	retry, err := whatsmeow.DecryptMediaRetryNotification(evt, mediaKey)
+	if err != nil {
+		c.Logger.Warnf("Media of %s could not be re-uploaded: %v", messageID, err)
+		return
+	}
+	if retry.GetResult() != waMmsRetry.MediaRetryNotification_SUCCESS {
+		c.Logger.Warnf("Media of %s could not be re-uploaded: %s", messageID, retry.GetResult())
+		return
+	}
+
+	url = mediaHost + retry.GetDirectPath()
+	if err := c.Store.SetMediaURL(messageID, chatJID, url); err != nil {
+		c.Logger.Warnf("Failed to record new media location of %s: %v", messageID, err)
+		return
+	}
+	// View-once media is downloaded too; it counts as viewed only once fetched with download_media
+	if _, err := c.downloadMedia(context.Background(), messageID, chatJID, url, mediaKey, fileSHA256, fileEncSHA256, fileLength, mediaType, filename); err != nil {
+		c.Logger.Warnf("Download of re-uploaded media of %s failed: %v", messageID, err)
+	}
+}
@@ -0,0 +1,70 @@
+package wa
+
+import (
+	"fmt"
+	"strings"
+
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+// resolveMentions parses the mentioned recipients (phone numbers or JIDs)
+// into JIDs and makes sure text has an @-placeholder for each: WhatsApp
+// highlights the placeholder and the mentioned JID tells it who it stands for.
+// Missing placeholders are appended to the text.
+func resolveMentions(text string, mentions []string) (string, []string, error) {
+	var jids []string
+	seen := make(map[string]bool)
+	for _, m := range mentions {
+		m = strings.TrimLeft(strings.TrimSpace(m), "@+")
+		jid, err := parseRecipient(m)
+		if err != nil || jid.User == "" || jid.Server == "" {
+			return "", nil, fmt.Errorf("invalid mention %q", m)
+		}
+		if seen[jid.String()] {
+			continue
+		}
+		seen[jid.String()] = true
+		jids = append(jids, jid.String())
+		if !hasPlaceholder(text, jid.User) {
+			text = strings.TrimRight(text, " ") + " @" + jid.User
+		}
+	}
+	return strings.TrimLeft(text, " "), jids, nil
+}
+
+// hasPlaceholder reports whether text contains @user not followed by more
+// digits of a longer number.
+func hasPlaceholder(text, user string) bool {
+	placeholder := "@" + user
+	for i := 0; ; {
+		idx := strings.Index(text[i:], placeholder)
+		if idx < 0 {
+			return false
+		}
+		end := i + idx + len(placeholder)
+		if end == len(text) || text[end] < '0' || text[end] > '9' {
+			return true
+		}
+		i = end
+	}
+}
+
+// textMessage builds a text message, as an extended text message carrying
+// the mentioned JIDs if there are any.
+func textMessage(text string, mentions []string) *waProto.Message {
+	if len(mentions) == 0 {
+		return &waProto.Message{Conversation: proto.String(text)}
+	}
+	return &waProto.Message{
+		ExtendedTextMessage: &waProto.ExtendedTextMessage{
+			Text:        proto.String(text),
+			ContextInfo: &waProto.ContextInfo{MentionedJID: mentions},
+		},
+	}
+}
+
+// extractMentions returns the JIDs @-mentioned in a message.
+func extractMentions(msg *waProto.Message) []string {
+	return contextInfo(msg).GetMentionedJID()
+}
@@ -3,9 +3,14 @@ package wa
 import (
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
+	"github.com/CSCSoftware/wahoo/db"
+
 	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/proto/waHistorySync"
+	"go.mau.fi/whatsmeow/proto/waWeb"
 	"go.mau.fi/whatsmeow/types"
 	"go.mau.fi/whatsmeow/types/events"
 )
@@ -21,20 +26,93 @@ func extractTextContent(msg *waProto.Message) string {
 	if ext := msg.GetExtendedTextMessage(); ext != nil {
 		return ext.GetText()
 	}
+	if poll := pollCreation(msg); poll != nil {
+		return "Poll: " + poll.GetName()
+	}
+	if loc := msg.GetLocationMessage(); loc != nil {
+		return loc.GetComment()
+	}
+	if live := msg.GetLiveLocationMessage(); live != nil {
+		return live.GetCaption()
+	}
+	if contact := msg.GetContactMessage(); contact != nil {
+		return "Contact: " + contact.GetDisplayName()
+	}
+	if contacts := msg.GetContactsArrayMessage(); contacts != nil {
+		names := make([]string, 0, len(contacts.GetContacts()))
+		for _, contact := range contacts.GetContacts() {
+			names = append(names, contact.GetDisplayName())
+		}
+		return "Contacts: " + strings.Join(names, ", ")
+	}
 	return ""
 }
 
+// extractQuote returns the ID and sender of the message a reply quotes, or
+// empty strings if msg is not a reply.
+func extractQuote(msg *waProto.Message) (id, sender string) {
+	ci := contextInfo(msg)
+	if ci.GetStanzaID() == "" {
+		return "", ""
+	}
+	if jid, err := types.ParseJID(ci.GetParticipant()); err == nil {
+		sender = jid.User
+	}
+	return ci.GetStanzaID(), sender
+}
+
+// extractVCard returns the vCard text of a contact card message. Multiple
+// shared contacts are concatenated; vCards are self-delimiting.
+func extractVCard(msg *waProto.Message) string {
+	if contact := msg.GetContactMessage(); contact != nil {
+		return contact.GetVcard()
+	}
+	var vcards []string
+	for _, contact := range msg.GetContactsArrayMessage().GetContacts() {
+		if vcard := strings.TrimSpace(contact.GetVcard()); vcard != "" {
+			vcards = append(vcards, vcard)
+		}
+	}
+	return strings.Join(vcards, "\n")
+}
+
+// extractLocation returns the position of a location or live location message.
+// Live locations carry the position at the time they were shared.
+func extractLocation(msg *waProto.Message) *db.Location {
+	if loc := msg.GetLocationMessage(); loc != nil {
+		return &db.Location{
+			Latitude:  loc.GetDegreesLatitude(),
+			Longitude: loc.GetDegreesLongitude(),
+			Name:      loc.GetName(),
+			Address:   loc.GetAddress(),
+		}
+	}
+	if live := msg.GetLiveLocationMessage(); live != nil {
+		return &db.Location{
+			Latitude:  live.GetDegreesLatitude(),
+			Longitude: live.GetDegreesLongitude(),
+		}
+	}
+	return nil
+}
+
 // extractMediaInfo extracts media metadata from a WhatsApp message proto.
+// View-once media is looked up inside its wrapper.
 func extractMediaInfo(msg *waProto.Message) (mediaType, filename, url string, mediaKey, fileSHA256, fileEncSHA256 []byte, fileLength uint64) {
 	if msg == nil {
 		return
 	}
+	msg = unwrapViewOnce(msg)
 
 	if img := msg.GetImageMessage(); img != nil {
 		return "image", "image_" + time.Now().Format("20060102_150405") + ".jpg",
 			img.GetURL(), img.GetMediaKey(), img.GetFileSHA256(), img.GetFileEncSHA256(), img.GetFileLength()
 	}
 	if vid := msg.GetVideoMessage(); vid != nil {
+		if vid.GetGifPlayback() {
+			return "gif", "gif_" + time.Now().Format("20060102_150405") + ".mp4",
+				vid.GetURL(), vid.GetMediaKey(), vid.GetFileSHA256(), vid.GetFileEncSHA256(), vid.GetFileLength()
+		}
 		return "video", "video_" + time.Now().Format("20060102_150405") + ".mp4",
 			vid.GetURL(), vid.GetMediaKey(), vid.GetFileSHA256(), vid.GetFileEncSHA256(), vid.GetFileLength()
 	}
@@ -42,6 +120,10 @@ func extractMediaInfo(msg *waProto.Message) (mediaType, filename, url string, me
 		return "audio", "audio_" + time.Now().Format("20060102_150405") + ".ogg",
 			aud.GetURL(), aud.GetMediaKey(), aud.GetFileSHA256(), aud.GetFileEncSHA256(), aud.GetFileLength()
 	}
+	if st := msg.GetStickerMessage(); st != nil {
+		return "sticker", "sticker_" + time.Now().Format("20060102_150405") + ".webp",
+			st.GetURL(), st.GetMediaKey(), st.GetFileSHA256(), st.GetFileEncSHA256(), st.GetFileLength()
+	}
 	if doc := msg.GetDocumentMessage(); doc != nil {
 		fn := doc.GetFileName()
 		if fn == "" {
@@ -50,20 +132,107 @@ func extractMediaInfo(msg *waProto.Message) (mediaType, filename, url string, me
 		return "document", fn,
 			doc.GetURL(), doc.GetMediaKey(), doc.GetFileSHA256(), doc.GetFileEncSHA256(), doc.GetFileLength()
 	}
+	// Locations have no file; the type marks them so they are stored even without a comment
+	if msg.GetLocationMessage() != nil {
+		return "location", "", "", nil, nil, nil, 0
+	}
+	if msg.GetLiveLocationMessage() != nil {
+		return "live_location", "", "", nil, nil, nil, 0
+	}
 
 	return
 }
 
+// extractMediaDetails returns the MIME type of a media message and, for
+// documents, the page count WhatsApp reports (0 if unknown).
+func extractMediaDetails(msg *waProto.Message) (mimeType string, pageCount uint32) {
+	msg = unwrapViewOnce(msg)
+	switch {
+	case msg.GetImageMessage() != nil:
+		return msg.GetImageMessage().GetMimetype(), 0
+	case msg.GetVideoMessage() != nil:
+		return msg.GetVideoMessage().GetMimetype(), 0
+	case msg.GetAudioMessage() != nil:
+		return msg.GetAudioMessage().GetMimetype(), 0
+	case msg.GetStickerMessage() != nil:
+		return msg.GetStickerMessage().GetMimetype(), 0
+	case msg.GetDocumentMessage() != nil:
+		return msg.GetDocumentMessage().GetMimetype(), msg.GetDocumentMessage().GetPageCount()
+	}
+	return "", 0
+}
+
+// unwrapViewOnce returns the message inside a view-once wrapper, or msg
+// itself if it has none. Live messages arrive unwrapped by whatsmeow, those
+// from history sync still wrapped.
+func unwrapViewOnce(msg *waProto.Message) *waProto.Message {
+	for _, wrapper := range []*waProto.FutureProofMessage{
+		msg.GetViewOnceMessage(), msg.GetViewOnceMessageV2(), msg.GetViewOnceMessageV2Extension(),
+	} {
+		if inner := wrapper.GetMessage(); inner != nil {
+			return inner
+		}
+	}
+	return msg
+}
+
+// isViewOnce reports whether msg is view-once media, either wrapped or
+// flagged on the media itself.
+func isViewOnce(msg *waProto.Message) bool {
+	if msg == nil {
+		return false
+	}
+	if inner := unwrapViewOnce(msg); inner != msg {
+		return true
+	}
+	return msg.GetImageMessage().GetViewOnce() || msg.GetVideoMessage().GetViewOnce() || msg.GetAudioMessage().GetViewOnce()
+}
+
 // handleMessage processes an incoming real-time message event.
 func handleMessage(c *Client, msg *events.Message) {
+	if !msg.Info.IsFromMe {
+		messagesTotal.Inc(c.AccountName, "in")
+	}
 	chatJID := msg.Info.Chat.String()
 	sender := msg.Info.Sender.User
 
+	// Number change notices arrive as system messages, which carry their
+	// stub in the source web message
+	if msg.SourceWebMsg != nil {
+		handleNumberChangeStub(c, msg.Info.Chat, msg.SourceWebMsg)
+	}
+
+	if msg.Message.GetPollUpdateMessage() != nil {
+		handlePollVote(c, msg)
+		return
+	}
+
+	if msg.Info.Chat == types.StatusBroadcastJID {
+		handleStatusMessage(c, msg)
+		return
+	}
+
+	if pm := msg.Message.GetProtocolMessage(); pm != nil {
+		handleProtocolMessage(c, msg, pm)
+		return
+	}
+
 	name := GetChatName(c, msg.Info.Chat, chatJID, nil, sender)
 
 	if err := c.Store.StoreChat(chatJID, name, msg.Info.Timestamp); err != nil {
 		c.Logger.Warnf("Failed to store chat: %v", err)
 	}
+	// Messages in a disappearing chat carry the timer, so a setting change
+	// made while we were offline is picked up with the next message
+	if exp := contextInfo(msg.Message).GetExpiration(); exp > 0 {
+		if err := c.Store.SetChatDisappearingTimer(chatJID, time.Duration(exp)*time.Second); err != nil {
+			c.Logger.Warnf("Failed to record disappearing timer of %s: %v", chatJID, err)
+		}
+	}
+
+	if poll := pollCreation(msg.Message); poll != nil {
+		handlePollCreation(c, msg, poll)
+	}
 
 	content := extractTextContent(msg.Message)
 	mediaType, filename, url, mediaKey, fileSHA256, fileEncSHA256, fileLength := extractMediaInfo(msg.Message)
@@ -71,15 +240,55 @@ func handleMessage(c *Client, msg *events.Message) {
 	if content == "" && mediaType == "" {
 		return
 	}
+	quotedID, quotedSender := extractQuote(msg.Message)
+	mentionsMe := c.mentionsMe(msg.Message)
+	viewOnce := msg.IsViewOnce || isViewOnce(msg.Message)
+
+	record := db.MessageRecord{
+		ID:            msg.Info.ID,
+		ChatJID:       chatJID,
+		Sender:        sender,
+		Content:       content,
+		Timestamp:     msg.Info.Timestamp,
+		IsFromMe:      msg.Info.IsFromMe,
+		Source:        db.SourceLive,
+		MediaType:     mediaType,
+		Filename:      filename,
+		URL:           url,
+		MediaKey:      mediaKey,
+		FileSHA256:    fileSHA256,
+		FileEncSHA256: fileEncSHA256,
+		FileLength:    fileLength,
+		Location:      extractLocation(msg.Message),
+		VCard:         extractVCard(msg.Message),
 
-	err := c.Store.StoreMessage(
-		msg.Info.ID, chatJID, sender, content, msg.Info.Timestamp, msg.Info.IsFromMe,
-		mediaType, filename, url, mediaKey, fileSHA256, fileEncSHA256, fileLength,
-	)
+		QuotedMessageID: quotedID,
+		QuotedSender:    quotedSender,
+		MentionedJIDs:   extractMentions(msg.Message),
+		MentionsMe:      mentionsMe,
+		ViewOnce:        viewOnce,
+	}
+	record.MimeType, record.PageCount = extractMediaDetails(msg.Message)
+	err := c.Store.StoreMessage(record)
 	if err != nil {
 		c.Logger.Warnf("Failed to store message: %v", err)
 		return
 	}
+	if c.OnMessage != nil {
+		c.OnMessage(chatJID, msg.Info.ID)
+	}
+
+	checkWatchRules(c, msg, content, mentionsMe)
+	go checkModeration(c, msg, content)
+	c.goWork(func() { c.autoMarkRead(msg) })
+
+	// View-once media is only downloaded on explicit request
+	if mediaType != "" && !viewOnce && c.autoDownload != nil {
+		c.autoDownload.enqueue(c, msg.Info.ID, chatJID, mediaType, fileLength)
+	}
+	if mediaType == "audio" && !viewOnce && !msg.Info.IsFromMe && c.transcribeJobs != nil {
+		c.enqueueTranscription(msg.Info.ID, chatJID)
+	}
 
 	// Log to stderr
 	ts := msg.Info.Timestamp.Format("2006-01-02 15:04:05")
@@ -94,12 +303,15 @@ func handleMessage(c *Client, msg *events.Message) {
 	}
 }
 
-// handleHistorySync processes a history sync event.
-func handleHistorySync(c *Client, historySync *events.HistorySync) {
-	fmt.Fprintf(os.Stderr, "History sync: %d conversations\n", len(historySync.Data.Conversations))
+// handleHistorySync stores the chats and messages of a history sync chunk.
+// Storing a chunk again changes nothing, so an interrupted chunk can be
+// processed from the start. Returns how many messages were stored.
+func handleHistorySync(c *Client, data *waHistorySync.HistorySync) (int, error) {
+	fmt.Fprintf(os.Stderr, "History sync (%s): %d conversations\n", data.GetSyncType(), len(data.Conversations))
 
-	syncedCount := 0
-	for _, conversation := range historySync.Data.Conversations {
+	// Messages are stored in batches once their chats exist
+	var records []db.MessageRecord
+	for _, conversation := range data.Conversations {
 		if conversation.ID == nil {
 			continue
 		}
@@ -113,6 +325,14 @@ func handleHistorySync(c *Client, historySync *events.HistorySync) {
 
 		name := GetChatName(c, jid, chatJID, conversation, "")
 
+		// Conversations carry the other side of a number change
+		if conversation.OldJID != nil {
+			linkNumberChange(c, conversation.GetOldJID(), chatJID)
+		}
+		if conversation.NewJID != nil {
+			linkNumberChange(c, chatJID, conversation.GetNewJID())
+		}
+
 		messages := conversation.Messages
 		if len(messages) == 0 {
 			continue
@@ -130,6 +350,15 @@ func handleHistorySync(c *Client, historySync *events.HistorySync) {
 		}
 		timestamp := time.Unix(int64(ts), 0)
 		c.Store.StoreChat(chatJID, name, timestamp)
+		if err := c.Store.MarkChatSynced(chatJID, conversation.GetEndOfHistoryTransfer(), time.Now()); err != nil {
+			c.Logger.Warnf("Failed to record sync of %s: %v", chatJID, err)
+		}
+		if conversation.EphemeralExpiration != nil {
+			timer := time.Duration(conversation.GetEphemeralExpiration()) * time.Second
+			if err := c.Store.SetChatDisappearingTimer(chatJID, timer); err != nil {
+				c.Logger.Warnf("Failed to record disappearing timer of %s: %v", chatJID, err)
+			}
+		}
 
 		// Store messages
 		for _, msg := range messages {
@@ -137,6 +366,8 @@ func handleHistorySync(c *Client, historySync *events.HistorySync) {
 				continue
 			}
 
+			handleNumberChangeStub(c, jid, msg.Message)
+
 			content := extractTextContent(msg.Message.Message)
 			mediaType, filename, url, mediaKey, fileSHA256, fileEncSHA256, fileLength := extractMediaInfo(msg.Message.Message)
 
@@ -173,17 +404,103 @@ func handleHistorySync(c *Client, historySync *events.HistorySync) {
 			}
 			msgTime := time.Unix(int64(msgTs), 0)
 
-			err = c.Store.StoreMessage(
-				msgID, chatJID, sender, content, msgTime, isFromMe,
-				mediaType, filename, url, mediaKey, fileSHA256, fileEncSHA256, fileLength,
-			)
-			if err != nil {
-				c.Logger.Warnf("Failed to store history message: %v", err)
-			} else {
-				syncedCount++
+			if poll := pollCreation(msg.Message.Message); poll != nil {
+				if err := c.Store.StorePoll(msgID, chatJID, sender, poll.GetName(), pollOptionNames(poll),
+					int(poll.GetSelectableOptionsCount()), msgTime); err != nil {
+					c.Logger.Warnf("Failed to store history poll: %v", err)
+				}
+			}
+
+			record := db.MessageRecord{
+				ID:            msgID,
+				ChatJID:       chatJID,
+				Sender:        sender,
+				Content:       content,
+				Timestamp:     msgTime,
+				IsFromMe:      isFromMe,
+				Source:        db.SourceHistorySync,
+				MediaType:     mediaType,
+				Filename:      filename,
+				URL:           url,
+				MediaKey:      mediaKey,
+				FileSHA256:    fileSHA256,
+				FileEncSHA256: fileEncSHA256,
+				FileLength:    fileLength,
+				Location:      extractLocation(msg.Message.Message),
+				VCard:         extractVCard(msg.Message.Message),
+			}
+			record.QuotedMessageID, record.QuotedSender = extractQuote(msg.Message.Message)
+			record.MentionedJIDs = extractMentions(msg.Message.Message)
+			record.MentionsMe = c.mentionsMe(msg.Message.Message)
+			record.ViewOnce = isViewOnce(msg.Message.Message)
+			record.MimeType, record.PageCount = extractMediaDetails(msg.Message.Message)
+			if c2s := msg.Message.GetMessageC2STimestamp(); c2s != 0 {
+				senderTime := time.Unix(int64(c2s), 0)
+				record.SenderTimestamp = &senderTime
+			}
+
+			records = append(records, record)
+		}
+
+		// An unread count of -1 means the chat was marked as unread
+		if conversation.UnreadCount != nil {
+			unread := int(conversation.GetUnreadCount())
+			if unread < 0 {
+				unread = 1
+			}
+			if err := c.Store.SetChatUnreadCount(chatJID, unread); err != nil {
+				c.Logger.Warnf("Failed to record unread count of %s: %v", chatJID, err)
 			}
 		}
 	}
 
+	syncedCount, err := c.Store.StoreMessages(records)
 	fmt.Fprintf(os.Stderr, "History sync complete. Stored %d messages.\n", syncedCount)
+	historySyncMessages.Add(float64(syncedCount), c.AccountName)
+	if data.Progress != nil {
+		historySyncProgress.Set(float64(data.GetProgress()), c.AccountName)
+	}
+	c.scheduleNameRefresh()
+	return syncedCount, err
+}
+
+// handleNumberChangeStub links identities announced by a number-change system message.
+// Individual chats carry [old, new] as stub parameters; group notices name the
+// old JID and use the participant field for the new one.
+func handleNumberChangeStub(c *Client, chat types.JID, msg *waWeb.WebMessageInfo) {
+	params := msg.GetMessageStubParameters()
+	switch msg.GetMessageStubType() {
+	case waWeb.WebMessageInfo_INDIVIDUAL_CHANGE_NUMBER:
+		if len(params) >= 2 {
+			linkNumberChange(c, params[0], params[1])
+		} else if len(params) == 1 {
+			linkNumberChange(c, params[0], chat.String())
+		}
+	case waWeb.WebMessageInfo_GROUP_PARTICIPANT_CHANGE_NUMBER:
+		if len(params) >= 2 {
+			linkNumberChange(c, params[0], params[1])
+		} else if len(params) == 1 && msg.GetParticipant() != "" {
+			linkNumberChange(c, params[0], msg.GetParticipant())
+		}
+	}
+}
+
+// linkNumberChange links an old and new JID in the identities table.
+func linkNumberChange(c *Client, oldJID, newJID string) {
+	oldParsed, err1 := types.ParseJID(oldJID)
+	newParsed, err2 := types.ParseJID(newJID)
+	if err1 != nil || err2 != nil || oldParsed.User == "" || newParsed.User == "" {
+		return
+	}
+	oldJID, newJID = oldParsed.ToNonAD().String(), newParsed.ToNonAD().String()
+	if oldJID == newJID {
+		return
+	}
+
+	if err := c.Store.LinkIdentities(oldJID, newJID, "number_change"); err != nil {
+		c.Logger.Warnf("Failed to link identities %s -> %s: %v", oldJID, newJID, err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Number change detected: %s -> %s\n", oldJID, newJID)
+	c.scheduleNameRefresh()
 }
@@ -0,0 +1,48 @@
+package wa
+
+import (
+	"go.mau.fi/whatsmeow/types/events"
+
+	"github.com/CSCSoftware/wahoo/metrics"
+)
+
+var (
+	messagesTotal = metrics.NewCounter("wahoo_messages_total",
+		"Messages received in real time and sent successfully.", "account", "direction")
+	sendFailures = metrics.NewCounter("wahoo_send_failures_total",
+		"Messages that WhatsApp did not accept.", "account")
+	connectedGauge = metrics.NewGauge("wahoo_connected",
+		"1 while the account is connected to WhatsApp.", "account")
+	reconnectsTotal = metrics.NewCounter("wahoo_reconnects_total",
+		"Connections established after the first one since startup.", "account")
+	historySyncProgress = metrics.NewGauge("wahoo_history_sync_progress_percent",
+		"Progress of the latest history sync as reported by WhatsApp.", "account")
+	historySyncMessages = metrics.NewCounter("wahoo_history_sync_messages_total",
+		"Messages stored from history syncs.", "account")
+)
+
+// recordSendMetrics counts the outcome of a send.
+func (c *Client) recordSendMetrics(err error) {
+	if err != nil {
+		sendFailures.Inc(c.AccountName)
+		return
+	}
+	messagesTotal.Inc(c.AccountName, "out")
+}
+
+// recordConnectionMetrics updates the connection gauges. It runs before
+// trackConnectionEvent so a reconnect can be told from the first connect.
+func (c *Client) recordConnectionMetrics(evt interface{}) {
+	switch evt.(type) {
+	case *events.Connected:
+		c.conn.mu.Lock()
+		reconnect := !c.conn.lastConnected.IsZero()
+		c.conn.mu.Unlock()
+		if reconnect {
+			reconnectsTotal.Inc(c.AccountName)
+		}
+		connectedGauge.Set(1, c.AccountName)
+	case *events.Disconnected, *events.LoggedOut, *events.StreamReplaced, *events.TemporaryBan:
+		connectedGauge.Set(0, c.AccountName)
+	}
+}
@@ -0,0 +1,94 @@
+package wa
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+
+	"github.com/CSCSoftware/wahoo/db"
+)
+
+// checkModeration revokes an incoming group message that breaks a moderation
+// rule, provided we admin the group and the sender does not. Every action is
+// written to the moderation log and forwarded as an account notice.
+func checkModeration(c *Client, msg *events.Message, content string) {
+	if msg.Info.IsFromMe || msg.Info.Chat.Server != types.GroupServer || content == "" {
+		return
+	}
+
+	rules, err := c.Store.ListModerationRules()
+	if err != nil || len(rules) == 0 {
+		return
+	}
+
+	groupJID := msg.Info.Chat.String()
+	var rule db.ModerationRule
+	var reason string
+	for _, r := range rules {
+		if !r.AppliesTo(groupJID) {
+			continue
+		}
+		if reason = r.Violation(content); reason != "" {
+			rule = r
+			break
+		}
+	}
+	if reason == "" {
+		return
+	}
+
+	admins, err := c.Store.GroupAdmins(groupJID)
+	if err != nil || !c.isOwnAdmin(admins) || c.isAdminSender(admins, msg.Info) {
+		return
+	}
+
+	entry := db.ModerationLogEntry{
+		Rule:      rule.Name,
+		GroupJID:  groupJID,
+		MessageID: msg.Info.ID,
+		Sender:    msg.Info.Sender.User,
+		Content:   content,
+		Reason:    reason,
+	}
+	ok, result := false, "read-only mode"
+	if !c.ReadOnly {
+		ok, result = c.RevokeMessage(context.Background(), groupJID, msg.Info.ID, msg.Info.Sender.ToNonAD().String())
+	}
+	entry.Revoked = ok
+	if !ok {
+		entry.Error = &result
+	}
+	if err := c.Store.LogModeration(entry, time.Now()); err != nil {
+		c.Logger.Warnf("Failed to log moderation of %s: %v", msg.Info.ID, err)
+	}
+
+	groupName := GetChatName(c, msg.Info.Chat, groupJID, nil, "")
+	notice := fmt.Sprintf("Moderation rule %q revoked a message from %s in %s (%s)",
+		rule.Name, msg.Info.PushName, groupName, reason)
+	if !ok {
+		notice = fmt.Sprintf("Moderation rule %q could not revoke a message from %s in %s (%s): %s",
+			rule.Name, msg.Info.PushName, groupName, reason, result)
+	}
+	if c.notifier != nil {
+		c.queueNotice(notice)
+	} else {
+		c.Logger.Infof("%s", notice)
+	}
+}
+
+// isOwnAdmin reports whether our own account (phone or LID) is among admins.
+func (c *Client) isOwnAdmin(admins map[string]bool) bool {
+	if c.WA.Store.ID == nil {
+		return false
+	}
+	return admins[c.WA.Store.ID.User] || (!c.WA.Store.LID.IsEmpty() && admins[c.WA.Store.LID.User])
+}
+
+// isAdminSender reports whether the sender of a message is a group admin,
+// checking both the sender's phone number and LID.
+func (c *Client) isAdminSender(admins map[string]bool, info types.MessageInfo) bool {
+	return admins[info.Sender.User] || (!info.SenderAlt.IsEmpty() && admins[info.SenderAlt.User])
+}
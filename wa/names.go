@@ -27,13 +27,23 @@ func GetChatName(c *Client, jid types.JID, chatJID string, conversation interfac
 		}
 
 		if name == "" {
-			groupInfo, err := c.WA.GetGroupInfo(context.Background(), jid)
-			if err == nil && groupInfo.Name != "" {
+			ctx, done := withTimeout(context.Background(), c.Timeouts.Request, "getting the group info")
+			groupInfo, err := c.WA.GetGroupInfo(ctx, jid)
+			if err = done(err); err == nil && groupInfo.Name != "" {
 				name = groupInfo.Name
 			} else {
 				name = fmt.Sprintf("Group %s", jid.User)
 			}
 		}
+	} else if jid.Server == types.NewsletterServer {
+		// Channel
+		ctx, done := withTimeout(context.Background(), c.Timeouts.Request, "getting the channel info")
+		meta, err := c.WA.GetNewsletterInfo(ctx, jid)
+		if err = done(err); err == nil && meta.ThreadMeta.Name.Text != "" {
+			name = meta.ThreadMeta.Name.Text
+		} else {
+			name = fmt.Sprintf("Channel %s", jid.User)
+		}
 	} else {
 		// Individual contact
 		contact, err := c.WA.Store.Contacts.GetContact(context.Background(), jid)
@@ -0,0 +1,234 @@
+package wa
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/CSCSoftware/wahoo/db"
+
+	"go.mau.fi/whatsmeow"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+// newsletterLinkPrefix starts the invite links of WhatsApp channels.
+const newsletterLinkPrefix = "https://whatsapp.com/channel/"
+
+// maxNewsletterFetch is the most messages WhatsApp returns per channel request.
+const maxNewsletterFetch = 100
+
+// Newsletter is a WhatsApp channel the account follows or administers.
+type Newsletter struct {
+	JID         string
+	Name        string
+	Description string
+	Subscribers int
+	Role        string // subscriber, admin or owner
+	Muted       bool
+	InviteLink  string
+}
+
+func newsletterFrom(meta *types.NewsletterMetadata) Newsletter {
+	n := Newsletter{
+		JID:         meta.ID.String(),
+		Name:        meta.ThreadMeta.Name.Text,
+		Description: meta.ThreadMeta.Description.Text,
+		Subscribers: meta.ThreadMeta.SubscriberCount,
+	}
+	if meta.ThreadMeta.InviteCode != "" {
+		n.InviteLink = newsletterLinkPrefix + meta.ThreadMeta.InviteCode
+	}
+	if meta.ViewerMeta != nil {
+		n.Role = string(meta.ViewerMeta.Role)
+		n.Muted = meta.ViewerMeta.Mute == types.NewsletterMuteOn
+	}
+	return n
+}
+
+// parseNewsletterJID checks that jid names a channel.
+func parseNewsletterJID(newsletterJID string) (types.JID, error) {
+	jid, err := types.ParseJID(newsletterJID)
+	if err != nil {
+		return jid, fmt.Errorf("invalid JID: %w", err)
+	}
+	if jid.Server != types.NewsletterServer {
+		return jid, fmt.Errorf("%s is not a channel (channel JIDs end in @%s)", newsletterJID, types.NewsletterServer)
+	}
+	return jid, nil
+}
+
+// ListNewsletters returns the channels the account follows.
+func (c *Client) ListNewsletters(ctx context.Context) ([]Newsletter, error) {
+	if !c.IsConnected() {
+		return nil, fmt.Errorf("not connected to WhatsApp")
+	}
+	ctx, done := withTimeout(ctx, c.Timeouts.Request, "listing channels")
+	metas, err := c.WA.GetSubscribedNewsletters(ctx)
+	if err = done(err); err != nil {
+		return nil, fmt.Errorf("failed to list channels: %w", err)
+	}
+	newsletters := make([]Newsletter, 0, len(metas))
+	for _, meta := range metas {
+		newsletters = append(newsletters, newsletterFrom(meta))
+	}
+	return newsletters, nil
+}
+
+// FollowNewsletter follows a channel given by JID or invite link.
+func (c *Client) FollowNewsletter(ctx context.Context, channel string) (bool, string) {
+	if !c.IsConnected() {
+		return false, "Not connected to WhatsApp"
+	}
+
+	key, isLink := strings.CutPrefix(channel, newsletterLinkPrefix)
+	var jid types.JID
+	var err error
+	if !isLink {
+		if jid, err = parseNewsletterJID(channel); err != nil {
+			return false, err.Error()
+		}
+	}
+
+	var meta *types.NewsletterMetadata
+	infoCtx, done := withTimeout(ctx, c.Timeouts.Request, "looking up the channel")
+	if isLink {
+		meta, err = c.WA.GetNewsletterInfoWithInvite(infoCtx, key)
+	} else {
+		meta, err = c.WA.GetNewsletterInfo(infoCtx, jid)
+	}
+	if err = done(err); err != nil {
+		return false, fmt.Sprintf("Failed to find channel: %v", err)
+	}
+
+	ctx, done = withTimeout(ctx, c.Timeouts.Request, "following the channel")
+	if err := done(c.WA.FollowNewsletter(ctx, meta.ID)); err != nil {
+		return false, fmt.Sprintf("Failed to follow channel: %v", err)
+	}
+	return true, fmt.Sprintf("Following channel %s (%s)", meta.ThreadMeta.Name.Text, meta.ID)
+}
+
+// UnfollowNewsletter stops following a channel.
+func (c *Client) UnfollowNewsletter(ctx context.Context, newsletterJID string) (bool, string) {
+	if !c.IsConnected() {
+		return false, "Not connected to WhatsApp"
+	}
+	jid, err := parseNewsletterJID(newsletterJID)
+	if err != nil {
+		return false, err.Error()
+	}
+
+	ctx, done := withTimeout(ctx, c.Timeouts.Request, "unfollowing the channel")
+	if err := done(c.WA.UnfollowNewsletter(ctx, jid)); err != nil {
+		return false, fmt.Sprintf("Failed to unfollow channel: %v", err)
+	}
+	return true, fmt.Sprintf("Unfollowed channel %s", newsletterJID)
+}
+
+// FetchNewsletterMessages stores the latest count messages of a channel
+// (at most 100) and returns how many were stored. New channel messages
+// arrive live once the channel is followed; this fills in older ones.
+func (c *Client) FetchNewsletterMessages(ctx context.Context, newsletterJID string, count int) (int, error) {
+	if !c.IsConnected() {
+		return 0, fmt.Errorf("not connected to WhatsApp")
+	}
+	jid, err := parseNewsletterJID(newsletterJID)
+	if err != nil {
+		return 0, err
+	}
+	if count <= 0 || count > maxNewsletterFetch {
+		count = maxNewsletterFetch
+	}
+
+	ctx, done := withTimeout(ctx, c.Timeouts.Request, "fetching channel messages")
+	messages, err := c.WA.GetNewsletterMessages(ctx, jid, &whatsmeow.GetNewsletterMessagesParams{Count: count})
+	if err = done(err); err != nil {
+		return 0, fmt.Errorf("failed to fetch channel messages: %w", err)
+	}
+	if len(messages) == 0 {
+		return 0, nil
+	}
+
+	latest := messages[0].Timestamp
+	for _, m := range messages {
+		if m.Timestamp.After(latest) {
+			latest = m.Timestamp
+		}
+	}
+	chatJID := jid.String()
+	if err := c.Store.StoreChat(chatJID, GetChatName(c, jid, chatJID, nil, ""), latest); err != nil {
+		return 0, fmt.Errorf("failed to store channel: %w", err)
+	}
+
+	stored := 0
+	for _, m := range messages {
+		if m.Message == nil {
+			continue
+		}
+		content := extractTextContent(m.Message)
+		mediaType, filename, url, mediaKey, fileSHA256, fileEncSHA256, fileLength := extractMediaInfo(m.Message)
+		if content == "" && mediaType == "" {
+			continue
+		}
+		id := string(m.MessageID)
+		if id == "" {
+			id = strconv.Itoa(int(m.MessageServerID))
+		}
+
+		record := db.MessageRecord{
+			ID:            id,
+			ChatJID:       chatJID,
+			Sender:        jid.User,
+			Content:       content,
+			Timestamp:     m.Timestamp,
+			Source:        db.SourceFetched,
+			MediaType:     mediaType,
+			Filename:      filename,
+			URL:           url,
+			MediaKey:      mediaKey,
+			FileSHA256:    fileSHA256,
+			FileEncSHA256: fileEncSHA256,
+			FileLength:    fileLength,
+			Location:      extractLocation(m.Message),
+			VCard:         extractVCard(m.Message),
+		}
+		record.MimeType, record.PageCount = extractMediaDetails(m.Message)
+		if err := c.Store.StoreMessage(record); err != nil {
+			c.Logger.Warnf("Failed to store channel message %s: %v", id, err)
+			continue
+		}
+		stored++
+	}
+	return stored, nil
+}
+
+// SendNewsletterMessage posts a text to a channel the account administers.
+func (c *Client) SendNewsletterMessage(ctx context.Context, newsletterJID, text string) (bool, string) {
+	if !c.IsConnected() {
+		return false, "Not connected to WhatsApp"
+	}
+	jid, err := parseNewsletterJID(newsletterJID)
+	if err != nil {
+		return false, err.Error()
+	}
+
+	meta, err := c.WA.GetNewsletterInfo(ctx, jid)
+	if err != nil {
+		return false, fmt.Sprintf("Failed to find channel: %v", err)
+	}
+	if meta.ViewerMeta == nil || (meta.ViewerMeta.Role != types.NewsletterRoleAdmin && meta.ViewerMeta.Role != types.NewsletterRoleOwner) {
+		return false, fmt.Sprintf("Cannot post to %s: only channel admins can post", meta.ThreadMeta.Name.Text)
+	}
+
+	note, ok := c.allowSend(jid)
+	if !ok {
+		return false, note
+	}
+
+	if _, err := c.sendTracked(ctx, jid, &waProto.Message{Conversation: proto.String(text)}); err != nil {
+		return false, fmt.Sprintf("Error posting to channel: %v%s", err, c.healthWarning())
+	}
+	return true, fmt.Sprintf("Posted to channel %s%s%s", meta.ThreadMeta.Name.Text, note, c.healthWarning())
+}
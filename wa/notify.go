@@ -0,0 +1,130 @@
+package wa
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// sendFailureAlertThreshold is the number of consecutive failed sends that triggers a notice.
+const sendFailureAlertThreshold = 3
+
+// eventNotifier forwards important account events as WhatsApp messages to a
+// designated chat, so the user notices on their phone when the bridge needs attention.
+// Notices that cannot be delivered right away are queued until the next connect.
+type eventNotifier struct {
+	chat string // "self" or a JID
+
+	mu               sync.Mutex
+	pending          []string
+	consecutiveFails int
+}
+
+// EnableEventNotifications forwards account events to chat ("self" = own chat).
+func (c *Client) EnableEventNotifications(chat string) {
+	c.notifier = &eventNotifier{chat: chat}
+}
+
+// notifyEvent turns a whatsmeow event into a notice, if it is one worth forwarding.
+func (c *Client) notifyEvent(evt interface{}) {
+	if c.notifier == nil {
+		return
+	}
+	switch v := evt.(type) {
+	case *events.LoggedOut:
+		c.queueNotice(fmt.Sprintf("Device was logged out (reason: %s). Re-pairing is needed.", v.Reason))
+	case *events.TemporaryBan:
+		c.queueNotice(fmt.Sprintf("WhatsApp temporarily banned this account: %s", v))
+	case *events.StreamReplaced:
+		c.queueNotice("Connection was replaced by another client using the same session.")
+	case *events.ClientOutdated:
+		c.queueNotice("WhatsApp rejected the connection because the client is outdated. Update wahoo.")
+	case *events.Connected:
+		c.goWork(c.flushNotices)
+	}
+}
+
+// recordSendOutcome counts consecutive send failures and raises a notice
+// once the threshold is reached.
+func (c *Client) recordSendOutcome(err error) {
+	n := c.notifier
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	if err == nil {
+		n.consecutiveFails = 0
+		n.mu.Unlock()
+		return
+	}
+	n.consecutiveFails++
+	alert := n.consecutiveFails == sendFailureAlertThreshold
+	n.mu.Unlock()
+
+	if alert {
+		c.queueNotice(fmt.Sprintf("%d sends in a row have failed. Last error: %v", sendFailureAlertThreshold, err))
+	}
+}
+
+// queueNotice delivers a notice now if possible, otherwise keeps it for the next connect.
+func (c *Client) queueNotice(text string) {
+	n := c.notifier
+	text = fmt.Sprintf("[wahoo %s] %s", time.Now().Format("2006-01-02 15:04"), text)
+	c.Logger.Warnf("Account notice: %s", text)
+
+	n.mu.Lock()
+	n.pending = append(n.pending, text)
+	n.mu.Unlock()
+
+	if c.IsConnected() {
+		c.goWork(c.flushNotices)
+	}
+}
+
+// flushNotices sends all queued notices; undelivered ones stay queued.
+func (c *Client) flushNotices() {
+	n := c.notifier
+	n.mu.Lock()
+	pending := n.pending
+	n.pending = nil
+	n.mu.Unlock()
+
+	for i, text := range pending {
+		if err := c.sendNotice(text); err != nil {
+			c.Logger.Warnf("Failed to deliver account notice: %v", err)
+			n.mu.Lock()
+			n.pending = append(pending[i:], n.pending...)
+			n.mu.Unlock()
+			return
+		}
+	}
+}
+
+// sendNotice sends a single notice to the configured chat.
+func (c *Client) sendNotice(text string) error {
+	if !c.IsConnected() || c.WA.Store.ID == nil {
+		return fmt.Errorf("not connected to WhatsApp")
+	}
+
+	var chat types.JID
+	if c.notifier.chat == "self" {
+		chat = c.WA.Store.ID.ToNonAD()
+	} else {
+		var err error
+		if chat, err = parseRecipient(c.notifier.chat); err != nil {
+			return err
+		}
+	}
+
+	ctx, done := withTimeout(context.Background(), c.Timeouts.Send, "sending the notice")
+	_, err := c.WA.SendMessage(ctx, chat, &waProto.Message{
+		Conversation: proto.String(text),
+	})
+	return done(err)
+}
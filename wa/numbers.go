@@ -0,0 +1,131 @@
+package wa
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/CSCSoftware/wahoo/db"
+)
+
+// MaxNumberChecks is the most numbers CheckNumbers looks up at once.
+const MaxNumberChecks = 100
+
+// NumberStatus is whether a phone number is registered on WhatsApp.
+type NumberStatus struct {
+	Number       string // as given
+	Phone        string // digits only, with country code
+	JID          string // empty if not on WhatsApp
+	OnWhatsApp   bool
+	IsBusiness   bool
+	BusinessName string
+	Cached       bool // answered from the cache instead of asking WhatsApp
+	CheckedAt    time.Time
+	Error        string // set if the number could not be checked
+}
+
+// normalizePhone reduces a phone number in international format to its
+// digits: "+49 (151) 234-567" and "0049151234567" both become
+// "49151234567".
+func normalizePhone(number string) (string, error) {
+	var digits strings.Builder
+	for _, r := range number {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case strings.ContainsRune("+-() ./", r):
+		default:
+			return "", fmt.Errorf("invalid phone number %q", number)
+		}
+	}
+	phone := strings.TrimPrefix(digits.String(), "00")
+	if len(phone) < 7 || len(phone) > 15 {
+		return "", fmt.Errorf("invalid phone number %q: expected 7 to 15 digits with country code", number)
+	}
+	return phone, nil
+}
+
+// CheckNumbers looks up which phone numbers are registered on WhatsApp.
+// Lookups newer than maxAge are answered from the cache; the rest are asked
+// in one query and cached.
+func (c *Client) CheckNumbers(ctx context.Context, numbers []string, maxAge time.Duration) ([]NumberStatus, error) {
+	if len(numbers) > MaxNumberChecks {
+		return nil, fmt.Errorf("at most %d numbers can be checked at once", MaxNumberChecks)
+	}
+
+	result := make([]NumberStatus, len(numbers))
+	var phones []string
+	for i, n := range numbers {
+		result[i].Number = n
+		phone, err := normalizePhone(n)
+		if err != nil {
+			result[i].Error = err.Error()
+			continue
+		}
+		result[i].Phone = phone
+		phones = append(phones, phone)
+	}
+
+	cached, err := c.Store.CachedNumberChecks(phones, time.Now().Add(-maxAge))
+	if err != nil {
+		return nil, err
+	}
+	var query []string
+	for _, phone := range phones {
+		if _, ok := cached[phone]; !ok {
+			query = append(query, "+"+phone)
+		}
+	}
+
+	checked := make(map[string]db.NumberCheck)
+	if len(query) > 0 {
+		if !c.IsConnected() {
+			return nil, fmt.Errorf("not connected to WhatsApp; %d of the numbers must be looked up", len(query))
+		}
+		ctx, done := withTimeout(ctx, c.Timeouts.Request, "checking the numbers")
+		resp, err := c.WA.IsOnWhatsApp(ctx, query)
+		if err = done(err); err != nil {
+			return nil, fmt.Errorf("check numbers: %w", err)
+		}
+		now := time.Now()
+		for _, r := range resp {
+			check := db.NumberCheck{
+				Phone:      strings.TrimPrefix(r.Query, "+"),
+				OnWhatsApp: r.IsIn,
+				CheckedAt:  now,
+			}
+			if r.IsIn {
+				check.JID = r.JID.ToNonAD().String()
+			}
+			if r.VerifiedName != nil {
+				check.BusinessName = r.VerifiedName.Details.GetVerifiedName()
+			}
+			checked[check.Phone] = check
+			if err := c.Store.StoreNumberCheck(check); err != nil {
+				c.Logger.Warnf("Failed to cache number check: %v", err)
+			}
+		}
+	}
+
+	for i := range result {
+		if result[i].Error != "" {
+			continue
+		}
+		check, isCached := cached[result[i].Phone]
+		if !isCached {
+			var ok bool
+			if check, ok = checked[result[i].Phone]; !ok {
+				result[i].Error = "no answer from WhatsApp"
+				continue
+			}
+		}
+		result[i].JID = check.JID
+		result[i].OnWhatsApp = check.OnWhatsApp
+		result[i].IsBusiness = check.BusinessName != ""
+		result[i].BusinessName = check.BusinessName
+		result[i].Cached = isCached
+		result[i].CheckedAt = check.CheckedAt
+	}
+	return result, nil
+}
@@ -0,0 +1,348 @@
+//go:build opusenc
+
+package wa
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"slices"
+
+	"github.com/jj11hh/opus"
+)
+
+// Voice messages are encoded in-process as mono Opus at opusBitrate, like the
+// ffmpeg conversion, in frames of opusFrameMillis. opusPreSkip is the
+// encoder's lookahead at 48 kHz, which players skip.
+const (
+	opusBitrate        = 32000
+	opusFrameMillis    = 20
+	opusPreSkip        = 312
+	opusPacketsPerPage = 50
+)
+
+// opusSampleRates are the rates the Opus encoder takes; audio at other rates
+// is resampled to 48 kHz.
+var opusSampleRates = []int{8000, 12000, 16000, 24000, 48000}
+
+// encodeOpusOgg converts a 16-bit PCM WAV file to OGG Opus without ffmpeg,
+// using an Opus encoder that runs as WebAssembly in-process.
+func encodeOpusOgg(inputPath string) (string, error) {
+	in, err := os.Open(inputPath)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	format, data, err := readWAV(bufio.NewReader(in))
+	if err != nil {
+		return "", fmt.Errorf("%w (without ffmpeg only 16-bit PCM WAV can be converted)", err)
+	}
+
+	rate := format.sampleRate
+	if !slices.Contains(opusSampleRates, rate) {
+		rate = 48000
+	}
+	enc, err := opus.NewEncoder(rate, 1, opus.AppVoIP)
+	if err != nil {
+		return "", fmt.Errorf("creating Opus encoder: %w", err)
+	}
+	if err := enc.SetBitrate(opusBitrate); err != nil {
+		return "", fmt.Errorf("creating Opus encoder: %w", err)
+	}
+
+	outPath := inputPath + ".ogg"
+	out, err := os.Create(outPath)
+	if err != nil {
+		return "", err
+	}
+	if err := writeOpusOgg(out, enc, newPCMReader(data, format, rate), format.sampleRate, rate); err != nil {
+		out.Close()
+		os.Remove(outPath)
+		return "", err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(outPath)
+		return "", err
+	}
+	return outPath, nil
+}
+
+// writeOpusOgg encodes mono PCM at rate into an Ogg Opus stream. inputRate is
+// the rate of the original audio, recorded in the header.
+func writeOpusOgg(out io.Writer, enc *opus.Encoder, pcm *pcmReader, inputRate, rate int) error {
+	bw := bufio.NewWriter(out)
+	w := &oggWriter{w: bw, serial: rand.Uint32()}
+
+	head := make([]byte, 19)
+	copy(head, "OpusHead")
+	head[8] = 1 // version
+	head[9] = 1 // channels
+	binary.LittleEndian.PutUint16(head[10:], opusPreSkip)
+	binary.LittleEndian.PutUint32(head[12:], uint32(inputRate))
+	if err := w.writePacket(head, 0); err != nil {
+		return err
+	}
+	if err := w.flush(0); err != nil {
+		return err
+	}
+	const vendor = "wahoo"
+	tags := binary.LittleEndian.AppendUint32([]byte("OpusTags"), uint32(len(vendor)))
+	tags = binary.LittleEndian.AppendUint32(append(tags, vendor...), 0)
+	if err := w.writePacket(tags, 0); err != nil {
+		return err
+	}
+	if err := w.flush(0); err != nil {
+		return err
+	}
+
+	// Granule positions count samples at 48 kHz whatever the encoding rate
+	frame := make([]int16, rate*opusFrameMillis/1000)
+	packet := make([]byte, 4000)
+	var encoded, samples int64 // in 48 kHz samples
+	encode := func(granule int64) error {
+		size, err := enc.Encode(frame, packet)
+		if err != nil {
+			return fmt.Errorf("encoding audio: %w", err)
+		}
+		encoded += 48 * opusFrameMillis
+		return w.writePacket(packet[:size], opusPreSkip+granule)
+	}
+	for {
+		n, err := pcm.read(frame)
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("reading audio: %w", err)
+		}
+		if n > 0 {
+			clear(frame[n:])
+			samples += int64(n) * 48000 / int64(rate)
+			if err := encode(min(encoded+48*opusFrameMillis, samples)); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	if samples == 0 {
+		return fmt.Errorf("no audio samples")
+	}
+	// A last silent frame makes up for the lookahead, so the end of the audio
+	// comes out of the decoder too
+	clear(frame)
+	if err := encode(samples); err != nil {
+		return err
+	}
+	if err := w.flush(oggEndOfStream); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// wavFormat describes the samples of a WAV file.
+type wavFormat struct {
+	sampleRate int
+	channels   int
+}
+
+// readWAV reads the header of a 16-bit PCM WAV file and returns the reader of
+// its samples.
+func readWAV(r io.Reader) (wavFormat, io.Reader, error) {
+	var format wavFormat
+	var riff [12]byte
+	if _, err := io.ReadFull(r, riff[:]); err != nil || string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return format, nil, fmt.Errorf("not a WAV file")
+	}
+	haveFormat := false
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(r, chunk[:]); err != nil {
+			return format, nil, fmt.Errorf("WAV file has no audio data")
+		}
+		id, size := string(chunk[0:4]), int64(binary.LittleEndian.Uint32(chunk[4:]))
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return format, nil, fmt.Errorf("invalid WAV format chunk")
+			}
+			body := make([]byte, size)
+			if _, err := io.ReadFull(r, body); err != nil {
+				return format, nil, fmt.Errorf("invalid WAV format chunk")
+			}
+			codec := binary.LittleEndian.Uint16(body[0:])
+			if codec == 0xFFFE && size >= 26 { // extensible: the sub-format follows
+				codec = binary.LittleEndian.Uint16(body[24:])
+			}
+			format.channels = int(binary.LittleEndian.Uint16(body[2:]))
+			format.sampleRate = int(binary.LittleEndian.Uint32(body[4:]))
+			bits := binary.LittleEndian.Uint16(body[14:])
+			if codec != 1 || bits != 16 || format.channels == 0 || format.sampleRate == 0 {
+				return format, nil, fmt.Errorf("unsupported WAV encoding")
+			}
+			haveFormat = true
+		case "data":
+			if !haveFormat {
+				return format, nil, fmt.Errorf("WAV file has no format chunk")
+			}
+			return format, io.LimitReader(r, size), nil
+		default:
+			if _, err := io.CopyN(io.Discard, r, size); err != nil {
+				return format, nil, fmt.Errorf("WAV file has no audio data")
+			}
+		}
+		if size%2 == 1 { // chunks are padded to an even size
+			if _, err := io.CopyN(io.Discard, r, 1); err != nil {
+				return format, nil, fmt.Errorf("WAV file has no audio data")
+			}
+		}
+	}
+}
+
+// pcmReader reads 16-bit PCM, mixing it down to mono and resampling it
+// linearly to the encoding rate.
+type pcmReader struct {
+	r          io.Reader
+	channels   int
+	step       float64 // input samples per output sample
+	pos        float64 // of the next output sample between prev and next
+	prev, next float64
+	buf        []byte
+}
+
+func newPCMReader(r io.Reader, format wavFormat, rate int) *pcmReader {
+	return &pcmReader{
+		r:        r,
+		channels: format.channels,
+		step:     float64(format.sampleRate) / float64(rate),
+		pos:      2,
+		buf:      make([]byte, 2*format.channels),
+	}
+}
+
+// sample reads the next input sample, averaged across channels.
+func (p *pcmReader) sample() (float64, error) {
+	if _, err := io.ReadFull(p.r, p.buf); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		return 0, err
+	}
+	var sum float64
+	for ch := range p.channels {
+		sum += float64(int16(binary.LittleEndian.Uint16(p.buf[2*ch:])))
+	}
+	return sum / float64(p.channels), nil
+}
+
+// read fills out with samples, returning io.EOF with the last ones.
+func (p *pcmReader) read(out []int16) (int, error) {
+	for i := range out {
+		if p.step == 1 {
+			s, err := p.sample()
+			if err != nil {
+				return i, err
+			}
+			out[i] = int16(s)
+			continue
+		}
+		for p.pos >= 1 {
+			s, err := p.sample()
+			if err != nil {
+				return i, err
+			}
+			p.prev, p.next = p.next, s
+			p.pos--
+		}
+		out[i] = int16(p.prev + (p.next-p.prev)*p.pos)
+		p.pos += p.step
+	}
+	return len(out), nil
+}
+
+// Ogg page flags.
+const (
+	oggBeginningOfStream = 0x02
+	oggEndOfStream       = 0x04
+)
+
+// oggWriter writes packets into the pages of an Ogg stream, up to
+// opusPacketsPerPage packets per page.
+type oggWriter struct {
+	w        io.Writer
+	serial   uint32
+	seq      uint32
+	granule  int64
+	segments []byte
+	data     []byte
+	packets  int
+}
+
+// writePacket adds a packet to the current page, first writing the page out
+// if it is full. granule is the stream position at the end of the packet.
+func (o *oggWriter) writePacket(packet []byte, granule int64) error {
+	if len(o.segments)+len(packet)/255+1 > 255 || o.packets == opusPacketsPerPage {
+		if err := o.flush(0); err != nil {
+			return err
+		}
+	}
+	for n := len(packet); ; n -= 255 {
+		if n < 255 {
+			o.segments = append(o.segments, byte(n))
+			break
+		}
+		o.segments = append(o.segments, 255)
+	}
+	o.data = append(o.data, packet...)
+	o.granule = granule
+	o.packets++
+	return nil
+}
+
+// flush writes out the current page with flags.
+func (o *oggWriter) flush(flags byte) error {
+	if o.seq == 0 {
+		flags |= oggBeginningOfStream
+	}
+	page := make([]byte, 27, 27+len(o.segments)+len(o.data))
+	copy(page, "OggS")
+	page[5] = flags
+	binary.LittleEndian.PutUint64(page[6:], uint64(o.granule))
+	binary.LittleEndian.PutUint32(page[14:], o.serial)
+	binary.LittleEndian.PutUint32(page[18:], o.seq)
+	page[26] = byte(len(o.segments))
+	page = append(append(page, o.segments...), o.data...)
+	binary.LittleEndian.PutUint32(page[22:], oggCRC(page))
+	if _, err := o.w.Write(page); err != nil {
+		return err
+	}
+	o.seq++
+	o.segments, o.data, o.packets = o.segments[:0], o.data[:0], 0
+	return nil
+}
+
+// oggCRCTable is the table of Ogg's CRC-32: polynomial 0x04c11db7, unreflected.
+var oggCRCTable = func() (table [256]uint32) {
+	for i := range table {
+		r := uint32(i) << 24
+		for range 8 {
+			if r&0x80000000 != 0 {
+				r = r<<1 ^ 0x04c11db7
+			} else {
+				r <<= 1
+			}
+		}
+		table[i] = r
+	}
+	return table
+}()
+
+// oggCRC computes the checksum of a page, whose checksum field is zero.
+func oggCRC(page []byte) uint32 {
+	var crc uint32
+	for _, b := range page {
+		crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^b]
+	}
+	return crc
+}
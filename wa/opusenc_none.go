@@ -0,0 +1,11 @@
+//go:build !opusenc
+
+package wa
+
+import "errors"
+
+// encodeOpusOgg is the in-process Opus encoder used without ffmpeg, which
+// this build leaves out.
+func encodeOpusOgg(inputPath string) (string, error) {
+	return "", errors.New("ffmpeg is not installed, and this build has no built-in Opus encoder (build with -tags opusenc)")
+}
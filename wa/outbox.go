@@ -0,0 +1,185 @@
+package wa
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/CSCSoftware/wahoo/db"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// maxSendAttempts is how often a text send is tried before it is abandoned.
+const maxSendAttempts = 5
+
+// Failed sends are retried after retryBackoff, doubling with every attempt
+// up to maxRetryBackoff.
+const (
+	retryBackoff    = 30 * time.Second
+	maxRetryBackoff = 30 * time.Minute
+)
+
+// nextRetry returns when a send that has failed attempts times is retried.
+func nextRetry(attempts int) time.Time {
+	backoff := maxRetryBackoff
+	if attempts < 16 {
+		backoff = min(retryBackoff<<(attempts-1), maxRetryBackoff)
+	}
+	return time.Now().Add(backoff)
+}
+
+// attemptSend sends a text mentioning mentions to recipientJID and records
+// the outcome for sendID (0 = untracked), which has been attempted attempts
+// times before. A send that timed out is recorded as unconfirmed rather than
+// failed, since retrying it could deliver the message twice.
+func (c *Client) attemptSend(ctx context.Context, sendID int64, attempts int, recipientJID, message string, mentions []string) error {
+	if sendID != 0 {
+		noteSendAttempt(ctx)
+	}
+	var msgID string
+	err := fmt.Errorf("not connected to WhatsApp")
+
+	if c.IsConnected() {
+		var jid types.JID
+		jid, err = types.ParseJID(recipientJID)
+		if err == nil {
+			var resp whatsmeow.SendResponse
+			resp, err = c.sendTracked(ctx, jid, textMessage(message, mentions))
+			msgID = resp.ID
+		}
+	}
+
+	if err == nil {
+		c.DupGuard.Record(recipientJID, message)
+	}
+	c.recordSendOutcome(err)
+	if sendID != 0 {
+		var uerr error
+		if IsTimeout(err) {
+			uerr = c.Store.MarkSendUnconfirmed(sendID, msgID, err)
+		} else {
+			uerr = c.Store.UpdateSendResult(sendID, msgID, err, maxSendAttempts, nextRetry(attempts+1))
+		}
+		if uerr != nil {
+			c.Logger.Warnf("Failed to update send %d: %v", sendID, uerr)
+		}
+	}
+	return err
+}
+
+// RetryFailedSends retries every send currently in the failed state,
+// regardless of when it is due.
+func (c *Client) RetryFailedSends() (retried, succeeded int, err error) {
+	sends, err := c.Store.ListFailedSends()
+	if err != nil {
+		return 0, 0, err
+	}
+	retried, succeeded = c.retrySends(sends)
+	return retried, succeeded, nil
+}
+
+// FlushOutbox sends all queued messages and retries the failed sends that
+// are due. It does nothing while disconnected.
+func (c *Client) FlushOutbox() (retried, succeeded int, err error) {
+	if !c.IsConnected() {
+		return 0, 0, nil
+	}
+	sends, err := c.Store.ListDueSends(time.Now())
+	if err != nil {
+		return 0, 0, err
+	}
+	retried, succeeded = c.retrySends(sends)
+	return retried, succeeded, nil
+}
+
+// retrySends attempts each send that is still waiting in the outbox,
+// stopping if the connection drops.
+func (c *Client) retrySends(sends []db.SendDict) (retried, succeeded int) {
+	for _, s := range sends {
+		if !c.IsConnected() {
+			break
+		}
+		// The send policy may have changed since the message was queued
+		if jid, err := types.ParseJID(s.Recipient); err == nil {
+			if reason := c.checkRecipient(jid); reason != "" {
+				if _, err := c.Store.CancelSend(s.ID); err != nil {
+					c.Logger.Warnf("Failed to cancel send %d: %v", s.ID, err)
+				}
+				c.Logger.Warnf("Cancelled send %d: %s", s.ID, reason)
+				continue
+			}
+		}
+		claimed, err := c.Store.ClaimSend(s.ID)
+		if err != nil {
+			c.Logger.Warnf("Failed to claim send %d: %v", s.ID, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		retried++
+		if c.attemptSend(context.Background(), s.ID, s.Attempts, s.Recipient, s.Content, s.Mentions) == nil {
+			succeeded++
+		}
+	}
+	return retried, succeeded
+}
+
+// flushOutboxOnConnect sends the messages queued while disconnected.
+func (c *Client) flushOutboxOnConnect() {
+	retried, succeeded, err := c.FlushOutbox()
+	if err != nil {
+		c.Logger.Warnf("Outbox flush failed: %v", err)
+	} else if retried > 0 {
+		fmt.Fprintf(os.Stderr, "Outbox: sent %d of %d queued sends after reconnecting\n", succeeded, retried)
+	}
+}
+
+// resetInterruptedSends marks the sends that were still pending when an
+// earlier run stopped as unconfirmed, so they neither stay pending forever nor
+// get sent twice. Sends pending for less than the send timeout may still be
+// in flight in another process and are left alone.
+func (c *Client) resetInterruptedSends() {
+	timeout := c.Timeouts.Send
+	if timeout <= 0 {
+		timeout = DefaultTimeouts.Send
+	}
+	n, err := c.Store.ResetInterruptedSends(time.Now().Add(-timeout))
+	if err != nil {
+		c.Logger.Warnf("Failed to reset interrupted sends: %v", err)
+	} else if n > 0 {
+		fmt.Fprintf(os.Stderr, "Outbox: %d sends were interrupted by a restart and are marked unconfirmed\n", n)
+	}
+}
+
+// StartOutboxWorker periodically sends queued messages and retries failed
+// sends that are due while connected, until ctx is done. It also flags the
+// messages whose timed-out send was never acknowledged. Sends left pending
+// by an earlier run are marked unconfirmed first. Close waits for it.
+func (c *Client) StartOutboxWorker(ctx context.Context, interval time.Duration) {
+	c.goWork(func() {
+		c.resetInterruptedSends()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.flagUnconfirmedMessages()
+				if !c.IsConnected() {
+					continue
+				}
+				retried, succeeded, err := c.FlushOutbox()
+				if err != nil {
+					c.Logger.Warnf("Outbox retry failed: %v", err)
+				} else if retried > 0 {
+					fmt.Fprintf(os.Stderr, "Outbox: retried %d failed sends, %d succeeded\n", retried, succeeded)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,88 @@
+package wa
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+
+	"github.com/CSCSoftware/wahoo/db"
+)
+
+// Humanized pacing parameters. Typing speed is that of a fast phone typist;
+// every duration gets ±25% jitter so consecutive messages never line up.
+const (
+	typingCharsPerSecond = 5.0
+	minTypingDuration    = 1500 * time.Millisecond
+	maxTypingDuration    = 20 * time.Second
+	minMessageGap        = 2 * time.Second
+	maxMessageGap        = 6 * time.Second
+)
+
+// sendPacer remembers when each chat was last sent a humanized message.
+type sendPacer struct {
+	mu       sync.Mutex
+	lastSend map[string]time.Time
+}
+
+// jitter returns d scaled by a random factor between 0.75 and 1.25.
+func jitter(d time.Duration) time.Duration {
+	return time.Duration(float64(d) * (0.75 + rand.Float64()/2))
+}
+
+// typingDuration estimates how long typing text takes on a phone.
+func typingDuration(text string) time.Duration {
+	d := time.Duration(float64(len([]rune(text))) / typingCharsPerSecond * float64(time.Second))
+	return jitter(min(max(d, minTypingDuration), maxTypingDuration))
+}
+
+// paceSend delays a text send to jid if its chat uses the humanize profile:
+// it keeps a randomized gap after the previous message, then shows the typing
+// indicator for as long as typing the text would take. It returns ctx's error
+// if ctx is done before the message is due.
+func (c *Client) paceSend(ctx context.Context, jid types.JID, text string) error {
+	chatJID := jid.String()
+	if !c.IsConnected() || c.Store.ChatSendProfile(chatJID) != db.SendProfileHumanize {
+		return nil
+	}
+
+	gap := minMessageGap + time.Duration(rand.Int63n(int64(maxMessageGap-minMessageGap)))
+	c.pacer.mu.Lock()
+	last := c.pacer.lastSend[chatJID]
+	c.pacer.mu.Unlock()
+	if wait := gap - time.Since(last); wait > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+
+	if err := c.sendChatPresence(ctx, jid, types.ChatPresenceComposing); err != nil {
+		c.Logger.Warnf("Failed to send typing indicator to %s: %v", chatJID, err)
+	}
+	select {
+	case <-ctx.Done():
+		_ = c.sendChatPresence(context.Background(), jid, types.ChatPresencePaused)
+		return ctx.Err()
+	case <-time.After(typingDuration(text)):
+	}
+	_ = c.sendChatPresence(ctx, jid, types.ChatPresencePaused)
+
+	c.pacer.mu.Lock()
+	if c.pacer.lastSend == nil {
+		c.pacer.lastSend = make(map[string]time.Time)
+	}
+	c.pacer.lastSend[chatJID] = time.Now()
+	c.pacer.mu.Unlock()
+	return nil
+}
+
+// sendChatPresence shows or clears the typing indicator in the chat with jid
+// within the request timeout.
+func (c *Client) sendChatPresence(ctx context.Context, jid types.JID, state types.ChatPresence) error {
+	ctx, done := withTimeout(ctx, c.Timeouts.Request, "sending the typing indicator")
+	return done(c.WA.SendChatPresence(ctx, jid, state, types.ChatPresenceMediaText))
+}
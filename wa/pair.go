@@ -0,0 +1,36 @@
+package wa
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.mau.fi/whatsmeow"
+)
+
+// pairingClientName is the browser shown on the phone for code pairing.
+// WhatsApp only accepts common "Browser (OS)" combinations.
+const pairingClientName = "Chrome (Linux)"
+
+// RequestPairingCode asks WhatsApp for the 8-character code that links this
+// device when typed into the phone, as an alternative to scanning the QR code.
+// The client must be connected and waiting for pairing.
+func (c *Client) RequestPairingCode(phone string) (string, error) {
+	if c.WA.Store.ID != nil {
+		return "", fmt.Errorf("already paired")
+	}
+	if !c.WA.IsConnected() {
+		return "", fmt.Errorf("not connected to WhatsApp")
+	}
+
+	phone = strings.TrimPrefix(phone, "+")
+	code, err := c.WA.PairPhone(context.Background(), phone, true, whatsmeow.PairClientChrome, pairingClientName)
+	if err != nil {
+		return "", fmt.Errorf("failed to request pairing code: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "\nPairing code for %s: %s\n", phone, code)
+	fmt.Fprintln(os.Stderr, "On your phone open WhatsApp > Linked devices > Link a device > Link with phone number instead, and enter the code.")
+	return code, nil
+}
@@ -0,0 +1,115 @@
+package wa
+
+import (
+	"time"
+
+	"github.com/CSCSoftware/wahoo/db"
+
+	"go.mau.fi/whatsmeow"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// unconfirmedAfter is how long a message whose send timed out stays pending
+// before it is flagged as unconfirmed.
+const unconfirmedAfter = 10 * time.Minute
+
+// storePending stores a message we are about to send under its ID, flagged
+// as pending, so it is listed right away rather than once its echo arrives.
+// Statuses and channel posts are left to their own handlers. Reports whether
+// the message was stored.
+func (c *Client) storePending(to types.JID, id types.MessageID, msg *waProto.Message) bool {
+	if to == types.StatusBroadcastJID || to.Server == types.NewsletterServer || c.WA.Store.ID == nil {
+		return false
+	}
+	content := extractTextContent(msg)
+	mediaType, filename, url, mediaKey, fileSHA256, fileEncSHA256, fileLength := extractMediaInfo(msg)
+	if content == "" && mediaType == "" {
+		return false
+	}
+
+	chatJID := to.String()
+	now := time.Now()
+	if err := c.Store.StoreChat(chatJID, GetChatName(c, to, chatJID, nil, ""), now); err != nil {
+		c.Logger.Warnf("Failed to store chat: %v", err)
+	}
+	quotedID, quotedSender := extractQuote(msg)
+	record := db.MessageRecord{
+		ID:              id,
+		ChatJID:         chatJID,
+		Sender:          c.WA.Store.ID.User,
+		Content:         content,
+		Timestamp:       now,
+		IsFromMe:        true,
+		Source:          db.SourceLive,
+		SenderTimestamp: &now,
+		MediaType:       mediaType,
+		Filename:        filename,
+		URL:             url,
+		MediaKey:        mediaKey,
+		FileSHA256:      fileSHA256,
+		FileEncSHA256:   fileEncSHA256,
+		FileLength:      fileLength,
+		Location:        extractLocation(msg),
+		VCard:           extractVCard(msg),
+		QuotedMessageID: quotedID,
+		QuotedSender:    quotedSender,
+		MentionedJIDs:   extractMentions(msg),
+		Pending:         true,
+	}
+	record.MimeType, record.PageCount = extractMediaDetails(msg)
+	if err := c.Store.StoreMessage(record); err != nil {
+		c.Logger.Warnf("Failed to store sent message: %v", err)
+		return false
+	}
+	return true
+}
+
+// settlePending reconciles a message stored by storePending with the outcome
+// of its send: an acknowledged message is confirmed with the server
+// timestamp, a failed one deleted, as failed texts are tracked in the sends
+// table and retried under a new ID. A send that timed out may still have
+// gone through, so its message stays pending until its echo or a receipt
+// arrives; see confirmDelivered and flagUnconfirmedMessages.
+func (c *Client) settlePending(to types.JID, id types.MessageID, resp whatsmeow.SendResponse, err error) {
+	chatJID := to.String()
+	if IsTimeout(err) {
+		return
+	}
+	if err != nil {
+		if err := c.Store.DeletePendingMessage(id, chatJID); err != nil {
+			c.Logger.Warnf("Failed to delete unsent message %s: %v", id, err)
+		}
+		return
+	}
+	if err := c.Store.ConfirmSentMessage(id, chatJID, resp.Timestamp); err != nil {
+		c.Logger.Warnf("Failed to confirm sent message %s: %v", id, err)
+		return
+	}
+	if c.OnMessage != nil {
+		c.OnMessage(chatJID, id)
+	}
+}
+
+// confirmDelivered settles the messages a receipt names, as the receipt shows
+// WhatsApp received them even if their send timed out.
+func (c *Client) confirmDelivered(evt *events.Receipt) {
+	if err := c.Store.ConfirmDeliveredMessages(evt.MessageIDs); err != nil {
+		c.Logger.Warnf("Failed to confirm delivered messages: %v", err)
+	}
+	if err := c.Store.ConfirmUnconfirmedSends(evt.MessageIDs); err != nil {
+		c.Logger.Warnf("Failed to confirm sends: %v", err)
+	}
+}
+
+// flagUnconfirmedMessages flags the messages that stayed pending for longer
+// than unconfirmedAfter, so they no longer look like sends in progress.
+func (c *Client) flagUnconfirmedMessages() {
+	n, err := c.Store.FlagUnconfirmedMessages(time.Now().Add(-unconfirmedAfter))
+	if err != nil {
+		c.Logger.Warnf("Failed to flag unconfirmed messages: %v", err)
+	} else if n > 0 {
+		c.Logger.Warnf("%d sent messages were never acknowledged by WhatsApp and are flagged as unconfirmed", n)
+	}
+}
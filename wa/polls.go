@@ -0,0 +1,119 @@
+package wa
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+
+	"go.mau.fi/whatsmeow"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// CreatePoll sends a poll to a recipient. multiSelect allows voters to pick
+// any number of options; otherwise only one.
+func (c *Client) CreatePoll(ctx context.Context, recipient, question string, options []string, multiSelect bool) (bool, string) {
+	if !c.IsConnected() {
+		return false, "Not connected to WhatsApp"
+	}
+	if len(options) < 2 {
+		return false, "A poll needs at least 2 options"
+	}
+
+	jid, err := parseRecipient(recipient)
+	if err != nil {
+		return false, err.Error()
+	}
+
+	note, ok := c.allowSend(jid)
+	if !ok {
+		return false, note
+	}
+
+	selectable := 1
+	if multiSelect {
+		selectable = 0
+	}
+
+	msg := c.WA.BuildPollCreation(question, options, selectable)
+	resp, err := c.sendTracked(ctx, jid, msg)
+	if err != nil {
+		return false, fmt.Sprintf("Error sending poll: %v%s", err, c.healthWarning())
+	}
+
+	if err := c.Store.StorePoll(resp.ID, jid.String(), c.WA.Store.ID.User, question, options, selectable, resp.Timestamp); err != nil {
+		c.Logger.Warnf("Failed to store poll: %v", err)
+	}
+
+	return true, fmt.Sprintf("Poll %s sent to %s%s%s", resp.ID, recipient, note, c.healthWarning())
+}
+
+// pollCreation returns the poll creation payload of a message, whichever version it uses.
+func pollCreation(msg *waProto.Message) *waProto.PollCreationMessage {
+	if poll := msg.GetPollCreationMessage(); poll != nil {
+		return poll
+	}
+	if poll := msg.GetPollCreationMessageV2(); poll != nil {
+		return poll
+	}
+	return msg.GetPollCreationMessageV3()
+}
+
+// pollOptionNames returns the option names of a poll in order.
+func pollOptionNames(poll *waProto.PollCreationMessage) []string {
+	options := make([]string, 0, len(poll.GetOptions()))
+	for _, opt := range poll.GetOptions() {
+		options = append(options, opt.GetOptionName())
+	}
+	return options
+}
+
+// handlePollCreation stores an incoming poll so later votes can be decoded.
+func handlePollCreation(c *Client, msg *events.Message, poll *waProto.PollCreationMessage) {
+	err := c.Store.StorePoll(
+		msg.Info.ID, msg.Info.Chat.String(), msg.Info.Sender.User,
+		poll.GetName(), pollOptionNames(poll), int(poll.GetSelectableOptionsCount()), msg.Info.Timestamp,
+	)
+	if err != nil {
+		c.Logger.Warnf("Failed to store poll: %v", err)
+	}
+}
+
+// handlePollVote decrypts a poll vote and records the voter's current selection.
+func handlePollVote(c *Client, msg *events.Message) {
+	update := msg.Message.GetPollUpdateMessage()
+	pollID := update.GetPollCreationMessageKey().GetID()
+	chatJID := msg.Info.Chat.String()
+
+	options, err := c.Store.GetPollOptions(pollID, chatJID)
+	if err != nil {
+		c.Logger.Warnf("Vote for unknown poll %s in %s", pollID, chatJID)
+		return
+	}
+
+	vote, err := c.WA.DecryptPollVote(context.Background(), msg)
+	if err != nil {
+		c.Logger.Warnf("Failed to decrypt poll vote: %v", err)
+		return
+	}
+
+	hashes := whatsmeow.HashPollOptions(options)
+	selected := []string{}
+	for _, hash := range vote.GetSelectedOptions() {
+		for i, optHash := range hashes {
+			if bytes.Equal(hash, optHash) {
+				selected = append(selected, options[i])
+				break
+			}
+		}
+	}
+
+	if err := c.Store.StorePollVote(pollID, chatJID, msg.Info.Sender.User, selected, msg.Info.Timestamp); err != nil {
+		c.Logger.Warnf("Failed to store poll vote: %v", err)
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "[%s] Poll vote in %s by %s: %v\n",
+		msg.Info.Timestamp.Format("2006-01-02 15:04:05"), chatJID, msg.Info.Sender.User, selected)
+}
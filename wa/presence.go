@@ -0,0 +1,202 @@
+package wa
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// PresenceStatus is the last known presence of a contact.
+type PresenceStatus struct {
+	JID      string
+	Known    bool // false if no presence update has been received
+	Online   bool
+	LastSeen time.Time // zero if hidden or unknown
+	Error    string    // set if the presence subscription failed
+}
+
+// presenceTracker remembers the latest presence event per user.
+type presenceTracker struct {
+	mu     sync.Mutex
+	latest map[string]events.Presence
+}
+
+func (t *presenceTracker) update(evt *events.Presence) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.latest == nil {
+		t.latest = make(map[string]events.Presence)
+	}
+	t.latest[evt.From.ToNonAD().String()] = *evt
+}
+
+func (t *presenceTracker) get(jid string) (events.Presence, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p, ok := t.latest[jid]
+	return p, ok
+}
+
+// GetPresenceSnapshot subscribes to the presence of each recipient, waits up
+// to wait for updates to arrive and returns the consolidated state. It returns
+// early once every contact has reported.
+func (c *Client) GetPresenceSnapshot(ctx context.Context, recipients []string, wait time.Duration) ([]PresenceStatus, error) {
+	if !c.IsConnected() {
+		return nil, fmt.Errorf("not connected to WhatsApp")
+	}
+
+	c.sendOwnPresence(ctx)
+
+	result := make([]PresenceStatus, len(recipients))
+	pending := 0
+	for i, r := range recipients {
+		jid, err := parseRecipient(r)
+		if err != nil {
+			result[i] = PresenceStatus{JID: r, Error: err.Error()}
+			continue
+		}
+		result[i].JID = jid.ToNonAD().String()
+		if err := c.subscribePresence(ctx, jid); err != nil {
+			result[i].Error = fmt.Sprintf("subscribe failed: %v", err)
+			continue
+		}
+		pending++
+	}
+
+	deadline := time.Now().Add(wait)
+	for pending > 0 && time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(200 * time.Millisecond):
+		}
+		pending = 0
+		for _, st := range result {
+			if _, ok := c.presence.get(st.JID); !ok && st.Error == "" {
+				pending++
+			}
+		}
+	}
+
+	for i, st := range result {
+		if st.Error != "" {
+			continue
+		}
+		if p, ok := c.presence.get(st.JID); ok {
+			result[i].Known = true
+			result[i].Online = !p.Unavailable
+			result[i].LastSeen = p.LastSeen
+		}
+	}
+	return result, nil
+}
+
+// storePresence records a presence update for get_contact_presence.
+func (c *Client) storePresence(evt *events.Presence) {
+	err := c.Store.StorePresence(evt.From.ToNonAD().String(), !evt.Unavailable, evt.LastSeen, time.Now())
+	if err != nil {
+		c.Logger.Warnf("Failed to store presence: %v", err)
+	}
+}
+
+// PresenceSubscription is the outcome of subscribing to one contact.
+type PresenceSubscription struct {
+	JID   string
+	Error string // set if the subscription failed
+}
+
+// SubscribePresence subscribes to the presence of each recipient and keeps
+// the subscriptions across reconnects, so their updates are recorded until
+// UnsubscribePresence is called.
+func (c *Client) SubscribePresence(ctx context.Context, recipients []string) ([]PresenceSubscription, error) {
+	if !c.IsConnected() {
+		return nil, fmt.Errorf("not connected to WhatsApp")
+	}
+	c.sendOwnPresence(ctx)
+
+	result := make([]PresenceSubscription, len(recipients))
+	for i, r := range recipients {
+		jid, err := parseRecipient(r)
+		if err != nil {
+			result[i] = PresenceSubscription{JID: r, Error: err.Error()}
+			continue
+		}
+		jid = jid.ToNonAD()
+		result[i].JID = jid.String()
+		if err := c.subscribePresence(ctx, jid); err != nil {
+			result[i].Error = fmt.Sprintf("subscribe failed: %v", err)
+			continue
+		}
+		if err := c.Store.AddPresenceSubscription(jid.String(), time.Now()); err != nil {
+			result[i].Error = err.Error()
+		}
+	}
+	return result, nil
+}
+
+// UnsubscribePresence stops renewing the presence subscriptions of the
+// recipients. WhatsApp has no unsubscribe, so updates may still arrive
+// until the next reconnect.
+func (c *Client) UnsubscribePresence(recipients []string) []PresenceSubscription {
+	result := make([]PresenceSubscription, len(recipients))
+	for i, r := range recipients {
+		jid, err := parseRecipient(r)
+		if err != nil {
+			result[i] = PresenceSubscription{JID: r, Error: err.Error()}
+			continue
+		}
+		result[i].JID = jid.ToNonAD().String()
+		removed, err := c.Store.RemovePresenceSubscription(result[i].JID)
+		switch {
+		case err != nil:
+			result[i].Error = err.Error()
+		case !removed:
+			result[i].Error = "not subscribed"
+		}
+	}
+	return result
+}
+
+// renewPresenceSubscriptions subscribes again to the stored presence
+// subscriptions, which WhatsApp drops when the connection ends.
+func (c *Client) renewPresenceSubscriptions() {
+	jids, err := c.Store.PresenceSubscriptions()
+	if err != nil {
+		c.Logger.Warnf("Failed to load presence subscriptions: %v", err)
+		return
+	}
+	if len(jids) == 0 {
+		return
+	}
+	ctx := context.Background()
+	c.sendOwnPresence(ctx)
+	for _, s := range jids {
+		jid, err := types.ParseJID(s)
+		if err != nil {
+			continue
+		}
+		if err := c.subscribePresence(ctx, jid); err != nil {
+			c.Logger.Warnf("Failed to renew presence subscription of %s: %v", s, err)
+		}
+	}
+}
+
+// sendOwnPresence marks us online, as the server only delivers presence to
+// clients that are themselves online.
+func (c *Client) sendOwnPresence(ctx context.Context) {
+	ctx, done := withTimeout(ctx, c.Timeouts.Request, "sending own presence")
+	if err := done(c.WA.SendPresence(ctx, types.PresenceAvailable)); err != nil {
+		c.Logger.Warnf("Failed to send own presence: %v", err)
+	}
+}
+
+// subscribePresence subscribes to the presence of jid within the request
+// timeout.
+func (c *Client) subscribePresence(ctx context.Context, jid types.JID) error {
+	ctx, done := withTimeout(ctx, c.Timeouts.Request, "subscribing to presence")
+	return done(c.WA.SubscribePresence(ctx, jid))
+}
@@ -0,0 +1,117 @@
+package wa
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"os"
+
+	"go.mau.fi/whatsmeow/appstate"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Profile pictures are square JPEGs; WhatsApp keeps at most 640x640.
+const (
+	profilePictureSize    = 640
+	profilePictureQuality = 90
+)
+
+// SetProfileName changes the push name other users see for this account.
+func (c *Client) SetProfileName(ctx context.Context, name string) (bool, string) {
+	if !c.IsConnected() {
+		return false, "Not connected to WhatsApp"
+	}
+	if name == "" {
+		return false, "Name must not be empty"
+	}
+
+	if err := c.sendAppState(ctx, appstate.BuildSettingPushName(name)); err != nil {
+		return false, fmt.Sprintf("Failed to set profile name: %v", err)
+	}
+	c.WA.Store.PushName = name
+	if err := c.WA.Store.Save(ctx); err != nil {
+		c.Logger.Warnf("Failed to save push name: %v", err)
+	}
+	return true, fmt.Sprintf("Profile name set to %q", name)
+}
+
+// SetProfileStatus changes the "About" text of this account.
+func (c *Client) SetProfileStatus(ctx context.Context, text string) (bool, string) {
+	if !c.IsConnected() {
+		return false, "Not connected to WhatsApp"
+	}
+
+	ctx, done := withTimeout(ctx, c.Timeouts.Request, "setting the profile status")
+	if err := done(c.WA.SetStatusMessage(ctx, text)); err != nil {
+		return false, fmt.Sprintf("Failed to set profile status: %v", err)
+	}
+	if text == "" {
+		return true, "Profile status cleared"
+	}
+	return true, fmt.Sprintf("Profile status set to %q", text)
+}
+
+// SetProfilePicture sets this account's profile picture from an image file
+// (JPEG, PNG or GIF), cropped to a centered square and scaled to at most
+// 640x640. An empty path removes the picture. The file must lie in an
+// allowed media directory.
+func (c *Client) SetProfilePicture(ctx context.Context, imagePath string) (bool, string) {
+	if !c.IsConnected() {
+		return false, "Not connected to WhatsApp"
+	}
+
+	var avatar []byte
+	if imagePath != "" {
+		path, err := c.allowedMediaPath(imagePath)
+		if err != nil {
+			return false, fmt.Sprintf("Error: %v", err)
+		}
+		if avatar, err = c.profilePicture(path); err != nil {
+			return false, fmt.Sprintf("Error preparing %s: %v", imagePath, err)
+		}
+	}
+
+	// Targeting no JID sets our own picture
+	ctx, done := withTimeout(ctx, c.Timeouts.Request, "setting the profile picture")
+	_, err := c.WA.SetGroupPhoto(ctx, types.EmptyJID, avatar)
+	if err = done(err); err != nil {
+		return false, fmt.Sprintf("Failed to set profile picture: %v", err)
+	}
+	if avatar == nil {
+		return true, "Profile picture removed"
+	}
+	return true, "Profile picture updated"
+}
+
+// profilePicture converts an image file to a profile picture JPEG.
+func (c *Client) profilePicture(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.checkThumbnailSize(data); err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	b := img.Bounds()
+	side := min(b.Dx(), b.Dy())
+	x0, y0 := b.Min.X+(b.Dx()-side)/2, b.Min.Y+(b.Dy()-side)/2
+	// All decoders of the image package return images that can be cropped
+	if sub, ok := img.(interface {
+		SubImage(r image.Rectangle) image.Image
+	}); ok {
+		img = sub.SubImage(image.Rect(x0, y0, x0+side, y0+side))
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, scaleDown(img, profilePictureSize), &jpeg.Options{Quality: profilePictureQuality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
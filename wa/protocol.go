@@ -0,0 +1,78 @@
+package wa
+
+import (
+	"time"
+
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// handleProtocolMessage applies revokes and edits, by us on another device
+// or by other chat members, to the stored message they refer to, and
+// records disappearing-message setting changes and history sync chunks
+// announced by our phone. Other protocol messages carry no chat content and
+// are ignored.
+func handleProtocolMessage(c *Client, msg *events.Message, pm *waProto.ProtocolMessage) {
+	chatJID := msg.Info.Chat.String()
+	if notif := pm.GetHistorySyncNotification(); notif != nil {
+		if msg.Info.IsFromMe {
+			c.queueHistorySync(msg, notif)
+		}
+		return
+	}
+	if pm.GetType() == waProto.ProtocolMessage_EPHEMERAL_SETTING {
+		timer := time.Duration(pm.GetEphemeralExpiration()) * time.Second
+		if err := c.Store.SetChatDisappearingTimer(chatJID, timer); err != nil {
+			c.Logger.Warnf("Failed to record disappearing timer of %s: %v", chatJID, err)
+		}
+		return
+	}
+
+	targetID := pm.GetKey().GetID()
+	if targetID == "" {
+		return
+	}
+
+	switch pm.GetType() {
+	case waProto.ProtocolMessage_REVOKE:
+		var err error
+		if c.DeleteRevoked {
+			err = c.Store.DeleteMessage(targetID, chatJID)
+		} else {
+			err = c.Store.MarkMessageRevoked(targetID, chatJID, msg.Info.Timestamp)
+		}
+		if err != nil {
+			c.Logger.Warnf("Failed to record revoke of %s: %v", targetID, err)
+		}
+
+	case waProto.ProtocolMessage_MESSAGE_EDIT:
+		text := editedText(pm.GetEditedMessage())
+		if text == "" {
+			return
+		}
+		editedAt := msg.Info.Timestamp
+		if ms := pm.GetTimestampMS(); ms > 0 {
+			editedAt = time.UnixMilli(ms)
+		}
+		if err := c.Store.EditMessage(targetID, chatJID, text, editedAt); err != nil {
+			c.Logger.Warnf("Failed to record edit of %s: %v", targetID, err)
+		}
+	}
+}
+
+// editedText returns the new text of an edit: the message text or, for
+// edited media, the new caption.
+func editedText(msg *waProto.Message) string {
+	if text := extractTextContent(msg); text != "" {
+		return text
+	}
+	switch {
+	case msg.GetImageMessage() != nil:
+		return msg.GetImageMessage().GetCaption()
+	case msg.GetVideoMessage() != nil:
+		return msg.GetVideoMessage().GetCaption()
+	case msg.GetDocumentMessage() != nil:
+		return msg.GetDocumentMessage().GetCaption()
+	}
+	return ""
+}
@@ -0,0 +1,118 @@
+package wa
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// maxRateLimitWait is the longest a queued send waits for a free slot;
+// sends that would wait longer are refused so tool calls don't hang.
+const maxRateLimitWait = 2 * time.Minute
+
+// RateLimiter caps how many messages are sent per minute, to each recipient
+// and in total, so an agent can't spam contacts. Each limit is a token bucket
+// that holds a minute's worth of sends and refills continuously.
+type RateLimiter struct {
+	PerChat int  // sends per minute to one recipient, 0 = unlimited
+	Global  int  // sends per minute in total, 0 = unlimited
+	Queue   bool // wait for a free slot instead of refusing
+
+	mu     sync.Mutex
+	chats  map[string]*tokenBucket
+	global tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter creates a limiter. mode is "queue" or "reject".
+func NewRateLimiter(perChat, global int, mode string) *RateLimiter {
+	return &RateLimiter{
+		PerChat: perChat,
+		Global:  global,
+		Queue:   mode == "queue",
+		chats:   make(map[string]*tokenBucket),
+		global:  tokenBucket{tokens: float64(global)},
+	}
+}
+
+// refill adds the tokens earned since the last update, up to perMinute.
+func (b *tokenBucket) refill(now time.Time, perMinute int) {
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Minutes() * float64(perMinute)
+	}
+	b.tokens = min(b.tokens, float64(perMinute))
+	b.last = now
+}
+
+// wait is how long until the bucket holds a whole token.
+func (b *tokenBucket) wait(perMinute int) time.Duration {
+	if perMinute <= 0 || b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / float64(perMinute) * float64(time.Minute))
+}
+
+// Reserve takes a send slot for recipient and returns how long the caller
+// must wait before sending. If ok is false the send is refused (reject mode,
+// or a queue wait longer than maxRateLimitWait), no slot is taken, and wait
+// is how long until one is free.
+func (l *RateLimiter) Reserve(recipient string) (wait time.Duration, ok bool) {
+	if l == nil || (l.PerChat <= 0 && l.Global <= 0) {
+		return 0, true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	var chat *tokenBucket
+	if l.PerChat > 0 {
+		// Full buckets are the same as missing ones
+		for key, b := range l.chats {
+			if b.refill(now, l.PerChat); b.tokens >= float64(l.PerChat) {
+				delete(l.chats, key)
+			}
+		}
+		chat = l.chats[recipient]
+		if chat == nil {
+			chat = &tokenBucket{tokens: float64(l.PerChat), last: now}
+		}
+		wait = chat.wait(l.PerChat)
+	}
+	if l.Global > 0 {
+		l.global.refill(now, l.Global)
+		wait = max(wait, l.global.wait(l.Global))
+	}
+
+	if wait > 0 && (!l.Queue || wait > maxRateLimitWait) {
+		return wait, false
+	}
+	if chat != nil {
+		chat.tokens--
+		l.chats[recipient] = chat
+	}
+	if l.Global > 0 {
+		l.global.tokens--
+	}
+	return wait, true
+}
+
+// rateLimit applies the rate limiter to a send to jid, sleeping while the
+// send is queued. It returns a note about the wait to append to the result,
+// or ok=false and the message to return when the send is refused.
+func (c *Client) rateLimit(jid types.JID) (msg string, ok bool) {
+	wait, ok := c.RateLimit.Reserve(jid.String())
+	if !ok {
+		return fmt.Sprintf("Rate limit reached for %s: not sent, try again in %s", jid, wait.Truncate(time.Second)+time.Second), false
+	}
+	if wait <= 0 {
+		return "", true
+	}
+	time.Sleep(wait)
+	return fmt.Sprintf(" (rate limited: queued for %s)", wait.Round(time.Second)), true
+}
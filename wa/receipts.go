@@ -0,0 +1,116 @@
+package wa
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// MarkMessagesRead sends read receipts (blue ticks) for specific incoming
+// messages of a chat. Messages are looked up in the store to find their
+// senders, since group receipts must name the sender.
+func (c *Client) MarkMessagesRead(ctx context.Context, chatJID string, messageIDs []string) (bool, string) {
+	if !c.IsConnected() {
+		return false, "Not connected to WhatsApp"
+	}
+	if len(messageIDs) == 0 {
+		return false, "At least one message ID must be provided"
+	}
+
+	chat, err := types.ParseJID(chatJID)
+	if err != nil {
+		return false, fmt.Sprintf("Invalid chat JID: %v", err)
+	}
+
+	bySender, skipped, err := c.Store.UnreadSenders(chatJID, messageIDs)
+	if err != nil {
+		return false, err.Error()
+	}
+
+	marked := 0
+	for sender, ids := range bySender {
+		var senderJID types.JID
+		if chat.Server == types.GroupServer {
+			senderJID = c.senderJID(sender)
+		}
+		if err := c.markRead(ctx, ids, chat, senderJID); err != nil {
+			return false, fmt.Sprintf("Failed to send read receipts after marking %d messages: %v", marked, err)
+		}
+		marked += len(ids)
+		if err := c.Store.MarkChatReadThrough(chatJID, ids); err != nil {
+			c.Logger.Warnf("Failed to record read state of %s: %v", chatJID, err)
+		}
+	}
+
+	msg := fmt.Sprintf("Marked %d messages in %s as read", marked, chatJID)
+	if len(skipped) > 0 {
+		msg += fmt.Sprintf(" (skipped %d unknown or own messages: %s)", len(skipped), strings.Join(skipped, ", "))
+	}
+	return marked > 0, msg
+}
+
+// senderJID turns a stored sender (usually just the user part) back into a JID,
+// using the LID map to tell hidden-user senders from phone numbers.
+func (c *Client) senderJID(sender string) types.JID {
+	if strings.Contains(sender, "@") {
+		if jid, err := types.ParseJID(sender); err == nil {
+			return jid
+		}
+	}
+	lid := types.NewJID(sender, types.HiddenUserServer)
+	if pn, err := c.WA.Store.LIDs.GetPNForLID(context.Background(), lid); err == nil && !pn.IsEmpty() {
+		return lid
+	}
+	return types.NewJID(sender, types.DefaultUserServer)
+}
+
+// autoMarkRead sends a read receipt for an incoming message if auto-read is
+// enabled for its chat.
+func (c *Client) autoMarkRead(msg *events.Message) {
+	if c.ReadOnly || msg.Info.IsFromMe || !c.Store.ChatAutoRead(msg.Info.Chat.String()) {
+		return
+	}
+	err := c.markRead(context.Background(), []types.MessageID{msg.Info.ID}, msg.Info.Chat, msg.Info.Sender)
+	if err != nil {
+		c.Logger.Warnf("Failed to auto-mark message %s as read: %v", msg.Info.ID, err)
+		return
+	}
+	if err := c.Store.MarkChatRead(msg.Info.Chat.String(), msg.Info.Timestamp); err != nil {
+		c.Logger.Warnf("Failed to record read state of %s: %v", msg.Info.Chat, err)
+	}
+}
+
+// markRead sends read receipts for messages of sender in chat within the
+// request timeout.
+func (c *Client) markRead(ctx context.Context, ids []types.MessageID, chat, sender types.JID) error {
+	ctx, done := withTimeout(ctx, c.Timeouts.Request, "sending read receipts")
+	return done(c.WA.MarkRead(ctx, ids, time.Now(), chat, sender))
+}
+
+// trackReadState advances the last-read time of a chat when we read it
+// elsewhere: our other devices send read receipts, and sending a message from
+// any device implies the chat was read up to that point.
+func (c *Client) trackReadState(evt interface{}) {
+	var err error
+	switch v := evt.(type) {
+	case *events.Receipt:
+		if !v.IsFromMe || (v.Type != types.ReceiptTypeRead && v.Type != types.ReceiptTypeReadSelf) {
+			return
+		}
+		err = c.Store.MarkChatReadThrough(v.Chat.String(), v.MessageIDs)
+	case *events.Message:
+		if !v.Info.IsFromMe {
+			return
+		}
+		err = c.Store.MarkChatRead(v.Info.Chat.String(), v.Info.Timestamp)
+	default:
+		return
+	}
+	if err != nil {
+		c.Logger.Warnf("Failed to record read state: %v", err)
+	}
+}
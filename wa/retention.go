@@ -0,0 +1,100 @@
+package wa
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/CSCSoftware/wahoo/db"
+)
+
+// retentionInterval is how often StartRetention prunes old messages.
+const retentionInterval = time.Hour
+
+// Retention limits how long stored messages are kept. Chats can override
+// the default with set_chat_retention.
+type Retention struct {
+	Days           int           // messages older than this are deleted; 0 = keep forever
+	VacuumInterval time.Duration // time between VACUUMs of the messages database; 0 = never
+}
+
+func (r Retention) String() string {
+	var parts []string
+	if r.Days > 0 {
+		parts = append(parts, fmt.Sprintf("keep %d days", r.Days))
+	}
+	if r.VacuumInterval > 0 {
+		parts = append(parts, fmt.Sprintf("vacuum every %s", r.VacuumInterval))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// PurgeMessages deletes stored messages and their downloaded media. With
+// dryRun set nothing is deleted, but the result tells what would be.
+func (c *Client) PurgeMessages(opts db.PurgeOpts, dryRun bool) (db.PurgeResult, error) {
+	result, err := c.Store.PurgeMessages(opts, dryRun)
+	if err == nil && !dryRun {
+		c.deletePurgedMedia(result.MediaPaths)
+	}
+	return result, err
+}
+
+// ApplyRetention deletes messages older than their chat's retention, with
+// their downloaded media.
+func (c *Client) ApplyRetention() (db.PurgeResult, error) {
+	result, err := c.Store.ApplyRetention(c.Retention.Days, time.Now())
+	c.deletePurgedMedia(result.MediaPaths)
+	return result, err
+}
+
+// deletePurgedMedia removes the downloaded files of deleted messages.
+func (c *Client) deletePurgedMedia(paths []string) {
+	if len(paths) == 0 {
+		return
+	}
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			c.Logger.Warnf("Failed to delete %s: %v", path, err)
+		}
+		os.Remove(thumbnailPath(path))
+	}
+	removeEmptyDirs(c.MediaDir())
+}
+
+// StartRetention prunes old messages now and then every hour until ctx is
+// done, and vacuums the messages database every r.VacuumInterval.
+func (c *Client) StartRetention(ctx context.Context, r Retention) {
+	lastVacuum := time.Now()
+	run := func() {
+		result, err := c.ApplyRetention()
+		if err != nil {
+			c.Logger.Warnf("Message retention failed: %v", err)
+		} else if result.Messages > 0 {
+			fmt.Fprintf(os.Stderr, "Message retention: deleted %d messages and %d media files\n", result.Messages, len(result.MediaPaths))
+		}
+		if r.VacuumInterval > 0 && time.Since(lastVacuum) >= r.VacuumInterval {
+			if err := c.Store.Vacuum(); err != nil {
+				c.Logger.Warnf("Database vacuum failed: %v", err)
+			}
+			lastVacuum = time.Now()
+		}
+	}
+	c.goWork(func() {
+		run()
+		ticker := time.NewTicker(retentionInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				run()
+			}
+		}
+	})
+	if r.Days > 0 || r.VacuumInterval > 0 {
+		fmt.Fprintf(os.Stderr, "Message retention enabled (%s)\n", r)
+	}
+}
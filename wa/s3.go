@@ -0,0 +1,215 @@
+package wa
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Archive archives media in a bucket of S3 or an S3-compatible store such
+// as MinIO. Requests are signed with AWS Signature Version 4.
+type S3Archive struct {
+	Endpoint  string // e.g. https://s3.eu-central-1.amazonaws.com or http://localhost:9000
+	Region    string // default us-east-1
+	Bucket    string
+	Prefix    string // prepended to object keys
+	AccessKey string
+	SecretKey string
+	PathStyle bool // address the bucket in the path (MinIO) instead of the host name
+}
+
+func (s *S3Archive) Name() string { return "s3" }
+
+// Put uploads a file with a single PUT request.
+func (s *S3Archive) Put(ctx context.Context, key, path, contentType string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", fmt.Errorf("reading %s: %w", path, err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	u, err := s.objectURL(s.Prefix + key)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), f)
+	if err != nil {
+		return "", err
+	}
+	req.ContentLength = info.Size()
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	s.sign(req, hex.EncodeToString(hash.Sum(nil)), time.Now())
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("upload to S3 failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+		return "", fmt.Errorf("S3 returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return u.String(), nil
+}
+
+// PresignGet returns a URL that downloads the object without credentials
+// until it expires (at most 7 days).
+func (s *S3Archive) PresignGet(key string, expires time.Duration) (string, error) {
+	u, err := s.objectURL(s.Prefix + key)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now().UTC()
+	q := url.Values{}
+	q.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	q.Set("X-Amz-Credential", s.AccessKey+"/"+s.scope(now))
+	q.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	q.Set("X-Amz-Expires", fmt.Sprint(int(min(expires, 7*24*time.Hour).Seconds())))
+	q.Set("X-Amz-SignedHeaders", "host")
+	canonical := strings.Join([]string{
+		http.MethodGet,
+		u.EscapedPath(),
+		canonicalQuery(q),
+		"host:" + u.Host + "\n",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	u.RawQuery = canonicalQuery(q) + "&X-Amz-Signature=" + s.signature(now, canonical)
+	return u.String(), nil
+}
+
+// objectURL returns the URL of an object, escaping each segment of the key.
+func (s *S3Archive) objectURL(key string) (*url.URL, error) {
+	endpoint, err := url.Parse(s.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", s.Endpoint)
+	}
+	segments := strings.Split(key, "/")
+	for i, seg := range segments {
+		segments[i] = s3Escape(seg)
+	}
+	host, path := endpoint.Host, strings.Join(segments, "/")
+	if s.PathStyle {
+		path = s3Escape(s.Bucket) + "/" + path
+	} else {
+		host = s.Bucket + "." + host
+	}
+	return url.Parse(endpoint.Scheme + "://" + host + strings.TrimSuffix(endpoint.EscapedPath(), "/") + "/" + path)
+}
+
+// sign adds the Signature Version 4 headers to a request whose body hashes
+// to payloadHash.
+func (s *S3Archive) sign(req *http.Request, payloadHash string, now time.Time) {
+	now = now.UTC()
+	req.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	names := []string{"host"}
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "content-type" || strings.HasPrefix(lower, "x-amz-") {
+			names = append(names, lower)
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signed := strings.Join(names, ";")
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signed,
+		payloadHash,
+	}, "\n")
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, s.scope(now), signed, s.signature(now, canonical)))
+}
+
+func (s *S3Archive) region() string {
+	if s.Region == "" {
+		return "us-east-1"
+	}
+	return s.Region
+}
+
+func (s *S3Archive) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + s.region() + "/s3/aws4_request"
+}
+
+// signature signs a canonical request with a key derived for the day.
+func (s *S3Archive) signature(now time.Time, canonicalRequest string) string {
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + now.Format("20060102T150405Z") + "\n" + s.scope(now) + "\n" + hex.EncodeToString(hash[:])
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), now.Format("20060102"))
+	key = hmacSHA256(key, s.region())
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery encodes query parameters sorted by name, as signed.
+func canonicalQuery(q url.Values) string {
+	names := make([]string, 0, len(q))
+	for name := range q {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var parts []string
+	for _, name := range names {
+		values := append([]string(nil), q[name]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, s3Escape(name)+"="+s3Escape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3Escape percent-encodes everything but unreserved characters, as
+// Signature Version 4 requires.
+func s3Escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || strings.IndexByte("-_.~", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
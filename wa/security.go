@@ -0,0 +1,24 @@
+package wa
+
+import (
+	"context"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// handleIdentityChange records that a contact's security code changed,
+// under their phone number when the LID map knows it.
+func (c *Client) handleIdentityChange(evt *events.IdentityChange) {
+	jid := evt.JID.ToNonAD()
+	if jid.Server == types.HiddenUserServer {
+		if pn, err := c.WA.Store.LIDs.GetPNForLID(context.Background(), jid); err == nil && !pn.IsEmpty() {
+			jid = pn.ToNonAD()
+		}
+	}
+	if err := c.Store.StoreIdentityChange(jid.String(), evt.Timestamp, evt.Implicit); err != nil {
+		c.Logger.Warnf("Failed to record security code change of %s: %v", jid, err)
+		return
+	}
+	c.Logger.Infof("Security code of %s changed", jid)
+}
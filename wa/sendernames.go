@@ -0,0 +1,34 @@
+package wa
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// nameRefreshDelay batches bursts of contact updates (e.g. after pairing)
+// into a single rewrite of the stored sender names.
+const nameRefreshDelay = 2 * time.Second
+
+// scheduleNameRefresh refreshes the precomputed sender names of stored
+// messages shortly after the last contact or identity change.
+func (c *Client) scheduleNameRefresh() {
+	c.nameRefreshMu.Lock()
+	defer c.nameRefreshMu.Unlock()
+	if c.nameRefresh != nil {
+		c.nameRefresh.Reset(nameRefreshDelay)
+		return
+	}
+	c.nameRefresh = time.AfterFunc(nameRefreshDelay, c.refreshSenderNames)
+}
+
+func (c *Client) refreshSenderNames() {
+	n, err := c.Store.RefreshSenderNames()
+	if err != nil {
+		c.Logger.Warnf("Failed to refresh sender names: %v", err)
+		return
+	}
+	if n > 0 {
+		fmt.Fprintf(os.Stderr, "Updated sender names on %d messages\n", n)
+	}
+}
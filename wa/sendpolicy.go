@@ -0,0 +1,146 @@
+package wa
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/CSCSoftware/wahoo/db"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// SendPolicy limits the recipients messages can be sent to. Patterns are
+// JIDs or phone numbers and may contain * and ? wildcards, e.g.
+// "491701234567", "4917*", "*@g.us" or "120363012345678901@g.us". A pattern
+// without @ matches the phone number (user part) of a recipient. Posting a
+// status counts as sending to status@broadcast.
+type SendPolicy struct {
+	Allow []string `json:"allow,omitempty"` // if set, only recipients matching one of these
+	Deny  []string `json:"deny,omitempty"`  // refused even if allowed
+}
+
+// LoadSendPolicy reads a send policy from a JSON file of the form
+// {"allow": [...], "deny": [...]}.
+func LoadSendPolicy(file string) (*SendPolicy, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read send policy: %w", err)
+	}
+	var p SendPolicy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("parse send policy %s: %w", file, err)
+	}
+	for _, pattern := range append(p.Allow, p.Deny...) {
+		if err := ValidSendPattern(pattern); err != nil {
+			return nil, err
+		}
+	}
+	return &p, nil
+}
+
+// ValidSendPattern reports whether pattern is usable in a send policy.
+func ValidSendPattern(pattern string) error {
+	if strings.TrimSpace(pattern) == "" {
+		return fmt.Errorf("empty send policy pattern")
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid send policy pattern %q: %v", pattern, err)
+	}
+	return nil
+}
+
+// Empty reports whether the policy allows every recipient.
+func (p *SendPolicy) Empty() bool {
+	return p == nil || (len(p.Allow) == 0 && len(p.Deny) == 0)
+}
+
+// check returns why a send to the recipient known by jids is refused, or ""
+// if it is allowed.
+func (p *SendPolicy) check(jids []string) string {
+	if p.Empty() {
+		return ""
+	}
+	for _, pattern := range p.Deny {
+		if matchRecipient(pattern, jids) {
+			return fmt.Sprintf("matches denied pattern %q", pattern)
+		}
+	}
+	if len(p.Allow) == 0 {
+		return ""
+	}
+	for _, pattern := range p.Allow {
+		if matchRecipient(pattern, jids) {
+			return ""
+		}
+	}
+	return "not on the allowlist"
+}
+
+// matchRecipient reports whether pattern matches any of the recipient's
+// JIDs. Patterns without @ only match phone number JIDs, not LIDs.
+func matchRecipient(pattern string, jids []string) bool {
+	pattern = strings.TrimPrefix(strings.TrimSpace(pattern), "+")
+	for _, jid := range jids {
+		user, server, ok := strings.Cut(jid, "@")
+		if !ok {
+			continue
+		}
+		subject := jid
+		if !strings.Contains(pattern, "@") {
+			if server != types.DefaultUserServer {
+				continue
+			}
+			subject = user
+		}
+		if ok, _ := path.Match(pattern, subject); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// sendPolicyFromRules builds the policy managed with manage_send_policy.
+func sendPolicyFromRules(rules []db.SendPolicyRule) *SendPolicy {
+	p := &SendPolicy{}
+	for _, r := range rules {
+		if r.Action == db.SendDeny {
+			p.Deny = append(p.Deny, r.Pattern)
+		} else {
+			p.Allow = append(p.Allow, r.Pattern)
+		}
+	}
+	return p
+}
+
+// checkRecipient applies the server's send policy and then the account's
+// (managed with manage_send_policy) to a send to jid, matching the JIDs
+// linked to it as well. It returns why the send is refused, or "".
+func (c *Client) checkRecipient(jid types.JID) string {
+	jids := c.Store.LinkedJIDs(jid.String())
+	if reason := c.SendPolicy.check(jids); reason != "" {
+		return fmt.Sprintf("Sending to %s is not allowed by the server's send policy (%s)", jid, reason)
+	}
+	rules, err := c.Store.ListSendPolicy()
+	if err != nil {
+		return fmt.Sprintf("Sending to %s refused: %v", jid, err)
+	}
+	if reason := sendPolicyFromRules(rules).check(jids); reason != "" {
+		return fmt.Sprintf("Sending to %s is not allowed by the send policy (%s)", jid, reason)
+	}
+	return ""
+}
+
+// allowSend checks a send to jid against the send policies, the group's
+// send restriction and then the rate limiter, with the results of rateLimit.
+func (c *Client) allowSend(jid types.JID) (msg string, ok bool) {
+	if reason := c.checkRecipient(jid); reason != "" {
+		return reason, false
+	}
+	if reason := c.checkGroupSend(jid); reason != "" {
+		return reason, false
+	}
+	return c.rateLimit(jid)
+}
@@ -0,0 +1,69 @@
+package wa
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// shutdownTimeout bounds how long Close waits for in-flight work.
+const shutdownTimeout = 15 * time.Second
+
+// workTracker counts event handlers and background workers that may be
+// writing to the database, so Close can wait for them.
+type workTracker struct {
+	mu      sync.Mutex
+	closing bool
+	wg      sync.WaitGroup
+}
+
+// begin registers a unit of work. Returns false once the client is closing,
+// in which case the work must not start.
+func (w *workTracker) begin() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closing {
+		return false
+	}
+	w.wg.Add(1)
+	return true
+}
+
+func (w *workTracker) done() {
+	w.wg.Done()
+}
+
+// goWork runs fn in a goroutine that Close waits for. Nothing is started
+// once the client is closing.
+func (c *Client) goWork(fn func()) {
+	if !c.work.begin() {
+		return
+	}
+	go func() {
+		defer c.work.done()
+		fn()
+	}()
+}
+
+// Close disconnects from WhatsApp, stops handling events and waits up to
+// shutdownTimeout for event handlers, history sync and background workers
+// to finish. Workers started with a context stop once it is cancelled, so
+// cancel it first.
+func (c *Client) Close() {
+	c.work.mu.Lock()
+	c.work.closing = true
+	c.work.mu.Unlock()
+	c.Disconnect()
+
+	drained := make(chan struct{})
+	go func() {
+		c.work.wg.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(shutdownTimeout):
+		fmt.Fprintf(os.Stderr, "Shutdown: work of account %s still running after %s, closing anyway\n", c.AccountName, shutdownTimeout)
+	}
+}
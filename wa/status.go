@@ -0,0 +1,99 @@
+package wa
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.mau.fi/whatsmeow"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// SendStatus posts a status update. If imagePath is set the image is posted
+// with text as its caption; otherwise text is posted as a text status.
+func (c *Client) SendStatus(ctx context.Context, text, imagePath string) (bool, string) {
+	if !c.IsConnected() {
+		return false, "Not connected to WhatsApp"
+	}
+
+	note, ok := c.allowSend(types.StatusBroadcastJID)
+	if !ok {
+		return false, note
+	}
+
+	msg := &waProto.Message{}
+	if imagePath == "" {
+		if text == "" {
+			return false, "Text or image must be provided"
+		}
+		msg.ExtendedTextMessage = &waProto.ExtendedTextMessage{Text: proto.String(text)}
+	} else {
+		imagePath, err := c.allowedMediaPath(imagePath)
+		if err != nil {
+			return false, fmt.Sprintf("Error: %v", err)
+		}
+		data, err := os.ReadFile(imagePath)
+		if err != nil {
+			return false, fmt.Sprintf("Error reading image file: %v", err)
+		}
+		mediaType, mimeType := detectMediaType(imagePath, data, "")
+		if mediaType != whatsmeow.MediaImage {
+			return false, fmt.Sprintf("Only images can be posted as status, got %s", mimeType)
+		}
+		if err := checkMediaSize(imagePath, whatsmeow.MediaImage, int64(len(data))); err != nil {
+			return false, fmt.Sprintf("Error: %v", err)
+		}
+		resp, err := c.uploadWithRetry(ctx, "upload", func(ctx context.Context) (whatsmeow.UploadResponse, error) {
+			return c.WA.Upload(ctx, data, whatsmeow.MediaImage)
+		})
+		if err != nil {
+			return false, fmt.Sprintf("Error uploading image: %v", err)
+		}
+		msg.ImageMessage = &waProto.ImageMessage{
+			Caption:       proto.String(text),
+			Mimetype:      proto.String(mimeType),
+			URL:           &resp.URL,
+			DirectPath:    &resp.DirectPath,
+			MediaKey:      resp.MediaKey,
+			FileEncSHA256: resp.FileEncSHA256,
+			FileSHA256:    resp.FileSHA256,
+			FileLength:    &resp.FileLength,
+		}
+	}
+
+	resp, err := c.sendTracked(ctx, types.StatusBroadcastJID, msg)
+	if err != nil {
+		return false, fmt.Sprintf("Error posting status: %v%s", err, c.healthWarning())
+	}
+	return true, fmt.Sprintf("Status %s posted%s%s", resp.ID, note, c.healthWarning())
+}
+
+// handleStatusMessage stores a contact's status update instead of treating
+// status@broadcast as a regular chat.
+func handleStatusMessage(c *Client, msg *events.Message) {
+	if msg.Info.IsFromMe {
+		return
+	}
+
+	content := extractTextContent(msg.Message)
+	if content == "" {
+		content = msg.Message.GetImageMessage().GetCaption()
+	}
+	if content == "" {
+		content = msg.Message.GetVideoMessage().GetCaption()
+	}
+	mediaType, _, _, _, _, _, _ := extractMediaInfo(msg.Message)
+	if content == "" && mediaType == "" {
+		return // e.g. status revocations
+	}
+
+	sender := msg.Info.Sender.User
+	if err := c.Store.StoreStatus(msg.Info.ID, sender, content, mediaType, msg.Info.Timestamp); err != nil {
+		c.Logger.Warnf("Failed to store status: %v", err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "[%s] Status from %s\n", msg.Info.Timestamp.Format("2006-01-02 15:04:05"), sender)
+}
@@ -0,0 +1,58 @@
+package wa
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var templatePlaceholder = regexp.MustCompile(`\{\{\s*(\w+)\s*\}\}`)
+
+// TemplatePlaceholders returns the names of the {{placeholders}} in a
+// template body, in order of first use.
+func TemplatePlaceholders(body string) []string {
+	names := []string{}
+	for _, m := range templatePlaceholder.FindAllStringSubmatch(body, -1) {
+		if !slices.Contains(names, m[1]) {
+			names = append(names, m[1])
+		}
+	}
+	return names
+}
+
+// renderTemplate replaces each {{name}} in body with vars[name]. As with
+// broadcasts, a placeholder without a value is an error.
+func renderTemplate(body string, vars map[string]string) (string, error) {
+	var missing []string
+	text := templatePlaceholder.ReplaceAllStringFunc(body, func(m string) string {
+		name := templatePlaceholder.FindStringSubmatch(m)[1]
+		v, ok := vars[name]
+		if !ok && !slices.Contains(missing, "{{"+name+"}}") {
+			missing = append(missing, "{{"+name+"}}")
+		}
+		return v
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("no value for %s", strings.Join(missing, ", "))
+	}
+	return text, nil
+}
+
+// SendTemplate fills the stored template name with vars and sends the text
+// to recipient like SendMessage.
+func (c *Client) SendTemplate(ctx context.Context, recipient, name string, vars map[string]string, force bool) (success, queued bool, msg string) {
+	tmpl, err := c.Store.GetTemplate(name)
+	if err != nil {
+		return false, false, fmt.Sprintf("Error loading template: %v", err)
+	}
+	if tmpl == nil {
+		return false, false, fmt.Sprintf("No template named %q (see list_templates)", name)
+	}
+	text, err := renderTemplate(tmpl.Body, vars)
+	if err != nil {
+		return false, false, fmt.Sprintf("Template %s not sent: %v", name, err)
+	}
+	return c.SendMessage(ctx, recipient, text, nil, force)
+}
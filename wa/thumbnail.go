@@ -0,0 +1,175 @@
+package wa
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // register decoders for image.Decode
+	"image/jpeg"
+	_ "image/png"
+	"os"
+	"os/exec"
+)
+
+const (
+	thumbnailSize    = 100 // longest side of generated thumbnails in pixels
+	thumbnailQuality = 60
+
+	// thumbnailSamples is the number of source pixels averaged per axis for
+	// each thumbnail pixel, enough to avoid aliasing without reading every
+	// pixel of large photos.
+	thumbnailSamples = 4
+)
+
+// imageThumbnail decodes a JPEG, PNG or GIF image and returns its size and a
+// downscaled JPEG thumbnail.
+func imageThumbnail(data []byte) (thumb []byte, width, height int, err error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	b := img.Bounds()
+	thumb, err = encodeThumbnail(img)
+	return thumb, b.Dx(), b.Dy(), err
+}
+
+// videoThumbnail grabs the first frame of a video with ffmpeg and returns the
+// video size and a JPEG thumbnail of the frame.
+func videoThumbnail(videoPath string) (thumb []byte, width, height int, err error) {
+	cmd := exec.Command("ffmpeg", "-loglevel", "error", "-i", videoPath,
+		"-frames:v", "1", "-f", "image2pipe", "-c:v", "png", "-")
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, 0, 0, fmt.Errorf("ffmpeg frame grab failed: %w", err)
+	}
+	return imageThumbnail(out.Bytes())
+}
+
+// encodeThumbnail scales img to fit thumbnailSize and encodes it as JPEG.
+func encodeThumbnail(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, scaleDown(img, thumbnailSize), &jpeg.Options{Quality: thumbnailQuality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// scaleDown shrinks img so its longest side is at most size, averaging a
+// grid of source samples per destination pixel. Smaller images are copied
+// unscaled.
+func scaleDown(img image.Image, size int) *image.RGBA {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if w > size || h > size {
+		if w >= h {
+			dw, dh = size, max(1, h*size/w)
+		} else {
+			dw, dh = max(1, w*size/h), size
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := b.Min.Y+y*h/dh, b.Min.Y+(y+1)*h/dh
+		for x := 0; x < dw; x++ {
+			x0, x1 := b.Min.X+x*w/dw, b.Min.X+(x+1)*w/dw
+			var r, g, bl, a, n uint32
+			for sy := 0; sy < thumbnailSamples; sy++ {
+				py := y0 + sy*max(1, y1-y0)/thumbnailSamples
+				for sx := 0; sx < thumbnailSamples; sx++ {
+					px := x0 + sx*max(1, x1-x0)/thumbnailSamples
+					cr, cg, cb, ca := img.At(px, py).RGBA()
+					r, g, bl, a, n = r+cr, g+cg, bl+cb, a+ca, n+1
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{uint8(r / n >> 8), uint8(g / n >> 8), uint8(bl / n >> 8), uint8(a / n >> 8)})
+		}
+	}
+	return dst
+}
+
+// imagePreview returns the thumbnail and size of an uploaded image. In
+// low-memory mode images over LowMemoryMaxThumbnailPixels are skipped.
+func (c *Client) imagePreview(upload *mediaUpload, mediaPath string) (thumb []byte, width, height uint32, err error) {
+	data := upload.fullData(mediaPath)
+	if data == nil {
+		return nil, 0, 0, fmt.Errorf("image too large to load")
+	}
+	if err := c.checkThumbnailSize(data); err != nil {
+		return nil, 0, 0, err
+	}
+	thumb, w, h, err := imageThumbnail(data)
+	return thumb, uint32(w), uint32(h), err
+}
+
+// checkThumbnailSize refuses images too large to decode in low-memory mode.
+func (c *Client) checkThumbnailSize(data []byte) error {
+	if !c.Store.LowMemory() {
+		return nil
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if cfg.Width*cfg.Height > LowMemoryMaxThumbnailPixels {
+		return fmt.Errorf("image too large to decode")
+	}
+	return nil
+}
+
+// videoPreview returns the thumbnail and size of a video file.
+func videoPreview(mediaPath string) (thumb []byte, width, height uint32, err error) {
+	thumb, w, h, err := videoThumbnail(mediaPath)
+	return thumb, uint32(w), uint32(h), err
+}
+
+// thumbnailSuffix is appended to a downloaded media file's path to get the
+// path of its thumbnail.
+const thumbnailSuffix = ".thumb.jpg"
+
+// thumbnailPath is where the thumbnail of a downloaded media file is kept.
+func thumbnailPath(mediaPath string) string {
+	return mediaPath + thumbnailSuffix
+}
+
+// MediaThumbnail returns the thumbnail saved for a downloaded media file, or
+// "" if there is none.
+func MediaThumbnail(mediaPath string) string {
+	path := thumbnailPath(mediaPath)
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+// saveThumbnail writes a thumbnail next to a downloaded image or video and
+// returns its path. Other media types have none.
+func (c *Client) saveThumbnail(mediaPath, mediaType string) (string, error) {
+	var thumb []byte
+	var err error
+	switch mediaType {
+	case "image":
+		var data []byte
+		if data, err = os.ReadFile(mediaPath); err == nil {
+			if err = c.checkThumbnailSize(data); err == nil {
+				thumb, _, _, err = imageThumbnail(data)
+			}
+		}
+	case "video", "gif":
+		thumb, _, _, err = videoThumbnail(mediaPath)
+	default:
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	path := thumbnailPath(mediaPath)
+	if err := os.WriteFile(path, thumb, 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
@@ -0,0 +1,68 @@
+package wa
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Timeouts bound the WhatsApp calls made for a tool call, on top of the
+// caller's context. A zero duration leaves that kind of call bounded only by
+// the caller's context.
+type Timeouts struct {
+	Send     time.Duration // sending a message
+	Media    time.Duration // uploading or downloading one media file
+	AppState time.Duration // chat state changes such as archive, pin, mute and star
+	Request  time.Duration // other requests, such as group, profile, blocklist and presence queries
+}
+
+// DefaultTimeouts are the timeouts of a new client.
+var DefaultTimeouts = Timeouts{
+	Send:     30 * time.Second,
+	Media:    5 * time.Minute,
+	AppState: 30 * time.Second,
+	Request:  30 * time.Second,
+}
+
+// TimeoutError is returned when a WhatsApp call exceeds its timeout or the
+// caller's deadline. The call may still have reached WhatsApp.
+type TimeoutError struct {
+	Op      string
+	Timeout time.Duration // 0 if the caller's deadline was exceeded
+}
+
+func (e *TimeoutError) Error() string {
+	if e.Timeout == 0 {
+		return e.Op + " timed out"
+	}
+	return fmt.Sprintf("%s timed out after %s", e.Op, e.Timeout)
+}
+
+// IsTimeout reports whether err is or wraps a TimeoutError.
+func IsTimeout(err error) bool {
+	var timeout *TimeoutError
+	return errors.As(err, &timeout)
+}
+
+// withTimeout derives the context of a WhatsApp call from ctx. The returned
+// function releases the context and reports an error caused by an exceeded
+// deadline as a TimeoutError naming op.
+func withTimeout(ctx context.Context, timeout time.Duration, op string) (context.Context, func(error) error) {
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < timeout {
+		timeout = 0 // the caller's deadline comes first
+	}
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	return ctx, func(err error) error {
+		defer cancel()
+		if err == nil || !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return err
+		}
+		return &TimeoutError{Op: op, Timeout: max(timeout, 0)}
+	}
+}
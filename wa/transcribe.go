@@ -0,0 +1,210 @@
+package wa
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/CSCSoftware/wahoo/db"
+)
+
+// transcribeTimeout bounds a single call to the transcription backend.
+const transcribeTimeout = 10 * time.Minute
+
+// Transcriber turns an audio file into text.
+type Transcriber interface {
+	Name() string // stored with each transcript
+	Transcribe(ctx context.Context, audioPath string) (string, error)
+}
+
+// WhisperCPP transcribes with a local whisper.cpp binary. Audio is converted
+// to 16 kHz mono WAV with ffmpeg first, as whisper.cpp requires.
+type WhisperCPP struct {
+	Binary   string // e.g. whisper-cli
+	Model    string // path to a ggml model file
+	Language string // spoken language code; empty = auto-detect
+}
+
+func (w *WhisperCPP) Name() string { return "whisper.cpp" }
+
+func (w *WhisperCPP) Transcribe(ctx context.Context, audioPath string) (string, error) {
+	wav, err := os.CreateTemp("", "wahoo-*.wav")
+	if err != nil {
+		return "", err
+	}
+	wav.Close()
+	defer os.Remove(wav.Name())
+
+	convert := exec.CommandContext(ctx, "ffmpeg", "-y", "-loglevel", "error", "-i", audioPath,
+		"-ar", "16000", "-ac", "1", "-c:a", "pcm_s16le", wav.Name())
+	convert.Stderr = os.Stderr
+	if err := convert.Run(); err != nil {
+		return "", fmt.Errorf("ffmpeg conversion failed: %w", err)
+	}
+
+	lang := w.Language
+	if lang == "" {
+		lang = "auto"
+	}
+	out, err := exec.CommandContext(ctx, w.Binary, "-m", w.Model, "-f", wav.Name(), "-l", lang, "-nt", "-np").Output()
+	if err != nil {
+		return "", fmt.Errorf("%s failed: %w", filepath.Base(w.Binary), err)
+	}
+	return strings.Join(strings.Fields(string(out)), " "), nil
+}
+
+// HTTPTranscriber posts audio to an OpenAI-compatible
+// /v1/audio/transcriptions endpoint.
+type HTTPTranscriber struct {
+	URL      string
+	APIKey   string // sent as a bearer token if set
+	Model    string // default whisper-1
+	Language string // spoken language code; empty = auto-detect
+}
+
+func (h *HTTPTranscriber) Name() string {
+	if u, err := url.Parse(h.URL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return "http"
+}
+
+func (h *HTTPTranscriber) Transcribe(ctx context.Context, audioPath string) (string, error) {
+	f, err := os.Open(audioPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	model := h.Model
+	if model == "" {
+		model = "whisper-1"
+	}
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", filepath.Base(audioPath))
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(part, f); err != nil {
+		return "", fmt.Errorf("reading audio: %w", err)
+	}
+	form.WriteField("model", model)
+	form.WriteField("response_format", "json")
+	if h.Language != "" {
+		form.WriteField("language", h.Language)
+	}
+	if err := form.Close(); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, &body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	if h.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+h.APIKey)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("transcription request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("transcription API returned %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	var result struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return "", fmt.Errorf("invalid transcription response: %w", err)
+	}
+	return strings.TrimSpace(result.Text), nil
+}
+
+// TranscribeAudio transcribes an audio message, downloading it first if
+// needed, and stores the transcript. An existing transcript is returned
+// unless force is set.
+func (c *Client) TranscribeAudio(ctx context.Context, chatJID, messageID string, force bool) (*db.Transcript, error) {
+	if c.Transcriber == nil {
+		return nil, fmt.Errorf("transcription is not configured (start the server with -transcribe-cmd or -transcribe-url)")
+	}
+	if !force {
+		if t, err := c.Store.GetTranscript(messageID, chatJID); err != nil || t != nil {
+			return t, err
+		}
+	}
+
+	_, _, _, _, _, mediaType, _, err := c.Store.GetMediaInfo(messageID, chatJID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find message: %w", err)
+	}
+	if mediaType != "audio" {
+		return nil, fmt.Errorf("not an audio message")
+	}
+
+	// Use an earlier download if it is still there, even while offline
+	path := c.Store.MediaLocalPath(messageID, chatJID)
+	if _, statErr := os.Stat(path); path == "" || statErr != nil {
+		if path, err = c.DownloadMedia(ctx, messageID, chatJID); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, transcribeTimeout)
+	defer cancel()
+	text, err := c.Transcriber.Transcribe(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	t := db.Transcript{MessageID: messageID, ChatJID: chatJID, Text: text, Backend: c.Transcriber.Name(), CreatedAt: now.Format(time.RFC3339)}
+	if err := c.Store.SaveTranscript(t, now); err != nil {
+		return nil, fmt.Errorf("failed to store transcript: %w", err)
+	}
+	return &t, nil
+}
+
+// StartAutoTranscribe transcribes incoming audio messages in the background
+// until ctx is done. Transcriber must be set.
+func (c *Client) StartAutoTranscribe(ctx context.Context) {
+	jobs := make(chan downloadJob, 100)
+	c.goWork(func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case job := <-jobs:
+				if _, err := c.TranscribeAudio(ctx, job.chatJID, job.messageID, false); err != nil {
+					c.Logger.Warnf("Transcription of %s failed: %v", job.messageID, err)
+				}
+			}
+		}
+	})
+	c.transcribeJobs = jobs
+	fmt.Fprintf(os.Stderr, "Auto-transcription enabled (%s)\n", c.Transcriber.Name())
+}
+
+// enqueueTranscription schedules an incoming audio message for transcription.
+// Drops the job if the queue is full; transcribe_audio still works later.
+func (c *Client) enqueueTranscription(messageID, chatJID string) {
+	select {
+	case c.transcribeJobs <- downloadJob{messageID: messageID, chatJID: chatJID}:
+	default:
+		c.Logger.Warnf("Transcription queue full, skipping %s", messageID)
+	}
+}
@@ -0,0 +1,144 @@
+package wa
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+)
+
+// mediaSizeLimits are the largest files WhatsApp accepts per media type:
+// 16 MB for photos, videos and voice messages, 2 GB for documents.
+var mediaSizeLimits = map[whatsmeow.MediaType]struct {
+	kind  string
+	bytes int64
+}{
+	whatsmeow.MediaImage:    {"images", 16 << 20},
+	whatsmeow.MediaVideo:    {"videos", 16 << 20},
+	whatsmeow.MediaAudio:    {"audio files", 16 << 20},
+	whatsmeow.MediaDocument: {"documents", 2 << 30},
+}
+
+// streamUploadBytes is the size above which media files are uploaded
+// straight from disk instead of being read into memory first.
+const streamUploadBytes = 16 << 20
+
+// Transient upload failures are retried: uploadAttempts tries in all, the
+// first retry after uploadBackoff, doubling for each further one. Each try
+// uploads the whole file, as WhatsApp's media servers take a file in one
+// request.
+const (
+	uploadAttempts = 3
+	uploadBackoff  = 2 * time.Second
+)
+
+// mediaUpload is an uploaded file. Data holds the file contents unless the
+// upload was streamed, in which case it holds at most the first 512 bytes.
+type mediaUpload struct {
+	Type     whatsmeow.MediaType
+	MimeType string
+	Data     []byte
+	Streamed bool
+	Resp     whatsmeow.UploadResponse
+}
+
+// checkMediaSize refuses a file larger than WhatsApp accepts for its type.
+func checkMediaSize(mediaPath string, mediaType whatsmeow.MediaType, size int64) error {
+	limit, ok := mediaSizeLimits[mediaType]
+	if !ok || size <= limit.bytes {
+		return nil
+	}
+	hint := ""
+	if mediaType != whatsmeow.MediaDocument {
+		hint = " (send it as a document by setting mime_type to application/octet-stream)"
+	}
+	return fmt.Errorf("%s is %d MB, but WhatsApp accepts %s up to %d MB%s",
+		filepath.Base(mediaPath), size>>20, limit.kind, limit.bytes>>20, hint)
+}
+
+// uploadFile uploads a media file, retrying transient failures. Files larger
+// than streamUploadBytes, and in low-memory mode all files, are streamed from
+// disk instead of being read into memory; only their first bytes are read to
+// detect the content type.
+func (c *Client) uploadFile(ctx context.Context, mediaPath, mimeOverride string) (*mediaUpload, error) {
+	f, err := os.Open(mediaPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading media file: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("reading media file: %w", err)
+	}
+
+	upload := &mediaUpload{Streamed: c.Store.LowMemory() || info.Size() > streamUploadBytes}
+	if upload.Streamed {
+		head := make([]byte, 512)
+		n, err := io.ReadFull(f, head)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			return nil, fmt.Errorf("reading media file: %w", err)
+		}
+		upload.Data = head[:n]
+	} else if upload.Data, err = io.ReadAll(f); err != nil {
+		return nil, fmt.Errorf("reading media file: %w", err)
+	}
+	upload.Type, upload.MimeType = detectMediaType(mediaPath, upload.Data, mimeOverride)
+	if err := checkMediaSize(mediaPath, upload.Type, info.Size()); err != nil {
+		return nil, err
+	}
+
+	upload.Resp, err = c.uploadWithRetry(ctx, "upload", func(ctx context.Context) (whatsmeow.UploadResponse, error) {
+		if !upload.Streamed {
+			return c.WA.Upload(ctx, upload.Data, upload.Type)
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return whatsmeow.UploadResponse{}, err
+		}
+		return c.WA.UploadReader(ctx, f, nil, upload.Type)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("uploading media: %w", err)
+	}
+	return upload, nil
+}
+
+// uploadWithRetry runs upload, each try within the media timeout, until it
+// succeeds, uploadAttempts tries have failed or ctx is done.
+func (c *Client) uploadWithRetry(ctx context.Context, op string, upload func(context.Context) (whatsmeow.UploadResponse, error)) (whatsmeow.UploadResponse, error) {
+	backoff := uploadBackoff
+	for attempt := 1; ; attempt++ {
+		attemptCtx, done := withTimeout(ctx, c.Timeouts.Media, op)
+		resp, err := upload(attemptCtx)
+		err = done(err)
+		if err == nil || attempt == uploadAttempts || ctx.Err() != nil {
+			return resp, err
+		}
+		c.Logger.Warnf("Upload failed (try %d of %d), retrying in %s: %v", attempt, uploadAttempts, backoff, err)
+		select {
+		case <-ctx.Done():
+			return resp, err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// fullData returns the complete file contents of an upload for analysis, or
+// nil if the upload was streamed and the file exceeds LowMemoryMaxAnalyzeBytes.
+func (u *mediaUpload) fullData(mediaPath string) []byte {
+	if !u.Streamed {
+		return u.Data
+	}
+	if info, err := os.Stat(mediaPath); err != nil || info.Size() > LowMemoryMaxAnalyzeBytes {
+		return nil
+	}
+	data, err := os.ReadFile(mediaPath)
+	if err != nil {
+		return nil
+	}
+	return data
+}
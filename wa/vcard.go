@@ -0,0 +1,75 @@
+package wa
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+// buildVCard builds a minimal vCard for a contact. The waid parameter lets
+// WhatsApp show "Message" and "Add contact" buttons for the number.
+func buildVCard(name, phone string) string {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, phone)
+	return fmt.Sprintf("BEGIN:VCARD\nVERSION:3.0\nFN:%s\nTEL;type=CELL;waid=%s:+%s\nEND:VCARD", name, digits, digits)
+}
+
+// vCardName returns the formatted name (FN) of a vCard, if any.
+func vCardName(vcard string) string {
+	for _, line := range strings.Split(vcard, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if key, value, ok := strings.Cut(line, ":"); ok && strings.EqualFold(strings.SplitN(key, ";", 2)[0], "FN") {
+			return value
+		}
+	}
+	return ""
+}
+
+// SendContactCard shares a contact. Either vcard is sent as-is, or a vCard is
+// built from name and phone.
+func (c *Client) SendContactCard(ctx context.Context, recipient, name, phone, vcard string) (bool, string) {
+	if !c.IsConnected() {
+		return false, "Not connected to WhatsApp"
+	}
+
+	if vcard == "" {
+		if name == "" || phone == "" {
+			return false, "Either vcard or both name and phone must be provided"
+		}
+		vcard = buildVCard(name, phone)
+	} else if !strings.HasPrefix(strings.TrimSpace(vcard), "BEGIN:VCARD") {
+		return false, "vcard must start with BEGIN:VCARD"
+	}
+	if name == "" {
+		name = vCardName(vcard)
+	}
+
+	jid, err := parseRecipient(recipient)
+	if err != nil {
+		return false, err.Error()
+	}
+
+	note, ok := c.allowSend(jid)
+	if !ok {
+		return false, note
+	}
+
+	msg := &waProto.Message{
+		ContactMessage: &waProto.ContactMessage{
+			DisplayName: proto.String(name),
+			Vcard:       proto.String(vcard),
+		},
+	}
+	_, err = c.sendTracked(ctx, jid, msg)
+	if err != nil {
+		return false, fmt.Sprintf("Error sending contact card: %v%s", err, c.healthWarning())
+	}
+	return true, fmt.Sprintf("Contact card %s sent to %s%s%s", name, recipient, note, c.healthWarning())
+}
@@ -0,0 +1,190 @@
+package wa
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// videoInfo is the metadata WhatsApp shows for a video before it is played.
+type videoInfo struct {
+	Seconds uint32
+	Width   uint32 // display size, rotation applied
+	Height  uint32
+}
+
+// probeVideo reads the duration and display size of a video, using ffprobe
+// if it is installed and the MP4 headers otherwise.
+func probeVideo(path string) (videoInfo, error) {
+	if info, err := ffprobeVideo(path); err == nil {
+		return info, nil
+	}
+	return parseMP4(path)
+}
+
+// ffprobeVideo reads video metadata with ffprobe.
+func ffprobeVideo(path string) (videoInfo, error) {
+	out, err := exec.Command("ffprobe", "-v", "error", "-select_streams", "v:0",
+		"-show_entries", "stream=width,height:stream_side_data=rotation:format=duration",
+		"-of", "json", path).Output()
+	if err != nil {
+		return videoInfo{}, fmt.Errorf("ffprobe failed: %w", err)
+	}
+
+	var probe struct {
+		Streams []struct {
+			Width        uint32 `json:"width"`
+			Height       uint32 `json:"height"`
+			SideDataList []struct {
+				Rotation int `json:"rotation"`
+			} `json:"side_data_list"`
+		} `json:"streams"`
+		Format struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
+	}
+	if err := json.Unmarshal(out, &probe); err != nil {
+		return videoInfo{}, fmt.Errorf("invalid ffprobe output: %w", err)
+	}
+	if len(probe.Streams) == 0 {
+		return videoInfo{}, fmt.Errorf("no video stream")
+	}
+
+	s := probe.Streams[0]
+	info := videoInfo{Width: s.Width, Height: s.Height}
+	for _, sd := range s.SideDataList {
+		if sd.Rotation%180 != 0 {
+			info.Width, info.Height = info.Height, info.Width
+		}
+	}
+	if d, err := strconv.ParseFloat(probe.Format.Duration, 64); err == nil {
+		info.Seconds = uint32(math.Round(d))
+	}
+	return info, nil
+}
+
+// parseMP4 reads video metadata from the moov box of an MP4/MOV file: the
+// duration from mvhd and the size from the first track header with one.
+func parseMP4(path string) (videoInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return videoInfo{}, err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return videoInfo{}, err
+	}
+
+	var info videoInfo
+	var foundMoov bool
+	err = walkBoxes(f, 0, st.Size(), func(typ string, start, end int64) error {
+		if typ != "moov" {
+			return nil
+		}
+		foundMoov = true
+		return walkBoxes(f, start, end, func(typ string, start, end int64) error {
+			switch typ {
+			case "mvhd":
+				info.Seconds = readMvhdSeconds(f, start)
+			case "trak":
+				if info.Width != 0 {
+					return nil
+				}
+				return walkBoxes(f, start, end, func(typ string, start, end int64) error {
+					if typ == "tkhd" {
+						info.Width, info.Height = readTkhdSize(f, start)
+					}
+					return nil
+				})
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return videoInfo{}, err
+	}
+	if !foundMoov {
+		return videoInfo{}, fmt.Errorf("not an MP4 file")
+	}
+	return info, nil
+}
+
+// walkBoxes calls fn with the type and content range of each box between
+// start and end.
+func walkBoxes(r io.ReaderAt, start, end int64, fn func(typ string, start, end int64) error) error {
+	header := make([]byte, 16)
+	for pos := start; pos+8 <= end; {
+		if _, err := r.ReadAt(header[:8], pos); err != nil {
+			return fmt.Errorf("reading MP4 box: %w", err)
+		}
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		typ := string(header[4:8])
+		contentStart := pos + 8
+		switch size {
+		case 0: // box extends to the end
+			size = end - pos
+		case 1: // 64-bit size follows the type
+			if _, err := r.ReadAt(header[8:16], pos+8); err != nil {
+				return fmt.Errorf("reading MP4 box: %w", err)
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+			contentStart += 8
+		}
+		if size < contentStart-pos || pos+size > end {
+			return fmt.Errorf("invalid MP4 box %q", typ)
+		}
+		if err := fn(typ, contentStart, pos+size); err != nil {
+			return err
+		}
+		pos += size
+	}
+	return nil
+}
+
+// readMvhdSeconds returns the movie duration from an mvhd box, or 0.
+func readMvhdSeconds(r io.ReaderAt, start int64) uint32 {
+	buf := make([]byte, 32)
+	if _, err := r.ReadAt(buf, start); err != nil {
+		return 0
+	}
+	var timescale, duration uint64
+	if buf[0] == 1 { // version 1: 64-bit creation/modification times and duration
+		timescale = uint64(binary.BigEndian.Uint32(buf[20:24]))
+		duration = binary.BigEndian.Uint64(buf[24:32])
+	} else {
+		timescale = uint64(binary.BigEndian.Uint32(buf[12:16]))
+		duration = uint64(binary.BigEndian.Uint32(buf[16:20]))
+	}
+	if timescale == 0 {
+		return 0
+	}
+	return uint32(math.Round(float64(duration) / float64(timescale)))
+}
+
+// readTkhdSize returns the display size from a tkhd box, swapping width
+// and height if the track matrix rotates by 90 or 270 degrees. Audio
+// tracks have a size of 0.
+func readTkhdSize(r io.ReaderAt, start int64) (width, height uint32) {
+	buf := make([]byte, 96)
+	n, _ := r.ReadAt(buf, start)
+	offset := 40 // version 0: times and duration are 32-bit
+	if n > 0 && buf[0] == 1 {
+		offset = 52
+	}
+	if n < offset+44 {
+		return 0, 0
+	}
+	matrixA := int32(binary.BigEndian.Uint32(buf[offset : offset+4]))
+	width = binary.BigEndian.Uint32(buf[offset+36:offset+40]) >> 16 // 16.16 fixed point
+	height = binary.BigEndian.Uint32(buf[offset+40:offset+44]) >> 16
+	if matrixA == 0 {
+		width, height = height, width
+	}
+	return width, height
+}
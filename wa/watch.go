@@ -0,0 +1,78 @@
+package wa
+
+import (
+	"strings"
+
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// checkWatchRules records a hit for every watch rule the stored message matches
+// and notifies the OnWatchHit hook.
+func checkWatchRules(c *Client, msg *events.Message, content string, mentionsMe bool) {
+	if msg.Info.IsFromMe {
+		return
+	}
+
+	rules, err := c.Store.ListWatchRules()
+	if err != nil || len(rules) == 0 {
+		return
+	}
+
+	chatJID := msg.Info.Chat.String()
+	sender := msg.Info.Sender.User
+
+	for _, rule := range rules {
+		if !rule.Matches(chatJID, sender, content, mentionsMe) {
+			continue
+		}
+		if err := c.Store.StoreWatchHit(rule.Name, msg.Info.ID, chatJID, msg.Info.Timestamp); err != nil {
+			c.Logger.Warnf("Failed to store watch hit for %s: %v", rule.Name, err)
+			continue
+		}
+		if c.OnWatchHit != nil {
+			c.OnWatchHit(rule.Name)
+		}
+	}
+}
+
+// mentionsMe reports whether the message @-mentions our own account (phone or LID).
+func (c *Client) mentionsMe(msg *waProto.Message) bool {
+	if c.WA.Store.ID == nil {
+		return false
+	}
+	own := map[string]bool{c.WA.Store.ID.User: true}
+	if !c.WA.Store.LID.IsEmpty() {
+		own[c.WA.Store.LID.User] = true
+	}
+
+	for _, jid := range contextInfo(msg).GetMentionedJID() {
+		if idx := strings.IndexByte(jid, '@'); idx > 0 && own[jid[:idx]] {
+			return true
+		}
+	}
+	return false
+}
+
+// contextInfo returns the ContextInfo of the message's main payload, if any.
+func contextInfo(msg *waProto.Message) *waProto.ContextInfo {
+	switch {
+	case msg.GetExtendedTextMessage() != nil:
+		return msg.GetExtendedTextMessage().GetContextInfo()
+	case msg.GetImageMessage() != nil:
+		return msg.GetImageMessage().GetContextInfo()
+	case msg.GetVideoMessage() != nil:
+		return msg.GetVideoMessage().GetContextInfo()
+	case msg.GetAudioMessage() != nil:
+		return msg.GetAudioMessage().GetContextInfo()
+	case msg.GetDocumentMessage() != nil:
+		return msg.GetDocumentMessage().GetContextInfo()
+	case msg.GetStickerMessage() != nil:
+		return msg.GetStickerMessage().GetContextInfo()
+	case msg.GetLocationMessage() != nil:
+		return msg.GetLocationMessage().GetContextInfo()
+	case msg.GetContactMessage() != nil:
+		return msg.GetContactMessage().GetContextInfo()
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package wa
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os/exec"
+)
+
+// Voice message waveforms have waveformBuckets amplitudes from 0 to 100.
+// Audio is decoded at waveformSampleRate, plenty for amplitudes, and
+// measured in frames of waveformFrameSamples before being divided into
+// buckets, as the duration is only known once it is decoded.
+const (
+	waveformBuckets      = 64
+	waveformSampleRate   = 8000
+	waveformFrameSamples = waveformSampleRate / 20
+)
+
+// audioWaveform decodes an audio file to PCM with ffmpeg and returns its
+// waveform; see pcmWaveform.
+func audioWaveform(path string) ([]byte, error) {
+	cmd := exec.Command("ffmpeg", "-v", "error", "-i", path,
+		"-ac", "1", "-ar", fmt.Sprint(waveformSampleRate), "-f", "s16le", "-")
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	waveform, err := pcmWaveform(out)
+	// Drain the output so ffmpeg can exit if reading stopped early
+	io.Copy(io.Discard, out)
+	if waitErr := cmd.Wait(); err == nil && waitErr != nil {
+		err = fmt.Errorf("ffmpeg decoding failed: %w", waitErr)
+	}
+	return waveform, err
+}
+
+// pcmWaveform computes a waveform from mono 16-bit little-endian PCM: the RMS
+// amplitude of each of waveformBuckets equal parts, scaled so the loudest part
+// is 100.
+func pcmWaveform(r io.Reader) ([]byte, error) {
+	type frame struct {
+		sumSquares float64
+		samples    int
+	}
+	var frames []frame
+	var cur frame
+	br := bufio.NewReader(r)
+	var sample [2]byte
+	for {
+		if _, err := io.ReadFull(br, sample[:]); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			return nil, err
+		}
+		s := float64(int16(binary.LittleEndian.Uint16(sample[:])))
+		cur.sumSquares += s * s
+		cur.samples++
+		if cur.samples == waveformFrameSamples {
+			frames = append(frames, cur)
+			cur = frame{}
+		}
+	}
+	if cur.samples > 0 {
+		frames = append(frames, cur)
+	}
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("no audio samples")
+	}
+
+	levels := make([]float64, waveformBuckets)
+	var loudest float64
+	for i := range levels {
+		// Audio shorter than a frame per bucket repeats frames
+		start := i * len(frames) / waveformBuckets
+		end := max((i+1)*len(frames)/waveformBuckets, start+1)
+		var b frame
+		for _, f := range frames[start:end] {
+			b.sumSquares += f.sumSquares
+			b.samples += f.samples
+		}
+		levels[i] = math.Sqrt(b.sumSquares / float64(b.samples))
+		loudest = max(loudest, levels[i])
+	}
+
+	waveform := make([]byte, waveformBuckets)
+	if loudest == 0 {
+		return waveform, nil // silence
+	}
+	for i, l := range levels {
+		waveform[i] = byte(math.Round(l / loudest * 100))
+	}
+	return waveform, nil
+}